@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	azproviderv2 "github.com/virtual-kubelet/azure-aci/pkg/provider"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaderElectionLeaseDuration = 15 * time.Second
+	leaderElectionRenewDeadline = 10 * time.Second
+	leaderElectionRetryPeriod   = 2 * time.Second
+)
+
+// runLeaderElection keeps the provider in standby until this replica holds the lease of the node, and switches it back
+// to standby when the lease is lost. The lease is named after the node, so that each virtual node elects its own leader.
+func runLeaderElection(ctx context.Context, client kubernetes.Interface, p *azproviderv2.ACIProvider, namespace string) error {
+	identity := os.Getenv("VKUBELET_POD_NAME")
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		identity = hostname
+	}
+
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, nodeName,
+		client.CoreV1(), client.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return err
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaderElectionLeaseDuration,
+		RenewDeadline:   leaderElectionRenewDeadline,
+		RetryPeriod:     leaderElectionRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            nodeName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				p.SetLeading(ctx, true)
+			},
+			OnStoppedLeading: func() {
+				p.SetLeading(ctx, false)
+			},
+			OnNewLeader: func(leader string) {
+				log.G(ctx).Infof("replica %s is the leader of node %s", leader, nodeName)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the elector gives up once the lease is lost, so the election is run again until the context is done
+	go func() {
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return nil
+}
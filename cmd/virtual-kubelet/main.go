@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -33,7 +34,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/virtual-kubelet/azure-aci/pkg/auth"
 	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
 	azproviderv2 "github.com/virtual-kubelet/azure-aci/pkg/provider"
+	"github.com/virtual-kubelet/azure-aci/pkg/validation"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
@@ -43,6 +46,13 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apiserver/pkg/server/dynamiccertificates"
 	"k8s.io/apiserver/pkg/server/options"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
@@ -54,8 +64,10 @@ var (
 	taintEffect = envOrDefault("VKUBELET_TAINT_EFFECT", string(v1.TaintEffectNoSchedule))
 	taintValue  = envOrDefault("VKUBELET_TAINT_VALUE", "azure")
 
-	logLevel        = "info"
-	traceSampleRate string
+	logLevel           = "info"
+	logComponentLevels string
+	logFormat          string
+	traceSampleRate    string
 
 	// for aci
 	kubeConfigPath  = os.Getenv("KUBECONFIG")
@@ -72,6 +84,9 @@ var (
 	clientCACert   string
 	clientNoVerify bool
 
+	rotateServerCertificates bool
+	certDir                  = envOrDefault("VKUBELET_CERT_DIR", "/var/lib/virtual-kubelet/pki")
+
 	webhookAuth                  bool
 	webhookAuthnCacheTTL         time.Duration
 	webhookAuthzUnauthedCacheTTL time.Duration
@@ -79,6 +94,20 @@ var (
 	nodeName                     = "vk-aci-test-aks"
 	listenPort                   = 10250
 
+	cgListCacheTTL          time.Duration
+	cgListBackgroundRefresh bool
+	cgListResourceGraph     bool
+
+	leaderElect          bool
+	leaderElectNamespace = envOrDefault("VKUBELET_POD_NAMESPACE", "kube-system")
+
+	endpointSliceSync bool
+	networkPolicySync bool
+
+	validationWebhookAddr            string
+	validationWebhookAllowPrivileged bool
+	validationWebhookHostPaths       []string
+
 	// deprecated
 	namespace   string
 	metricsAddr string
@@ -140,14 +169,26 @@ func main() {
 		cfg.NodeSpec.Status.NodeInfo.KubeletVersion = strings.Join([]string{k8sVersion, "vk-azure-aci", buildVersion}, "-")
 		return nil
 	}
+	mux := http.NewServeMux()
 	configureRoutes := func(cfg *nodeutil.NodeConfig) error {
-		mux := http.NewServeMux()
 		cfg.Handler = mux
 		return nodeutil.AttachProviderRoutes(mux)(cfg)
 	}
+	// the health checks are served without authentication, for the probes of the kubelet, as is the Event Grid
+	// webhook, which checks its own token as Event Grid can't authenticate against the cluster
+	publicMux := http.NewServeMux()
+	withPublicRoutes := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := publicMux.Handler(r); pattern != "" {
+				publicMux.ServeHTTP(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
 	withWebhookAuth := func(cfg *nodeutil.NodeConfig) error {
 		if !webhookAuth {
-			cfg.Handler = api.InstrumentHandler(nodeutil.WithAuth(nodeutil.NoAuth(), cfg.Handler))
+			cfg.Handler = api.InstrumentHandler(withPublicRoutes(nodeutil.WithAuth(nodeutil.NoAuth(), cfg.Handler)))
 			return nil
 		}
 
@@ -155,7 +196,7 @@ func main() {
 			func(cfg *nodeutil.WebhookAuthConfig) error {
 				var err error
 
-				cfg.AuthzConfig.WebhookRetryBackoff = options.DefaultAuthWebhookRetryBackoff()
+				cfg.AuthnConfig.WebhookRetryBackoff = options.DefaultAuthWebhookRetryBackoff()
 				cfg.AuthzConfig.WebhookRetryBackoff = options.DefaultAuthWebhookRetryBackoff()
 
 				if webhookAuthnCacheTTL > 0 {
@@ -165,7 +206,7 @@ func main() {
 					cfg.AuthzConfig.AllowCacheTTL = webhookAuthzAuthedCacheTTL
 				}
 				if webhookAuthzUnauthedCacheTTL > 0 {
-					cfg.AuthzConfig.AllowCacheTTL = webhookAuthzUnauthedCacheTTL
+					cfg.AuthzConfig.DenyCacheTTL = webhookAuthzUnauthedCacheTTL
 				}
 				if clientCACert != "" {
 					ca, err := dynamiccertificates.NewDynamicCAContentFromFile("client-ca", clientCACert)
@@ -182,10 +223,29 @@ func main() {
 			return err
 		}
 		cfg.TLSConfig.ClientAuth = tls.RequestClientCert
-		cfg.Handler = api.InstrumentHandler(nodeutil.WithAuth(auth, cfg.Handler))
+		cfg.Handler = api.InstrumentHandler(withPublicRoutes(nodeutil.WithAuth(auth, cfg.Handler)))
 		return nil
 	}
 
+	var kubeClient kubernetes.Interface
+	// the serving certificate is either read from the files of APISERVER_CERT_LOCATION and APISERVER_KEY_LOCATION, or
+	// requested from the certificates API of the cluster and rotated
+	withServingCert := func(cfg *tls.Config) error {
+		if !rotateServerCertificates {
+			return nodeutil.WithKeyPairFromPath(certPath, keyPath)(cfg)
+		}
+		m, err := newServingCertificateManager(ctx, kubeClient, nodeName, os.Getenv("VKUBELET_POD_IP"), certDir)
+		if err != nil {
+			return err
+		}
+		m.Start()
+		go func() {
+			<-ctx.Done()
+			m.Stop()
+		}()
+		return withServingCertificate(m)(cfg)
+	}
+
 	withCA := func(cfg *tls.Config) error {
 		if clientCACert == "" {
 			return nil
@@ -204,13 +264,40 @@ func main() {
 		if err != nil {
 			return err
 		}
+		kubeClient = client
 		return nodeutil.WithClient(client)(cfg)
 	}
 
 	run := func(ctx context.Context) error {
-		if err := configureTracing(nodeName, traceSampleRate); err != nil {
+		if err := configureTracing(ctx, nodeName, traceSampleRate); err != nil {
 			return err
 		}
+		if validationWebhookAddr != "" {
+			go runValidationWebhook(ctx, validationWebhookAddr, certPath, keyPath, validation.PodOptions{
+				AllowPrivileged:  validationWebhookAllowPrivileged,
+				HostPathPrefixes: validationWebhookHostPaths,
+			})
+		}
+
+		// the clients are configured once the flags are parsed
+		azACIAPIs.UseResourceGraph = cgListResourceGraph
+		var azClients client.AzClientsInterface = azACIAPIs
+		if cgListCacheTTL > 0 {
+			azClients = client.WrapCachedAzClientsAPIs(cgListCacheTTL, cgListBackgroundRefresh, azACIAPIs)
+		}
+
+		// The event recorder of the pod controller is shared with the provider, so that it can report ACI failures on pods.
+		var provider *azproviderv2.ACIProvider
+		var eventRecorder record.EventRecorder
+		eb := record.NewBroadcaster()
+		defer eb.Shutdown()
+		withEventRecorder := func(cfg *nodeutil.NodeConfig) error {
+			eb.StartLogging(log.G(ctx).Infof)
+			eb.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: cfg.Client.CoreV1().Events(v1.NamespaceAll)})
+			eventRecorder = eb.NewRecorder(scheme.Scheme, v1.EventSource{Component: path.Join(nodeName, "pod-controller")})
+			cfg.EventRecorder = eventRecorder
+			return nil
+		}
 
 		node, err := nodeutil.NewNode(nodeName,
 			func(cfg nodeutil.ProviderConfig) (nodeutil.Provider, node.NodeProvider, error) {
@@ -221,18 +308,71 @@ func main() {
 						return nil, nil, err
 					}
 				}
-				p, err := azproviderv2.NewACIProvider(ctx, cfgPath, azConfig, azACIAPIs, cfg,
+				p, err := azproviderv2.NewACIProvider(ctx, cfgPath, azConfig, azClients, cfg,
 					nodeName, operatingSystem, os.Getenv("VKUBELET_POD_IP"),
 					int32(listenPort), clusterDomain)
+				if err != nil {
+					return nil, nil, err
+				}
 				p.ConfigureNode(ctx, cfg.Node)
-				return p, nil, err
+				p.SetEventRecorder(eventRecorder)
+				// the image pull secrets of the service accounts are added to the pods, as the pod informers of
+				// the virtual kubelet don't cover service accounts
+				serviceAccountInformers := informers.NewSharedInformerFactory(kubeClient, resync)
+				p.SetServiceAccountLister(serviceAccountInformers.Core().V1().ServiceAccounts().Lister())
+				// as are the default requests of the namespaces
+				p.SetNamespaceLister(serviceAccountInformers.Core().V1().Namespaces().Lister())
+				p.SetConfigMapClient(kubeClient.CoreV1())
+				p.SetPodClient(kubeClient.CoreV1())
+				var serviceLister corev1listers.ServiceLister
+				if endpointSliceSync {
+					serviceLister = serviceAccountInformers.Core().V1().Services().Lister()
+				}
+				var networkPolicyLister networkingv1listers.NetworkPolicyLister
+				if networkPolicySync {
+					networkPolicyLister = serviceAccountInformers.Networking().V1().NetworkPolicies().Lister()
+				}
+				serviceAccountInformers.Start(ctx.Done())
+				if leaderElect {
+					p.SetLeading(ctx, false)
+				}
+				if cfgPath != "" {
+					if err := p.WatchConfig(ctx, cfgPath); err != nil {
+						return nil, nil, err
+					}
+				}
+				p.StartLogArchive(ctx)
+				p.StartCompletedPodCleanup(ctx)
+				p.StartPodTTLExpiration(ctx)
+				p.StartVolumeSourceSync(ctx, kubeClient.CoreV1())
+				p.StartNodeDrain(ctx, kubeClient.CoreV1(), kubeClient.CoreV1())
+				p.StartRegionFailoverProbe(ctx)
+				if endpointSliceSync {
+					p.StartEndpointSliceSync(ctx, kubeClient.DiscoveryV1(), serviceLister)
+				}
+				if networkPolicySync {
+					p.StartNetworkPolicySync(ctx, networkPolicyLister)
+				}
+				provider = p
+				mux.Handle("/securityreports", p.SecurityReportHandler())
+				mux.Handle("/attach/", p.AttachHandler())
+				mux.Handle("/burstmetrics", p.BurstMetricsHandler())
+				mux.Handle("/containergroups/", p.ContainerGroupHandler())
+				publicMux.Handle("/healthz", p.HealthzHandler())
+				publicMux.Handle("/readyz", p.ReadyzHandler())
+				if token := os.Getenv("ACI_EVENT_GRID_WEBHOOK_TOKEN"); token != "" {
+					publicMux.Handle("/events/containergroups", p.EventGridHandler(token))
+				}
+				return p, p, nil
 			},
 			withClient,
+			withEventRecorder,
 			withTaint,
 			withVersion,
-			nodeutil.WithTLSConfig(nodeutil.WithKeyPairFromPath(certPath, keyPath), withCA),
-			withWebhookAuth,
+			nodeutil.WithTLSConfig(withServingCert, withCA),
+			// the routes are configured first, so that the authentication wraps them
 			configureRoutes,
+			withWebhookAuth,
 			func(cfg *nodeutil.NodeConfig) error {
 				cfg.InformerResyncPeriod = resync
 				cfg.NumWorkers = numberOfWorkers
@@ -256,6 +396,14 @@ func main() {
 			return fmt.Errorf("error waiting for node to be ready: %w", err)
 		}
 
+		if leaderElect {
+			if err := runLeaderElection(ctx, kubeClient, provider, leaderElectNamespace); err != nil {
+				return fmt.Errorf("error starting the leader election: %w", err)
+			}
+		} else if err := provider.AdoptContainerGroups(ctx); err != nil {
+			log.G(ctx).WithError(err).Error("failed to adopt the existing container groups")
+		}
+
 		<-node.Done()
 		return node.Err()
 	}
@@ -265,12 +413,14 @@ func main() {
 		Short: desc,
 		Long:  desc,
 		Run: func(cmd *cobra.Command, args []string) {
-			logger := logrus.StandardLogger()
-			lvl, err := logrus.ParseLevel(logLevel)
+			logger, err := logging.NewLogger(logging.Config{
+				Level:           logLevel,
+				ComponentLevels: logComponentLevels,
+				Format:          logFormat,
+			})
 			if err != nil {
-				logrus.WithError(err).Fatal("Error parsing log level")
+				logrus.WithError(err).Fatal("Error configuring the logger")
 			}
-			logger.SetLevel(lvl)
 
 			ctx := log.WithLogger(cmd.Context(), logruslogger.FromLogrus(logrus.NewEntry(logger)))
 
@@ -298,11 +448,17 @@ func main() {
 	flags.BoolVar(&disableTaint, "disable-taint", disableTaint, "disable the node taint")
 	flags.StringVar(&operatingSystem, "os", operatingSystem, "Operating System (Linux/Windows)")
 	flags.StringVar(&logLevel, "log-level", logLevel, "log level.")
+	flags.StringVar(&logComponentLevels, "log-component-levels", os.Getenv("VKUBELET_LOG_COMPONENT_LEVELS"),
+		"log levels of the tracker, client and network components, formatted as component=level,component=level")
+	flags.StringVar(&logFormat, "log-format", envOrDefault("VKUBELET_LOG_FORMAT", logging.FormatText), "log format, text or json")
 	flags.IntVar(&numberOfWorkers, "pod-sync-workers", numberOfWorkers, `set the number of pod synchronization workers`)
 	flags.DurationVar(&resync, "full-resync-period", resync, "how often to perform a full resync of pods between kubernetes and the provider")
 
 	flags.StringVar(&clientCACert, "client-verify-ca", os.Getenv("APISERVER_CA_CERT_LOCATION"), "CA cert to use to verify client requests")
 	flags.BoolVar(&clientNoVerify, "no-verify-clients", clientNoVerify, "Do not require client certificate validation")
+	flags.BoolVar(&rotateServerCertificates, "rotate-server-certificates", os.Getenv("VKUBELET_ROTATE_SERVER_CERTIFICATES") == "true",
+		"Request the serving certificate from the certificates API of the cluster and rotate it before it expires, instead of reading APISERVER_CERT_LOCATION and APISERVER_KEY_LOCATION.")
+	flags.StringVar(&certDir, "cert-dir", certDir, "The directory of the serving certificates requested with --rotate-server-certificates.")
 	flags.BoolVar(&webhookAuth, "authentication-token-webhook", webhookAuth, ""+
 		"Use the TokenReview API to determine authentication for bearer tokens.")
 	flags.DurationVar(&webhookAuthnCacheTTL, "authentication-token-webhook-cache-ttl", webhookAuthnCacheTTL,
@@ -312,6 +468,30 @@ func main() {
 	flags.DurationVar(&webhookAuthzUnauthedCacheTTL, "authorization-webhook-cache-unauthorized-ttl", webhookAuthzUnauthedCacheTTL,
 		"The duration to cache 'unauthorized' responses from the webhook authorizer.")
 
+	flags.DurationVar(&cgListCacheTTL, "container-group-list-cache-ttl", cgListCacheTTL,
+		"The duration to cache the list of container groups, caching is disabled when not set.")
+	flags.BoolVar(&cgListBackgroundRefresh, "container-group-list-background-refresh", cgListBackgroundRefresh,
+		"Serve the expired list of container groups from the cache while refreshing it in the background.")
+	flags.BoolVar(&cgListResourceGraph, "container-group-list-resource-graph", os.Getenv("VKUBELET_CONTAINER_GROUP_LIST_RESOURCE_GRAPH") == "true",
+		"List the container groups with Azure Resource Graph queries, falling back to the ACI API when they fail.")
+
+	flags.BoolVar(&leaderElect, "leader-elect", os.Getenv("VKUBELET_LEADER_ELECTION") == "true",
+		"Elect a leader among the replicas of the node, only the leader creates and deletes container groups.")
+	flags.StringVar(&leaderElectNamespace, "leader-elect-namespace", leaderElectNamespace,
+		"The namespace of the lease used for the leader election.")
+	flags.BoolVar(&endpointSliceSync, "endpoint-slice-sync", os.Getenv("VKUBELET_ENDPOINT_SLICE_SYNC") == "true",
+		"Publish the private IP addresses of the pods of the node in endpoint slices of the services selecting them.")
+	flags.BoolVar(&networkPolicySync, "network-policy-sync", os.Getenv("VKUBELET_NETWORK_POLICY_SYNC") == "true",
+		"Translate the network policies selecting the pods of the node into rules of the network security groups of their subnets.")
+
+	flags.StringVar(&validationWebhookAddr, "validation-webhook-addr", os.Getenv("VKUBELET_VALIDATION_WEBHOOK_ADDR"),
+		"Serve a validating admission webhook rejecting the pods ACI doesn't support on this address, with the certificate of APISERVER_CERT_LOCATION and APISERVER_KEY_LOCATION.")
+	flags.BoolVar(&validationWebhookAllowPrivileged, "validation-webhook-allow-privileged", os.Getenv("VKUBELET_VALIDATION_WEBHOOK_ALLOW_PRIVILEGED") == "true",
+		"Accept the privileged containers in the validation webhook.")
+	flags.StringSliceVar(&validationWebhookHostPaths, "validation-webhook-host-path-prefixes",
+		strings.FieldsFunc(os.Getenv("VKUBELET_VALIDATION_WEBHOOK_HOST_PATH_PREFIXES"), func(r rune) bool { return r == ',' }),
+		"Accept the hostPath volumes under these prefixes in the validation webhook, as redirected to Azure Files shares by the HostPathMappings of the provider config.")
+
 	flags.StringVar(&traceSampleRate, "trace-sample-rate", traceSampleRate, "set probability of tracing samples")
 
 	// deprecated flags
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
 	"contrib.go.opencensus.io/exporter/ocagent"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
 	"github.com/virtual-kubelet/virtual-kubelet/trace/opencensus"
+	"go.opencensus.io/stats/view"
 	octrace "go.opencensus.io/trace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func initOCAgent(service string) error {
@@ -37,17 +41,25 @@ func initOCAgent(service string) error {
 	}
 
 	octrace.RegisterExporter(exporter)
-	return nil
+	view.RegisterExporter(exporter)
+	return view.Register(client.RetryViews...)
 }
 
-func configureTracing(service string, rate string) error {
-	var s octrace.Sampler
+// configureTracing exports the traces with OpenTelemetry when an OTLP endpoint is set through the standard OTEL
+// environment variables, and with the OpenCensus agent otherwise.
+func configureTracing(ctx context.Context, service string, rate string) error {
+	var (
+		s       octrace.Sampler
+		sampler sdktrace.Sampler
+	)
 	switch strings.ToLower(rate) {
 	case "":
 	case "always":
 		s = octrace.AlwaysSample()
+		sampler = sdktrace.AlwaysSample()
 	case "never":
 		s = octrace.NeverSample()
+		sampler = sdktrace.NeverSample()
 	default:
 		rate, err := strconv.Atoi(rate)
 		if err != nil {
@@ -57,6 +69,11 @@ func configureTracing(service string, rate string) error {
 			return errdefs.AsInvalidInput(fmt.Errorf("trace sample rate must be between 0 and 100: %w", err))
 		}
 		s = octrace.ProbabilitySampler(float64(rate) / 100)
+		sampler = sdktrace.TraceIDRatioBased(float64(rate) / 100)
+	}
+
+	if otlpEnabled() {
+		return initOpenTelemetry(ctx, service, sampler)
 	}
 
 	if err := initOCAgent(service); err != nil {
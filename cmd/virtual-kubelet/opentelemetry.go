@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	"github.com/virtual-kubelet/virtual-kubelet/trace/opentelemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// otlpEnabled returns whether an OTLP trace endpoint is set, the exporter is then configured through the
+// standard OTEL_EXPORTER_OTLP_* environment variables.
+func otlpEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// initOpenTelemetry exports the spans of the provider and of the virtual kubelet to the OTLP endpoint. The service
+// name and the sampler default to the node name and to the trace sample rate, unless OTEL_SERVICE_NAME and
+// OTEL_TRACES_SAMPLER are set. The spans are flushed when the context is done.
+func initOpenTelemetry(ctx context.Context, service string, sampler sdktrace.Sampler) error {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceNameKey.String(service)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return err
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	}
+	if sampler != nil && os.Getenv("OTEL_TRACES_SAMPLER") == "" {
+		options = append(options, sdktrace.WithSampler(sdktrace.ParentBased(sampler)))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	trace.T = opentelemetry.Adapter{}
+
+	go func() {
+		<-ctx.Done()
+		// the context of the provider is done, the spans are flushed with a fresh one
+		if err := provider.Shutdown(context.Background()); err != nil {
+			log.G(ctx).WithError(err).Warn("failed to flush the OpenTelemetry spans")
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/certificate"
+)
+
+// newServingCertificateManager requests the serving certificate of the node from the certificates API of the cluster
+// with the kubelet-serving signer, and renews it before it expires. The certificate signing requests of the node
+// have to be approved, e.g. by an approver watching the kubelet serving CSRs, as the controller manager only
+// approves the client certificates of the nodes.
+func newServingCertificateManager(ctx context.Context, client kubernetes.Interface, nodeName, nodeIP, certDir string) (certificate.Manager, error) {
+	store, err := certificate.NewFileStore("kubelet-server", certDir, certDir, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the serving certificate store: %w", err)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(nodeIP); ip != nil {
+		ips = append(ips, ip)
+	}
+	logger := log.G(ctx).WithField("method", "newServingCertificateManager")
+	return certificate.NewManager(&certificate.Config{
+		ClientsetFn: func(current *tls.Certificate) (kubernetes.Interface, error) {
+			return client, nil
+		},
+		GetTemplate: func() *x509.CertificateRequest {
+			return &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName:   "system:node:" + nodeName,
+					Organization: []string{"system:nodes"},
+				},
+				DNSNames:    []string{nodeName},
+				IPAddresses: ips,
+			}
+		},
+		SignerName: certificatesv1.KubeletServingSignerName,
+		Usages: []certificatesv1.KeyUsage{
+			certificatesv1.UsageDigitalSignature,
+			certificatesv1.UsageKeyEncipherment,
+			certificatesv1.UsageServerAuth,
+		},
+		CertificateStore: store,
+		Name:             "kubelet-server",
+		Logf:             logger.Infof,
+	})
+}
+
+// withServingCertificate makes a TLS config option serving the current certificate of the manager, so that the
+// renewed certificates are served without restarting the listener.
+func withServingCertificate(m certificate.Manager) func(*tls.Config) error {
+	return func(cfg *tls.Config) error {
+		cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := m.Current()
+			if cert == nil {
+				return nil, fmt.Errorf("no serving certificate available for the node")
+			}
+			return cert, nil
+		}
+		return nil
+	}
+}
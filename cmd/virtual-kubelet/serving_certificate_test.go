@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServingCertificateManagerRequest(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	m, err := newServingCertificateManager(context.Background(), client, "vk-node", "10.0.0.4", t.TempDir())
+	assert.NilError(t, err)
+	assert.Check(t, m.Current() == nil)
+	m.Start()
+	defer m.Stop()
+
+	var csrs *certificatesv1.CertificateSigningRequestList
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		csrs, err = client.CertificatesV1().CertificateSigningRequests().List(context.Background(), metav1.ListOptions{})
+		return err == nil && len(csrs.Items) > 0, err
+	})
+	assert.NilError(t, err)
+
+	csr := csrs.Items[0]
+	assert.Check(t, is.Equal(certificatesv1.KubeletServingSignerName, csr.Spec.SignerName))
+	assert.Check(t, is.DeepEqual([]certificatesv1.KeyUsage{
+		certificatesv1.UsageDigitalSignature,
+		certificatesv1.UsageKeyEncipherment,
+		certificatesv1.UsageServerAuth,
+	}, csr.Spec.Usages))
+	block, _ := pem.Decode(csr.Spec.Request)
+	assert.Assert(t, block != nil)
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("system:node:vk-node", request.Subject.CommonName))
+	assert.Check(t, is.DeepEqual([]string{"system:nodes"}, request.Subject.Organization))
+	assert.Check(t, is.DeepEqual([]string{"vk-node"}, request.DNSNames))
+	assert.Assert(t, is.Len(request.IPAddresses, 1))
+	assert.Check(t, request.IPAddresses[0].Equal(net.ParseIP("10.0.0.4")))
+}
+
+func TestWithServingCertificate(t *testing.T) {
+	certDir := t.TempDir()
+	m, err := newServingCertificateManager(context.Background(), fake.NewSimpleClientset(), "vk-node", "", certDir)
+	assert.NilError(t, err)
+
+	cfg := &tls.Config{}
+	assert.NilError(t, withServingCertificate(m)(cfg))
+	_, err = cfg.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Check(t, err != nil, "no certificate is served before one is issued")
+
+	// the certificate stored by a previous run is served
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system:node:vk-node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+	content := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	assert.NilError(t, os.WriteFile(filepath.Join(certDir, "kubelet-server-current.pem"), content, 0600))
+
+	m, err = newServingCertificateManager(context.Background(), fake.NewSimpleClientset(), "vk-node", "", certDir)
+	assert.NilError(t, err)
+	assert.NilError(t, withServingCertificate(m)(cfg))
+	cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("system:node:vk-node", cert.Leaf.Subject.CommonName))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/virtual-kubelet/azure-aci/pkg/validation"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// runValidationWebhook serves the validating admission webhook of the pods on addr with the serving certificate
+// files until the context is done.
+func runValidationWebhook(ctx context.Context, addr, certFile, keyFile string, opts validation.PodOptions) {
+	mux := http.NewServeMux()
+	mux.Handle("/validate-pods", validation.NewWebhookHandler(opts))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.G(ctx).Infof("serving the validation webhook of the pods on %s", addr)
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.G(ctx).WithError(err).Error("the validation webhook of the pods stopped")
+	}
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	armruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+const (
+	workspaceAPIVersion  = "2020-08-01"
+	workspaceClientName  = "analytics"
+	workspaceClientVer   = "v1.0.0"
+	workspaceKeysSubPath = "sharedKeys"
+)
+
+type workspace struct {
+	Properties *struct {
+		CustomerID *string `json:"customerId"`
+	} `json:"properties"`
+}
+
+type workspaceSharedKeys struct {
+	PrimarySharedKey *string `json:"primarySharedKey"`
+}
+
+// NewContainerGroupDiagnosticsFromResourceID creates a container group diagnostics object for the
+// Log Analytics workspace with the given resource ID. The workspace ID and key are looked up in Azure
+// Resource Manager with the given credential, e.g. the managed identity of the virtual node.
+func NewContainerGroupDiagnosticsFromResourceID(ctx context.Context, resourceID string, credential azcore.TokenCredential, cloudConfig cloud.Configuration) (*azaciv2.ContainerGroupDiagnostics, error) {
+	ctx, span := trace.StartSpan(ctx, "analytics.NewContainerGroupDiagnosticsFromResourceID")
+	defer span.End()
+
+	if resourceID == "" {
+		return nil, errors.New("log Analytics configuration requires the workspace resource ID")
+	}
+
+	clientOptions, err := client.GetClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.Cloud = cloudConfig
+	options := &arm.ClientOptions{
+		ClientOptions: clientOptions,
+	}
+	pl, err := armruntime.NewPipeline(workspaceClientName, workspaceClientVer, credential, runtime.PipelineOptions{}, options)
+	if err != nil {
+		return nil, fmt.Errorf("creating Log Analytics pipeline failed: %v", err)
+	}
+
+	endpoint := cloud.AzurePublic.Services[cloud.ResourceManager].Endpoint
+	if svc, ok := cloudConfig.Services[cloud.ResourceManager]; ok && svc.Endpoint != "" {
+		endpoint = svc.Endpoint
+	}
+
+	var ws workspace
+	if err := sendWorkspaceRequest(ctx, pl, http.MethodGet, runtime.JoinPaths(endpoint, resourceID), &ws); err != nil {
+		return nil, fmt.Errorf("getting Log Analytics workspace %q failed: %v", resourceID, err)
+	}
+	if ws.Properties == nil || ws.Properties.CustomerID == nil {
+		return nil, fmt.Errorf("log Analytics workspace %q has no workspace ID", resourceID)
+	}
+
+	var keys workspaceSharedKeys
+	if err := sendWorkspaceRequest(ctx, pl, http.MethodPost, runtime.JoinPaths(endpoint, resourceID, workspaceKeysSubPath), &keys); err != nil {
+		return nil, fmt.Errorf("getting Log Analytics workspace %q keys failed: %v", resourceID, err)
+	}
+	if keys.PrimarySharedKey == nil {
+		return nil, fmt.Errorf("log Analytics workspace %q has no shared key", resourceID)
+	}
+
+	diagnostics, err := NewContainerGroupDiagnostics(*ws.Properties.CustomerID, *keys.PrimarySharedKey)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics.LogAnalytics.WorkspaceResourceID = &resourceID
+	return diagnostics, nil
+}
+
+func sendWorkspaceRequest(ctx context.Context, pl runtime.Pipeline, method, url string, result interface{}) error {
+	req, err := runtime.NewRequest(ctx, method, url)
+	if err != nil {
+		return err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", workspaceAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+	req.Raw().Header.Set("Accept", "application/json")
+
+	resp, err := pl.Do(req)
+	if err != nil {
+		return err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return runtime.NewResponseError(resp)
+	}
+	return runtime.UnmarshalAsJSON(resp, result)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/dimchansky/utfbom"
 	"github.com/pkg/errors"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
@@ -29,6 +30,9 @@ const (
 	AzurePublicCloud       CloudEnvironmentName = "AzurePublicCloud"
 	AzureUSGovernmentCloud CloudEnvironmentName = "AzureUSGovernmentCloud"
 	AzureChinaCloud        CloudEnvironmentName = "AzureChinaCloud"
+	// AzureStackCloud is a custom cloud, e.g. Azure Stack Hub or an air-gapped cloud, whose endpoints are read from
+	// the JSON file of AZURE_ENVIRONMENT_FILEPATH.
+	AzureStackCloud CloudEnvironmentName = "AzureStackCloud"
 )
 
 type Config struct {
@@ -70,6 +74,52 @@ func (c *Config) GetSPCredential(ctx context.Context) (*azidentity.ClientSecretC
 	return spCredential, nil
 }
 
+// GetWorkloadIdentityCredential retrieve workload identity credential, exchanging the federated token of the
+// service account of the virtual node for an Azure AD token. The token file is read on every exchange, as the
+// kubelet rotates the token.
+func (c *Config) GetWorkloadIdentityCredential(ctx context.Context) (*azidentity.ClientAssertionCredential, error) {
+	log.G(ctx).Debug("getting token using workload identity")
+	opts := &azidentity.ClientAssertionCredentialOptions{
+		ClientOptions: azcore.ClientOptions{
+			Cloud: c.Cloud,
+		},
+	}
+	tokenFile := c.AuthConfig.FederatedTokenFile
+	getAssertion := func(context.Context) (string, error) {
+		return readFederatedToken(tokenFile)
+	}
+	wiCredential, err := azidentity.NewClientAssertionCredential(c.AuthConfig.TenantID, c.AuthConfig.ClientID, getAssertion, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return wiCredential, nil
+}
+
+// GetCredential retrieve the credential of the configured authentication: the credential chain when enabled, else
+// the workload identity when a federated token file is set, else the service principal when a client ID is set,
+// else the user identity.
+func (c *Config) GetCredential(ctx context.Context) (azcore.TokenCredential, error) {
+	switch {
+	case c.AuthConfig.CredentialChain:
+		return c.GetCredentialChain(ctx)
+	case c.AuthConfig.FederatedTokenFile != "":
+		return c.GetWorkloadIdentityCredential(ctx)
+	case len(c.AuthConfig.ClientID) == 0:
+		return c.GetMSICredential(ctx)
+	default:
+		return c.GetSPCredential(ctx)
+	}
+}
+
+func readFederatedToken(tokenFile string) (string, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading federated token file %q failed: %v", tokenFile, err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
 // getAuthorizer return autorest authorizer.
 func (c *Config) getAuthorizer(ctx context.Context, resource string) (autorest.Authorizer, error) {
 	var auth autorest.Authorizer
@@ -78,7 +128,32 @@ func (c *Config) getAuthorizer(ctx context.Context, resource string) (autorest.A
 	var token *adal.ServicePrincipalToken
 	isUserIdentity := len(c.AuthConfig.ClientID) == 0
 
-	if isUserIdentity {
+	if c.AuthConfig.CredentialChain {
+		credential, err := c.GetCredentialChain(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return getCredentialAuthorizer(credential, c.Cloud), nil
+	}
+
+	if c.AuthConfig.FederatedTokenFile != "" {
+		log.G(ctx).Debug("getting token using workload identity")
+
+		oauthConfig, err := adal.NewOAuthConfig(
+			c.Cloud.ActiveDirectoryAuthorityHost, c.AuthConfig.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		jwt, err := readFederatedToken(c.AuthConfig.FederatedTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token, err = adal.NewServicePrincipalTokenFromFederatedToken(
+			*oauthConfig, c.AuthConfig.ClientID, jwt, resource)
+		if err != nil {
+			return nil, err
+		}
+	} else if isUserIdentity {
 		log.G(ctx).Debug("getting token using user identity")
 
 		token, err = adal.NewServicePrincipalTokenFromManagedIdentity(
@@ -136,7 +211,10 @@ func (c *Config) SetAuthConfig(ctx context.Context) error {
 		}
 
 		//Set Azure cloud environment
-		c.Cloud = getCloudConfiguration(c.AKSCredential.Cloud)
+		c.Cloud, err = getCloudConfiguration(c.AKSCredential.Cloud)
+		if err != nil {
+			return errors.Wrap(err, "cannot get the cloud of the AKS credential config")
+		}
 		c.AuthConfig = NewAuthentication(
 			clientId,
 			c.AKSCredential.ClientSecret,
@@ -145,6 +223,14 @@ func (c *Config) SetAuthConfig(ctx context.Context) error {
 			c.AKSCredential.UserAssignedIdentityID)
 	}
 
+	if cloudName := os.Getenv("AZURE_ENVIRONMENT"); cloudName != "" {
+		log.G(ctx).Debugf("azure environment env variable AZURE_ENVIRONMENT is set to %s", cloudName)
+		c.Cloud, err = getCloudConfiguration(cloudName)
+		if err != nil {
+			return errors.Wrap(err, "cannot get the cloud configuration. Please make sure AZURE_ENVIRONMENT env variable is set correctly")
+		}
+	}
+
 	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
 		log.G(ctx).Debug("azure client ID env variable AZURE_CLIENT_ID is set")
 		c.AuthConfig.ClientID = clientID
@@ -160,9 +246,37 @@ func (c *Config) SetAuthConfig(ctx context.Context) error {
 		c.AuthConfig.UserIdentityClientId = userIdentityClientId
 	}
 
+	if tenantID := os.Getenv("AZURE_TENANT_ID"); tenantID != "" {
+		log.G(ctx).Debug("azure tenant ID env variable AZURE_TENANT_ID is set")
+		c.AuthConfig.TenantID = tenantID
+	}
+
+	// the workload identity webhook sets the federated token file, the client and tenant IDs and the authority host
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		log.G(ctx).Debug("azure federated token file env variable AZURE_FEDERATED_TOKEN_FILE is set")
+		c.AuthConfig.FederatedTokenFile = tokenFile
+		if authorityHost := os.Getenv("AZURE_AUTHORITY_HOST"); authorityHost != "" {
+			c.Cloud.ActiveDirectoryAuthorityHost = authorityHost
+		}
+	}
+
+	// the credential chain lets developers run the provider with their Azure CLI login
+	if os.Getenv("VIRTUALNODE_CREDENTIAL_CHAIN") == "true" {
+		log.G(ctx).Debug("credential chain env variable VIRTUALNODE_CREDENTIAL_CHAIN is set")
+		c.AuthConfig.CredentialChain = true
+	}
+
 	isUserIdentity := len(c.AuthConfig.ClientID) == 0
 
-	if isUserIdentity {
+	if c.AuthConfig.CredentialChain {
+		log.G(ctx).Info("using credential chain for Authentication")
+	} else if c.AuthConfig.FederatedTokenFile != "" {
+		if isUserIdentity || len(c.AuthConfig.TenantID) == 0 {
+			return fmt.Errorf("workload identity requires both AZURE_CLIENT_ID and AZURE_TENANT_ID to be set")
+		}
+
+		log.G(ctx).Info("using workload identity for Authentication")
+	} else if isUserIdentity {
 		if len(c.AuthConfig.UserIdentityClientId) == 0 {
 			return fmt.Errorf("neither AZURE_CLIENT_ID or VIRTUALNODE_USER_IDENTITY_CLIENTID is being set")
 		}
@@ -170,17 +284,12 @@ func (c *Config) SetAuthConfig(ctx context.Context) error {
 		log.G(ctx).Info("using user identity for Authentication")
 	}
 
-	if tenantID := os.Getenv("AZURE_TENANT_ID"); tenantID != "" {
-		log.G(ctx).Debug("azure tenant ID env variable AZURE_TENANT_ID is set")
-		c.AuthConfig.TenantID = tenantID
-	}
-
 	if subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID"); subscriptionID != "" {
 		log.G(ctx).Debug("azure subscription ID env variable AZURE_SUBSCRIPTION_ID is set")
 		c.AuthConfig.SubscriptionID = subscriptionID
 	}
 
-	resource := c.Cloud.Services[cloud.ResourceManager].Endpoint
+	resource := c.Cloud.Services[cloud.ResourceManager].Audience
 
 	c.Authorizer, err = c.getAuthorizer(ctx, resource)
 	if err != nil {
@@ -197,6 +306,10 @@ type Authentication struct {
 	SubscriptionID       string `json:"subscriptionId,omitempty"`
 	TenantID             string `json:"tenantId,omitempty"`
 	UserIdentityClientId string `json:"userIdentityClientId,omitempty"`
+	// FederatedTokenFile is the service account token exchanged for an Azure AD token with workload identity.
+	FederatedTokenFile string `json:"federatedTokenFile,omitempty"`
+	// CredentialChain tries the environment, workload identity, managed identity and Azure CLI credentials in turn.
+	CredentialChain bool `json:"credentialChain,omitempty"`
 }
 
 // newAuthenticationFromFile returns an Authentication struct from file path.
@@ -285,14 +398,46 @@ func (a *Authentication) decode(b []byte) ([]byte, error) {
 	return ioutil.ReadAll(reader)
 }
 
-func getCloudConfiguration(cloudName string) cloud.Configuration {
-	switch cloudName {
-	case string(AzurePublicCloud):
-		return cloud.AzurePublic
-	case string(AzureUSGovernmentCloud):
-		return cloud.AzureGovernment
-	case string(AzureChinaCloud):
-		return cloud.AzureChina
+func getCloudConfiguration(cloudName string) (cloud.Configuration, error) {
+	switch {
+	case strings.EqualFold(cloudName, string(AzurePublicCloud)):
+		return cloud.AzurePublic, nil
+	case strings.EqualFold(cloudName, string(AzureUSGovernmentCloud)):
+		return cloud.AzureGovernment, nil
+	case strings.EqualFold(cloudName, string(AzureChinaCloud)):
+		return cloud.AzureChina, nil
+	case strings.EqualFold(cloudName, string(AzureStackCloud)):
+		filePath := os.Getenv("AZURE_ENVIRONMENT_FILEPATH")
+		if filePath == "" {
+			return cloud.Configuration{}, fmt.Errorf("AZURE_ENVIRONMENT_FILEPATH env variable must be set for %s", AzureStackCloud)
+		}
+		return getCustomCloudConfiguration(filePath)
+	}
+	return cloud.Configuration{}, fmt.Errorf("cloud %q is not supported", cloudName)
+}
+
+// getCustomCloudConfiguration returns the cloud configuration of the environment JSON file of a custom cloud, in
+// the format of the Azure Stack Hub and AKS environment files.
+func getCustomCloudConfiguration(filePath string) (cloud.Configuration, error) {
+	env, err := azure.EnvironmentFromFile(filePath)
+	if err != nil {
+		return cloud.Configuration{}, fmt.Errorf("reading cloud environment file %q failed: %v", filePath, err)
+	}
+	if env.ResourceManagerEndpoint == "" || env.ActiveDirectoryEndpoint == "" {
+		return cloud.Configuration{}, fmt.Errorf("cloud environment file %q must set resourceManagerEndpoint and activeDirectoryEndpoint", filePath)
+	}
+
+	audience := env.TokenAudience
+	if audience == "" {
+		audience = env.ResourceManagerEndpoint
 	}
-	panic("cloud config does not exist")
+	return cloud.Configuration{
+		ActiveDirectoryAuthorityHost: env.ActiveDirectoryEndpoint,
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: audience,
+				Endpoint: env.ResourceManagerEndpoint,
+			},
+		},
+	}, nil
 }
@@ -2,10 +2,16 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"gotest.tools/assert"
 )
 
@@ -248,6 +254,145 @@ func TestSetAuthConfigWithEnvVariablesOnly(t *testing.T) {
 	assert.Check(t, azConfig.Authorizer != nil, "Authorizer should be nil")
 }
 
+func TestSetAuthConfigWithWorkloadIdentity(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "federated_token_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	if _, err := tokenFile.Write([]byte("service-account-token\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AZURE_AUTH_LOCATION", "")
+	t.Setenv("AKS_CREDENTIAL_LOCATION", "")
+	t.Setenv("AZURE_CLIENT_ID", "######-###-####-####-######")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("VIRTUALNODE_USER_IDENTITY_CLIENTID", "")
+	t.Setenv("AZURE_TENANT_ID", "00000000-0000-0000-0000-000000000000")
+	t.Setenv("AZURE_SUBSCRIPTION_ID", "######-###-####-####-######")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile.Name())
+	t.Setenv("AZURE_AUTHORITY_HOST", "https://login.example.com/")
+
+	azConfig := Config{}
+	assert.NilError(t, azConfig.SetAuthConfig(context.TODO()))
+	assert.Equal(t, tokenFile.Name(), azConfig.AuthConfig.FederatedTokenFile)
+	assert.Equal(t, "https://login.example.com/", azConfig.Cloud.ActiveDirectoryAuthorityHost)
+	assert.Check(t, azConfig.Authorizer != nil)
+
+	credential, err := azConfig.GetCredential(context.TODO())
+	assert.NilError(t, err)
+	_, ok := credential.(*azidentity.ClientAssertionCredential)
+	assert.Check(t, ok, "workload identity should use a client assertion credential")
+
+	token, err := readFederatedToken(tokenFile.Name())
+	assert.NilError(t, err)
+	assert.Equal(t, "service-account-token", token)
+
+	t.Setenv("AZURE_TENANT_ID", "")
+	azConfig = Config{}
+	assert.ErrorContains(t, azConfig.SetAuthConfig(context.TODO()), "workload identity requires both AZURE_CLIENT_ID and AZURE_TENANT_ID")
+}
+
+type fakeCredential struct {
+	err   error
+	calls int
+}
+
+func (f *fakeCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.calls++
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestCredentialChain(t *testing.T) {
+	unavailable := &fakeCredential{err: errors.New("not logged in")}
+	cli := &fakeCredential{}
+	chain := &credentialChain{credentials: []chainedCredential{
+		{name: "environment", credential: unavailable},
+		{name: "Azure CLI", credential: cli},
+	}}
+
+	for i := 0; i < 2; i++ {
+		token, err := chain.GetToken(context.TODO(), policy.TokenRequestOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, "token", token.Token)
+	}
+	assert.Equal(t, "Azure CLI", chain.selected.name)
+	assert.Equal(t, 1, unavailable.calls)
+	assert.Equal(t, 2, cli.calls)
+
+	chain = &credentialChain{credentials: []chainedCredential{{name: "environment", credential: unavailable}}}
+	_, err := chain.GetToken(context.TODO(), policy.TokenRequestOptions{})
+	assert.ErrorContains(t, err, "environment: not logged in")
+
+	t.Setenv("AZURE_AUTH_LOCATION", "")
+	t.Setenv("AKS_CREDENTIAL_LOCATION", "")
+	t.Setenv("AZURE_CLIENT_ID", "")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("VIRTUALNODE_USER_IDENTITY_CLIENTID", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	t.Setenv("VIRTUALNODE_CREDENTIAL_CHAIN", "true")
+
+	azConfig := Config{}
+	assert.NilError(t, azConfig.SetAuthConfig(context.TODO()))
+	assert.Check(t, azConfig.AuthConfig.CredentialChain)
+	assert.Check(t, azConfig.Authorizer != nil)
+	credential, err := azConfig.GetCredential(context.TODO())
+	assert.NilError(t, err)
+	_, ok := credential.(*credentialChain)
+	assert.Check(t, ok, "credential chain should be used")
+}
+
+func TestGetCloudConfiguration(t *testing.T) {
+	envFile, err := ioutil.TempFile("", "cloud_env_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(envFile.Name())
+	if _, err := envFile.Write([]byte(`{
+	"name": "AzureStackCloud",
+	"resourceManagerEndpoint": "https://management.local.azurestack.external/",
+	"activeDirectoryEndpoint": "https://login.local.azurestack.external/",
+	"tokenAudience": "https://management.azurestack.external/"
+}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := getCloudConfiguration("azurechinacloud")
+	assert.NilError(t, err)
+	assert.Equal(t, cloud.AzureChina.ActiveDirectoryAuthorityHost, c.ActiveDirectoryAuthorityHost)
+
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", "")
+	_, err = getCloudConfiguration("AzureStackCloud")
+	assert.ErrorContains(t, err, "AZURE_ENVIRONMENT_FILEPATH env variable must be set")
+	_, err = getCloudConfiguration("AzureGermanCloud")
+	assert.ErrorContains(t, err, `cloud "AzureGermanCloud" is not supported`)
+
+	t.Setenv("AZURE_AUTH_LOCATION", "")
+	t.Setenv("AKS_CREDENTIAL_LOCATION", "")
+	t.Setenv("AZURE_CLIENT_ID", "######-###-####-####-######")
+	t.Setenv("AZURE_CLIENT_SECRET", "######-###-####-####-######")
+	t.Setenv("AZURE_TENANT_ID", "00000000-0000-0000-0000-000000000000")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	t.Setenv("VIRTUALNODE_CREDENTIAL_CHAIN", "")
+	t.Setenv("AZURE_ENVIRONMENT", "AzureStackCloud")
+	t.Setenv("AZURE_ENVIRONMENT_FILEPATH", envFile.Name())
+
+	azConfig := Config{}
+	assert.NilError(t, azConfig.SetAuthConfig(context.TODO()))
+	assert.Equal(t, "https://login.local.azurestack.external/", azConfig.Cloud.ActiveDirectoryAuthorityHost)
+	arm := azConfig.Cloud.Services[cloud.ResourceManager]
+	assert.Equal(t, "https://management.local.azurestack.external/", arm.Endpoint)
+	assert.Equal(t, "https://management.azurestack.external/", arm.Audience)
+
+	t.Setenv("AZURE_ENVIRONMENT", "AzureGermanCloud")
+	azConfig = Config{}
+	assert.ErrorContains(t, azConfig.SetAuthConfig(context.TODO()), "Please make sure AZURE_ENVIRONMENT env variable is set correctly")
+}
+
 func TestDecode(t *testing.T) {
 	testCases := []struct {
 		desc           string
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// managedIdentityProbeTimeout bounds the first token request of the managed identity in the chain, as the
+// instance metadata service doesn't answer outside of Azure.
+const managedIdentityProbeTimeout = time.Second
+
+type chainedCredential struct {
+	name       string
+	credential azcore.TokenCredential
+	// probeTimeout bounds the token requests until the credential is selected.
+	probeTimeout time.Duration
+}
+
+// credentialChain gets tokens from the first of its credentials that can get one, and then sticks to it, like
+// azidentity.DefaultAzureCredential, but logs which of the credentials is used.
+type credentialChain struct {
+	credentials []chainedCredential
+
+	lock     sync.Mutex
+	selected *chainedCredential
+}
+
+// GetCredentialChain retrieve a credential chain for local development, trying the service principal or user of
+// the environment variables, the workload identity, the managed identity and then the Azure CLI login.
+func (c *Config) GetCredentialChain(ctx context.Context) (azcore.TokenCredential, error) {
+	log.G(ctx).Debug("getting token using credential chain")
+	clientOptions := azcore.ClientOptions{
+		Cloud: c.Cloud,
+	}
+	chain := &credentialChain{}
+
+	envCredential, err := azidentity.NewEnvironmentCredential(&azidentity.EnvironmentCredentialOptions{ClientOptions: clientOptions})
+	if err == nil {
+		chain.credentials = append(chain.credentials, chainedCredential{name: "environment", credential: envCredential})
+	} else {
+		log.G(ctx).WithError(err).Debug("skipping environment credential")
+	}
+
+	if c.AuthConfig.FederatedTokenFile != "" {
+		wiCredential, err := c.GetWorkloadIdentityCredential(ctx)
+		if err != nil {
+			return nil, err
+		}
+		chain.credentials = append(chain.credentials, chainedCredential{name: "workload identity", credential: wiCredential})
+	}
+
+	msiOptions := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+	if clientID := c.AuthConfig.UserIdentityClientId; clientID != "" {
+		msiOptions.ID = azidentity.ClientID(clientID)
+	} else if clientID := c.AuthConfig.ClientID; clientID != "" {
+		msiOptions.ID = azidentity.ClientID(clientID)
+	}
+	msiCredential, err := azidentity.NewManagedIdentityCredential(msiOptions)
+	if err == nil {
+		chain.credentials = append(chain.credentials, chainedCredential{
+			name:         "managed identity",
+			credential:   msiCredential,
+			probeTimeout: managedIdentityProbeTimeout,
+		})
+	} else {
+		log.G(ctx).WithError(err).Debug("skipping managed identity credential")
+	}
+
+	cliCredential, err := azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: c.AuthConfig.TenantID})
+	if err == nil {
+		chain.credentials = append(chain.credentials, chainedCredential{name: "Azure CLI", credential: cliCredential})
+	} else {
+		log.G(ctx).WithError(err).Debug("skipping Azure CLI credential")
+	}
+
+	if len(chain.credentials) == 0 {
+		return nil, fmt.Errorf("none of the credentials of the credential chain is available")
+	}
+	return chain, nil
+}
+
+func (c *credentialChain) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.lock.Lock()
+	selected := c.selected
+	c.lock.Unlock()
+	if selected != nil {
+		return selected.credential.GetToken(ctx, opts)
+	}
+
+	var errs []string
+	for i := range c.credentials {
+		cred := &c.credentials[i]
+		token, err := cred.getProbeToken(ctx, opts)
+		if err != nil {
+			log.G(ctx).WithError(err).Debugf("%s credential can't get a token", cred.name)
+			errs = append(errs, fmt.Sprintf("%s: %v", cred.name, err))
+			continue
+		}
+
+		c.lock.Lock()
+		if c.selected == nil {
+			c.selected = cred
+			log.G(ctx).Infof("using %s credential of the credential chain for Authentication", cred.name)
+		}
+		c.lock.Unlock()
+		return token, nil
+	}
+	return azcore.AccessToken{}, fmt.Errorf("none of the credentials of the credential chain can get a token:\n\t%s", strings.Join(errs, "\n\t"))
+}
+
+func (c *chainedCredential) getProbeToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.probeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.probeTimeout)
+		defer cancel()
+	}
+	return c.credential.GetToken(ctx, opts)
+}
+
+// tokenCredentialProvider adapts an azcore credential to the autorest authorizers.
+type tokenCredentialProvider struct {
+	credential azcore.TokenCredential
+	scopes     []string
+
+	lock  sync.Mutex
+	token azcore.AccessToken
+}
+
+// getCredentialAuthorizer return autorest authorizer getting its tokens from the credential.
+func getCredentialAuthorizer(credential azcore.TokenCredential, c cloud.Configuration) autorest.Authorizer {
+	resource := c.Services[cloud.ResourceManager].Audience
+	return autorest.NewBearerAuthorizer(&tokenCredentialProvider{
+		credential: credential,
+		scopes:     []string{strings.TrimSuffix(resource, "/") + "/.default"},
+	})
+}
+
+func (p *tokenCredentialProvider) OAuthToken() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.token.Token
+}
+
+func (p *tokenCredentialProvider) EnsureFreshWithContext(ctx context.Context) error {
+	p.lock.Lock()
+	fresh := p.token.Token != "" && time.Until(p.token.ExpiresOn) > 5*time.Minute
+	p.lock.Unlock()
+	if fresh {
+		return nil
+	}
+	return p.RefreshWithContext(ctx)
+}
+
+func (p *tokenCredentialProvider) RefreshWithContext(ctx context.Context) error {
+	token, err := p.credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: p.scopes})
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.token = token
+	return nil
+}
+
+func (p *tokenCredentialProvider) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	return p.RefreshWithContext(ctx)
+}
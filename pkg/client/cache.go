@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// WrapCachedAzClientsAPIs adds a cache of the container group list of each resource group to the ACI clients.
+// Cached lists expire after ttl and are invalidated when a container group is created or deleted.
+// When backgroundRefresh is set, an expired list is returned while it is refreshed in the background.
+func WrapCachedAzClientsAPIs(ttl time.Duration, backgroundRefresh bool, clients AzClientsInterface) *cachedAzClientsAPIs {
+	return &cachedAzClientsAPIs{
+		AzClientsInterface: clients,
+		ttl:                ttl,
+		backgroundRefresh:  backgroundRefresh,
+		lists:              make(map[string]*containerGroupList),
+	}
+}
+
+type containerGroupList struct {
+	cgs       []*azaciv2.ContainerGroup
+	fetchedAt time.Time
+}
+
+// Adding container group list cache capability into AzClientsInterface
+type cachedAzClientsAPIs struct {
+	AzClientsInterface
+
+	ttl               time.Duration
+	backgroundRefresh bool
+
+	lock  sync.Mutex
+	lists map[string]*containerGroupList
+	// generation is increased on every invalidation, so that lists fetched before are not cached.
+	generation uint64
+	group      singleflight.Group
+}
+
+func (c *cachedAzClientsAPIs) GetContainerGroupListResult(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+	ctx, span := trace.StartSpan(ctx, "client.cached.GetContainerGroupListResult")
+	defer span.End()
+
+	c.lock.Lock()
+	list, found := c.lists[resourceGroup]
+	c.lock.Unlock()
+
+	if found {
+		if time.Since(list.fetchedAt) < c.ttl {
+			return list.cgs, nil
+		}
+		if c.backgroundRefresh {
+			go func() {
+				// the refresh must not be canceled together with the request which triggered it
+				refreshCtx := log.WithLogger(context.Background(), log.G(ctx))
+				if _, err := c.refresh(refreshCtx, resourceGroup); err != nil {
+					log.G(refreshCtx).WithError(err).Warnf("failed to refresh container group list of resource group %s", resourceGroup)
+				}
+			}()
+			return list.cgs, nil
+		}
+	}
+
+	return c.refresh(ctx, resourceGroup)
+}
+
+// refresh lists the container groups of a resource group and caches them. Concurrent refreshes of
+// the same resource group share a single list call.
+func (c *cachedAzClientsAPIs) refresh(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+	c.lock.Lock()
+	generation := c.generation
+	c.lock.Unlock()
+
+	key := fmt.Sprintf("%s/%d", resourceGroup, generation)
+	result, err, _ := c.group.Do(key, func() (interface{}, error) {
+		cgs, err := c.AzClientsInterface.GetContainerGroupListResult(ctx, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		c.lock.Lock()
+		if generation == c.generation {
+			c.lists[resourceGroup] = &containerGroupList{cgs: cgs, fetchedAt: time.Now()}
+		}
+		c.lock.Unlock()
+		return cgs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*azaciv2.ContainerGroup), nil
+}
+
+// invalidate drops the cached container group list of a resource group.
+func (c *cachedAzClientsAPIs) invalidate(resourceGroup string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	delete(c.lists, resourceGroup)
+}
+
+func (c *cachedAzClientsAPIs) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) (string, error) {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.CreateContainerGroup(ctx, resourceGroup, podNS, podName, cg)
+}
+
+func (c *cachedAzClientsAPIs) CreateContainerGroupFromProfile(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile ContainerGroupProfileReference) (string, error) {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.CreateContainerGroupFromProfile(ctx, resourceGroup, podNS, podName, cg, profile)
+}
+
+func (c *cachedAzClientsAPIs) UpdateContainerGroupTags(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.UpdateContainerGroupTags(ctx, resourceGroup, cgName, tags)
+}
+
+func (c *cachedAzClientsAPIs) DeleteContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.DeleteContainerGroup(ctx, resourceGroup, cgName)
+}
+
+func (c *cachedAzClientsAPIs) DeleteContainerGroupAndWait(ctx context.Context, resourceGroup, cgName string) error {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.DeleteContainerGroupAndWait(ctx, resourceGroup, cgName)
+}
+
+func (c *cachedAzClientsAPIs) StopContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.StopContainerGroup(ctx, resourceGroup, cgName)
+}
+
+func (c *cachedAzClientsAPIs) StartContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	defer c.invalidate(resourceGroup)
+	return c.AzClientsInterface.StartContainerGroup(ctx, resourceGroup, cgName)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"gotest.tools/assert"
+)
+
+type fakeListClients struct {
+	AzClientsInterface
+	listCalls int32
+}
+
+func (f *fakeListClients) GetContainerGroupListResult(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+	atomic.AddInt32(&f.listCalls, 1)
+	return []*azaciv2.ContainerGroup{{}}, nil
+}
+
+func (f *fakeListClients) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) (string, error) {
+	return "", nil
+}
+
+func (f *fakeListClients) DeleteContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	return nil
+}
+
+func TestCachedContainerGroupList(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeListClients{}
+	cached := WrapCachedAzClientsAPIs(time.Hour, false, fake)
+
+	for i := 0; i < 3; i++ {
+		cgs, err := cached.GetContainerGroupListResult(ctx, "rg")
+		assert.NilError(t, err)
+		assert.Equal(t, 1, len(cgs))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.listCalls), "list should be served from cache")
+
+	_, err := cached.GetContainerGroupListResult(ctx, "other-rg")
+	assert.NilError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fake.listCalls), "each resource group should be cached separately")
+
+	_, err = cached.CreateContainerGroup(ctx, "rg", "ns", "pod", &azaciv2.ContainerGroup{})
+	assert.NilError(t, err)
+	_, err = cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fake.listCalls), "create should invalidate the cache")
+
+	assert.NilError(t, cached.DeleteContainerGroup(ctx, "rg", "ns-pod"))
+	_, err = cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&fake.listCalls), "delete should invalidate the cache")
+}
+
+func TestCachedContainerGroupListExpiration(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeListClients{}
+	cached := WrapCachedAzClientsAPIs(time.Millisecond, false, fake)
+
+	_, err := cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fake.listCalls), "expired list should be fetched again")
+}
+
+func TestCachedContainerGroupListBackgroundRefresh(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeListClients{}
+	cached := WrapCachedAzClientsAPIs(time.Millisecond, true, fake)
+
+	_, err := cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	cgs, err := cached.GetContainerGroupListResult(ctx, "rg")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(cgs), "expired list should be served while refreshing")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&fake.listCalls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fake.listCalls), "expired list should be refreshed in the background")
+}
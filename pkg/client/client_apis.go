@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	armruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
@@ -22,19 +26,43 @@ import (
 
 type AzClientsInterface interface {
 	ContainerGroupGetter
-	CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error
+	// CreateContainerGroup starts creating a container group and returns the ID of the ARM operation creating it.
+	CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) (string, error)
+	// CreateContainerGroupFromProfile starts creating a container group from a container group profile, and
+	// returns the ID of the ARM operation creating it.
+	CreateContainerGroupFromProfile(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile ContainerGroupProfileReference) (string, error)
+	// GetContainerGroupProfileImages returns the images of the containers of a container group profile, by name.
+	GetContainerGroupProfileImages(ctx context.Context, profile ContainerGroupProfileReference) (map[string]string, error)
 	GetContainerGroupInfo(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error)
 	GetContainerGroupListResult(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error)
 	ListCapabilities(ctx context.Context, region string) ([]*azaciv2.Capabilities, error)
+	ListUsage(ctx context.Context, region string) ([]*azaciv2.Usage, error)
 	DeleteContainerGroup(ctx context.Context, resourceGroup, cgName string) error
+	// DeleteContainerGroupAndWait deletes a container group and waits for the deletion to complete, so that a
+	// container group with the same name can be created in another region right after.
+	DeleteContainerGroupAndWait(ctx context.Context, resourceGroup, cgName string) error
+	// StopContainerGroup stops the containers of a container group and releases its compute, keeping the group.
+	StopContainerGroup(ctx context.Context, resourceGroup, cgName string) error
+	// StartContainerGroup starts the containers of a stopped container group again.
+	StartContainerGroup(ctx context.Context, resourceGroup, cgName string) error
+	UpdateContainerGroupTags(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error
 	ListLogs(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error)
 	ExecuteContainerCommand(ctx context.Context, resourceGroup, cgName, containerName string, containerReq azaciv2.ContainerExecRequest) (*azaciv2.ContainerExecResponse, error)
+	AttachToContainer(ctx context.Context, resourceGroup, cgName, containerName string) (*azaciv2.ContainerAttachResponse, error)
 }
 
 type AzClientsAPIs struct {
 	ContainersClient     *azaciv2.ContainersClient
 	ContainerGroupClient *azaciv2.ContainerGroupsClient
 	LocationClient       *azaciv2.LocationClient
+	// UseResourceGraph lists the container groups with Azure Resource Graph queries, see
+	// listContainerGroupsFromResourceGraph.
+	UseResourceGraph bool
+
+	// pipeline sends the requests of the APIs which the ACI SDK doesn't support.
+	pipeline       runtime.Pipeline
+	endpoint       string
+	subscriptionID string
 }
 
 func NewAzClientsAPIs(ctx context.Context, azConfig auth.Config) (*AzClientsAPIs, error) {
@@ -46,28 +74,25 @@ func NewAzClientsAPIs(ctx context.Context, azConfig auth.Config) (*AzClientsAPIs
 
 	logger.Debug("getting azure credential")
 
-	var err error
-	var credential azcore.TokenCredential
-	isUserIdentity := len(azConfig.AuthConfig.ClientID) == 0
-
-	if isUserIdentity {
-		credential, err = azConfig.GetMSICredential(ctx)
-	} else {
-		credential, err = azConfig.GetSPCredential(ctx)
-	}
+	credential, err := azConfig.GetCredential(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error has occurred while creating getting credential ")
 	}
 
+	logger.Debug("setting aci retry policy")
+	clientOptions, err := GetClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Debug("setting aci user agent")
 	userAgent := os.Getenv("ACI_EXTRA_USER_AGENT")
+	clientOptions.Cloud = azConfig.Cloud
+	clientOptions.Telemetry = policy.TelemetryOptions{
+		ApplicationID: userAgent,
+	}
 	options := arm.ClientOptions{
-		ClientOptions: azcore.ClientOptions{
-			Cloud: azConfig.Cloud,
-			Telemetry: policy.TelemetryOptions{
-				ApplicationID: userAgent,
-			},
-		},
+		ClientOptions: clientOptions,
 	}
 
 	logger.Debug("initializing aci clients")
@@ -86,9 +111,20 @@ func NewAzClientsAPIs(ctx context.Context, azConfig auth.Config) (*AzClientsAPIs
 		return nil, errors.Wrap(err, "failed to create location client ")
 	}
 
+	pl, err := armruntime.NewPipeline(previewClientName, previewClientVersion, credential, runtime.PipelineOptions{}, &options)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create preview API pipeline ")
+	}
+
 	obj.ContainersClient = cClient
 	obj.ContainerGroupClient = cgClient
 	obj.LocationClient = lClient
+	obj.pipeline = pl
+	obj.subscriptionID = azConfig.AuthConfig.SubscriptionID
+	obj.endpoint = cloud.AzurePublic.Services[cloud.ResourceManager].Endpoint
+	if svc, ok := azConfig.Cloud.Services[cloud.ResourceManager]; ok && svc.Endpoint != "" {
+		obj.endpoint = svc.Endpoint
+	}
 
 	logger.Debug("aci clients have been initialized successfully")
 	return &obj, nil
@@ -115,7 +151,7 @@ func (a *AzClientsAPIs) GetContainerGroup(ctx context.Context, resourceGroup, co
 	return &result.ContainerGroup, nil
 }
 
-func (a *AzClientsAPIs) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+func (a *AzClientsAPIs) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) (string, error) {
 	logger := log.G(ctx).WithField("method", "CreateContainerGroup")
 	ctx, span := trace.StartSpan(ctx, "client.CreateContainerGroup")
 	defer span.End()
@@ -129,6 +165,7 @@ func (a *AzClientsAPIs) CreateContainerGroup(ctx context.Context, resourceGroup,
 		Location:   cg.Location,
 		Tags:       cg.Tags,
 		ID:         cg.ID,
+		Zones:      cg.Zones,
 	}
 
 	var rawResponse *http.Response
@@ -138,10 +175,26 @@ func (a *AzClientsAPIs) CreateContainerGroup(ctx context.Context, resourceGroup,
 	_, err := a.ContainerGroupClient.BeginCreateOrUpdate(ctxWithResp, resourceGroup, cgName, containerGroup, nil)
 	if err != nil {
 		logger.Errorf("an error has occurred while creating container group %s, status code %d", cgName, rawResponse.StatusCode)
-		return err
+		return "", err
 	}
 
-	return nil
+	operationID := getOperationID(rawResponse)
+	logger.Infof("ARM operation %s is creating container group %s", operationID, cgName)
+	return operationID, nil
+}
+
+// getOperationID returns the ID of the asynchronous ARM operation started by a request, falling back to
+// the ID of the request itself when ARM completed the operation synchronously.
+func getOperationID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	if asyncOperation := resp.Header.Get("Azure-AsyncOperation"); asyncOperation != "" {
+		if u, err := url.Parse(asyncOperation); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+	return resp.Header.Get("x-ms-request-id")
 }
 
 // GetContainerGroupInfo returns a container group from ACI.
@@ -180,6 +233,10 @@ func (a *AzClientsAPIs) GetContainerGroupListResult(ctx context.Context, resourc
 	ctx, span := trace.StartSpan(ctx, "client.GetContainerGroupListResult")
 	defer span.End()
 
+	if cgList, ok := a.listContainerGroups(ctx, resourceGroup); ok {
+		return cgList, nil
+	}
+
 	var rawResponse *http.Response
 	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
 
@@ -223,6 +280,23 @@ func (a *AzClientsAPIs) ListCapabilities(ctx context.Context, region string) ([]
 	return capList, nil
 }
 
+func (a *AzClientsAPIs) ListUsage(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+	ctx, span := trace.StartSpan(ctx, "client.ListUsage")
+	defer span.End()
+
+	pager := a.LocationClient.NewListUsagePager(region, nil)
+
+	var usageList []*azaciv2.Usage
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to fetch the ACI usage for the location %s", region)
+		}
+		usageList = append(usageList, page.Value...)
+	}
+	return usageList, nil
+}
+
 func (a *AzClientsAPIs) DeleteContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
 	logger := log.G(ctx).WithField("method", "DeleteContainerGroup")
 	ctx, span := trace.StartSpan(ctx, "client.DeleteContainerGroup")
@@ -241,6 +315,91 @@ func (a *AzClientsAPIs) DeleteContainerGroup(ctx context.Context, resourceGroup,
 	return nil
 }
 
+func (a *AzClientsAPIs) DeleteContainerGroupAndWait(ctx context.Context, resourceGroup, cgName string) error {
+	logger := log.G(ctx).WithField("method", "DeleteContainerGroupAndWait")
+	ctx, span := trace.StartSpan(ctx, "client.DeleteContainerGroupAndWait")
+	defer span.End()
+
+	var rawResponse *http.Response
+	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
+
+	poller, err := a.ContainerGroupClient.BeginDelete(ctxWithResp, resourceGroup, cgName, nil)
+	if err != nil {
+		if rawResponse != nil {
+			logger.Errorf("failed to delete container group %s, status code %d", cgName, rawResponse.StatusCode)
+		}
+		return err
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		logger.Errorf("failed to wait for the deletion of container group %s", cgName)
+		return err
+	}
+
+	logger.Infof("container group %s has been deleted", cgName)
+	return nil
+}
+
+func (a *AzClientsAPIs) StopContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	logger := log.G(ctx).WithField("method", "StopContainerGroup")
+	ctx, span := trace.StartSpan(ctx, "client.StopContainerGroup")
+	defer span.End()
+
+	var rawResponse *http.Response
+	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
+
+	_, err := a.ContainerGroupClient.Stop(ctxWithResp, resourceGroup, cgName, nil)
+	if err != nil {
+		if rawResponse != nil {
+			logger.Errorf("failed to stop container group %s, status code %d", cgName, rawResponse.StatusCode)
+		}
+		return err
+	}
+
+	logger.Infof("container group %s has been stopped", cgName)
+	return nil
+}
+
+func (a *AzClientsAPIs) StartContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	logger := log.G(ctx).WithField("method", "StartContainerGroup")
+	ctx, span := trace.StartSpan(ctx, "client.StartContainerGroup")
+	defer span.End()
+
+	var rawResponse *http.Response
+	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
+
+	_, err := a.ContainerGroupClient.BeginStart(ctxWithResp, resourceGroup, cgName, nil)
+	if err != nil {
+		if rawResponse != nil {
+			logger.Errorf("failed to start container group %s, status code %d", cgName, rawResponse.StatusCode)
+		}
+		return err
+	}
+
+	logger.Infof("container group %s is starting", cgName)
+	return nil
+}
+
+// UpdateContainerGroupTags replaces the tags of a container group without touching its containers.
+func (a *AzClientsAPIs) UpdateContainerGroupTags(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+	logger := log.G(ctx).WithField("method", "UpdateContainerGroupTags")
+	ctx, span := trace.StartSpan(ctx, "client.UpdateContainerGroupTags")
+	defer span.End()
+
+	var rawResponse *http.Response
+	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
+
+	_, err := a.ContainerGroupClient.Update(ctxWithResp, resourceGroup, cgName, azaciv2.Resource{Tags: tags}, nil)
+	if err != nil {
+		if rawResponse != nil {
+			logger.Errorf("failed to update the tags of container group %s, status code %d", cgName, rawResponse.StatusCode)
+		}
+		return err
+	}
+
+	logger.Infof("tags of container group %s have been updated", cgName)
+	return nil
+}
+
 func (a *AzClientsAPIs) ListLogs(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
 	logger := log.G(ctx).WithField("method", "ListLogs")
 	ctx, span := trace.StartSpan(ctx, "client.ListLogs")
@@ -249,14 +408,14 @@ func (a *AzClientsAPIs) ListLogs(ctx context.Context, resourceGroup, cgName, con
 	var rawResponse *http.Response
 	ctxWithResp := runtime.WithCaptureResponse(ctx, &rawResponse)
 
+	// the logs are read with timestamps, which the since options filter the lines with
 	enableTimestamp := true
 
-	// tail should be > 0, otherwise, set to nil
+	// tail should be > 0, otherwise, set to nil. The since options apply before the tail, which is then
+	// trimmed from the filtered lines.
 	var logTail *int32
 	tail := int32(opts.Tail)
-	if opts.Tail == 0 {
-		logTail = nil
-	} else {
+	if opts.Tail > 0 && opts.SinceSeconds == 0 && opts.SinceTime.IsZero() {
 		logTail = &tail
 	}
 
@@ -270,8 +429,12 @@ func (a *AzClientsAPIs) ListLogs(ctx context.Context, resourceGroup, cgName, con
 		logger.Errorf("error getting container logs, name: %s , container group:  %s, status code %d", containerName, cgName, rawResponse.StatusCode)
 		return nil, err
 	}
+	if response.Content == nil {
+		return nil, nil
+	}
 
-	return response.Content, nil
+	logs := ApplyLogOptions(*response.Content, opts, time.Now())
+	return &logs, nil
 }
 
 func (a *AzClientsAPIs) ExecuteContainerCommand(ctx context.Context, resourceGroup, cgName, containerName string, containerReq azaciv2.ContainerExecRequest) (*azaciv2.ContainerExecResponse, error) {
@@ -292,6 +455,21 @@ func (a *AzClientsAPIs) ExecuteContainerCommand(ctx context.Context, resourceGro
 	return &result.ContainerExecResponse, nil
 }
 
+func (a *AzClientsAPIs) AttachToContainer(ctx context.Context, resourceGroup, cgName, containerName string) (*azaciv2.ContainerAttachResponse, error) {
+	logger := log.G(ctx).WithField("method", "AttachToContainer")
+	ctx, span := trace.StartSpan(ctx, "client.AttachToContainer")
+	defer span.End()
+
+	result, err := a.ContainersClient.Attach(ctx, resourceGroup, cgName, containerName, nil)
+	if err != nil {
+		logger.WithError(err).Errorf("an error has occurred while attaching to container %s of container group %s", containerName, cgName)
+		return nil, err
+	}
+
+	logger.Debug("AttachToContainer is successful")
+	return &result.ContainerAttachResponse, nil
+}
+
 func containerGroupName(podNS, podName string) string {
 	return fmt.Sprintf("%s-%s", podNS, podName)
 }
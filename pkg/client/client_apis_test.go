@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+)
+
+func TestGetOperationID(t *testing.T) {
+	async := &http.Response{Header: http.Header{}}
+	async.Header.Set("Azure-AsyncOperation", "https://management.azure.com/subscriptions/sub/providers/Microsoft.ContainerInstance/locations/westus/operations/op-id?api-version=2022-10-01-preview")
+	async.Header.Set("x-ms-request-id", "request-id")
+	assert.Equal(t, "op-id", getOperationID(async))
+
+	sync := &http.Response{Header: http.Header{}}
+	sync.Header.Set("x-ms-request-id", "request-id")
+	assert.Equal(t, "request-id", getOperationID(sync))
+
+	assert.Equal(t, "", getOperationID(nil))
+}
+
+func TestGetContainerGroupFromProfileBody(t *testing.T) {
+	location := "westus"
+	restartPolicy := azaciv2.ContainerGroupRestartPolicyNever
+	revision := int64(3)
+	cg := &azaciv2.ContainerGroup{
+		Location:   &location,
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{RestartPolicy: &restartPolicy},
+	}
+
+	body, err := getContainerGroupFromProfileBody("ns-pod", cg, ContainerGroupProfileReference{
+		ID:            "profile-id",
+		Revision:      &revision,
+		StandbyPoolID: "pool-id",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, "ns-pod", body["name"])
+	assert.Equal(t, "westus", body["location"])
+	properties := body["properties"].(map[string]interface{})
+	assert.Equal(t, "Never", properties["restartPolicy"])
+	assert.DeepEqual(t, map[string]interface{}{"id": "profile-id", "revision": float64(3)}, properties["containerGroupProfile"])
+	assert.DeepEqual(t, map[string]interface{}{"id": "pool-id"}, properties["standbyPoolProfile"])
+
+	body, err = getContainerGroupFromProfileBody("ns-pod", cg, ContainerGroupProfileReference{ID: "profile-id"})
+	assert.NilError(t, err)
+	properties = body["properties"].(map[string]interface{})
+	assert.DeepEqual(t, map[string]interface{}{"id": "profile-id"}, properties["containerGroupProfile"])
+	_, ok := properties["standbyPoolProfile"]
+	assert.Assert(t, !ok)
+}
+
+func TestGetContainerGroupFromProfileBodyOverlay(t *testing.T) {
+	name, image, envName, envValue := "app", "nginx", "MODE", "debug"
+	restartPolicy := azaciv2.ContainerGroupRestartPolicyNever
+	cg := &azaciv2.ContainerGroup{
+		Tags: map[string]*string{"PodName": &name},
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{
+			RestartPolicy: &restartPolicy,
+			Containers: []*azaciv2.Container{{
+				Name: &name,
+				Properties: &azaciv2.ContainerProperties{
+					Image:                &image,
+					EnvironmentVariables: []*azaciv2.EnvironmentVariable{{Name: &envName, Value: &envValue}},
+				},
+			}},
+		},
+	}
+
+	body, err := getContainerGroupFromProfileBody("ns-pod", cg, ContainerGroupProfileReference{ID: "profile-id", Overlay: true})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]interface{}{"PodName": "app"}, body["tags"])
+	properties := body["properties"].(map[string]interface{})
+	assert.DeepEqual(t, map[string]interface{}{
+		"containerGroupProfile": map[string]interface{}{"id": "profile-id"},
+		"containers": []interface{}{map[string]interface{}{
+			"name": "app",
+			"properties": map[string]interface{}{
+				"environmentVariables": []interface{}{map[string]interface{}{"name": "MODE", "value": "debug"}},
+			},
+		}},
+	}, properties)
+}
+
+type profileTransport struct {
+	status int
+	urls   []string
+}
+
+func (f *profileTransport) Do(req *http.Request) (*http.Response, error) {
+	f.urls = append(f.urls, req.URL.Path)
+	body := `{"properties": {"containers": [{"name": "app", "properties": {"image": "nginx:1.25"}}],
+		"initContainers": [{"name": "init", "properties": {"image": "busybox"}}]}}`
+	return &http.Response{StatusCode: f.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestGetContainerGroupProfileImages(t *testing.T) {
+	transport := &profileTransport{status: http.StatusOK}
+	a := &AzClientsAPIs{
+		pipeline: runtime.NewPipeline("client", "test", runtime.PipelineOptions{}, &policy.ClientOptions{Transport: transport}),
+		endpoint: "https://management.azure.com",
+	}
+	id := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerInstance/containerGroupProfiles/web"
+	revision := int64(2)
+
+	images, err := a.GetContainerGroupProfileImages(context.Background(), ContainerGroupProfileReference{ID: id, Revision: &revision})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]string{"app": "nginx:1.25", "init": "busybox"}, images)
+	assert.DeepEqual(t, []string{id + "/revisions/2"}, transport.urls)
+
+	transport.status = http.StatusNotFound
+	_, err = a.GetContainerGroupProfileImages(context.Background(), ContainerGroupProfileReference{ID: id})
+	assert.Assert(t, errdefs.IsNotFound(err))
+}
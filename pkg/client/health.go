@@ -0,0 +1,71 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+var sharedARMHealth = NewARMHealth()
+
+// ARMHealth tracks the failures of the ARM calls the provider reports in the conditions of the node: the
+// authentication failures, until an ARM call succeeds again, and the last throttled ARM call.
+type ARMHealth struct {
+	lock                  sync.Mutex
+	authenticationFailure string
+	authenticationFailed  time.Time
+	lastThrottled         time.Time
+}
+
+func NewARMHealth() *ARMHealth {
+	return &ARMHealth{}
+}
+
+// GetARMHealth returns the health of the ARM calls of all the clients of the provider.
+func GetARMHealth() *ARMHealth {
+	return sharedARMHealth
+}
+
+// GetAuthenticationFailure returns the last authentication failure and when it happened, or an empty message when
+// the last ARM call was authenticated.
+func (h *ARMHealth) GetAuthenticationFailure() (string, time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.authenticationFailure, h.authenticationFailed
+}
+
+// GetLastThrottled returns when ARM last throttled a call of the provider.
+func (h *ARMHealth) GetLastThrottled() time.Time {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.lastThrottled
+}
+
+// RecordResponse records the outcome of an ARM call: the token of the provider couldn't be acquired or ARM
+// rejected it, or the call was authenticated.
+func (h *ARMHealth) RecordResponse(resp *http.Response, err error, now time.Time) {
+	var authErr *azidentity.AuthenticationFailedError
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch {
+	case errors.As(err, &authErr):
+		h.authenticationFailure = authErr.Error()
+		h.authenticationFailed = now
+	case resp != nil && resp.StatusCode == http.StatusUnauthorized:
+		h.authenticationFailure = fmt.Sprintf("ARM rejected the token of the provider for %s %s", resp.Request.Method, resp.Request.URL.Path)
+		h.authenticationFailed = now
+	case resp != nil:
+		h.authenticationFailure = ""
+	}
+}
+
+// RecordThrottled records a throttled ARM call.
+func (h *ARMHealth) RecordThrottled(now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastThrottled = now
+}
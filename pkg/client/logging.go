@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+const (
+	requestIDHeader            = "x-ms-request-id"
+	correlationRequestIDHeader = "x-ms-correlation-request-id"
+)
+
+// armLoggingPolicy logs every try of the ARM calls with the request and correlation IDs returned by ARM, which
+// identify the call to the Azure support, and with the pod the call is made for, when the context has one.
+type armLoggingPolicy struct{}
+
+func (armLoggingPolicy) Do(req *policy.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := req.Next()
+
+	ctx := logging.WithComponent(req.Raw().Context(), logging.ComponentClient)
+	logger := log.G(ctx).WithFields(log.Fields{
+		"method":   req.Raw().Method,
+		"path":     req.Raw().URL.Path,
+		"duration": time.Since(start).String(),
+	})
+	if err != nil {
+		logger.WithError(err).Warn("ARM request failed")
+		return resp, err
+	}
+
+	logger = logger.WithFields(log.Fields{
+		"statusCode":           resp.StatusCode,
+		"requestID":            resp.Header.Get(requestIDHeader),
+		"correlationRequestID": resp.Header.Get(correlationRequestIDHeader),
+	})
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+		logger.Warn("ARM request returned an error")
+	} else {
+		logger.Debug("ARM request")
+	}
+	return resp, err
+}
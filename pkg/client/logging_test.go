@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/sirupsen/logrus"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
+	"gotest.tools/assert"
+)
+
+type requestIDTransport struct{}
+
+func (requestIDTransport) Do(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set(requestIDHeader, "request-id")
+	header.Set(correlationRequestIDHeader, "correlation-id")
+	return &http.Response{StatusCode: http.StatusConflict, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestARMLoggingPolicy(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	ctx := log.WithLogger(context.Background(), logruslogger.FromLogrus(logrus.NewEntry(logger)))
+	ctx = logging.WithPod(ctx, "ns", "pod", "pod-uid")
+
+	pl := runtime.NewPipeline("client", "test", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport:        requestIDTransport{},
+		Retry:            policy.RetryOptions{MaxRetries: -1},
+		PerRetryPolicies: []policy.Policy{armLoggingPolicy{}},
+	})
+	req, err := runtime.NewRequest(ctx, http.MethodPut, "https://management.azure.com/containerGroups/cg")
+	assert.NilError(t, err)
+	_, err = pl.Do(req)
+	assert.NilError(t, err)
+
+	for _, field := range []string{"podUID=pod-uid", "requestID=request-id", "correlationRequestID=correlation-id",
+		"component=client", "statusCode=409", "path=/containerGroups/cg"} {
+		assert.Check(t, bytes.Contains(out.Bytes(), []byte(field)), "missing %s in %s", field, out.String())
+	}
+}
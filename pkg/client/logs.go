@@ -0,0 +1,70 @@
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+// ApplyLogOptions trims logs read from ACI with timestamps to the options of a log request, in the order of the
+// kubelet: the lines since a time, then the last lines, then the timestamps, then the byte limit. Lines without
+// timestamp belong to the line before them.
+func ApplyLogOptions(logs string, opts api.ContainerLogOpts, now time.Time) string {
+	since := opts.SinceTime
+	if opts.SinceSeconds > 0 {
+		since = now.Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	}
+
+	lines := strings.SplitAfter(logs, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if !since.IsZero() {
+		filtered := lines[:0:0]
+		include := true
+		for _, line := range lines {
+			if timestamp, _, ok := splitLogTimestamp(line); ok {
+				include = !timestamp.Before(since)
+			}
+			if include {
+				filtered = append(filtered, line)
+			}
+		}
+		lines = filtered
+	}
+
+	if opts.Tail > 0 && len(lines) > opts.Tail {
+		lines = lines[len(lines)-opts.Tail:]
+	}
+
+	var result strings.Builder
+	for _, line := range lines {
+		if !opts.Timestamps {
+			if _, message, ok := splitLogTimestamp(line); ok {
+				line = message
+			}
+		}
+		result.WriteString(line)
+	}
+
+	trimmed := result.String()
+	if opts.LimitBytes > 0 && len(trimmed) > opts.LimitBytes {
+		trimmed = trimmed[:opts.LimitBytes]
+	}
+	return trimmed
+}
+
+// splitLogTimestamp splits a log line into its RFC 3339 timestamp and its message.
+func splitLogTimestamp(line string) (time.Time, string, bool) {
+	prefix, message, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, line, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return timestamp, message, true
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestApplyLogOptions(t *testing.T) {
+	logs := "2023-01-01T00:00:01.5Z first\n" +
+		"2023-01-01T00:00:02Z second\n" +
+		"continued\n" +
+		"2023-01-01T00:00:03Z third\n"
+	now, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:04Z")
+
+	cases := []struct {
+		description string
+		opts        api.ContainerLogOpts
+		expected    string
+	}{
+		{
+			description: "without timestamps",
+			expected:    "first\nsecond\ncontinued\nthird\n",
+		},
+		{
+			description: "with timestamps",
+			opts:        api.ContainerLogOpts{Timestamps: true},
+			expected:    logs,
+		},
+		{
+			description: "tail",
+			opts:        api.ContainerLogOpts{Tail: 2},
+			expected:    "continued\nthird\n",
+		},
+		{
+			description: "since seconds",
+			opts:        api.ContainerLogOpts{SinceSeconds: 2},
+			expected:    "second\ncontinued\nthird\n",
+		},
+		{
+			description: "since time and tail",
+			opts:        api.ContainerLogOpts{SinceTime: now.Add(-3 * time.Second), Tail: 3},
+			expected:    "second\ncontinued\nthird\n",
+		},
+		{
+			description: "limit bytes",
+			opts:        api.ContainerLogOpts{LimitBytes: 8},
+			expected:    "first\nse",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Check(t, is.Equal(tc.expected, ApplyLogOptions(logs, tc.opts, now)))
+		})
+	}
+}
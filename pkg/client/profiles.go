@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+const (
+	// previewAPIVersion is the version of the ACI API supporting container group profiles and standby pools,
+	// which the SDK doesn't support yet.
+	previewAPIVersion    = "2024-05-01-preview"
+	previewClientName    = "armcontainerinstance"
+	previewClientVersion = "v1.0.0"
+)
+
+// ContainerGroupProfileReference references the container group profile a container group is created from, and
+// optionally the standby pool of container groups prepared from the profile, which ACI takes a container group
+// from instead of creating it when one is available. With Overlay, the container group only overlays the names and
+// environment variables of its containers on the profile, which describes the rest of the container group.
+type ContainerGroupProfileReference struct {
+	ID            string
+	Revision      *int64
+	StandbyPoolID string
+	Overlay       bool
+}
+
+type containerGroupProfileProperties struct {
+	ContainerGroupProfile *containerGroupProfileStub `json:"containerGroupProfile,omitempty"`
+	StandbyPoolProfile    *standbyPoolProfile        `json:"standbyPoolProfile,omitempty"`
+}
+
+type containerGroupProfileStub struct {
+	ID       string `json:"id"`
+	Revision *int64 `json:"revision,omitempty"`
+}
+
+type standbyPoolProfile struct {
+	ID string `json:"id"`
+}
+
+// containerGroupProfile is the part of a container group profile describing the images of its containers.
+type containerGroupProfile struct {
+	Properties struct {
+		Containers     []profileContainer `json:"containers"`
+		InitContainers []profileContainer `json:"initContainers"`
+	} `json:"properties"`
+}
+
+type profileContainer struct {
+	Name       string `json:"name"`
+	Properties struct {
+		Image string `json:"image"`
+	} `json:"properties"`
+}
+
+// GetContainerGroupProfileImages returns the images of the containers and init containers of the revision of a
+// container group profile, by container name, with the preview ACI API.
+func (a *AzClientsAPIs) GetContainerGroupProfileImages(ctx context.Context, profile ContainerGroupProfileReference) (map[string]string, error) {
+	ctx, span := trace.StartSpan(ctx, "client.GetContainerGroupProfileImages")
+	defer span.End()
+
+	url := runtime.JoinPaths(a.endpoint, profile.ID)
+	if profile.Revision != nil {
+		url = runtime.JoinPaths(url, "revisions", strconv.FormatInt(*profile.Revision, 10))
+	}
+	req, err := runtime.NewRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", previewAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+	req.Raw().Header.Set("Accept", "application/json")
+
+	resp, err := a.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.HasStatusCode(resp, http.StatusNotFound) {
+		return nil, errdefs.NotFoundf("container group profile %s is not found", profile.ID)
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+	var result containerGroupProfile
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the container group profile ")
+	}
+
+	images := make(map[string]string, len(result.Properties.Containers)+len(result.Properties.InitContainers))
+	for _, container := range append(result.Properties.Containers, result.Properties.InitContainers...) {
+		images[container.Name] = container.Properties.Image
+	}
+	return images, nil
+}
+
+// CreateContainerGroupFromProfile starts creating a container group from a container group profile with the
+// preview ACI API, and returns the ID of the ARM operation creating it.
+func (a *AzClientsAPIs) CreateContainerGroupFromProfile(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile ContainerGroupProfileReference) (string, error) {
+	logger := log.G(ctx).WithField("method", "CreateContainerGroupFromProfile")
+	ctx, span := trace.StartSpan(ctx, "client.CreateContainerGroupFromProfile")
+	defer span.End()
+	cgName := containerGroupName(podNS, podName)
+
+	body, err := getContainerGroupFromProfileBody(cgName, cg, profile)
+	if err != nil {
+		return "", err
+	}
+
+	url := runtime.JoinPaths(a.endpoint, "subscriptions", a.subscriptionID, "resourceGroups", resourceGroup,
+		"providers/Microsoft.ContainerInstance/containerGroups", cgName)
+	req, err := runtime.NewRequest(ctx, http.MethodPut, url)
+	if err != nil {
+		return "", err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", previewAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+	req.Raw().Header.Set("Accept", "application/json")
+	if err := runtime.MarshalAsJSON(req, body); err != nil {
+		return "", err
+	}
+
+	logger.Infof("creating container group with name: %s from profile %s", cgName, profile.ID)
+	resp, err := a.pipeline.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK, http.StatusCreated) {
+		logger.Errorf("an error has occurred while creating container group %s, status code %d", cgName, resp.StatusCode)
+		return "", runtime.NewResponseError(resp)
+	}
+
+	operationID := getOperationID(resp)
+	logger.Infof("ARM operation %s is creating container group %s", operationID, cgName)
+	return operationID, nil
+}
+
+// getContainerGroupFromProfileBody returns the container group to create, referencing the profile and the standby
+// pool in its properties.
+func getContainerGroupFromProfileBody(cgName string, cg *azaciv2.ContainerGroup, profile ContainerGroupProfileReference) (map[string]interface{}, error) {
+	properties := cg.Properties
+	if profile.Overlay {
+		properties = getProfileOverlayProperties(cg.Properties)
+	}
+	containerGroup := azaciv2.ContainerGroup{
+		Properties: properties,
+		Name:       &cgName,
+		Identity:   cg.Identity,
+		Location:   cg.Location,
+		Tags:       cg.Tags,
+		Zones:      cg.Zones,
+	}
+	data, err := json.Marshal(containerGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal container group ")
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal container group ")
+	}
+
+	extra := containerGroupProfileProperties{
+		ContainerGroupProfile: &containerGroupProfileStub{ID: profile.ID, Revision: profile.Revision},
+	}
+	if profile.StandbyPoolID != "" {
+		extra.StandbyPoolProfile = &standbyPoolProfile{ID: profile.StandbyPoolID}
+	}
+	data, err = json.Marshal(extra)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal container group profile ")
+	}
+	bodyProperties, _ := body["properties"].(map[string]interface{})
+	if bodyProperties == nil {
+		bodyProperties = make(map[string]interface{})
+	}
+	if err := json.Unmarshal(data, &bodyProperties); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal container group profile ")
+	}
+	body["properties"] = bodyProperties
+	return body, nil
+}
+
+// getProfileOverlayProperties returns the properties of a container group overlaid on its profile: the names of
+// its containers, matched against the containers of the profile, and their environment variables.
+func getProfileOverlayProperties(properties *azaciv2.ContainerGroupPropertiesProperties) *azaciv2.ContainerGroupPropertiesProperties {
+	if properties == nil {
+		return nil
+	}
+	overlay := func(containers []*azaciv2.Container) []*azaciv2.Container {
+		overlaid := make([]*azaciv2.Container, 0, len(containers))
+		for _, container := range containers {
+			c := &azaciv2.Container{Name: container.Name, Properties: &azaciv2.ContainerProperties{}}
+			if container.Properties != nil {
+				c.Properties.EnvironmentVariables = container.Properties.EnvironmentVariables
+			}
+			overlaid = append(overlaid, c)
+		}
+		return overlaid
+	}
+	result := &azaciv2.ContainerGroupPropertiesProperties{Containers: overlay(properties.Containers)}
+	for _, container := range properties.InitContainers {
+		initContainer := &azaciv2.InitContainerDefinition{Name: container.Name, Properties: &azaciv2.InitContainerPropertiesDefinition{}}
+		if container.Properties != nil {
+			initContainer.Properties.EnvironmentVariables = container.Properties.EnvironmentVariables
+		}
+		result.InitContainers = append(result.InitContainers, initContainer)
+	}
+	return result
+}
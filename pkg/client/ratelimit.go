@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.opencensus.io/stats"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// The default budgets are the ARM token buckets of a subscription, see
+	// https://learn.microsoft.com/azure/azure-resource-manager/management/request-limits-and-throttling
+	defaultReadsPerSecond  = 25
+	defaultReadBurst       = 250
+	defaultWritesPerSecond = 10
+	defaultWriteBurst      = 200
+)
+
+var (
+	// RateLimitedMeasure counts the ARM calls delayed to stay within the budget of the subscription.
+	RateLimitedMeasure = stats.Int64("aci/arm_rate_limited", "number of ARM calls delayed by the rate limiter", stats.UnitDimensionless)
+
+	sharedRateLimitOnce   sync.Once
+	sharedRateLimitPolicy *rateLimitPolicy
+	sharedRateLimitErr    error
+)
+
+// rateLimitPolicy delays the ARM calls to stay within the read and the write budgets of the subscription, so that
+// ARM doesn't throttle the provider. Reads and writes have separate budgets as in ARM, so listing the container
+// groups doesn't starve their creations.
+type rateLimitPolicy struct {
+	reads  *rate.Limiter
+	writes *rate.Limiter
+}
+
+// getSharedRateLimitPolicy returns the rate limiter shared by all the ARM clients of the provider.
+func getSharedRateLimitPolicy() (*rateLimitPolicy, error) {
+	sharedRateLimitOnce.Do(func() {
+		sharedRateLimitPolicy, sharedRateLimitErr = newRateLimitPolicy()
+	})
+	return sharedRateLimitPolicy, sharedRateLimitErr
+}
+
+// newRateLimitPolicy returns a rate limiter with the budgets of ACI_ARM_READS_PER_SECOND, ACI_ARM_READ_BURST,
+// ACI_ARM_WRITES_PER_SECOND and ACI_ARM_WRITE_BURST, the ARM limits of a subscription by default. They can be
+// lowered to share the budget of the subscription with other virtual nodes or tools.
+func newRateLimitPolicy() (*rateLimitPolicy, error) {
+	readsPerSecond, err := getRateLimitEnv("ACI_ARM_READS_PER_SECOND", defaultReadsPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	readBurst, err := getRateLimitEnv("ACI_ARM_READ_BURST", defaultReadBurst)
+	if err != nil {
+		return nil, err
+	}
+	writesPerSecond, err := getRateLimitEnv("ACI_ARM_WRITES_PER_SECOND", defaultWritesPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	writeBurst, err := getRateLimitEnv("ACI_ARM_WRITE_BURST", defaultWriteBurst)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitPolicy{
+		reads:  rate.NewLimiter(rate.Limit(readsPerSecond), int(readBurst)),
+		writes: rate.NewLimiter(rate.Limit(writesPerSecond), int(writeBurst)),
+	}, nil
+}
+
+func getRateLimitEnv(name string, defaultValue float64) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("error parsing %s: %q is not a number greater than or equal to 1", name, value)
+	}
+	return n, nil
+}
+
+func (p *rateLimitPolicy) Do(req *policy.Request) (*http.Response, error) {
+	limiter := p.writes
+	if method := req.Raw().Method; method == http.MethodGet || method == http.MethodHead {
+		limiter = p.reads
+	}
+
+	if !limiter.Allow() {
+		ctx := req.Raw().Context()
+		recordARMCall(ctx, req.Raw().Method, RateLimitedMeasure)
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return req.Next()
+}
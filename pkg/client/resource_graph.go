@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+const (
+	resourceGraphAPIVersion = "2021-03-01"
+	// resourceGraphPageSize is the maximum number of rows Azure Resource Graph returns at once.
+	resourceGraphPageSize = 1000
+)
+
+type resourceGraphRequest struct {
+	Subscriptions []string             `json:"subscriptions"`
+	Query         string               `json:"query"`
+	Options       resourceGraphOptions `json:"options"`
+}
+
+type resourceGraphOptions struct {
+	Top          int    `json:"$top"`
+	SkipToken    string `json:"$skipToken,omitempty"`
+	ResultFormat string `json:"resultFormat"`
+}
+
+type resourceGraphResponse struct {
+	SkipToken string                    `json:"$skipToken"`
+	Data      []*azaciv2.ContainerGroup `json:"data"`
+}
+
+// listContainerGroupsFromResourceGraph lists the container groups of a resource group with an Azure Resource Graph
+// query, which returns up to a thousand container groups per call, while the ACI API pages them by a hundred.
+// Azure Resource Graph is eventually consistent, so the list may lag behind the creations and deletions.
+func (a *AzClientsAPIs) listContainerGroupsFromResourceGraph(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+	ctx, span := trace.StartSpan(ctx, "client.listContainerGroupsFromResourceGraph")
+	defer span.End()
+
+	body := resourceGraphRequest{
+		Subscriptions: []string{a.subscriptionID},
+		Query:         getContainerGroupsQuery(resourceGroup),
+		Options:       resourceGraphOptions{Top: resourceGraphPageSize, ResultFormat: "objectArray"},
+	}
+	url := runtime.JoinPaths(a.endpoint, "providers/Microsoft.ResourceGraph/resources")
+
+	var cgList []*azaciv2.ContainerGroup
+	for {
+		req, err := runtime.NewRequest(ctx, http.MethodPost, url)
+		if err != nil {
+			return nil, err
+		}
+		query := req.Raw().URL.Query()
+		query.Set("api-version", resourceGraphAPIVersion)
+		req.Raw().URL.RawQuery = query.Encode()
+		req.Raw().Header.Set("Accept", "application/json")
+		if err := runtime.MarshalAsJSON(req, body); err != nil {
+			return nil, err
+		}
+
+		resp, err := a.pipeline.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if !runtime.HasStatusCode(resp, http.StatusOK) {
+			return nil, runtime.NewResponseError(resp)
+		}
+		var page resourceGraphResponse
+		if err := runtime.UnmarshalAsJSON(resp, &page); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the Azure Resource Graph response ")
+		}
+		cgList = append(cgList, page.Data...)
+
+		if page.SkipToken == "" {
+			return cgList, nil
+		}
+		body.Options.SkipToken = page.SkipToken
+	}
+}
+
+// getContainerGroupsQuery returns the Azure Resource Graph query of the container groups of a resource group.
+func getContainerGroupsQuery(resourceGroup string) string {
+	quoted, _ := json.Marshal(strings.ToLower(resourceGroup))
+	return fmt.Sprintf("Resources | where type =~ 'microsoft.containerinstance/containergroups' and resourceGroup =~ %s "+
+		"| project id, name, type, location, tags, zones, identity, properties", quoted)
+}
+
+// listContainerGroups lists the container groups of a resource group with Azure Resource Graph when enabled,
+// falling back to the ACI API when the query fails.
+func (a *AzClientsAPIs) listContainerGroups(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, bool) {
+	if !a.UseResourceGraph {
+		return nil, false
+	}
+	cgList, err := a.listContainerGroupsFromResourceGraph(ctx, resourceGroup)
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("unable to list the container groups of resource group %s with Azure Resource Graph, falling back to the ACI API", resourceGroup)
+		return nil, false
+	}
+	return cgList, true
+}
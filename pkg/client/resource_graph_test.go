@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type resourceGraphTransport struct {
+	pages    []string
+	requests []resourceGraphRequest
+}
+
+func (f *resourceGraphTransport) Do(req *http.Request) (*http.Response, error) {
+	var body resourceGraphRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	f.requests = append(f.requests, body)
+	if len(f.pages) == 0 {
+		return &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(page)), Request: req}, nil
+}
+
+func TestListContainerGroupsFromResourceGraph(t *testing.T) {
+	transport := &resourceGraphTransport{pages: []string{
+		`{"data": [{"name": "ns-pod1", "location": "westus", "tags": {"NodeName": "vk"}}], "$skipToken": "next"}`,
+		`{"data": [{"name": "ns-pod2", "properties": {"provisioningState": "Succeeded"}}]}`,
+	}}
+	a := &AzClientsAPIs{
+		UseResourceGraph: true,
+		pipeline:         runtime.NewPipeline("client", "test", runtime.PipelineOptions{}, &policy.ClientOptions{Transport: transport}),
+		endpoint:         "https://management.azure.com",
+		subscriptionID:   "sub",
+	}
+
+	cgList, ok := a.listContainerGroups(context.Background(), "RG")
+	assert.Assert(t, ok)
+	assert.Assert(t, is.Len(cgList, 2))
+	assert.Check(t, is.Equal("ns-pod1", *cgList[0].Name))
+	assert.Check(t, is.Equal("vk", *cgList[0].Tags["NodeName"]))
+	assert.Check(t, is.Equal("Succeeded", *cgList[1].Properties.ProvisioningState))
+
+	assert.Assert(t, is.Len(transport.requests, 2))
+	assert.Check(t, is.DeepEqual([]string{"sub"}, transport.requests[0].Subscriptions))
+	assert.Check(t, is.Contains(transport.requests[0].Query, `resourceGroup =~ "rg"`))
+	assert.Check(t, is.Equal("", transport.requests[0].Options.SkipToken))
+	assert.Check(t, is.Equal("next", transport.requests[1].Options.SkipToken))
+
+	// the failed queries fall back to the ACI API
+	_, ok = a.listContainerGroups(context.Background(), "rg")
+	assert.Check(t, !ok)
+
+	a.UseResourceGraph = false
+	_, ok = a.listContainerGroups(context.Background(), "rg")
+	assert.Check(t, !ok)
+	assert.Check(t, is.Len(transport.requests, 3))
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// RequestsMeasure counts the ARM calls made by the provider.
+	RequestsMeasure = stats.Int64("aci/arm_requests", "number of ARM calls", stats.UnitDimensionless)
+	// RetriesMeasure counts the retries of ARM calls after a transient failure.
+	RetriesMeasure = stats.Int64("aci/arm_retries", "number of ARM call retries", stats.UnitDimensionless)
+	// ThrottledMeasure counts the ARM responses with status code 429.
+	ThrottledMeasure = stats.Int64("aci/arm_throttled", "number of throttled ARM calls", stats.UnitDimensionless)
+
+	// MethodKey tags the measures with the HTTP method of the ARM call.
+	MethodKey = tag.MustNewKey("method")
+
+	// RetryViews are the views of the ARM call measures, they have to be registered to be exported.
+	RetryViews = []*view.View{
+		{Name: "aci/arm_requests_total", Measure: RequestsMeasure, TagKeys: []tag.Key{MethodKey}, Aggregation: view.Count()},
+		{Name: "aci/arm_retries_total", Measure: RetriesMeasure, TagKeys: []tag.Key{MethodKey}, Aggregation: view.Count()},
+		{Name: "aci/arm_throttled_total", Measure: ThrottledMeasure, TagKeys: []tag.Key{MethodKey}, Aggregation: view.Count()},
+		{Name: "aci/arm_rate_limited_total", Measure: RateLimitedMeasure, TagKeys: []tag.Key{MethodKey}, Aggregation: view.Count()},
+	}
+)
+
+// GetRetryOptions returns the retry policy of the ARM calls. The defaults of the Azure SDK are used unless
+// overwritten by ACI_ARM_MAX_RETRIES, ACI_ARM_RETRY_DELAY and ACI_ARM_MAX_RETRY_DELAY. The SDK retries
+// 408, 429 and 5xx responses with an exponential backoff with jitter and honors the Retry-After header.
+func GetRetryOptions() (policy.RetryOptions, error) {
+	options := policy.RetryOptions{}
+
+	if maxRetries := os.Getenv("ACI_ARM_MAX_RETRIES"); maxRetries != "" {
+		n, err := strconv.ParseInt(maxRetries, 10, 32)
+		if err != nil {
+			return options, fmt.Errorf("error parsing ACI_ARM_MAX_RETRIES: %v", err)
+		}
+		options.MaxRetries = int32(n)
+	}
+	if retryDelay := os.Getenv("ACI_ARM_RETRY_DELAY"); retryDelay != "" {
+		d, err := time.ParseDuration(retryDelay)
+		if err != nil {
+			return options, fmt.Errorf("error parsing ACI_ARM_RETRY_DELAY: %v", err)
+		}
+		options.RetryDelay = d
+	}
+	if maxRetryDelay := os.Getenv("ACI_ARM_MAX_RETRY_DELAY"); maxRetryDelay != "" {
+		d, err := time.ParseDuration(maxRetryDelay)
+		if err != nil {
+			return options, fmt.Errorf("error parsing ACI_ARM_MAX_RETRY_DELAY: %v", err)
+		}
+		options.MaxRetryDelay = d
+	}
+	return options, nil
+}
+
+// GetClientOptions returns the retry policy and the policies recording the retry measures and the ARM health,
+// tracing, logging and rate limiting the ARM calls. The rate limiter is shared by all the clients.
+func GetClientOptions() (policy.ClientOptions, error) {
+	retryOptions, err := GetRetryOptions()
+	if err != nil {
+		return policy.ClientOptions{}, err
+	}
+	rateLimit, err := getSharedRateLimitPolicy()
+	if err != nil {
+		return policy.ClientOptions{}, err
+	}
+	return policy.ClientOptions{
+		Retry:            retryOptions,
+		PerCallPolicies:  []policy.Policy{callCounterPolicy{}, armTracingPolicy{}},
+		PerRetryPolicies: []policy.Policy{rateLimit, tryCounterPolicy{}, armLoggingPolicy{}},
+	}, nil
+}
+
+// tryCounter counts the tries of a single ARM call.
+type tryCounter struct {
+	tries int
+}
+
+type callCounterPolicy struct{}
+
+func (callCounterPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.SetOperationValue(&tryCounter{})
+	recordARMCall(req.Raw().Context(), req.Raw().Method, RequestsMeasure)
+	resp, err := req.Next()
+	sharedARMHealth.RecordResponse(resp, err, time.Now())
+	return resp, err
+}
+
+type tryCounterPolicy struct{}
+
+func (tryCounterPolicy) Do(req *policy.Request) (*http.Response, error) {
+	var counter *tryCounter
+	if req.OperationValue(&counter) && counter != nil {
+		counter.tries++
+		if counter.tries > 1 {
+			recordARMCall(req.Raw().Context(), req.Raw().Method, RetriesMeasure)
+		}
+	}
+
+	resp, err := req.Next()
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		recordARMCall(req.Raw().Context(), req.Raw().Method, ThrottledMeasure)
+		sharedARMHealth.RecordThrottled(time.Now())
+	}
+	return resp, err
+}
+
+func recordARMCall(ctx context.Context, method string, measure *stats.Int64Measure) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(MethodKey, method)}, measure.M(1))
+}
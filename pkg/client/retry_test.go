@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"go.opencensus.io/stats/view"
+	"gotest.tools/assert"
+)
+
+type fakeTransport struct {
+	statusCodes []int
+	tries       int
+}
+
+func (f *fakeTransport) Do(req *http.Request) (*http.Response, error) {
+	code := f.statusCodes[f.tries]
+	f.tries++
+	return &http.Response{StatusCode: code, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+}
+
+func viewCount(t *testing.T, name string) int64 {
+	rows, err := view.RetrieveData(name)
+	assert.NilError(t, err)
+	var count int64
+	for _, row := range rows {
+		count += row.Data.(*view.CountData).Value
+	}
+	return count
+}
+
+func TestGetRetryOptions(t *testing.T) {
+	t.Setenv("ACI_ARM_MAX_RETRIES", "5")
+	t.Setenv("ACI_ARM_RETRY_DELAY", "2s")
+	t.Setenv("ACI_ARM_MAX_RETRY_DELAY", "1m")
+
+	options, err := GetRetryOptions()
+	assert.NilError(t, err)
+	assert.Equal(t, int32(5), options.MaxRetries)
+	assert.Equal(t, 2*time.Second, options.RetryDelay)
+	assert.Equal(t, time.Minute, options.MaxRetryDelay)
+
+	t.Setenv("ACI_ARM_RETRY_DELAY", "two seconds")
+	_, err = GetRetryOptions()
+	assert.ErrorContains(t, err, "ACI_ARM_RETRY_DELAY")
+}
+
+func TestRetryPolicyRecordsRetries(t *testing.T) {
+	assert.NilError(t, view.Register(RetryViews...))
+	defer view.Unregister(RetryViews...)
+
+	t.Setenv("ACI_ARM_RETRY_DELAY", "1ms")
+	options, err := GetClientOptions()
+	assert.NilError(t, err)
+
+	transport := &fakeTransport{statusCodes: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}}
+	options.Transport = transport
+	pl := runtime.NewPipeline("client", "test", runtime.PipelineOptions{}, &options)
+
+	req, err := runtime.NewRequest(context.Background(), http.MethodGet, "https://management.azure.com/test")
+	assert.NilError(t, err)
+	resp, err := pl.Do(req)
+	assert.NilError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, transport.tries)
+
+	assert.Equal(t, int64(1), viewCount(t, "aci/arm_requests_total"))
+	assert.Equal(t, int64(2), viewCount(t, "aci/arm_retries_total"))
+	assert.Equal(t, int64(1), viewCount(t, "aci/arm_throttled_total"))
+	assert.Check(t, !GetARMHealth().GetLastThrottled().IsZero())
+}
+
+func TestARMHealth(t *testing.T) {
+	h := NewARMHealth()
+	now := time.Now()
+	req, err := http.NewRequest(http.MethodGet, "https://management.azure.com/test", nil)
+	assert.NilError(t, err)
+
+	h.RecordResponse(&http.Response{StatusCode: http.StatusUnauthorized, Request: req}, nil, now)
+	failure, at := h.GetAuthenticationFailure()
+	assert.Equal(t, "ARM rejected the token of the provider for GET /test", failure)
+	assert.Equal(t, now, at)
+
+	// the failures without a response don't clear the authentication failure
+	h.RecordResponse(nil, context.DeadlineExceeded, now)
+	failure, _ = h.GetAuthenticationFailure()
+	assert.Check(t, failure != "")
+
+	h.RecordResponse(&http.Response{StatusCode: http.StatusNotFound, Request: req}, nil, now)
+	failure, _ = h.GetAuthenticationFailure()
+	assert.Equal(t, "", failure)
+
+	h.RecordThrottled(now)
+	assert.Equal(t, now, h.GetLastThrottled())
+}
+
+func TestRateLimitPolicy(t *testing.T) {
+	t.Setenv("ACI_ARM_READS_PER_SECOND", "1")
+	t.Setenv("ACI_ARM_READ_BURST", "1")
+	rateLimit, err := newRateLimitPolicy()
+	assert.NilError(t, err)
+	assert.Equal(t, float64(defaultWritesPerSecond), float64(rateLimit.writes.Limit()))
+
+	transport := &fakeTransport{statusCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK}}
+	pl := runtime.NewPipeline("client", "test", runtime.PipelineOptions{PerRetry: []policy.Policy{rateLimit}},
+		&policy.ClientOptions{Transport: transport})
+	send := func(ctx context.Context, method string) error {
+		req, err := runtime.NewRequest(ctx, method, "https://management.azure.com/test")
+		assert.NilError(t, err)
+		_, err = pl.Do(req)
+		return err
+	}
+
+	assert.NilError(t, send(context.Background(), http.MethodGet))
+	// the writes don't wait for the exhausted read budget
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.NilError(t, send(ctx, http.MethodPut))
+	assert.ErrorContains(t, send(ctx, http.MethodGet), "")
+	assert.Equal(t, 2, transport.tries)
+
+	t.Setenv("ACI_ARM_WRITE_BURST", "0")
+	_, err = newRateLimitPolicy()
+	assert.ErrorContains(t, err, "ACI_ARM_WRITE_BURST")
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+// armTracingPolicy traces the ARM calls, retries included, as children of the span of the provider operation.
+type armTracingPolicy struct{}
+
+func (armTracingPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ctx, span := trace.StartSpan(req.Raw().Context(), "client.ARM")
+	defer span.End()
+	span.WithFields(ctx, log.Fields{
+		"http.method": req.Raw().Method,
+		"http.path":   req.Raw().URL.Path,
+	})
+
+	resp, err := req.Next()
+	if err != nil {
+		span.SetStatus(err)
+		return resp, err
+	}
+	span.WithFields(ctx, log.Fields{
+		"http.status_code":    resp.StatusCode,
+		"azure.requestID":     resp.Header.Get(requestIDHeader),
+		"azure.correlationID": resp.Header.Get(correlationRequestIDHeader),
+	})
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(fmt.Errorf("ARM request returned status code %d", resp.StatusCode))
+	}
+	return resp, err
+}
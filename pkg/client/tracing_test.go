@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type fakeSpan struct {
+	name   string
+	fields log.Fields
+	err    error
+	ended  bool
+}
+
+func (s *fakeSpan) End()                { s.ended = true }
+func (s *fakeSpan) SetStatus(err error) { s.err = err }
+func (s *fakeSpan) Logger() log.Logger  { return log.L }
+func (s *fakeSpan) WithField(ctx context.Context, key string, value interface{}) context.Context {
+	s.fields[key] = value
+	return ctx
+}
+func (s *fakeSpan) WithFields(ctx context.Context, fields log.Fields) context.Context {
+	for key, value := range fields {
+		s.fields[key] = value
+	}
+	return ctx
+}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	span := &fakeSpan{name: name, fields: log.Fields{}}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestARMTracingPolicy(t *testing.T) {
+	tracer := &fakeTracer{}
+	ctx := trace.WithTracer(context.Background(), tracer)
+
+	pl := runtime.NewPipeline("client", "test", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport:       requestIDTransport{},
+		Retry:           policy.RetryOptions{MaxRetries: -1},
+		PerCallPolicies: []policy.Policy{armTracingPolicy{}},
+	})
+	req, err := runtime.NewRequest(ctx, http.MethodPut, "https://management.azure.com/containerGroups/cg")
+	assert.NilError(t, err)
+	_, err = pl.Do(req)
+	assert.NilError(t, err)
+
+	assert.Assert(t, is.Len(tracer.spans, 1))
+	span := tracer.spans[0]
+	assert.Check(t, is.Equal("client.ARM", span.name))
+	assert.Check(t, span.ended)
+	assert.Check(t, is.Equal(http.MethodPut, span.fields["http.method"]))
+	assert.Check(t, is.Equal(http.StatusConflict, span.fields["http.status_code"]))
+	assert.Check(t, is.Equal("request-id", span.fields["azure.requestID"]))
+	assert.Check(t, is.ErrorContains(span.err, "status code 409"))
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+const (
+	// ComponentField is the log field naming the component an entry comes from.
+	ComponentField = "component"
+	// PodUIDField is the log field of the UID of the pod an entry is about.
+	PodUIDField = "podUID"
+
+	ComponentTracker = "tracker"
+	ComponentClient  = "client"
+	ComponentNetwork = "network"
+
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config is the configuration of the provider logger.
+type Config struct {
+	// Level is the level of the entries without component or of the components without level.
+	Level string
+	// ComponentLevels are the levels of the components, formatted as component=level,component=level.
+	ComponentLevels string
+	// Format is either text or json, which is ingested as is by Log Analytics.
+	Format string
+}
+
+// NewLogger returns a logger filtering the entries by the level of their component.
+func NewLogger(config Config) (*logrus.Logger, error) {
+	defaultLevel, err := logrus.ParseLevel(config.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %v", config.Level, err)
+	}
+	levels, err := parseComponentLevels(config.ComponentLevels)
+	if err != nil {
+		return nil, err
+	}
+
+	var formatter logrus.Formatter
+	switch config.Format {
+	case "", FormatText:
+		formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", config.Format, FormatText, FormatJSON)
+	}
+
+	// the logger lets through the most verbose level, the formatter drops the entries below the level
+	// of their component
+	maxLevel := defaultLevel
+	for _, level := range levels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(maxLevel)
+	logger.SetFormatter(&componentFormatter{
+		Formatter:    formatter,
+		defaultLevel: defaultLevel,
+		levels:       levels,
+	})
+	return logger, nil
+}
+
+// parseComponentLevels parses a list of component=level.
+func parseComponentLevels(value string) (map[string]logrus.Level, error) {
+	levels := map[string]logrus.Level{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, levelName, ok := strings.Cut(item, "=")
+		if !ok || component == "" {
+			return nil, fmt.Errorf("invalid component log level %q, must be component=level", item)
+		}
+		level, err := logrus.ParseLevel(levelName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level of component %s: %v", component, err)
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+// componentFormatter drops the entries below the level of their component.
+type componentFormatter struct {
+	logrus.Formatter
+	defaultLevel logrus.Level
+	levels       map[string]logrus.Level
+}
+
+func (f *componentFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	level := f.defaultLevel
+	if component, ok := entry.Data[ComponentField].(string); ok {
+		if l, ok := f.levels[component]; ok {
+			level = l
+		}
+	}
+	if entry.Level > level {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// WithComponent returns a context whose logger tags the entries with the component, so that they are filtered
+// by the level of the component.
+func WithComponent(ctx context.Context, component string) context.Context {
+	return log.WithLogger(ctx, log.G(ctx).WithField(ComponentField, component))
+}
+
+// WithPod returns a context whose logger tags the entries with the pod, including the ARM calls made for it.
+func WithPod(ctx context.Context, namespace, name, uid string) context.Context {
+	return log.WithLogger(ctx, log.G(ctx).WithFields(PodFields(namespace, name, uid)))
+}
+
+// PodFields returns the fields identifying a pod in the log entries and the trace spans.
+func PodFields(namespace, name, uid string) log.Fields {
+	return log.Fields{
+		"namespace": namespace,
+		"pod":       name,
+		PodUIDField: uid,
+	}
+}
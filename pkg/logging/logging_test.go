@@ -0,0 +1,57 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestComponentLevels(t *testing.T) {
+	logger, err := NewLogger(Config{Level: "info", ComponentLevels: "tracker=debug, client=error", Format: FormatJSON})
+	assert.NilError(t, err)
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+	ctx := log.WithLogger(context.Background(), logruslogger.FromLogrus(logrus.NewEntry(logger)))
+
+	log.G(ctx).Debug("provider debug")
+	log.G(ctx).Info("provider info")
+	log.G(WithComponent(ctx, ComponentTracker)).Debug("tracker debug")
+	log.G(WithComponent(ctx, ComponentClient)).Warn("client warning")
+	log.G(WithComponent(ctx, ComponentClient)).Error("client error")
+	log.G(WithPod(WithComponent(ctx, ComponentNetwork), "ns", "pod", "uid")).Info("network info")
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]interface{}
+		assert.NilError(t, json.Unmarshal([]byte(line), &entry))
+		messages = append(messages, entry["msg"].(string))
+		if entry["msg"] == "network info" {
+			assert.Check(t, is.Equal("uid", entry[PodUIDField]))
+			assert.Check(t, is.Equal(ComponentNetwork, entry[ComponentField]))
+		}
+	}
+	assert.Check(t, is.DeepEqual([]string{"provider info", "tracker debug", "client error", "network info"}, messages))
+}
+
+func TestNewLoggerErrors(t *testing.T) {
+	_, err := NewLogger(Config{Level: "loud"})
+	assert.Check(t, is.ErrorContains(err, "invalid log level"))
+	_, err = NewLogger(Config{Level: "info", ComponentLevels: "tracker"})
+	assert.Check(t, is.ErrorContains(err, "must be component=level"))
+	_, err = NewLogger(Config{Level: "info", ComponentLevels: "tracker=loud"})
+	assert.Check(t, is.ErrorContains(err, "invalid log level of component tracker"))
+	_, err = NewLogger(Config{Level: "info", Format: "xml"})
+	assert.Check(t, is.ErrorContains(err, "invalid log format"))
+}
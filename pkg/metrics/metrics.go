@@ -31,7 +31,10 @@ type ACIPodMetricsProvider struct {
 	podStatsGetter client.PodStatsGetter
 }
 
-func NewACIPodMetricsProvider(nodeName, aciResourcegroup string, podLister corev1listers.PodLister, aciCGGetter client.ContainerGroupGetter) *ACIPodMetricsProvider {
+// ResourceGroupResolver returns the resource group of the container groups of a namespace.
+type ResourceGroupResolver func(namespace string) string
+
+func NewACIPodMetricsProvider(nodeName string, resourceGroup ResourceGroupResolver, podLister corev1listers.PodLister, aciCGGetter client.ContainerGroupGetter) *ACIPodMetricsProvider {
 	provider := ACIPodMetricsProvider{
 		nodeName:    nodeName,
 		podGetter:   podLister,
@@ -41,7 +44,7 @@ func NewACIPodMetricsProvider(nodeName, aciResourcegroup string, podLister corev
 	realTimeGetter := WrapCachedPodStatsGetter(
 		5,
 		NewRealTimeMetrics())
-	provider.podStatsGetter = NewPodStatsGetterDecider(realTimeGetter, aciResourcegroup, aciCGGetter)
+	provider.podStatsGetter = NewPodStatsGetterDecider(realTimeGetter, resourceGroup, aciCGGetter)
 	return &provider
 }
 
@@ -133,15 +136,15 @@ func (p *ACIPodMetricsProvider) GetStatsSummary(ctx context.Context) (summary *s
 
 type podStatsGetterDecider struct {
 	realTimeGetter client.PodStatsGetter
-	rgName         string
+	resourceGroup  ResourceGroupResolver
 	aciCGGetter    client.ContainerGroupGetter
 	cache          *cache.Cache
 }
 
-func NewPodStatsGetterDecider(realTimeGetter client.PodStatsGetter, rgName string, aciCGGetter client.ContainerGroupGetter) *podStatsGetterDecider {
+func NewPodStatsGetterDecider(realTimeGetter client.PodStatsGetter, resourceGroup ResourceGroupResolver, aciCGGetter client.ContainerGroupGetter) *podStatsGetterDecider {
 	decider := &podStatsGetterDecider{
 		realTimeGetter: realTimeGetter,
-		rgName:         rgName,
+		resourceGroup:  resourceGroup,
 		aciCGGetter:    aciCGGetter,
 		cache:          cache.New(ContainerGroupCacheTTLSeconds*time.Second, 10*time.Minute),
 	}
@@ -185,7 +188,7 @@ func (decider *podStatsGetterDecider) getContainerGroupFromPod(ctx context.Conte
 	if found {
 		return aciContainerGroup.(*azaciv2.ContainerGroup), nil
 	}
-	aciCG, err := decider.aciCGGetter.GetContainerGroup(ctx, decider.rgName, cgName)
+	aciCG, err := decider.aciCGGetter.GetContainerGroup(ctx, decider.resourceGroup(pod.Namespace), cgName)
 	if err != nil {
 		return nil, err
 	}
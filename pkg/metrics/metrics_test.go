@@ -51,7 +51,7 @@ func TestGetStatsSummary(t *testing.T) {
 
 			podLister := NewMockPodGetter(ctrl)
 			mockedPodStatsGetter := NewMockpodStatsGetter(ctrl)
-			podMetricsProvider := NewACIPodMetricsProvider("node-1", "rg", podLister, nil)
+			podMetricsProvider := NewACIPodMetricsProvider("node-1", staticResourceGroup("rg"), podLister, nil)
 			podMetricsProvider.podStatsGetter = mockedPodStatsGetter
 			podLister.EXPECT().List(gomock.Any()).Return(fakePod(getMapKeys(test)), nil)
 			for podName, cpu := range test {
@@ -82,7 +82,7 @@ func TestPodStatsGetterDecider(t *testing.T) {
 		mockedRealtime.EXPECT().GetPodStats(gomock.Any(), gomock.Any()).Return(fakePodStatus("pod-1", 0), nil).Times(1)
 		mockedRealtime.EXPECT().GetPodStats(gomock.Any(), gomock.Any()).Return(fakePodStatus("pod-1", 0), nil).Times(1)
 
-		decider := NewPodStatsGetterDecider(mockedRealtime, "rg", mockedAciCgGetter)
+		decider := NewPodStatsGetterDecider(mockedRealtime, staticResourceGroup("rg"), mockedAciCgGetter)
 		ctx := context.Background()
 		pod := fakePod([]string{"pod-1"})[0]
 		decider.GetPodStats(ctx, pod)
@@ -157,3 +157,9 @@ func getMapKeys(m map[string]uint64) []string {
 	}
 	return keys
 }
+
+func staticResourceGroup(resourceGroup string) ResourceGroupResolver {
+	return func(string) string {
+		return resourceGroup
+	}
+}
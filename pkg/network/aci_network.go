@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
@@ -23,6 +24,8 @@ import (
 	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
 	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
 	"github.com/virtual-kubelet/azure-aci/pkg/auth"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	v1 "k8s.io/api/core/v1"
 )
@@ -33,6 +36,21 @@ const (
 	maxDNSSearchPaths       = 6
 	maxDNSSearchListChars   = 256
 	subnetDelegationService = "Microsoft.ContainerInstance/containerGroups"
+	// defaultDNSNdots is the ndots option of the pods using the cluster DNS, like the kubelet sets it, so that the
+	// names of the services of other namespaces are resolved with the search list first.
+	defaultDNSNdots = "5"
+)
+
+// SubnetAnnotation selects the delegated subnet of the virtual network a pod is placed into.
+const SubnetAnnotation = "virtual-kubelet.io/subnet"
+
+const (
+	// ClusterDNSAnnotation overrides the IP address of the cluster DNS server of a pod in a virtual network, e.g. for
+	// a node local DNS cache, KUBE_DNS_IP by default.
+	ClusterDNSAnnotation = "virtual-kubelet.io/cluster-dns"
+	// ClusterDomainAnnotation overrides the cluster domain of the DNS search list of a pod in a virtual network, the
+	// cluster domain of the virtual node by default.
+	ClusterDomainAnnotation = "virtual-kubelet.io/cluster-domain"
 )
 
 var (
@@ -48,11 +66,17 @@ type ProviderNetwork struct {
 	SubnetName         string
 	SubnetCIDR         string
 	KubeDNSIP          string
+	// NamespaceSubnets maps a namespace to the subnet its pods are placed into by default.
+	NamespaceSubnets map[string]string
+
+	azConfig         *auth.Config
+	validatedSubnets sync.Map
 }
 
 func (pn *ProviderNetwork) SetVNETConfig(ctx context.Context, azConfig *auth.Config) error {
 	ctx, span := trace.StartSpan(ctx, "network.SetVNETConfig")
 	defer span.End()
+	ctx = logging.WithComponent(ctx, logging.ComponentNetwork)
 
 	// the VNET subscription ID by default is authentication subscription ID.
 	// We need to override when using cross subscription virtual network resource
@@ -94,6 +118,11 @@ func (pn *ProviderNetwork) SetVNETConfig(ctx context.Context, azConfig *auth.Con
 		pn.SubnetCIDR = subnetCIDR
 	}
 
+	if len(pn.NamespaceSubnets) > 0 && pn.SubnetName == "" {
+		return fmt.Errorf("namespace subnets defined but no subnet name, subnet name is required to select a subnet per namespace")
+	}
+
+	pn.azConfig = azConfig
 	if pn.SubnetName != "" {
 		if err := pn.setupNetwork(ctx, azConfig); err != nil {
 			return fmt.Errorf("error setting up network: %v", err)
@@ -135,12 +164,17 @@ func (pn *ProviderNetwork) setupNetwork(ctx context.Context, azConfig *auth.Conf
 	currentSubnet := response.Subnet
 
 	if err == nil {
-		if currentSubnet.Properties.AddressPrefix != nil {
+		// dual-stack subnets have their IPv4 and IPv6 prefixes in AddressPrefixes
+		addressPrefix, ipv6Prefixes := getSubnetAddressPrefixes(&currentSubnet)
+		if len(ipv6Prefixes) > 0 {
+			logger.Warnf("subnet '%s' is dual-stack, but ACI only assigns IPv4 addresses to container groups, its IPv6 prefixes %s are not used", pn.SubnetName, strings.Join(ipv6Prefixes, ", "))
+		}
+		if addressPrefix != "" {
 			if pn.SubnetCIDR == "" {
-				pn.SubnetCIDR = *currentSubnet.Properties.AddressPrefix
+				pn.SubnetCIDR = addressPrefix
 			}
-			if pn.SubnetCIDR != *currentSubnet.Properties.AddressPrefix {
-				return fmt.Errorf("found subnet '%s' using different CIDR: '%s'. desired: '%s'", pn.SubnetName, *currentSubnet.Properties.AddressPrefix, pn.SubnetCIDR)
+			if pn.SubnetCIDR != addressPrefix {
+				return fmt.Errorf("found subnet '%s' using different CIDR: '%s'. desired: '%s'", pn.SubnetName, addressPrefix, pn.SubnetCIDR)
 			}
 			if currentSubnet.Properties.RouteTable != nil {
 				return fmt.Errorf("unable to delegate subnet '%s' to Azure Container Instance since it references the route table '%s'", pn.SubnetName, *currentSubnet.Properties.RouteTable.ID)
@@ -181,37 +215,68 @@ func (pn *ProviderNetwork) setupNetwork(ctx context.Context, azConfig *auth.Conf
 	return nil
 }
 
+// getSubnetAddressPrefixes returns the IPv4 prefix and the IPv6 prefixes of a subnet.
+func getSubnetAddressPrefixes(subnet *aznetworkv2.Subnet) (string, []string) {
+	if subnet.Properties == nil {
+		return "", nil
+	}
+	prefixes := subnet.Properties.AddressPrefixes
+	if subnet.Properties.AddressPrefix != nil {
+		prefixes = append([]*string{subnet.Properties.AddressPrefix}, prefixes...)
+	}
+
+	ipv4Prefix := ""
+	var ipv6Prefixes []string
+	for _, prefix := range prefixes {
+		if prefix == nil {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(*prefix)
+		switch {
+		case err != nil:
+		case ip.To4() == nil:
+			ipv6Prefixes = append(ipv6Prefixes, *prefix)
+		case ipv4Prefix == "":
+			ipv4Prefix = *prefix
+		}
+	}
+	return ipv4Prefix, util.OmitDuplicates(ipv6Prefixes)
+}
+
 func getSubnetClient(ctx context.Context, azConfig *auth.Config) (*aznetworkv2.SubnetsClient, error) {
-	logger := log.G(ctx).WithField("method", "getSubnetClient")
 	ctx, span := trace.StartSpan(ctx, "network.getSubnetClient")
 	defer span.End()
 
-	logger.Debug("getting azure credential")
-
-	var err error
-	var credential azcore.TokenCredential
-	isUserIdentity := len(azConfig.AuthConfig.ClientID) == 0
-
-	if isUserIdentity {
-		credential, err = azConfig.GetMSICredential(ctx)
-	} else {
-		credential, err = azConfig.GetSPCredential(ctx)
+	credential, options, err := getClientCredential(ctx, azConfig)
+	if err != nil {
+		return nil, err
 	}
+
+	subnetsClient, err := aznetworkv2.NewSubnetsClient(azConfig.AuthConfig.SubscriptionID, credential, options)
 	if err != nil {
-		return nil, errors.Wrap(err, "an error has occurred while creating getting credential ")
+		return nil, errors.Wrap(err, "an error has occurred while creating subnet client")
 	}
+	return subnetsClient, nil
+}
 
-	options := arm.ClientOptions{
-		ClientOptions: azcore.ClientOptions{
-			Cloud: azConfig.Cloud,
-		},
+// getClientCredential returns the credential and the options of the clients of the network resources.
+func getClientCredential(ctx context.Context, azConfig *auth.Config) (azcore.TokenCredential, *arm.ClientOptions, error) {
+	logger := log.G(ctx).WithField("method", "getClientCredential")
+	logger.Debug("getting azure credential")
+
+	credential, err := azConfig.GetCredential(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "an error has occurred while creating getting credential ")
 	}
 
-	subnetsClient, err := aznetworkv2.NewSubnetsClient(azConfig.AuthConfig.SubscriptionID, credential, &options)
+	clientOptions, err := client.GetClientOptions()
 	if err != nil {
-		return nil, errors.Wrap(err, "an error has occurred while creating subnet client")
+		return nil, nil, err
 	}
-	return subnetsClient, nil
+	clientOptions.Cloud = azConfig.Cloud
+	return credential, &arm.ClientOptions{
+		ClientOptions: clientOptions,
+	}, nil
 }
 
 // createACISubnet create new subnet for ACI
@@ -254,43 +319,169 @@ func (pn *ProviderNetwork) createACISubnet(ctx context.Context, subnetsClient *a
 	return nil
 }
 
-func (pn *ProviderNetwork) AmendVnetResources(ctx context.Context, cg azaciv2.ContainerGroup, pod *v1.Pod, clusterDomain string) {
+// GetPodSubnet returns the name of the subnet a pod is placed into. The subnet annotation
+// of the pod takes precedence over the default subnet of its namespace, which takes precedence
+// over the subnet of the virtual node.
+func (pn *ProviderNetwork) GetPodSubnet(pod *v1.Pod) string {
+	if subnetName := pod.Annotations[SubnetAnnotation]; subnetName != "" {
+		return subnetName
+	}
+	if subnetName := pn.NamespaceSubnets[pod.Namespace]; subnetName != "" {
+		return subnetName
+	}
+	return pn.SubnetName
+}
+
+// ValidateSubnet verifies that the subnet exists in the virtual network and is delegated to
+// Azure Container Instance. Subnets which passed the validation once are not looked up again.
+func (pn *ProviderNetwork) ValidateSubnet(ctx context.Context, subnetName string) error {
+	ctx, span := trace.StartSpan(ctx, "network.ValidateSubnet")
+	defer span.End()
+	ctx = logging.WithComponent(ctx, logging.ComponentNetwork)
+
+	if _, ok := pn.validatedSubnets.Load(subnetName); ok {
+		return nil
+	}
+	if err := pn.CheckSubnet(ctx, subnetName); err != nil {
+		return err
+	}
+
+	pn.validatedSubnets.Store(subnetName, true)
+	return nil
+}
+
+// CheckSubnet looks the subnet up in the virtual network and verifies that it is still delegated to Azure
+// Container Instance, without the cache of ValidateSubnet.
+func (pn *ProviderNetwork) CheckSubnet(ctx context.Context, subnetName string) error {
+	ctx, span := trace.StartSpan(ctx, "network.CheckSubnet")
+	defer span.End()
+	ctx = logging.WithComponent(ctx, logging.ComponentNetwork)
+
+	if pn.azConfig == nil {
+		return fmt.Errorf("unable to validate subnet '%s', virtual network is not configured", subnetName)
+	}
+
+	subnetsClient, err := getSubnetClient(ctx, pn.azConfig)
+	if err != nil {
+		return err
+	}
+
+	response, err := subnetsClient.Get(ctx, pn.VnetResourceGroup, pn.VnetName, subnetName, nil)
+	if err != nil {
+		return fmt.Errorf("error while looking up subnet '%s' in vnet '%s': %v", subnetName, pn.VnetName, err)
+	}
+	if !isSubnetDelegatedToACI(&response.Subnet) {
+		return fmt.Errorf("subnet '%s' in vnet '%s' is not delegated to %s", subnetName, pn.VnetName, subnetDelegationService)
+	}
+	return nil
+}
+
+// isSubnetDelegatedToACI checks whether a subnet is delegated to Azure Container Instance.
+func isSubnetDelegatedToACI(subnet *aznetworkv2.Subnet) bool {
+	if subnet == nil || subnet.Properties == nil {
+		return false
+	}
+	for _, l := range subnet.Properties.ServiceAssociationLinks {
+		if l != nil && l.Properties != nil && l.Properties.LinkedResourceType != nil &&
+			*l.Properties.LinkedResourceType == subnetDelegationService {
+			return true
+		}
+	}
+	for _, d := range subnet.Properties.Delegations {
+		if d != nil && d.Properties != nil && d.Properties.ServiceName != nil &&
+			*d.Properties.ServiceName == subnetDelegationService {
+			return true
+		}
+	}
+	return false
+}
+
+func (pn *ProviderNetwork) AmendVnetResources(ctx context.Context, cg azaciv2.ContainerGroup, pod *v1.Pod, clusterDomain string) error {
 	if pn.SubnetName == "" {
-		return
+		if pod.Annotations[SubnetAnnotation] != "" {
+			return fmt.Errorf("pod %s/%s requests subnet '%s' but the virtual node is not configured with a virtual network", pod.Namespace, pod.Name, pod.Annotations[SubnetAnnotation])
+		}
+		return nil
 	}
 
-	subnetID := "/subscriptions/" + pn.VnetSubscriptionID + "/resourceGroups/" + pn.VnetResourceGroup + "/providers/Microsoft.Network/virtualNetworks/" + pn.VnetName + "/subnets/" + pn.SubnetName
+	subnetName := pn.GetPodSubnet(pod)
+	if subnetName != pn.SubnetName {
+		if err := pn.ValidateSubnet(ctx, subnetName); err != nil {
+			return err
+		}
+	}
+
+	subnetID := "/subscriptions/" + pn.VnetSubscriptionID + "/resourceGroups/" + pn.VnetResourceGroup + "/providers/Microsoft.Network/virtualNetworks/" + pn.VnetName + "/subnets/" + subnetName
 	cgIDList := []*azaciv2.ContainerGroupSubnetID{{ID: &subnetID}}
 	cg.Properties.SubnetIDs = cgIDList
 	// windows containers don't support DNS config
-	if cg.Properties.OSType != nil &&
+	if cg.Properties.OSType == nil ||
 		*cg.Properties.OSType != azaciv2.OperatingSystemTypesWindows {
-		cg.Properties.DNSConfig = getDNSConfig(ctx, pod, pn.KubeDNSIP, clusterDomain)
+		kubeDNSIP, clusterDomain, err := getPodClusterDNS(pod, pn.KubeDNSIP, clusterDomain)
+		if err != nil {
+			return err
+		}
+		cg.Properties.DNSConfig = getDNSConfig(ctx, pod, kubeDNSIP, clusterDomain)
+	}
+	return nil
+}
+
+// getPodClusterDNS returns the cluster DNS server and cluster domain of a pod, which its annotations can override.
+func getPodClusterDNS(pod *v1.Pod, kubeDNSIP, clusterDomain string) (string, string, error) {
+	if value, ok := pod.Annotations[ClusterDNSAnnotation]; ok {
+		if net.ParseIP(value) == nil {
+			return "", "", fmt.Errorf("the value %q of annotation %s of pod %s/%s is not an IP address", value, ClusterDNSAnnotation, pod.Namespace, pod.Name)
+		}
+		kubeDNSIP = value
+	}
+	if value, ok := pod.Annotations[ClusterDomainAnnotation]; ok {
+		value = strings.TrimSuffix(value, ".")
+		if errs := utilvalidation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			return "", "", fmt.Errorf("the value %q of annotation %s of pod %s/%s is not a domain: %s", value, ClusterDomainAnnotation, pod.Namespace, pod.Name, strings.Join(errs, ", "))
+		}
+		clusterDomain = value
+	}
+	return kubeDNSIP, clusterDomain, nil
+}
+
+// usesClusterDNS returns whether a pod resolves names with the cluster DNS, ClusterFirst being the default policy.
+func usesClusterDNS(pod *v1.Pod) bool {
+	switch pod.Spec.DNSPolicy {
+	case "", v1.DNSClusterFirst, v1.DNSClusterFirstWithHostNet:
+		return true
 	}
+	return false
 }
 
 func getDNSConfig(ctx context.Context, pod *v1.Pod, kubeDNSIP, clusterDomain string) *azaciv2.DNSConfiguration {
 	servers := make([]string, 0)
 	searchDomains := make([]string, 0)
 
-	if pod.Spec.DNSPolicy == v1.DNSClusterFirst || pod.Spec.DNSPolicy == v1.DNSClusterFirstWithHostNet {
-		servers = append(servers, kubeDNSIP)
+	var dnsOptions []v1.PodDNSConfigOption
+	if usesClusterDNS(pod) {
+		if kubeDNSIP != "" {
+			servers = append(servers, kubeDNSIP)
+		} else {
+			log.G(ctx).WithField("method", "getDNSConfig").Warnf("no cluster DNS server for pod %s/%s, set KUBE_DNS_IP or the %s annotation", pod.Namespace, pod.Name, ClusterDNSAnnotation)
+		}
 		searchDomains = generateSearchesForDNSClusterFirst(pod.Spec.DNSConfig, pod, clusterDomain)
+		ndots := defaultDNSNdots
+		dnsOptions = append(dnsOptions, v1.PodDNSConfigOption{Name: "ndots", Value: &ndots})
 	}
 
-	options := make([]string, 0)
-
 	if pod.Spec.DNSConfig != nil {
 		servers = util.OmitDuplicates(append(servers, pod.Spec.DNSConfig.Nameservers...))
 		searchDomains = util.OmitDuplicates(append(searchDomains, pod.Spec.DNSConfig.Searches...))
+		dnsOptions = mergeDNSOptions(dnsOptions, pod.Spec.DNSConfig.Options)
+	}
 
-		for _, option := range pod.Spec.DNSConfig.Options {
-			op := option.Name
-			if option.Value != nil && *(option.Value) != "" {
-				op = op + ":" + *(option.Value)
-			}
-			options = append(options, op)
+	options := make([]string, 0, len(dnsOptions))
+	for _, option := range dnsOptions {
+		op := option.Name
+		if option.Value != nil && *(option.Value) != "" {
+			op = op + ":" + *(option.Value)
 		}
+		options = append(options, op)
 	}
 
 	if len(servers) == 0 {
@@ -330,6 +521,21 @@ func generateSearchesForDNSClusterFirst(dnsConfig *v1.PodDNSConfig, pod *v1.Pod,
 	return util.OmitDuplicates(append(clusterSearch, hostSearch...))
 }
 
+// mergeDNSOptions overrides the default DNS options with the options of the pod of the same name, like the kubelet.
+func mergeDNSOptions(defaults, options []v1.PodDNSConfigOption) []v1.PodDNSConfigOption {
+	merged := make([]v1.PodDNSConfigOption, 0, len(defaults)+len(options))
+	index := make(map[string]int, len(defaults)+len(options))
+	for _, option := range append(append([]v1.PodDNSConfigOption{}, defaults...), options...) {
+		if i, ok := index[option.Name]; ok {
+			merged[i] = option
+			continue
+		}
+		index[option.Name] = len(merged)
+		merged = append(merged, option)
+	}
+	return merged
+}
+
 // https://github.com/kubernetes/kubernetes/blob/4276ed36282405d026d8072e0ebed4f1da49070d/pkg/kubelet/network/dns/dns.go#L101-L149
 func formDNSNameserversFitsLimits(ctx context.Context, nameservers []string) []string {
 	if len(nameservers) > maxDNSNameservers {
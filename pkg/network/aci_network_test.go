@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
@@ -77,6 +79,57 @@ func TestGetDNSConfig(t *testing.T) {
 	}
 }
 
+func TestGetDNSConfigClusterFirst(t *testing.T) {
+	testPod := testsutil.CreatePodObj("pod", "team-a")
+	testPod.Spec.DNSPolicy = ""
+
+	dnsConfig := getDNSConfig(context.TODO(), testPod, "10.0.0.10", "cluster.local")
+	assert.NotNil(t, dnsConfig)
+	assert.Len(t, dnsConfig.NameServers, 1)
+	assert.Equal(t, "10.0.0.10", *dnsConfig.NameServers[0])
+	assert.Equal(t, "team-a.svc.cluster.local svc.cluster.local cluster.local", *dnsConfig.SearchDomains)
+	assert.Equal(t, "ndots:5", *dnsConfig.Options)
+
+	// the options of the pod override the defaults
+	ndots, timeout := "2", "3"
+	testPod.Spec.DNSConfig = &v1.PodDNSConfig{Options: []v1.PodDNSConfigOption{{Name: "timeout", Value: &timeout}, {Name: "ndots", Value: &ndots}}}
+	dnsConfig = getDNSConfig(context.TODO(), testPod, "10.0.0.10", "cluster.local")
+	assert.Equal(t, "ndots:2 timeout:3", *dnsConfig.Options)
+
+	// without cluster DNS server, the container group keeps the DNS of the virtual network
+	testPod.Spec.DNSConfig = nil
+	assert.Nil(t, getDNSConfig(context.TODO(), testPod, "", "cluster.local"))
+
+	testPod.Spec.DNSPolicy = v1.DNSNone
+	testPod.Spec.DNSConfig = &v1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}}
+	dnsConfig = getDNSConfig(context.TODO(), testPod, "10.0.0.10", "cluster.local")
+	assert.Len(t, dnsConfig.NameServers, 1)
+	assert.Equal(t, "1.1.1.1", *dnsConfig.NameServers[0])
+	assert.Equal(t, "", *dnsConfig.SearchDomains)
+}
+
+func TestGetPodClusterDNS(t *testing.T) {
+	testPod := testsutil.CreatePodObj("pod", "ns")
+	kubeDNSIP, clusterDomain, err := getPodClusterDNS(testPod, "10.0.0.10", "cluster.local")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.10", kubeDNSIP)
+	assert.Equal(t, "cluster.local", clusterDomain)
+
+	testPod.Annotations = map[string]string{ClusterDNSAnnotation: "169.254.20.10", ClusterDomainAnnotation: "corp.example."}
+	kubeDNSIP, clusterDomain, err = getPodClusterDNS(testPod, "10.0.0.10", "cluster.local")
+	assert.NoError(t, err)
+	assert.Equal(t, "169.254.20.10", kubeDNSIP)
+	assert.Equal(t, "corp.example", clusterDomain)
+
+	testPod.Annotations[ClusterDNSAnnotation] = "kube-dns"
+	_, _, err = getPodClusterDNS(testPod, "10.0.0.10", "cluster.local")
+	assert.ErrorContains(t, err, "is not an IP address")
+
+	testPod.Annotations = map[string]string{ClusterDomainAnnotation: "Corp_Example"}
+	_, _, err = getPodClusterDNS(testPod, "10.0.0.10", "cluster.local")
+	assert.ErrorContains(t, err, "is not a domain")
+}
+
 func TestFormDNSSearchFitsLimits(t *testing.T) {
 	testCases := []struct {
 		desc              string
@@ -135,3 +188,159 @@ func TestFormDNSNameserversFitsLimits(t *testing.T) {
 		assert.EqualValues(t, tc.expectedNameserver, appliedNameservers, tc.desc)
 	}
 }
+
+func TestGetPodSubnet(t *testing.T) {
+	pn := ProviderNetwork{
+		SubnetName:       "default-subnet",
+		NamespaceSubnets: map[string]string{"team-a": "team-a-subnet"},
+	}
+
+	testCases := []struct {
+		desc           string
+		namespace      string
+		annotation     string
+		expectedSubnet string
+	}{
+		{
+			desc:           "pod without annotation in namespace without default",
+			namespace:      "team-b",
+			expectedSubnet: "default-subnet",
+		},
+		{
+			desc:           "pod without annotation in namespace with default",
+			namespace:      "team-a",
+			expectedSubnet: "team-a-subnet",
+		},
+		{
+			desc:           "pod with annotation in namespace with default",
+			namespace:      "team-a",
+			annotation:     "pod-subnet",
+			expectedSubnet: "pod-subnet",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			testPod := testsutil.CreatePodObj("pod-"+uuid.New().String(), tc.namespace)
+			if tc.annotation != "" {
+				testPod.Annotations = map[string]string{SubnetAnnotation: tc.annotation}
+			}
+			assert.Equal(t, tc.expectedSubnet, pn.GetPodSubnet(testPod))
+		})
+	}
+}
+
+func TestIsSubnetDelegatedToACI(t *testing.T) {
+	aciService := subnetDelegationService
+	otherService := "Microsoft.Web/serverFarms"
+
+	testCases := []struct {
+		desc      string
+		subnet    *aznetworkv2.Subnet
+		delegated bool
+	}{
+		{
+			desc:      "subnet without properties",
+			subnet:    &aznetworkv2.Subnet{},
+			delegated: false,
+		},
+		{
+			desc: "subnet delegated to another service",
+			subnet: &aznetworkv2.Subnet{Properties: &aznetworkv2.SubnetPropertiesFormat{
+				Delegations: []*aznetworkv2.Delegation{{Properties: &aznetworkv2.ServiceDelegationPropertiesFormat{ServiceName: &otherService}}},
+			}},
+			delegated: false,
+		},
+		{
+			desc: "subnet delegated to ACI",
+			subnet: &aznetworkv2.Subnet{Properties: &aznetworkv2.SubnetPropertiesFormat{
+				Delegations: []*aznetworkv2.Delegation{{Properties: &aznetworkv2.ServiceDelegationPropertiesFormat{ServiceName: &aciService}}},
+			}},
+			delegated: true,
+		},
+		{
+			desc: "subnet linked to ACI",
+			subnet: &aznetworkv2.Subnet{Properties: &aznetworkv2.SubnetPropertiesFormat{
+				ServiceAssociationLinks: []*aznetworkv2.ServiceAssociationLink{{Properties: &aznetworkv2.ServiceAssociationLinkPropertiesFormat{LinkedResourceType: &aciService}}},
+			}},
+			delegated: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.delegated, isSubnetDelegatedToACI(tc.subnet))
+		})
+	}
+}
+
+func TestGetSubnetAddressPrefixes(t *testing.T) {
+	ipv4, ipv6, invalid := "10.1.0.0/24", "fd00:db8:deca::/64", "subnet"
+	subnet := aznetworkv2.Subnet{Properties: &aznetworkv2.SubnetPropertiesFormat{AddressPrefix: &ipv4}}
+	addressPrefix, ipv6Prefixes := getSubnetAddressPrefixes(&subnet)
+	assert.Equal(t, ipv4, addressPrefix)
+	assert.Empty(t, ipv6Prefixes)
+
+	// dual-stack subnets only have address prefixes
+	subnet.Properties = &aznetworkv2.SubnetPropertiesFormat{AddressPrefixes: []*string{&ipv6, &invalid, &ipv4}}
+	addressPrefix, ipv6Prefixes = getSubnetAddressPrefixes(&subnet)
+	assert.Equal(t, ipv4, addressPrefix)
+	assert.Equal(t, []string{ipv6}, ipv6Prefixes)
+
+	addressPrefix, ipv6Prefixes = getSubnetAddressPrefixes(&aznetworkv2.Subnet{})
+	assert.Equal(t, "", addressPrefix)
+	assert.Empty(t, ipv6Prefixes)
+}
+
+func TestAmendVnetResourcesWithoutVnet(t *testing.T) {
+	pn := ProviderNetwork{}
+	cg := azaciv2.ContainerGroup{Properties: &azaciv2.ContainerGroupPropertiesProperties{}}
+	testPod := testsutil.CreatePodObj("pod-"+uuid.New().String(), "ns-"+uuid.New().String())
+
+	err := pn.AmendVnetResources(context.TODO(), cg, testPod, "")
+	assert.NoError(t, err)
+	assert.Nil(t, cg.Properties.SubnetIDs)
+
+	testPod.Annotations = map[string]string{SubnetAnnotation: "pod-subnet"}
+	err = pn.AmendVnetResources(context.TODO(), cg, testPod, "")
+	assert.Error(t, err)
+}
+
+func TestAmendVnetResourcesWithNamespaceSubnet(t *testing.T) {
+	pn := ProviderNetwork{
+		VnetSubscriptionID: "sub",
+		VnetResourceGroup:  "rg",
+		VnetName:           "vnet",
+		SubnetName:         "default-subnet",
+		NamespaceSubnets:   map[string]string{"team-a": "team-a-subnet"},
+	}
+	pn.validatedSubnets.Store("team-a-subnet", true)
+	osType := azaciv2.OperatingSystemTypesWindows
+	cg := azaciv2.ContainerGroup{Properties: &azaciv2.ContainerGroupPropertiesProperties{OSType: &osType}}
+	testPod := testsutil.CreatePodObj("pod-"+uuid.New().String(), "team-a")
+
+	err := pn.AmendVnetResources(context.TODO(), cg, testPod, "")
+	assert.NoError(t, err)
+	assert.Len(t, cg.Properties.SubnetIDs, 1)
+	assert.Equal(t, "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/team-a-subnet", *cg.Properties.SubnetIDs[0].ID)
+}
+
+func TestAmendVnetResourcesWithClusterDNS(t *testing.T) {
+	pn := ProviderNetwork{
+		VnetSubscriptionID: "sub",
+		VnetResourceGroup:  "rg",
+		VnetName:           "vnet",
+		SubnetName:         "default-subnet",
+		KubeDNSIP:          "10.0.0.10",
+	}
+	cg := azaciv2.ContainerGroup{Properties: &azaciv2.ContainerGroupPropertiesProperties{}}
+	testPod := testsutil.CreatePodObj("pod", "team-a")
+	testPod.Annotations = map[string]string{ClusterDomainAnnotation: "corp.example"}
+
+	err := pn.AmendVnetResources(context.TODO(), cg, testPod, "cluster.local")
+	assert.NoError(t, err)
+	assert.NotNil(t, cg.Properties.DNSConfig)
+	assert.Equal(t, "10.0.0.10", *cg.Properties.DNSConfig.NameServers[0])
+	assert.Equal(t, "team-a.svc.corp.example svc.corp.example corp.example", *cg.Properties.DNSConfig.SearchDomains)
+
+	testPod.Annotations = map[string]string{ClusterDNSAnnotation: "dns"}
+	assert.Error(t, pn.AmendVnetResources(context.TODO(), cg, testPod, "cluster.local"))
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package network
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+// SyncSecurityRules makes the rules owned by the caller, whose names owns matches, in the network security group
+// associated with a subnet match the given rules, creating, updating and deleting rules as needed. The other rules of
+// the network security group are left alone.
+func (pn *ProviderNetwork) SyncSecurityRules(ctx context.Context, subnetName string, owns func(name string) bool, rules []*aznetworkv2.SecurityRule) error {
+	ctx, span := trace.StartSpan(ctx, "network.SyncSecurityRules")
+	defer span.End()
+	ctx = logging.WithComponent(ctx, logging.ComponentNetwork)
+
+	if pn.azConfig == nil {
+		return fmt.Errorf("unable to sync the security rules of subnet '%s', virtual network is not configured", subnetName)
+	}
+	subnetsClient, err := getSubnetClient(ctx, pn.azConfig)
+	if err != nil {
+		return err
+	}
+	response, err := subnetsClient.Get(ctx, pn.VnetResourceGroup, pn.VnetName, subnetName, nil)
+	if err != nil {
+		return fmt.Errorf("error while looking up subnet '%s' in vnet '%s': %v", subnetName, pn.VnetName, err)
+	}
+	subnet := response.Subnet
+	if subnet.Properties == nil || subnet.Properties.NetworkSecurityGroup == nil || subnet.Properties.NetworkSecurityGroup.ID == nil {
+		return fmt.Errorf("subnet '%s' in vnet '%s' has no network security group", subnetName, pn.VnetName)
+	}
+	nsgID, err := arm.ParseResourceID(*subnet.Properties.NetworkSecurityGroup.ID)
+	if err != nil {
+		return fmt.Errorf("invalid network security group of subnet '%s': %v", subnetName, err)
+	}
+
+	credential, options, err := getClientCredential(ctx, pn.azConfig)
+	if err != nil {
+		return err
+	}
+	rulesClient, err := aznetworkv2.NewSecurityRulesClient(nsgID.SubscriptionID, credential, options)
+	if err != nil {
+		return fmt.Errorf("an error has occurred while creating security rules client: %v", err)
+	}
+
+	existing := map[string]*aznetworkv2.SecurityRule{}
+	pager := rulesClient.NewListPager(nsgID.ResourceGroupName, nsgID.Name, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error while listing the security rules of network security group '%s': %v", nsgID.Name, err)
+		}
+		for _, rule := range page.Value {
+			if rule != nil && rule.Name != nil && owns(*rule.Name) {
+				existing[*rule.Name] = rule
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		current, ok := existing[*rule.Name]
+		delete(existing, *rule.Name)
+		if ok && securityRuleEqual(current, rule) {
+			continue
+		}
+		log.G(ctx).Infof("updating security rule %s of network security group %s", *rule.Name, nsgID.Name)
+		poller, err := rulesClient.BeginCreateOrUpdate(ctx, nsgID.ResourceGroupName, nsgID.Name, *rule.Name, *rule, nil)
+		if err != nil {
+			return fmt.Errorf("error updating security rule '%s': %v", *rule.Name, err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("error updating security rule '%s': %v", *rule.Name, err)
+		}
+	}
+	for name := range existing {
+		log.G(ctx).Infof("deleting security rule %s of network security group %s", name, nsgID.Name)
+		poller, err := rulesClient.BeginDelete(ctx, nsgID.ResourceGroupName, nsgID.Name, name, nil)
+		if err != nil {
+			return fmt.Errorf("error deleting security rule '%s': %v", name, err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("error deleting security rule '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+// securityRuleEqual returns whether two security rules match the same traffic with the same access and priority,
+// ignoring the read only properties set by Azure.
+func securityRuleEqual(a, b *aznetworkv2.SecurityRule) bool {
+	if a.Properties == nil || b.Properties == nil {
+		return a.Properties == b.Properties
+	}
+	return reflect.DeepEqual(normalizeSecurityRule(*a.Properties), normalizeSecurityRule(*b.Properties))
+}
+
+// normalizeSecurityRule clears the read only properties of a rule and the empty lists Azure returns for the
+// properties which weren't set.
+func normalizeSecurityRule(properties aznetworkv2.SecurityRulePropertiesFormat) aznetworkv2.SecurityRulePropertiesFormat {
+	properties.ProvisioningState = nil
+	if len(properties.SourceAddressPrefixes) == 0 {
+		properties.SourceAddressPrefixes = nil
+	}
+	if len(properties.SourcePortRanges) == 0 {
+		properties.SourcePortRanges = nil
+	}
+	if len(properties.SourceApplicationSecurityGroups) == 0 {
+		properties.SourceApplicationSecurityGroups = nil
+	}
+	if len(properties.DestinationAddressPrefixes) == 0 {
+		properties.DestinationAddressPrefixes = nil
+	}
+	if len(properties.DestinationPortRanges) == 0 {
+		properties.DestinationPortRanges = nil
+	}
+	if len(properties.DestinationApplicationSecurityGroups) == 0 {
+		properties.DestinationApplicationSecurityGroups = nil
+	}
+	return properties
+}
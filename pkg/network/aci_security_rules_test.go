@@ -0,0 +1,38 @@
+package network
+
+import (
+	"testing"
+
+	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityRuleEqual(t *testing.T) {
+	access := aznetworkv2.SecurityRuleAccessAllow
+	direction := aznetworkv2.SecurityRuleDirectionInbound
+	priority := int32(1000)
+	prefix := "10.0.0.4"
+	newRule := func() *aznetworkv2.SecurityRule {
+		return &aznetworkv2.SecurityRule{
+			Properties: &aznetworkv2.SecurityRulePropertiesFormat{
+				Access:                   &access,
+				Direction:                &direction,
+				Priority:                 &priority,
+				DestinationAddressPrefix: &prefix,
+			},
+		}
+	}
+
+	// the rules returned by Azure have a provisioning state and empty lists
+	succeeded := aznetworkv2.ProvisioningStateSucceeded
+	existing := newRule()
+	existing.Properties.ProvisioningState = &succeeded
+	existing.Properties.SourceAddressPrefixes = []*string{}
+	existing.Properties.DestinationPortRanges = []*string{}
+	assert.True(t, securityRuleEqual(existing, newRule()))
+
+	otherPriority := int32(1001)
+	changed := newRule()
+	changed.Properties.Priority = &otherPriority
+	assert.False(t, securityRuleEqual(existing, changed))
+}
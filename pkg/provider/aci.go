@@ -10,11 +10,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -22,6 +26,7 @@ import (
 	"github.com/virtual-kubelet/azure-aci/pkg/auth"
 	"github.com/virtual-kubelet/azure-aci/pkg/client"
 	"github.com/virtual-kubelet/azure-aci/pkg/featureflag"
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
 	"github.com/virtual-kubelet/azure-aci/pkg/metrics"
 	"github.com/virtual-kubelet/azure-aci/pkg/network"
 	"github.com/virtual-kubelet/azure-aci/pkg/util"
@@ -33,8 +38,11 @@ import (
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/cpuguy83/dockercfg"
 )
@@ -42,6 +50,10 @@ import (
 const (
 	// The service account secret mount path.
 	serviceAccountSecretMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// The environment variables the files of the service account secret volume are projected into on Windows.
+	serviceAccountTokenEnvVar     = "KUBERNETES_SERVICE_ACCOUNT_TOKEN"
+	serviceAccountCACertEnvVar    = "KUBERNETES_SERVICE_ACCOUNT_CA_CRT"
+	serviceAccountNamespaceEnvVar = "KUBERNETES_SERVICE_ACCOUNT_NAMESPACE"
 
 	virtualKubeletDNSNameLabel = "virtualkubelet.io/dnsnamelabel"
 
@@ -66,35 +78,196 @@ const (
 	containerExitCodePodDeleted int32 = 0
 )
 
+const (
+	// Kubernetes defaults of probe fields which are left unset
+	defaultProbePeriodSeconds    int32 = 10
+	defaultProbeFailureThreshold int32 = 3
+)
+
 const (
 	confidentialComputeSkuLabel       = "virtual-kubelet.io/container-sku"
 	confidentialComputeCcePolicyLabel = "virtual-kubelet.io/confidential-compute-cce-policy"
 )
 
+const (
+	// logAnalyticsOptOutAnnotation disables sending the container logs of a pod to Log Analytics when set to "true".
+	logAnalyticsOptOutAnnotation = "virtual-kubelet.io/disable-log-analytics"
+)
+
 // ACIProvider implements the virtual-kubelet provider interface and communicates with Azure's ACI APIs.
 type ACIProvider struct {
-	azClientsAPIs            client.AzClientsInterface
+	azClientsAPIs client.AzClientsInterface
+	// containerGroupExtensions are the deployment extensions of the container groups, set from extensions.
 	containerGroupExtensions []*azaciv2.DeploymentExtensionSpec
+	extensions               extensionsConfig
 	secretL                  corev1listers.SecretLister
 	configL                  corev1listers.ConfigMapLister
 	podsL                    corev1listers.PodLister
+	serviceAccountL          corev1listers.ServiceAccountLister
+	namespaceL               corev1listers.NamespaceLister
 	enabledFeatures          *featureflag.FlagIdentifier
 	providernetwork          network.ProviderNetwork
 
-	resourceGroup      string
-	region             string
-	nodeName           string
-	operatingSystem    string
-	cpu                string
-	memory             string
-	pods               string
-	gpu                string
-	gpuSKUs            []azaciv2.GpuSKU
-	internalIP         string
-	daemonEndpointPort int32
-	diagnostics        *azaciv2.ContainerGroupDiagnostics
-	clusterDomain      string
-	tracker            *PodsTracker
+	resourceGroup string
+	// namespaceResourceGroups maps a namespace to the resource group its container groups are created in.
+	namespaceResourceGroups map[string]string
+	region                  string
+	nodeName                string
+	operatingSystem         string
+	// mixedOperatingSystems selects the operating system of the container groups per pod, operatingSystem is the
+	// default one, see detectPodOperatingSystem.
+	mixedOperatingSystems bool
+	// validateImageArchitectures fails the pods whose images have no amd64 image, see checkPodArchitecture.
+	validateImageArchitectures bool
+	// containerGroupSKU is the SKU of the container groups of the pods without the SKU annotation.
+	containerGroupSKU string
+	// containerGroupMutators change the container groups before they are created, followed by
+	// containerGroupWebhook when configured.
+	containerGroupMutators []ContainerGroupMutator
+	containerGroupWebhook  *containerGroupWebhook
+	cpu                    string
+	memory                 string
+	pods                   string
+	gpu                    string
+	gpuSKUs                []azaciv2.GpuSKU
+	internalIP             string
+	// podIPPolicy and hostIPPolicy select the IP addresses reported in the pod statuses, see getContainerGroupIPs.
+	podIPPolicy  string
+	hostIPPolicy string
+	// portExposurePolicy selects the container ports exposed on the IP address of the container groups.
+	portExposurePolicy string
+	// overcommitPolicy selects whether the resources of the node are accounted by the requests or the limits of
+	// the pods, see overcommitPolicyLimits.
+	overcommitPolicy string
+	// networkPolicyPriority is the priority of the first security rule generated for the network policies.
+	networkPolicyPriority int32
+	daemonEndpointPort    int32
+	diagnostics           *azaciv2.ContainerGroupDiagnostics
+	// logAnalyticsResourceID is the resource ID of the Log Analytics workspace used when no workspace ID and key are set.
+	logAnalyticsResourceID string
+	// logArchiveContainerURL, logArchiveInterval and logArchiveRetention configure logArchiver.
+	logArchiveContainerURL string
+	logArchiveInterval     time.Duration
+	logArchiveRetention    time.Duration
+	// logArchiver copies the container logs to a blob container, when one is configured.
+	logArchiver          *blobLogArchiver
+	clusterDomain        string
+	tracker              *PodsTracker
+	podStatusWorkers     int
+	podStatusMinInterval time.Duration
+	capacityCheckers     map[string]*capacityChecker
+	// regions are the regions container groups are placed in, starting with the region of the provider.
+	regions    []string
+	nextRegion uint32
+	// nextZone rotates the availability zone tried first for the pods allowing several zones.
+	nextZone uint32
+	// failoverRegion, failoverThreshold and failoverProbeInterval configure regionFailover, which creates the
+	// container groups in the failover region while the region of the provider is unavailable.
+	failoverRegion        string
+	failoverThreshold     int
+	failoverProbeInterval time.Duration
+	regionFailover        *regionFailover
+	// podClient annotates the pods with the region and the security report of their container group.
+	podClient corev1client.PodsGetter
+	// standby is set while another replica holds the leader election lease.
+	standby uint32
+	// dynamicCapacity lowers the allocatable resources of the node to the remaining ACI quota.
+	dynamicCapacity         bool
+	capacityRefreshInterval time.Duration
+	nodeLock                sync.Mutex
+	node                    *v1.Node
+	nodeLabels              map[string]string
+	nodeAnnotations         map[string]string
+	nodeTaints              []v1.Taint
+	// drain is the drain mode set by the annotations of the node, see nodeDrainAnnotation.
+	drain nodeDrain
+	// podTagAnnotationPrefix and podTagLabels select the pod annotations and labels set as container group tags.
+	podTagAnnotationPrefix string
+	podTagLabels           []podTagLabel
+	// containerGroupProfiles are the container group profiles the pods can opt in to, by name.
+	containerGroupProfiles map[string]client.ContainerGroupProfileReference
+	// podDefaults are applied to the pods before they are admitted and translated, see applyPodDefaults.
+	podDefaults []podDefaults
+	// hostPathMappings redirect hostPath volumes to Azure Files shares, see getHostPathVolume.
+	hostPathMappings []hostPathMapping
+	// largeVolumePolicy and volumeArchiveImage select how the volumes over the size limits of ACI secret volumes
+	// are handled, see applyLargeVolumePolicy.
+	largeVolumePolicy  string
+	volumeArchiveImage string
+	// volumeSourceChangePolicy selects how the pods pick up the changes of their mounted secrets and config maps,
+	// see syncVolumeSources.
+	volumeSourceChangePolicy string
+	// dryRun validates pods without creating their container groups, unless the pod opts out.
+	dryRun bool
+	// requireTaintToleration and requiredNodeSelector select the pods admitted by the provider, see admitPod.
+	requireTaintToleration bool
+	requiredNodeSelector   map[string]string
+	// createQueue and deleteQueue limit the creations and deletions of container groups in flight.
+	createQueue *operationQueue
+	deleteQueue *operationQueue
+	// preemptLowerPriorityPods deletes the container groups of pods with a lower priority to free the ACI quota
+	// for the pods which don't fit in it, see preemptForQuota.
+	preemptLowerPriorityPods bool
+	// drainBatchSize is the number of pods evicted at once while the node is drained.
+	drainBatchSize int
+	// hostNetworkWarnOnly creates the pods requesting host networking without it instead of failing them.
+	hostNetworkWarnOnly bool
+	// defaultCPURequest and defaultMemoryRequest are the resources requested by the containers without requests.
+	defaultCPURequest    float64
+	defaultMemoryRequest float64
+	// cpuRequestGranularity and memoryRequestGranularity are the multiples the container resources are rounded
+	// down to, and maxPodCPU and maxPodMemory cap the requests of the pods, see resourcePolicy.
+	cpuRequestGranularity    float64
+	memoryRequestGranularity float64
+	maxPodCPU                float64
+	maxPodMemory             float64
+	// podResourcesPolicy is Scale to scale the resources of the pods down to the maximums of the container groups
+	// instead of failing the pods.
+	podResourcesPolicy string
+	// registryCredentialProvider runs the credential helpers of the image pull secrets, none are allowed when nil.
+	registryCredentialProvider RegistryCredentialProvider
+	// registryCredentialHelpers are the servers and namespaces each credential helper is allowed for.
+	registryCredentialHelpers []registryCredentialHelperConfig
+	// imageConfigResolver reads the entrypoints of the images of the containers with args but no command.
+	imageConfigResolver ImageConfigResolver
+	// registryTokenHosts are the token hosts the image config resolver trusts besides the registries.
+	registryTokenHosts []string
+	// defaultImagePullSecrets are added to the image pull secrets of every pod.
+	defaultImagePullSecrets []types.NamespacedName
+	// settingsLock guards the settings reloaded from the config file at runtime, see reloadConfig.
+	settingsLock sync.RWMutex
+	// eventRecorder emits events on the pods whose ACI operations failed.
+	eventRecorder record.EventRecorder
+	// containerLogs caches the logs of the containers, to serve the logs of the instances before a restart.
+	containerLogs *containerLogCache
+	// restartCounts adds up the restart counts of the containers across the restarts of their container groups.
+	restartCounts *restartCountTracker
+	// privateIPPools are the private IP addresses the pods can request with the private IP pool annotation, by
+	// pool name, and privateIPs the addresses assigned to the pods, see getPodPrivateIP.
+	privateIPPools map[string][]string
+	privateIPs     *privateIPAllocator
+	// containerGroupEvents mirrors the ACI events of the container groups as events on their pods.
+	containerGroupEvents *containerGroupEventMirror
+	// completedPodRetention is how long the container groups of the completed pods are kept, forever when zero.
+	completedPodRetention time.Duration
+	completedPodCleanup   *completedPodCleanup
+	podTTLExpiration      *podTTLExpiration
+	// containerGroupSpecs are the redacted JSON of the container groups last generated for the pods, by pod, and
+	// configMapClient writes them to the config maps of the pods asking for it.
+	containerGroupSpecs sync.Map
+	configMapClient     corev1client.ConfigMapsGetter
+	// provisioningOperations are the IDs of the ARM operations creating container groups, by pod.
+	provisioningOperations sync.Map
+	// resourceOverheads are the resources the container groups request on top of their pods, by pod, and
+	// accountResourceOverhead lowers the allocatable resources of the node by them.
+	resourceOverheads       sync.Map
+	accountResourceOverhead bool
+	// armHealth tracks the ARM authentication failures and throttling reported in the health conditions of the node.
+	armHealth *client.ARMHealth
+	// serviceHealth caches the reachability of ACI checked by Ping.
+	serviceHealth *serviceHealthCheck
+	// burstMetrics measures the creation latency of the container groups for the autoscalers, see BurstMetrics.
+	burstMetrics *burstMetricsCollector
 
 	*metrics.ACIPodMetricsProvider
 }
@@ -194,6 +367,14 @@ func NewACIProvider(ctx context.Context, config string, azConfig auth.Config, az
 	p.podsL = pCfg.Pods
 	p.clusterDomain = clusterDomain
 	p.operatingSystem = operatingSystem
+	p.imageConfigResolver = newRegistryImageConfigResolver(p.registryTokenHosts)
+	p.containerLogs = newContainerLogCache(maxCachedContainerLogBytes, maxCachedContainerLogTotalBytes)
+	p.restartCounts = newRestartCountTracker()
+	p.privateIPs = newPrivateIPAllocator()
+	p.containerGroupEvents = newContainerGroupEventMirror(time.Now())
+	p.burstMetrics = newBurstMetricsCollector()
+	p.armHealth = client.GetARMHealth()
+	p.serviceHealth = newServiceHealthCheck()
 	p.nodeName = nodeName
 	p.internalIP = internalIP
 	p.daemonEndpointPort = daemonEndpointPort
@@ -227,6 +408,36 @@ func NewACIProvider(ctx context.Context, config string, azConfig auth.Config, az
 		}
 	}
 
+	if logAnalyticsResourceID := os.Getenv("LOG_ANALYTICS_RESOURCE_ID"); logAnalyticsResourceID != "" {
+		p.logAnalyticsResourceID = logAnalyticsResourceID
+	}
+
+	// The workspace resource ID is only used when no workspace ID and key are provided
+	if p.diagnostics == nil && p.logAnalyticsResourceID != "" {
+		credential, err := getCredential(ctx, azConfig)
+		if err != nil {
+			return nil, err
+		}
+		p.diagnostics, err = analytics.NewContainerGroupDiagnosticsFromResourceID(ctx, p.logAnalyticsResourceID, credential, azConfig.Cloud)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if containerURL := os.Getenv("ACI_LOG_ARCHIVE_CONTAINER_URL"); containerURL != "" {
+		p.logArchiveContainerURL = containerURL
+	}
+	if p.logArchiveContainerURL != "" {
+		credential, err := getCredential(ctx, azConfig)
+		if err != nil {
+			return nil, err
+		}
+		p.logArchiver, err = newBlobLogArchiver(p.logArchiveContainerURL, nodeName, credential, p.logArchiveInterval, p.logArchiveRetention)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if clusterResourceID := os.Getenv("CLUSTER_RESOURCE_ID"); clusterResourceID != "" {
 		if p.diagnostics != nil && p.diagnostics.LogAnalytics != nil {
 			p.diagnostics.LogAnalytics.LogType = &util.LogTypeContainerInsights
@@ -255,25 +466,69 @@ func NewACIProvider(ctx context.Context, config string, azConfig auth.Config, az
 		return nil, errors.New(unsupportedRegionMessage)
 	}
 
+	if err := p.setupRegions(); err != nil {
+		return nil, err
+	}
+
+	if workers := os.Getenv("ACI_POD_STATUS_WORKERS"); workers != "" {
+		p.podStatusWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ACI_POD_STATUS_WORKERS: %v", err)
+		}
+	}
+
+	if err := p.setupReloadableSettings(); err != nil {
+		return nil, err
+	}
+
+	if err := p.setupImagePullSecrets(); err != nil {
+		return nil, err
+	}
+	if err := p.setupCredentialHelpers(); err != nil {
+		return nil, err
+	}
+
+	if capacityCheck := os.Getenv("ACI_CAPACITY_CHECK"); capacityCheck != "" {
+		enabled, err := strconv.ParseBool(capacityCheck)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ACI_CAPACITY_CHECK: %v", err)
+		}
+		if enabled {
+			p.capacityCheckers = make(map[string]*capacityChecker, len(p.regions)+1)
+			for _, region := range p.regions {
+				p.capacityCheckers[region] = newCapacityChecker(p.azClientsAPIs, region)
+			}
+			if p.failoverRegion != "" {
+				p.capacityCheckers[p.failoverRegion] = newCapacityChecker(p.azClientsAPIs, p.failoverRegion)
+			}
+		}
+	}
+
 	if err := p.setupNodeCapacity(ctx); err != nil {
 		return nil, err
 	}
 
+	if err := p.setupNodeMetadata(); err != nil {
+		return nil, err
+	}
+
 	if err := p.providernetwork.SetVNETConfig(ctx, &azConfig); err != nil {
 		return nil, err
 	}
 
-	if p.providernetwork.SubnetName != "" {
-		// windows containers don't support kube-proxy nor realtime metrics
-		if p.operatingSystem != string(azaciv2.OperatingSystemTypesWindows) {
-			err = p.setACIExtensions(ctx)
-			if err != nil {
-				return nil, err
-			}
+	if p.providernetwork.SubnetName != "" && (len(p.regions) > 1 || p.failoverRegion != "") {
+		return nil, fmt.Errorf("container groups can't be placed in multiple regions when using the subnet %s", p.providernetwork.SubnetName)
+	}
+
+	// windows containers don't support extensions
+	if p.operatingSystem != string(azaciv2.OperatingSystemTypesWindows) || p.mixedOperatingSystems {
+		err = p.setACIExtensions(ctx)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	p.ACIPodMetricsProvider = metrics.NewACIPodMetricsProvider(p.nodeName, p.resourceGroup, p.podsL, p.azClientsAPIs)
+	p.ACIPodMetricsProvider = metrics.NewACIPodMetricsProvider(p.nodeName, p.getResourceGroup, p.podsL, p.azClientsAPIs)
 	return &p, err
 }
 
@@ -284,33 +539,94 @@ func addAzureAttributes(ctx context.Context, span trace.Span, p *ACIProvider) co
 	})
 }
 
+// addPodAttributes tags the span and the log entries of a pod operation, including its ARM calls, with the pod.
+func addPodAttributes(ctx context.Context, span trace.Span, pod *v1.Pod) context.Context {
+	return span.WithFields(ctx, logging.PodFields(pod.Namespace, pod.Name, string(pod.UID)))
+}
+
 // CreatePod accepts a Pod definition and creates
 // an ACI deployment
-func (p *ACIProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
-	var err error
+func (p *ACIProvider) CreatePod(ctx context.Context, pod *v1.Pod) (err error) {
 	ctx, span := trace.StartSpan(ctx, "aci.CreatePod")
 	defer span.End()
 	ctx = addAzureAttributes(ctx, span, p)
+	ctx = addPodAttributes(ctx, span, pod)
+
+	if !p.isLeading() {
+		log.G(ctx).Debugf("standby replica skips creating pod %s", pod.Name)
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			p.recordPodFailure(pod, eventReasonCreateFailed, err)
+		}
+	}()
+	// the overhead of the container group is accounted against the pod as the scheduler sees it
+	scheduled := pod
+	pod = p.applyPodDefaults(pod)
+	// the registry credentials are read once, for the images of all the containers
+	creds, err := p.getImagePullSecrets(ctx, pod)
+	if err != nil {
+		return err
+	}
+	if pod, err = p.setPodOperatingSystem(ctx, pod, creds); err != nil {
+		return err
+	}
+
+	dryRun, err := p.isDryRun(pod)
+	if err != nil {
+		return err
+	}
+
+	if err := validateSecurityContext(pod); err != nil {
+		return err
+	}
+	if _, _, err := getPodTTLAfterStart(pod); err != nil {
+		return err
+	}
+	if _, err := isContainerGroupExported(pod); err != nil {
+		return err
+	}
+	if _, err := isStoppedOnDelete(pod); err != nil {
+		return err
+	}
+
+	if !p.admitPodOnCordonedNode(ctx, pod) || !p.admitPod(ctx, pod) || !p.validateNetworking(ctx, pod) {
+		return nil
+	}
+
+	publicIP, err := requestsPublicIP(pod)
+	if err != nil {
+		return err
+	}
 
 	cg := &azaciv2.ContainerGroup{
 		Properties: &azaciv2.ContainerGroupPropertiesProperties{},
 	}
 
-	os := azaciv2.OperatingSystemTypes(p.operatingSystem)
-	policy := azaciv2.ContainerGroupRestartPolicy(pod.Spec.RestartPolicy)
+	os := azaciv2.OperatingSystemTypes(p.getPodOperatingSystem(pod))
+	policy, err := getRestartPolicy(pod)
+	if err != nil {
+		return err
+	}
 
-	cg.Location = &p.region
 	cg.Properties.RestartPolicy = &policy
 	cg.Properties.OSType = &os
+	cg.Properties.Priority, err = getContainerGroupPriority(pod)
+	if err != nil {
+		return err
+	}
+	cg.Properties.SKU, err = p.getContainerGroupSKU(pod)
+	if err != nil {
+		return err
+	}
 
 	// get containers
-	containers, err := p.getContainers(pod)
+	containers, err := p.getContainers(ctx, pod, creds)
 	if err != nil {
 		return err
 	}
-	// get registry creds
-	creds, err := p.getImagePullSecrets(pod)
-	if err != nil {
+	if err := p.checkPodArchitecture(ctx, pod, creds); err != nil {
 		return err
 	}
 	// get volumes
@@ -319,15 +635,26 @@ func (p *ACIProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 		return err
 
 	}
+	if err := p.checkAzureFileMountOptions(ctx, pod); err != nil {
+		return err
+	}
 
 	if p.enabledFeatures.IsEnabled(ctx, featureflag.InitContainerFeature) {
 		// get initContainers
-		initContainers, err := p.getInitContainers(ctx, pod)
+		initContainers, err := p.getInitContainers(ctx, pod, creds)
 		if err != nil {
 			return err
 		}
 		cg.Properties.InitContainers = initContainers
 	}
+	volumes, err = applySubPathMounts(pod, volumes, containers, cg.Properties.InitContainers)
+	if err != nil {
+		return err
+	}
+	volumes, cg.Properties.InitContainers, err = p.applyLargeVolumePolicy(pod, volumes, cg.Properties.InitContainers)
+	if err != nil {
+		return err
+	}
 
 	// confidential compute proeprties
 	if p.enabledFeatures.IsEnabled(ctx, featureflag.ConfidentialComputeFeature) {
@@ -341,24 +668,20 @@ func (p *ACIProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 	cg.Properties.ImageRegistryCredentials = creds
 	cg.Properties.Diagnostics = p.getDiagnostics(pod)
 
-	filterWindowsServiceAccountSecretVolume(ctx, p.operatingSystem, cg)
+	projectWindowsServiceAccountSecretVolume(ctx, string(os), cg)
+	propagateReadOnlyVolumeMounts(pod, cg)
 
 	// create ipaddress if containerPort is used
-	count := 0
-	for _, container := range containers {
-		count = count + len(container.Properties.Ports)
-	}
-	ports := make([]*azaciv2.Port, 0, count)
-	for c := range containers {
-		containerPorts := containers[c].Properties.Ports
-		for p := range containerPorts {
-			ports = append(ports, &azaciv2.Port{
-				Port:     containerPorts[p].Port,
-				Protocol: &util.ContainerGroupNetworkProtocolTCP,
-			})
-		}
+	ports, err := getExposedPorts(pod, containers, p.portExposurePolicy == portExposurePolicyAnnotated)
+	if err != nil {
+		return err
 	}
-	if len(ports) > 0 && p.providernetwork.SubnetName == "" {
+	if publicIP {
+		cg.Properties.IPAddress, err = getPublicIPAddress(pod, ports)
+		if err != nil {
+			return err
+		}
+	} else if len(ports) > 0 && p.providernetwork.SubnetName == "" {
 		cg.Properties.IPAddress = &azaciv2.IPAddress{
 			Ports: ports,
 			Type:  &util.ContainerGroupIPAddressTypePublic,
@@ -369,67 +692,100 @@ func (p *ACIProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 		}
 	}
 
+	cg.Tags, err = p.getPodTags(pod)
+	if err != nil {
+		return err
+	}
 	podUID := string(pod.UID)
 	podCreationTimestamp := pod.CreationTimestamp.String()
-	cg.Tags = map[string]*string{
-		"PodName":           &pod.Name,
-		"NodeName":          &pod.Spec.NodeName,
-		"Namespace":         &pod.Namespace,
-		"UID":               &podUID,
-		"CreationTimestamp": &podCreationTimestamp,
+	cg.Tags["PodName"] = &pod.Name
+	cg.Tags["NodeName"] = &pod.Spec.NodeName
+	cg.Tags["Namespace"] = &pod.Namespace
+	cg.Tags["UID"] = &podUID
+	cg.Tags["CreationTimestamp"] = &podCreationTimestamp
+	if p.getVolumeSourceChangePolicy() != "" {
+		if version := p.getVolumeSourcesVersion(pod); version != "" {
+			cg.Tags[volumeSourcesTag] = &version
+		}
 	}
 
-	p.providernetwork.AmendVnetResources(ctx, *cg, pod, p.clusterDomain)
+	// container groups with a public IP address can't be in a virtual network
+	if !publicIP {
+		if err := p.providernetwork.AmendVnetResources(ctx, *cg, pod, p.clusterDomain); err != nil {
+			return err
+		}
+	}
+	if err := p.setPrivateIPAddress(pod, cg, ports, publicIP); err != nil {
+		return err
+	}
 
-	// windows containers don't support kube-proxy nor realtime metrics
+	// windows containers don't support extensions
 	if cg.Properties.OSType != nil &&
 		*cg.Properties.OSType != azaciv2.OperatingSystemTypesWindows {
 		cg.Properties.Extensions = p.containerGroupExtensions
 	}
 
-	log.G(ctx).Debugf("start creating pod %v", pod.Name)
-	// TODO: Run in a go routine to not block workers, and use tracker.UpdatePodStatus() based on result.
-	return p.azClientsAPIs.CreateContainerGroup(ctx, p.resourceGroup, pod.Namespace, pod.Name, cg)
-}
-
-// setACIExtensions
-func (p *ACIProvider) setACIExtensions(ctx context.Context) error {
-	masterURI := os.Getenv("MASTER_URI")
-	if masterURI == "" {
-		masterURI = "10.0.0.1"
+	if err := p.mutateContainerGroup(ctx, pod, cg); err != nil {
+		return err
 	}
-	clusterCIDR := os.Getenv("CLUSTER_CIDR")
-	if clusterCIDR == "" {
-		clusterCIDR = "10.240.0.0/16"
+	p.setResourceOverhead(scheduled, cg)
+	p.setRestartCountsTag(pod, cg)
+	setPodSpecHashTag(pod, cg)
+
+	if !dryRun {
+		started, err := p.startStoppedContainerGroup(ctx, pod, cg)
+		if err != nil {
+			return err
+		}
+		if started {
+			p.recordContainerGroup(ctx, pod, cg)
+			return nil
+		}
 	}
 
-	kubeExtensions, err := client.GetKubeProxyExtension(serviceAccountSecretMountPath, masterURI, clusterCIDR)
+	log.G(ctx).Debugf("start creating pod %v", pod.Name)
+	// TODO: Run in a go routine to not block workers, and use tracker.UpdatePodStatus() based on result.
+	err = p.createContainerGroupInRegions(ctx, pod, cg, dryRun)
+	p.recordContainerGroup(ctx, pod, cg)
 	if err != nil {
-		return fmt.Errorf("error creating kube proxy extension: %v", err)
+		return err
 	}
-
-	p.containerGroupExtensions = append(p.containerGroupExtensions, kubeExtensions)
-
-	enableRealTimeMetricsExtension := os.Getenv("ENABLE_REAL_TIME_METRICS")
-	if enableRealTimeMetricsExtension == "true" {
-		realtimeExtension := client.GetRealtimeMetricsExtension()
-		p.containerGroupExtensions = append(p.containerGroupExtensions, realtimeExtension)
+	if dryRun {
+		p.completeDryRun(ctx, pod)
 	}
 	return nil
 }
 
 func (p *ACIProvider) getDiagnostics(pod *v1.Pod) *azaciv2.ContainerGroupDiagnostics {
+	if strings.EqualFold(pod.Annotations[logAnalyticsOptOutAnnotation], "true") {
+		return nil
+	}
 	if p.diagnostics != nil && p.diagnostics.LogAnalytics != nil &&
 		p.diagnostics.LogAnalytics.LogType != nil &&
 		*p.diagnostics.LogAnalytics.LogType == azaciv2.LogAnalyticsLogTypeContainerInsights {
-		d := *p.diagnostics
+		// copy the log analytics settings as the metadata is specific to each pod
+		la := *p.diagnostics.LogAnalytics
+		la.Metadata = make(map[string]*string, len(p.diagnostics.LogAnalytics.Metadata)+1)
+		for k, v := range p.diagnostics.LogAnalytics.Metadata {
+			la.Metadata[k] = v
+		}
 		uID := string(pod.ObjectMeta.UID)
-		d.LogAnalytics.Metadata[analytics.LogAnalyticsMetadataKeyPodUUID] = &uID
-		return &d
+		la.Metadata[analytics.LogAnalyticsMetadataKeyPodUUID] = &uID
+		return &azaciv2.ContainerGroupDiagnostics{LogAnalytics: &la}
 	}
 	return p.diagnostics
 }
 
+// getCredential returns the credential of the virtual node, its workload identity or service principal when one is
+// configured or else its managed identity.
+func getCredential(ctx context.Context, azConfig auth.Config) (azcore.TokenCredential, error) {
+	credential, err := azConfig.GetCredential(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error has occurred while creating getting credential ")
+	}
+	return credential, nil
+}
+
 func containerGroupName(podNS, podName string) string {
 	return fmt.Sprintf("%s-%s", podNS, podName)
 }
@@ -444,10 +800,72 @@ func (p *ACIProvider) DeletePod(ctx context.Context, pod *v1.Pod) error {
 	ctx, span := trace.StartSpan(ctx, "aci.DeletePod")
 	defer span.End()
 	ctx = addAzureAttributes(ctx, span, p)
+	ctx = addPodAttributes(ctx, span, pod)
+
+	if !p.isLeading() {
+		log.G(ctx).Debugf("standby replica skips deleting pod %s", pod.Name)
+		return nil
+	}
 
 	log.G(ctx).Debugf("start deleting pod %v", pod.Name)
 	// TODO: Run in a go routine to not block workers.
-	return p.deleteContainerGroup(ctx, pod.Namespace, pod.Name)
+	release, err := p.deleteQueue.acquire(ctx, pod.Namespace, getPodPriority(pod))
+	if err != nil {
+		return err
+	}
+	if stopped, _ := isStoppedOnDelete(pod); stopped {
+		err = p.stopContainerGroup(ctx, pod)
+	} else if err = p.deletePodContainerGroup(ctx, pod, false); err == nil {
+		p.terminatePodContainers(ctx, pod.Namespace, pod.Name)
+	}
+	release()
+	if err != nil {
+		p.recordPodFailure(pod, eventReasonDeleteFailed, err)
+		return err
+	}
+
+	p.forgetPod(pod.Namespace, pod.Name)
+	return nil
+}
+
+// deletePodContainerGroup deletes the container group of a pod, the caller holds the delete queue. The private IP
+// address of the pod is only released once its container group is gone, so the deletion is waited for when the pod
+// has one, or when wait is set.
+func (p *ACIProvider) deletePodContainerGroup(ctx context.Context, pod *v1.Pod, wait bool) error {
+	ctx, span := trace.StartSpan(ctx, "aci.deletePodContainerGroup")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	resourceGroup := p.getResourceGroup(pod.Namespace)
+	cgName := containerGroupName(pod.Namespace, pod.Name)
+	podKey := pod.Namespace + "/" + pod.Name
+
+	if !wait && !hasPrivateIP(pod) && !p.privateIPs.isAssigned(podKey) {
+		if err := p.azClientsAPIs.DeleteContainerGroup(ctx, resourceGroup, cgName); err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to delete container group %v", cgName)
+			return err
+		}
+		return nil
+	}
+
+	if err := p.azClientsAPIs.DeleteContainerGroupAndWait(ctx, resourceGroup, cgName); err != nil && !errdefs.IsNotFound(err) {
+		log.G(ctx).WithError(err).Errorf("failed to delete container group %v", cgName)
+		return err
+	}
+	p.privateIPs.release(podKey)
+	return nil
+}
+
+// forgetPod drops the state kept for a pod whose container group is gone.
+func (p *ACIProvider) forgetPod(namespace, name string) {
+	p.provisioningOperations.Delete(namespace + "/" + name)
+	p.resourceOverheads.Delete(namespace + "/" + name)
+	p.restartCounts.deletePod(namespace + "/" + name)
+	p.privateIPs.release(namespace + "/" + name)
+	p.burstMetrics.forgetCreation(namespace, name)
+	p.containerLogs.deletePod(namespace, name)
+	p.containerGroupEvents.deletePod(namespace, name)
+	p.containerGroupSpecs.Delete(namespace + "/" + name)
 }
 
 func (p *ACIProvider) deleteContainerGroup(ctx context.Context, podNS, podName string) error {
@@ -457,12 +875,19 @@ func (p *ACIProvider) deleteContainerGroup(ctx context.Context, podNS, podName s
 
 	cgName := containerGroupName(podNS, podName)
 
-	err := p.azClientsAPIs.DeleteContainerGroup(ctx, p.resourceGroup, cgName)
+	err := p.azClientsAPIs.DeleteContainerGroup(ctx, p.getResourceGroup(podNS), cgName)
 	if err != nil {
 		log.G(ctx).WithError(err).Errorf("failed to delete container group %v", cgName)
 		return err
 	}
 
+	p.terminatePodContainers(ctx, podNS, podName)
+	return nil
+}
+
+// terminatePodContainers sets the running containers of a pod whose container group is deleted or stopped as
+// terminated.
+func (p *ACIProvider) terminatePodContainers(ctx context.Context, podNS, podName string) {
 	if p.tracker != nil {
 		// Delete is not a sync API on ACI yet, but will assume with current implementation that termination is completed. Also, till gracePeriod is supported.
 		updateErr := p.tracker.UpdatePodStatus(ctx,
@@ -490,11 +915,9 @@ func (p *ACIProvider) deleteContainerGroup(ctx context.Context, podNS, podName s
 		)
 
 		if updateErr != nil && !errdefs.IsNotFound(updateErr) {
-			log.G(ctx).WithError(updateErr).Errorf("failed to update termination status for cg %v", cgName)
+			log.G(ctx).WithError(updateErr).Errorf("failed to update termination status for cg %v", containerGroupName(podNS, podName))
 		}
 	}
-
-	return nil
 }
 
 // GetPod returns a pod by name that is running inside ACI
@@ -504,10 +927,13 @@ func (p *ACIProvider) GetPod(ctx context.Context, namespace, name string) (*v1.P
 	defer span.End()
 	ctx = addAzureAttributes(ctx, span, p)
 
-	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.resourceGroup, namespace, name, p.nodeName)
+	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(namespace), namespace, name, p.nodeName)
 	if err != nil {
 		return nil, err
 	}
+	if isContainerGroupStopped(cg) {
+		return nil, errdefs.NotFoundf("the container group of pod %s/%s is stopped", namespace, name)
+	}
 
 	err = validation.ValidateContainerGroup(ctx, cg)
 	if err != nil {
@@ -523,21 +949,33 @@ func (p *ACIProvider) GetContainerLogs(ctx context.Context, namespace, podName,
 	defer span.End()
 	ctx = addAzureAttributes(ctx, span, p)
 
-	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.resourceGroup, namespace, podName, p.nodeName)
+	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(namespace), namespace, podName, p.nodeName)
 	if err != nil {
 		return nil, err
 	}
 
-	// get logs from cg
-	logContent, err := p.azClientsAPIs.ListLogs(ctx, p.resourceGroup, *cg.Name, containerName, opts)
+	key := containerLogKey{namespace: namespace, pod: podName, container: containerName}
+	restartCount := getContainerRestartCount(cg, containerName)
+	if opts.Previous {
+		// ACI only returns the logs of the current instance of a container
+		logs, ok := p.containerLogs.getPrevious(key, restartCount)
+		if !ok {
+			return nil, errdefs.NotFoundf("previous terminated container %q in pod %q not found", containerName, podName)
+		}
+		return io.NopCloser(strings.NewReader(client.ApplyLogOptions(logs, opts, time.Now()))), nil
+	}
+
+	// the complete logs of the instance are read with their timestamps, so that they are cached for the next
+	// requests whatever their options, which are applied afterwards
+	logContent, err := p.azClientsAPIs.ListLogs(ctx, p.getResourceGroup(namespace), *cg.Name, containerName, api.ContainerLogOpts{Timestamps: true})
 	if err != nil {
 		return nil, err
 	}
-	if logContent != nil {
-		logStr := *logContent
-		return io.NopCloser(strings.NewReader(logStr)), nil
+	if logContent == nil {
+		return nil, nil
 	}
-	return nil, nil
+	p.containerLogs.record(key, restartCount, *logContent, false)
+	return io.NopCloser(strings.NewReader(client.ApplyLogOptions(*logContent, opts, time.Now()))), nil
 }
 
 // GetPodFullName as defined in the provider context
@@ -558,14 +996,12 @@ func (p *ACIProvider) RunInContainer(ctx context.Context, namespace, name, conta
 		defer out.Close()
 	}
 
-	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.resourceGroup, namespace, name, p.nodeName)
+	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(namespace), namespace, name, p.nodeName)
 	if err != nil {
 		return err
 	}
 
-	// Set default terminal size
-	cols := int32(60)
-	rows := int32(120)
+	cols, rows := getExecTerminalSize(ctx, attach)
 	cmdParam := strings.Join(cmd, " ")
 	req := azaciv2.ContainerExecRequest{
 		Command: &cmdParam,
@@ -575,7 +1011,7 @@ func (p *ACIProvider) RunInContainer(ctx context.Context, namespace, name, conta
 		},
 	}
 
-	xcrsp, err := p.azClientsAPIs.ExecuteContainerCommand(ctx, p.resourceGroup, *cg.Name, container, req)
+	xcrsp, err := p.azClientsAPIs.ExecuteContainerCommand(ctx, p.getResourceGroup(namespace), *cg.Name, container, req)
 	if err != nil {
 		return err
 	}
@@ -656,17 +1092,38 @@ func (p *ACIProvider) GetPodStatus(ctx context.Context, namespace, name string)
 	defer span.End()
 	ctx = addAzureAttributes(ctx, span, p)
 
-	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.resourceGroup, namespace, name, p.nodeName)
+	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(namespace), namespace, name, p.nodeName)
 	if err != nil {
 		return nil, err
 	}
+	if isContainerGroupStopped(cg) {
+		return nil, errdefs.NotFoundf("the container group of pod %s/%s is stopped", namespace, name)
+	}
 
 	err = validation.ValidateContainerGroup(ctx, cg)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		var status *v1.PodStatus
+		status, err = p.getPodStatusFromContainerGroup(ctx, cg)
+		if err == nil {
+			p.snapshotTerminatedContainerLogs(ctx, namespace, name, cg)
+			p.mirrorContainerGroupEvents(namespace, name, cg)
+			p.setResourceOverheadCondition(status, namespace, name, cg)
+			if state := getProvisioningState(cg); state != "" && state != provisioningStateSucceeded {
+				setPodCondition(status, p.getProvisioningCondition(namespace, name, state))
+			} else if state == provisioningStateSucceeded {
+				p.burstMetrics.completeCreation(namespace, name, time.Now())
+			}
+			return status, nil
+		}
 	}
 
-	return p.getPodStatusFromContainerGroup(ctx, cg)
+	// the instance view of a container group is incomplete until ACI provisioned it, but its events already tell
+	// how the image pulls are going
+	if state := getProvisioningState(cg); isProvisioning(state) {
+		p.mirrorContainerGroupEvents(namespace, name, cg)
+		return p.getProvisioningPodStatus(namespace, name, state), nil
+	}
+	return nil, err
 }
 
 // GetPods returns a list of all pods known to be running within ACI.
@@ -676,12 +1133,25 @@ func (p *ACIProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 
 	ctx = addAzureAttributes(ctx, span, p)
 
-	cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, p.resourceGroup)
+	pods := make([]*v1.Pod, 0)
+	for _, resourceGroup := range p.getResourceGroups() {
+		resourceGroupPods, err := p.getResourceGroupPods(ctx, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, resourceGroupPods...)
+	}
+	return pods, nil
+}
+
+// getResourceGroupPods returns the pods of the container groups of the node in a resource group.
+func (p *ACIProvider) getResourceGroupPods(ctx context.Context, resourceGroup string) ([]*v1.Pod, error) {
+	cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, resourceGroup)
 	if err != nil {
 		return nil, err
 	}
 	if cgs == nil {
-		log.G(ctx).Infof("no container groups found for resource group %s", p.resourceGroup)
+		log.G(ctx).Infof("no container groups found for resource group %s", resourceGroup)
 		return nil, nil
 	}
 	pods := make([]*v1.Pod, 0, len(cgs))
@@ -693,7 +1163,7 @@ func (p *ACIProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 		}
 		// The GetContainerGroupListResult API doesn't return InstanceView status which can cause nil.
 		// For that, we had to get the CG info one more time.
-		cg, err := p.azClientsAPIs.GetContainerGroup(ctx, p.resourceGroup, *cgName)
+		cg, err := p.azClientsAPIs.GetContainerGroup(ctx, resourceGroup, *cgName)
 		// CG might get deleted between the getlist and get calls
 		if errdefs.IsNotFound(err) || cg == nil {
 			continue
@@ -715,6 +1185,11 @@ func (p *ACIProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 			continue
 		}
 
+		// the container groups stopped on the deletion of their pods wait for the next pod
+		if isContainerGroupStopped(cg) {
+			continue
+		}
+
 		if cg.Tags != nil && cg.Tags["NodeName"] != nil {
 			if *cg.Tags["NodeName"] != p.nodeName {
 				log.G(ctx).WithFields(log.Fields{
@@ -752,15 +1227,24 @@ func (p *ACIProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 // the pod status changes.
 // The provided pointer to a Pod is guaranteed to be used in a read-only
 // fashion.
+// The statuses are pushed by the tracker as soon as it observes a change,
+// either polling ACI or on the container group events, so the node
+// controller doesn't poll GetPodStatus nor update unchanged statuses.
 func (p *ACIProvider) NotifyPods(ctx context.Context, notifierCb func(*v1.Pod)) {
 	ctx, span := trace.StartSpan(ctx, "ACIProvider.NotifyPods")
 	defer span.End()
 
+	p.settingsLock.RLock()
+	minPodUpdateInterval := p.podStatusMinInterval
+	p.settingsLock.RUnlock()
+
 	// Capture the notifier to be used for communicating updates to VK
 	p.tracker = &PodsTracker{
-		pods:     p.podsL,
-		updateCb: notifierCb,
-		handler:  p,
+		pods:                 p.podsL,
+		updateCb:             notifierCb,
+		handler:              p,
+		workers:              p.podStatusWorkers,
+		minPodUpdateInterval: minPodUpdateInterval,
 	}
 
 	go p.tracker.StartTracking(ctx)
@@ -785,6 +1269,8 @@ func (p *ACIProvider) ListActivePods(ctx context.Context) ([]PodIdentifier, erro
 				name:      pod.Name,
 			})
 	}
+	// the logs of the pods whose container group is gone can't be read anymore
+	p.containerLogs.retainPods(podsIdentifiers)
 
 	return podsIdentifiers, nil
 }
@@ -802,34 +1288,16 @@ func (p *ACIProvider) CleanupPod(ctx context.Context, ns, name string) error {
 	ctx, span := trace.StartSpan(ctx, "ACIProvider.CleanupPod")
 	defer span.End()
 
-	return p.deleteContainerGroup(ctx, ns, name)
-}
-
-func (p *ACIProvider) getImagePullSecrets(pod *v1.Pod) ([]*azaciv2.ImageRegistryCredential, error) {
-	ips := make([]*azaciv2.ImageRegistryCredential, 0, len(pod.Spec.ImagePullSecrets))
-	for _, ref := range pod.Spec.ImagePullSecrets {
-		secret, err := p.secretL.Secrets(pod.Namespace).Get(ref.Name)
-		if err != nil {
-			return ips, err
-		}
-		if secret == nil {
-			return nil, fmt.Errorf("error getting image pull secret")
-		}
-		switch secret.Type {
-		case v1.SecretTypeDockercfg:
-			ips, err = readDockerCfgSecret(secret, ips)
-		case v1.SecretTypeDockerConfigJson:
-			ips, err = readDockerConfigJSONSecret(secret, ips)
-		default:
-			return nil, fmt.Errorf("image pull secret type is not one of kubernetes.io/dockercfg or kubernetes.io/dockerconfigjson")
-		}
-
-		if err != nil {
-			return ips, err
-		}
+	if !p.isLeading() {
+		return nil
+	}
 
+	release, err := p.deleteQueue.acquire(ctx, ns, 0)
+	if err != nil {
+		return err
 	}
-	return ips, nil
+	defer release()
+	return p.deleteContainerGroup(ctx, ns, name)
 }
 
 func makeRegistryCredential(server string, authConfig AuthConfig) (*azaciv2.ImageRegistryCredential, error) {
@@ -914,7 +1382,7 @@ func readDockerCfgSecret(secret *v1.Secret, ips []*azaciv2.ImageRegistryCredenti
 	return ips, err
 }
 
-func readDockerConfigJSONSecret(secret *v1.Secret, ips []*azaciv2.ImageRegistryCredential) ([]*azaciv2.ImageRegistryCredential, error) {
+func (p *ACIProvider) readDockerConfigJSONSecret(ctx context.Context, secret *v1.Secret, ips []*azaciv2.ImageRegistryCredential) ([]*azaciv2.ImageRegistryCredential, error) {
 	var err error
 	repoData, ok := secret.Data[v1.DockerConfigJsonKey]
 
@@ -931,11 +1399,15 @@ func readDockerConfigJSONSecret(secret *v1.Secret, ips []*azaciv2.ImageRegistryC
 	}
 
 	auths := cfgJson.AuthConfigs
-	if len(auths) == 0 {
+	helpers := getCredentialHelpers(&cfgJson)
+	if len(auths) == 0 && len(helpers) == 0 {
 		return ips, fmt.Errorf("malformed dockerconfigjson in secret")
 	}
 
 	for server := range auths {
+		if _, ok := helpers[server]; ok {
+			continue
+		}
 		cred, err := makeRegistryCredentialFromDockerConfig(server, auths[server])
 		if err != nil {
 			return ips, err
@@ -944,15 +1416,16 @@ func readDockerConfigJSONSecret(secret *v1.Secret, ips []*azaciv2.ImageRegistryC
 		ips = append(ips, cred)
 	}
 
-	return ips, err
-}
+	for server, helper := range helpers {
+		cred, err := p.makeRegistryCredentialFromHelper(ctx, secret.Namespace, server, helper)
+		if err != nil {
+			return ips, err
+		}
 
-// verify if Container is properly declared for the use on ACI
-func (p *ACIProvider) verifyContainer(container *v1.Container) error {
-	if len(container.Command) == 0 && len(container.Args) > 0 {
-		return errdefs.InvalidInput("ACI does not support providing args without specifying the command. Please supply both command and args to the pod spec.")
+		ips = append(ips, cred)
 	}
-	return nil
+
+	return ips, err
 }
 
 // this method is used for both initConainers and containers
@@ -983,23 +1456,30 @@ func (p *ACIProvider) getVolumeMounts(container v1.Container) []*azaciv2.VolumeM
 	return volumeMounts
 }
 
-// get EnvironmentVariables declared on Container as []aci.EnvironmentVariable
-func (p *ACIProvider) getEnvironmentVariables(container v1.Container) []*azaciv2.EnvironmentVariable {
-	environmentVariable := make([]*azaciv2.EnvironmentVariable, 0, len(container.Env))
-	for i := range container.Env {
-		if container.Env[i].Value != "" {
-			envVar := getACIEnvVar(container.Env[i])
-			environmentVariable = append(environmentVariable, envVar)
-		}
+// getRestartPolicy maps the restart policy of a pod to the restart policy of its container group.
+// Kubernetes defaults an unset restart policy to Always.
+func getRestartPolicy(pod *v1.Pod) (azaciv2.ContainerGroupRestartPolicy, error) {
+	switch pod.Spec.RestartPolicy {
+	case v1.RestartPolicyAlways, "":
+		return azaciv2.ContainerGroupRestartPolicyAlways, nil
+	case v1.RestartPolicyOnFailure:
+		return azaciv2.ContainerGroupRestartPolicyOnFailure, nil
+	case v1.RestartPolicyNever:
+		return azaciv2.ContainerGroupRestartPolicyNever, nil
+	default:
+		return "", errdefs.InvalidInputf("pod %s: unsupported restart policy %q, must be one of %s, %s or %s", pod.Name,
+			pod.Spec.RestartPolicy, v1.RestartPolicyAlways, v1.RestartPolicyOnFailure, v1.RestartPolicyNever)
 	}
-	return environmentVariable
 }
 
 // get InitContainers defined in Pod as []aci.InitContainerDefinition
-func (p *ACIProvider) getInitContainers(ctx context.Context, pod *v1.Pod) ([]*azaciv2.InitContainerDefinition, error) {
+func (p *ACIProvider) getInitContainers(ctx context.Context, pod *v1.Pod, creds []*azaciv2.ImageRegistryCredential) ([]*azaciv2.InitContainerDefinition, error) {
 	initContainers := make([]*azaciv2.InitContainerDefinition, 0, len(pod.Spec.InitContainers))
 	for i, initContainer := range pod.Spec.InitContainers {
-		err := p.verifyContainer(&initContainer)
+		if err := validateContainerIO(ctx, &initContainer); err != nil {
+			return nil, err
+		}
+		resolved, err := p.resolveCommand(ctx, pod, initContainer, creds)
 		if err != nil {
 			log.G(ctx).Errorf("couldn't verify container %v", err)
 			return nil, err
@@ -1026,13 +1506,22 @@ func (p *ACIProvider) getInitContainers(ctx context.Context, pod *v1.Pod) ([]*az
 			return nil, errdefs.InvalidInput("azure container instances initContainers do not support readinessProbe")
 		}
 
+		envVars, envValues, err := p.getEnvironmentVariables(ctx, pod, &pod.Spec.InitContainers[i])
+		if err != nil {
+			return nil, err
+		}
+		command, err := p.getLifecycleCommand(ctx, pod, expandCommand(resolved, envValues))
+		if err != nil {
+			return nil, err
+		}
+
 		newInitContainer := azaciv2.InitContainerDefinition{
 			Name: &pod.Spec.InitContainers[i].Name,
 			Properties: &azaciv2.InitContainerPropertiesDefinition{
 				Image:                &pod.Spec.InitContainers[i].Image,
-				Command:              p.getCommand(pod.Spec.InitContainers[i]),
+				Command:              command,
 				VolumeMounts:         p.getVolumeMounts(pod.Spec.InitContainers[i]),
-				EnvironmentVariables: p.getEnvironmentVariables(pod.Spec.InitContainers[i]),
+				EnvironmentVariables: envVars,
 			},
 		}
 
@@ -1041,16 +1530,32 @@ func (p *ACIProvider) getInitContainers(ctx context.Context, pod *v1.Pod) ([]*az
 	return initContainers, nil
 }
 
-func (p *ACIProvider) getContainers(pod *v1.Pod) ([]*azaciv2.Container, error) {
+func (p *ACIProvider) getContainers(ctx context.Context, pod *v1.Pod, creds []*azaciv2.ImageRegistryCredential) ([]*azaciv2.Container, error) {
 	containers := make([]*azaciv2.Container, 0, len(pod.Spec.Containers))
+	policy, err := p.getPodResourcePolicy(pod.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var adjustments []string
 
 	podContainers := pod.Spec.Containers
 	for c := range podContainers {
 
-		if len(podContainers[c].Command) == 0 && len(podContainers[c].Args) > 0 {
-			return nil, errdefs.InvalidInput("ACI does not support providing args without specifying the command. Please supply both command and args to the pod spec.")
+		if err := validateContainerIO(ctx, &podContainers[c]); err != nil {
+			return nil, err
+		}
+		resolved, err := p.resolveCommand(ctx, pod, podContainers[c], creds)
+		if err != nil {
+			return nil, err
+		}
+		envVars, envValues, err := p.getEnvironmentVariables(ctx, pod, &podContainers[c])
+		if err != nil {
+			return nil, err
+		}
+		cmd, err := p.getLifecycleCommand(ctx, pod, expandCommand(resolved, envValues))
+		if err != nil {
+			return nil, err
 		}
-		cmd := p.getCommand(podContainers[c])
 		ports := make([]*azaciv2.ContainerPort, 0, len(podContainers[c].Ports))
 		aciContainer := azaciv2.Container{
 			Name: &podContainers[c].Name,
@@ -1078,97 +1583,51 @@ func (p *ACIProvider) getContainers(pod *v1.Pod) ([]*azaciv2.Container, error) {
 			})
 		}
 
-		initEnv := make([]*azaciv2.EnvironmentVariable, 0, len(podContainers[c].Env))
-		aciContainer.Properties.EnvironmentVariables = initEnv
-		for _, e := range podContainers[c].Env {
-			if e.Value != "" {
-				envVar := getACIEnvVar(e)
-				envList := append(aciContainer.Properties.EnvironmentVariables, envVar)
-				aciContainer.Properties.EnvironmentVariables = envList
-			}
-		}
-
-		// NOTE(robbiezhang): ACI CPU request must be times of 10m
-		cpuRequest := 1.00
-		if _, ok := podContainers[c].Resources.Requests[v1.ResourceCPU]; ok {
-			cpuRequest = float64(podContainers[c].Resources.Requests.Cpu().MilliValue()/10.00) / 100.00
-			if cpuRequest < 0.01 {
-				cpuRequest = 0.01
-			}
-		}
+		aciContainer.Properties.EnvironmentVariables = envVars
 
-		// NOTE(robbiezhang): ACI memory request must be times of 0.1 GB
-		memoryRequest := 1.50
-		if _, ok := podContainers[c].Resources.Requests[v1.ResourceMemory]; ok {
-			memoryRequest = float64(podContainers[c].Resources.Requests.Memory().Value()/100000000.00) / 10.00
-			if memoryRequest < 0.10 {
-				memoryRequest = 0.10
-			}
-		}
+		// NOTE(robbiezhang): ACI CPU request must be times of 10m and memory request times of 0.1 GB
+		resources, adjusted := policy.getContainerResources(&podContainers[c])
+		aciContainer.Properties.Resources = resources
+		adjustments = append(adjustments, adjusted...)
 
-		aciContainer.Properties.Resources = &azaciv2.ResourceRequirements{
-			Requests: &azaciv2.ResourceRequests{
-				CPU:        &cpuRequest,
-				MemoryInGB: &memoryRequest,
-			},
+		gpuResource, err := p.getGPUResource(pod, podContainers[c])
+		if err != nil {
+			return nil, err
 		}
-
-		if podContainers[c].Resources.Limits != nil {
-			cpuLimit := cpuRequest
-			if _, ok := podContainers[c].Resources.Limits[v1.ResourceCPU]; ok {
-				cpuLimit = float64(podContainers[c].Resources.Limits.Cpu().MilliValue()) / 1000.00
-			}
-
-			// NOTE(jahstreet): ACI memory limit must be times of 0.1 GB
-			memoryLimit := memoryRequest
-			if _, ok := podContainers[c].Resources.Limits[v1.ResourceMemory]; ok {
-				memoryLimit = float64(podContainers[c].Resources.Limits.Memory().Value()/100000000.00) / 10.00
-			}
-			aciContainer.Properties.Resources.Limits = &azaciv2.ResourceLimits{
-				CPU:        &cpuLimit,
-				MemoryInGB: &memoryLimit,
-			}
-
-			if gpu, ok := podContainers[c].Resources.Limits[gpuResourceName]; ok {
-				sku, err := p.getGPUSKU(pod)
-				if err != nil {
-					return nil, err
-				}
-
-				if gpu.Value() == 0 {
-					return nil, errors.New("GPU must be a integer number")
-				}
-
-				count := int32(gpu.Value())
-
-				gpuResource := &azaciv2.GpuResource{
-					Count: &count,
-					SKU:   &sku,
-				}
-
-				aciContainer.Properties.Resources.Requests.Gpu = gpuResource
+		if gpuResource != nil {
+			aciContainer.Properties.Resources.Requests.Gpu = gpuResource
+			if aciContainer.Properties.Resources.Limits != nil {
 				aciContainer.Properties.Resources.Limits.Gpu = gpuResource
 			}
 		}
 
 		if podContainers[c].LivenessProbe != nil {
-			probe, err := getProbe(podContainers[c].LivenessProbe, podContainers[c].Ports)
+			probe, err := getProbe(podContainers[c].LivenessProbe, getProbePorts(podContainers, c))
 			if err != nil {
-				return nil, err
+				return nil, &probeError{container: podContainers[c].Name, probe: "liveness", err: err}
+			}
+			if podContainers[c].StartupProbe != nil {
+				delayForStartupProbe(probe, podContainers[c].StartupProbe)
 			}
 			aciContainer.Properties.LivenessProbe = probe
 		}
 
 		if podContainers[c].ReadinessProbe != nil {
-			probe, err := getProbe(podContainers[c].ReadinessProbe, podContainers[c].Ports)
+			probe, err := getProbe(podContainers[c].ReadinessProbe, getProbePorts(podContainers, c))
 			if err != nil {
-				return nil, err
+				return nil, &probeError{container: podContainers[c].Name, probe: "readiness", err: err}
 			}
 			aciContainer.Properties.ReadinessProbe = probe
 		}
 
 		containers = append(containers, &aciContainer)
 	}
+
+	scaled, err := policy.fitPodResources(pod, containers)
+	if err != nil {
+		return nil, err
+	}
+	p.reportResourceAdjustments(ctx, pod, append(adjustments, scaled...))
 	return containers, nil
 }
 
@@ -1195,19 +1654,59 @@ func (p *ACIProvider) setConfidentialComputeProperties(ctx context.Context, pod
 	l.Infof("no annotations for confidential SKU")
 }
 
-func (p *ACIProvider) getGPUSKU(pod *v1.Pod) (azaciv2.GpuSKU, error) {
+// getGPUResource returns the GPU resource of a container, requested as nvidia.com/gpu in either the requests
+// or the limits of the container. Kubernetes requires both to be equal when both are set.
+func (p *ACIProvider) getGPUResource(pod *v1.Pod, container v1.Container) (*azaciv2.GpuResource, error) {
+	request, hasRequest := container.Resources.Requests[gpuResourceName]
+	limit, hasLimit := container.Resources.Limits[gpuResourceName]
+	if !hasRequest && !hasLimit {
+		return nil, nil
+	}
+	if hasRequest && hasLimit && request.Cmp(limit) != 0 {
+		return nil, errdefs.InvalidInputf("container %s: %s request %s must be equal to its limit %s", container.Name, gpuResourceName, request.String(), limit.String())
+	}
+
+	gpu := limit
+	if !hasLimit {
+		gpu = request
+	}
+	count, ok := gpu.AsInt64()
+	if !ok || count <= 0 || count > math.MaxInt32 {
+		return nil, errdefs.InvalidInputf("container %s: %s must be a positive integer number, got %s", container.Name, gpuResourceName, gpu.String())
+	}
+
+	sku, err := p.getGPUSKU(pod, container.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	gpuCount := int32(count)
+	return &azaciv2.GpuResource{
+		Count: &gpuCount,
+		SKU:   &sku,
+	}, nil
+}
+
+// getGPUSKU returns the GPU SKU of a container. The SKU is taken from the gpu-type annotation of the container,
+// virtual-kubelet.io/gpu-type.<container name>, then from the gpu-type annotation of the pod, and otherwise
+// the first SKU supported in the region is used.
+func (p *ACIProvider) getGPUSKU(pod *v1.Pod, containerName string) (azaciv2.GpuSKU, error) {
 	if len(p.gpuSKUs) == 0 {
 		return "", fmt.Errorf("the pod requires GPU resource, but ACI doesn't provide GPU enabled container group in region %s", p.region)
 	}
 
-	if desiredSKU, ok := pod.Annotations[gpuTypeAnnotation]; ok {
+	desiredSKU, ok := pod.Annotations[gpuTypeAnnotation+"."+containerName]
+	if !ok {
+		desiredSKU, ok = pod.Annotations[gpuTypeAnnotation]
+	}
+	if ok {
 		for _, supportedSKU := range p.gpuSKUs {
 			if strings.EqualFold(desiredSKU, string(supportedSKU)) {
 				return supportedSKU, nil
 			}
 		}
 
-		return "", fmt.Errorf("the pod requires GPU SKU %s, but ACI only supports SKUs %v in region %s", desiredSKU, p.region, p.gpuSKUs)
+		return "", fmt.Errorf("the container %s requires GPU SKU %s, but ACI only supports SKUs %v in region %s", containerName, desiredSKU, p.gpuSKUs, p.region)
 	}
 
 	return p.gpuSKUs[0], nil
@@ -1252,7 +1751,7 @@ func getProbe(probe *v1.Probe, ports []v1.ContainerPort) (*azaciv2.ContainerProb
 				}
 			}
 			if portValue == 0 {
-				return nil, fmt.Errorf("unable to find named port: %s", portName)
+				return nil, namedPortNotFoundError(portName, ports)
 			}
 		}
 
@@ -1275,12 +1774,63 @@ func getProbe(probe *v1.Probe, ports []v1.ContainerPort) (*azaciv2.ContainerProb
 	}, nil
 }
 
-// Filters service account secret volume for Windows.
-// Service account secret volume gets automatically turned on if not specified otherwise.
-// ACI doesn't support secret volume for Windows, so we need to filter it.
-func filterWindowsServiceAccountSecretVolume(ctx context.Context, osType string, cgw *azaciv2.ContainerGroup) {
+// getProbePorts returns the ports a probe of the container at index c can refer to by name. The containers
+// of a container group share their network, so the ports of the container itself come first, followed by the
+// ports declared by the other containers of the pod.
+func getProbePorts(containers []v1.Container, c int) []v1.ContainerPort {
+	ports := make([]v1.ContainerPort, 0, len(containers[c].Ports))
+	ports = append(ports, containers[c].Ports...)
+	for i := range containers {
+		if i != c {
+			ports = append(ports, containers[i].Ports...)
+		}
+	}
+	return ports
+}
+
+func namedPortNotFoundError(portName string, ports []v1.ContainerPort) error {
+	names := make([]string, 0, len(ports))
+	for _, p := range ports {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("unable to find named port: %s, the pod does not declare any named ports", portName)
+	}
+	return fmt.Errorf("unable to find named port: %s, available named ports: %s", portName, strings.Join(names, ", "))
+}
+
+// delayForStartupProbe delays a liveness probe until the startup probe of the container would have given up,
+// since ACI has no startup probes and would otherwise restart slow-starting containers before they are up.
+func delayForStartupProbe(probe *azaciv2.ContainerProbe, startupProbe *v1.Probe) {
+	periodSeconds := startupProbe.PeriodSeconds
+	if periodSeconds <= 0 {
+		periodSeconds = defaultProbePeriodSeconds
+	}
+	failureThreshold := startupProbe.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = defaultProbeFailureThreshold
+	}
+
+	initialDelaySeconds := startupProbe.InitialDelaySeconds + periodSeconds*failureThreshold
+	if probe.InitialDelaySeconds != nil && *probe.InitialDelaySeconds > initialDelaySeconds {
+		return
+	}
+	probe.InitialDelaySeconds = &initialDelaySeconds
+}
+
+// projectWindowsServiceAccountSecretVolume projects the service account secret volume of the containers of a
+// Windows container group into environment variables, as ACI doesn't support secret volumes on Windows. The token
+// and the CA certificate are secure values, so that the pods can still build their configuration for the API
+// server from KUBERNETES_SERVICE_HOST, KUBERNETES_SERVICE_PORT and these variables.
+func projectWindowsServiceAccountSecretVolume(ctx context.Context, osType string, cgw *azaciv2.ContainerGroup) {
 	if strings.EqualFold(osType, "Windows") {
 		serviceAccountSecretVolumeName := make(map[string]bool)
+		volumeFiles := make(map[string]map[string]*string, len(cgw.Properties.Volumes))
+		for _, volume := range cgw.Properties.Volumes {
+			volumeFiles[*volume.Name] = volume.Secret
+		}
 
 		for index, container := range cgw.Properties.Containers {
 			volumeMounts := make([]*azaciv2.VolumeMount, 0, len(container.Properties.VolumeMounts))
@@ -1289,6 +1839,8 @@ func filterWindowsServiceAccountSecretVolume(ctx context.Context, osType string,
 					volumeMounts = append(volumeMounts, volumeMount)
 				} else {
 					serviceAccountSecretVolumeName[*volumeMount.Name] = true
+					container.Properties.EnvironmentVariables = append(container.Properties.EnvironmentVariables,
+						getServiceAccountEnvironmentVariables(ctx, volumeFiles[*volumeMount.Name])...)
 				}
 			}
 			cgw.Properties.Containers[index].Properties.VolumeMounts = volumeMounts
@@ -1299,7 +1851,7 @@ func filterWindowsServiceAccountSecretVolume(ctx context.Context, osType string,
 		}
 
 		l := log.G(ctx).WithField("containerGroup", cgw.Name)
-		l.Infof("Ignoring service account secret volumes '%v' for Windows", reflect.ValueOf(serviceAccountSecretVolumeName).MapKeys())
+		l.Infof("Projecting service account secret volumes '%v' into environment variables for Windows", reflect.ValueOf(serviceAccountSecretVolumeName).MapKeys())
 
 		volumes := make([]*azaciv2.Volume, 0, len(cgw.Properties.Volumes))
 		for _, volume := range cgw.Properties.Volumes {
@@ -1312,19 +1864,37 @@ func filterWindowsServiceAccountSecretVolume(ctx context.Context, osType string,
 	}
 }
 
-func getACIEnvVar(e v1.EnvVar) *azaciv2.EnvironmentVariable {
-	var envVar azaciv2.EnvironmentVariable
-	// If the variable is a secret, use SecureValue
-	if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
-		envVar = azaciv2.EnvironmentVariable{
-			Name:        &e.Name,
-			SecureValue: &e.Value,
+// getServiceAccountEnvironmentVariables returns the environment variables of the files of a service account secret
+// volume, whose contents are base64 encoded.
+func getServiceAccountEnvironmentVariables(ctx context.Context, files map[string]*string) []*azaciv2.EnvironmentVariable {
+	var envVars []*azaciv2.EnvironmentVariable
+	for _, file := range []struct {
+		name   string
+		envVar string
+		secure bool
+	}{
+		{"token", serviceAccountTokenEnvVar, true},
+		{"ca.crt", serviceAccountCACertEnvVar, true},
+		{"namespace", serviceAccountNamespaceEnvVar, false},
+	} {
+		encoded, ok := files[file.name]
+		if !ok || encoded == nil {
+			continue
 		}
-	} else {
-		envVar = azaciv2.EnvironmentVariable{
-			Name:  &e.Name,
-			Value: &e.Value,
+		content, err := base64.StdEncoding.DecodeString(*encoded)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to decode the %s file of the service account secret volume", file.name)
+			continue
+		}
+		name := file.envVar
+		value := string(content)
+		envVar := &azaciv2.EnvironmentVariable{Name: &name}
+		if file.secure {
+			envVar.SecureValue = &value
+		} else {
+			envVar.Value = &value
 		}
+		envVars = append(envVars, envVar)
 	}
-	return &envVar
+	return envVars
 }
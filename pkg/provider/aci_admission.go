@@ -0,0 +1,88 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// podStatusReasonTaintToleration and podStatusReasonNodeAffinity are the reasons of the pods rejected by
+	// the admission of the provider, named after the scheduler plugins which should have kept them off the node.
+	podStatusReasonTaintToleration = "TaintToleration"
+	podStatusReasonNodeAffinity    = "NodeAffinity"
+)
+
+// admitPod checks that a pod was meant to run on ACI, which the scheduler doesn't ensure for the pods bound to the
+// node directly. When the provider requires tolerations, the pods must tolerate the NoSchedule and NoExecute taints
+// of the node, and they must select the required node labels with their nodeSelector. Their limits must also fit
+// in the node with the Limits overcommit policy. The rejected pods are reported as failed with an event. It returns whether the creation of the pod should go on.
+func (p *ACIProvider) admitPod(ctx context.Context, pod *v1.Pod) bool {
+	p.settingsLock.RLock()
+	requireToleration := p.requireTaintToleration
+	requiredNodeSelector := p.requiredNodeSelector
+	p.settingsLock.RUnlock()
+
+	if requireToleration {
+		p.nodeLock.Lock()
+		var taints []v1.Taint
+		if p.node != nil {
+			taints = p.node.Spec.Taints
+		}
+		p.nodeLock.Unlock()
+
+		if taint := getUntoleratedTaint(pod, taints); taint != nil {
+			p.failPod(ctx, pod, podStatusReasonTaintToleration,
+				errdefs.InvalidInputf("the pod doesn't tolerate the taint %s of node %s", taint.ToString(), p.nodeName))
+			return false
+		}
+	}
+
+	if missing := getMissingNodeSelector(pod, requiredNodeSelector); len(missing) > 0 {
+		p.failPod(ctx, pod, podStatusReasonNodeAffinity,
+			errdefs.InvalidInputf("the pod must select node %s with the nodeSelector %s", p.nodeName, strings.Join(missing, ", ")))
+		return false
+	}
+	return p.admitPodLimits(ctx, pod)
+}
+
+// getUntoleratedTaint returns the first NoSchedule or NoExecute taint a pod doesn't tolerate.
+func getUntoleratedTaint(pod *v1.Pod, taints []v1.Taint) *v1.Taint {
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint
+		}
+	}
+	return nil
+}
+
+// getMissingNodeSelector returns the required node labels the nodeSelector of a pod doesn't select, as key=value.
+func getMissingNodeSelector(pod *v1.Pod, required map[string]string) []string {
+	var missing []string
+	for key, value := range required {
+		if selected, ok := pod.Spec.NodeSelector[key]; !ok || selected != value {
+			missing = append(missing, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
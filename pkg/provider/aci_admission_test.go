@@ -0,0 +1,109 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAdmitPod(t *testing.T) {
+	taint := v1.Taint{Key: "virtual-kubelet.io/provider", Value: "azure", Effect: v1.TaintEffectNoSchedule}
+	toleration := v1.Toleration{Key: taint.Key, Operator: v1.TolerationOpExists}
+
+	cases := []struct {
+		description          string
+		requireToleration    bool
+		requiredNodeSelector map[string]string
+		prepPod              func(pod *v1.Pod)
+		expectedReason       string
+	}{
+		{
+			description: "admission is disabled",
+			prepPod:     func(pod *v1.Pod) {},
+		},
+		{
+			description:       "pod tolerates the taint",
+			requireToleration: true,
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.Tolerations = []v1.Toleration{toleration}
+			},
+		},
+		{
+			description:       "pod doesn't tolerate the taint",
+			requireToleration: true,
+			prepPod:           func(pod *v1.Pod) {},
+			expectedReason:    podStatusReasonTaintToleration,
+		},
+		{
+			description:          "pod selects the node",
+			requiredNodeSelector: map[string]string{"type": "virtual-kubelet"},
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.NodeSelector = map[string]string{"type": "virtual-kubelet"}
+			},
+		},
+		{
+			description:          "pod doesn't select the node",
+			requiredNodeSelector: map[string]string{"type": "virtual-kubelet"},
+			prepPod:              func(pod *v1.Pod) {},
+			expectedReason:       podStatusReasonNodeAffinity,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			pod := testsutil.CreatePodObj("pod", "ns")
+			tc.prepPod(pod)
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+			created := false
+			aciMocks := createNewACIMock()
+			aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+				created = true
+				return nil
+			}
+
+			provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+				NewMockSecretLister(mockCtrl), podLister)
+			assert.NilError(t, err)
+			provider.node = &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{taint}}}
+			provider.requireTaintToleration = tc.requireToleration
+			provider.requiredNodeSelector = tc.requiredNodeSelector
+			recorder := record.NewFakeRecorder(10)
+			provider.SetEventRecorder(recorder)
+			var updatedPod *v1.Pod
+			provider.tracker = &PodsTracker{
+				pods: podLister,
+				updateCb: func(p *v1.Pod) {
+					updatedPod = p
+				},
+			}
+
+			assert.NilError(t, provider.CreatePod(context.Background(), pod))
+			if tc.expectedReason == "" {
+				assert.Check(t, created)
+				return
+			}
+			assert.Check(t, !created)
+			assert.Assert(t, updatedPod != nil)
+			assert.Check(t, is.Equal(v1.PodFailed, updatedPod.Status.Phase))
+			assert.Check(t, is.Equal(tc.expectedReason, updatedPod.Status.Reason))
+			assert.Assert(t, is.Len(recorder.Events, 1))
+			assert.Check(t, is.Contains(<-recorder.Events, tc.expectedReason))
+		})
+	}
+}
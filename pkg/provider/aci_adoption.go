@@ -0,0 +1,140 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	eventReasonAdopted      = "ContainerGroupAdopted"
+	eventReasonStaleDeleted = "StaleContainerGroupDeleted"
+)
+
+// AdoptContainerGroups reconciles the container groups left by a previous run of the provider with the pods of the
+// node, and must be called once the pod informer is synced. Container groups are matched to pods by name and UID tag:
+//   - container groups of pods are adopted, their drifted tags repaired and the pod status refreshed right away,
+//   - container groups created for a previous pod of the same name are deleted, and the pod created again,
+//   - container groups of other nodes and without pod are left to the dangling pod cleanup,
+//   - stopped container groups are left to the creation of their pods, see stopOnDeleteAnnotation.
+func (p *ACIProvider) AdoptContainerGroups(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "aci.AdoptContainerGroups")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	if !p.isLeading() {
+		return nil
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	podsByCG := make(map[string]*v1.Pod, len(pods))
+	for _, pod := range pods {
+		podsByCG[containerGroupName(pod.Namespace, pod.Name)] = pod
+	}
+
+	var adopted, repaired, deleted int
+	for _, resourceGroup := range p.getResourceGroups() {
+		cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, resourceGroup)
+		if err != nil {
+			return err
+		}
+		for _, cg := range cgs {
+			if cg == nil || cg.Name == nil {
+				continue
+			}
+			pod, ok := podsByCG[*cg.Name]
+			if !ok || isContainerGroupStopped(cg) || !strings.EqualFold(p.getResourceGroup(pod.Namespace), resourceGroup) {
+				continue
+			}
+
+			uid := stringValue(cg.Tags["UID"])
+			nodeName := cg.Tags["NodeName"]
+			if nodeName != nil && *nodeName != p.nodeName && uid != string(pod.UID) {
+				continue
+			}
+			logger := log.G(ctx).WithField("containerGroup", *cg.Name)
+
+			if uid != "" && uid != string(pod.UID) {
+				logger.Infof("deleting container group created for pod UID %s instead of %s", uid, pod.UID)
+				// the pod controller already saw the stale container group as the one of the pod, so the
+				// container group of the pod is created once the stale one is gone
+				if err := p.azClientsAPIs.DeleteContainerGroupAndWait(ctx, resourceGroup, *cg.Name); err != nil && !errdefs.IsNotFound(err) {
+					logger.WithError(err).Error("failed to delete stale container group")
+					continue
+				}
+				if p.eventRecorder != nil {
+					p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonStaleDeleted,
+						"Deleted container group %s, which was created for a previous pod with the same name, the pod will be recreated", *cg.Name)
+				}
+				deleted++
+				if pod.DeletionTimestamp == nil {
+					if err := p.CreatePod(ctx, pod); err != nil {
+						logger.WithError(err).Error("failed to recreate the container group of the pod")
+					}
+				}
+				continue
+			}
+
+			if tags, drifted := getAdoptedTags(cg.Tags, pod, p.nodeName); drifted {
+				logger.Info("repairing drifted container group tags")
+				if err := p.azClientsAPIs.UpdateContainerGroupTags(ctx, resourceGroup, *cg.Name, tags); err != nil {
+					logger.WithError(err).Error("failed to repair container group tags")
+				} else {
+					if p.eventRecorder != nil {
+						p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonAdopted,
+							"Adopted container group %s and repaired its tags", *cg.Name)
+					}
+					repaired++
+				}
+			}
+			adopted++
+
+			if p.tracker != nil {
+				if err := p.tracker.RefreshPodStatus(ctx, pod.Namespace, pod.Name); err != nil && !errdefs.IsNotFound(err) {
+					logger.WithError(err).Warn("failed to refresh the status of the adopted pod")
+				}
+			}
+		}
+	}
+
+	log.G(ctx).Infof("adopted %d container groups, repaired the tags of %d and deleted %d stale ones", adopted, repaired, deleted)
+	return nil
+}
+
+// getAdoptedTags returns the tags of a container group with the tags identifying its pod set as CreatePod sets them,
+// and whether any of them drifted.
+func getAdoptedTags(tags map[string]*string, pod *v1.Pod, nodeName string) (map[string]*string, bool) {
+	expected := map[string]string{
+		"PodName":           pod.Name,
+		"NodeName":          nodeName,
+		"Namespace":         pod.Namespace,
+		"UID":               string(pod.UID),
+		"CreationTimestamp": pod.CreationTimestamp.String(),
+	}
+
+	adopted := make(map[string]*string, len(tags)+len(expected))
+	for key, value := range tags {
+		adopted[key] = value
+	}
+	drifted := false
+	for key, value := range expected {
+		if current := adopted[key]; current == nil || *current != value {
+			value := value
+			adopted[key] = &value
+			drifted = true
+		}
+	}
+	return adopted, drifted
+}
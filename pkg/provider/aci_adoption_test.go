@@ -0,0 +1,98 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAdoptContainerGroups(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newPod := func(name string) *v1.Pod {
+		pod := testsutil.CreatePodObj(name, "ns")
+		pod.UID = types.UID(name + "-uid")
+		return pod
+	}
+	newContainerGroup := func(pod *v1.Pod, uid, nodeName string) *azaciv2.ContainerGroup {
+		cgName := containerGroupName(pod.Namespace, pod.Name)
+		tags, _ := getAdoptedTags(map[string]*string{"team": &pod.Name}, pod, nodeName)
+		if uid == "" {
+			delete(tags, "UID")
+		} else {
+			tags["UID"] = &uid
+		}
+		return &azaciv2.ContainerGroup{Name: &cgName, Tags: tags}
+	}
+
+	adopted := newPod("adopted")
+	drifted := newPod("drifted")
+	stale := newPod("stale")
+	otherNode := newPod("other-node")
+	renamedNode := newPod("renamed-node")
+	cgs := []*azaciv2.ContainerGroup{
+		newContainerGroup(adopted, string(adopted.UID), fakeNodeName),
+		newContainerGroup(drifted, "", fakeNodeName),
+		newContainerGroup(stale, "previous-uid", fakeNodeName),
+		newContainerGroup(otherNode, "other-uid", "other-vk"),
+		newContainerGroup(renamedNode, string(renamedNode.UID), "old-vk"),
+		newContainerGroup(newPod("deleted"), "deleted-uid", fakeNodeName),
+	}
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{adopted, drifted, stale, otherNode, renamedNode}, nil).AnyTimes()
+
+	var deleted []string
+	updated := map[string]map[string]*string{}
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		return cgs, nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = append(deleted, cgName)
+		return nil
+	}
+	var created []string
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		created = append(created, containerGroupName(podNS, podName))
+		return nil
+	}
+	aciMocks.MockUpdateContainerGroupTags = func(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+		updated[cgName] = tags
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	assert.NilError(t, provider.AdoptContainerGroups(context.Background()))
+	assert.Check(t, is.DeepEqual([]string{"ns-stale"}, deleted))
+	// the pod of the stale container group is created again
+	assert.Check(t, is.DeepEqual([]string{"ns-stale"}, created))
+	assert.Assert(t, is.Len(updated, 2))
+
+	tags := updated["ns-drifted"]
+	assert.Assert(t, tags != nil)
+	assert.Check(t, is.Equal(string(drifted.UID), *tags["UID"]))
+	// tags not identifying the pod are kept
+	assert.Check(t, is.Equal("drifted", *tags["team"]))
+
+	tags = updated["ns-renamed-node"]
+	assert.Assert(t, tags != nil)
+	assert.Check(t, is.Equal(fakeNodeName, *tags["NodeName"]))
+}
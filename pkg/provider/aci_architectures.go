@@ -0,0 +1,101 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// architectureAnnotation selects the CPU architecture of the containers of a pod, like the kubernetes.io/arch
+	// node selector but without constraining its scheduling.
+	architectureAnnotation = "virtual-kubelet.io/architecture"
+	// aciArchitecture is the only CPU architecture of ACI, the API has no field to select another one.
+	aciArchitecture = "amd64"
+)
+
+// architectureNodeSelectors are the node selectors of the CPU architecture of a pod, the beta one is still set by
+// older charts.
+var architectureNodeSelectors = []string{v1.LabelArchStable, "beta.kubernetes.io/arch"}
+
+// getPodArchitectures returns the CPU architectures a pod accepts, or nil when it accepts any. The annotation takes
+// precedence over the node selectors, which take precedence over the required node affinity.
+func getPodArchitectures(pod *v1.Pod) []string {
+	if value, ok := pod.Annotations[architectureAnnotation]; ok {
+		return []string{strings.ToLower(value)}
+	}
+	for _, label := range architectureNodeSelectors {
+		if value, ok := pod.Spec.NodeSelector[label]; ok {
+			return []string{strings.ToLower(value)}
+		}
+	}
+	return getAffinityArchitectures(pod.Spec.Affinity)
+}
+
+// getAffinityArchitectures returns the CPU architectures of the In expressions of the required node affinity. Node
+// selector terms are ORed, so the architectures of all the terms are merged, and a term without an architecture
+// accepts any.
+func getAffinityArchitectures(affinity *v1.Affinity) []string {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+
+	var architectures []string
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		found := false
+		for _, expr := range term.MatchExpressions {
+			if containsString(architectureNodeSelectors, expr.Key) && expr.Operator == v1.NodeSelectorOpIn {
+				for _, value := range expr.Values {
+					architectures = append(architectures, strings.ToLower(value))
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return architectures
+}
+
+// checkPodArchitecture fails the pods which only accept other CPU architectures than the one of ACI. When image
+// architectures are validated, it also fails the pods whose images have no amd64 image for the operating system
+// of their container group, which ACI would only report once the pull fails. The images whose platforms can't be
+// read are let through.
+func (p *ACIProvider) checkPodArchitecture(ctx context.Context, pod *v1.Pod, creds []*azaciv2.ImageRegistryCredential) error {
+	if architectures := getPodArchitectures(pod); architectures != nil && !containsString(architectures, aciArchitecture) {
+		return errdefs.InvalidInputf("pod %s requests the %s architecture, ACI only runs %s containers", pod.Name,
+			strings.Join(architectures, ","), aciArchitecture)
+	}
+	if !p.validateImageArchitectures {
+		return nil
+	}
+	resolver, ok := p.imageConfigResolver.(ImageOperatingSystemResolver)
+	if !ok {
+		return nil
+	}
+
+	os := strings.ToLower(p.getPodOperatingSystem(pod))
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		oses, err := resolver.GetImageOperatingSystems(ctx, container.Image, creds)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("pod %s: failed to read the platforms of image %s", pod.Name, container.Image)
+			continue
+		}
+		if !containsString(oses, os) {
+			return errdefs.InvalidInputf("container %s: image %s has no %s/%s image, the only platform ACI runs", container.Name,
+				container.Image, os, aciArchitecture)
+		}
+	}
+	return nil
+}
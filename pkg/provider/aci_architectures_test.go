@@ -0,0 +1,120 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCheckPodArchitecture(t *testing.T) {
+	p := ACIProvider{
+		operatingSystem:            "Linux",
+		validateImageArchitectures: true,
+		imageConfigResolver: fakeImagePlatformResolver{oses: map[string][]string{
+			"nginx": {"linux", "windows"},
+			"iis":   {"windows"},
+			"arm":   {},
+		}},
+	}
+	affinity := func(terms ...[]string) *v1.Affinity {
+		selector := &v1.NodeSelector{}
+		for _, values := range terms {
+			term := v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "example.com/tier", Operator: v1.NodeSelectorOpExists}}}
+			if values != nil {
+				term.MatchExpressions = append(term.MatchExpressions,
+					v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: values})
+			}
+			selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, term)
+		}
+		return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}}
+	}
+
+	cases := []struct {
+		description   string
+		annotations   map[string]string
+		nodeSelector  map[string]string
+		affinity      *v1.Affinity
+		image         string
+		expectedError string
+	}{
+		{
+			description: "any architecture",
+			image:       "nginx",
+		},
+		{
+			description:  "amd64 node selector",
+			nodeSelector: map[string]string{v1.LabelArchStable: "amd64"},
+			image:        "nginx",
+		},
+		{
+			description:   "arm64 node selector",
+			nodeSelector:  map[string]string{"beta.kubernetes.io/arch": "arm64"},
+			image:         "nginx",
+			expectedError: "requests the arm64 architecture",
+		},
+		{
+			description:   "annotation takes precedence",
+			annotations:   map[string]string{architectureAnnotation: "ARM64"},
+			nodeSelector:  map[string]string{v1.LabelArchStable: "amd64"},
+			image:         "nginx",
+			expectedError: "requests the arm64 architecture",
+		},
+		{
+			description: "affinity accepting amd64",
+			affinity:    affinity([]string{"arm64"}, []string{"amd64"}),
+			image:       "nginx",
+		},
+		{
+			description: "affinity term accepting any architecture",
+			affinity:    affinity([]string{"arm64"}, nil),
+			image:       "nginx",
+		},
+		{
+			description:   "affinity rejecting amd64",
+			affinity:      affinity([]string{"arm64", "s390x"}),
+			image:         "nginx",
+			expectedError: "requests the arm64,s390x architecture",
+		},
+		{
+			description:   "image without an image for the operating system",
+			image:         "iis",
+			expectedError: "image iis has no linux/amd64 image",
+		},
+		{
+			description:   "arm64 image",
+			image:         "arm",
+			expectedError: "image arm has no linux/amd64 image",
+		},
+		{
+			description: "unknown image",
+			image:       "unknown",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Annotations = tc.annotations
+			pod.Spec.NodeSelector = tc.nodeSelector
+			pod.Spec.Affinity = tc.affinity
+			pod.Spec.Containers = []v1.Container{{Name: "c", Image: tc.image}}
+
+			err := p.checkPodArchitecture(context.Background(), pod, nil)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+// AttachToContainer streams the live output of a container in the pod to the stdout of the attached client,
+// until the client or ACI closes the stream. The ACI attach stream merges the stdout and stderr of the container
+// and has no input, which is consistent with the containers not having stdin, see validateContainerIO.
+func (p *ACIProvider) AttachToContainer(ctx context.Context, namespace, name, container string, attach api.AttachIO) error {
+	logger := log.G(ctx).WithField("method", "AttachToContainer")
+	ctx, span := trace.StartSpan(ctx, "aci.AttachToContainer")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	out := attach.Stdout()
+	if out != nil {
+		defer out.Close()
+	}
+	if errOut := attach.Stderr(); errOut != nil {
+		defer errOut.Close()
+	}
+	if attach.Stdin() != nil {
+		return errdefs.InvalidInput("ACI containers have no stdin, only their output can be attached to")
+	}
+	if out == nil {
+		out = attach.Stderr()
+	}
+	if out == nil {
+		return errdefs.InvalidInput("the output of the container must be attached to")
+	}
+
+	cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(namespace), namespace, name, p.nodeName)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.azClientsAPIs.AttachToContainer(ctx, p.getResourceGroup(namespace), *cg.Name, container)
+	if err != nil {
+		return err
+	}
+	if resp.WebSocketURI == nil || resp.Password == nil {
+		return errdefs.NotFoundf("container %s of pod %s/%s has no output stream", container, namespace, name)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", *resp.Password)
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, *resp.WebSocketURI, header)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// the reads of the websocket are not cancellable, closing the connection ends them
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, r, err := c.NextReader()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.WithError(err).Debug("the output stream of the container was closed")
+			return nil
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			// the client detached
+			return nil
+		}
+	}
+}
+
+// AttachHandler serves kubectl attach, which the pod routes of the virtual kubelet do not cover, with the stream
+// protocol of exec.
+func (p *ACIProvider) AttachHandler() http.Handler {
+	r := mux.NewRouter()
+	r.StrictSlash(true)
+	r.HandleFunc("/attach/{namespace}/{pod}/{container}", api.HandleContainerExec(
+		func(ctx context.Context, namespace, pod, container string, cmd []string, attach api.AttachIO) error {
+			return p.AttachToContainer(ctx, namespace, pod, container, attach)
+		},
+	)).Methods("POST", "GET")
+	r.NotFoundHandler = http.HandlerFunc(api.NotFound)
+	return r
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestAttachToContainer(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_ = c.WriteMessage(websocket.TextMessage, []byte("line 1\n"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte("line 2\n"))
+		_ = c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+	defer server.Close()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		return testsutil.CreateContainerGroupObj(name, namespace, "Succeeded", testsutil.CreateACIContainersListObj("Running", "Initializing", testsutil.CgCreationTime.Add(time.Second*2), testsutil.CgCreationTime.Add(time.Second*3), false, false, false), "Succeeded"), nil
+	}
+	wsURI := "ws" + strings.TrimPrefix(server.URL, "http")
+	password := "password"
+	aciMocks.MockAttachToContainer = func(ctx context.Context, resourceGroup, cgName, containerName string) (*azaciv2.ContainerAttachResponse, error) {
+		return &azaciv2.ContainerAttachResponse{WebSocketURI: &wsURI, Password: &password}, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+
+	var out bytes.Buffer
+	err = provider.AttachToContainer(context.Background(), "ns", "pod", "c", &fakeAttachIO{stdout: nopWriteCloser{&out}})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("line 1\nline 2\n", out.String()))
+
+	err = provider.AttachToContainer(context.Background(), "ns", "pod", "c", &fakeAttachIO{stdin: strings.NewReader(""), stdout: nopWriteCloser{&out}})
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
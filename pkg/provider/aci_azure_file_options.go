@@ -0,0 +1,97 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// azureFileMountOptionsAnnotation lists the mount options of the Azure Files volumes of a pod, comma separated
+	// like the mountOptions of the Azure Files CSI driver.
+	azureFileMountOptionsAnnotation = "virtual-kubelet.io/azure-file-mount-options"
+	// azureFileMountOptions and azureFileProtocol are the volume attributes of the Azure Files CSI driver for the
+	// mount options and the protocol of a share.
+	azureFileMountOptions = "mountOptions"
+	azureFileProtocol     = "protocol"
+
+	eventReasonMountOptionsIgnored = "AzureFileMountOptionsIgnored"
+)
+
+// checkAzureFileMountOptions validates the mount options and protocols requested for the Azure Files volumes of a
+// pod. The ACI API mounts the shares over SMB with its own options and has no field to pass others, so the NFS
+// shares are rejected and the valid mount options are only reported with a warning event, rather than silently
+// dropped, so that the owners of non-root containers know why the files aren't owned by their user.
+func (p *ACIProvider) checkAzureFileMountOptions(ctx context.Context, pod *v1.Pod) error {
+	var requested []string
+	if options, ok := pod.Annotations[azureFileMountOptionsAnnotation]; ok {
+		parsed, err := parseAzureFileMountOptions(options)
+		if err != nil {
+			return errdefs.InvalidInputf("pod %s: annotation %s: %v", pod.Name, azureFileMountOptionsAnnotation, err)
+		}
+		requested = append(requested, parsed...)
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.CSI == nil || volume.CSI.Driver != AzureFileDriverName {
+			continue
+		}
+		if protocol := volume.CSI.VolumeAttributes[azureFileProtocol]; protocol != "" && !strings.EqualFold(protocol, "smb") {
+			return errdefs.InvalidInputf("pod %s: volume %s: ACI only mounts Azure Files shares over SMB, not %s", pod.Name, volume.Name, protocol)
+		}
+		if options, ok := volume.CSI.VolumeAttributes[azureFileMountOptions]; ok {
+			parsed, err := parseAzureFileMountOptions(options)
+			if err != nil {
+				return errdefs.InvalidInputf("pod %s: volume %s: %v", pod.Name, volume.Name, err)
+			}
+			requested = append(requested, parsed...)
+		}
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("ACI mounts the Azure Files shares with its own options, ignoring %s", strings.Join(requested, ","))
+	log.G(ctx).Warnf("pod %s: %s", pod.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeWarning, eventReasonMountOptionsIgnored, message)
+	}
+	return nil
+}
+
+// parseAzureFileMountOptions validates comma separated mount options, checking the values of the options setting
+// the SMB version, the ownership and the modes of the files.
+func parseAzureFileMountOptions(options string) ([]string, error) {
+	var parsed []string
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(option, "=")
+		switch name {
+		case "uid", "gid":
+			if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid mount option %s, the %s must be a number", option, name)
+			}
+		case "file_mode", "dir_mode":
+			if _, err := strconv.ParseUint(value, 8, 32); err != nil {
+				return nil, fmt.Errorf("invalid mount option %s, the %s must be an octal mode", option, name)
+			}
+		case "vers":
+			if !hasValue || value == "" {
+				return nil, fmt.Errorf("invalid mount option %s, the SMB version is missing", option)
+			}
+		}
+		parsed = append(parsed, option)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseAzureFileMountOptions(t *testing.T) {
+	options, err := parseAzureFileMountOptions("uid=1000, gid=1000,file_mode=0640,dir_mode=0750,vers=3.1.1,,nobrl")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"uid=1000", "gid=1000", "file_mode=0640", "dir_mode=0750", "vers=3.1.1", "nobrl"}, options))
+
+	cases := []struct {
+		options string
+		err     string
+	}{
+		{"uid=nobody", "the uid must be a number"},
+		{"file_mode=0990", "the file_mode must be an octal mode"},
+		{"vers", "the SMB version is missing"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.options, func(t *testing.T) {
+			_, err := parseAzureFileMountOptions(tc.options)
+			assert.Check(t, is.ErrorContains(err, tc.err))
+		})
+	}
+}
+
+func TestCheckAzureFileMountOptions(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	p := &ACIProvider{eventRecorder: recorder}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "p",
+			Namespace:   "ns",
+			Annotations: map[string]string{azureFileMountOptionsAnnotation: "uid=1000,gid=1000"},
+		},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{{
+			Name: "data",
+			VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{
+				Driver:           AzureFileDriverName,
+				VolumeAttributes: map[string]string{azureFileMountOptions: "file_mode=0640"},
+			}},
+		}}},
+	}
+
+	assert.NilError(t, p.checkAzureFileMountOptions(context.Background(), pod))
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Equal("Warning "+eventReasonMountOptionsIgnored+" ACI mounts the Azure Files shares with its own options, ignoring uid=1000,gid=1000,file_mode=0640",
+		<-recorder.Events))
+
+	pod.Spec.Volumes[0].CSI.VolumeAttributes[azureFileProtocol] = "nfs"
+	err := p.checkAzureFileMountOptions(context.Background(), pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "only mounts Azure Files shares over SMB, not nfs"))
+
+	pod.Annotations[azureFileMountOptionsAnnotation] = "gid=staff"
+	err = p.checkAzureFileMountOptions(context.Background(), pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
@@ -0,0 +1,224 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// maxCreationLatencySamples is the number of the most recent container group creations the latency percentiles
+// are computed from.
+const maxCreationLatencySamples = 1000
+
+// BurstMetrics tells the autoscalers of a cluster, e.g. the cluster autoscaler or KEDA, whether bursting pods to
+// ACI keeps up, so that they can choose between scaling the VM pools and bursting to the virtual node.
+type BurstMetrics struct {
+	// PendingPods is the number of pods of the node waiting for their container group.
+	PendingPods     int                    `json:"pendingPods"`
+	CreationLatency CreationLatencyMetrics `json:"creationLatency"`
+	Regions         []RegionQuotaHeadroom  `json:"regions"`
+}
+
+// CreationLatencyMetrics are the percentiles of the time from the creation of the recent pods to the provisioning
+// of their container group.
+type CreationLatencyMetrics struct {
+	Samples    int     `json:"samples"`
+	P50Seconds float64 `json:"p50Seconds"`
+	P90Seconds float64 `json:"p90Seconds"`
+	P99Seconds float64 `json:"p99Seconds"`
+}
+
+// RegionQuotaHeadroom is the ACI quota left in a region, missing when the usage of the region is unavailable.
+type RegionQuotaHeadroom struct {
+	Region          string `json:"region"`
+	ContainerGroups *int32 `json:"containerGroups,omitempty"`
+	StandardCores   *int32 `json:"standardCores,omitempty"`
+}
+
+// burstMetricsCollector measures how long the container groups of the pods take to be provisioned, and caches the
+// usage of the regions when the capacity checks don't.
+type burstMetricsCollector struct {
+	lock sync.Mutex
+	// started is when the pods whose container group is provisioning were created, by pod.
+	started map[string]time.Time
+	samples []time.Duration
+	next    int
+	usage   map[string]*capacityChecker
+}
+
+func newBurstMetricsCollector() *burstMetricsCollector {
+	return &burstMetricsCollector{
+		started: make(map[string]time.Time),
+		usage:   make(map[string]*capacityChecker),
+	}
+}
+
+// startCreation records the creation time of a pod whose container group is being provisioned.
+func (c *burstMetricsCollector) startCreation(namespace, name string, created time.Time) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.started[namespace+"/"+name] = created
+}
+
+// completeCreation records the creation latency of a pod once its container group is provisioned.
+func (c *burstMetricsCollector) completeCreation(namespace, name string, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := namespace + "/" + name
+	created, ok := c.started[key]
+	if !ok {
+		return
+	}
+	delete(c.started, key)
+
+	latency := now.Sub(created)
+	if len(c.samples) < maxCreationLatencySamples {
+		c.samples = append(c.samples, latency)
+		return
+	}
+	c.samples[c.next] = latency
+	c.next = (c.next + 1) % maxCreationLatencySamples
+}
+
+// forgetCreation drops a pod deleted before its container group was provisioned.
+func (c *burstMetricsCollector) forgetCreation(namespace, name string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.started, namespace+"/"+name)
+}
+
+func (c *burstMetricsCollector) getCreationLatency() CreationLatencyMetrics {
+	if c == nil {
+		return CreationLatencyMetrics{}
+	}
+	c.lock.Lock()
+	samples := append([]time.Duration(nil), c.samples...)
+	c.lock.Unlock()
+	if len(samples) == 0 {
+		return CreationLatencyMetrics{}
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return samples[i].Seconds()
+	}
+	return CreationLatencyMetrics{
+		Samples:    len(samples),
+		P50Seconds: percentile(0.5),
+		P90Seconds: percentile(0.9),
+		P99Seconds: percentile(0.99),
+	}
+}
+
+// usageChecker returns the checker caching the usage of a region, the one of the capacity checks when enabled.
+func (p *ACIProvider) usageChecker(region string) *capacityChecker {
+	if checker := p.capacityCheckers[region]; checker != nil {
+		return checker
+	}
+	c := p.burstMetrics
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	checker := c.usage[region]
+	if checker == nil {
+		checker = newCapacityChecker(p.azClientsAPIs, region)
+		c.usage[region] = checker
+	}
+	return checker
+}
+
+// GetBurstMetrics returns the pending pods of the node, the latency of the recent container group creations and
+// the ACI quota left in each region.
+func (p *ACIProvider) GetBurstMetrics(ctx context.Context) (*BurstMetrics, error) {
+	ctx, span := trace.StartSpan(ctx, "aci.GetBurstMetrics")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	metrics := &BurstMetrics{
+		CreationLatency: p.burstMetrics.getCreationLatency(),
+		Regions:         make([]RegionQuotaHeadroom, 0, len(p.regions)),
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == v1.PodPending {
+			metrics.PendingPods++
+		}
+	}
+
+	regions := p.regions
+	if len(regions) == 0 {
+		regions = []string{p.region}
+	}
+	for _, region := range regions {
+		_, usage := p.usageChecker(region).get(ctx)
+		metrics.Regions = append(metrics.Regions, getQuotaHeadroom(region, usage))
+	}
+	return metrics, nil
+}
+
+// getQuotaHeadroom returns the container groups and standard cores left in the quota of a region.
+func getQuotaHeadroom(region string, usage []*azaciv2.Usage) RegionQuotaHeadroom {
+	headroom := RegionQuotaHeadroom{Region: region}
+	for _, u := range usage {
+		if u.Name == nil || u.CurrentValue == nil || u.Limit == nil {
+			continue
+		}
+		left := *u.Limit - *u.CurrentValue
+		if left < 0 {
+			left = 0
+		}
+		switch name := stringValue(u.Name.Value); {
+		case strings.EqualFold(name, containerGroupsUsageName):
+			headroom.ContainerGroups = &left
+		case strings.EqualFold(name, standardCoresUsageName):
+			headroom.StandardCores = &left
+		}
+	}
+	return headroom
+}
+
+// BurstMetricsHandler serves the burst metrics of the node as JSON.
+func (p *ACIProvider) BurstMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := p.GetBurstMetrics(r.Context())
+		if err != nil {
+			log.G(r.Context()).WithError(err).Error("failed to get burst metrics")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(metrics); err != nil {
+			log.G(r.Context()).WithError(err).Error("failed to encode burst metrics")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCreationLatency(t *testing.T) {
+	c := newBurstMetricsCollector()
+	assert.Check(t, is.DeepEqual(CreationLatencyMetrics{}, c.getCreationLatency()))
+
+	created := time.Now()
+	for i := 1; i <= 10; i++ {
+		name := string(rune('a' + i))
+		c.startCreation("ns", name, created)
+		c.completeCreation("ns", name, created.Add(time.Duration(i)*time.Second))
+	}
+	// the pods deleted or not created by the provider aren't measured
+	c.startCreation("ns", "deleted", created)
+	c.forgetCreation("ns", "deleted")
+	c.completeCreation("ns", "deleted", created.Add(time.Hour))
+	c.completeCreation("ns", "unknown", created.Add(time.Hour))
+
+	assert.Check(t, is.DeepEqual(CreationLatencyMetrics{
+		Samples:    10,
+		P50Seconds: 5,
+		P90Seconds: 9,
+		P99Seconds: 10,
+	}, c.getCreationLatency()))
+
+	// the oldest samples are replaced
+	for i := 0; i < maxCreationLatencySamples; i++ {
+		c.startCreation("ns", "pod", created)
+		c.completeCreation("ns", "pod", created.Add(time.Minute))
+	}
+	latency := c.getCreationLatency()
+	assert.Check(t, is.Equal(maxCreationLatencySamples, latency.Samples))
+	assert.Check(t, is.Equal(float64(60), latency.P50Seconds))
+}
+
+func TestBurstMetricsHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pods := testsutil.CreatePodsList([]string{"pending", "running", "deleting"}, "ns")
+	pods[0].Status.Phase = v1.PodPending
+	pods[1].Status.Phase = v1.PodRunning
+	pods[2].Status.Phase = v1.PodPending
+	pods[2].DeletionTimestamp = pods[1].CreationTimestamp.DeepCopy()
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		return []*azaciv2.Usage{
+			newTestUsage("ContainerGroups", 90, 100),
+			newTestUsage("StandardCores", 12, 10),
+		}, nil
+	}
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+
+	recorder := httptest.NewRecorder()
+	provider.BurstMetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/burstmetrics", nil))
+	assert.Check(t, is.Equal(http.StatusOK, recorder.Code))
+
+	var metrics BurstMetrics
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &metrics))
+	assert.Check(t, is.Equal(1, metrics.PendingPods))
+	assert.Assert(t, is.Len(metrics.Regions, 1))
+	assert.Check(t, is.Equal(fakeRegion, metrics.Regions[0].Region))
+	assert.Check(t, is.Equal(int32(10), *metrics.Regions[0].ContainerGroups))
+	assert.Check(t, is.Equal(int32(0), *metrics.Regions[0].StandardCores))
+}
@@ -0,0 +1,260 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+const (
+	capabilitiesCacheTTL = time.Hour
+	usageCacheTTL        = time.Minute
+
+	containerGroupsUsageName = "ContainerGroups"
+	standardCoresUsageName   = "StandardCores"
+	noGPUCapability          = "None"
+)
+
+// capacityChecker rejects container groups which ACI would refuse because they exceed the regional
+// capabilities or the remaining quota of the subscription, so that the pod fails with an actionable event
+// instead of an ARM error. The capabilities and the usage are cached, and the check is skipped when they
+// can't be retrieved.
+type capacityChecker struct {
+	clients client.AzClientsInterface
+	region  string
+
+	lock                sync.Mutex
+	capabilities        []*azaciv2.Capabilities
+	capabilitiesFetched time.Time
+	usage               []*azaciv2.Usage
+	usageFetched        time.Time
+}
+
+func newCapacityChecker(clients client.AzClientsInterface, region string) *capacityChecker {
+	return &capacityChecker{
+		clients: clients,
+		region:  region,
+	}
+}
+
+// containerGroupResources is the sum of the resources requested by the containers of a container group.
+type containerGroupResources struct {
+	cpu      float64
+	memoryGB float64
+	gpuCount int32
+	gpuSKU   string
+}
+
+func getContainerGroupResources(cg *azaciv2.ContainerGroup) containerGroupResources {
+	var resources containerGroupResources
+	for _, container := range cg.Properties.Containers {
+		if container.Properties == nil || container.Properties.Resources == nil || container.Properties.Resources.Requests == nil {
+			continue
+		}
+		requests := container.Properties.Resources.Requests
+		if requests.CPU != nil {
+			resources.cpu += *requests.CPU
+		}
+		if requests.MemoryInGB != nil {
+			resources.memoryGB += *requests.MemoryInGB
+		}
+		if requests.Gpu != nil && requests.Gpu.Count != nil {
+			resources.gpuCount += *requests.Gpu.Count
+			if requests.Gpu.SKU != nil {
+				resources.gpuSKU = string(*requests.Gpu.SKU)
+			}
+		}
+	}
+	return resources
+}
+
+// check validates the container group against the capabilities of the region and the quota of the subscription.
+func (c *capacityChecker) check(ctx context.Context, cg *azaciv2.ContainerGroup) error {
+	ctx, span := trace.StartSpan(ctx, "aci.capacityChecker.check")
+	defer span.End()
+
+	resources := getContainerGroupResources(cg)
+	osType := ""
+	if cg.Properties.OSType != nil {
+		osType = string(*cg.Properties.OSType)
+	}
+
+	capabilities, usage := c.get(ctx)
+	if err := checkCapabilities(capabilities, c.region, osType, resources); err != nil {
+		return err
+	}
+	return checkUsage(usage, c.region, resources)
+}
+
+// get returns the cached capabilities and usage of the region, refreshing them when they expired.
+func (c *capacityChecker) get(ctx context.Context) ([]*azaciv2.Capabilities, []*azaciv2.Usage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if c.capabilitiesFetched.IsZero() || now.Sub(c.capabilitiesFetched) > capabilitiesCacheTTL {
+		capabilities, err := c.clients.ListCapabilities(ctx, c.region)
+		if err != nil {
+			log.G(ctx).WithError(err).Warn("unable to fetch the ACI capabilities, skipping the capabilities check")
+		} else {
+			c.capabilities = capabilities
+			c.capabilitiesFetched = now
+		}
+	}
+	if c.usageFetched.IsZero() || now.Sub(c.usageFetched) > usageCacheTTL {
+		usage, err := c.clients.ListUsage(ctx, c.region)
+		if err != nil {
+			log.G(ctx).WithError(err).Warn("unable to fetch the ACI usage, skipping the quota check")
+		} else {
+			c.usage = usage
+			c.usageFetched = now
+		}
+	}
+	return c.capabilities, c.usage
+}
+
+// invalidateUsage refreshes the usage on the next check, once container groups were deleted to free quota.
+func (c *capacityChecker) invalidateUsage() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.usageFetched = time.Time{}
+}
+
+// checkCapabilities rejects container groups requesting more than the largest matching container group
+// capability of the region allows.
+func checkCapabilities(capabilities []*azaciv2.Capabilities, region, osType string, resources containerGroupResources) error {
+	if len(capabilities) == 0 {
+		return nil
+	}
+
+	gpu := noGPUCapability
+	if resources.gpuCount > 0 {
+		gpu = resources.gpuSKU
+	}
+	maxCPU, maxMemoryGB, maxGPUCount, found := getCapabilityMaximums(capabilities, osType, gpu)
+
+	if !found {
+		if gpu != noGPUCapability {
+			return errdefs.InvalidInputf("ACI doesn't provide %s GPU enabled %s container groups in region %s", gpu, osType, region)
+		}
+		return nil
+	}
+	if resources.cpu > maxCPU {
+		return errdefs.InvalidInputf("the pod requests %v CPU cores, but ACI allows at most %v cores per %s container group in region %s", resources.cpu, maxCPU, osType, region)
+	}
+	if resources.memoryGB > maxMemoryGB {
+		return errdefs.InvalidInputf("the pod requests %vGB of memory, but ACI allows at most %vGB per %s container group in region %s", resources.memoryGB, maxMemoryGB, osType, region)
+	}
+	if float64(resources.gpuCount) > maxGPUCount {
+		return errdefs.InvalidInputf("the pod requests %d %s GPUs, but ACI allows at most %v per container group in region %s", resources.gpuCount, gpu, maxGPUCount, region)
+	}
+	return nil
+}
+
+// getCapabilityMaximums returns the resources of the largest container group capability of the region for an OS
+// and a GPU SKU, false when the region has none.
+func getCapabilityMaximums(capabilities []*azaciv2.Capabilities, osType, gpu string) (maxCPU, maxMemoryGB, maxGPUCount float64, found bool) {
+	for _, capability := range capabilities {
+		if capability.Capabilities == nil ||
+			!strings.EqualFold(stringValue(capability.ResourceType), "containerGroups") ||
+			!strings.EqualFold(stringValue(capability.OSType), osType) ||
+			!strings.EqualFold(stringValue(capability.Gpu), gpu) {
+			continue
+		}
+		found = true
+		maxCPU = math.Max(maxCPU, float64Value(capability.Capabilities.MaxCPU))
+		maxMemoryGB = math.Max(maxMemoryGB, float64Value(capability.Capabilities.MaxMemoryInGB))
+		maxGPUCount = math.Max(maxGPUCount, float64Value(capability.Capabilities.MaxGpuCount))
+	}
+	return maxCPU, maxMemoryGB, maxGPUCount, found
+}
+
+// fitCapabilities scales the resources of a container group down to the largest container group capability of
+// the region, see fitContainerResources, and returns the adjustments.
+func (c *capacityChecker) fitCapabilities(ctx context.Context, cg *azaciv2.ContainerGroup, policy resourcePolicy) ([]string, error) {
+	resources := getContainerGroupResources(cg)
+	gpu := noGPUCapability
+	if resources.gpuCount > 0 {
+		gpu = resources.gpuSKU
+	}
+	osType := ""
+	if cg.Properties.OSType != nil {
+		osType = string(*cg.Properties.OSType)
+	}
+
+	capabilities, _ := c.get(ctx)
+	maxCPU, maxMemoryGB, _, found := getCapabilityMaximums(capabilities, osType, gpu)
+	if !found {
+		return nil, nil
+	}
+	adjustments, err := fitContainerResources(cg.Properties.Containers, maxCPU, maxMemoryGB, policy.cpuGranularity, policy.memoryGranularityGB, true)
+	if err != nil {
+		return nil, errdefs.InvalidInputf("the pod %v per %s container group in region %s", err, osType, c.region)
+	}
+	return adjustments, nil
+}
+
+// checkUsage rejects container groups which would exceed the container group or core quota of the subscription.
+func checkUsage(usage []*azaciv2.Usage, region string, resources containerGroupResources) error {
+	coresUsageName := standardCoresUsageName
+	if resources.gpuCount > 0 {
+		coresUsageName = "Standard" + resources.gpuSKU + "Cores"
+	}
+
+	for _, u := range usage {
+		if u.Name == nil || u.CurrentValue == nil || u.Limit == nil {
+			continue
+		}
+		name := stringValue(u.Name.Value)
+		switch {
+		case strings.EqualFold(name, containerGroupsUsageName):
+			if *u.CurrentValue+1 > *u.Limit {
+				return &quotaError{
+					error:           fmt.Errorf("the container group quota of %d in region %s is exhausted, delete unused container groups or request a quota increase", *u.Limit, region),
+					containerGroups: *u.CurrentValue + 1 - *u.Limit,
+				}
+			}
+		case strings.EqualFold(name, coresUsageName):
+			cores := int32(math.Ceil(resources.cpu))
+			if *u.CurrentValue+cores > *u.Limit {
+				return &quotaError{
+					error: fmt.Errorf("the pod requests %d %s, but only %d of %d are left in region %s, request a quota increase",
+						cores, name, *u.Limit-*u.CurrentValue, *u.Limit, region),
+					cores: *u.CurrentValue + cores - *u.Limit,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Value(f *float32) float64 {
+	if f == nil {
+		return 0
+	}
+	return float64(*f)
+}
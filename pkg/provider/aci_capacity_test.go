@@ -0,0 +1,181 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func newTestCapability(osType, gpu string, maxCPU, maxMemoryGB, maxGPUCount float32) *azaciv2.Capabilities {
+	resourceType := "containerGroups"
+	return &azaciv2.Capabilities{
+		ResourceType: &resourceType,
+		OSType:       &osType,
+		Gpu:          &gpu,
+		Capabilities: &azaciv2.CapabilitiesCapabilities{
+			MaxCPU:        &maxCPU,
+			MaxMemoryInGB: &maxMemoryGB,
+			MaxGpuCount:   &maxGPUCount,
+		},
+	}
+}
+
+func newTestUsage(name string, current, limit int32) *azaciv2.Usage {
+	return &azaciv2.Usage{
+		Name:         &azaciv2.UsageName{Value: &name},
+		CurrentValue: &current,
+		Limit:        &limit,
+	}
+}
+
+func newTestContainerGroup(cpu, memoryGB float64, gpuCount int32, gpuSKU azaciv2.GpuSKU) *azaciv2.ContainerGroup {
+	osType := azaciv2.OperatingSystemTypesLinux
+	requests := &azaciv2.ResourceRequests{CPU: &cpu, MemoryInGB: &memoryGB}
+	if gpuCount > 0 {
+		requests.Gpu = &azaciv2.GpuResource{Count: &gpuCount, SKU: &gpuSKU}
+	}
+	return &azaciv2.ContainerGroup{
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{
+			OSType: &osType,
+			Containers: []*azaciv2.Container{
+				{Properties: &azaciv2.ContainerProperties{Resources: &azaciv2.ResourceRequirements{Requests: requests}}},
+			},
+		},
+	}
+}
+
+func TestCapacityCheck(t *testing.T) {
+	capabilities := []*azaciv2.Capabilities{
+		newTestCapability("Linux", "None", 4, 16, 0),
+		newTestCapability("Windows", "None", 4, 14, 0),
+		newTestCapability("Linux", "V100", 24, 112, 4),
+	}
+	usage := []*azaciv2.Usage{
+		newTestUsage("ContainerGroups", 10, 100),
+		newTestUsage("StandardCores", 6, 10),
+		newTestUsage("StandardV100Cores", 0, 6),
+	}
+
+	cases := []struct {
+		description   string
+		cg            *azaciv2.ContainerGroup
+		capabilities  []*azaciv2.Capabilities
+		usage         []*azaciv2.Usage
+		expectedError string
+		invalidInput  bool
+	}{
+		{
+			description: "container group within capabilities and quota",
+			cg:          newTestContainerGroup(2, 8, 0, ""),
+		},
+		{
+			description:   "too many CPU cores",
+			cg:            newTestContainerGroup(6, 8, 0, ""),
+			expectedError: "the pod requests 6 CPU cores, but ACI allows at most 4 cores per Linux container group",
+			invalidInput:  true,
+		},
+		{
+			description:   "too much memory",
+			cg:            newTestContainerGroup(1, 20, 0, ""),
+			expectedError: "the pod requests 20GB of memory, but ACI allows at most 16GB per Linux container group",
+			invalidInput:  true,
+		},
+		{
+			description:   "unavailable GPU SKU",
+			cg:            newTestContainerGroup(1, 8, 1, azaciv2.GpuSKUK80),
+			expectedError: "ACI doesn't provide K80 GPU enabled Linux container groups",
+			invalidInput:  true,
+		},
+		{
+			description:   "GPU core quota exhausted",
+			cg:            newTestContainerGroup(8, 8, 1, azaciv2.GpuSKUV100),
+			expectedError: "the pod requests 8 StandardV100Cores, but only 6 of 6 are left",
+		},
+		{
+			description:   "core quota exhausted",
+			cg:            newTestContainerGroup(4.5, 8, 0, ""),
+			capabilities:  []*azaciv2.Capabilities{newTestCapability("Linux", "None", 8, 16, 0)},
+			usage:         []*azaciv2.Usage{newTestUsage("StandardCores", 6, 10)},
+			expectedError: "the pod requests 5 StandardCores, but only 4 of 10 are left",
+		},
+		{
+			description:   "container group quota exhausted",
+			cg:            newTestContainerGroup(1, 1, 0, ""),
+			usage:         []*azaciv2.Usage{newTestUsage("ContainerGroups", 100, 100)},
+			expectedError: "the container group quota of 100 in region westus is exhausted",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			aciMocks := createNewACIMock()
+			aciMocks.MockListCapabilities = func(ctx context.Context, region string) ([]*azaciv2.Capabilities, error) {
+				if tc.capabilities != nil {
+					return tc.capabilities, nil
+				}
+				return capabilities, nil
+			}
+			aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+				if tc.usage != nil {
+					return tc.usage, nil
+				}
+				return usage, nil
+			}
+
+			err := newCapacityChecker(aciMocks, "westus").check(context.Background(), tc.cg)
+			if tc.expectedError == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Check(t, is.ErrorContains(err, tc.expectedError))
+			assert.Check(t, is.Equal(tc.invalidInput, errdefs.IsInvalidInput(err)))
+		})
+	}
+}
+
+func TestCapacityCheckWithoutCapabilities(t *testing.T) {
+	listed := 0
+	aciMocks := createNewACIMock()
+	aciMocks.MockListCapabilities = func(ctx context.Context, region string) ([]*azaciv2.Capabilities, error) {
+		listed++
+		return nil, errors.New("location API unavailable")
+	}
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		return []*azaciv2.Usage{newTestUsage("ContainerGroups", 1, 100)}, nil
+	}
+
+	checker := newCapacityChecker(aciMocks, "westus")
+	assert.NilError(t, checker.check(context.Background(), newTestContainerGroup(100, 1000, 0, "")))
+	assert.NilError(t, checker.check(context.Background(), newTestContainerGroup(1, 1, 0, "")))
+	// failed lookups are retried on the next check
+	assert.Check(t, is.Equal(2, listed))
+}
+
+func TestCapacityFitCapabilities(t *testing.T) {
+	aciMocks := createNewACIMock()
+	aciMocks.MockListCapabilities = func(ctx context.Context, region string) ([]*azaciv2.Capabilities, error) {
+		return []*azaciv2.Capabilities{newTestCapability("Linux", "None", 4, 16, 0)}, nil
+	}
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		return nil, nil
+	}
+	checker := newCapacityChecker(aciMocks, "westus")
+	policy := resourcePolicy{cpuGranularity: 0.01, memoryGranularityGB: 0.1}
+
+	cg := newTestContainerGroup(8, 8, 0, "")
+	adjustments, err := checker.fitCapabilities(context.Background(), cg, policy)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(adjustments, 1))
+	assert.Check(t, is.Equal(4.0, *cg.Properties.Containers[0].Properties.Resources.Requests.CPU))
+	assert.Check(t, is.Equal(8.0, *cg.Properties.Containers[0].Properties.Resources.Requests.MemoryInGB))
+	assert.NilError(t, checker.check(context.Background(), cg))
+}
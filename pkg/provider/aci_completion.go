@@ -0,0 +1,204 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// completedPodCleanupInterval is the interval between two deletions of the expired completed container groups.
+	completedPodCleanupInterval = time.Minute
+	// maxCompletedPodLogArchiveAttempts is the number of cleanups the container group of a completed pod is kept
+	// for while its logs fail to be archived, so that the container groups whose logs can't be read are reaped.
+	maxCompletedPodLogArchiveAttempts = 10
+
+	// eventReasonCompletedDeleted is the reason of the event emitted when the container group of a completed pod
+	// is deleted.
+	eventReasonCompletedDeleted = "CompletedContainerGroupDeleted"
+	// eventReasonLogsNotArchived is the reason of the event emitted when the container group of a completed pod is
+	// deleted without its logs being archived.
+	eventReasonLogsNotArchived = "LogsNotArchived"
+)
+
+// getCompletedPodPhase returns the phase of a pod whose container group doesn't restart its containers once they
+// all terminated, as ACI may keep reporting the container group as running for a while. With the Never restart
+// policy, the pod fails when a container failed, with OnFailure the failed containers are restarted so the pod
+// only completes when all of them succeeded. Otherwise the phase of the container group is kept.
+func getCompletedPodPhase(restartPolicy *azaciv2.ContainerGroupRestartPolicy, phase v1.PodPhase, statuses []v1.ContainerStatus) v1.PodPhase {
+	if restartPolicy == nil || *restartPolicy == azaciv2.ContainerGroupRestartPolicyAlways || len(statuses) == 0 ||
+		(phase != v1.PodRunning && phase != v1.PodPending) {
+		return phase
+	}
+
+	succeeded := true
+	for _, status := range statuses {
+		if status.State.Terminated == nil {
+			return phase
+		}
+		succeeded = succeeded && isSucceeded(status.State)
+	}
+	if succeeded {
+		return v1.PodSucceeded
+	}
+	if *restartPolicy == azaciv2.ContainerGroupRestartPolicyNever {
+		return v1.PodFailed
+	}
+	return phase
+}
+
+// completedPodCleanup remembers the completed pods whose container group was deleted, not to delete it again,
+// when the cleanup first saw the completed pods without terminated containers, e.g. the pods whose container
+// group failed to start, and how many times the logs of the completed pods failed to be archived.
+type completedPodCleanup struct {
+	lock            sync.Mutex
+	deleted         map[types.UID]bool
+	terminalSince   map[types.UID]time.Time
+	archiveAttempts map[types.UID]int
+}
+
+func newCompletedPodCleanup() *completedPodCleanup {
+	return &completedPodCleanup{
+		deleted:         make(map[types.UID]bool),
+		terminalSince:   make(map[types.UID]time.Time),
+		archiveAttempts: make(map[types.UID]int),
+	}
+}
+
+// StartCompletedPodCleanup deletes the container groups of the succeeded and failed pods once they completed for
+// the configured retention, so that they stop holding ACI quota while their pods are kept, e.g. by the Jobs.
+// The status of the pods is kept, but their logs can't be read from ACI anymore, so the container groups are only
+// deleted once their logs are archived when a log archive is configured, or after maxCompletedPodLogArchiveAttempts
+// failed attempts.
+func (p *ACIProvider) StartCompletedPodCleanup(ctx context.Context) {
+	if p.completedPodRetention <= 0 {
+		return
+	}
+	p.completedPodCleanup = newCompletedPodCleanup()
+
+	go func() {
+		timer := time.NewTimer(completedPodCleanupInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			p.cleanupCompletedPods(ctx, time.Now())
+			timer.Reset(completedPodCleanupInterval)
+		}
+	}()
+}
+
+// cleanupCompletedPods deletes the container groups of the pods which completed for longer than the retention.
+func (p *ACIProvider) cleanupCompletedPods(ctx context.Context, now time.Time) {
+	ctx, span := trace.StartSpan(ctx, "aci.cleanupCompletedPods")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	if !p.isLeading() {
+		return
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to list the pods to clean up the completed ones")
+		return
+	}
+
+	c := p.completedPodCleanup
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	existing := make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		existing[pod.UID] = true
+		if c.deleted[pod.UID] || pod.DeletionTimestamp != nil || isActivePod(pod) {
+			continue
+		}
+		completed, ok := getPodCompletionTime(pod)
+		if !ok {
+			if _, seen := c.terminalSince[pod.UID]; !seen {
+				c.terminalSince[pod.UID] = now
+			}
+			completed = c.terminalSince[pod.UID]
+		}
+		if now.Sub(completed) < p.completedPodRetention {
+			continue
+		}
+
+		if !p.archivePodLogsBeforeDeletion(ctx, pod) {
+			c.archiveAttempts[pod.UID]++
+			if c.archiveAttempts[pod.UID] < maxCompletedPodLogArchiveAttempts {
+				log.G(ctx).Warnf("keeping the container group of completed pod %s/%s until its logs are archived", pod.Namespace, pod.Name)
+				continue
+			}
+			log.G(ctx).Warnf("deleting the container group of completed pod %s/%s without archiving its logs after %d attempts",
+				pod.Namespace, pod.Name, c.archiveAttempts[pod.UID])
+			if p.eventRecorder != nil {
+				p.eventRecorder.Eventf(pod, v1.EventTypeWarning, eventReasonLogsNotArchived,
+					"the logs couldn't be archived after %d attempts, they are lost with the container group", c.archiveAttempts[pod.UID])
+			}
+		}
+		cgName := containerGroupName(pod.Namespace, pod.Name)
+		p.announceDisruption(ctx, pod, fmt.Sprintf("deleting the container group: completed for more than %s", p.completedPodRetention))
+		release, err := p.deleteQueue.acquire(ctx, pod.Namespace, getPodPriority(pod))
+		if err != nil {
+			return
+		}
+		err = p.deletePodContainerGroup(ctx, pod, false)
+		release()
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to delete the container group of completed pod %s/%s", pod.Namespace, pod.Name)
+			continue
+		}
+		log.G(ctx).Infof("deleted the container group of pod %s/%s, completed at %s", pod.Namespace, pod.Name, completed)
+		if p.eventRecorder != nil {
+			p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonCompletedDeleted,
+				"deleted container group %s, completed for more than %s", cgName, p.completedPodRetention)
+		}
+		c.deleted[pod.UID] = true
+		delete(c.terminalSince, pod.UID)
+		delete(c.archiveAttempts, pod.UID)
+	}
+
+	for uid := range c.deleted {
+		if !existing[uid] {
+			delete(c.deleted, uid)
+		}
+	}
+	for uid := range c.terminalSince {
+		if !existing[uid] {
+			delete(c.terminalSince, uid)
+		}
+	}
+	for uid := range c.archiveAttempts {
+		if !existing[uid] {
+			delete(c.archiveAttempts, uid)
+		}
+	}
+}
+
+// getPodCompletionTime returns when the last container of a completed pod terminated.
+func getPodCompletionTime(pod *v1.Pod) (time.Time, bool) {
+	var completed time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.FinishedAt.Time.After(completed) {
+			completed = terminated.FinishedAt.Time
+		}
+	}
+	return completed, !completed.IsZero()
+}
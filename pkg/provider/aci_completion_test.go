@@ -0,0 +1,199 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetCompletedPodPhase(t *testing.T) {
+	running := v1.ContainerStatus{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}
+	succeeded := v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}}
+	failed := v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1}}}
+	always := azaciv2.ContainerGroupRestartPolicyAlways
+	onFailure := azaciv2.ContainerGroupRestartPolicyOnFailure
+	never := azaciv2.ContainerGroupRestartPolicyNever
+
+	cases := []struct {
+		description   string
+		restartPolicy *azaciv2.ContainerGroupRestartPolicy
+		phase         v1.PodPhase
+		statuses      []v1.ContainerStatus
+		expectedPhase v1.PodPhase
+	}{
+		{
+			description:   "containers restarted always",
+			restartPolicy: &always,
+			phase:         v1.PodRunning,
+			statuses:      []v1.ContainerStatus{succeeded},
+			expectedPhase: v1.PodRunning,
+		},
+		{
+			description:   "container still running",
+			restartPolicy: &never,
+			phase:         v1.PodRunning,
+			statuses:      []v1.ContainerStatus{succeeded, running},
+			expectedPhase: v1.PodRunning,
+		},
+		{
+			description:   "all containers succeeded",
+			restartPolicy: &onFailure,
+			phase:         v1.PodRunning,
+			statuses:      []v1.ContainerStatus{succeeded, succeeded},
+			expectedPhase: v1.PodSucceeded,
+		},
+		{
+			description:   "failed container restarted on failure",
+			restartPolicy: &onFailure,
+			phase:         v1.PodRunning,
+			statuses:      []v1.ContainerStatus{succeeded, failed},
+			expectedPhase: v1.PodRunning,
+		},
+		{
+			description:   "failed container never restarted",
+			restartPolicy: &never,
+			phase:         v1.PodRunning,
+			statuses:      []v1.ContainerStatus{succeeded, failed},
+			expectedPhase: v1.PodFailed,
+		},
+		{
+			description:   "container group already completed",
+			restartPolicy: &never,
+			phase:         v1.PodSucceeded,
+			statuses:      []v1.ContainerStatus{failed},
+			expectedPhase: v1.PodSucceeded,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Check(t, is.Equal(tc.expectedPhase, getCompletedPodPhase(tc.restartPolicy, tc.phase, tc.statuses)))
+		})
+	}
+}
+
+func TestCleanupCompletedPods(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Now()
+	terminated := func(finishedAt time.Time) []v1.ContainerStatus {
+		return []v1.ContainerStatus{{State: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(finishedAt)},
+		}}}
+	}
+	pods := testsutil.CreatePodsList([]string{"expired", "recent", "running", "not-started"}, "ns")
+	for i, pod := range pods {
+		pod.UID = types.UID(pod.Name)
+		pod.Status.Phase = v1.PodSucceeded
+		pod.Status.ContainerStatuses = terminated(now.Add(-time.Duration(2-i) * time.Hour))
+	}
+	pods[2].Status.Phase = v1.PodRunning
+	pods[2].Status.ContainerStatuses = terminated(now.Add(-2 * time.Hour))
+	// the retention of the pods without terminated containers starts when the cleanup first sees them
+	pods[3].Status.Phase = v1.PodFailed
+	pods[3].Status.ContainerStatuses = nil
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+	var deleted []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = append(deleted, cgName)
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	provider.completedPodRetention = 90 * time.Minute
+	provider.completedPodCleanup = newCompletedPodCleanup()
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	provider.cleanupCompletedPods(context.Background(), now)
+	assert.Check(t, is.DeepEqual([]string{containerGroupName("ns", "expired")}, deleted))
+	// the deletion is announced beforehand
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonDisruptionTarget))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonCompletedDeleted))
+
+	// the container groups are deleted once
+	provider.cleanupCompletedPods(context.Background(), now.Add(2*time.Hour))
+	assert.Check(t, is.DeepEqual([]string{
+		containerGroupName("ns", "expired"),
+		containerGroupName("ns", "recent"),
+		containerGroupName("ns", "not-started"),
+	}, deleted))
+}
+
+func TestCleanupCompletedPodsLogArchive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Now()
+	pods := testsutil.CreatePodsList([]string{"never-started", "unreadable"}, "ns")
+	for _, pod := range pods {
+		pod.UID = types.UID(pod.Name)
+		pod.Status.Phase = v1.PodFailed
+	}
+	// the container group failed to start, its containers have no logs
+	pods[0].Status.ContainerStatuses = []v1.ContainerStatus{{Name: "c", State: v1.ContainerState{
+		Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"},
+	}}}
+	pods[1].Status.ContainerStatuses = []v1.ContainerStatus{{Name: "c", State: v1.ContainerState{
+		Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(now.Add(-2 * time.Hour))},
+	}}}
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+	var deleted []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = append(deleted, cgName)
+		return nil
+	}
+	aciMocks.MockListLogs = func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
+		assert.Check(t, is.Equal(containerGroupName("ns", "unreadable"), cgName))
+		return nil, errors.New("internal server error")
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	provider.completedPodRetention = time.Hour
+	provider.completedPodCleanup = newCompletedPodCleanup()
+	provider.logArchiver = &blobLogArchiver{prefix: "node"}
+
+	provider.cleanupCompletedPods(context.Background(), now)
+	provider.cleanupCompletedPods(context.Background(), now.Add(2*time.Hour))
+	assert.Check(t, is.DeepEqual([]string{containerGroupName("ns", "never-started")}, deleted))
+
+	// the container groups whose logs keep failing to be archived are eventually deleted
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+	// the unreadable logs failed to be archived twice so far
+	for i := 3; i < maxCompletedPodLogArchiveAttempts; i++ {
+		provider.cleanupCompletedPods(context.Background(), now.Add(2*time.Hour))
+	}
+	assert.Check(t, is.Len(deleted, 1))
+	provider.cleanupCompletedPods(context.Background(), now.Add(2*time.Hour))
+	assert.Check(t, is.DeepEqual([]string{containerGroupName("ns", "never-started"), containerGroupName("ns", "unreadable")}, deleted))
+	assert.Assert(t, is.Len(recorder.Events, 3))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonLogsNotArchived))
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+const (
+	// defaultCPURequest and defaultMemoryRequestGB are requested by the containers without requests, unless configured.
+	defaultCPURequest      = 1.00
+	defaultMemoryRequestGB = 1.50
+
+	// defaultPodStatusMinInterval is the minimum time between two status fetches of the same pod, unless configured.
+	defaultPodStatusMinInterval = 5 * time.Second
+)
+
+// setupReloadableSettings reads the environment variables of the settings which are reloaded at runtime, which
+// take precedence over the config file.
+func (p *ACIProvider) setupReloadableSettings() error {
+	if interval := os.Getenv("ACI_POD_STATUS_MIN_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_POD_STATUS_MIN_INTERVAL: %v", err)
+		}
+		p.podStatusMinInterval = d
+	}
+	// the default is set here rather than when loading the config file, so that a reloaded file without the
+	// setting restores it
+	if p.podStatusMinInterval <= 0 {
+		p.podStatusMinInterval = defaultPodStatusMinInterval
+	}
+
+	if interval := os.Getenv("ACI_CAPACITY_REFRESH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_CAPACITY_REFRESH_INTERVAL: %v", err)
+		}
+		p.capacityRefreshInterval = d
+	}
+
+	if dryRun := os.Getenv("ACI_DRY_RUN"); dryRun != "" {
+		enabled, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_DRY_RUN: %v", err)
+		}
+		p.dryRun = enabled
+	}
+
+	return p.setupPodTags()
+}
+
+// WatchConfig reloads the settings of the config file which can be changed at runtime whenever the file changes,
+// until the context is done. The other settings, like the region or the capacity of the node, require a restart.
+func (p *ACIProvider) WatchConfig(ctx context.Context, path string) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// the directory is watched rather than the file, as a config file mounted from a ConfigMap is replaced
+	// through a symlink swap on update
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-watcher.Errors:
+				log.G(ctx).WithError(err).Warn("error watching the provider config file")
+			case <-watcher.Events:
+				data, err := os.ReadFile(path)
+				if err != nil {
+					log.G(ctx).WithError(err).Warn("unable to read the provider config file")
+					continue
+				}
+				if bytes.Equal(data, current) {
+					continue
+				}
+				current = data
+				if err := p.reloadConfig(ctx, data); err != nil {
+					log.G(ctx).WithError(err).Error("invalid provider config file, keeping the current settings")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadConfig applies the reloadable settings of a config file, once all of them are validated. The pods already
+// tracked are not affected, besides the rate at which their status is fetched.
+func (p *ACIProvider) reloadConfig(ctx context.Context, data []byte) error {
+	var next ACIProvider
+	if err := next.loadConfig(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err := next.setupReloadableSettings(); err != nil {
+		return err
+	}
+
+	p.settingsLock.Lock()
+	p.podTagAnnotationPrefix = next.podTagAnnotationPrefix
+	p.podTagLabels = next.podTagLabels
+	p.podDefaults = next.podDefaults
+	p.hostPathMappings = next.hostPathMappings
+	p.volumeSourceChangePolicy = next.volumeSourceChangePolicy
+	p.dryRun = next.dryRun
+	p.hostNetworkWarnOnly = next.hostNetworkWarnOnly
+	p.preemptLowerPriorityPods = next.preemptLowerPriorityPods
+	p.drainBatchSize = next.drainBatchSize
+	p.requireTaintToleration = next.requireTaintToleration
+	p.requiredNodeSelector = next.requiredNodeSelector
+	p.defaultCPURequest = next.defaultCPURequest
+	p.defaultMemoryRequest = next.defaultMemoryRequest
+	p.cpuRequestGranularity = next.cpuRequestGranularity
+	p.memoryRequestGranularity = next.memoryRequestGranularity
+	p.maxPodCPU = next.maxPodCPU
+	p.maxPodMemory = next.maxPodMemory
+	p.podResourcesPolicy = next.podResourcesPolicy
+	p.capacityRefreshInterval = next.capacityRefreshInterval
+	p.podStatusMinInterval = next.podStatusMinInterval
+	p.settingsLock.Unlock()
+
+	if p.tracker != nil {
+		p.tracker.setMinPodUpdateInterval(next.podStatusMinInterval)
+	}
+
+	log.G(ctx).Info("reloaded the provider config")
+	return nil
+}
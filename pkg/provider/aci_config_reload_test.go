@@ -0,0 +1,93 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestReloadConfig(t *testing.T) {
+	ctx := context.Background()
+	p := ACIProvider{
+		region:        "westus",
+		resourceGroup: "virtual-kubeletrg",
+		tracker:       &PodsTracker{},
+	}
+
+	assert.NilError(t, p.reloadConfig(ctx, []byte(`
+Region = "eastus"
+PodTagLabels = ["app=application"]
+DryRun = true
+DefaultCPURequest = 0.5
+DefaultMemoryRequestGB = 2.0
+CapacityRefreshInterval = "1m"
+PodStatusMinInterval = "10s"`)))
+
+	// settings requiring a restart are kept
+	assert.Check(t, is.Equal("westus", p.region))
+	assert.Assert(t, is.Len(p.podTagLabels, 1))
+	assert.Check(t, p.podTagLabels[0] == podTagLabel{label: "app", tag: "application"})
+	assert.Check(t, p.dryRun)
+	assert.Check(t, is.Equal(time.Minute, p.getCapacityRefreshInterval()))
+	assert.Check(t, is.Equal(10*time.Second, p.tracker.minPodUpdateInterval))
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].Resources.Requests = nil
+	containers, err := p.getContainers(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(0.5, *containers[0].Properties.Resources.Requests.CPU))
+	assert.Check(t, is.Equal(2.0, *containers[0].Properties.Resources.Requests.MemoryInGB))
+
+	// an invalid config keeps all the current settings
+	err = p.reloadConfig(ctx, []byte(`
+DryRun = false
+PodStatusMinInterval = "soon"`))
+	assert.Check(t, is.ErrorContains(err, "error parsing pod status min interval"))
+	assert.Check(t, p.dryRun)
+	assert.Check(t, is.Equal(10*time.Second, p.tracker.minPodUpdateInterval))
+
+	// the settings removed from the config are back to their defaults
+	assert.NilError(t, p.reloadConfig(ctx, []byte(`DryRun = true`)))
+	assert.Check(t, is.Equal(defaultPodStatusMinInterval, p.tracker.minPodUpdateInterval))
+	assert.Check(t, is.Equal(defaultCapacityRefreshInterval, p.getCapacityRefreshInterval()))
+	containers, err = p.getContainers(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(defaultCPURequest, *containers[0].Properties.Resources.Requests.CPU))
+	assert.Check(t, is.Equal(defaultMemoryRequestGB, *containers[0].Properties.Resources.Requests.MemoryInGB))
+}
+
+func TestWatchConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "provider.toml")
+	assert.NilError(t, os.WriteFile(path, []byte(`DryRun = false`), 0600))
+
+	var p ACIProvider
+	assert.NilError(t, p.WatchConfig(ctx, path))
+	assert.NilError(t, os.WriteFile(path, []byte(`DryRun = true`), 0600))
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dryRun, err := p.isDryRun(pod)
+		assert.NilError(t, err)
+		if dryRun {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the config was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
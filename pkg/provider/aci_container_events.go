@@ -0,0 +1,141 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// containerGroupEventMirror emits the events ACI records on container groups and their containers, e.g. Pulling,
+// Started or Killing, as events on their pods. An ACI event is mirrored again when ACI updates its last timestamp.
+type containerGroupEventMirror struct {
+	lock sync.Mutex
+	// since skips the events recorded before the provider started, which were mirrored by a previous instance.
+	since time.Time
+	// lastMirrored is the last timestamp of the events mirrored for the container group, with no container, and
+	// each container of a pod.
+	lastMirrored map[containerLogKey]time.Time
+	// lastPullProgress is when the pull in progress of the image of each container was last reported.
+	lastPullProgress map[containerLogKey]time.Time
+}
+
+func newContainerGroupEventMirror(since time.Time) *containerGroupEventMirror {
+	return &containerGroupEventMirror{
+		since:            since,
+		lastMirrored:     map[containerLogKey]time.Time{},
+		lastPullProgress: map[containerLogKey]time.Time{},
+	}
+}
+
+// newEvents returns the events of a container of a pod, or of its container group when container is empty, which
+// weren't mirrored yet, sorted by their last timestamp.
+func (m *containerGroupEventMirror) newEvents(key containerLogKey, events []*azaciv2.Event) []*azaciv2.Event {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	last, ok := m.lastMirrored[key]
+	if !ok {
+		last = m.since
+	}
+	var result []*azaciv2.Event
+	latest := last
+	for _, event := range events {
+		if event == nil || event.LastTimestamp == nil || !event.LastTimestamp.After(last) {
+			continue
+		}
+		result = append(result, event)
+		if event.LastTimestamp.After(latest) {
+			latest = *event.LastTimestamp
+		}
+	}
+	m.lastMirrored[key] = latest
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastTimestamp.Before(*result[j].LastTimestamp)
+	})
+	return result
+}
+
+// deletePod forgets the events mirrored for a pod.
+func (m *containerGroupEventMirror) deletePod(namespace, pod string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key := range m.lastMirrored {
+		if key.namespace == namespace && key.pod == pod {
+			delete(m.lastMirrored, key)
+		}
+	}
+	for key := range m.lastPullProgress {
+		if key.namespace == namespace && key.pod == pod {
+			delete(m.lastPullProgress, key)
+		}
+	}
+}
+
+// mirrorContainerGroupEvents emits the new ACI events of a container group and its containers on its pod, and
+// reports the image pulls in progress.
+func (p *ACIProvider) mirrorContainerGroupEvents(namespace, name string, cg *azaciv2.ContainerGroup) {
+	if p.eventRecorder == nil || p.containerGroupEvents == nil || cg.Properties == nil || !p.isLeading() {
+		return
+	}
+	ref := &v1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  namespace,
+		Name:       name,
+		UID:        types.UID(stringValue(cg.Tags["UID"])),
+	}
+
+	if cg.Properties.InstanceView != nil {
+		p.mirrorEvents(ref, "", "", cg.Properties.InstanceView.Events)
+	}
+	now := time.Now()
+	for _, container := range cg.Properties.InitContainers {
+		if container.Name != nil && container.Properties != nil && container.Properties.InstanceView != nil {
+			fieldPath := fmt.Sprintf("spec.initContainers{%s}", *container.Name)
+			p.mirrorEvents(ref, *container.Name, fieldPath, container.Properties.InstanceView.Events)
+			p.reportContainerImagePullProgress(ref, *container.Name, fieldPath, stringValue(container.Properties.Image),
+				container.Properties.InstanceView.Events, now)
+		}
+	}
+	for _, container := range cg.Properties.Containers {
+		if container.Name != nil && container.Properties != nil && container.Properties.InstanceView != nil {
+			fieldPath := fmt.Sprintf("spec.containers{%s}", *container.Name)
+			p.mirrorEvents(ref, *container.Name, fieldPath, container.Properties.InstanceView.Events)
+			p.reportContainerImagePullProgress(ref, *container.Name, fieldPath, stringValue(container.Properties.Image),
+				container.Properties.InstanceView.Events, now)
+		}
+	}
+}
+
+func (p *ACIProvider) mirrorEvents(pod *v1.ObjectReference, container, fieldPath string, events []*azaciv2.Event) {
+	key := containerLogKey{namespace: pod.Namespace, pod: pod.Name, container: container}
+	for _, event := range p.containerGroupEvents.newEvents(key, events) {
+		ref := *pod
+		ref.FieldPath = fieldPath
+		eventType := v1.EventTypeNormal
+		if stringValue(event.Type) == v1.EventTypeWarning {
+			eventType = v1.EventTypeWarning
+		}
+		p.eventRecorder.Event(&ref, eventType, stringValue(event.Name), getImagePullEventMessage(eventType, stringValue(event.Message)))
+	}
+}
+
+func (p *ACIProvider) reportContainerImagePullProgress(pod *v1.ObjectReference, container, fieldPath, image string, events []*azaciv2.Event, now time.Time) {
+	ref := *pod
+	ref.FieldPath = fieldPath
+	key := containerLogKey{namespace: pod.Namespace, pod: pod.Name, container: container}
+	p.reportImagePullProgress(&ref, key, image, events, now)
+}
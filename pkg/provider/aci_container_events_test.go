@@ -0,0 +1,61 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestMirrorContainerGroupEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podName, podNamespace := "pod", "ns"
+	start := time.Now()
+	event := func(name, eventType, message string, at time.Time) *azaciv2.Event {
+		return &azaciv2.Event{Name: &name, Type: &eventType, Message: &message, LastTimestamp: &at}
+	}
+	events := []*azaciv2.Event{
+		event("Started", "Normal", "Started container", start.Add(2*time.Second)),
+		event("Pulled", "Normal", "Successfully pulled image", start.Add(time.Second)),
+		event("Pulling", "Normal", "pulling image", start.Add(-time.Minute)),
+	}
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		containers := testsutil.CreateACIContainersListObj("Running", "Initializing",
+			testsutil.CgCreationTime.Add(time.Second*2), testsutil.CgCreationTime.Add(time.Second*3), false, false, false)
+		containers[0].Properties.InstanceView.Events = events
+		return testsutil.CreateContainerGroupObj(podName, podNamespace, "Running", containers, "Succeeded"), nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	provider.containerGroupEvents = newContainerGroupEventMirror(start)
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	_, err = provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+	// the events recorded before the provider started are skipped
+	assert.Check(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Equal("Normal Pulled Successfully pulled image", <-recorder.Events))
+	assert.Check(t, is.Equal("Normal Started Started container", <-recorder.Events))
+
+	// the events are mirrored once
+	events = append(events, event("Killing", "Warning", "Killing container", start.Add(3*time.Second)))
+	_, err = provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Equal("Warning Killing Killing container", <-recorder.Events))
+}
@@ -0,0 +1,209 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/gorilla/mux"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// exportContainerGroupAnnotation writes the container group generated for a pod to a config map next to the
+	// pod when set to "true", see getContainerGroupExportName.
+	exportContainerGroupAnnotation = "virtual-kubelet.io/export-container-group"
+	// containerGroupExportKey is the key of the container group JSON in the export config maps.
+	containerGroupExportKey    = "containerGroup.json"
+	containerGroupExportSuffix = "-container-group"
+	// redactedValue replaces the secrets of the exported container groups.
+	redactedValue = "REDACTED"
+)
+
+// SetConfigMapClient sets the client writing the container groups exported with the export annotation.
+func (p *ACIProvider) SetConfigMapClient(client corev1client.ConfigMapsGetter) {
+	p.configMapClient = client
+}
+
+// isContainerGroupExported returns whether the container group of a pod is exported to a config map.
+func isContainerGroupExported(pod *v1.Pod) (bool, error) {
+	value, ok := pod.Annotations[exportContainerGroupAnnotation]
+	if !ok {
+		return false, nil
+	}
+	exported, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.InvalidInputf("the value %q of annotation %s is not a boolean", value, exportContainerGroupAnnotation)
+	}
+	return exported, nil
+}
+
+// getContainerGroupExportName returns the name of the config map the container group of a pod is exported to.
+func getContainerGroupExportName(podName string) string {
+	if len(podName)+len(containerGroupExportSuffix) > 253 {
+		podName = podName[:253-len(containerGroupExportSuffix)]
+	}
+	return podName + containerGroupExportSuffix
+}
+
+// recordContainerGroup keeps the container group generated for a pod, without its secrets, for the container
+// group endpoint, and writes it to the export config map of the pod when it asks for it. Exporting doesn't fail the
+// pod.
+func (p *ACIProvider) recordContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	data, err := getRedactedContainerGroupJSON(cg)
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("unable to encode the container group of pod %s", pod.Name)
+		return
+	}
+	p.containerGroupSpecs.Store(pod.Namespace+"/"+pod.Name, data)
+
+	if exported, _ := isContainerGroupExported(pod); !exported || p.configMapClient == nil {
+		return
+	}
+	if err := p.exportContainerGroup(ctx, pod, data); err != nil {
+		log.G(ctx).WithError(err).Warnf("unable to export the container group of pod %s", pod.Name)
+	}
+}
+
+// exportContainerGroup creates or updates the export config map of a pod, owned by the pod so that it is deleted
+// with it.
+func (p *ACIProvider) exportContainerGroup(ctx context.Context, pod *v1.Pod, data []byte) error {
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getContainerGroupExportName(pod.Name),
+			Namespace: pod.Namespace,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+			}},
+		},
+		Data: map[string]string{containerGroupExportKey: string(data)},
+	}
+	configMaps := p.configMapClient.ConfigMaps(pod.Namespace)
+	_, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// getRedactedContainerGroupJSON returns the JSON of a container group as sent to ARM, with the secure environment
+// variables, the files of the secret volumes and the keys and passwords replaced. The $(VAR) references of the
+// commands and of the other variables are expanded with the values of the secure variables too, so the command
+// arguments, probe commands and variables of a container containing one of its secure values are replaced as well.
+func getRedactedContainerGroupJSON(cg *azaciv2.ContainerGroup) ([]byte, error) {
+	data, err := json.Marshal(cg)
+	if err != nil {
+		return nil, err
+	}
+	var redacted azaciv2.ContainerGroup
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return nil, err
+	}
+
+	redact := func(value *string) *string {
+		if value == nil {
+			return nil
+		}
+		return stringPtr(redactedValue)
+	}
+	redactContainer := func(env []*azaciv2.EnvironmentVariable, commands ...[]*string) {
+		var secrets []string
+		for _, variable := range env {
+			if value := stringValue(variable.SecureValue); value != "" {
+				secrets = append(secrets, value)
+			}
+		}
+		redactExpanded := func(value *string) *string {
+			for _, secret := range secrets {
+				if value != nil && strings.Contains(*value, secret) {
+					return stringPtr(redactedValue)
+				}
+			}
+			return value
+		}
+		for _, command := range commands {
+			for i := range command {
+				command[i] = redactExpanded(command[i])
+			}
+		}
+		for _, variable := range env {
+			variable.Value = redactExpanded(variable.Value)
+			variable.SecureValue = redact(variable.SecureValue)
+		}
+	}
+	if properties := redacted.Properties; properties != nil {
+		for _, container := range properties.Containers {
+			if container.Properties != nil {
+				var probeCommands [][]*string
+				for _, probe := range []*azaciv2.ContainerProbe{container.Properties.LivenessProbe, container.Properties.ReadinessProbe} {
+					if probe != nil && probe.Exec != nil {
+						probeCommands = append(probeCommands, probe.Exec.Command)
+					}
+				}
+				redactContainer(container.Properties.EnvironmentVariables, append(probeCommands, container.Properties.Command)...)
+			}
+		}
+		for _, container := range properties.InitContainers {
+			if container.Properties != nil {
+				redactContainer(container.Properties.EnvironmentVariables, container.Properties.Command)
+			}
+		}
+		for _, cred := range properties.ImageRegistryCredentials {
+			cred.Password = redact(cred.Password)
+		}
+		for _, volume := range properties.Volumes {
+			for name, content := range volume.Secret {
+				volume.Secret[name] = redact(content)
+			}
+			if volume.AzureFile != nil {
+				volume.AzureFile.StorageAccountKey = redact(volume.AzureFile.StorageAccountKey)
+			}
+		}
+		if properties.Diagnostics != nil && properties.Diagnostics.LogAnalytics != nil {
+			properties.Diagnostics.LogAnalytics.WorkspaceKey = redact(properties.Diagnostics.LogAnalytics.WorkspaceKey)
+		}
+		for _, extension := range properties.Extensions {
+			if extension.Properties != nil && extension.Properties.ProtectedSettings != nil {
+				extension.Properties.ProtectedSettings = redactedValue
+			}
+		}
+	}
+	return json.MarshalIndent(&redacted, "", "  ")
+}
+
+// ContainerGroupHandler serves the container group last generated for a pod by the provider, without its secrets,
+// at /containergroups/{namespace}/{pod}, to debug the translation of the pods.
+func (p *ACIProvider) ContainerGroupHandler() http.Handler {
+	r := mux.NewRouter()
+	r.StrictSlash(true)
+	r.HandleFunc("/containergroups/{namespace}/{pod}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		data, ok := p.containerGroupSpecs.Load(vars["namespace"] + "/" + vars["pod"])
+		if !ok {
+			http.Error(w, "no container group was generated for this pod since the provider started", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(data.([]byte)); err != nil {
+			log.G(r.Context()).WithError(err).Error("failed to write the container group")
+		}
+	}).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(api.NotFound)
+	return r
+}
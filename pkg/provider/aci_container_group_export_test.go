@@ -0,0 +1,120 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newExportTestContainerGroup() *azaciv2.ContainerGroup {
+	name := "ns-pod"
+	return &azaciv2.ContainerGroup{
+		Name: &name,
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{
+			Containers: []*azaciv2.Container{{
+				Name: stringPtr("app"),
+				Properties: &azaciv2.ContainerProperties{
+					Image: stringPtr("nginx"),
+					// expanded from $(TOKEN)
+					Command: []*string{stringPtr("nginx"), stringPtr("--token=s3cr3t-token")},
+					EnvironmentVariables: []*azaciv2.EnvironmentVariable{
+						{Name: stringPtr("MODE"), Value: stringPtr("debug")},
+						{Name: stringPtr("TOKEN"), SecureValue: stringPtr("s3cr3t-token")},
+						{Name: stringPtr("HEADER"), Value: stringPtr("Bearer s3cr3t-token")},
+					},
+					LivenessProbe: &azaciv2.ContainerProbe{Exec: &azaciv2.ContainerExec{
+						Command: []*string{stringPtr("check"), stringPtr("s3cr3t-token")},
+					}},
+				},
+			}},
+			ImageRegistryCredentials: []*azaciv2.ImageRegistryCredential{
+				{Server: stringPtr("example.azurecr.io"), Username: stringPtr("user"), Password: stringPtr("s3cr3t-password")},
+			},
+			Volumes: []*azaciv2.Volume{
+				{Name: stringPtr("config"), Secret: map[string]*string{"app.conf": stringPtr("czNjcjN0LWZpbGU=")}},
+				{Name: stringPtr("share"), AzureFile: &azaciv2.AzureFileVolume{
+					ShareName: stringPtr("share"), StorageAccountName: stringPtr("account"), StorageAccountKey: stringPtr("s3cr3t-key"),
+				}},
+			},
+		},
+	}
+}
+
+func TestGetRedactedContainerGroupJSON(t *testing.T) {
+	cg := newExportTestContainerGroup()
+	data, err := getRedactedContainerGroupJSON(cg)
+	assert.NilError(t, err)
+
+	exported := string(data)
+	assert.Check(t, !strings.Contains(exported, "s3cr3t"), exported)
+	assert.Check(t, is.Contains(exported, `"value": "debug"`))
+	var redacted azaciv2.ContainerGroup
+	assert.NilError(t, json.Unmarshal(data, &redacted))
+	properties := redacted.Properties.Containers[0].Properties
+	assert.Check(t, is.DeepEqual([]*string{stringPtr("nginx"), stringPtr(redactedValue)}, properties.Command),
+		"only the arguments expanded with a secret are redacted")
+	assert.Check(t, is.DeepEqual([]*string{stringPtr("check"), stringPtr(redactedValue)}, properties.LivenessProbe.Exec.Command))
+	assert.Check(t, is.Equal(redactedValue, stringValue(properties.EnvironmentVariables[2].Value)))
+	assert.Check(t, is.Contains(exported, `"app.conf": "REDACTED"`))
+	assert.Check(t, is.Contains(exported, `"username": "user"`))
+	// the container group itself is left alone
+	assert.Check(t, is.Equal("s3cr3t-token", *cg.Properties.Containers[0].Properties.EnvironmentVariables[1].SecureValue))
+}
+
+func TestRecordContainerGroup(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	p := ACIProvider{}
+	p.SetConfigMapClient(client.CoreV1())
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.UID = "pod-uid"
+	p.recordContainerGroup(context.Background(), pod, newExportTestContainerGroup())
+
+	// the container group is served by the endpoint
+	handler := p.ContainerGroupHandler()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/containergroups/ns/pod", nil))
+	assert.Check(t, is.Equal(http.StatusOK, recorder.Code))
+	assert.Check(t, is.Contains(recorder.Body.String(), `"name": "ns-pod"`))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/containergroups/ns/other", nil))
+	assert.Check(t, is.Equal(http.StatusNotFound, recorder.Code))
+
+	// but only written to a config map when the pod asks for it
+	_, err := client.CoreV1().ConfigMaps("ns").Get(context.Background(), "pod-container-group", metav1.GetOptions{})
+	assert.Check(t, is.ErrorContains(err, "not found"))
+
+	pod.Annotations = map[string]string{exportContainerGroupAnnotation: "true"}
+	for i := 0; i < 2; i++ {
+		p.recordContainerGroup(context.Background(), pod, newExportTestContainerGroup())
+	}
+	configMap, err := client.CoreV1().ConfigMaps("ns").Get(context.Background(), "pod-container-group", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(configMap.Data[containerGroupExportKey], `"name": "ns-pod"`))
+	assert.Check(t, is.Len(configMap.OwnerReferences, 1))
+	assert.Check(t, is.Equal(pod.UID, configMap.OwnerReferences[0].UID))
+}
+
+func TestIsContainerGroupExported(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Annotations = map[string]string{exportContainerGroupAnnotation: "yes please"}
+	_, err := isContainerGroupExported(pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+
+	assert.Check(t, is.Equal(strings.Repeat("p", 237)+containerGroupExportSuffix, getContainerGroupExportName(strings.Repeat("p", 253))))
+}
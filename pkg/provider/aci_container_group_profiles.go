@@ -0,0 +1,167 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// containerGroupProfileAnnotation is the name, or the resource ID, of the container group profile of the config
+	// file the container group of a pod is created from.
+	containerGroupProfileAnnotation = "virtual-kubelet.io/container-group-profile"
+
+	containerGroupProfileResourceType = "Microsoft.ContainerInstance/containerGroupProfiles"
+	standbyPoolResourceType           = "Microsoft.StandbyPool/standbyContainerGroupPools"
+)
+
+// containerGroupProfileConfig is a container group profile the pods can opt in to with the container group profile
+// annotation. ID is the resource ID of the profile and Revision its revision, the latest one when not set.
+// StandbyPoolID is the resource ID of a standby pool of container groups of the profile, whose images are
+// already pulled: ACI takes the container group of the pod from the pool when one is available. With Overlay, the
+// profile describes the container groups, whose containers only get the environment variables of the pods, and the
+// pods must have the containers and images of the profile.
+type containerGroupProfileConfig struct {
+	Name          string
+	ID            string
+	Revision      int64
+	StandbyPoolID string
+	Overlay       bool
+}
+
+// parseContainerGroupProfiles validates the container group profiles of the config file and returns them by name.
+func parseContainerGroupProfiles(profiles []containerGroupProfileConfig) (map[string]client.ContainerGroupProfileReference, error) {
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+
+	references := make(map[string]client.ContainerGroupProfileReference, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("container group profile %q has no name", profile.ID)
+		}
+		if _, ok := references[profile.Name]; ok {
+			return nil, fmt.Errorf("container group profile %q is defined twice", profile.Name)
+		}
+		if err := validateResourceID(profile.ID, containerGroupProfileResourceType); err != nil {
+			return nil, fmt.Errorf("container group profile %q: %v", profile.Name, err)
+		}
+		if profile.Revision < 0 {
+			return nil, fmt.Errorf("container group profile %q: revision %d can't be negative", profile.Name, profile.Revision)
+		}
+
+		reference := client.ContainerGroupProfileReference{ID: profile.ID, Overlay: profile.Overlay}
+		if profile.Revision > 0 {
+			revision := profile.Revision
+			reference.Revision = &revision
+		}
+		if profile.StandbyPoolID != "" {
+			if err := validateResourceID(profile.StandbyPoolID, standbyPoolResourceType); err != nil {
+				return nil, fmt.Errorf("container group profile %q: %v", profile.Name, err)
+			}
+			reference.StandbyPoolID = profile.StandbyPoolID
+		}
+		references[profile.Name] = reference
+	}
+	return references, nil
+}
+
+func validateResourceID(id, resourceType string) error {
+	resourceID, err := arm.ParseResourceID(id)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid resource ID: %v", id, err)
+	}
+	if !strings.EqualFold(resourceID.ResourceType.String(), resourceType) {
+		return fmt.Errorf("%q is not a %s resource ID", id, resourceType)
+	}
+	return nil
+}
+
+// getContainerGroupProfile returns the container group profile a pod opted in to, nil when it didn't. The pods can
+// only use the profiles configured on the node, referenced by name or resource ID, as the profiles can grant the
+// container groups identities and settings the pods couldn't get otherwise.
+func (p *ACIProvider) getContainerGroupProfile(pod *v1.Pod) (*client.ContainerGroupProfileReference, error) {
+	name, ok := pod.Annotations[containerGroupProfileAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	if profile, ok := p.containerGroupProfiles[name]; ok {
+		return &profile, nil
+	}
+	if strings.HasPrefix(name, "/") {
+		for _, profile := range p.containerGroupProfiles {
+			if strings.EqualFold(profile.ID, name) {
+				return &profile, nil
+			}
+		}
+	}
+	return nil, errdefs.InvalidInputf("container group profile %q of the pod is not configured on the virtual node", name)
+}
+
+// validateProfileOverlay checks that the containers of the container group of a pod overlaid on a profile are the
+// containers of the profile, with the same images: the images of the pod are not sent to ACI, so the pods asking
+// for other images are rejected rather than running the images of the profile.
+func (p *ACIProvider) validateProfileOverlay(ctx context.Context, cg *azaciv2.ContainerGroup, profile client.ContainerGroupProfileReference) error {
+	images, err := p.azClientsAPIs.GetContainerGroupProfileImages(ctx, profile)
+	if err != nil {
+		return fmt.Errorf("unable to read the images of container group profile %s: %w", profile.ID, err)
+	}
+	check := func(name, image *string) error {
+		profileImage, ok := images[stringValue(name)]
+		if !ok {
+			return errdefs.InvalidInputf("container %s of the pod is not a container of container group profile %s", stringValue(name), profile.ID)
+		}
+		if profileImage != stringValue(image) {
+			return errdefs.InvalidInputf("container %s of the pod has image %s, but the container of container group profile %s has image %s",
+				stringValue(name), stringValue(image), profile.ID, profileImage)
+		}
+		return nil
+	}
+	if cg.Properties == nil {
+		return nil
+	}
+	for _, container := range cg.Properties.Containers {
+		var image *string
+		if container.Properties != nil {
+			image = container.Properties.Image
+		}
+		if err := check(container.Name, image); err != nil {
+			return err
+		}
+	}
+	for _, container := range cg.Properties.InitContainers {
+		var image *string
+		if container.Properties != nil {
+			image = container.Properties.Image
+		}
+		if err := check(container.Name, image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createContainerGroup starts creating the container group of a pod, from its container group profile if any.
+// The container group keeps the containers of the pod, so the profile is expected to describe the same images for
+// the standby container groups to be reused, or the same container names when the profile is overlaid.
+func (p *ACIProvider) createContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup, profile *client.ContainerGroupProfileReference) (string, error) {
+	resourceGroup := p.getResourceGroup(pod.Namespace)
+	var operationID string
+	var err error
+	if profile == nil {
+		operationID, err = p.azClientsAPIs.CreateContainerGroup(ctx, resourceGroup, pod.Namespace, pod.Name, cg)
+	} else {
+		operationID, err = p.azClientsAPIs.CreateContainerGroupFromProfile(ctx, resourceGroup, pod.Namespace, pod.Name, cg, *profile)
+	}
+	return operationID, getSKUError(err, cg)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+const (
+	fakeProfileID     = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerInstance/containerGroupProfiles/web"
+	fakeStandbyPoolID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.StandbyPool/standbyContainerGroupPools/web"
+)
+
+func TestParseContainerGroupProfiles(t *testing.T) {
+	profiles, err := parseContainerGroupProfiles([]containerGroupProfileConfig{
+		{Name: "web", ID: fakeProfileID, Revision: 2, StandbyPoolID: fakeStandbyPoolID},
+		{Name: "batch", ID: fakeProfileID},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(profiles, 2))
+	assert.Check(t, is.Equal(int64(2), *profiles["web"].Revision))
+	assert.Check(t, is.Equal(fakeStandbyPoolID, profiles["web"].StandbyPoolID))
+	assert.Check(t, profiles["batch"].Revision == nil)
+
+	cases := []struct {
+		description string
+		profile     containerGroupProfileConfig
+		err         string
+	}{
+		{"no name", containerGroupProfileConfig{ID: fakeProfileID}, "has no name"},
+		{"invalid ID", containerGroupProfileConfig{Name: "web", ID: "web"}, "is not a valid resource ID"},
+		{"wrong resource type", containerGroupProfileConfig{Name: "web", ID: fakeStandbyPoolID}, "is not a Microsoft.ContainerInstance/containerGroupProfiles resource ID"},
+		{"negative revision", containerGroupProfileConfig{Name: "web", ID: fakeProfileID, Revision: -1}, "can't be negative"},
+		{"wrong standby pool type", containerGroupProfileConfig{Name: "web", ID: fakeProfileID, StandbyPoolID: fakeProfileID}, "is not a Microsoft.StandbyPool/standbyContainerGroupPools resource ID"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := parseContainerGroupProfiles([]containerGroupProfileConfig{tc.profile})
+			assert.Check(t, is.ErrorContains(err, tc.err))
+		})
+	}
+
+	_, err = parseContainerGroupProfiles([]containerGroupProfileConfig{{Name: "web", ID: fakeProfileID}, {Name: "web", ID: fakeProfileID}})
+	assert.Check(t, is.ErrorContains(err, "is defined twice"))
+}
+
+func TestCreateContainerGroupFromProfile(t *testing.T) {
+	var created, createdFromProfile []string
+	var usedProfile client.ContainerGroupProfileReference
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		created = append(created, podName)
+		return nil
+	}
+	aciMocks.MockCreateContainerGroupFromProfile = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile client.ContainerGroupProfileReference) error {
+		createdFromProfile = append(createdFromProfile, podName)
+		usedProfile = profile
+		return nil
+	}
+	p := ACIProvider{
+		azClientsAPIs: aciMocks,
+		region:        "westus",
+		containerGroupProfiles: map[string]client.ContainerGroupProfileReference{
+			"web": {ID: fakeProfileID, StandbyPoolID: fakeStandbyPoolID},
+		},
+	}
+	newContainerGroup := func() *azaciv2.ContainerGroup {
+		return &azaciv2.ContainerGroup{Tags: map[string]*string{}}
+	}
+
+	assert.NilError(t, p.createContainerGroupInRegions(context.Background(), testsutil.CreatePodObj("plain", "ns"), newContainerGroup(), false))
+
+	pod := testsutil.CreatePodObj("web", "ns")
+	pod.Annotations = map[string]string{containerGroupProfileAnnotation: "web"}
+	assert.NilError(t, p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup(), false))
+	assert.Check(t, is.DeepEqual([]string{"plain"}, created))
+	assert.Check(t, is.DeepEqual([]string{"web"}, createdFromProfile))
+	assert.Check(t, is.Equal(fakeStandbyPoolID, usedProfile.StandbyPoolID))
+
+	pod = testsutil.CreatePodObj("unknown", "ns")
+	pod.Annotations = map[string]string{containerGroupProfileAnnotation: "batch"}
+	err := p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup(), false)
+	assert.Check(t, is.ErrorContains(err, `container group profile "batch" of the pod is not configured`))
+
+	// the profiles can be referenced by the resource ID of a configured profile only
+	pod = testsutil.CreatePodObj("by-id", "ns")
+	pod.Annotations = map[string]string{containerGroupProfileAnnotation: fakeProfileID}
+	assert.NilError(t, p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup(), false))
+	assert.Check(t, is.DeepEqual([]string{"web", "by-id"}, createdFromProfile))
+	assert.Check(t, is.Equal(fakeStandbyPoolID, usedProfile.StandbyPoolID))
+
+	for _, id := range []string{fakeStandbyPoolID, strings.Replace(fakeProfileID, "/web", "/admin", 1)} {
+		pod.Annotations[containerGroupProfileAnnotation] = id
+		err = p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup(), false)
+		assert.Check(t, errdefs.IsInvalidInput(err), id)
+	}
+}
+
+func TestCreateContainerGroupFromOverlaidProfile(t *testing.T) {
+	var createdFromProfile []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroupFromProfile = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile client.ContainerGroupProfileReference) error {
+		createdFromProfile = append(createdFromProfile, podName)
+		return nil
+	}
+	aciMocks.MockGetContainerGroupProfileImages = func(ctx context.Context, profile client.ContainerGroupProfileReference) (map[string]string, error) {
+		assert.Check(t, is.Equal(fakeProfileID, profile.ID))
+		return map[string]string{"app": "contoso.azurecr.io/app:1.0", "init": "contoso.azurecr.io/init:1.0"}, nil
+	}
+	p := ACIProvider{
+		azClientsAPIs: aciMocks,
+		region:        "westus",
+		containerGroupProfiles: map[string]client.ContainerGroupProfileReference{
+			"managed": {ID: fakeProfileID, Overlay: true},
+		},
+	}
+	newContainerGroup := func(image string) *azaciv2.ContainerGroup {
+		return &azaciv2.ContainerGroup{
+			Tags: map[string]*string{},
+			Properties: &azaciv2.ContainerGroupPropertiesProperties{
+				Containers: []*azaciv2.Container{{Name: stringPtr("app"), Properties: &azaciv2.ContainerProperties{Image: stringPtr(image)}}},
+				InitContainers: []*azaciv2.InitContainerDefinition{{
+					Name: stringPtr("init"), Properties: &azaciv2.InitContainerPropertiesDefinition{Image: stringPtr("contoso.azurecr.io/init:1.0")},
+				}},
+			},
+		}
+	}
+
+	pod := testsutil.CreatePodObj("managed", "ns")
+	pod.Annotations = map[string]string{containerGroupProfileAnnotation: "managed"}
+	assert.NilError(t, p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup("contoso.azurecr.io/app:1.0"), false))
+	assert.Check(t, is.DeepEqual([]string{"managed"}, createdFromProfile))
+
+	// the pods asking for other images are rejected rather than running the images of the profile
+	err := p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup("evil.example.com/app:1.0"), false)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "evil.example.com/app:1.0"))
+
+	cg := newContainerGroup("contoso.azurecr.io/app:1.0")
+	cg.Properties.Containers[0].Name = stringPtr("sidecar")
+	err = p.createContainerGroupInRegions(context.Background(), pod, cg, false)
+	assert.Check(t, is.ErrorContains(err, "is not a container of container group profile"))
+	assert.Check(t, is.Len(createdFromProfile, 1))
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultExecTerminalCols and defaultExecTerminalRows are the size of the terminal of the exec sessions
+	// whose client did not send one.
+	defaultExecTerminalCols = 60
+	defaultExecTerminalRows = 120
+	// execTerminalSizeTimeout is the time the initial size of the terminal of an exec session is waited for.
+	execTerminalSizeTimeout = time.Second
+)
+
+// validateContainerIO validates the stdin and tty of a container. ACI has no input stream to the containers of a
+// container group, its attach only streams their output, so the containers reading their stdin would never get any
+// input and are rejected rather than left waiting. A tty without stdin only changes the formatting of the output and
+// is ignored. The exec sessions have their own stdin and tty, see RunInContainer.
+func validateContainerIO(ctx context.Context, container *v1.Container) error {
+	if container.Stdin || container.StdinOnce {
+		return errdefs.InvalidInputf("container %s: stdin is not supported by ACI, containers cannot be attached to", container.Name)
+	}
+	if container.TTY {
+		log.G(ctx).Debugf("container %s: ignoring tty, ACI containers have no terminal", container.Name)
+	}
+	return nil
+}
+
+// getExecTerminalSize returns the size of the terminal of an exec session. ACI sets the size of the terminal when
+// the session is created and cannot resize it, so the first size sent by a client with a tty is used.
+func getExecTerminalSize(ctx context.Context, attach api.AttachIO) (int32, int32) {
+	cols, rows := int32(defaultExecTerminalCols), int32(defaultExecTerminalRows)
+	if !attach.TTY() || attach.Resize() == nil {
+		return cols, rows
+	}
+
+	timer := time.NewTimer(execTerminalSizeTimeout)
+	defer timer.Stop()
+	select {
+	case size := <-attach.Resize():
+		if size.Width > 0 && size.Height > 0 {
+			cols, rows = int32(size.Width), int32(size.Height)
+		}
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return cols, rows
+}
@@ -0,0 +1,55 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+type fakeAttachIO struct {
+	stdin  io.Reader
+	stdout io.WriteCloser
+	tty    bool
+	resize chan api.TermSize
+}
+
+func (f *fakeAttachIO) Stdin() io.Reader            { return f.stdin }
+func (f *fakeAttachIO) Stdout() io.WriteCloser      { return f.stdout }
+func (f *fakeAttachIO) Stderr() io.WriteCloser      { return nil }
+func (f *fakeAttachIO) TTY() bool                   { return f.tty }
+func (f *fakeAttachIO) Resize() <-chan api.TermSize { return f.resize }
+
+func TestValidateContainerIO(t *testing.T) {
+	ctx := context.Background()
+	assert.NilError(t, validateContainerIO(ctx, &v1.Container{Name: "c", TTY: true}))
+
+	err := validateContainerIO(ctx, &v1.Container{Name: "c", Stdin: true, TTY: true})
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "stdin is not supported"))
+
+	err = validateContainerIO(ctx, &v1.Container{Name: "c", StdinOnce: true})
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
+
+func TestGetExecTerminalSize(t *testing.T) {
+	ctx := context.Background()
+	cols, rows := getExecTerminalSize(ctx, &fakeAttachIO{})
+	assert.Check(t, is.Equal(int32(defaultExecTerminalCols), cols))
+	assert.Check(t, is.Equal(int32(defaultExecTerminalRows), rows))
+
+	resize := make(chan api.TermSize, 1)
+	resize <- api.TermSize{Width: 200, Height: 50}
+	cols, rows = getExecTerminalSize(ctx, &fakeAttachIO{tty: true, resize: resize})
+	assert.Check(t, is.Equal(int32(200), cols))
+	assert.Check(t, is.Equal(int32(50), rows))
+}
@@ -0,0 +1,250 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+const (
+	// maxCachedContainerLogBytes bounds the logs cached per container instance.
+	maxCachedContainerLogBytes = 1 << 20
+	// maxCachedContainerLogTotalBytes bounds the logs cached for all the containers, the logs of the containers
+	// read least recently are dropped first.
+	maxCachedContainerLogTotalBytes = 64 << 20
+)
+
+const aciContainerStateTerminated = "Terminated"
+
+type containerLogKey struct {
+	namespace, pod, container string
+}
+
+// cachedContainerLogs are the most recent logs of an instance of a container.
+type cachedContainerLogs struct {
+	restartCount int32
+	logs         string
+	// terminated is set once the logs were read after the instance terminated, so they are complete.
+	terminated bool
+}
+
+// containerLogEntry are the cached logs of the last two instances of a container.
+type containerLogEntry struct {
+	key               containerLogKey
+	current, previous *cachedContainerLogs
+}
+
+func (e *containerLogEntry) size() int {
+	size := 0
+	for _, logs := range []*cachedContainerLogs{e.current, e.previous} {
+		if logs != nil {
+			size += len(logs.logs)
+		}
+	}
+	return size
+}
+
+// containerLogCache keeps the most recent logs of the last two instances of the containers, since the ACI log API
+// only returns the logs of the current instance of a container, so that the logs of the instance before a restart
+// can still be served to kubectl logs --previous. The logs of the containers used least recently are evicted once
+// the cache holds more than maxTotalBytes.
+type containerLogCache struct {
+	lock    sync.Mutex
+	entries map[containerLogKey]*list.Element
+	// lru has the entries used most recently first.
+	lru           *list.List
+	size          int
+	maxBytes      int
+	maxTotalBytes int
+}
+
+func newContainerLogCache(maxBytes, maxTotalBytes int) *containerLogCache {
+	return &containerLogCache{
+		entries:       map[containerLogKey]*list.Element{},
+		lru:           list.New(),
+		maxBytes:      maxBytes,
+		maxTotalBytes: maxTotalBytes,
+	}
+}
+
+// get returns the entry of a container, as the one used most recently, with the lock held.
+func (c *containerLogCache) get(key containerLogKey) *containerLogEntry {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*containerLogEntry)
+}
+
+// remove drops the entry of a container, with the lock held.
+func (c *containerLogCache) remove(element *list.Element) {
+	entry := element.Value.(*containerLogEntry)
+	c.size -= entry.size()
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+}
+
+// record caches the logs of an instance of a container, which replace the logs of the same instance and push
+// the logs of an older instance to the previous logs.
+func (c *containerLogCache) record(key containerLogKey, restartCount int32, logs string, terminated bool) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	logs = tailBytes(logs, c.maxBytes)
+	entry := c.get(key)
+	if entry == nil {
+		entry = &containerLogEntry{key: key}
+		c.entries[key] = c.lru.PushFront(entry)
+	}
+	c.size -= entry.size()
+	switch {
+	case entry.current == nil:
+	case restartCount > entry.current.restartCount:
+		entry.previous = entry.current
+	case restartCount < entry.current.restartCount:
+		c.size += entry.size()
+		return
+	}
+	entry.current = &cachedContainerLogs{restartCount: restartCount, logs: logs, terminated: terminated}
+	c.size += entry.size()
+
+	for c.maxTotalBytes > 0 && c.size > c.maxTotalBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// isTerminated returns whether the complete logs of an instance of a container are cached.
+func (c *containerLogCache) isTerminated(key containerLogKey, restartCount int32) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.get(key)
+	return entry != nil && entry.current.restartCount == restartCount && entry.current.terminated
+}
+
+// getPrevious returns the logs of the instance of a container before the instance with restartCount.
+func (c *containerLogCache) getPrevious(key containerLogKey, restartCount int32) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.get(key)
+	if entry == nil {
+		return "", false
+	}
+	for _, logs := range []*cachedContainerLogs{entry.current, entry.previous} {
+		if logs != nil && logs.restartCount < restartCount {
+			return logs.logs, true
+		}
+	}
+	return "", false
+}
+
+// deletePod drops the logs of the containers of a pod.
+func (c *containerLogCache) deletePod(namespace, pod string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, element := range c.entries {
+		if key.namespace == namespace && key.pod == pod {
+			c.remove(element)
+		}
+	}
+}
+
+// retainPods drops the logs of the containers of the pods which are not in the list, for the pods whose container
+// group disappeared without the pod being deleted through DeletePod.
+func (c *containerLogCache) retainPods(pods []PodIdentifier) {
+	if c == nil {
+		return
+	}
+	existing := make(map[PodIdentifier]bool, len(pods))
+	for _, pod := range pods {
+		existing[pod] = true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, element := range c.entries {
+		if !existing[PodIdentifier{namespace: key.namespace, name: key.pod}] {
+			c.remove(element)
+		}
+	}
+}
+
+// snapshotTerminatedContainerLogs caches the logs of the terminated containers of a container group, before ACI
+// restarts them and their logs are lost.
+func (p *ACIProvider) snapshotTerminatedContainerLogs(ctx context.Context, namespace, name string, cg *azaciv2.ContainerGroup) {
+	if p.containerLogs == nil || cg.Properties == nil {
+		return
+	}
+	for _, container := range cg.Properties.Containers {
+		if container.Name == nil || container.Properties == nil || container.Properties.InstanceView == nil {
+			continue
+		}
+		instanceView := container.Properties.InstanceView
+		if instanceView.CurrentState == nil || stringValue(instanceView.CurrentState.State) != aciContainerStateTerminated {
+			continue
+		}
+		key := containerLogKey{namespace: namespace, pod: name, container: *container.Name}
+		restartCount := getRestartCount(instanceView)
+		if p.containerLogs.isTerminated(key, restartCount) {
+			continue
+		}
+		logs, err := p.azClientsAPIs.ListLogs(ctx, p.getResourceGroup(namespace), *cg.Name, *container.Name, api.ContainerLogOpts{Timestamps: true})
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to cache the logs of terminated container %s of pod %s/%s", *container.Name, namespace, name)
+			continue
+		}
+		p.containerLogs.record(key, restartCount, stringValue(logs), true)
+	}
+}
+
+// getContainerRestartCount returns the restart count of a container of a container group.
+func getContainerRestartCount(cg *azaciv2.ContainerGroup, containerName string) int32 {
+	if cg.Properties == nil {
+		return 0
+	}
+	for _, container := range cg.Properties.Containers {
+		if stringValue(container.Name) == containerName && container.Properties != nil {
+			return getRestartCount(container.Properties.InstanceView)
+		}
+	}
+	return 0
+}
+
+func getRestartCount(instanceView *azaciv2.ContainerPropertiesInstanceView) int32 {
+	if instanceView == nil || instanceView.RestartCount == nil {
+		return 0
+	}
+	return *instanceView.RestartCount
+}
+
+// tailBytes returns the last lines of logs fitting in maxBytes.
+func tailBytes(logs string, maxBytes int) string {
+	if maxBytes <= 0 || len(logs) <= maxBytes {
+		return logs
+	}
+	logs = logs[len(logs)-maxBytes:]
+	if i := strings.IndexByte(logs, '\n'); i >= 0 {
+		return logs[i+1:]
+	}
+	return logs
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestContainerLogCache(t *testing.T) {
+	cache := newContainerLogCache(10, 0)
+	key := containerLogKey{namespace: "ns", pod: "pod", container: "c"}
+
+	cache.record(key, 0, "first\n", false)
+	_, ok := cache.getPrevious(key, 0)
+	assert.Check(t, !ok)
+
+	cache.record(key, 0, "first\nsecond\n", true)
+	assert.Check(t, cache.isTerminated(key, 0))
+	// the logs of the restarted instance were not read yet
+	logs, ok := cache.getPrevious(key, 1)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal("second\n", logs))
+
+	cache.record(key, 1, "third\n", false)
+	logs, ok = cache.getPrevious(key, 1)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal("second\n", logs))
+
+	// logs of older instances are ignored
+	cache.record(key, 0, "stale\n", false)
+	logs, _ = cache.getPrevious(key, 2)
+	assert.Check(t, is.Equal("third\n", logs))
+
+	cache.deletePod("ns", "pod")
+	_, ok = cache.getPrevious(key, 2)
+	assert.Check(t, !ok)
+}
+
+func TestContainerLogCacheEviction(t *testing.T) {
+	cache := newContainerLogCache(10, 20)
+	key := func(pod, container string) containerLogKey {
+		return containerLogKey{namespace: "ns", pod: pod, container: container}
+	}
+
+	cache.record(key("a", "c"), 0, "aaaaaaaa\n", true)
+	cache.record(key("b", "c"), 0, "bbbbbbbb\n", true)
+	// the logs of a are read, so the ones of b are evicted first
+	_, ok := cache.getPrevious(key("a", "c"), 1)
+	assert.Check(t, ok)
+	cache.record(key("c", "c"), 0, "cccccccc\n", true)
+	assert.Check(t, cache.isTerminated(key("a", "c"), 0))
+	assert.Check(t, !cache.isTerminated(key("b", "c"), 0))
+	assert.Check(t, cache.isTerminated(key("c", "c"), 0))
+	assert.Check(t, is.Equal(18, cache.size))
+
+	// the previous logs count in the size of a container
+	cache.record(key("c", "c"), 1, "dddddddd\n", false)
+	assert.Check(t, !cache.isTerminated(key("a", "c"), 0))
+	logs, ok := cache.getPrevious(key("c", "c"), 1)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal("cccccccc\n", logs))
+	assert.Check(t, is.Equal(18, cache.size))
+
+	// the logs of the pods which are gone are dropped
+	cache.record(key("d", "c"), 0, "d\n", true)
+	cache.retainPods([]PodIdentifier{{namespace: "ns", name: "d"}})
+	assert.Check(t, cache.isTerminated(key("d", "c"), 0))
+	_, ok = cache.getPrevious(key("c", "c"), 1)
+	assert.Check(t, !ok)
+	assert.Check(t, is.Equal(2, cache.size))
+}
+
+func TestGetPreviousContainerLogs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podName, podNamespace := "pod", "ns"
+	state, restartCount := "Terminated", int32(0)
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		containers := testsutil.CreateACIContainersListObj(state, "Initializing",
+			testsutil.CgCreationTime.Add(time.Second*2), testsutil.CgCreationTime.Add(time.Second*3), false, false, false)
+		count := restartCount
+		containers[0].Properties.InstanceView.RestartCount = &count
+		return testsutil.CreateContainerGroupObj(podName, podNamespace, "Running", containers, "Succeeded"), nil
+	}
+	logs := "crashed\n"
+	aciMocks.MockListLogs = func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
+		content := logs
+		return &content, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	container := testsutil.TestContainerName
+
+	_, err = provider.GetContainerLogs(context.Background(), podNamespace, podName, container, api.ContainerLogOpts{Previous: true})
+	assert.Check(t, errdefs.IsNotFound(err))
+
+	// the status update caches the logs of the terminated container
+	_, err = provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+
+	state, restartCount, logs = "Running", 1, "restarted\n"
+	rc, err := provider.GetContainerLogs(context.Background(), podNamespace, podName, container, api.ContainerLogOpts{Previous: true})
+	assert.NilError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("crashed\n", string(content)))
+
+	rc, err = provider.GetContainerLogs(context.Background(), podNamespace, podName, container, api.ContainerLogOpts{})
+	assert.NilError(t, err)
+	content, err = io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("restarted\n", string(content)))
+}
+
+func TestGetContainerLogsOptions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podName, podNamespace := "pod", "ns"
+	restartCount := int32(0)
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		containers := testsutil.CreateACIContainersListObj("Running", "Initializing",
+			testsutil.CgCreationTime.Add(time.Second*2), testsutil.CgCreationTime.Add(time.Second*3), false, false, false)
+		count := restartCount
+		containers[0].Properties.InstanceView.RestartCount = &count
+		return testsutil.CreateContainerGroupObj(podName, podNamespace, "Running", containers, "Succeeded"), nil
+	}
+	logs := "2022-01-01T00:00:00Z first\n2022-01-01T00:00:01Z second\n"
+	aciMocks.MockListLogs = func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
+		content := logs
+		return &content, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	container := testsutil.TestContainerName
+
+	rc, err := provider.GetContainerLogs(context.Background(), podNamespace, podName, container, api.ContainerLogOpts{Tail: 1})
+	assert.NilError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("second\n", string(content)))
+
+	// the complete logs were cached despite the options of the request
+	restartCount, logs = 1, ""
+	rc, err = provider.GetContainerLogs(context.Background(), podNamespace, podName, container, api.ContainerLogOpts{Previous: true, Timestamps: true})
+	assert.NilError(t, err)
+	content, err = io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("2022-01-01T00:00:00Z first\n2022-01-01T00:00:01Z second\n", string(content)))
+}
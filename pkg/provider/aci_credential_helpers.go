@@ -0,0 +1,222 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/cpuguy83/dockercfg"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+)
+
+const (
+	credentialHelperTimeout = 30 * time.Second
+	// credentialHelperTokenUsername is returned by the credential helpers instead of a username for identity tokens.
+	credentialHelperTokenUsername = "<token>"
+)
+
+// registryCredentialHelperConfig allows the image pull secrets of Namespaces, or of all the namespaces when empty,
+// to use the credential helper Name for the registries of Servers.
+type registryCredentialHelperConfig struct {
+	Name       string
+	Servers    []string
+	Namespaces []string
+}
+
+// RegistryCredentialProvider returns the credentials of a registry from the credential helper referenced by the
+// credHelpers or credsStore of the docker config of an image pull secret.
+type RegistryCredentialProvider interface {
+	GetCredentials(ctx context.Context, helper, server string) (username, password string, err error)
+}
+
+// SetRegistryCredentialProvider replaces the provider of the credentials of the registries using a credential
+// helper, which by default execs the allowed docker-credential-<helper> binaries. The provider is still only asked
+// for the servers and namespaces the helpers are allowed for.
+func (p *ACIProvider) SetRegistryCredentialProvider(provider RegistryCredentialProvider) {
+	p.registryCredentialProvider = provider
+}
+
+// setupCredentialHelpers reads the ACI_REGISTRY_CREDENTIAL_HELPERS environment variable, which takes precedence
+// over the config file: a semicolon separated list of <helper>=<server>[,<server>...][@<namespace>[,<namespace>...]].
+//
+// The docker config of image pull secrets is controlled by the users of the cluster, while the credential helpers
+// run with the identity of the provider. A secret naming a server under credHelpers would otherwise get the
+// credentials the provider holds for any registry, so each helper is only run for the servers and the namespaces
+// the administrator allowed it for, and the other servers are rejected.
+func (p *ACIProvider) setupCredentialHelpers() error {
+	if helpers := os.Getenv("ACI_REGISTRY_CREDENTIAL_HELPERS"); helpers != "" {
+		configs, err := parseRegistryCredentialHelpers(helpers)
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_REGISTRY_CREDENTIAL_HELPERS: %v", err)
+		}
+		return p.setRegistryCredentialHelpers(configs)
+	}
+	return nil
+}
+
+// parseRegistryCredentialHelpers parses the credential helpers of the ACI_REGISTRY_CREDENTIAL_HELPERS environment
+// variable.
+func parseRegistryCredentialHelpers(value string) ([]registryCredentialHelperConfig, error) {
+	var configs []registryCredentialHelperConfig
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, servers, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential helper %q, must be <helper>=<servers>[@<namespaces>]", entry)
+		}
+		config := registryCredentialHelperConfig{Name: strings.TrimSpace(name)}
+		servers, namespaces, _ := strings.Cut(servers, "@")
+		config.Servers = splitCommaList(servers)
+		config.Namespaces = splitCommaList(namespaces)
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// splitCommaList returns the non empty items of a comma separated list.
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// setRegistryCredentialHelpers validates the allowed credential helpers and sets up the provider running them.
+func (p *ACIProvider) setRegistryCredentialHelpers(configs []registryCredentialHelperConfig) error {
+	names := make([]string, 0, len(configs))
+	for _, config := range configs {
+		if config.Name == "" {
+			return fmt.Errorf("credential helpers must have a name")
+		}
+		if len(config.Servers) == 0 {
+			return fmt.Errorf("credential helper %s must be allowed for at least one server", config.Name)
+		}
+		names = append(names, config.Name)
+	}
+	p.registryCredentialHelpers = configs
+	p.registryCredentialProvider = newExecCredentialHelpers(names)
+	return nil
+}
+
+// isCredentialHelperAllowed returns whether the image pull secrets of a namespace may use a credential helper for
+// a server.
+func (p *ACIProvider) isCredentialHelperAllowed(helper, server, namespace string) bool {
+	server = normalizeRegistryServer(server)
+	for _, config := range p.registryCredentialHelpers {
+		if config.Name != helper {
+			continue
+		}
+		if len(config.Namespaces) > 0 && !containsString(config.Namespaces, namespace) {
+			continue
+		}
+		for _, allowed := range config.Servers {
+			if normalizeRegistryServer(allowed) == server {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getCredentialHelpers returns the credential helper of the registries of a docker config using one: the helpers
+// of credHelpers, and the credentials store for the registries of auths without credentials.
+func getCredentialHelpers(config *dockercfg.Config) map[string]string {
+	helpers := map[string]string{}
+	for server, helper := range config.CredentialHelpers {
+		helpers[server] = helper
+	}
+	if config.CredentialsStore != "" {
+		for server, auth := range config.AuthConfigs {
+			if _, ok := helpers[server]; !ok && auth.Username == "" && auth.Auth == "" && auth.IdentityToken == "" {
+				helpers[server] = config.CredentialsStore
+			}
+		}
+	}
+	return helpers
+}
+
+// makeRegistryCredentialFromHelper returns the credential of a registry from its credential helper, when the
+// image pull secrets of the namespace are allowed to use the helper for the registry.
+func (p *ACIProvider) makeRegistryCredentialFromHelper(ctx context.Context, namespace, server, helper string) (*azaciv2.ImageRegistryCredential, error) {
+	if p.registryCredentialProvider == nil || !p.isCredentialHelperAllowed(helper, server, namespace) {
+		return nil, errdefs.InvalidInputf("the credential helper %s of registry %s is not allowed in namespace %s", helper, server, namespace)
+	}
+	username, password, err := p.registryCredentialProvider.GetCredentials(ctx, helper, server)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the credentials of registry %s from credential helper %s: %w", server, helper, err)
+	}
+	if username == "" || username == credentialHelperTokenUsername {
+		return nil, fmt.Errorf("credential helper %s returned no username for registry %s, identity tokens are not supported", helper, server)
+	}
+
+	return &azaciv2.ImageRegistryCredential{
+		Server:   &server,
+		Username: &username,
+		Password: &password,
+	}, nil
+}
+
+// execCredentialHelpers runs the docker-credential-<helper> binaries of the allowed helpers.
+type execCredentialHelpers struct {
+	allowed map[string]bool
+}
+
+// newExecCredentialHelpers returns the provider running the allowed credential helpers, or nil when none is.
+func newExecCredentialHelpers(helpers []string) RegistryCredentialProvider {
+	allowed := map[string]bool{}
+	for _, helper := range helpers {
+		if helper = strings.TrimSpace(helper); helper != "" {
+			allowed[helper] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return &execCredentialHelpers{allowed: allowed}
+}
+
+func (h *execCredentialHelpers) GetCredentials(ctx context.Context, helper, server string) (string, string, error) {
+	if !h.allowed[helper] {
+		return "", "", errdefs.InvalidInputf("the credential helper %s is not allowed", helper)
+	}
+	path, err := exec.LookPath("docker-credential-" + helper)
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// the helpers report errors on stdout
+		return "", "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)+" "+stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("error parsing the output of the credential helper: %v", err)
+	}
+	return creds.Username, creds.Secret, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeCredentialProvider map[string]string
+
+func (f fakeCredentialProvider) GetCredentials(ctx context.Context, helper, server string) (string, string, error) {
+	return helper + "-user", f[server], nil
+}
+
+func TestReadDockerConfigJSONSecretWithCredentialHelpers(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns"},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{v1.DockerConfigJsonKey: []byte(`{
+	"auths": {
+		"static.example.com": {"username": "static", "password": "static-password"},
+		"store.example.com": {}
+	},
+	"credsStore": "store",
+	"credHelpers": {"helper.example.com": "helper"}
+}`)},
+	}
+
+	var p ACIProvider
+	_, err := p.readDockerConfigJSONSecret(context.Background(), secret, nil)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "is not allowed"))
+
+	p.SetRegistryCredentialProvider(fakeCredentialProvider{
+		"store.example.com":  "store-password",
+		"helper.example.com": "helper-password",
+	})
+	_, err = p.readDockerConfigJSONSecret(context.Background(), secret, nil)
+	assert.Check(t, errdefs.IsInvalidInput(err), "the helpers are only run for their allowed servers")
+
+	p.registryCredentialHelpers = []registryCredentialHelperConfig{
+		{Name: "store", Servers: []string{"https://store.example.com/"}},
+		{Name: "helper", Servers: []string{"helper.example.com"}, Namespaces: []string{"ns"}},
+	}
+	ips, err := p.readDockerConfigJSONSecret(context.Background(), secret, nil)
+	assert.NilError(t, err)
+	creds := map[string]string{}
+	for _, ip := range ips {
+		creds[*ip.Server] = *ip.Username + ":" + *ip.Password
+	}
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"static.example.com": "static:static-password",
+		"store.example.com":  "store-user:store-password",
+		"helper.example.com": "helper-user:helper-password",
+	}, creds))
+
+	// the helpers are not run for the servers or the namespaces they are not allowed for
+	_, err = p.makeRegistryCredentialFromHelper(context.Background(), "ns", "other.example.com", "helper")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	_, err = p.makeRegistryCredentialFromHelper(context.Background(), "other", "helper.example.com", "helper")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	_, err = p.makeRegistryCredentialFromHelper(context.Background(), "ns", "helper.example.com", "store")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
+
+func TestParseRegistryCredentialHelpers(t *testing.T) {
+	configs, err := parseRegistryCredentialHelpers(" ecr-login=a.example.com, b.example.com@team-a,team-b; gcloud=gcr.io;")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]registryCredentialHelperConfig{
+		{Name: "ecr-login", Servers: []string{"a.example.com", "b.example.com"}, Namespaces: []string{"team-a", "team-b"}},
+		{Name: "gcloud", Servers: []string{"gcr.io"}},
+	}, configs))
+
+	_, err = parseRegistryCredentialHelpers("gcloud")
+	assert.Check(t, err != nil, "a helper without servers is invalid")
+
+	var p ACIProvider
+	assert.Check(t, p.setRegistryCredentialHelpers([]registryCredentialHelperConfig{{Name: "gcloud"}}) != nil)
+	assert.NilError(t, p.setRegistryCredentialHelpers(configs))
+	assert.Check(t, p.registryCredentialProvider != nil)
+}
+
+func TestExecCredentialHelpers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nread server\necho \"{\\\"ServerURL\\\":\\\"$server\\\",\\\"Username\\\":\\\"user\\\",\\\"Secret\\\":\\\"secret-for-$server\\\"}\"\n"
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(script), 0700))
+	t.Setenv("PATH", dir)
+
+	helpers := newExecCredentialHelpers([]string{" fake ", ""})
+	username, password, err := helpers.GetCredentials(context.Background(), "fake", "registry.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("user", username))
+	assert.Check(t, is.Equal("secret-for-registry.example.com", password))
+
+	_, _, err = helpers.GetCredentials(context.Background(), "other", "registry.example.com")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+
+	assert.Check(t, newExecCredentialHelpers(nil) == nil)
+}
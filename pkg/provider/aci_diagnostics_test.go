@@ -0,0 +1,46 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/virtual-kubelet/azure-aci/pkg/analytics"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetDiagnostics(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	nodeName := fakeNodeName
+
+	diagnostics, err := analytics.NewContainerGroupDiagnostics("workspace-id", "workspace-key")
+	assert.NilError(t, err)
+	diagnostics.LogAnalytics.LogType = &util.LogTypeContainerInsights
+	diagnostics.LogAnalytics.Metadata = map[string]*string{
+		analytics.LogAnalyticsMetadataKeyNodeName: &nodeName,
+	}
+	provider := ACIProvider{diagnostics: diagnostics}
+
+	pod1 := testsutil.CreatePodObj(podName, podNamespace)
+	pod1.UID = types.UID(uuid.New().String())
+	pod2 := testsutil.CreatePodObj(podName, podNamespace)
+	pod2.UID = types.UID(uuid.New().String())
+
+	d1 := provider.getDiagnostics(pod1)
+	d2 := provider.getDiagnostics(pod2)
+	assert.Check(t, is.Equal(string(pod1.UID), *d1.LogAnalytics.Metadata[analytics.LogAnalyticsMetadataKeyPodUUID]))
+	assert.Check(t, is.Equal(string(pod2.UID), *d2.LogAnalytics.Metadata[analytics.LogAnalyticsMetadataKeyPodUUID]))
+	assert.Check(t, is.Equal(nodeName, *d1.LogAnalytics.Metadata[analytics.LogAnalyticsMetadataKeyNodeName]))
+	assert.Check(t, is.Nil(diagnostics.LogAnalytics.Metadata[analytics.LogAnalyticsMetadataKeyPodUUID]), "provider diagnostics should not be modified")
+
+	pod1.Annotations = map[string]string{logAnalyticsOptOutAnnotation: "true"}
+	assert.Check(t, is.Nil(provider.getDiagnostics(pod1)), "diagnostics should not be set for opted out pod")
+}
@@ -0,0 +1,50 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventReasonDisruptionTarget is the reason of the event emitted on the pods whose container group is about to be
+// deleted by the provider.
+const eventReasonDisruptionTarget = "DisruptionTarget"
+
+// getDisruptionCondition returns the DisruptionTarget condition of a pod whose container group the provider
+// deletes, with the reason the kubelet reports for the pods it terminates.
+func getDisruptionCondition(message string) v1.PodCondition {
+	return v1.PodCondition{
+		Type:               v1.DisruptionTarget,
+		Status:             v1.ConditionTrue,
+		Reason:             v1.PodReasonTerminationByKubelet,
+		Message:            message,
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	}
+}
+
+// announceDisruption reports that the provider is about to delete the container group of a pod, with the
+// DisruptionTarget condition and an event, like the kubelet before it evicts a pod. It lets the controllers of the
+// pod, e.g. the pod failure policy of a job, and its users tell the deletion from a failure of the pod.
+func (p *ACIProvider) announceDisruption(ctx context.Context, pod *v1.Pod, message string) {
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeNormal, eventReasonDisruptionTarget, message)
+	}
+	if p.tracker == nil {
+		return
+	}
+
+	err := p.tracker.UpdatePodStatus(ctx, pod.Namespace, pod.Name, func(podStatus *v1.PodStatus) {
+		setPodCondition(podStatus, getDisruptionCondition(message))
+	}, false)
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.G(ctx).WithError(err).Warnf("failed to announce the disruption of pod %s/%s", pod.Namespace, pod.Name)
+	}
+}
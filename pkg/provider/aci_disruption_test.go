@@ -0,0 +1,46 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAnnounceDisruption(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+	var updated *v1.Pod
+	p := ACIProvider{tracker: &PodsTracker{pods: podLister, updateCb: func(p *v1.Pod) { updated = p }}}
+	recorder := record.NewFakeRecorder(10)
+	p.SetEventRecorder(recorder)
+
+	p.announceDisruption(context.Background(), pod, "deleting the container group: stopped after its TTL of 1h since its start")
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Contains(<-recorder.Events, "Normal DisruptionTarget deleting the container group"))
+	assert.Assert(t, updated != nil)
+	condition := findPodCondition(updated.Status.Conditions, v1.DisruptionTarget)
+	assert.Assert(t, condition != nil)
+	assert.Check(t, is.Equal(v1.ConditionTrue, condition.Status))
+	assert.Check(t, is.Equal(v1.PodReasonTerminationByKubelet, condition.Reason))
+
+	// the condition survives the next status fetched from ACI
+	status := &v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}
+	mergePodConditions(updated, status)
+	assert.Check(t, findPodCondition(status.Conditions, v1.DisruptionTarget) != nil)
+	assert.Check(t, findPodCondition(pod.Status.Conditions, v1.DisruptionTarget) == nil)
+}
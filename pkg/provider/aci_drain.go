@@ -0,0 +1,224 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// nodeDrainAnnotation set on the virtual node to cordon stops the provider from creating the container groups
+	// of new pods, and set to drain also evicts the pods of the node, e.g. for a maintenance window or to evacuate
+	// the region.
+	nodeDrainAnnotation = "virtual-kubelet.io/drain"
+	// nodeDrainStartAnnotation is when the evictions of a drain start, as RFC3339, right away without it.
+	nodeDrainStartAnnotation = "virtual-kubelet.io/drain-start"
+
+	drainModeCordon = "cordon"
+	drainModeDrain  = "drain"
+
+	// podStatusReasonNodeCordoned is the reason of the new pods rejected while the node is cordoned or drained.
+	podStatusReasonNodeCordoned = "NodeCordoned"
+	// eventReasonDraining is the reason of the events emitted on the node when its drain mode changes, and on the
+	// pods evicted by a drain.
+	eventReasonDraining = "Draining"
+
+	nodeDrainInterval     = 30 * time.Second
+	defaultDrainBatchSize = 10
+)
+
+// nodeDrain is the drain mode of the virtual node set by its annotations.
+type nodeDrain struct {
+	mode  string
+	start time.Time
+}
+
+// getNodeDrain returns the drain mode set by the annotations of the virtual node.
+func getNodeDrain(node *v1.Node) (nodeDrain, error) {
+	var drain nodeDrain
+	switch mode := node.Annotations[nodeDrainAnnotation]; mode {
+	case "":
+		return drain, nil
+	case drainModeCordon, drainModeDrain:
+		drain.mode = mode
+	default:
+		return drain, fmt.Errorf("invalid %s annotation %q of node %s, expected %s or %s",
+			nodeDrainAnnotation, mode, node.Name, drainModeCordon, drainModeDrain)
+	}
+	if value, ok := node.Annotations[nodeDrainStartAnnotation]; ok && drain.mode == drainModeDrain {
+		start, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nodeDrain{}, fmt.Errorf("invalid %s annotation %q of node %s, expected an RFC3339 time",
+				nodeDrainStartAnnotation, value, node.Name)
+		}
+		drain.start = start
+	}
+	return drain, nil
+}
+
+// getMessage describes the drain mode of a node.
+func (d nodeDrain) getMessage(nodeName string) string {
+	switch {
+	case d.mode == drainModeCordon:
+		return fmt.Sprintf("node %s is cordoned, it doesn't accept new pods", nodeName)
+	case d.mode == drainModeDrain && !d.start.IsZero():
+		return fmt.Sprintf("node %s is drained, it doesn't accept new pods and evicts its pods from %s",
+			nodeName, d.start.Format(time.RFC3339))
+	case d.mode == drainModeDrain:
+		return fmt.Sprintf("node %s is drained, it doesn't accept new pods and evicts its pods", nodeName)
+	}
+	return fmt.Sprintf("node %s accepts new pods again", nodeName)
+}
+
+// getDrain returns the current drain mode of the virtual node.
+func (p *ACIProvider) getDrain() nodeDrain {
+	p.nodeLock.Lock()
+	defer p.nodeLock.Unlock()
+	return p.drain
+}
+
+// getDrainBatchSize returns the number of pods evicted every nodeDrainInterval while the node is drained.
+func (p *ACIProvider) getDrainBatchSize() int {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+	if p.drainBatchSize <= 0 {
+		return defaultDrainBatchSize
+	}
+	return p.drainBatchSize
+}
+
+// admitPodOnCordonedNode fails the new pods while the node is cordoned or drained. The pods already running, e.g.
+// whose container groups are updated in place, go on. It returns whether the creation of the pod should go on.
+func (p *ACIProvider) admitPodOnCordonedNode(ctx context.Context, pod *v1.Pod) bool {
+	if p.getDrain().mode == "" || (pod.Status.Phase != v1.PodPending && pod.Status.Phase != "") {
+		return true
+	}
+	p.failPod(ctx, pod, podStatusReasonNodeCordoned,
+		errdefs.InvalidInputf("node %s is cordoned by its %s annotation and doesn't accept new pods", p.nodeName, nodeDrainAnnotation))
+	return false
+}
+
+// StartNodeDrain reads the drain mode of the virtual node every nodeDrainInterval and, while the node is drained,
+// evicts its pods in batches of DrainBatchSize.
+func (p *ACIProvider) StartNodeDrain(ctx context.Context, nodes corev1client.NodesGetter, pods corev1client.PodsGetter) {
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if err := p.syncNodeDrain(ctx, nodes, pods, time.Now()); err != nil {
+				log.G(ctx).WithError(err).Warn("failed to sync the drain mode of the node")
+			}
+			timer.Reset(nodeDrainInterval)
+		}
+	}()
+}
+
+// syncNodeDrain updates the drain mode from the annotations of the virtual node and evicts the next batch of pods
+// once the drain started. An invalid annotation keeps the current mode.
+func (p *ACIProvider) syncNodeDrain(ctx context.Context, nodes corev1client.NodesGetter, pods corev1client.PodsGetter, now time.Time) error {
+	ctx, span := trace.StartSpan(ctx, "aci.syncNodeDrain")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	node, err := nodes.Nodes().Get(ctx, p.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	drain, err := getNodeDrain(node)
+	if err != nil {
+		return err
+	}
+
+	p.nodeLock.Lock()
+	changed := drain != p.drain
+	p.drain = drain
+	p.nodeLock.Unlock()
+	if changed {
+		message := drain.getMessage(p.nodeName)
+		log.G(ctx).Info(message)
+		if p.eventRecorder != nil {
+			p.eventRecorder.Event(node, v1.EventTypeNormal, eventReasonDraining, message)
+		}
+	}
+
+	if drain.mode != drainModeDrain || now.Before(drain.start) || !p.isLeading() {
+		return nil
+	}
+	return p.evictPods(ctx, pods)
+}
+
+// getDrainedPods returns the pods a drain evicts, by increasing priority. Like kubectl drain, the pods of daemon
+// sets are left alone as they would be recreated on the node, as are the pods already being deleted.
+func getDrainedPods(pods []*v1.Pod) []*v1.Pod {
+	var drained []*v1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !isActivePod(pod) {
+			continue
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		drained = append(drained, pod)
+	}
+	sort.SliceStable(drained, func(i, j int) bool {
+		if pi, pj := getPodPriority(drained[i]), getPodPriority(drained[j]); pi != pj {
+			return pi < pj
+		}
+		return drained[i].Namespace+"/"+drained[i].Name < drained[j].Namespace+"/"+drained[j].Name
+	})
+	return drained
+}
+
+// evictPods evicts the next batch of pods of a drained node with the eviction API, so that the disruption budgets
+// of the pods are honored and their controllers recreate them on other nodes. The pods whose eviction is refused
+// are retried with the next batch.
+func (p *ACIProvider) evictPods(ctx context.Context, client corev1client.PodsGetter) error {
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	drained := getDrainedPods(pods)
+	if batch := p.getDrainBatchSize(); len(drained) > batch {
+		drained = drained[:batch]
+	}
+
+	for _, pod := range drained {
+		err := client.Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+			ObjectMeta:    metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+			DeleteOptions: &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}},
+		})
+		switch {
+		case apierrors.IsNotFound(err):
+		case apierrors.IsTooManyRequests(err):
+			log.G(ctx).Infof("the disruption budget of pod %s/%s doesn't allow its eviction yet", pod.Namespace, pod.Name)
+		case err != nil:
+			log.G(ctx).WithError(err).Warnf("failed to evict pod %s/%s", pod.Namespace, pod.Name)
+		default:
+			log.G(ctx).Infof("evicted pod %s/%s to drain the node", pod.Namespace, pod.Name)
+			if p.eventRecorder != nil {
+				p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonDraining, "evicted to drain node %s", p.nodeName)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetNodeDrain(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fakeNodeName}}
+	drain, err := getNodeDrain(node)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("", drain.mode))
+
+	node.Annotations = map[string]string{nodeDrainAnnotation: drainModeDrain, nodeDrainStartAnnotation: "2026-10-17T22:00:00Z"}
+	drain, err = getNodeDrain(node)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("node vk is drained, it doesn't accept new pods and evicts its pods from 2026-10-17T22:00:00Z",
+		drain.getMessage("vk")))
+
+	node.Annotations[nodeDrainStartAnnotation] = "tonight"
+	_, err = getNodeDrain(node)
+	assert.Check(t, is.ErrorContains(err, "expected an RFC3339 time"))
+	node.Annotations[nodeDrainAnnotation] = "evacuate"
+	_, err = getNodeDrain(node)
+	assert.Check(t, is.ErrorContains(err, "expected cordon or drain"))
+}
+
+func TestGetDrainedPods(t *testing.T) {
+	pods := testsutil.CreatePodsList([]string{"web", "batch", "done", "agent"}, "ns")
+	high := int32(1000)
+	pods[0].Spec.Priority = &high
+	pods[2].Status.Phase = v1.PodSucceeded
+	controller := true
+	pods[3].OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "agent", Controller: &controller}}
+
+	drained := getDrainedPods(pods)
+	assert.Assert(t, is.Len(drained, 2))
+	assert.Check(t, is.Equal("batch", drained[0].Name))
+	assert.Check(t, is.Equal("web", drained[1].Name))
+}
+
+func TestSyncNodeDrain(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pods := testsutil.CreatePodsList([]string{"p1", "p2", "p3"}, "ns")
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+	start := time.Now().Add(time.Hour)
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        fakeNodeName,
+		Annotations: map[string]string{nodeDrainAnnotation: drainModeDrain, nodeDrainStartAnnotation: start.Format(time.RFC3339)},
+	}}
+	client := fake.NewSimpleClientset(node)
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if eviction.Name == "p2" {
+			return true, nil, apierrors.NewTooManyRequests("disruption budget", 10)
+		}
+		evicted = append(evicted, eviction.Name)
+		return true, nil, nil
+	})
+
+	p := ACIProvider{nodeName: fakeNodeName, podsL: podLister, drainBatchSize: 2}
+	recorder := record.NewFakeRecorder(10)
+	p.SetEventRecorder(recorder)
+
+	// the new pods are rejected as soon as the node is drained, the evictions wait for the start of the drain
+	assert.NilError(t, p.syncNodeDrain(context.Background(), client.CoreV1(), client.CoreV1(), time.Now()))
+	assert.Check(t, is.Equal(drainModeDrain, p.getDrain().mode))
+	assert.Check(t, !p.admitPodOnCordonedNode(context.Background(), testsutil.CreatePodObj("new", "ns")))
+	running := testsutil.CreatePodObj("running", "ns")
+	running.Status.Phase = v1.PodRunning
+	assert.Check(t, p.admitPodOnCordonedNode(context.Background(), running))
+	assert.Check(t, is.Len(evicted, 0))
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Contains(<-recorder.Events, "evicts its pods from"))
+	assert.Check(t, is.Contains(<-recorder.Events, podStatusReasonNodeCordoned))
+
+	// the pods are evicted in batches, the evictions refused by the disruption budgets are retried
+	assert.NilError(t, p.syncNodeDrain(context.Background(), client.CoreV1(), client.CoreV1(), start))
+	assert.Check(t, is.DeepEqual([]string{"p1"}, evicted))
+	assert.Check(t, is.Len(recorder.Events, 1))
+
+	// the node accepts new pods again without the annotation
+	node.Annotations = nil
+	_, err := client.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	assert.NilError(t, p.syncNodeDrain(context.Background(), client.CoreV1(), client.CoreV1(), start))
+	assert.Check(t, p.admitPodOnCordonedNode(context.Background(), testsutil.CreatePodObj("new", "ns")))
+	assert.Check(t, is.DeepEqual([]string{"p1"}, evicted))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dryRunAnnotation validates the pod without creating its container group when set to "true",
+	// and creates the container group of the pod when set to "false" while the provider runs in dry run mode.
+	dryRunAnnotation = "virtual-kubelet.io/dry-run"
+
+	podStatusReasonDryRun  = "DryRun"
+	podStatusMessageDryRun = "The pod passed the validations of the provider, no container group was created"
+)
+
+// isDryRun returns whether the container group of a pod is only validated and not created.
+func (p *ACIProvider) isDryRun(pod *v1.Pod) (bool, error) {
+	value, ok := pod.Annotations[dryRunAnnotation]
+	if !ok {
+		p.settingsLock.RLock()
+		defer p.settingsLock.RUnlock()
+		return p.dryRun, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.InvalidInputf("the value %q of annotation %s is not a boolean", value, dryRunAnnotation)
+	}
+	return dryRun, nil
+}
+
+// completeDryRun reports a pod which passed its dry run as succeeded, so that it isn't retried. Pods failing
+// the dry run get the error of CreatePod as event like any other pod.
+func (p *ACIProvider) completeDryRun(ctx context.Context, pod *v1.Pod) {
+	log.G(ctx).Infof("dry run of pod %s/%s passed", pod.Namespace, pod.Name)
+	if p.tracker == nil {
+		return
+	}
+
+	err := p.tracker.UpdatePodStatus(ctx, pod.Namespace, pod.Name, func(podStatus *v1.PodStatus) {
+		now := metav1.NewTime(time.Now())
+		podStatus.Phase = v1.PodSucceeded
+		podStatus.Reason = podStatusReasonDryRun
+		podStatus.Message = podStatusMessageDryRun
+		podStatus.StartTime = &now
+		podStatus.ContainerStatuses = make([]v1.ContainerStatus, 0, len(pod.Spec.Containers))
+		for _, container := range pod.Spec.Containers {
+			podStatus.ContainerStatuses = append(podStatus.ContainerStatuses, v1.ContainerStatus{
+				Name:  container.Name,
+				Image: container.Image,
+				State: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{
+						Reason:     podStatusReasonDryRun,
+						Message:    podStatusMessageDryRun,
+						StartedAt:  now,
+						FinishedAt: now,
+					},
+				},
+			})
+		}
+	}, false)
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.G(ctx).WithError(err).Errorf("failed to update the status of dry run pod %s/%s", pod.Namespace, pod.Name)
+	}
+}
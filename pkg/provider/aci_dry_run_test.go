@@ -0,0 +1,109 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCreatePodDryRun(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+
+	cases := []struct {
+		description     string
+		providerDryRun  bool
+		annotation      string
+		expectedCreated bool
+		expectedError   string
+	}{
+		{
+			description:     "pod is created without dry run",
+			expectedCreated: true,
+		},
+		{
+			description: "pod opts into dry run",
+			annotation:  "true",
+		},
+		{
+			description:    "provider runs in dry run mode",
+			providerDryRun: true,
+		},
+		{
+			description:     "pod opts out of dry run mode",
+			providerDryRun:  true,
+			annotation:      "false",
+			expectedCreated: true,
+		},
+		{
+			description:   "invalid annotation",
+			annotation:    "yes please",
+			expectedError: "is not a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			pod := testsutil.CreatePodObj(podName, podNamespace)
+			if tc.annotation != "" {
+				pod.Annotations = map[string]string{dryRunAnnotation: tc.annotation}
+			}
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+			created := false
+			aciMocks := createNewACIMock()
+			aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+				created = true
+				return nil
+			}
+
+			provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+				NewMockSecretLister(mockCtrl), podLister)
+			if err != nil {
+				t.Fatal("failed to create the test provider", err)
+			}
+			provider.dryRun = tc.providerDryRun
+			var updatedPod *v1.Pod
+			provider.tracker = &PodsTracker{
+				pods: podLister,
+				updateCb: func(p *v1.Pod) {
+					updatedPod = p
+				},
+			}
+
+			err = provider.CreatePod(context.Background(), pod)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				assert.Check(t, !created)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(tc.expectedCreated, created))
+			assert.Assert(t, updatedPod != nil)
+			if tc.expectedCreated {
+				assert.Check(t, is.Equal(v1.PodPhase(""), updatedPod.Status.Phase))
+				return
+			}
+			assert.Check(t, is.Equal(v1.PodSucceeded, updatedPod.Status.Phase))
+			assert.Check(t, is.Equal(podStatusReasonDryRun, updatedPod.Status.Reason))
+			assert.Check(t, is.Len(updatedPod.Status.ContainerStatuses, len(pod.Spec.Containers)))
+		})
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	discoveryv1client "k8s.io/client-go/kubernetes/typed/discovery/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// endpointSliceManagedBy marks the endpoint slices of the provider, which the endpoint slice controller of the
+	// cluster leaves alone.
+	endpointSliceManagedBy = "aci.virtual-kubelet.io"
+	// endpointSliceNodeLabel is the virtual node whose pods are the endpoints of an endpoint slice.
+	endpointSliceNodeLabel = "virtual-kubelet.io/node"
+
+	endpointSliceSyncInterval  = 30 * time.Second
+	maxEndpointSliceNameLength = 253
+)
+
+// StartEndpointSliceSync keeps an endpoint slice per service in sync with the private IP addresses of the container
+// groups of the pods of the node the service selects, so that cluster IP services reach the pods in the virtual
+// network of ACI even when the endpoint controller of the cluster doesn't publish them.
+func (p *ACIProvider) StartEndpointSliceSync(ctx context.Context, client discoveryv1client.EndpointSlicesGetter, services corev1listers.ServiceLister) {
+	go func() {
+		timer := time.NewTimer(endpointSliceSyncInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if err := p.syncEndpointSlices(ctx, client, services); err != nil {
+				log.G(ctx).WithError(err).Warn("failed to sync the endpoint slices of the services of the node")
+			}
+			timer.Reset(endpointSliceSyncInterval)
+		}
+	}()
+}
+
+// syncEndpointSlices creates, updates and deletes the endpoint slices of the node.
+func (p *ACIProvider) syncEndpointSlices(ctx context.Context, client discoveryv1client.EndpointSlicesGetter, serviceLister corev1listers.ServiceLister) error {
+	ctx, span := trace.StartSpan(ctx, "aci.syncEndpointSlices")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	// the replicas would fight over the endpoint slices
+	if !p.isLeading() {
+		return nil
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	services, err := serviceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	privateIPs, err := p.getPrivateIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]*discoveryv1.EndpointSlice{}
+	for _, service := range services {
+		if slice := p.getEndpointSlice(service, pods, privateIPs); slice != nil {
+			desired[slice.Namespace+"/"+slice.Name] = slice
+		}
+	}
+
+	existing, err := client.EndpointSlices(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			discoveryv1.LabelManagedBy: endpointSliceManagedBy,
+			endpointSliceNodeLabel:     p.nodeName,
+		}).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range existing.Items {
+		current := &existing.Items[i]
+		key := current.Namespace + "/" + current.Name
+		slice, ok := desired[key]
+		delete(desired, key)
+		if !ok {
+			err = client.EndpointSlices(current.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{})
+		} else if !apiequality.Semantic.DeepEqual(current.Endpoints, slice.Endpoints) ||
+			!apiequality.Semantic.DeepEqual(current.Ports, slice.Ports) {
+			slice.ResourceVersion = current.ResourceVersion
+			_, err = client.EndpointSlices(slice.Namespace).Update(ctx, slice, metav1.UpdateOptions{})
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	for _, slice := range desired {
+		if _, err := client.EndpointSlices(slice.Namespace).Create(ctx, slice, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPrivateIPs returns the private IP addresses of the container groups of the node, by namespace/name of their pods.
+func (p *ACIProvider) getPrivateIPs(ctx context.Context) (map[string]string, error) {
+	ips := map[string]string{}
+	for _, resourceGroup := range p.getResourceGroups() {
+		cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+		for _, cg := range cgs {
+			if cg == nil || cg.Properties == nil || cg.Properties.IPAddress == nil || stringValue(cg.Tags["NodeName"]) != p.nodeName {
+				continue
+			}
+			ip := cg.Properties.IPAddress
+			if ip.Type == nil || *ip.Type != azaciv2.ContainerGroupIPAddressTypePrivate || stringValue(ip.IP) == "" {
+				continue
+			}
+			ips[stringValue(cg.Tags["Namespace"])+"/"+stringValue(cg.Tags["PodName"])] = *ip.IP
+		}
+	}
+	return ips, nil
+}
+
+// getEndpointSlice returns the endpoint slice of the pods of the node a service selects, or nil when it selects
+// none with a private IP address.
+func (p *ACIProvider) getEndpointSlice(service *v1.Service, pods []*v1.Pod, privateIPs map[string]string) *discoveryv1.EndpointSlice {
+	if len(service.Spec.Selector) == 0 || service.Spec.Type == v1.ServiceTypeExternalName {
+		return nil
+	}
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+
+	var endpoints []discoveryv1.Endpoint
+	var selected []*v1.Pod
+	for _, pod := range pods {
+		ip, ok := privateIPs[pod.Namespace+"/"+pod.Name]
+		if !ok || pod.Namespace != service.Namespace || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		ready := isPodReady(pod) && pod.DeletionTimestamp == nil
+		terminating := pod.DeletionTimestamp != nil
+		nodeName := p.nodeName
+		endpoints = append(endpoints, discoveryv1.Endpoint{
+			Addresses: []string{ip},
+			Conditions: discoveryv1.EndpointConditions{
+				Ready:       &ready,
+				Serving:     &ready,
+				Terminating: &terminating,
+			},
+			NodeName: &nodeName,
+			TargetRef: &v1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				UID:       pod.UID,
+			},
+		})
+		selected = append(selected, pod)
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	ports := make([]discoveryv1.EndpointPort, 0, len(service.Spec.Ports))
+	for i := range service.Spec.Ports {
+		servicePort := service.Spec.Ports[i]
+		port, ok := getTargetPort(servicePort, selected)
+		if !ok {
+			continue
+		}
+		name, protocol := servicePort.Name, servicePort.Protocol
+		ports = append(ports, discoveryv1.EndpointPort{
+			Name:        &name,
+			Port:        &port,
+			Protocol:    &protocol,
+			AppProtocol: servicePort.AppProtocol,
+		})
+	}
+
+	name := service.Name + "-" + p.nodeName
+	if len(name) > maxEndpointSliceNameLength {
+		name = name[:maxEndpointSliceNameLength]
+	}
+	controller := true
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: service.Namespace,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: service.Name,
+				discoveryv1.LabelManagedBy:   endpointSliceManagedBy,
+				endpointSliceNodeLabel:       p.nodeName,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Service",
+				Name:       service.Name,
+				UID:        service.UID,
+				Controller: &controller,
+			}},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       ports,
+	}
+}
+
+// getTargetPort resolves the target port of a service port, looking up named ports in the containers of the pods.
+func getTargetPort(servicePort v1.ServicePort, pods []*v1.Pod) (int32, bool) {
+	switch servicePort.TargetPort.Type {
+	case intstr.Int:
+		if servicePort.TargetPort.IntVal == 0 {
+			return servicePort.Port, true
+		}
+		return servicePort.TargetPort.IntVal, true
+	case intstr.String:
+		if servicePort.TargetPort.StrVal == "" {
+			return servicePort.Port, true
+		}
+		for _, pod := range pods {
+			for _, container := range pod.Spec.Containers {
+				for _, port := range container.Ports {
+					if port.Name == servicePort.TargetPort.StrVal && port.Protocol == servicePort.Protocol {
+						return port.ContainerPort, true
+					}
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	condition := findPodCondition(pod.Status.Conditions, v1.PodReady)
+	return condition != nil && condition.Status == v1.ConditionTrue
+}
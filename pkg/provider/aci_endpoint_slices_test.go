@@ -0,0 +1,141 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSyncEndpointSlices(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ready := testsutil.CreatePodObj("web-ready", "ns")
+	ready.Labels = map[string]string{"app": "web"}
+	ready.Spec.Containers[0].Ports = []v1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: v1.ProtocolTCP}}
+	ready.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	unready := testsutil.CreatePodObj("web-unready", "ns")
+	unready.Labels = map[string]string{"app": "web"}
+	public := testsutil.CreatePodObj("web-public", "ns")
+	public.Labels = map[string]string{"app": "web"}
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{ready, unready, public}, nil).AnyTimes()
+
+	newCG := func(pod *v1.Pod, ip string, ipType azaciv2.ContainerGroupIPAddressType) *azaciv2.ContainerGroup {
+		cg := testsutil.CreateContainerGroupObj(pod.Name, pod.Namespace, "Running", nil, "Succeeded")
+		nodeName := fakeNodeName
+		cg.Tags["NodeName"] = &nodeName
+		cg.Properties.IPAddress = &azaciv2.IPAddress{IP: &ip, Type: &ipType}
+		return cg
+	}
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		return []*azaciv2.ContainerGroup{
+			newCG(ready, "10.0.0.4", azaciv2.ContainerGroupIPAddressTypePrivate),
+			newCG(unready, "10.0.0.5", azaciv2.ContainerGroupIPAddressTypePrivate),
+			newCG(public, "20.0.0.6", azaciv2.ContainerGroupIPAddressTypePublic),
+		}, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+
+	web := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns", UID: "web-uid"},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports:    []v1.ServicePort{{Name: "http", Port: 80, Protocol: v1.ProtocolTCP, TargetPort: intstr.FromString("http")}},
+		},
+	}
+	other := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns"},
+		Spec:       v1.ServiceSpec{Selector: map[string]string{"app": "other"}},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(web))
+	assert.NilError(t, indexer.Add(other))
+	services := corev1listers.NewServiceLister(indexer)
+
+	// the slice of a service which no longer selects pods of the node is deleted
+	stale := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-" + fakeNodeName,
+			Namespace: "ns",
+			Labels: map[string]string{
+				discoveryv1.LabelManagedBy: endpointSliceManagedBy,
+				endpointSliceNodeLabel:     fakeNodeName,
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(stale)
+	ctx := context.Background()
+	assert.NilError(t, provider.syncEndpointSlices(ctx, client.DiscoveryV1(), services))
+
+	slices, err := client.DiscoveryV1().EndpointSlices("ns").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(slices.Items, 1))
+	slice := slices.Items[0]
+	assert.Check(t, is.Equal("web-"+fakeNodeName, slice.Name))
+	assert.Check(t, is.Equal("web", slice.Labels[discoveryv1.LabelServiceName]))
+	assert.Check(t, is.Equal("web-uid", string(slice.OwnerReferences[0].UID)))
+	assert.Assert(t, is.Len(slice.Endpoints, 2), "the pod with a public IP address isn't an endpoint")
+	assert.Check(t, is.DeepEqual([]string{"10.0.0.4"}, slice.Endpoints[0].Addresses))
+	assert.Check(t, *slice.Endpoints[0].Conditions.Ready)
+	assert.Check(t, is.DeepEqual([]string{"10.0.0.5"}, slice.Endpoints[1].Addresses))
+	assert.Check(t, !*slice.Endpoints[1].Conditions.Ready)
+	assert.Assert(t, is.Len(slice.Ports, 1))
+	assert.Check(t, is.Equal(int32(8080), *slice.Ports[0].Port))
+
+	// the slice is updated once the pod is ready
+	unready.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	assert.NilError(t, provider.syncEndpointSlices(ctx, client.DiscoveryV1(), services))
+	updated, err := client.DiscoveryV1().EndpointSlices("ns").Get(ctx, slice.Name, metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, *updated.Endpoints[1].Conditions.Ready)
+
+	// a standby replica leaves the slices alone
+	provider.SetLeading(ctx, false)
+	assert.NilError(t, indexer.Delete(web))
+	assert.NilError(t, provider.syncEndpointSlices(ctx, client.DiscoveryV1(), services))
+	slices, err = client.DiscoveryV1().EndpointSlices("ns").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(slices.Items, 1))
+}
+
+func TestGetTargetPort(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].Ports = []v1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: v1.ProtocolTCP}}
+	pods := []*v1.Pod{pod}
+
+	port, ok := getTargetPort(v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP}, pods)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(int32(80), port))
+
+	port, ok = getTargetPort(v1.ServicePort{Port: 80, TargetPort: intstr.FromInt(9090)}, pods)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(int32(9090), port))
+
+	port, ok = getTargetPort(v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP, TargetPort: intstr.FromString("http")}, pods)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(int32(8080), port))
+
+	_, ok = getTargetPort(v1.ServicePort{Port: 80, Protocol: v1.ProtocolUDP, TargetPort: intstr.FromString("http")}, pods)
+	assert.Check(t, !ok)
+}
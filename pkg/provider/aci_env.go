@@ -0,0 +1,296 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// The reasons of the events of missing environment variable sources are the ones of the kubelet.
+const (
+	eventReasonOptionalConfigMapNotFound    = "OptionalConfigMapNotFound"
+	eventReasonOptionalConfigMapKeyNotFound = "OptionalConfigMapKeyNotFound"
+	eventReasonOptionalSecretNotFound       = "OptionalSecretNotFound"
+	eventReasonOptionalSecretKeyNotFound    = "OptionalSecretKeyNotFound"
+	eventReasonMandatoryConfigMapNotFound   = "MandatoryConfigMapNotFound"
+	eventReasonMandatoryConfigMapKeyMissing = "MandatoryConfigMapKeyNotFound"
+	eventReasonMandatorySecretNotFound      = "MandatorySecretNotFound"
+	eventReasonMandatorySecretKeyMissing    = "MandatorySecretKeyNotFound"
+)
+
+// envError is returned when a mandatory source of an environment variable is missing.
+type envError struct {
+	reason string
+	err    error
+}
+
+func (e *envError) Error() string {
+	return e.err.Error()
+}
+
+func (e *envError) Unwrap() error {
+	return e.err
+}
+
+// Cause returns the wrapped error, so that errdefs sees the invalid input.
+func (e *envError) Cause() error {
+	return e.err
+}
+
+// envSource reads the data of the config maps and secrets the environment variables of a container come from.
+type envSource struct {
+	p   *ACIProvider
+	pod *v1.Pod
+	// report emits the events of the optional sources which are missing.
+	report bool
+}
+
+// getEnvironmentVariables returns the environment variables of a container, with their envFrom and valueFrom
+// sources resolved against the config map and secret listers and their $(VAR) references expanded, along with
+// the values of all the variables, which the references of the command and args are expanded with. The variables
+// coming from secrets are secure values.
+//
+// The pod controller of the virtual kubelet resolves the environment before calling CreatePod, which loses the
+// sources of the variables. Its pods are recognized by their empty but not nil envFrom, and the environment is then
+// resolved again from the pod of the informer, so that the variables coming from secrets stay secure values.
+func (p *ACIProvider) getEnvironmentVariables(ctx context.Context, pod *v1.Pod, container *v1.Container) ([]*azaciv2.EnvironmentVariable, map[string]string, error) {
+	spec := container
+	resolved := container.EnvFrom != nil && len(container.EnvFrom) == 0
+	if resolved {
+		if original := p.getInformerContainer(pod, container.Name); original != nil {
+			spec = original
+		}
+	}
+	source := envSource{p: p, pod: pod, report: !resolved}
+	// the values of the environment flattened by the pod controller are already expanded
+	expand := spec != container || !resolved
+
+	envVars := map[string]*azaciv2.EnvironmentVariable{}
+	values := map[string]string{}
+	var names []string
+	set := func(name, value string, secure bool) {
+		envVar := &azaciv2.EnvironmentVariable{Name: &name}
+		if secure {
+			envVar.SecureValue = &value
+		} else {
+			envVar.Value = &value
+		}
+		if _, ok := envVars[name]; !ok {
+			names = append(names, name)
+		}
+		envVars[name] = envVar
+		values[name] = value
+	}
+
+	for _, envFrom := range spec.EnvFrom {
+		data, secure, err := source.getEnvFromData(ctx, envFrom)
+		if err != nil {
+			return nil, nil, err
+		}
+		for key, value := range data {
+			set(envFrom.Prefix+key, value, secure)
+		}
+	}
+
+	for _, env := range spec.Env {
+		if env.ValueFrom == nil {
+			// as for the kubelet, only the variables defined before can be referenced
+			value := env.Value
+			if expand {
+				value = util.Expand(value, util.ExpansionMappingFor(values))
+			}
+			set(env.Name, value, false)
+			continue
+		}
+		value, secure, ok, err := source.getEnvValueFrom(ctx, env.ValueFrom)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			// the sources resolved by the pod controller only, like the resource fields, keep its value
+			if value, ok = getEnvValue(container.Env, env.Name); !ok {
+				continue
+			}
+		}
+		set(env.Name, value, secure || env.ValueFrom.SecretKeyRef != nil)
+	}
+
+	environmentVariables := make([]*azaciv2.EnvironmentVariable, 0, len(names))
+	for _, name := range names {
+		envVar := envVars[name]
+		// empty values are not supported by ACI
+		if stringValue(envVar.Value) == "" && stringValue(envVar.SecureValue) == "" {
+			continue
+		}
+		environmentVariables = append(environmentVariables, envVar)
+	}
+	return environmentVariables, values, nil
+}
+
+// expandCommand returns a copy of a container with the $(VAR) references of its command and args expanded with the
+// values of its environment variables, which the pod controller does not do.
+func expandCommand(container v1.Container, values map[string]string) v1.Container {
+	mapping := util.ExpansionMappingFor(values)
+	expandAll := func(input []string) []string {
+		if input == nil {
+			return nil
+		}
+		expanded := make([]string, 0, len(input))
+		for _, s := range input {
+			expanded = append(expanded, util.Expand(s, mapping))
+		}
+		return expanded
+	}
+	container.Command = expandAll(container.Command)
+	container.Args = expandAll(container.Args)
+	return container
+}
+
+// getInformerContainer returns the container of the pod of the informer, or nil when the pod was recreated.
+func (p *ACIProvider) getInformerContainer(pod *v1.Pod, name string) *v1.Container {
+	if p.podsL == nil {
+		return nil
+	}
+	original, err := p.podsL.Pods(pod.Namespace).Get(pod.Name)
+	if err != nil || original == nil || original.UID != pod.UID {
+		return nil
+	}
+	for _, containers := range [][]v1.Container{original.Spec.InitContainers, original.Spec.Containers} {
+		for i := range containers {
+			if containers[i].Name == name {
+				return &containers[i]
+			}
+		}
+	}
+	return nil
+}
+
+func getEnvValue(env []v1.EnvVar, name string) (string, bool) {
+	for _, e := range env {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// getEnvFromData returns the data of the config map or secret of an envFrom, and whether it comes from a secret.
+func (s *envSource) getEnvFromData(ctx context.Context, envFrom v1.EnvFromSource) (map[string]string, bool, error) {
+	switch {
+	case envFrom.ConfigMapRef != nil:
+		ref := envFrom.ConfigMapRef
+		configMap, err := s.p.configL.ConfigMaps(s.pod.Namespace).Get(ref.Name)
+		if err != nil {
+			return nil, false, s.missing(ctx, err, ref.Optional, eventReasonOptionalConfigMapNotFound,
+				eventReasonMandatoryConfigMapNotFound, "configmap %q not found", ref.Name)
+		}
+		return configMap.Data, false, nil
+
+	case envFrom.SecretRef != nil:
+		ref := envFrom.SecretRef
+		secret, err := s.p.secretL.Secrets(s.pod.Namespace).Get(ref.Name)
+		if err != nil {
+			return nil, true, s.missing(ctx, err, ref.Optional, eventReasonOptionalSecretNotFound,
+				eventReasonMandatorySecretNotFound, "secret %q not found", ref.Name)
+		}
+		data := make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			data[key] = string(value)
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
+
+// getEnvValueFrom returns the value of a config map key, secret key or pod field reference, whether it comes from
+// a secret, and whether it was resolved.
+func (s *envSource) getEnvValueFrom(ctx context.Context, valueFrom *v1.EnvVarSource) (string, bool, bool, error) {
+	switch {
+	case valueFrom.ConfigMapKeyRef != nil:
+		ref := valueFrom.ConfigMapKeyRef
+		configMap, err := s.p.configL.ConfigMaps(s.pod.Namespace).Get(ref.Name)
+		if err != nil {
+			return "", false, false, s.missing(ctx, err, ref.Optional, eventReasonOptionalConfigMapNotFound,
+				eventReasonMandatoryConfigMapNotFound, "configmap %q not found", ref.Name)
+		}
+		value, ok := configMap.Data[ref.Key]
+		if !ok {
+			return "", false, false, s.missing(ctx, nil, ref.Optional, eventReasonOptionalConfigMapKeyNotFound,
+				eventReasonMandatoryConfigMapKeyMissing, "key %q not found in configmap %q", ref.Key, ref.Name)
+		}
+		return value, false, true, nil
+
+	case valueFrom.SecretKeyRef != nil:
+		ref := valueFrom.SecretKeyRef
+		secret, err := s.p.secretL.Secrets(s.pod.Namespace).Get(ref.Name)
+		if err != nil {
+			return "", true, false, s.missing(ctx, err, ref.Optional, eventReasonOptionalSecretNotFound,
+				eventReasonMandatorySecretNotFound, "secret %q not found", ref.Name)
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return "", true, false, s.missing(ctx, nil, ref.Optional, eventReasonOptionalSecretKeyNotFound,
+				eventReasonMandatorySecretKeyMissing, "key %q not found in secret %q", ref.Key, ref.Name)
+		}
+		return string(value), true, true, nil
+
+	case valueFrom.FieldRef != nil:
+		value, ok := getPodFieldValue(s.pod, valueFrom.FieldRef.FieldPath)
+		return value, false, ok, nil
+	}
+	return "", false, false, nil
+}
+
+// missing handles a missing source: optional sources are skipped with an event, while mandatory sources fail the
+// pod. Errors other than not found fail the pod in both cases.
+func (s *envSource) missing(ctx context.Context, err error, optional *bool, optionalReason, mandatoryReason, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if err != nil && !k8serrors.IsNotFound(err) && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("error reading the environment variables: %s: %w", message, err)
+	}
+	if optional != nil && *optional {
+		log.G(ctx).Debugf("skipping optional environment variable source: %s", message)
+		if s.report && s.p.eventRecorder != nil {
+			s.p.eventRecorder.Event(s.pod, v1.EventTypeWarning, optionalReason, message)
+		}
+		return nil
+	}
+	return &envError{reason: mandatoryReason, err: errdefs.InvalidInput(message)}
+}
+
+// getPodFieldValue returns the value of the pod fields which can be referenced by environment variables and are
+// known before the container group is created.
+func getPodFieldValue(pod *v1.Pod, fieldPath string) (string, bool) {
+	switch fieldPath {
+	case "metadata.name":
+		return pod.Name, true
+	case "metadata.namespace":
+		return pod.Namespace, true
+	case "metadata.uid":
+		return string(pod.UID), true
+	case "spec.nodeName":
+		return pod.Spec.NodeName, true
+	case "spec.serviceAccountName":
+		return pod.Spec.ServiceAccountName, true
+	}
+	for prefix, values := range map[string]map[string]string{
+		"metadata.labels":      pod.Labels,
+		"metadata.annotations": pod.Annotations,
+	} {
+		if key := strings.TrimPrefix(fieldPath, prefix); key != fieldPath && strings.HasPrefix(key, "['") && strings.HasSuffix(key, "']") {
+			return values[strings.TrimSuffix(strings.TrimPrefix(key, "['"), "']")], true
+		}
+	}
+	return "", false
+}
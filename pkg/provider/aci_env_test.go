@@ -0,0 +1,162 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newEnvTestProvider(t *testing.T, pods ...*v1.Pod) (*ACIProvider, *record.FakeRecorder) {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	assert.NilError(t, configMaps.Add(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"},
+		Data:       map[string]string{"LEVEL": "debug", "MODE": "fast"},
+	}))
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	assert.NilError(t, secrets.Add(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "credentials"},
+		Data:       map[string][]byte{"PASSWORD": []byte("secret")},
+	}))
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	for _, pod := range pods {
+		assert.NilError(t, podIndexer.Add(pod))
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	return &ACIProvider{
+		configL:       corev1listers.NewConfigMapLister(configMaps),
+		secretL:       corev1listers.NewSecretLister(secrets),
+		podsL:         corev1listers.NewPodLister(podIndexer),
+		eventRecorder: recorder,
+	}, recorder
+}
+
+func envValues(envVars []*azaciv2.EnvironmentVariable) map[string]string {
+	values := map[string]string{}
+	for _, envVar := range envVars {
+		if envVar.SecureValue != nil {
+			values[*envVar.Name] = "secure:" + *envVar.SecureValue
+		} else {
+			values[*envVar.Name] = *envVar.Value
+		}
+	}
+	return values
+}
+
+func TestGetEnvironmentVariables(t *testing.T) {
+	optional := true
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].EnvFrom = []v1.EnvFromSource{
+		{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "config"}}},
+		{Prefix: "DB_", SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "credentials"}}},
+		{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+	}
+	pod.Spec.Containers[0].Env = []v1.EnvVar{
+		{Name: "MODE", Value: "slow"},
+		{Name: "EMPTY"},
+		{Name: "POD_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+		{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "credentials"}, Key: "PASSWORD"}}},
+		{Name: "OPTIONAL", ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "config"}, Key: "missing", Optional: &optional}}},
+	}
+
+	p, recorder := newEnvTestProvider(t)
+	envVars, _, err := p.getEnvironmentVariables(context.Background(), pod, &pod.Spec.Containers[0])
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"LEVEL":       "debug",
+		"MODE":        "slow",
+		"DB_PASSWORD": "secure:secret",
+		"POD_NAME":    "pod",
+		"TOKEN":       "secure:secret",
+	}, envValues(envVars)))
+
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonOptionalSecretNotFound))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonOptionalConfigMapKeyNotFound))
+}
+
+func TestGetEnvironmentVariablesMissingMandatory(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].Env = []v1.EnvVar{
+		{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "credentials"}, Key: "missing"}}},
+	}
+
+	p, _ := newEnvTestProvider(t)
+	_, _, err := p.getEnvironmentVariables(context.Background(), pod, &pod.Spec.Containers[0])
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.Equal(eventReasonMandatorySecretKeyMissing, getFailureReason(eventReasonCreateFailed, err)))
+}
+
+func TestGetEnvironmentVariablesResolvedByPodController(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].Env = []v1.EnvVar{
+		{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "credentials"}, Key: "PASSWORD"}}},
+		{Name: "CPU", ValueFrom: &v1.EnvVarSource{ResourceFieldRef: &v1.ResourceFieldSelector{Resource: "limits.cpu"}}},
+	}
+
+	// the pod controller flattens the environment of a copy of the pod
+	resolved := pod.DeepCopy()
+	resolved.Spec.Containers[0].EnvFrom = []v1.EnvFromSource{}
+	resolved.Spec.Containers[0].Env = []v1.EnvVar{{Name: "TOKEN", Value: "secret"}, {Name: "CPU", Value: "2"}}
+
+	p, _ := newEnvTestProvider(t, pod)
+	envVars, _, err := p.getEnvironmentVariables(context.Background(), resolved, &resolved.Spec.Containers[0])
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"TOKEN": "secure:secret",
+		"CPU":   "2",
+	}, envValues(envVars)))
+}
+
+func TestGetEnvironmentVariablesExpansion(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	container := &pod.Spec.Containers[0]
+	container.EnvFrom = []v1.EnvFromSource{
+		{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "config"}}},
+	}
+	container.Env = []v1.EnvVar{
+		{Name: "URL", Value: "http://$(HOST):$(PORT)/$(LEVEL)"},
+		{Name: "HOST", Value: "localhost"},
+		{Name: "ADDRESS", Value: "$(HOST)"},
+		{Name: "ESCAPED", Value: "$$(HOST) $(HOST"},
+	}
+	container.Command = []string{"/bin/app", "--address=$(ADDRESS)"}
+	container.Args = []string{"--mode", "$(MODE)", "$(UNDEFINED)", "$$(MODE)"}
+
+	p, _ := newEnvTestProvider(t)
+	envVars, values, err := p.getEnvironmentVariables(context.Background(), pod, container)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"LEVEL": "debug",
+		"MODE":  "fast",
+		// references to the variables defined after are not expanded
+		"URL":     "http://$(HOST):$(PORT)/debug",
+		"HOST":    "localhost",
+		"ADDRESS": "localhost",
+		"ESCAPED": "$(HOST) $(HOST",
+	}, envValues(envVars)))
+
+	expanded := expandCommand(*container, values)
+	assert.Check(t, is.DeepEqual([]string{"/bin/app", "--address=localhost"}, expanded.Command))
+	assert.Check(t, is.DeepEqual([]string{"--mode", "fast", "$(UNDEFINED)", "$(MODE)"}, expanded.Args))
+	assert.Check(t, is.Equal("$(MODE)", container.Args[1]))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	eventGridSubscriptionValidationEvent = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	eventGridTokenQueryParameter         = "token"
+	containerGroupResourceType           = "/providers/microsoft.containerinstance/containergroups/"
+	maxEventGridRequestBytes             = 1 << 20
+)
+
+// eventGridEvent is an event delivered by Azure Event Grid in the Event Grid schema.
+type eventGridEvent struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Subject   string          `json:"subject"`
+	EventType string          `json:"eventType"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type eventGridValidationData struct {
+	ValidationCode string `json:"validationCode"`
+}
+
+type eventGridValidationResponse struct {
+	ValidationResponse string `json:"validationResponse"`
+}
+
+// EventGridHandler receives the resource events of the container groups from an Azure Event Grid
+// webhook subscription and refreshes the status of the affected pods right away, instead of waiting
+// for the next status update loop. The subscription endpoint has to carry the token as query parameter.
+func (p *ACIProvider) EventGridHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trace.StartSpan(r.Context(), "aci.EventGridHandler")
+		defer span.End()
+		ctx = addAzureAttributes(ctx, span, p)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get(eventGridTokenQueryParameter)), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var events []eventGridEvent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventGridRequestBytes)).Decode(&events); err != nil {
+			http.Error(w, "invalid events: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, event := range events {
+			if event.EventType == eventGridSubscriptionValidationEvent {
+				var data eventGridValidationData
+				if err := json.Unmarshal(event.Data, &data); err != nil {
+					http.Error(w, "invalid validation event: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(eventGridValidationResponse{ValidationResponse: data.ValidationCode}); err != nil {
+					log.G(ctx).WithError(err).Error("failed to encode event grid validation response")
+				}
+				return
+			}
+		}
+
+		for _, event := range events {
+			p.handleContainerGroupEvent(ctx, event)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// handleContainerGroupEvent refreshes the status of the pod backed by the container group the event is about.
+func (p *ACIProvider) handleContainerGroupEvent(ctx context.Context, event eventGridEvent) {
+	logger := log.G(ctx).WithFields(log.Fields{
+		"eventID":   event.ID,
+		"eventType": event.EventType,
+		"subject":   event.Subject,
+	})
+
+	resourceGroup, cgName, ok := parseContainerGroupID(event.Subject)
+	if !ok || !p.isProviderResourceGroup(resourceGroup) {
+		logger.Debug("ignoring event which is not about a container group of this provider")
+		return
+	}
+	if p.tracker == nil {
+		logger.Debug("ignoring container group event, pod tracking is not started yet")
+		return
+	}
+
+	pod := p.getPodByContainerGroupName(cgName)
+	if pod == nil {
+		logger.Debug("ignoring event of a container group without pod")
+		return
+	}
+	logger.Debugf("refreshing status of pod %s/%s", pod.Namespace, pod.Name)
+	if err := p.tracker.RefreshPodStatus(ctx, pod.Namespace, pod.Name); err != nil && !errdefs.IsNotFound(err) {
+		logger.WithError(err).Errorf("failed to refresh status of pod %s/%s", pod.Namespace, pod.Name)
+	}
+}
+
+// getPodByContainerGroupName returns the pod of a container group named <namespace>-<pod>. Namespaces and pod
+// names may contain dashes, so every split of the name is looked up with the namespace and name index of the
+// lister, instead of listing all the pods for every event.
+func (p *ACIProvider) getPodByContainerGroupName(cgName string) *v1.Pod {
+	cgName = strings.ToLower(cgName)
+	for i := strings.Index(cgName, "-"); i >= 0; {
+		pod, err := p.podsL.Pods(cgName[:i]).Get(cgName[i+1:])
+		if err == nil && pod != nil {
+			return pod
+		}
+		next := strings.Index(cgName[i+1:], "-")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+// parseContainerGroupID returns the resource group and the name of a container group resource ID.
+func parseContainerGroupID(id string) (string, string, bool) {
+	lowerID := strings.ToLower(id)
+	i := strings.Index(lowerID, containerGroupResourceType)
+	if i < 0 {
+		return "", "", false
+	}
+	name := id[i+len(containerGroupResourceType):]
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+
+	prefix := strings.Split(strings.Trim(id[:i], "/"), "/")
+	for j := 0; j+1 < len(prefix); j++ {
+		if strings.EqualFold(prefix[j], "resourceGroups") {
+			return prefix[j+1], name, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,131 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type refreshTrackingHandler struct {
+	PodsTrackerHandler
+	fetched []string
+}
+
+func (h *refreshTrackingHandler) FetchPodStatus(ctx context.Context, ns, name string) (*v1.PodStatus, error) {
+	h.fetched = append(h.fetched, ns+"/"+name)
+	return &v1.PodStatus{Phase: v1.PodRunning}, nil
+}
+
+func TestParseContainerGroupID(t *testing.T) {
+	cases := []struct {
+		id            string
+		resourceGroup string
+		cgName        string
+		ok            bool
+	}{
+		{
+			id:            "/subscriptions/sub/resourceGroups/vk-rg/providers/Microsoft.ContainerInstance/containerGroups/ns-pod",
+			resourceGroup: "vk-rg",
+			cgName:        "ns-pod",
+			ok:            true,
+		},
+		{
+			id: "/subscriptions/sub/resourceGroups/vk-rg/providers/Microsoft.Network/virtualNetworks/vnet",
+			ok: false,
+		},
+		{
+			id: "/subscriptions/sub/resourceGroups/vk-rg/providers/Microsoft.ContainerInstance/containerGroups/ns-pod/containers/c",
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.id, func(t *testing.T) {
+			resourceGroup, cgName, ok := parseContainerGroupID(tc.id)
+			assert.Check(t, is.Equal(tc.ok, ok))
+			assert.Check(t, is.Equal(tc.resourceGroup, resourceGroup))
+			assert.Check(t, is.Equal(tc.cgName, cgName))
+		})
+	}
+}
+
+func TestEventGridHandler(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	token := "secret-token"
+
+	// the pods are looked up by the namespace and name of every split of the container group name
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range testsutil.CreatePodsList([]string{podName, "other"}, podNamespace) {
+		assert.NilError(t, podIndexer.Add(pod))
+	}
+	podLister := corev1listers.NewPodLister(podIndexer)
+
+	handler := &refreshTrackingHandler{}
+	updatedPods := make([]*v1.Pod, 0)
+	provider := &ACIProvider{
+		resourceGroup: fakeResourceGroup,
+		podsL:         podLister,
+	}
+	provider.tracker = &PodsTracker{
+		pods: podLister,
+		updateCb: func(p *v1.Pod) {
+			updatedPods = append(updatedPods, p)
+		},
+		handler: handler,
+	}
+
+	send := func(query string, events []eventGridEvent) *httptest.ResponseRecorder {
+		body, err := json.Marshal(events)
+		assert.NilError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/events/containergroups"+query, strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		provider.EventGridHandler(token).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("request without token is rejected", func(t *testing.T) {
+		rec := send("", nil)
+		assert.Check(t, is.Equal(http.StatusUnauthorized, rec.Code))
+	})
+
+	t.Run("subscription validation is answered", func(t *testing.T) {
+		rec := send("?token="+token, []eventGridEvent{{
+			EventType: eventGridSubscriptionValidationEvent,
+			Data:      json.RawMessage(`{"validationCode":"512d38b6-c7b8-40c8-89fe-f46f9e9622b6"}`),
+		}})
+		assert.Check(t, is.Equal(http.StatusOK, rec.Code))
+		assert.Check(t, is.Contains(rec.Body.String(), "512d38b6-c7b8-40c8-89fe-f46f9e9622b6"))
+	})
+
+	t.Run("container group event refreshes pod status", func(t *testing.T) {
+		rec := send("?token="+token, []eventGridEvent{
+			{
+				EventType: "Microsoft.Resources.ResourceWriteSuccess",
+				Subject:   "/subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.ContainerInstance/containerGroups/" + containerGroupName(podNamespace, podName),
+			},
+			{
+				EventType: "Microsoft.Resources.ResourceWriteSuccess",
+				Subject:   "/subscriptions/sub/resourceGroups/" + fakeResourceGroup + "/providers/Microsoft.ContainerInstance/containerGroups/" + containerGroupName(podNamespace, podName),
+			},
+		})
+		assert.Check(t, is.Equal(http.StatusOK, rec.Code))
+		assert.Check(t, is.DeepEqual([]string{podNamespace + "/" + podName}, handler.fetched))
+		assert.Check(t, is.Equal(1, len(updatedPods)))
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+)
+
+const (
+	defaultKubeProxyMasterURI   = "10.0.0.1"
+	defaultKubeProxyClusterCIDR = "10.240.0.0/16"
+)
+
+// extensionConfig is a deployment extension added to all the container groups supporting extensions, e.g. to
+// configure DNS or networking beyond the kube-proxy extension.
+type extensionConfig struct {
+	Name              string
+	ExtensionType     string
+	Version           string
+	Settings          map[string]string
+	ProtectedSettings map[string]string
+}
+
+// extensionsConfig are the deployment extensions of the container groups, see setACIExtensions.
+type extensionsConfig struct {
+	disableKubeProxy      bool
+	enableRealtimeMetrics bool
+	kubeProxyMasterURI    string
+	kubeProxyClusterCIDR  string
+	customExtensions      []*azaciv2.DeploymentExtensionSpec
+}
+
+// parseExtensions validates the custom extensions of the config file.
+func parseExtensions(extensions []extensionConfig) ([]*azaciv2.DeploymentExtensionSpec, error) {
+	specs := make([]*azaciv2.DeploymentExtensionSpec, 0, len(extensions))
+	names := make(map[string]bool, len(extensions))
+	for _, extension := range extensions {
+		if extension.Name == "" || extension.ExtensionType == "" || extension.Version == "" {
+			return nil, fmt.Errorf("extension %q must have a name, an extension type and a version", extension.Name)
+		}
+		if names[extension.Name] {
+			return nil, fmt.Errorf("extension %q is configured twice", extension.Name)
+		}
+		names[extension.Name] = true
+
+		name, extensionType, version := extension.Name, extension.ExtensionType, extension.Version
+		spec := &azaciv2.DeploymentExtensionSpec{
+			Name: &name,
+			Properties: &azaciv2.DeploymentExtensionSpecProperties{
+				ExtensionType:     &extensionType,
+				Version:           &version,
+				Settings:          map[string]string{},
+				ProtectedSettings: map[string]string{},
+			},
+		}
+		if extension.Settings != nil {
+			spec.Properties.Settings = extension.Settings
+		}
+		if extension.ProtectedSettings != nil {
+			spec.Properties.ProtectedSettings = extension.ProtectedSettings
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// setACIExtensions sets the deployment extensions of the container groups: the kube-proxy extension, so that the
+// pods in a virtual network reach the services of the cluster, the realtime metrics extension when enabled, and
+// the custom extensions of the config file. The master URI and cluster CIDR of kube-proxy default to the
+// MASTER_URI and CLUSTER_CIDR environment variables.
+func (p *ACIProvider) setACIExtensions(ctx context.Context) error {
+	config := p.extensions
+	if p.providernetwork.SubnetName != "" {
+		if !config.disableKubeProxy {
+			masterURI := config.kubeProxyMasterURI
+			if masterURI == "" {
+				masterURI = os.Getenv("MASTER_URI")
+			}
+			if masterURI == "" {
+				masterURI = defaultKubeProxyMasterURI
+			}
+			clusterCIDR := config.kubeProxyClusterCIDR
+			if clusterCIDR == "" {
+				clusterCIDR = os.Getenv("CLUSTER_CIDR")
+			}
+			if clusterCIDR == "" {
+				clusterCIDR = defaultKubeProxyClusterCIDR
+			}
+
+			kubeExtensions, err := client.GetKubeProxyExtension(serviceAccountSecretMountPath, masterURI, clusterCIDR)
+			if err != nil {
+				return fmt.Errorf("error creating kube proxy extension: %v", err)
+			}
+			p.containerGroupExtensions = append(p.containerGroupExtensions, kubeExtensions)
+		}
+
+		if config.enableRealtimeMetrics || os.Getenv("ENABLE_REAL_TIME_METRICS") == "true" {
+			realtimeExtension := client.GetRealtimeMetricsExtension()
+			p.containerGroupExtensions = append(p.containerGroupExtensions, realtimeExtension)
+		}
+	}
+
+	for _, extension := range config.customExtensions {
+		for _, existing := range p.containerGroupExtensions {
+			if *existing.Name == *extension.Name {
+				return fmt.Errorf("extension %q conflicts with the %s extension of the provider", *extension.Name, *existing.Name)
+			}
+		}
+		p.containerGroupExtensions = append(p.containerGroupExtensions, extension)
+	}
+	return nil
+}
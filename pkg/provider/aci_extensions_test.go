@@ -0,0 +1,57 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestParseExtensions(t *testing.T) {
+	extensions, err := parseExtensions([]extensionConfig{
+		{Name: "dns", ExtensionType: "custom-dns", Version: "1.0", Settings: map[string]string{"nameserver": "10.0.0.10"}},
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(extensions, 1))
+	assert.Check(t, is.Equal("custom-dns", *extensions[0].Properties.ExtensionType))
+	assert.Check(t, is.DeepEqual(map[string]string{"nameserver": "10.0.0.10"}, extensions[0].Properties.Settings))
+	assert.Check(t, extensions[0].Properties.ProtectedSettings != nil)
+
+	_, err = parseExtensions([]extensionConfig{{Name: "dns", ExtensionType: "custom-dns"}})
+	assert.Check(t, is.ErrorContains(err, "must have a name, an extension type and a version"))
+	_, err = parseExtensions([]extensionConfig{
+		{Name: "dns", ExtensionType: "custom-dns", Version: "1.0"},
+		{Name: "dns", ExtensionType: "custom-dns", Version: "2.0"},
+	})
+	assert.Check(t, is.ErrorContains(err, "configured twice"))
+}
+
+func TestSetACIExtensions(t *testing.T) {
+	custom, err := parseExtensions([]extensionConfig{{Name: "dns", ExtensionType: "custom-dns", Version: "1.0"}})
+	assert.NilError(t, err)
+
+	// the custom extensions are added outside of a virtual network
+	p := ACIProvider{extensions: extensionsConfig{customExtensions: custom}}
+	assert.NilError(t, p.setACIExtensions(context.Background()))
+	assert.Assert(t, is.Len(p.containerGroupExtensions, 1))
+	assert.Check(t, is.Equal("dns", *p.containerGroupExtensions[0].Name))
+
+	p = ACIProvider{extensions: extensionsConfig{disableKubeProxy: true, enableRealtimeMetrics: true, customExtensions: custom}}
+	p.providernetwork.SubnetName = "aci"
+	assert.NilError(t, p.setACIExtensions(context.Background()))
+	assert.Assert(t, is.Len(p.containerGroupExtensions, 2))
+	assert.Check(t, is.Equal(client.ExtensionTypeRealtimeMetrics, *p.containerGroupExtensions[0].Name))
+	assert.Check(t, is.Equal("dns", *p.containerGroupExtensions[1].Name))
+
+	conflicting, err := parseExtensions([]extensionConfig{{Name: client.ExtensionTypeRealtimeMetrics, ExtensionType: "custom", Version: "1.0"}})
+	assert.NilError(t, err)
+	p = ACIProvider{extensions: extensionsConfig{disableKubeProxy: true, enableRealtimeMetrics: true, customExtensions: conflicting}}
+	p.providernetwork.SubnetName = "aci"
+	assert.Check(t, is.ErrorContains(p.setACIExtensions(context.Background()), "conflicts"))
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// placedRegionAnnotation is set on the pods by the provider to the region their container group was created in,
+	// when a failover region is configured.
+	placedRegionAnnotation = "virtual-kubelet.io/placed-region"
+
+	defaultFailoverThreshold     = 3
+	defaultFailoverProbeInterval = time.Minute
+)
+
+// regionFailover tracks the availability of the region of the provider: after failoverThreshold consecutive
+// capacity or availability errors, the container groups are created in the failover region first. Once the region
+// answers a probe again, the next container group tries it first, and the provider fails back when it succeeds.
+type regionFailover struct {
+	region    string
+	threshold int
+	interval  time.Duration
+
+	lock       sync.Mutex
+	failures   int
+	failedOver bool
+	// probing is set when the region of the provider answered the last probe while failed over.
+	probing bool
+}
+
+func newRegionFailover(region string, threshold int, interval time.Duration) *regionFailover {
+	if threshold <= 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if interval <= 0 {
+		interval = defaultFailoverProbeInterval
+	}
+	return &regionFailover{region: region, threshold: threshold, interval: interval}
+}
+
+// getRegions returns the regions to try creating a container group in: the failover region comes first while
+// failed over, and last otherwise.
+func (f *regionFailover) getRegions(regions []string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ordered := make([]string, 0, len(regions)+1)
+	if f.failedOver && !f.probing {
+		ordered = append(ordered, f.region)
+	}
+	for _, region := range regions {
+		if region != f.region {
+			ordered = append(ordered, region)
+		}
+	}
+	if !containsRegion(ordered, f.region) {
+		ordered = append(ordered, f.region)
+	}
+	return ordered
+}
+
+// recordFailure counts a capacity or availability error of the region of the provider, and returns whether the
+// provider just failed over.
+func (f *regionFailover) recordFailure() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures++
+	f.probing = false
+	if f.failedOver || f.failures < f.threshold {
+		return false
+	}
+	f.failedOver = true
+	return true
+}
+
+// recordSuccess resets the errors of the region of the provider, and returns whether the provider just failed back.
+func (f *regionFailover) recordSuccess() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	failedBack := f.failedOver
+	f.failures = 0
+	f.failedOver = false
+	f.probing = false
+	return failedBack
+}
+
+func (f *regionFailover) isFailedOver() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.failedOver
+}
+
+func (f *regionFailover) setProbing() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.failedOver {
+		f.probing = true
+	}
+}
+
+// getFailoverRegions returns the placement regions of a pod with the failover region, unless the pod picked its
+// region.
+func (p *ACIProvider) getFailoverRegions(pod *v1.Pod, regions []string) []string {
+	if p.regionFailover == nil {
+		return regions
+	}
+	if _, ok := pod.Annotations[regionAnnotation]; ok {
+		return regions
+	}
+	return p.regionFailover.getRegions(regions)
+}
+
+// recordRegionOutcome tracks the capacity and availability errors of the region of the provider for the failover.
+func (p *ACIProvider) recordRegionOutcome(ctx context.Context, region string, err error) {
+	if p.regionFailover == nil || region != p.region {
+		return
+	}
+	switch {
+	case err == nil:
+		if p.regionFailover.recordSuccess() {
+			log.G(ctx).Infof("region %s is available again, failing back from region %s", p.region, p.regionFailover.region)
+		}
+	case isRegionCapacityError(err):
+		if p.regionFailover.recordFailure() {
+			log.G(ctx).WithError(err).Warnf("region %s keeps failing, failing over to region %s", p.region, p.regionFailover.region)
+		}
+	}
+}
+
+// SetPodClient sets the client annotating the pods with the region and the security report of their container group.
+func (p *ACIProvider) SetPodClient(client corev1client.PodsGetter) {
+	p.podClient = client
+}
+
+// annotatePod patches annotations of a pod, as the pod controller only updates the status of the pods.
+func (p *ACIProvider) annotatePod(ctx context.Context, pod *v1.Pod, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.podClient.Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// recordPlacedRegion annotates a pod with the region its container group was created in, when a failover region
+// is configured.
+func (p *ACIProvider) recordPlacedRegion(ctx context.Context, pod *v1.Pod, region string) {
+	if p.regionFailover == nil || p.podClient == nil || pod.Annotations[placedRegionAnnotation] == region {
+		return
+	}
+	if err := p.annotatePod(ctx, pod, map[string]string{placedRegionAnnotation: region}); err != nil {
+		log.G(ctx).WithError(err).Warnf("failed to annotate pod %s/%s with region %s", pod.Namespace, pod.Name, region)
+	}
+}
+
+// StartRegionFailoverProbe probes the region of the provider every FailoverProbeInterval while failed over.
+func (p *ACIProvider) StartRegionFailoverProbe(ctx context.Context) {
+	if p.regionFailover == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.regionFailover.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			p.probeRegion(ctx)
+		}
+	}()
+}
+
+// probeRegion lists the ACI usage of the region of the provider, a lightweight call, while failed over. When it
+// answers, the next container group is tried in the region first.
+func (p *ACIProvider) probeRegion(ctx context.Context) {
+	if !p.regionFailover.isFailedOver() {
+		return
+	}
+
+	ctx, span := trace.StartSpan(ctx, "aci.probeRegion")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	if _, err := p.azClientsAPIs.ListUsage(ctx, p.region); err != nil {
+		log.G(ctx).WithError(err).Debugf("region %s is still unavailable", p.region)
+		return
+	}
+	log.G(ctx).Infof("region %s answered, trying it for the next container group", p.region)
+	p.regionFailover.setProbing()
+}
+
+// validateFailoverRegion checks the failover region configured with the region of the provider.
+func validateFailoverRegion(region, failoverRegion string) error {
+	if failoverRegion == "" {
+		return nil
+	}
+	if !isValidACIRegion(failoverRegion) {
+		return fmt.Errorf("failover region %s is invalid", failoverRegion)
+	}
+	if failoverRegion == region {
+		return fmt.Errorf("the failover region must differ from the region %s", region)
+	}
+	return nil
+}
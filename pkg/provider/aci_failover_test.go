@@ -0,0 +1,121 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRegionFailover(t *testing.T) {
+	f := newRegionFailover("eastus", 2, 0)
+	assert.Check(t, is.Equal(defaultFailoverProbeInterval, f.interval))
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus"}, f.getRegions([]string{"westus"})))
+
+	assert.Check(t, !f.recordFailure())
+	assert.Check(t, f.recordFailure())
+	assert.Check(t, !f.recordFailure())
+	assert.Check(t, is.DeepEqual([]string{"eastus", "westus"}, f.getRegions([]string{"westus", "eastus"})))
+
+	// a probe answered puts the region back first, a failure fails over again
+	f.setProbing()
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus"}, f.getRegions([]string{"westus"})))
+	assert.Check(t, !f.recordFailure())
+	assert.Check(t, is.DeepEqual([]string{"eastus", "westus"}, f.getRegions([]string{"westus"})))
+
+	assert.Check(t, f.recordSuccess())
+	assert.Check(t, !f.isFailedOver())
+	assert.Check(t, !f.recordSuccess())
+}
+
+func TestValidateFailoverRegion(t *testing.T) {
+	assert.Check(t, validateFailoverRegion("westus", ""))
+	assert.Check(t, validateFailoverRegion("westus", "eastus"))
+	assert.Check(t, is.ErrorContains(validateFailoverRegion("westus", "westus"), "must differ"))
+	assert.Check(t, is.ErrorContains(validateFailoverRegion("westus", "moon"), "is invalid"))
+}
+
+func TestCreateContainerGroupWithFailover(t *testing.T) {
+	var tried []string
+	outage := true
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		tried = append(tried, *cg.Location)
+		if *cg.Location == "westus" && outage {
+			return &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServiceUnavailable"}
+		}
+		return nil
+	}
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		if outage {
+			return nil, errors.New("region unavailable")
+		}
+		return nil, nil
+	}
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	client := fake.NewSimpleClientset(pod)
+	p := ACIProvider{
+		azClientsAPIs:  aciMocks,
+		region:         "westus",
+		regions:        []string{"westus"},
+		failoverRegion: "eastus",
+		regionFailover: newRegionFailover("eastus", 2, time.Minute),
+	}
+	p.SetPodClient(client.CoreV1())
+
+	newContainerGroup := func() *azaciv2.ContainerGroup {
+		return &azaciv2.ContainerGroup{Tags: map[string]*string{}}
+	}
+	create := func() {
+		tried = nil
+		assert.NilError(t, p.createContainerGroupInRegions(context.Background(), pod, newContainerGroup(), false))
+	}
+
+	// the region of the provider is tried first until it failed the threshold
+	create()
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus"}, tried))
+	create()
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus"}, tried))
+	assert.Check(t, p.regionFailover.isFailedOver())
+	create()
+	assert.Check(t, is.DeepEqual([]string{"eastus"}, tried))
+
+	updated, err := client.CoreV1().Pods("ns").Get(context.Background(), "pod", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("eastus", updated.Annotations[placedRegionAnnotation]))
+
+	// the region isn't tried again until it answers a probe
+	p.probeRegion(context.Background())
+	create()
+	assert.Check(t, is.DeepEqual([]string{"eastus"}, tried))
+
+	outage = false
+	p.probeRegion(context.Background())
+	create()
+	assert.Check(t, is.DeepEqual([]string{"westus"}, tried))
+	assert.Check(t, !p.regionFailover.isFailedOver())
+
+	// the pods picking their region are left alone
+	pinned := testsutil.CreatePodObj("pinned", "ns")
+	pinned.Annotations = map[string]string{regionAnnotation: "eastus"}
+	create = func() {
+		tried = nil
+		assert.NilError(t, p.createContainerGroupInRegions(context.Background(), pinned, newContainerGroup(), false))
+	}
+	create()
+	assert.Check(t, is.DeepEqual([]string{"eastus"}, tried))
+}
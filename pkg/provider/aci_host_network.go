@@ -0,0 +1,93 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// eventReasonUnsupportedNetworking is the reason of the events and the failed statuses of the pods requesting
+// host networking, which container groups don't have.
+const eventReasonUnsupportedNetworking = "UnsupportedNetworking"
+
+// getUnsupportedNetworking returns the fields of a pod requesting the network of the host, which ACI can't provide
+// as every container group has its own network namespace on a host shared with other customers.
+func getUnsupportedNetworking(pod *v1.Pod) []string {
+	var fields []string
+	if pod.Spec.HostNetwork {
+		fields = append(fields, "spec.hostNetwork")
+	}
+	for i, container := range pod.Spec.InitContainers {
+		fields = append(fields, getHostPorts(fmt.Sprintf("spec.initContainers[%d]", i), container)...)
+	}
+	for i, container := range pod.Spec.Containers {
+		fields = append(fields, getHostPorts(fmt.Sprintf("spec.containers[%d]", i), container)...)
+	}
+	return fields
+}
+
+func getHostPorts(path string, container v1.Container) []string {
+	var fields []string
+	for i, port := range container.Ports {
+		if port.HostPort != 0 {
+			fields = append(fields, fmt.Sprintf("%s.ports[%d].hostPort (%d, container %s)", path, i, port.HostPort, container.Name))
+		}
+	}
+	return fields
+}
+
+// validateNetworking checks that a pod doesn't request host networking. The pods which do are reported as failed
+// with an event, unless the provider only warns about them, in which case the fields are ignored.
+// It returns whether the creation of the pod should go on.
+func (p *ACIProvider) validateNetworking(ctx context.Context, pod *v1.Pod) bool {
+	fields := getUnsupportedNetworking(pod)
+	if len(fields) == 0 {
+		return true
+	}
+
+	p.settingsLock.RLock()
+	warnOnly := p.hostNetworkWarnOnly
+	p.settingsLock.RUnlock()
+
+	if warnOnly {
+		message := "ACI doesn't support host networking, ignoring " + strings.Join(fields, ", ")
+		log.G(ctx).Warnf("pod %s/%s: %s", pod.Namespace, pod.Name, message)
+		if p.eventRecorder != nil {
+			p.eventRecorder.Event(pod, v1.EventTypeWarning, eventReasonUnsupportedNetworking, message)
+		}
+		return true
+	}
+
+	err := errdefs.InvalidInputf("ACI doesn't support host networking, remove %s", strings.Join(fields, ", "))
+	p.failPod(ctx, pod, eventReasonUnsupportedNetworking, err)
+	return false
+}
+
+// failPod reports a pod rejected by the provider as failed, like the kubelet reports the pods it can't admit, and
+// emits a warning event with the reason. The pod isn't retried.
+func (p *ACIProvider) failPod(ctx context.Context, pod *v1.Pod, reason string, err error) {
+	log.G(ctx).WithError(err).Warnf("rejecting pod %s/%s", pod.Namespace, pod.Name)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeWarning, reason, getFailureMessage(err))
+	}
+	if p.tracker == nil {
+		return
+	}
+
+	updateErr := p.tracker.UpdatePodStatus(ctx, pod.Namespace, pod.Name, func(podStatus *v1.PodStatus) {
+		podStatus.Phase = v1.PodFailed
+		podStatus.Reason = reason
+		podStatus.Message = err.Error()
+	}, false)
+	if updateErr != nil && !errdefs.IsNotFound(updateErr) {
+		log.G(ctx).WithError(updateErr).Errorf("failed to report pod %s/%s as failed", pod.Namespace, pod.Name)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetUnsupportedNetworking(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	assert.Check(t, is.Len(getUnsupportedNetworking(pod), 0))
+
+	pod.Spec.HostNetwork = true
+	pod.Spec.Containers[0].Ports = []v1.ContainerPort{{ContainerPort: 80}, {ContainerPort: 8080, HostPort: 8080}}
+	assert.Check(t, is.DeepEqual([]string{
+		"spec.hostNetwork",
+		"spec.containers[0].ports[1].hostPort (8080, container " + pod.Spec.Containers[0].Name + ")",
+	}, getUnsupportedNetworking(pod)))
+}
+
+func TestCreatePodWithHostNetwork(t *testing.T) {
+	cases := []struct {
+		description     string
+		warnOnly        bool
+		expectedCreated bool
+	}{
+		{
+			description: "pod is failed",
+		},
+		{
+			description:     "pod is created with a warning",
+			warnOnly:        true,
+			expectedCreated: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Spec.HostNetwork = true
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+			created := false
+			aciMocks := createNewACIMock()
+			aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+				created = true
+				return nil
+			}
+
+			provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+				NewMockSecretLister(mockCtrl), podLister)
+			assert.NilError(t, err)
+			provider.hostNetworkWarnOnly = tc.warnOnly
+			recorder := record.NewFakeRecorder(10)
+			provider.SetEventRecorder(recorder)
+			var updatedPod *v1.Pod
+			provider.tracker = &PodsTracker{
+				pods: podLister,
+				updateCb: func(p *v1.Pod) {
+					updatedPod = p
+				},
+			}
+
+			assert.NilError(t, provider.CreatePod(context.Background(), pod))
+			assert.Check(t, is.Equal(tc.expectedCreated, created))
+			assert.Assert(t, len(recorder.Events) > 0)
+			event := <-recorder.Events
+			assert.Check(t, is.Contains(event, eventReasonUnsupportedNetworking))
+			assert.Check(t, is.Contains(event, "spec.hostNetwork"))
+			if tc.expectedCreated {
+				return
+			}
+			assert.Assert(t, updatedPod != nil)
+			assert.Check(t, is.Equal(v1.PodFailed, updatedPod.Status.Phase))
+			assert.Check(t, is.Equal(eventReasonUnsupportedNetworking, updatedPod.Status.Reason))
+			assert.Check(t, is.Contains(updatedPod.Status.Message, "spec.hostNetwork"))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// hostPathMappingConfig redirects the hostPath volumes under PathPrefix to an Azure Files share, for the charts
+// which can't do without hostPath. The storage account of the share is read from the azurestorageaccountname
+// and azurestorageaccountkey keys of SecretName, either name for the secret of the namespace of the pod or
+// namespace/name.
+type hostPathMappingConfig struct {
+	PathPrefix string
+	ShareName  string
+	SecretName string
+	ReadOnly   bool
+}
+
+type hostPathMapping struct {
+	pathPrefix string
+	shareName  string
+	secret     types.NamespacedName
+	readOnly   bool
+}
+
+// parseHostPathMappings validates the host path mappings of the config file, and sorts them by decreasing
+// prefix length so that the most specific mapping of a path wins.
+func parseHostPathMappings(configs []hostPathMappingConfig) ([]hostPathMapping, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	mappings := make([]hostPathMapping, 0, len(configs))
+	for _, config := range configs {
+		if !path.IsAbs(config.PathPrefix) {
+			return nil, fmt.Errorf("host path mapping prefix %q must be an absolute path", config.PathPrefix)
+		}
+		if config.ShareName == "" {
+			return nil, fmt.Errorf("host path mapping of %s has no share name", config.PathPrefix)
+		}
+		secret := types.NamespacedName{Name: config.SecretName}
+		if namespace, name, ok := strings.Cut(config.SecretName, "/"); ok {
+			secret = types.NamespacedName{Namespace: namespace, Name: name}
+		}
+		if secret.Name == "" || strings.Contains(secret.Name, "/") || (strings.Contains(config.SecretName, "/") && secret.Namespace == "") {
+			return nil, fmt.Errorf("host path mapping of %s: invalid secret %q, must be name or namespace/name", config.PathPrefix, config.SecretName)
+		}
+		mappings = append(mappings, hostPathMapping{
+			pathPrefix: path.Clean(config.PathPrefix),
+			shareName:  config.ShareName,
+			secret:     secret,
+			readOnly:   config.ReadOnly,
+		})
+	}
+	sort.SliceStable(mappings, func(i, j int) bool {
+		return len(mappings[i].pathPrefix) > len(mappings[j].pathPrefix)
+	})
+	return mappings, nil
+}
+
+// match returns whether a host path is the prefix of the mapping or under it.
+func (m *hostPathMapping) match(hostPath string) bool {
+	hostPath = path.Clean(hostPath)
+	return hostPath == m.pathPrefix || m.pathPrefix == "/" || strings.HasPrefix(hostPath, m.pathPrefix+"/")
+}
+
+// getHostPathVolume redirects a hostPath volume to the Azure Files share of its host path mapping. ACI mounts
+// whole shares, so the host paths under the prefix of a mapping all get the root of its share. The hostPath
+// volumes without a mapping are rejected, as ACI doesn't give access to the filesystem of its hosts.
+func (p *ACIProvider) getHostPathVolume(pod *v1.Pod, volume v1.Volume) (*azaciv2.Volume, error) {
+	p.settingsLock.RLock()
+	mappings := p.hostPathMappings
+	p.settingsLock.RUnlock()
+
+	hostPath := volume.HostPath.Path
+	var mapping *hostPathMapping
+	for i := range mappings {
+		if mappings[i].match(hostPath) {
+			mapping = &mappings[i]
+			break
+		}
+	}
+	if mapping == nil {
+		return nil, errdefs.InvalidInputf("pod %s: volume %s: ACI doesn't support hostPath volumes, use an emptyDir or Azure Files volume "+
+			"instead, or redirect %s to an Azure Files share with HostPathMappings in the provider config", pod.Name, volume.Name, hostPath)
+	}
+
+	namespace := mapping.secret.Namespace
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	secret, err := p.secretL.Secrets(namespace).Get(mapping.secret.Name)
+	if err != nil {
+		return nil, fmt.Errorf("pod %s: volume %s: the secret %s/%s of the share of host path %s: %w", pod.Name, volume.Name,
+			namespace, mapping.secret.Name, mapping.pathPrefix, err)
+	}
+	storageAccountName := string(secret.Data[azureFileStorageAccountName])
+	storageAccountKey := string(secret.Data[azureFileStorageAccountKey])
+	shareName := mapping.shareName
+	readOnly := mapping.readOnly
+	return &azaciv2.Volume{
+		Name: &volume.Name,
+		AzureFile: &azaciv2.AzureFileVolume{
+			ShareName:          &shareName,
+			ReadOnly:           &readOnly,
+			StorageAccountName: &storageAccountName,
+			StorageAccountKey:  &storageAccountKey,
+		},
+	}, nil
+}
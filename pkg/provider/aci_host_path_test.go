@@ -0,0 +1,93 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseHostPathMappings(t *testing.T) {
+	mappings, err := parseHostPathMappings([]hostPathMappingConfig{
+		{PathPrefix: "/var", ShareName: "var", SecretName: "files"},
+		{PathPrefix: "/var/log/", ShareName: "logs", SecretName: "kube-system/files", ReadOnly: true},
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(mappings, 2))
+	assert.Check(t, is.Equal("/var/log", mappings[0].pathPrefix), "the most specific prefix comes first")
+	assert.Check(t, is.Equal("kube-system", mappings[0].secret.Namespace))
+	assert.Check(t, is.Equal("/var", mappings[1].pathPrefix))
+	assert.Check(t, is.Equal("", mappings[1].secret.Namespace))
+
+	cases := []struct {
+		description string
+		mapping     hostPathMappingConfig
+		err         string
+	}{
+		{"relative prefix", hostPathMappingConfig{PathPrefix: "var/log", ShareName: "logs", SecretName: "files"}, "must be an absolute path"},
+		{"no share", hostPathMappingConfig{PathPrefix: "/var/log", SecretName: "files"}, "has no share name"},
+		{"no secret", hostPathMappingConfig{PathPrefix: "/var/log", ShareName: "logs"}, "invalid secret"},
+		{"invalid secret", hostPathMappingConfig{PathPrefix: "/var/log", ShareName: "logs", SecretName: "/files"}, "invalid secret"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := parseHostPathMappings([]hostPathMappingConfig{tc.mapping})
+			assert.Check(t, is.ErrorContains(err, tc.err))
+		})
+	}
+}
+
+func TestGetHostPathVolume(t *testing.T) {
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, secrets.Add(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "files"},
+		Data: map[string][]byte{
+			azureFileStorageAccountName: []byte("account"),
+			azureFileStorageAccountKey:  []byte("key"),
+		},
+	}))
+	mappings, err := parseHostPathMappings([]hostPathMappingConfig{
+		{PathPrefix: "/var/log", ShareName: "logs", SecretName: "kube-system/files", ReadOnly: true},
+		{PathPrefix: "/data", ShareName: "data", SecretName: "files"},
+	})
+	assert.NilError(t, err)
+	p := &ACIProvider{secretL: corev1listers.NewSecretLister(secrets), hostPathMappings: mappings}
+
+	hostPathPod := func(path string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+			Spec: v1.PodSpec{Volumes: []v1.Volume{{
+				Name:         "host",
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: path}},
+			}}},
+		}
+	}
+
+	volumes, err := p.getVolumes(context.Background(), hostPathPod("/var/log/pods"))
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 1))
+	assert.Check(t, is.Equal("host", *volumes[0].Name))
+	assert.Assert(t, volumes[0].AzureFile != nil)
+	assert.Check(t, is.Equal("logs", *volumes[0].AzureFile.ShareName))
+	assert.Check(t, is.Equal("account", *volumes[0].AzureFile.StorageAccountName))
+	assert.Check(t, is.Equal("key", *volumes[0].AzureFile.StorageAccountKey))
+	assert.Check(t, *volumes[0].AzureFile.ReadOnly)
+
+	_, err = p.getVolumes(context.Background(), hostPathPod("/var/logs"))
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "redirect /var/logs to an Azure Files share with HostPathMappings"))
+
+	// the secret of the mapping is looked up in the namespace of the pod
+	_, err = p.getVolumes(context.Background(), hostPathPod("/data"))
+	assert.Check(t, is.ErrorContains(err, "the secret ns/files of the share of host path /data"))
+}
@@ -0,0 +1,474 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/patrickmn/go-cache"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	// dockerHubTokenHost is the host of the bearer token realm of Docker Hub.
+	dockerHubTokenHost = "auth.docker.io"
+	// imageConfigCacheExpiration bounds the time a tag moved to another image keeps resolving to the old entrypoint.
+	imageConfigCacheExpiration = 10 * time.Minute
+	registryRequestTimeout     = 30 * time.Second
+	maxRegistryResponseSize    = 4 << 20
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// ImageConfig is the part of the config of an image the command of its containers depends on.
+type ImageConfig struct {
+	Entrypoint []string
+	Cmd        []string
+}
+
+// ImageConfigResolver returns the config of the image of an operating system, read from its registry with the
+// registry credentials of the pod.
+type ImageConfigResolver interface {
+	GetImageConfig(ctx context.Context, image, os string, creds []*azaciv2.ImageRegistryCredential) (*ImageConfig, error)
+}
+
+// ImageOperatingSystemResolver is implemented by the image config resolvers which can also list the operating
+// systems an image has an amd64 image for, lower case, which select the operating system of the container groups
+// of the pods when the node runs both Linux and Windows pods.
+type ImageOperatingSystemResolver interface {
+	GetImageOperatingSystems(ctx context.Context, image string, creds []*azaciv2.ImageRegistryCredential) ([]string, error)
+}
+
+// SetImageConfigResolver replaces the resolver of the image entrypoints, which by default reads the image configs
+// from the registries.
+func (p *ACIProvider) SetImageConfigResolver(resolver ImageConfigResolver) {
+	p.imageConfigResolver = resolver
+}
+
+// resolveCommand returns a copy of a container with the command and args ACI has to run, with the semantics of
+// Kubernetes: the command overrides the image entrypoint and the args override the image cmd. As the command of
+// a container group replaces both, the entrypoint of the image is read from its registry when the container only
+// has args, or has lifecycle hooks or a working directory, which wrap the command. The images are read with the
+// registry credentials of the pod.
+func (p *ACIProvider) resolveCommand(ctx context.Context, pod *v1.Pod, container v1.Container, creds []*azaciv2.ImageRegistryCredential) (v1.Container, error) {
+	// lifecycle hooks and working directories are not supported for Windows containers, see getLifecycleCommand
+	os := p.getPodOperatingSystem(pod)
+	wrapped := usesLifecycleShell(pod, &container) && os != string(azaciv2.OperatingSystemTypesWindows)
+	if len(container.Command) > 0 || (len(container.Args) == 0 && !wrapped) {
+		return container, nil
+	}
+	if p.imageConfigResolver == nil {
+		return container, errdefs.InvalidInputf("container %s: the command must be set as the entrypoint of image %s is unknown", container.Name, container.Image)
+	}
+
+	config, err := p.imageConfigResolver.GetImageConfig(ctx, container.Image, os, creds)
+	if err != nil {
+		return container, fmt.Errorf("container %s: error reading the entrypoint of image %s, set the command of the container: %w", container.Name, container.Image, err)
+	}
+
+	container.Command = config.Entrypoint
+	if len(container.Args) == 0 {
+		container.Args = config.Cmd
+	}
+	// without entrypoint, the first arg is the executable
+	if len(container.Command) == 0 && len(container.Args) > 0 {
+		container.Command, container.Args = container.Args[:1], container.Args[1:]
+	}
+	if len(container.Command) == 0 {
+		return container, errdefs.InvalidInputf("container %s: image %s has no entrypoint nor cmd, set the command of the container", container.Name, container.Image)
+	}
+	return container, nil
+}
+
+// registryImageConfigResolver reads the configs of the images from their registries with the registry API.
+type registryImageConfigResolver struct {
+	client  *http.Client
+	configs *cache.Cache
+	// architecture is the CPU architecture of the images read from multi-platform images.
+	architecture string
+	// tokenHosts are the hosts of the bearer token realms the credentials are sent to, besides the registries.
+	tokenHosts map[string]bool
+}
+
+func newRegistryImageConfigResolver(tokenHosts []string) *registryImageConfigResolver {
+	r := &registryImageConfigResolver{
+		client:       &http.Client{Timeout: registryRequestTimeout},
+		configs:      cache.New(imageConfigCacheExpiration, 2*imageConfigCacheExpiration),
+		architecture: aciArchitecture,
+		tokenHosts:   map[string]bool{dockerHubTokenHost: true},
+	}
+	for _, host := range tokenHosts {
+		r.tokenHosts[strings.ToLower(strings.TrimSpace(host))] = true
+	}
+	return r
+}
+
+func (r *registryImageConfigResolver) GetImageConfig(ctx context.Context, image, os string, creds []*azaciv2.ImageRegistryCredential) (*ImageConfig, error) {
+	session, reference, key, err := r.newSession(image, creds)
+	if err != nil {
+		return nil, err
+	}
+	os = strings.ToLower(os)
+	key += "\x00" + os
+	if config, ok := r.configs.Get(key); ok {
+		return config.(*ImageConfig), nil
+	}
+
+	digest, err := session.getConfigDigest(ctx, reference, os)
+	if err != nil {
+		return nil, err
+	}
+	var blob struct {
+		Config ImageConfig `json:"config"`
+	}
+	if err := session.getConfig(ctx, digest, &blob); err != nil {
+		return nil, err
+	}
+
+	log.G(ctx).Debugf("image %s has entrypoint %q and cmd %q", image, blob.Config.Entrypoint, blob.Config.Cmd)
+	r.configs.SetDefault(key, &blob.Config)
+	return &blob.Config, nil
+}
+
+func (r *registryImageConfigResolver) GetImageOperatingSystems(ctx context.Context, image string, creds []*azaciv2.ImageRegistryCredential) ([]string, error) {
+	session, reference, key, err := r.newSession(image, creds)
+	if err != nil {
+		return nil, err
+	}
+	key += "\x00platforms"
+	if oses, ok := r.configs.Get(key); ok {
+		return oses.([]string), nil
+	}
+
+	oses, err := session.getOperatingSystems(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	log.G(ctx).Debugf("image %s has images for %v", image, oses)
+	r.configs.SetDefault(key, oses)
+	return oses, nil
+}
+
+// newSession returns the session reading an image from its registry, with the registry credential of the pod
+// for the registry, and the key of the image in the cache of the configs.
+func (r *registryImageConfigResolver) newSession(image string, creds []*azaciv2.ImageRegistryCredential) (*registrySession, string, string, error) {
+	registry, repository, reference, err := parseImageReference(image)
+	if err != nil {
+		return nil, "", "", err
+	}
+	var cred *azaciv2.ImageRegistryCredential
+	for _, c := range creds {
+		if normalizeRegistryServer(stringValue(c.Server)) == normalizeRegistryServer(registry) {
+			cred = c
+			break
+		}
+	}
+	// the configs are cached by credential, so that a pod cannot read the config of an image it has no access to,
+	// even with the username of a pod which has
+	key := image
+	if cred != nil {
+		sum := sha256.Sum256([]byte(stringValue(cred.Username) + "\x00" + stringValue(cred.Password)))
+		key += "\x00" + hex.EncodeToString(sum[:])
+	}
+	return &registrySession{resolver: r, registry: registry, repository: repository, cred: cred}, reference, key, nil
+}
+
+// parseImageReference returns the registry, repository and tag or digest of an image, with the defaults of docker.
+func parseImageReference(image string) (registry, repository, reference string, err error) {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		if reference == "" {
+			reference = name[i+1:]
+		}
+		name = name[:i]
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+
+	registry = dockerHubRegistry
+	if i := strings.Index(name, "/"); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		registry, name = name[:i], name[i+1:]
+	}
+	if normalizeRegistryServer(registry) == dockerHubServer {
+		registry = dockerHubRegistry
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	if name == "" || reference == "" {
+		return "", "", "", errdefs.InvalidInputf("invalid image reference %q", image)
+	}
+	return registry, name, reference, nil
+}
+
+// registrySession reads the manifests and blobs of a repository, authenticating with the challenges of the registry.
+type registrySession struct {
+	resolver   *registryImageConfigResolver
+	registry   string
+	repository string
+	cred       *azaciv2.ImageRegistryCredential
+	// authorization is the authorization header of the requests, once the registry challenged the session.
+	authorization string
+}
+
+// registryManifest is an image manifest, or an index of the manifests of the platforms of a multi-platform image.
+type registryManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func (s *registrySession) getManifest(ctx context.Context, reference string) (*registryManifest, error) {
+	accept := []string{mediaTypeDockerManifest, mediaTypeOCIManifest, mediaTypeDockerManifestList, mediaTypeOCIIndex}
+	body, err := s.get(ctx, "manifests/"+reference, accept)
+	if err != nil {
+		return nil, err
+	}
+	var manifest registryManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing the manifest of %s/%s: %v", s.registry, s.repository, err)
+	}
+	return &manifest, nil
+}
+
+// getConfig reads the config blob of an image.
+func (s *registrySession) getConfig(ctx context.Context, digest string, config interface{}) error {
+	body, err := s.get(ctx, "blobs/"+digest, nil)
+	if err != nil {
+		return err
+	}
+	if err := verifyDigest(digest, body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, config); err != nil {
+		return fmt.Errorf("error parsing the config of image %s/%s: %v", s.registry, s.repository, err)
+	}
+	return nil
+}
+
+// getConfigDigest returns the digest of the config of the image of a manifest, selecting the image of the platform
+// of the containers, the architecture of the resolver and os, for multi-platform images.
+func (s *registrySession) getConfigDigest(ctx context.Context, reference, os string) (string, error) {
+	for i := 0; i < 2; i++ {
+		manifest, err := s.getManifest(ctx, reference)
+		if err != nil {
+			return "", err
+		}
+		if manifest.Config.Digest != "" {
+			return manifest.Config.Digest, nil
+		}
+
+		reference = ""
+		for _, m := range manifest.Manifests {
+			if strings.ToLower(m.Platform.OS) == os && m.Platform.Architecture == s.resolver.architecture {
+				reference = m.Digest
+				break
+			}
+		}
+		if reference == "" {
+			return "", fmt.Errorf("image %s/%s has no %s/%s image", s.registry, s.repository, os, s.resolver.architecture)
+		}
+	}
+	return "", fmt.Errorf("image %s/%s has nested image indexes", s.registry, s.repository)
+}
+
+// getOperatingSystems returns the operating systems of the images of the architecture of the resolver of a
+// multi-platform image, or the operating system of the config of a single image of the architecture.
+func (s *registrySession) getOperatingSystems(ctx context.Context, reference string) ([]string, error) {
+	manifest, err := s.getManifest(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Config.Digest != "" {
+		var config struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		}
+		if err := s.getConfig(ctx, manifest.Config.Digest, &config); err != nil {
+			return nil, err
+		}
+		if config.Architecture != "" && config.Architecture != s.resolver.architecture {
+			return []string{}, nil
+		}
+		return []string{strings.ToLower(config.OS)}, nil
+	}
+
+	var oses []string
+	for _, m := range manifest.Manifests {
+		os := strings.ToLower(m.Platform.OS)
+		if m.Platform.Architecture == s.resolver.architecture && !containsString(oses, os) {
+			oses = append(oses, os)
+		}
+	}
+	return oses, nil
+}
+
+// get reads a manifest or blob of the repository.
+func (s *registrySession) get(ctx context.Context, path string, accept []string) ([]byte, error) {
+	resp, err := s.do(ctx, fmt.Sprintf("https://%s/v2/%s/%s", s.registry, s.repository, path), accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && s.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := s.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = s.do(ctx, fmt.Sprintf("https://%s/v2/%s/%s", s.registry, s.repository, path), accept); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRegistryResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry %s returned %s for %s/%s", s.registry, resp.Status, s.repository, path)
+	}
+	return body, nil
+}
+
+func (s *registrySession) do(ctx context.Context, rawURL string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+	return s.resolver.client.Do(req)
+}
+
+// authorize answers the basic or bearer challenge of the registry, anonymously when the pod has no credential for
+// the registry. The credentials are only sent over https, to the registry or the trusted token hosts, so that a
+// registry can't collect the credentials of another one with its challenge.
+func (s *registrySession) authorize(ctx context.Context, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if s.cred == nil {
+			return fmt.Errorf("registry %s requires credentials", s.registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(stringValue(s.cred.Username), stringValue(s.cred.Password))
+		s.authorization = req.Header.Get("Authorization")
+		return nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Scheme == "" {
+			return fmt.Errorf("registry %s returned an invalid bearer challenge %q", s.registry, challenge)
+		}
+		if realm.Scheme != "https" || (!strings.EqualFold(realm.Host, s.registry) && !s.resolver.tokenHosts[strings.ToLower(realm.Hostname())]) {
+			return fmt.Errorf("registry %s returned the untrusted bearer realm %s, add its host to RegistryTokenHosts to trust it", s.registry, realm.Redacted())
+		}
+		query := realm.Query()
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		query.Set("scope", fmt.Sprintf("repository:%s:pull", s.repository))
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		if s.cred != nil {
+			req.SetBasicAuth(stringValue(s.cred.Username), stringValue(s.cred.Password))
+		}
+		resp, err := s.resolver.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("error getting a token of registry %s: %s", s.registry, resp.Status)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponseSize)).Decode(&token); err != nil {
+			return fmt.Errorf("error parsing the token of registry %s: %v", s.registry, err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		s.authorization = "Bearer " + token.Token
+		return nil
+	}
+	return fmt.Errorf("registry %s returned an unsupported challenge %q", s.registry, challenge)
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header like Bearer realm="...",service="...".
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var param string
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+			param, rest = value[1:end+1], value[end+2:]
+		} else {
+			param, rest, _ = strings.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = param
+	}
+	return strings.ToLower(scheme), params
+}
+
+func verifyDigest(digest string, body []byte) error {
+	algorithm, hash, _ := strings.Cut(digest, ":")
+	if algorithm != "sha256" {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("the content of blob %s does not match its digest", digest)
+	}
+	return nil
+}
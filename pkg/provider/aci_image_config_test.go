@@ -0,0 +1,246 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+type fakeImageConfigResolver map[string]*ImageConfig
+
+func (f fakeImageConfigResolver) GetImageConfig(ctx context.Context, image, os string, creds []*azaciv2.ImageRegistryCredential) (*ImageConfig, error) {
+	if config, ok := f[image]; ok {
+		return config, nil
+	}
+	return nil, fmt.Errorf("image %s not found", image)
+}
+
+func TestResolveCommand(t *testing.T) {
+	p := ACIProvider{imageConfigResolver: fakeImageConfigResolver{
+		"nginx":   {Entrypoint: []string{"/docker-entrypoint.sh"}, Cmd: []string{"nginx", "-g", "daemon off;"}},
+		"busybox": {Cmd: []string{"sh"}},
+		"scratch": {},
+	}}
+	pod := testsutil.CreatePodObj("pod", "ns")
+	postStart := &v1.Lifecycle{PostStart: &v1.LifecycleHandler{Exec: &v1.ExecAction{Command: []string{"true"}}}}
+
+	cases := []struct {
+		description     string
+		container       v1.Container
+		expectedCommand []string
+		expectedArgs    []string
+		expectedError   string
+	}{
+		{
+			description: "image defaults",
+			container:   v1.Container{Image: "nginx"},
+		},
+		{
+			description:     "command overrides entrypoint and cmd",
+			container:       v1.Container{Image: "nginx", Command: []string{"nginx"}},
+			expectedCommand: []string{"nginx"},
+		},
+		{
+			description:     "args override cmd",
+			container:       v1.Container{Image: "nginx", Args: []string{"nginx", "-T"}},
+			expectedCommand: []string{"/docker-entrypoint.sh"},
+			expectedArgs:    []string{"nginx", "-T"},
+		},
+		{
+			description:     "args without entrypoint",
+			container:       v1.Container{Image: "busybox", Args: []string{"echo", "hello"}},
+			expectedCommand: []string{"echo"},
+			expectedArgs:    []string{"hello"},
+		},
+		{
+			description:     "lifecycle hooks wrap the image command",
+			container:       v1.Container{Image: "nginx", Lifecycle: postStart},
+			expectedCommand: []string{"/docker-entrypoint.sh"},
+			expectedArgs:    []string{"nginx", "-g", "daemon off;"},
+		},
+		{
+			description:   "image without command",
+			container:     v1.Container{Image: "scratch", Lifecycle: postStart},
+			expectedError: "has no entrypoint nor cmd",
+		},
+		{
+			description:   "unknown image",
+			container:     v1.Container{Image: "unknown", Args: []string{"-v"}},
+			expectedError: "error reading the entrypoint of image unknown",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			container, err := p.resolveCommand(context.Background(), pod, tc.container, nil)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.DeepEqual(tc.expectedCommand, container.Command))
+			assert.Check(t, is.DeepEqual(tc.expectedArgs, container.Args))
+		})
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	cases := map[string][3]string{
+		"nginx":                             {dockerHubRegistry, "library/nginx", "latest"},
+		"docker.io/bitnami/nginx:1.23":      {dockerHubRegistry, "bitnami/nginx", "1.23"},
+		"myregistry.azurecr.io/app/web:v1":  {"myregistry.azurecr.io", "app/web", "v1"},
+		"localhost:5000/app":                {"localhost:5000", "app", "latest"},
+		"localhost/app:v2@sha256:0123abcd":  {"localhost", "app", "sha256:0123abcd"},
+		"mcr.microsoft.com/oss/nginx/nginx": {"mcr.microsoft.com", "oss/nginx/nginx", "latest"},
+	}
+	for image, expected := range cases {
+		registry, repository, reference, err := parseImageReference(image)
+		assert.NilError(t, err, image)
+		assert.Check(t, is.DeepEqual(expected, [3]string{registry, repository, reference}), image)
+	}
+
+	_, _, _, err := parseImageReference("registry.example.com/")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
+
+func TestRegistryImageConfigResolver(t *testing.T) {
+	config := `{"architecture":"amd64","os":"linux","config":{"Entrypoint":["/entrypoint"],"Cmd":["serve"]}}`
+	configSum := sha256.Sum256([]byte(config))
+	configDigest := "sha256:" + hex.EncodeToString(configSum[:])
+
+	var server *httptest.Server
+	requests := 0
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "password" || r.URL.Query().Get("scope") != "repository:app:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"secret-token"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/app/manifests/v1":
+			assert.Check(t, strings.Contains(r.Header.Get("Accept"), mediaTypeOCIIndex))
+			fmt.Fprint(w, `{"mediaType":"`+mediaTypeOCIIndex+`","manifests":[
+				{"digest":"sha256:windows","platform":{"os":"windows","architecture":"amd64"}},
+				{"digest":"sha256:linux","platform":{"os":"linux","architecture":"amd64"}}]}`)
+		case "/v2/app/manifests/sha256:linux":
+			fmt.Fprint(w, `{"mediaType":"`+mediaTypeOCIManifest+`","config":{"digest":"`+configDigest+`"}}`)
+		case "/v2/app/blobs/" + configDigest:
+			fmt.Fprint(w, config)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver := newRegistryImageConfigResolver(nil)
+	resolver.client = server.Client()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	creds := []*azaciv2.ImageRegistryCredential{
+		{Server: stringPtr("other.example.com"), Username: stringPtr("other"), Password: stringPtr("other")},
+		{Server: stringPtr(registry), Username: stringPtr("user"), Password: stringPtr("password")},
+	}
+
+	imageConfig, err := resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", creds)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(&ImageConfig{Entrypoint: []string{"/entrypoint"}, Cmd: []string{"serve"}}, imageConfig))
+
+	// the configs are cached
+	requests = 0
+	_, err = resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", creds)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(0, requests))
+
+	// but not shared with pods without the credentials, or with the same username only
+	_, err = resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", creds[:1])
+	assert.Check(t, is.ErrorContains(err, "401"))
+	wrongPassword := []*azaciv2.ImageRegistryCredential{{Server: stringPtr(registry), Username: stringPtr("user"), Password: stringPtr("guess")}}
+	_, err = resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", wrongPassword)
+	assert.Check(t, is.ErrorContains(err, "401"))
+
+	// the operating systems of the amd64 images of a multi-platform image, or of the config of a single image
+	oses, err := resolver.GetImageOperatingSystems(context.Background(), registry+"/app:v1", creds)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"windows", "linux"}, oses))
+	oses, err = resolver.GetImageOperatingSystems(context.Background(), registry+"/app@sha256:linux", creds)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"linux"}, oses))
+
+	// the images of other architectures are not selected
+	resolver = newRegistryImageConfigResolver(nil)
+	resolver.client = server.Client()
+	resolver.architecture = "arm64"
+	_, err = resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", creds)
+	assert.Check(t, is.ErrorContains(err, "has no linux/arm64 image"))
+	oses, err = resolver.GetImageOperatingSystems(context.Background(), registry+"/app:v1", creds)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(oses, 0))
+}
+
+func TestRegistryBearerRealm(t *testing.T) {
+	var realm string
+	tokens := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokens++
+			fmt.Fprint(w, `{"token":"secret-token"}`)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry"`, realm))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	creds := []*azaciv2.ImageRegistryCredential{{Server: stringPtr(registry), Username: stringPtr("user"), Password: stringPtr("password")}}
+
+	// the client of the test server also sends the requests to example.com to the test server
+	for _, tc := range []struct {
+		description string
+		realm       string
+		tokenHosts  []string
+		trusted     bool
+	}{
+		{description: "realm of the registry", realm: server.URL + "/token", trusted: true},
+		{description: "realm of a trusted host", realm: "https://login.example.com/token", tokenHosts: []string{"Login.example.com"}, trusted: true},
+		{description: "realm of another host", realm: "https://attacker.example.com/token"},
+		{description: "realm over http", realm: "http://" + registry + "/token"},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			realm, tokens = tc.realm, 0
+			resolver := newRegistryImageConfigResolver(tc.tokenHosts)
+			resolver.client = server.Client()
+			_, err := resolver.GetImageConfig(context.Background(), registry+"/app:v1", "Linux", creds)
+			if tc.trusted {
+				assert.Check(t, is.ErrorContains(err, "401"))
+				assert.Check(t, is.Equal(1, tokens))
+				return
+			}
+			assert.Check(t, is.ErrorContains(err, "untrusted bearer realm "+tc.realm))
+			assert.Check(t, is.Equal(0, tokens))
+		})
+	}
+}
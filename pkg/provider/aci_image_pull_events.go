@@ -0,0 +1,104 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// imagePullProgressInterval is how often an event reports that the image of a container is still being pulled,
+	// so that long pulls don't look like hung pods.
+	imagePullProgressInterval = time.Minute
+
+	aciEventPulling = "pulling"
+)
+
+// getImagePullStart returns when ACI started pulling the image of a container, false when the last event of the
+// container isn't a pull in progress.
+func getImagePullStart(events []*azaciv2.Event) (time.Time, bool) {
+	var last *azaciv2.Event
+	for _, event := range events {
+		if event == nil || event.LastTimestamp == nil {
+			continue
+		}
+		if last == nil || !event.LastTimestamp.Before(*last.LastTimestamp) {
+			last = event
+		}
+	}
+	if last == nil || !strings.EqualFold(stringValue(last.Name), aciEventPulling) {
+		return time.Time{}, false
+	}
+	if last.FirstTimestamp != nil {
+		return *last.FirstTimestamp, true
+	}
+	return *last.LastTimestamp, true
+}
+
+// reportImagePullProgress emits a Pulling event on a pod every imagePullProgressInterval while the image of one of
+// its containers is being pulled.
+func (p *ACIProvider) reportImagePullProgress(ref *v1.ObjectReference, key containerLogKey, image string, events []*azaciv2.Event, now time.Time) {
+	m := p.containerGroupEvents
+	start, pulling := getImagePullStart(events)
+
+	m.lock.Lock()
+	last, reported := m.lastPullProgress[key]
+	if !pulling || now.Sub(start) < imagePullProgressInterval {
+		delete(m.lastPullProgress, key)
+		m.lock.Unlock()
+		return
+	}
+	if reported && now.Sub(last) < imagePullProgressInterval {
+		m.lock.Unlock()
+		return
+	}
+	m.lastPullProgress[key] = now
+	m.lock.Unlock()
+
+	p.eventRecorder.Eventf(ref, v1.EventTypeNormal, "Pulling", "Still pulling image %q, started %s ago",
+		image, now.Sub(start).Round(time.Second))
+}
+
+// getImagePullFailureHint explains the image pull failures ACI reports with the errors of the registry, e.g. a
+// registry refusing the credentials of the pod, empty when the message isn't a recognized pull failure.
+func getImagePullFailureHint(message string) string {
+	message = strings.ToLower(message)
+	if !strings.Contains(message, "pull") && !strings.Contains(message, "image") {
+		return ""
+	}
+	switch {
+	case strings.Contains(message, "unauthorized") || strings.Contains(message, "authentication required") ||
+		strings.Contains(message, "failed to authorize") || strings.Contains(message, "forbidden") ||
+		strings.Contains(message, "access denied") || strings.Contains(message, "denied:") ||
+		strings.Contains(message, "may require authorization"):
+		return "the registry refused the credentials, check the image pull secrets of the pod and of its service account"
+	case strings.Contains(message, "not found") || strings.Contains(message, "manifest unknown") ||
+		strings.Contains(message, "does not exist"):
+		return "the image or its tag doesn't exist in the registry"
+	case strings.Contains(message, "toomanyrequests") || strings.Contains(message, "rate limit"):
+		return "the registry is rate limiting the pulls, use image pull secrets or a mirror of the image"
+	case strings.Contains(message, "no such host") || strings.Contains(message, "i/o timeout") ||
+		strings.Contains(message, "connection refused"):
+		return "the registry can't be reached from ACI, check its name and the network of the container group"
+	}
+	return ""
+}
+
+// getImagePullEventMessage returns the message of a mirrored ACI event, with a hint about the cause of the image
+// pull failures.
+func getImagePullEventMessage(eventType, message string) string {
+	if eventType != v1.EventTypeWarning {
+		return message
+	}
+	if hint := getImagePullFailureHint(message); hint != "" {
+		return fmt.Sprintf("%s (%s)", message, hint)
+	}
+	return message
+}
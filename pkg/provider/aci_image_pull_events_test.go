@@ -0,0 +1,88 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetImagePullFailureHint(t *testing.T) {
+	testCases := []struct {
+		message  string
+		expected string
+	}{
+		{`Failed to pull image "example.azurecr.io/app:v1": failed to authorize: failed to fetch anonymous token: unexpected status: 401 Unauthorized`, "refused the credentials"},
+		{`pull access denied for private/app, repository does not exist or may require authorization`, "refused the credentials"},
+		{`Failed to pull image "nginx:nope": manifest unknown`, "doesn't exist"},
+		{`Failed to pull image "nginx": toomanyrequests: You have reached your pull rate limit`, "rate limiting"},
+		{`Failed to pull image "registry.invalid/app": dial tcp: lookup registry.invalid: no such host`, "can't be reached"},
+		{`Failed to pull image "nginx": context canceled`, ""},
+		{`Killing container with id 42: not found`, ""},
+	}
+	for _, tc := range testCases {
+		hint := getImagePullFailureHint(tc.message)
+		if tc.expected == "" {
+			assert.Check(t, is.Equal("", hint), tc.message)
+		} else {
+			assert.Check(t, is.Contains(hint, tc.expected), tc.message)
+		}
+	}
+}
+
+func TestReportImagePullProgress(t *testing.T) {
+	start := time.Now()
+	event := func(name, eventType, message string, at time.Time) *azaciv2.Event {
+		return &azaciv2.Event{Name: &name, Type: &eventType, Message: &message, FirstTimestamp: &at, LastTimestamp: &at}
+	}
+	events := []*azaciv2.Event{event("Pulling", "Normal", `pulling image "example.azurecr.io/big:v1"`, start)}
+	containerGroup := func() *azaciv2.ContainerGroup {
+		return &azaciv2.ContainerGroup{
+			Tags: map[string]*string{"UID": stringPtr("uid")},
+			Properties: &azaciv2.ContainerGroupPropertiesProperties{
+				Containers: []*azaciv2.Container{{
+					Name: stringPtr("app"),
+					Properties: &azaciv2.ContainerProperties{
+						Image:        stringPtr("example.azurecr.io/big:v1"),
+						InstanceView: &azaciv2.ContainerPropertiesInstanceView{Events: events},
+					},
+				}},
+			},
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	p := ACIProvider{containerGroupEvents: newContainerGroupEventMirror(start.Add(-time.Second))}
+	p.SetEventRecorder(recorder)
+	key := containerLogKey{namespace: "ns", pod: "pod", container: "app"}
+
+	p.mirrorContainerGroupEvents("ns", "pod", containerGroup())
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Equal(`Normal Pulling pulling image "example.azurecr.io/big:v1"`, <-recorder.Events))
+
+	// the progress of the pull is reported every interval
+	container := containerGroup().Properties.Containers[0]
+	ref := &v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: "ns", Name: "pod", FieldPath: "spec.containers{app}"}
+	p.reportImagePullProgress(ref, key, *container.Properties.Image, events, start.Add(90*time.Second))
+	p.reportImagePullProgress(ref, key, *container.Properties.Image, events, start.Add(2*time.Minute))
+	p.reportImagePullProgress(ref, key, *container.Properties.Image, events, start.Add(3*time.Minute))
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Equal(`Normal Pulling Still pulling image "example.azurecr.io/big:v1", started 1m30s ago`, <-recorder.Events))
+	assert.Check(t, is.Equal(`Normal Pulling Still pulling image "example.azurecr.io/big:v1", started 3m0s ago`, <-recorder.Events))
+
+	// the failures are mirrored with a hint, and end the progress reports
+	events = append(events, event("Failed", "Warning", `Failed to pull image "example.azurecr.io/big:v1": 401 Unauthorized`, start.Add(4*time.Minute)))
+	p.mirrorContainerGroupEvents("ns", "pod", containerGroup())
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Contains(<-recorder.Events, "Warning Failed Failed to pull image \"example.azurecr.io/big:v1\": 401 Unauthorized (the registry refused the credentials"))
+	p.reportImagePullProgress(ref, key, *container.Properties.Image, events, start.Add(5*time.Minute))
+	assert.Check(t, is.Len(recorder.Events, 0))
+}
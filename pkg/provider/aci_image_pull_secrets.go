@@ -0,0 +1,189 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const eventReasonRegistryCredentialConflict = "RegistryCredentialConflict"
+
+// dockerHubServer is the registry server of the credentials of the Docker Hub aliases.
+const dockerHubServer = "index.docker.io"
+
+// imagePullSecretRef references an image pull secret of a pod. Secrets of the pod spec are required, while
+// the secrets of the service account and the default secrets are skipped when missing, as the kubelet does.
+type imagePullSecretRef struct {
+	types.NamespacedName
+	required bool
+}
+
+// SetServiceAccountLister sets the lister the image pull secrets of the service accounts of the pods are read with.
+func (p *ACIProvider) SetServiceAccountLister(lister corev1listers.ServiceAccountLister) {
+	p.serviceAccountL = lister
+}
+
+// setupImagePullSecrets reads the ACI_IMAGE_PULL_SECRETS environment variable, which takes precedence over
+// the config file.
+func (p *ACIProvider) setupImagePullSecrets() error {
+	if secrets := os.Getenv("ACI_IMAGE_PULL_SECRETS"); secrets != "" {
+		defaultSecrets, err := parseImagePullSecrets(strings.Split(secrets, ","))
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_IMAGE_PULL_SECRETS: %v", err)
+		}
+		p.defaultImagePullSecrets = defaultSecrets
+	}
+	return nil
+}
+
+// parseImagePullSecrets parses the default image pull secrets, either name for the secret of the namespace
+// of the pod, or namespace/name for a secret shared by the pods of all namespaces.
+func parseImagePullSecrets(secrets []string) ([]types.NamespacedName, error) {
+	var defaultSecrets []types.NamespacedName
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		ref := types.NamespacedName{Name: secret}
+		if namespace, name, ok := strings.Cut(secret, "/"); ok {
+			ref = types.NamespacedName{Namespace: namespace, Name: name}
+		}
+		if ref.Name == "" || strings.Contains(ref.Name, "/") || (strings.Contains(secret, "/") && ref.Namespace == "") {
+			return nil, fmt.Errorf("invalid image pull secret %q, must be name or namespace/name", secret)
+		}
+		defaultSecrets = append(defaultSecrets, ref)
+	}
+	return defaultSecrets, nil
+}
+
+// getImagePullSecretRefs returns the image pull secrets of a pod: the secrets of its spec, then the secrets
+// of its service account, then the default secrets.
+func (p *ACIProvider) getImagePullSecretRefs(ctx context.Context, pod *v1.Pod) []imagePullSecretRef {
+	var refs []imagePullSecretRef
+	seen := map[types.NamespacedName]bool{}
+	add := func(ref types.NamespacedName, required bool) {
+		if ref.Namespace == "" {
+			ref.Namespace = pod.Namespace
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, imagePullSecretRef{NamespacedName: ref, required: required})
+		}
+	}
+
+	for _, secret := range pod.Spec.ImagePullSecrets {
+		add(types.NamespacedName{Name: secret.Name}, true)
+	}
+
+	if p.serviceAccountL != nil {
+		name := pod.Spec.ServiceAccountName
+		if name == "" {
+			name = "default"
+		}
+		sa, err := p.serviceAccountL.ServiceAccounts(pod.Namespace).Get(name)
+		if err != nil {
+			log.G(ctx).WithError(err).Debugf("unable to get the image pull secrets of service account %s/%s", pod.Namespace, name)
+		} else {
+			for _, secret := range sa.ImagePullSecrets {
+				add(types.NamespacedName{Name: secret.Name}, false)
+			}
+		}
+	}
+
+	for _, secret := range p.defaultImagePullSecrets {
+		add(secret, false)
+	}
+	return refs
+}
+
+// getImagePullSecrets returns the registry credentials of a pod, with a single credential per registry as ACI
+// rejects duplicated registries. A registry with credentials in several secrets uses the credentials of the first
+// secret, in the order of getImagePullSecretRefs, and a warning event is emitted when the credentials differ.
+func (p *ACIProvider) getImagePullSecrets(ctx context.Context, pod *v1.Pod) ([]*azaciv2.ImageRegistryCredential, error) {
+	refs := p.getImagePullSecretRefs(ctx, pod)
+	ips := make([]*azaciv2.ImageRegistryCredential, 0, len(refs))
+	type source struct {
+		cred   *azaciv2.ImageRegistryCredential
+		secret types.NamespacedName
+	}
+	servers := map[string]source{}
+	for _, ref := range refs {
+		secret, err := p.secretL.Secrets(ref.Namespace).Get(ref.Name)
+		if err != nil || secret == nil {
+			if !ref.required {
+				log.G(ctx).WithError(err).Warnf("skipping missing image pull secret %s", ref)
+				continue
+			}
+			if err != nil {
+				return ips, err
+			}
+			return nil, fmt.Errorf("error getting image pull secret")
+		}
+
+		var creds []*azaciv2.ImageRegistryCredential
+		switch secret.Type {
+		case v1.SecretTypeDockercfg:
+			creds, err = readDockerCfgSecret(secret, nil)
+		case v1.SecretTypeDockerConfigJson:
+			creds, err = p.readDockerConfigJSONSecret(ctx, secret, nil)
+		default:
+			if !ref.required {
+				log.G(ctx).Warnf("skipping image pull secret %s of type %s", ref, secret.Type)
+				continue
+			}
+			return nil, fmt.Errorf("image pull secret type is not one of kubernetes.io/dockercfg or kubernetes.io/dockerconfigjson")
+		}
+		if err != nil {
+			return ips, err
+		}
+
+		for _, cred := range creds {
+			server := normalizeRegistryServer(stringValue(cred.Server))
+			first, ok := servers[server]
+			if !ok {
+				servers[server] = source{cred: cred, secret: ref.NamespacedName}
+				ips = append(ips, cred)
+				continue
+			}
+			if stringValue(first.cred.Username) == stringValue(cred.Username) && stringValue(first.cred.Password) == stringValue(cred.Password) {
+				continue
+			}
+			log.G(ctx).Warnf("registry %s has different credentials in image pull secrets %s and %s, using the ones of %s",
+				server, first.secret, ref, first.secret)
+			if p.eventRecorder != nil {
+				p.eventRecorder.Eventf(pod, v1.EventTypeWarning, eventReasonRegistryCredentialConflict,
+					"Registry %s has different credentials in image pull secrets %s and %s, using the ones of %s",
+					server, first.secret, ref, first.secret)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// normalizeRegistryServer returns the registry host of a server of a docker config, which may have a scheme
+// and a path, so that the credentials of the same registry are merged.
+func normalizeRegistryServer(server string) string {
+	server = strings.ToLower(strings.TrimSpace(server))
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	switch server {
+	case "docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubServer
+	}
+	return server
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newDockerConfigSecret(namespace, name, server, username string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			v1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{%q:{"username":%q,"password":"password"}}}`, server, username)),
+		},
+	}
+}
+
+func TestGetImagePullSecretsDefaults(t *testing.T) {
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, secret := range []*v1.Secret{
+		newDockerConfigSecret("ns", "pod-secret", "registry.example.com", "pod"),
+		newDockerConfigSecret("ns", "sa-secret", "registry.example.com", "service-account"),
+		newDockerConfigSecret("ns", "sa-other-secret", "other.example.com", "service-account"),
+		newDockerConfigSecret("ns", "namespace-default", "namespace.example.com", "namespace-default"),
+		newDockerConfigSecret("shared", "cluster-default", "cluster.example.com", "cluster-default"),
+	} {
+		assert.NilError(t, secrets.Add(secret))
+	}
+	serviceAccounts := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, serviceAccounts.Add(&v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder"},
+		ImagePullSecrets: []v1.LocalObjectReference{
+			{Name: "sa-secret"}, {Name: "sa-other-secret"}, {Name: "sa-missing-secret"},
+		},
+	}))
+
+	defaultSecrets, err := parseImagePullSecrets([]string{"namespace-default", "shared/cluster-default", "missing"})
+	assert.NilError(t, err)
+	p := ACIProvider{
+		secretL:                 corev1listers.NewSecretLister(secrets),
+		serviceAccountL:         corev1listers.NewServiceAccountLister(serviceAccounts),
+		defaultImagePullSecrets: defaultSecrets,
+	}
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.ServiceAccountName = "builder"
+	pod.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "pod-secret"}}
+
+	ips, err := p.getImagePullSecrets(context.Background(), pod)
+	assert.NilError(t, err)
+	users := map[string]string{}
+	for _, ip := range ips {
+		users[*ip.Server] = *ip.Username
+	}
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"registry.example.com":  "pod",
+		"other.example.com":     "service-account",
+		"namespace.example.com": "namespace-default",
+		"cluster.example.com":   "cluster-default",
+	}, users))
+
+	// secrets of the pod spec are required
+	pod.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "missing"}}
+	_, err = p.getImagePullSecrets(context.Background(), pod)
+	assert.Check(t, is.ErrorContains(err, "not found"))
+}
+
+func TestParseImagePullSecrets(t *testing.T) {
+	secrets, err := parseImagePullSecrets([]string{"regcred", " shared/regcred ", ""})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]types.NamespacedName{
+		{Name: "regcred"},
+		{Namespace: "shared", Name: "regcred"},
+	}, secrets))
+
+	for _, secret := range []string{"/regcred", "shared/", "a/b/c"} {
+		_, err := parseImagePullSecrets([]string{secret})
+		assert.Check(t, is.ErrorContains(err, "must be name or namespace/name"), secret)
+	}
+}
+
+func TestGetImagePullSecretsMergesRegistries(t *testing.T) {
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, secret := range []*v1.Secret{
+		newDockerConfigSecret("ns", "first", "https://index.docker.io/v1/", "first"),
+		newDockerConfigSecret("ns", "same", "docker.io", "first"),
+		newDockerConfigSecret("ns", "conflict", "Registry-1.Docker.io", "conflict"),
+	} {
+		assert.NilError(t, secrets.Add(secret))
+	}
+	recorder := record.NewFakeRecorder(10)
+	p := ACIProvider{
+		secretL:       corev1listers.NewSecretLister(secrets),
+		eventRecorder: recorder,
+	}
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "first"}, {Name: "same"}, {Name: "conflict"}}
+	ips, err := p.getImagePullSecrets(context.Background(), pod)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(ips, 1))
+	assert.Check(t, is.Equal("first", *ips[0].Username))
+
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	event := <-recorder.Events
+	assert.Check(t, is.Contains(event, eventReasonRegistryCredentialConflict))
+	assert.Check(t, is.Contains(event, "ns/first and ns/conflict"))
+}
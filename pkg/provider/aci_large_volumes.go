@@ -0,0 +1,188 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// largeVolumePolicyReject fails the pods with a secret, configMap or projected volume over the size limits of
+	// the ACI secret volumes.
+	largeVolumePolicyReject = "Reject"
+	// largeVolumePolicyArchive ships the volumes over the limits as a gzipped tar split into chunks, extracted
+	// into an emptyDir volume of the same name by an init container before the containers of the pod start.
+	largeVolumePolicyArchive = "Archive"
+
+	// maxSecretVolumeFileSize and maxSecretVolumeSize are the size limits of a file and of all the files of an ACI
+	// secret volume, decoded.
+	maxSecretVolumeFileSize = 256 * 1024
+	maxSecretVolumeSize     = 1024 * 1024
+
+	// defaultVolumeArchiveImage is the image of the init container extracting the archived volumes, it must have
+	// sh, cat and a tar supporting gzip.
+	defaultVolumeArchiveImage = "mcr.microsoft.com/cbl-mariner/busybox:2.0"
+	// volumeArchiveContainerName is the name of the init container extracting the archived volumes.
+	volumeArchiveContainerName = "vk-extract-volumes"
+)
+
+func validateLargeVolumePolicy(policy string) error {
+	switch policy {
+	case "", largeVolumePolicyReject, largeVolumePolicyArchive:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid large volume policy, expected %s or %s", policy, largeVolumePolicyReject, largeVolumePolicyArchive)
+}
+
+// checkSecretVolumeSize returns an error describing why the files of a secret volume don't fit in ACI, nil when
+// they do.
+func checkSecretVolumeSize(files map[string]*string) error {
+	total := 0
+	for _, name := range sortedFileNames(files) {
+		size := decodedSize(*files[name])
+		if size > maxSecretVolumeFileSize {
+			return fmt.Errorf("file %s is %d bytes, over the %d bytes limit of a file", name, size, maxSecretVolumeFileSize)
+		}
+		total += size
+	}
+	if total > maxSecretVolumeSize {
+		return fmt.Errorf("its files are %d bytes, over the %d bytes limit of a volume", total, maxSecretVolumeSize)
+	}
+	return nil
+}
+
+// applyLargeVolumePolicy checks the secret volumes of a container group against the size limits of ACI. The volumes
+// over the limits fail the pod, unless the large volume policy archives them: their files are put in a gzipped tar
+// split into chunks in a secret volume of its own, and the volume is replaced by an emptyDir volume the chunks are
+// extracted to by an init container, run before the other init containers. It returns the volumes and the init
+// containers of the container group.
+func (p *ACIProvider) applyLargeVolumePolicy(pod *v1.Pod, volumes []*azaciv2.Volume,
+	initContainers []*azaciv2.InitContainerDefinition) ([]*azaciv2.Volume, []*azaciv2.InitContainerDefinition, error) {
+	var archived []*azaciv2.Volume
+	var extract []string
+	var mounts []*azaciv2.VolumeMount
+	for i, volume := range volumes {
+		if volume.Secret == nil {
+			continue
+		}
+		sizeErr := checkSecretVolumeSize(volume.Secret)
+		if sizeErr == nil {
+			continue
+		}
+		if p.largeVolumePolicy != largeVolumePolicyArchive {
+			return nil, nil, errdefs.InvalidInputf("pod %s: volume %s doesn't fit in an ACI secret volume: %v, split it or set LargeVolumePolicy "+
+				"to %s in the provider config", pod.Name, *volume.Name, sizeErr, largeVolumePolicyArchive)
+		}
+
+		chunks, err := getVolumeArchive(volume.Secret)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pod %s: error archiving volume %s: %w", pod.Name, *volume.Name, err)
+		}
+		archive := getSecretVolume(getArchiveVolumeName(*volume.Name), chunks)
+		if err := checkSecretVolumeSize(archive.Secret); err != nil {
+			return nil, nil, errdefs.InvalidInputf("pod %s: volume %s doesn't fit in an ACI secret volume once archived: %v", pod.Name, *volume.Name, err)
+		}
+		archived = append(archived, archive)
+		volumes[i] = getEmptyVolume(*volume.Name)
+
+		archivePath := fmt.Sprintf("/vk/archives/%d", len(extract))
+		volumePath := fmt.Sprintf("/vk/volumes/%d", len(extract))
+		extract = append(extract, fmt.Sprintf("cat %s/* | tar -xzf - -C %s", archivePath, volumePath))
+		readOnly := true
+		mounts = append(mounts,
+			&azaciv2.VolumeMount{Name: archive.Name, MountPath: &archivePath, ReadOnly: &readOnly},
+			&azaciv2.VolumeMount{Name: volume.Name, MountPath: &volumePath})
+	}
+	if len(archived) == 0 {
+		return volumes, initContainers, nil
+	}
+
+	name := volumeArchiveContainerName
+	image := p.volumeArchiveImage
+	if image == "" {
+		image = defaultVolumeArchiveImage
+	}
+	command := []*string{stringPtr("/bin/sh"), stringPtr("-c"), stringPtr("set -e; " + strings.Join(extract, "; "))}
+	extractContainer := &azaciv2.InitContainerDefinition{
+		Name: &name,
+		Properties: &azaciv2.InitContainerPropertiesDefinition{
+			Image:        &image,
+			Command:      command,
+			VolumeMounts: mounts,
+		},
+	}
+	return append(volumes, archived...), append([]*azaciv2.InitContainerDefinition{extractContainer}, initContainers...), nil
+}
+
+// getVolumeArchive returns the files of a secret volume as the chunks of a gzipped tar, base64 encoded like the
+// files of secret volumes. The chunks are named so that they are concatenated in order by a shell glob.
+func getVolumeArchive(files map[string]*string) (map[string]*string, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedFileNames(files) {
+		content, err := base64.StdEncoding.DecodeString(*files[name])
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", name, err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: int64(defaultVolumeMode), Size: int64(len(content))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	chunks := make(map[string]*string, len(data)/maxSecretVolumeFileSize+1)
+	for i := 0; i*maxSecretVolumeFileSize < len(data); i++ {
+		end := (i + 1) * maxSecretVolumeFileSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := base64.StdEncoding.EncodeToString(data[i*maxSecretVolumeFileSize : end])
+		chunks[fmt.Sprintf("part-%04d", i)] = &chunk
+	}
+	return chunks, nil
+}
+
+// getArchiveVolumeName returns the name of the secret volume of the archive of a volume, unique within the
+// container group.
+func getArchiveVolumeName(volumeName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(volumeName))
+	return fmt.Sprintf("archive-%08x", h.Sum32())
+}
+
+// decodedSize returns the size of the content of a base64 encoded file.
+func decodedSize(encoded string) int {
+	return len(encoded)/4*3 - (len(encoded) - len(strings.TrimRight(encoded, "=")))
+}
+
+func sortedFileNames(files map[string]*string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
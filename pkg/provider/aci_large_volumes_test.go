@@ -0,0 +1,104 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func largeVolumeTestVolumes(t *testing.T) ([]*azaciv2.Volume, []byte) {
+	// random data doesn't compress, so the archive takes more than one chunk
+	large := make([]byte, maxSecretVolumeFileSize+1024)
+	_, err := rand.New(rand.NewSource(1)).Read(large)
+	assert.NilError(t, err)
+	config := "config"
+	data := "data"
+	return []*azaciv2.Volume{
+		{Name: &config, Secret: map[string]*string{"app.conf": encoded("debug = true")}},
+		{Name: &data, Secret: map[string]*string{"model.bin": encoded(string(large)), "labels.txt": encoded("cat\ndog")}},
+	}, large
+}
+
+func TestApplyLargeVolumePolicyReject(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"}}
+	volumes, _ := largeVolumeTestVolumes(t)
+
+	p := &ACIProvider{}
+	_, _, err := p.applyLargeVolumePolicy(pod, volumes[:1], nil)
+	assert.NilError(t, err)
+
+	_, _, err = p.applyLargeVolumePolicy(pod, volumes, nil)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "volume data doesn't fit in an ACI secret volume: file model.bin"))
+	assert.Check(t, is.ErrorContains(err, "set LargeVolumePolicy to Archive"))
+}
+
+func TestApplyLargeVolumePolicyArchive(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"}}
+	volumes, large := largeVolumeTestVolumes(t)
+	initName := "init"
+	initContainers := []*azaciv2.InitContainerDefinition{{Name: &initName}}
+
+	p := &ACIProvider{largeVolumePolicy: largeVolumePolicyArchive}
+	volumes, initContainers, err := p.applyLargeVolumePolicy(pod, volumes, initContainers)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 3))
+	assert.Check(t, volumes[0].Secret != nil, "the volumes within the limits are left as is")
+	assert.Check(t, is.Equal("data", *volumes[1].Name))
+	assert.Check(t, volumes[1].EmptyDir != nil, "the archived volume is extracted to an emptyDir volume")
+	archive := volumes[2]
+	assert.Check(t, is.Equal(getArchiveVolumeName("data"), *archive.Name))
+	assert.Assert(t, is.Len(archive.Secret, 2))
+
+	assert.Assert(t, is.Len(initContainers, 2))
+	extract := initContainers[0]
+	assert.Check(t, is.Equal(volumeArchiveContainerName, *extract.Name), "the volumes are extracted before the init containers of the pod run")
+	assert.Check(t, is.Equal(defaultVolumeArchiveImage, *extract.Properties.Image))
+	assert.Check(t, is.Equal("set -e; cat /vk/archives/0/* | tar -xzf - -C /vk/volumes/0", *extract.Properties.Command[2]))
+	assert.Assert(t, is.Len(extract.Properties.VolumeMounts, 2))
+	assert.Check(t, is.Equal(*archive.Name, *extract.Properties.VolumeMounts[0].Name))
+	assert.Check(t, is.Equal("data", *extract.Properties.VolumeMounts[1].Name))
+
+	var gzipped []byte
+	for _, name := range sortedFileNames(archive.Secret) {
+		chunk, err := base64.StdEncoding.DecodeString(*archive.Secret[name])
+		assert.NilError(t, err)
+		gzipped = append(gzipped, chunk...)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(gzipped))
+	assert.NilError(t, err)
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		content, err := io.ReadAll(tr)
+		assert.NilError(t, err)
+		files[header.Name] = content
+	}
+	assert.Check(t, is.DeepEqual(map[string][]byte{"labels.txt": []byte("cat\ndog"), "model.bin": large}, files))
+}
+
+func TestValidateLargeVolumePolicy(t *testing.T) {
+	assert.Check(t, validateLargeVolumePolicy(""))
+	assert.Check(t, validateLargeVolumePolicy(largeVolumePolicyArchive))
+	assert.Check(t, is.ErrorContains(validateLargeVolumePolicy("Compress"), "not a valid large volume policy"))
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SetLeading switches the provider between the leader of a highly available deployment, which creates and deletes
+// container groups, and a standby replica, which only serves the read paths. A replica becoming the leader adopts
+// the container groups of the node and creates the container groups of the pods the previous leader missed.
+func (p *ACIProvider) SetLeading(ctx context.Context, leading bool) {
+	if !leading {
+		log.G(ctx).Info("running as standby replica, container groups are not created nor deleted")
+		atomic.StoreUint32(&p.standby, 1)
+		return
+	}
+
+	log.G(ctx).Info("running as leader replica")
+	if atomic.SwapUint32(&p.standby, 0) == 0 {
+		return
+	}
+	if err := p.AdoptContainerGroups(ctx); err != nil {
+		log.G(ctx).WithError(err).Error("failed to adopt the existing container groups")
+	}
+	p.createMissingContainerGroups(ctx)
+}
+
+// isLeading returns whether the provider may create and delete container groups.
+func (p *ACIProvider) isLeading() bool {
+	return atomic.LoadUint32(&p.standby) == 0
+}
+
+// createMissingContainerGroups creates the container groups of the pending pods of the node which have none,
+// as their creation was skipped while the provider was a standby replica.
+func (p *ACIProvider) createMissingContainerGroups(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "aci.createMissingContainerGroups")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Error("failed to list the pods")
+		return
+	}
+	providerPods, err := p.GetPods(ctx)
+	if err != nil {
+		log.G(ctx).WithError(err).Error("failed to list the container groups")
+		return
+	}
+	existing := make(map[string]bool, len(providerPods))
+	for _, pod := range providerPods {
+		existing[pod.Namespace+"/"+pod.Name] = true
+	}
+
+	for _, pod := range pods {
+		pending := pod.Status.Phase == "" || pod.Status.Phase == v1.PodPending
+		if pod.DeletionTimestamp != nil || !pending || existing[pod.Namespace+"/"+pod.Name] {
+			continue
+		}
+		log.G(ctx).Infof("creating missing container group of pod %s/%s", pod.Namespace, pod.Name)
+		if err := p.CreatePod(ctx, pod); err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to create the container group of pod %s/%s", pod.Namespace, pod.Name)
+		}
+	}
+}
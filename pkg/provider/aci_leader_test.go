@@ -0,0 +1,61 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStandbyProvider(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pending := testsutil.CreatePodObj("pending", "ns")
+	running := testsutil.CreatePodObj("running", "ns")
+	running.Status.Phase = v1.PodRunning
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pending, running}, nil).AnyTimes()
+
+	var created, deleted []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		created = append(created, podNS+"/"+podName)
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = append(deleted, cgName)
+		return nil
+	}
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		return nil, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	ctx := context.Background()
+	provider.SetLeading(ctx, false)
+	assert.Check(t, !provider.isLeading())
+	assert.NilError(t, provider.CreatePod(ctx, pending))
+	assert.NilError(t, provider.DeletePod(ctx, running))
+	assert.Check(t, is.Len(created, 0))
+	assert.Check(t, is.Len(deleted, 0))
+
+	// the pending pod skipped while in standby is created once leading
+	provider.SetLeading(ctx, true)
+	assert.Check(t, provider.isLeading())
+	assert.Check(t, is.DeepEqual([]string{"ns/pending"}, created))
+}
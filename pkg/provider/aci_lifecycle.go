@@ -0,0 +1,161 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	lifecycleShell = "/bin/sh"
+
+	// workingDirShellAnnotation opts the containers of a pod with a working directory into running through
+	// lifecycleShell, which changes to it, as images without a shell like the distroless ones can't run then.
+	workingDirShellAnnotation = "virtual-kubelet.io/working-dir-shell"
+
+	eventReasonWorkingDirIgnored = "WorkingDirIgnored"
+)
+
+// hasLifecycleHooks returns whether a container has lifecycle hooks.
+func hasLifecycleHooks(container *v1.Container) bool {
+	return container.Lifecycle != nil && (container.Lifecycle.PostStart != nil || container.Lifecycle.PreStop != nil)
+}
+
+// usesWorkingDirShell returns whether the working directories of the containers of a pod are applied with
+// lifecycleShell, see workingDirShellAnnotation.
+func usesWorkingDirShell(pod *v1.Pod) (bool, error) {
+	value, ok := pod.Annotations[workingDirShellAnnotation]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.InvalidInputf("pod %s: invalid annotation %s %q, must be true or false", pod.Name, workingDirShellAnnotation, value)
+	}
+	return enabled, nil
+}
+
+// usesLifecycleShell returns whether the command of a container is wrapped by getLifecycleCommand, for its
+// lifecycle hooks or its working directory.
+func usesLifecycleShell(pod *v1.Pod, container *v1.Container) bool {
+	if hasLifecycleHooks(container) {
+		return true
+	}
+	shell, _ := usesWorkingDirShell(pod)
+	return container.WorkingDir != "" && shell
+}
+
+// getLifecycleCommand wraps the command of a container with lifecycle hooks in a shell script, since ACI has none.
+// The postStart hook runs in the background next to the container command and the preStop hook runs when the
+// container is asked to stop, before the container command is terminated. ACI has no working directory either:
+// the script changes to the working directory of the container first, so that the hooks run there too, and the
+// containers without hooks are only wrapped for their working directory when the pod opts in with
+// workingDirShellAnnotation, else their working directory is ignored with a warning event.
+// Only exec hooks are supported, and the container command has to be set, see resolveCommand.
+func (p *ACIProvider) getLifecycleCommand(ctx context.Context, pod *v1.Pod, container v1.Container) ([]*string, error) {
+	lifecycle := container.Lifecycle
+	hooks := hasLifecycleHooks(&container)
+	shell, err := usesWorkingDirShell(pod)
+	if err != nil {
+		return nil, err
+	}
+	if !hooks && container.WorkingDir != "" && !shell {
+		message := fmt.Sprintf("Ignoring the working directory %s of container %s, ACI runs the containers in the working directory of their image, unless the pod has the %s=true annotation and the image has %s",
+			container.WorkingDir, container.Name, workingDirShellAnnotation, lifecycleShell)
+		log.G(ctx).Warnf("pod %s: %s", pod.Name, message)
+		if p.eventRecorder != nil {
+			p.eventRecorder.Event(pod, v1.EventTypeWarning, eventReasonWorkingDirIgnored, message)
+		}
+		container.WorkingDir = ""
+	}
+	if !hooks && container.WorkingDir == "" {
+		return p.getCommand(container), nil
+	}
+
+	var postStart, preStop string
+	if hooks {
+		postStart, err = getLifecycleHookCommand(container.Name, "postStart", lifecycle.PostStart)
+		if err != nil {
+			return nil, err
+		}
+		preStop, err = getLifecycleHookCommand(container.Name, "preStop", lifecycle.PreStop)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.getPodOperatingSystem(pod) == string(azaciv2.OperatingSystemTypesWindows) {
+		if hooks {
+			return nil, errdefs.InvalidInputf("container %s: lifecycle hooks are not supported for Windows containers", container.Name)
+		}
+		return nil, errdefs.InvalidInputf("container %s: workingDir is not supported for Windows containers", container.Name)
+	}
+	if len(container.Command) == 0 {
+		if hooks {
+			return nil, errdefs.InvalidInputf("container %s: lifecycle hooks require the command of the container to be set", container.Name)
+		}
+		return nil, errdefs.InvalidInputf("container %s: workingDir requires the command of the container to be set", container.Name)
+	}
+
+	var script strings.Builder
+	if container.WorkingDir != "" {
+		fmt.Fprintf(&script, "cd %s || exit 1\n", shellQuote(container.WorkingDir))
+	}
+	if !hooks {
+		script.WriteString("exec \"$@\"")
+	} else {
+		if postStart != "" {
+			fmt.Fprintf(&script, "(%s) &\n", postStart)
+		}
+		script.WriteString("\"$@\" &\nchild=$!\n")
+		if preStop != "" {
+			fmt.Fprintf(&script, "trap '%s' TERM INT\n", strings.ReplaceAll(fmt.Sprintf("(%s); kill -TERM \"$child\" 2>/dev/null", preStop), "'", `'"'"'`))
+		}
+		// wait returns early when a trapped signal arrives, so wait until the command actually exited
+		script.WriteString("wait \"$child\"\nstatus=$?\nwhile kill -0 \"$child\" 2>/dev/null; do wait \"$child\"; status=$?; done\nexit $status")
+	}
+
+	command := []string{lifecycleShell, "-c", script.String(), lifecycleShell}
+	command = append(command, container.Command...)
+	command = append(command, container.Args...)
+
+	result := make([]*string, 0, len(command))
+	for i := range command {
+		result = append(result, &command[i])
+	}
+	return result, nil
+}
+
+// getLifecycleHookCommand returns the exec command of a lifecycle hook as a shell command line.
+func getLifecycleHookCommand(containerName, hookName string, hook *v1.LifecycleHandler) (string, error) {
+	if hook == nil {
+		return "", nil
+	}
+	if hook.HTTPGet != nil || hook.TCPSocket != nil {
+		return "", errdefs.InvalidInputf("container %s: ACI only supports exec %s hooks", containerName, hookName)
+	}
+	if hook.Exec == nil || len(hook.Exec.Command) == 0 {
+		return "", errdefs.InvalidInputf("container %s: %s hook must specify an exec command", containerName, hookName)
+	}
+
+	quoted := make([]string, 0, len(hook.Exec.Command))
+	for _, arg := range hook.Exec.Command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// shellQuote quotes a string so that it is passed as a single word to a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,189 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetLifecycleCommand(t *testing.T) {
+	execHook := func(command ...string) *v1.LifecycleHandler {
+		return &v1.LifecycleHandler{Exec: &v1.ExecAction{Command: command}}
+	}
+
+	cases := []struct {
+		description     string
+		operatingSystem string
+		workingDirShell bool
+		container       v1.Container
+		expectedCommand []string
+		expectedScript  []string
+		expectedError   string
+	}{
+		{
+			description:     "container without lifecycle hooks",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name:    "c",
+				Command: []string{"nginx"},
+				Args:    []string{"-g", "daemon off;"},
+			},
+			expectedCommand: []string{"nginx", "-g", "daemon off;"},
+		},
+		{
+			description:     "container with exec hooks",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name:    "c",
+				Command: []string{"nginx"},
+				Args:    []string{"-g", "daemon off;"},
+				Lifecycle: &v1.Lifecycle{
+					PostStart: execHook("touch", "/tmp/started"),
+					PreStop:   execHook("nginx", "-s", "quit"),
+				},
+			},
+			expectedCommand: []string{lifecycleShell, "-c", "", lifecycleShell, "nginx", "-g", "daemon off;"},
+			expectedScript:  []string{"('touch' '/tmp/started') &", `trap '('"'"'nginx'"'"' '"'"'-s'"'"' '"'"'quit'"'"')`},
+		},
+		{
+			description:     "container with http hook",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name:    "c",
+				Command: []string{"nginx"},
+				Lifecycle: &v1.Lifecycle{
+					PreStop: &v1.LifecycleHandler{HTTPGet: &v1.HTTPGetAction{Path: "/quit", Port: intstr.FromInt(80)}},
+				},
+			},
+			expectedError: "ACI only supports exec preStop hooks",
+		},
+		{
+			description:     "container with hook but without command",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name: "c",
+				Lifecycle: &v1.Lifecycle{
+					PostStart: execHook("touch", "/tmp/started"),
+				},
+			},
+			expectedError: "lifecycle hooks require the command of the container to be set",
+		},
+		{
+			description:     "container with working directory",
+			operatingSystem: "Linux",
+			workingDirShell: true,
+			container: v1.Container{
+				Name:       "c",
+				Command:    []string{"make"},
+				WorkingDir: "/src/my app",
+			},
+			expectedCommand: []string{lifecycleShell, "-c", "", lifecycleShell, "make"},
+			expectedScript:  []string{"cd '/src/my app' || exit 1\nexec \"$@\""},
+		},
+		{
+			description:     "container with working directory without the shell",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name:       "c",
+				Command:    []string{"make"},
+				WorkingDir: "/src",
+			},
+			expectedCommand: []string{"make"},
+		},
+		{
+			description:     "container with working directory and hook",
+			operatingSystem: "Linux",
+			container: v1.Container{
+				Name:       "c",
+				Command:    []string{"make"},
+				WorkingDir: "/src",
+				Lifecycle: &v1.Lifecycle{
+					PostStart: execHook("touch", "started"),
+				},
+			},
+			expectedCommand: []string{lifecycleShell, "-c", "", lifecycleShell, "make"},
+			expectedScript:  []string{"cd '/src' || exit 1\n('touch' 'started') &"},
+		},
+		{
+			description:     "windows container with working directory",
+			operatingSystem: "Windows",
+			workingDirShell: true,
+			container: v1.Container{
+				Name:       "c",
+				Command:    []string{"cmd"},
+				WorkingDir: "C:\\app",
+			},
+			expectedError: "workingDir is not supported for Windows containers",
+		},
+		{
+			description:     "windows container with hook",
+			operatingSystem: "Windows",
+			container: v1.Container{
+				Name:    "c",
+				Command: []string{"cmd"},
+				Lifecycle: &v1.Lifecycle{
+					PostStart: execHook("echo", "started"),
+				},
+			},
+			expectedError: "lifecycle hooks are not supported for Windows containers",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			provider := ACIProvider{operatingSystem: tc.operatingSystem}
+			pod := &v1.Pod{}
+			if tc.workingDirShell {
+				pod.Annotations = map[string]string{workingDirShellAnnotation: "true"}
+			}
+			command, err := provider.getLifecycleCommand(context.Background(), pod, tc.container)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(len(tc.expectedCommand), len(command)))
+			for i := range command {
+				if tc.expectedCommand[i] == "" {
+					// the wrapping script
+					for _, part := range tc.expectedScript {
+						assert.Check(t, strings.Contains(*command[i], part), "script %q should contain %q", *command[i], part)
+					}
+					continue
+				}
+				assert.Check(t, is.Equal(tc.expectedCommand[i], *command[i]))
+			}
+		})
+	}
+}
+
+func TestGetLifecycleCommandWorkingDirShell(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	provider := ACIProvider{operatingSystem: "Windows", eventRecorder: recorder}
+	container := v1.Container{Name: "c", Command: []string{"app"}, WorkingDir: "/app"}
+
+	// the working directory is ignored, even for Windows containers, with a warning event
+	command, err := provider.getLifecycleCommand(context.Background(), &v1.Pod{}, container)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(command, 1))
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	event := <-recorder.Events
+	assert.Check(t, is.Contains(event, eventReasonWorkingDirIgnored))
+	assert.Check(t, is.Contains(event, workingDirShellAnnotation))
+
+	pod := &v1.Pod{}
+	pod.Annotations = map[string]string{workingDirShellAnnotation: "yes please"}
+	_, err = provider.getLifecycleCommand(context.Background(), pod, container)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
@@ -0,0 +1,379 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	logArchiveBlobAPIVersion  = "2021-08-06"
+	logArchiveClientName      = "logarchive"
+	logArchiveClientVer       = "v1.0.0"
+	defaultLogArchiveInterval = 5 * time.Minute
+	// maxAppendBlockBytes is the maximum size of a block appended to an append blob.
+	maxAppendBlockBytes = 4 << 20
+)
+
+// blobLogArchiver appends the logs of the containers to append blobs of an Azure Storage blob container, named
+// <node>/<namespace>/<pod>/<pod UID>/<container>/<restart count>.log, so that they outlive their container groups.
+// The blob container may be shared by several virtual nodes, each one only manages the blobs of its node.
+type blobLogArchiver struct {
+	containerURL string
+	pipeline     runtime.Pipeline
+	// prefix is the name of the virtual node, the blobs of the other nodes are left alone.
+	prefix string
+	// interval is the time between two copies of the logs of the running containers.
+	interval time.Duration
+	// retention is the time the blobs are kept after their last update, they are kept forever when it is zero.
+	retention time.Duration
+
+	lock sync.Mutex
+	// archived is the timestamp of the last line appended to each blob, only the lines after it are appended. The
+	// blobs without one are created again with all the logs, e.g. after a restart of the provider.
+	archived map[string]time.Time
+}
+
+// newBlobLogArchiver creates a log archiver of a virtual node for the blob container URL, authenticated with the
+// credential of the virtual node, which needs the Storage Blob Data Contributor role on the blob container.
+func newBlobLogArchiver(containerURL, nodeName string, credential azcore.TokenCredential, interval, retention time.Duration) (*blobLogArchiver, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing log archive container URL: %v", err)
+	}
+	if u.Scheme != "https" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("log archive container URL %q must be an https URL of a blob container", containerURL)
+	}
+
+	retryOptions, err := client.GetRetryOptions()
+	if err != nil {
+		return nil, err
+	}
+	// tokens for the storage account itself are valid in every cloud
+	scope := u.Scheme + "://" + u.Host + "/.default"
+	pl := runtime.NewPipeline(logArchiveClientName, logArchiveClientVer, runtime.PipelineOptions{
+		PerRetry: []policy.Policy{runtime.NewBearerTokenPolicy(credential, []string{scope}, nil)},
+	}, &policy.ClientOptions{Retry: retryOptions})
+
+	return &blobLogArchiver{
+		containerURL: strings.TrimSuffix(containerURL, "/"),
+		pipeline:     pl,
+		prefix:       nodeName,
+		interval:     interval,
+		retention:    retention,
+	}, nil
+}
+
+func (a *blobLogArchiver) blobName(pod *v1.Pod, container string, restartCount int32) string {
+	return path.Join(a.prefix, pod.Namespace, pod.Name, string(pod.UID), container, strconv.Itoa(int(restartCount))+".log")
+}
+
+// archive appends the lines of the logs of a container instance which were not archived yet to its blob.
+func (a *blobLogArchiver) archive(ctx context.Context, name, logs string) error {
+	a.lock.Lock()
+	last, ok := a.archived[name]
+	a.lock.Unlock()
+
+	content := logs
+	if ok {
+		// the logs have timestamps, the lines of the same timestamp as the last archived one were archived with it
+		content = client.ApplyLogOptions(logs, api.ContainerLogOpts{SinceTime: last.Add(time.Nanosecond), Timestamps: true}, time.Now())
+	} else if err := a.createAppendBlob(ctx, name); err != nil {
+		return err
+	}
+	for len(content) > 0 {
+		block := content
+		if len(block) > maxAppendBlockBytes {
+			block = block[:maxAppendBlockBytes]
+		}
+		if err := a.appendBlock(ctx, name, block); err != nil {
+			// the blob is created again with all the logs next time
+			a.forget(name)
+			return err
+		}
+		content = content[len(block):]
+	}
+
+	if timestamp, found := lastLogTimestamp(logs); found && timestamp.After(last) {
+		last = timestamp
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.archived == nil {
+		a.archived = map[string]time.Time{}
+	}
+	a.archived[name] = last
+	return nil
+}
+
+func (a *blobLogArchiver) forget(name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.archived, name)
+}
+
+// retain forgets the blobs which are not in names, whose pods are gone or whose containers restarted.
+func (a *blobLogArchiver) retain(names map[string]bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for name := range a.archived {
+		if !names[name] {
+			delete(a.archived, name)
+		}
+	}
+}
+
+// lastLogTimestamp returns the timestamp of the last line of logs with a timestamp.
+func lastLogTimestamp(logs string) (time.Time, bool) {
+	lines := strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		prefix, _, _ := strings.Cut(lines[i], " ")
+		if timestamp, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+			return timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// createAppendBlob creates an empty append blob, replacing the blob of the same name.
+func (a *blobLogArchiver) createAppendBlob(ctx context.Context, name string) error {
+	req, err := a.newRequest(ctx, http.MethodPut, runtime.JoinPaths(a.containerURL, name))
+	if err != nil {
+		return err
+	}
+	req.Raw().Header.Set("x-ms-blob-type", "AppendBlob")
+	req.Raw().Header.Set("x-ms-blob-content-type", "text/plain; charset=utf-8")
+	resp, err := a.pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusCreated) {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+func (a *blobLogArchiver) appendBlock(ctx context.Context, name, block string) error {
+	req, err := a.newRequest(ctx, http.MethodPut, runtime.JoinPaths(a.containerURL, name))
+	if err != nil {
+		return err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("comp", "appendblock")
+	req.Raw().URL.RawQuery = query.Encode()
+	if err := req.SetBody(streaming.NopCloser(bytes.NewReader([]byte(block))), "application/octet-stream"); err != nil {
+		return err
+	}
+	resp, err := a.pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusCreated) {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+type blobList struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			LastModified string `xml:"Last-Modified"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// expire deletes the blobs of the node which were not updated within the retention.
+func (a *blobLogArchiver) expire(ctx context.Context, now time.Time) error {
+	if a.retention <= 0 {
+		return nil
+	}
+	marker := ""
+	for {
+		req, err := a.newRequest(ctx, http.MethodGet, a.containerURL)
+		if err != nil {
+			return err
+		}
+		query := req.Raw().URL.Query()
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", a.prefix+"/")
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		req.Raw().URL.RawQuery = query.Encode()
+		resp, err := a.pipeline.Do(req)
+		if err != nil {
+			return err
+		}
+		if !runtime.HasStatusCode(resp, http.StatusOK) {
+			return runtime.NewResponseError(resp)
+		}
+		var list blobList
+		if err := runtime.UnmarshalAsXML(resp, &list); err != nil {
+			return err
+		}
+
+		for _, blob := range list.Blobs {
+			lastModified, err := time.Parse(http.TimeFormat, blob.Properties.LastModified)
+			if err != nil || now.Sub(lastModified) < a.retention || !strings.HasPrefix(blob.Name, a.prefix+"/") {
+				continue
+			}
+			if err := a.delete(ctx, blob.Name); err != nil {
+				return err
+			}
+		}
+
+		if list.NextMarker == "" {
+			return nil
+		}
+		marker = list.NextMarker
+	}
+}
+
+func (a *blobLogArchiver) delete(ctx context.Context, name string) error {
+	req, err := a.newRequest(ctx, http.MethodDelete, runtime.JoinPaths(a.containerURL, name))
+	if err != nil {
+		return err
+	}
+	resp, err := a.pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusAccepted, http.StatusNotFound) {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+func (a *blobLogArchiver) newRequest(ctx context.Context, method, endpoint string) (*policy.Request, error) {
+	req, err := runtime.NewRequest(ctx, method, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().Header.Set("x-ms-version", logArchiveBlobAPIVersion)
+	return req, nil
+}
+
+// StartLogArchive copies the logs of the containers of the pods of the node to the log archive periodically and
+// deletes the expired archived logs, when a log archive is configured.
+func (p *ACIProvider) StartLogArchive(ctx context.Context) {
+	if p.logArchiver == nil {
+		return
+	}
+	interval := p.logArchiver.interval
+	if interval <= 0 {
+		interval = defaultLogArchiveInterval
+	}
+
+	go func() {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			p.archiveLogs(ctx)
+			timer.Reset(interval)
+		}
+	}()
+}
+
+// archiveLogs appends the new logs of the containers of the pods of the node to the log archive. The restart
+// counts of the containers are read from the statuses of the pods, so only their logs are read from ACI.
+func (p *ACIProvider) archiveLogs(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "aci.archiveLogs")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	// the replicas share the log archive
+	if !p.isLeading() {
+		return
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to list the pods to archive their logs")
+		return
+	}
+	names := map[string]bool{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		p.archivePodLogs(ctx, pod, names)
+	}
+	p.logArchiver.retain(names)
+
+	if err := p.logArchiver.expire(ctx, time.Now()); err != nil {
+		log.G(ctx).WithError(err).Warn("unable to delete the expired archived logs")
+	}
+}
+
+// archivePodLogs appends the new logs of the current instances of the started containers of a pod to the log
+// archive, and adds the names of their blobs to names. Errors are only logged, as archiving must not hold back
+// the pod, and it returns whether all the logs were archived, or there was nothing to archive.
+func (p *ACIProvider) archivePodLogs(ctx context.Context, pod *v1.Pod, names map[string]bool) bool {
+	archived := true
+	for _, status := range pod.Status.ContainerStatuses {
+		// the containers which never started have no logs
+		if status.State.Waiting != nil && status.LastTerminationState == (v1.ContainerState{}) {
+			continue
+		}
+		name := p.logArchiver.blobName(pod, status.Name, status.RestartCount)
+		if names != nil {
+			names[name] = true
+		}
+		logs, err := p.azClientsAPIs.ListLogs(ctx, p.getResourceGroup(pod.Namespace), containerGroupName(pod.Namespace, pod.Name), status.Name, api.ContainerLogOpts{Timestamps: true})
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			log.G(ctx).WithError(err).Warnf("unable to read the logs of container %s of pod %s/%s to archive them", status.Name, pod.Namespace, pod.Name)
+			archived = false
+			continue
+		}
+		if err := p.logArchiver.archive(ctx, name, stringValue(logs)); err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to archive the logs of container %s of pod %s/%s", status.Name, pod.Namespace, pod.Name)
+			archived = false
+		}
+	}
+	return archived
+}
+
+// archivePodLogsBeforeDeletion appends the last logs of the containers of a pod to the log archive before the
+// provider deletes its container group, e.g. once it completed. The pods deleted through the API only have the
+// logs archived by the last archiveLogs, so that their deletion is not held back by the archive. It returns whether
+// all the logs were archived, or there was nothing to archive.
+func (p *ACIProvider) archivePodLogsBeforeDeletion(ctx context.Context, pod *v1.Pod) bool {
+	if p.logArchiver == nil {
+		return true
+	}
+	return p.archivePodLogs(ctx, pod, nil)
+}
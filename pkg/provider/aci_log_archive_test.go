@@ -0,0 +1,151 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeBlobContainer serves the blob operations of the log archiver from memory.
+type fakeBlobContainer struct {
+	lock         sync.Mutex
+	blobs        map[string]string
+	lastModified map[string]time.Time
+}
+
+func (f *fakeBlobContainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/logs/")
+	switch {
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-blob-type") == "AppendBlob":
+		f.blobs[name] = ""
+		f.lastModified[name] = time.Now()
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "appendblock":
+		if _, ok := f.blobs[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		content, _ := io.ReadAll(r.Body)
+		f.blobs[name] += string(content)
+		f.lastModified[name] = time.Now()
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && r.URL.Query().Get("comp") == "list":
+		fmt.Fprint(w, "<EnumerationResults><Blobs>")
+		for name := range f.blobs {
+			if !strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				continue
+			}
+			fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified></Properties></Blob>",
+				name, f.lastModified[name].UTC().Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker/></EnumerationResults>")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestNewBlobLogArchiver(t *testing.T) {
+	for _, containerURL := range []string{"http://account.blob.core.windows.net/logs", "https://account.blob.core.windows.net/", "://"} {
+		_, err := newBlobLogArchiver(containerURL, "node", nil, 0, 0)
+		assert.Check(t, err != nil, containerURL)
+	}
+	archiver, err := newBlobLogArchiver("https://account.blob.core.windows.net/logs/", "node", nil, time.Minute, time.Hour)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("https://account.blob.core.windows.net/logs", archiver.containerURL))
+}
+
+func TestArchivePodLogs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	blobs := &fakeBlobContainer{blobs: map[string]string{}, lastModified: map[string]time.Time{}}
+	server := httptest.NewServer(blobs)
+	defer server.Close()
+	// the blobs of the other nodes sharing the blob container
+	blobs.blobs["other-node/ns/pod/uid/c/0.log"] = "other logs\n"
+	blobs.lastModified["other-node/ns/pod/uid/c/0.log"] = time.Now()
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid"}}
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "c", RestartCount: 2, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+		{Name: "waiting", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+	}
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		t.Error("the logs are archived without reading the container group")
+		return nil, nil
+	}
+	logs := "2022-01-01T00:00:00Z first\n"
+	reads := 0
+	aciMocks.MockListLogs = func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
+		reads++
+		assert.Check(t, is.Equal("ns-pod", cgName))
+		assert.Check(t, is.Equal("c", containerName))
+		assert.Check(t, opts.Timestamps)
+		content := logs
+		return &content, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	provider.logArchiver = &blobLogArchiver{
+		containerURL: server.URL + "/logs",
+		pipeline:     runtime.NewPipeline("test", "v1.0.0", runtime.PipelineOptions{}, nil),
+		prefix:       "node",
+		retention:    time.Hour,
+	}
+
+	name := "node/ns/pod/uid/c/2.log"
+	assert.Check(t, provider.archivePodLogsBeforeDeletion(context.Background(), pod))
+	assert.Check(t, is.Equal("2022-01-01T00:00:00Z first\n", blobs.blobs[name]))
+	assert.Check(t, is.Equal(1, reads))
+
+	// only the new lines are appended
+	logs = "2022-01-01T00:00:00Z first\n2022-01-01T00:00:01Z second\n"
+	assert.Check(t, provider.archivePodLogsBeforeDeletion(context.Background(), pod))
+	assert.Check(t, is.Equal("2022-01-01T00:00:00Z first\n2022-01-01T00:00:01Z second\n", blobs.blobs[name]))
+
+	// the blobs are created again once forgotten
+	provider.logArchiver.retain(map[string]bool{})
+	logs = "2022-01-01T00:00:01Z second\n"
+	assert.Check(t, provider.archivePodLogsBeforeDeletion(context.Background(), pod))
+	assert.Check(t, is.Equal("2022-01-01T00:00:01Z second\n", blobs.blobs[name]))
+
+	// DeletePod doesn't wait for the archive
+	reads = 0
+	assert.NilError(t, provider.DeletePod(context.Background(), pod))
+	assert.Check(t, is.Equal(0, reads))
+
+	// the logs are kept within the retention
+	assert.NilError(t, provider.logArchiver.expire(context.Background(), time.Now()))
+	assert.Check(t, is.Len(blobs.blobs, 2))
+
+	// and only the blobs of the node are deleted after it
+	assert.NilError(t, provider.logArchiver.expire(context.Background(), time.Now().Add(2*time.Hour)))
+	assert.Check(t, is.DeepEqual(map[string]string{"other-node/ns/pod/uid/c/0.log": "other logs\n"}, blobs.blobs))
+}
@@ -0,0 +1,177 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// containerGroupWebhookFailurePolicyFail fails the pods whose container group the webhook couldn't mutate,
+	// containerGroupWebhookFailurePolicyIgnore creates their container group unchanged.
+	containerGroupWebhookFailurePolicyFail   = "Fail"
+	containerGroupWebhookFailurePolicyIgnore = "Ignore"
+
+	defaultContainerGroupWebhookTimeout = 10 * time.Second
+	maxContainerGroupWebhookResponse    = 4 << 20
+)
+
+// ContainerGroupMutator changes the container group translated from a pod before it is created, e.g. to add
+// sidecars, extensions or DNS settings. An error fails the pod.
+type ContainerGroupMutator interface {
+	MutateContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error
+}
+
+// ContainerGroupMutatorFunc is a function implementing ContainerGroupMutator.
+type ContainerGroupMutatorFunc func(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error
+
+func (f ContainerGroupMutatorFunc) MutateContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+	return f(ctx, pod, cg)
+}
+
+// AddContainerGroupMutator registers a mutator of the container groups, run after the ones registered before it
+// and before the container group webhook of the config file.
+func (p *ACIProvider) AddContainerGroupMutator(mutator ContainerGroupMutator) {
+	p.containerGroupMutators = append(p.containerGroupMutators, mutator)
+}
+
+func validateContainerGroupWebhookFailurePolicy(policy string) error {
+	switch policy {
+	case "", containerGroupWebhookFailurePolicyFail, containerGroupWebhookFailurePolicyIgnore:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid container group webhook failure policy, expected %s or %s", policy,
+		containerGroupWebhookFailurePolicyFail, containerGroupWebhookFailurePolicyIgnore)
+}
+
+// ContainerGroupReview is the request and the response of the container group webhook. The webhook receives the
+// pod and its container group, and returns the container group to create, or an error message to fail the pod.
+type ContainerGroupReview struct {
+	Pod            *v1.Pod                 `json:"pod,omitempty"`
+	ContainerGroup *azaciv2.ContainerGroup `json:"containerGroup,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// containerGroupWebhook is a ContainerGroupMutator posting the container groups to an external service.
+type containerGroupWebhook struct {
+	url           string
+	client        *http.Client
+	failurePolicy string
+}
+
+func newContainerGroupWebhook(rawURL string, timeout time.Duration, failurePolicy string) (*containerGroupWebhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not a valid container group webhook URL", rawURL)
+	}
+	if timeout <= 0 {
+		timeout = defaultContainerGroupWebhookTimeout
+	}
+	if failurePolicy == "" {
+		failurePolicy = containerGroupWebhookFailurePolicyFail
+	}
+	return &containerGroupWebhook{
+		url:           rawURL,
+		client:        &http.Client{Timeout: timeout},
+		failurePolicy: failurePolicy,
+	}, nil
+}
+
+func (w *containerGroupWebhook) MutateContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+	mutated, err := w.review(ctx, pod, cg)
+	if err != nil {
+		if w.failurePolicy == containerGroupWebhookFailurePolicyIgnore && !errdefs.IsInvalidInput(err) {
+			log.G(ctx).WithError(err).Warnf("container group webhook failed, creating the container group of pod %s unchanged", pod.Name)
+			return nil
+		}
+		return err
+	}
+	*cg = *mutated
+	return nil
+}
+
+// review posts a pod and its container group to the webhook and returns the container group it answered. The
+// rejections of the webhook are invalid input, so that they are reported regardless of the failure policy.
+func (w *containerGroupWebhook) review(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) (*azaciv2.ContainerGroup, error) {
+	body, err := json.Marshal(&ContainerGroupReview{Pod: pod, ContainerGroup: cg})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling the container group webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the container group webhook answered HTTP %d", resp.StatusCode)
+	}
+
+	var review ContainerGroupReview
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxContainerGroupWebhookResponse)).Decode(&review); err != nil {
+		return nil, fmt.Errorf("error parsing the answer of the container group webhook: %w", err)
+	}
+	if review.Error != "" {
+		return nil, errdefs.InvalidInputf("the container group webhook rejected the pod: %s", review.Error)
+	}
+	if review.ContainerGroup == nil || review.ContainerGroup.Properties == nil {
+		return nil, fmt.Errorf("the container group webhook answered no container group")
+	}
+	return review.ContainerGroup, nil
+}
+
+// mutateContainerGroup runs the mutators of the container groups on the container group of a pod. The tags the
+// provider finds the container groups of its pods by are restored, so that a mutator can't orphan them.
+func (p *ACIProvider) mutateContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+	mutators := p.containerGroupMutators
+	if p.containerGroupWebhook != nil {
+		mutators = append(mutators[:len(mutators):len(mutators)], p.containerGroupWebhook)
+	}
+	if len(mutators) == 0 {
+		return nil
+	}
+	ctx, span := trace.StartSpan(ctx, "aci.mutateContainerGroup")
+	defer span.End()
+
+	tags := make(map[string]*string, len(containerGroupOwnerTags))
+	for _, tag := range containerGroupOwnerTags {
+		tags[tag] = cg.Tags[tag]
+	}
+	for _, mutator := range mutators {
+		if err := mutator.MutateContainerGroup(ctx, pod, cg); err != nil {
+			return err
+		}
+	}
+	if cg.Properties == nil {
+		return fmt.Errorf("a container group mutator removed the properties of the container group of pod %s", pod.Name)
+	}
+	if cg.Tags == nil {
+		cg.Tags = make(map[string]*string, len(tags))
+	}
+	for tag, value := range tags {
+		cg.Tags[tag] = value
+	}
+	return nil
+}
+
+// containerGroupOwnerTags are the tags identifying the pod of a container group.
+var containerGroupOwnerTags = []string{"PodName", "NodeName", "Namespace", "UID", "CreationTimestamp"}
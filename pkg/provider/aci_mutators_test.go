@@ -0,0 +1,119 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func newMutatorTestContainerGroup() *azaciv2.ContainerGroup {
+	return &azaciv2.ContainerGroup{
+		Tags: map[string]*string{"PodName": stringPtr("pod"), "Namespace": stringPtr("ns")},
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{
+			Containers: []*azaciv2.Container{{Name: stringPtr("app")}},
+		},
+	}
+}
+
+func TestMutateContainerGroup(t *testing.T) {
+	p := ACIProvider{}
+	pod := testsutil.CreatePodObj("pod", "ns")
+	var calls []string
+	p.AddContainerGroupMutator(ContainerGroupMutatorFunc(func(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+		calls = append(calls, "sidecar")
+		cg.Properties.Containers = append(cg.Properties.Containers, &azaciv2.Container{Name: stringPtr("sidecar")})
+		return nil
+	}))
+	p.AddContainerGroupMutator(ContainerGroupMutatorFunc(func(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+		calls = append(calls, "tags")
+		cg.Tags = map[string]*string{"PodName": stringPtr("other"), "team": stringPtr("blue")}
+		return nil
+	}))
+
+	cg := newMutatorTestContainerGroup()
+	assert.NilError(t, p.mutateContainerGroup(context.Background(), pod, cg))
+	assert.Check(t, is.DeepEqual([]string{"sidecar", "tags"}, calls))
+	assert.Check(t, is.Len(cg.Properties.Containers, 2))
+	// the tags of the pod are restored
+	assert.Check(t, is.Equal("pod", stringValue(cg.Tags["PodName"])))
+	assert.Check(t, is.Equal("ns", stringValue(cg.Tags["Namespace"])))
+	assert.Check(t, is.Equal("blue", stringValue(cg.Tags["team"])))
+
+	p.AddContainerGroupMutator(ContainerGroupMutatorFunc(func(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) error {
+		return errors.New("no sidecar for you")
+	}))
+	assert.Check(t, is.ErrorContains(p.mutateContainerGroup(context.Background(), pod, newMutatorTestContainerGroup()), "no sidecar for you"))
+}
+
+func TestContainerGroupWebhook(t *testing.T) {
+	var answer func(w http.ResponseWriter, review *ContainerGroupReview)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review ContainerGroupReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		answer(w, &review)
+	}))
+	defer server.Close()
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	webhook, err := newContainerGroupWebhook(server.URL, 0, "")
+	assert.NilError(t, err)
+	p := ACIProvider{containerGroupWebhook: webhook}
+
+	answer = func(w http.ResponseWriter, review *ContainerGroupReview) {
+		dns := &azaciv2.DNSConfiguration{NameServers: []*string{stringPtr("10.0.0.10")}}
+		review.ContainerGroup.Properties.DNSConfig = dns
+		assert.Check(t, json.NewEncoder(w).Encode(&ContainerGroupReview{ContainerGroup: review.ContainerGroup}))
+	}
+	cg := newMutatorTestContainerGroup()
+	assert.NilError(t, p.mutateContainerGroup(context.Background(), pod, cg))
+	assert.Assert(t, cg.Properties.DNSConfig != nil)
+	assert.Check(t, is.Equal("10.0.0.10", stringValue(cg.Properties.DNSConfig.NameServers[0])))
+	assert.Check(t, is.Equal("pod", stringValue(cg.Tags["PodName"])))
+
+	answer = func(w http.ResponseWriter, review *ContainerGroupReview) {
+		assert.Check(t, json.NewEncoder(w).Encode(&ContainerGroupReview{Error: "images must come from our registry"}))
+	}
+	err = p.mutateContainerGroup(context.Background(), pod, newMutatorTestContainerGroup())
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "images must come from our registry"))
+
+	answer = func(w http.ResponseWriter, review *ContainerGroupReview) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	assert.Check(t, is.ErrorContains(p.mutateContainerGroup(context.Background(), pod, newMutatorTestContainerGroup()), "HTTP 500"))
+
+	// the failures of the webhook are ignored with the Ignore policy, but not its rejections
+	webhook.failurePolicy = containerGroupWebhookFailurePolicyIgnore
+	cg = newMutatorTestContainerGroup()
+	assert.NilError(t, p.mutateContainerGroup(context.Background(), pod, cg))
+	assert.Check(t, is.Len(cg.Properties.Containers, 1))
+	answer = func(w http.ResponseWriter, review *ContainerGroupReview) {
+		assert.Check(t, json.NewEncoder(w).Encode(&ContainerGroupReview{Error: "rejected"}))
+	}
+	assert.Check(t, errdefs.IsInvalidInput(p.mutateContainerGroup(context.Background(), pod, newMutatorTestContainerGroup())))
+}
+
+func TestNewContainerGroupWebhook(t *testing.T) {
+	for _, rawURL := range []string{"ftp://example.com", "example.com/mutate", "https://"} {
+		_, err := newContainerGroupWebhook(rawURL, 0, "")
+		assert.Check(t, is.ErrorContains(err, "not a valid container group webhook URL"), rawURL)
+	}
+	assert.Check(t, is.ErrorContains(validateContainerGroupWebhookFailurePolicy("Retry"), "not a valid"))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// namespaceDefaultCPURequestAnnotation and namespaceDefaultMemoryRequestAnnotation are the quantities requested
+	// by the containers of the pods of an annotated namespace which don't request CPU or memory.
+	namespaceDefaultCPURequestAnnotation    = "virtual-kubelet.io/default-cpu-request"
+	namespaceDefaultMemoryRequestAnnotation = "virtual-kubelet.io/default-memory-request"
+
+	// minCPURequest and minMemoryRequestGB are the smallest resources ACI runs a container with.
+	minCPURequest      = defaultCPURequestGranularity
+	minMemoryRequestGB = defaultMemoryRequestGranularityGB
+)
+
+// SetNamespaceLister sets the lister the default requests of the namespaces are read with.
+func (p *ACIProvider) SetNamespaceLister(lister corev1listers.NamespaceLister) {
+	p.namespaceL = lister
+}
+
+// validateDefaultRequests checks that default requests are not below the minimums of ACI, which would fail the
+// container groups of all the pods they apply to.
+func validateDefaultRequests(cpu, memoryGB float64) error {
+	if cpu != 0 && cpu < minCPURequest {
+		return fmt.Errorf("default CPU request %g is lower than the ACI minimum of %g", cpu, minCPURequest)
+	}
+	if memoryGB != 0 && memoryGB < minMemoryRequestGB {
+		return fmt.Errorf("default memory request %gGB is lower than the ACI minimum of %gGB", memoryGB, minMemoryRequestGB)
+	}
+	return nil
+}
+
+// validateDefaultResourceList checks the CPU and memory of default requests against the minimums of ACI.
+func validateDefaultResourceList(requests v1.ResourceList) error {
+	var cpu, memoryGB float64
+	if q, ok := requests[v1.ResourceCPU]; ok {
+		cpu = cpuValue(q)
+	}
+	if q, ok := requests[v1.ResourceMemory]; ok {
+		memoryGB = memoryValueGB(q)
+	}
+	return validateDefaultRequests(cpu, memoryGB)
+}
+
+// getNamespaceDefaultRequests returns the default requests of the annotations of a namespace, none when the
+// namespace lister isn't set. They take precedence over the other default requests, see getDefaultRequests.
+func (p *ACIProvider) getNamespaceDefaultRequests(namespace string) (v1.ResourceList, error) {
+	if p.namespaceL == nil {
+		return nil, nil
+	}
+	ns, err := p.namespaceL.Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var requests v1.ResourceList
+	for annotation, name := range map[string]v1.ResourceName{
+		namespaceDefaultCPURequestAnnotation:    v1.ResourceCPU,
+		namespaceDefaultMemoryRequestAnnotation: v1.ResourceMemory,
+	} {
+		value, ok := ns.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil || quantity.Sign() <= 0 {
+			return nil, errdefs.InvalidInputf("invalid %s annotation %q of namespace %s, expected a positive quantity",
+				annotation, value, namespace)
+		}
+		if requests == nil {
+			requests = v1.ResourceList{}
+		}
+		requests[name] = quantity
+	}
+	if err := validateDefaultResourceList(requests); err != nil {
+		return nil, errdefs.InvalidInputf("namespace %s: %v", namespace, err)
+	}
+	return requests, nil
+}
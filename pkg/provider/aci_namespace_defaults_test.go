@@ -0,0 +1,100 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestGetDefaultRequests(t *testing.T) {
+	namespaces := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, namespaces.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "batch",
+		Annotations: map[string]string{
+			namespaceDefaultCPURequestAnnotation:    "250m",
+			namespaceDefaultMemoryRequestAnnotation: "512M",
+		},
+	}}))
+	assert.NilError(t, namespaces.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Annotations: map[string]string{namespaceDefaultCPURequestAnnotation: "100m"},
+	}}))
+	assert.NilError(t, namespaces.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tiny",
+		Annotations: map[string]string{namespaceDefaultCPURequestAnnotation: "1m"},
+	}}))
+	var p ACIProvider
+	assert.NilError(t, p.loadConfig(bytes.NewReader([]byte(`
+DefaultCPURequest = 2.0
+
+[[PodDefaults]]
+Namespaces = ["team-a", "team-b"]
+Requests = { "cpu" = "500m", "memory" = "1G" }
+
+[[PodDefaults]]
+Requests = { "cpu" = "4", "memory" = "8G" }
+`))))
+	p.SetNamespaceLister(corev1listers.NewNamespaceLister(namespaces))
+
+	for _, tc := range []struct {
+		namespace string
+		cpu       float64
+		memoryGB  float64
+	}{
+		// the namespace annotations take precedence
+		{namespace: "batch", cpu: 0.25, memoryGB: 0.512},
+		// then the first pod defaults of the namespace, for each resource
+		{namespace: "team-a", cpu: 0.1, memoryGB: 1},
+		{namespace: "team-b", cpu: 0.5, memoryGB: 1},
+		{namespace: "other", cpu: 4, memoryGB: 8},
+	} {
+		cpu, memoryGB, err := p.getDefaultRequests(tc.namespace)
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(tc.cpu, cpu), tc.namespace)
+		assert.Check(t, is.Equal(tc.memoryGB, memoryGB), tc.namespace)
+	}
+
+	// then the defaults of the node, and the built-in ones
+	p.podDefaults = nil
+	cpu, memoryGB, err := p.getDefaultRequests("other")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(2.0, cpu))
+	assert.Check(t, is.Equal(defaultMemoryRequestGB, memoryGB))
+
+	_, _, err = p.getDefaultRequests("tiny")
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "lower than the ACI minimum"))
+
+	// the containers without requests get the default requests of their namespace
+	pod := testsutil.CreatePodObj("pod", "batch")
+	pod.Spec.Containers[0].Resources = v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+	}
+	containers, err := p.getContainers(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(2.0, *containers[0].Properties.Resources.Requests.CPU))
+	assert.Check(t, is.Equal(0.512, *containers[0].Properties.Resources.Requests.MemoryInGB))
+}
+
+func TestLoadConfigDefaultRequestMinimums(t *testing.T) {
+	p := ACIProvider{}
+	err := p.loadConfig(bytes.NewReader([]byte("DefaultMemoryRequestGB = 0.05\n")))
+	assert.Check(t, is.ErrorContains(err, "lower than the ACI minimum"))
+
+	err = p.loadConfig(bytes.NewReader([]byte("[[PodDefaults]]\nRequests = { \"cpu\" = \"5m\" }\n")))
+	assert.Check(t, is.ErrorContains(err, "lower than the ACI minimum"))
+}
@@ -0,0 +1,434 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+)
+
+const (
+	networkPolicySyncInterval = time.Minute
+	// defaultNetworkPolicyPriority is the priority of the first security rule generated for the network policies,
+	// the NSG priorities go from 100 to 4096.
+	defaultNetworkPolicyPriority = 1000
+	maxNetworkPolicyPriority     = 4096
+
+	networkPolicyReasonNotEnforced = "NetworkPolicyNotEnforced"
+)
+
+// networkPolicySync translates the network policies selecting the pods of the node into rules of the network
+// security groups of their subnets. NSG rules match IP addresses and ports only, so the policies whose peers are
+// pod or namespace selectors, or which use named ports, can't be translated: they are left out and flagged with a
+// warning event instead, as are the pods they select in the directions they cover, so that no traffic they allow
+// is denied.
+type networkPolicySync struct {
+	policies networkingv1listers.NetworkPolicyLister
+	// syncSecurityRules replaces the rules of the network security group of a subnet whose names owns matches.
+	syncSecurityRules func(ctx context.Context, subnetName string, owns func(name string) bool, rules []*aznetworkv2.SecurityRule) error
+	// subnets are the subnets rules were generated for, whose rules are deleted once they have no more pods.
+	subnets map[string]bool
+	// flagged are the generations of the unsupported policies an event was emitted for.
+	flagged map[types.UID]int64
+}
+
+// StartNetworkPolicySync keeps the network security groups of the subnets of the pods of the node in sync with the
+// network policies selecting them. The subnets must be associated with a network security group.
+func (p *ACIProvider) StartNetworkPolicySync(ctx context.Context, policies networkingv1listers.NetworkPolicyLister) {
+	if p.providernetwork.SubnetName == "" {
+		log.G(ctx).Warn("network policies are not enforced on virtual nodes without a virtual network")
+		return
+	}
+	s := &networkPolicySync{
+		policies:          policies,
+		syncSecurityRules: p.providernetwork.SyncSecurityRules,
+		subnets:           map[string]bool{p.providernetwork.SubnetName: true},
+		flagged:           map[types.UID]int64{},
+	}
+	go func() {
+		timer := time.NewTimer(networkPolicySyncInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if err := p.syncNetworkPolicies(ctx, s); err != nil {
+				log.G(ctx).WithError(err).Warn("failed to sync the network security rules of the network policies")
+			}
+			timer.Reset(networkPolicySyncInterval)
+		}
+	}()
+}
+
+func (p *ACIProvider) syncNetworkPolicies(ctx context.Context, s *networkPolicySync) error {
+	ctx, span := trace.StartSpan(ctx, "aci.syncNetworkPolicies")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	// the replicas would fight over the security rules
+	if !p.isLeading() {
+		return nil
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	policies, err := s.policies.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	privateIPs, err := p.getPrivateIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules, unsupported := p.getSecurityRules(policies, pods, privateIPs)
+	for _, policy := range policies {
+		reason, ok := unsupported[policy.UID]
+		if !ok {
+			delete(s.flagged, policy.UID)
+			continue
+		}
+		if generation, ok := s.flagged[policy.UID]; ok && generation == policy.Generation {
+			continue
+		}
+		s.flagged[policy.UID] = policy.Generation
+		if p.eventRecorder != nil {
+			p.eventRecorder.Eventf(policy, v1.EventTypeWarning, networkPolicyReasonNotEnforced,
+				"Network policy is not enforced for the pods of virtual node %s: %s", p.nodeName, reason)
+		}
+	}
+
+	for subnet := range rules {
+		s.subnets[subnet] = true
+	}
+	owned := p.securityRuleNamePattern()
+	for subnet := range s.subnets {
+		if err := s.syncSecurityRules(ctx, subnet, owned.MatchString, rules[subnet]); err != nil {
+			return err
+		}
+		if len(rules[subnet]) == 0 && subnet != p.providernetwork.SubnetName {
+			delete(s.subnets, subnet)
+		}
+	}
+	return nil
+}
+
+// securityRulePrefix is the name prefix of the security rules generated for the pods of the node.
+func (p *ACIProvider) securityRulePrefix() string {
+	return "vk-" + p.nodeName + "-"
+}
+
+// securityRuleNamePattern matches the names of the security rules generated for the pods of the node, and only them:
+// the rules of a node named like the prefix of another one, such as aci and aci-2, are left alone.
+func (p *ACIProvider) securityRuleNamePattern() *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(p.securityRulePrefix()) + "(inbound|outbound)-[0-9]+$")
+}
+
+// getSecurityRules returns the security rules enforcing the network policies for the pods of the node with a private
+// IP address, by subnet, and the reason why the unsupported policies can't be enforced, by UID.
+func (p *ACIProvider) getSecurityRules(policies []*networkingv1.NetworkPolicy, pods []*v1.Pod, privateIPs map[string]string) (map[string][]*aznetworkv2.SecurityRule, map[types.UID]string) {
+	// the policies are ordered to keep the priorities of the rules stable
+	policies = append([]*networkingv1.NetworkPolicy(nil), policies...)
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Namespace+"/"+policies[i].Name < policies[j].Namespace+"/"+policies[j].Name
+	})
+
+	unsupported := map[types.UID]string{}
+	selected := map[types.UID][]*v1.Pod{}
+	// unenforced are the pods selected by an unsupported policy, by direction
+	unenforced := map[networkingv1.PolicyType]map[string]bool{
+		networkingv1.PolicyTypeIngress: {},
+		networkingv1.PolicyTypeEgress:  {},
+	}
+	for _, policy := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil {
+			unsupported[policy.UID] = err.Error()
+			continue
+		}
+		for _, pod := range pods {
+			if _, ok := privateIPs[pod.Namespace+"/"+pod.Name]; ok && pod.Namespace == policy.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+				selected[policy.UID] = append(selected[policy.UID], pod)
+			}
+		}
+		if len(selected[policy.UID]) == 0 {
+			continue
+		}
+		if reason := getUnsupportedNetworkPolicyReason(policy); reason != "" {
+			unsupported[policy.UID] = reason
+			for _, policyType := range getPolicyTypes(policy) {
+				for _, pod := range selected[policy.UID] {
+					unenforced[policyType][pod.Namespace+"/"+pod.Name] = true
+				}
+			}
+		}
+	}
+
+	type subnetRules struct {
+		allow map[networkingv1.PolicyType][]*aznetworkv2.SecurityRulePropertiesFormat
+		deny  map[networkingv1.PolicyType][]string
+		// policies are the policies the rules were generated for, by direction
+		policies map[networkingv1.PolicyType][]types.UID
+	}
+	bySubnet := map[string]*subnetRules{}
+	for _, policy := range policies {
+		if _, ok := unsupported[policy.UID]; ok || len(selected[policy.UID]) == 0 {
+			continue
+		}
+		for _, policyType := range getPolicyTypes(policy) {
+			ips := map[string][]string{}
+			for _, pod := range selected[policy.UID] {
+				if !unenforced[policyType][pod.Namespace+"/"+pod.Name] {
+					subnet := p.providernetwork.GetPodSubnet(pod)
+					ips[subnet] = append(ips[subnet], privateIPs[pod.Namespace+"/"+pod.Name])
+				}
+			}
+			for subnet, podIPs := range ips {
+				podIPs = uniqueSortedStrings(podIPs)
+				rules, ok := bySubnet[subnet]
+				if !ok {
+					rules = &subnetRules{
+						allow:    map[networkingv1.PolicyType][]*aznetworkv2.SecurityRulePropertiesFormat{},
+						deny:     map[networkingv1.PolicyType][]string{},
+						policies: map[networkingv1.PolicyType][]types.UID{},
+					}
+					bySubnet[subnet] = rules
+				}
+				rules.allow[policyType] = append(rules.allow[policyType], getAllowRules(policy, policyType, podIPs)...)
+				rules.deny[policyType] = append(rules.deny[policyType], podIPs...)
+				rules.policies[policyType] = append(rules.policies[policyType], policy.UID)
+			}
+		}
+	}
+
+	result := map[string][]*aznetworkv2.SecurityRule{}
+	for subnet, rules := range bySubnet {
+		for _, policyType := range []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress} {
+			if len(rules.deny[policyType]) == 0 {
+				continue
+			}
+			// the pods selected by several policies are only denied once
+			denied := uniqueSortedStrings(rules.deny[policyType])
+			deny := newSecurityRuleProperties(aznetworkv2.SecurityRuleAccessDeny, policyType, denied, []string{"*"})
+			deny.Protocol = securityRuleProtocolPtr(aznetworkv2.SecurityRuleProtocolAsterisk)
+			deny.DestinationPortRange = stringPtr("*")
+
+			direction := "inbound"
+			if policyType == networkingv1.PolicyTypeEgress {
+				direction = "outbound"
+			}
+			first := p.networkPolicyPriority
+			if first == 0 {
+				first = defaultNetworkPolicyPriority
+			}
+			priority := first
+			for _, properties := range append(rules.allow[policyType], deny) {
+				if priority > maxNetworkPolicyPriority {
+					// the NSG has no room left, the deny rule is dropped along with the remaining allow rules so
+					// the policies of the direction aren't enforced and are flagged
+					for _, uid := range rules.policies[policyType] {
+						unsupported[uid] = fmt.Sprintf("the %s security rules of subnet %s need more priorities than the %d to %d range "+
+							"starting at the network policy priority", direction, subnet, first, maxNetworkPolicyPriority)
+					}
+					break
+				}
+				rulePriority := priority
+				properties.Priority = &rulePriority
+				result[subnet] = append(result[subnet], &aznetworkv2.SecurityRule{
+					Name:       stringPtr(fmt.Sprintf("%s%s-%d", p.securityRulePrefix(), direction, priority)),
+					Properties: properties,
+				})
+				priority++
+			}
+		}
+	}
+	return result, unsupported
+}
+
+// getUnsupportedNetworkPolicyReason returns why a network policy can't be translated into security rules, or an
+// empty string when it can.
+func getUnsupportedNetworkPolicyReason(policy *networkingv1.NetworkPolicy) string {
+	var peers []networkingv1.NetworkPolicyPeer
+	var ports []networkingv1.NetworkPolicyPort
+	for _, rule := range policy.Spec.Ingress {
+		peers = append(peers, rule.From...)
+		ports = append(ports, rule.Ports...)
+	}
+	for _, rule := range policy.Spec.Egress {
+		peers = append(peers, rule.To...)
+		ports = append(ports, rule.Ports...)
+	}
+	for _, peer := range peers {
+		switch {
+		case peer.PodSelector != nil || peer.NamespaceSelector != nil:
+			return "pod and namespace selectors can't be translated into network security rules, use IP blocks"
+		case peer.IPBlock != nil && len(peer.IPBlock.Except) > 0:
+			return "IP blocks with exceptions can't be translated into network security rules"
+		}
+	}
+	for _, port := range ports {
+		if port.Protocol != nil && *port.Protocol == v1.ProtocolSCTP {
+			return "SCTP isn't supported by network security groups"
+		}
+		if port.Port != nil && port.Port.StrVal != "" {
+			return "named ports can't be translated into network security rules"
+		}
+	}
+	return ""
+}
+
+// getPolicyTypes returns the directions a network policy applies to, like the API server defaults them.
+func getPolicyTypes(policy *networkingv1.NetworkPolicy) []networkingv1.PolicyType {
+	if len(policy.Spec.PolicyTypes) > 0 {
+		return policy.Spec.PolicyTypes
+	}
+	policyTypes := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(policy.Spec.Egress) > 0 {
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return policyTypes
+}
+
+// getAllowRules returns the properties of the security rules allowing the traffic the rules of a network policy allow
+// in a direction for the given pod IP addresses, one per rule and protocol.
+func getAllowRules(policy *networkingv1.NetworkPolicy, policyType networkingv1.PolicyType, podIPs []string) []*aznetworkv2.SecurityRulePropertiesFormat {
+	type policyRule struct {
+		peers []networkingv1.NetworkPolicyPeer
+		ports []networkingv1.NetworkPolicyPort
+	}
+	var policyRules []policyRule
+	if policyType == networkingv1.PolicyTypeIngress {
+		for _, rule := range policy.Spec.Ingress {
+			policyRules = append(policyRules, policyRule{peers: rule.From, ports: rule.Ports})
+		}
+	} else {
+		for _, rule := range policy.Spec.Egress {
+			policyRules = append(policyRules, policyRule{peers: rule.To, ports: rule.Ports})
+		}
+	}
+
+	var result []*aznetworkv2.SecurityRulePropertiesFormat
+	for _, rule := range policyRules {
+		peerPrefixes := []string{"*"}
+		if len(rule.peers) > 0 {
+			peerPrefixes = nil
+			for _, peer := range rule.peers {
+				peerPrefixes = append(peerPrefixes, peer.IPBlock.CIDR)
+			}
+		}
+
+		if len(rule.ports) == 0 {
+			properties := newSecurityRuleProperties(aznetworkv2.SecurityRuleAccessAllow, policyType, podIPs, peerPrefixes)
+			properties.Protocol = securityRuleProtocolPtr(aznetworkv2.SecurityRuleProtocolAsterisk)
+			properties.DestinationPortRange = stringPtr("*")
+			result = append(result, properties)
+			continue
+		}
+		portRanges := map[v1.Protocol][]string{}
+		var protocols []v1.Protocol
+		for _, port := range rule.ports {
+			protocol := v1.ProtocolTCP
+			if port.Protocol != nil {
+				protocol = *port.Protocol
+			}
+			if _, ok := portRanges[protocol]; !ok {
+				protocols = append(protocols, protocol)
+			}
+			portRange := "*"
+			if port.Port != nil {
+				portRange = port.Port.String()
+				if port.EndPort != nil {
+					portRange = fmt.Sprintf("%s-%d", portRange, *port.EndPort)
+				}
+			}
+			portRanges[protocol] = append(portRanges[protocol], portRange)
+		}
+		for _, protocol := range protocols {
+			properties := newSecurityRuleProperties(aznetworkv2.SecurityRuleAccessAllow, policyType, podIPs, peerPrefixes)
+			ruleProtocol := aznetworkv2.SecurityRuleProtocolTCP
+			if protocol == v1.ProtocolUDP {
+				ruleProtocol = aznetworkv2.SecurityRuleProtocolUDP
+			}
+			properties.Protocol = securityRuleProtocolPtr(ruleProtocol)
+			properties.DestinationPortRanges = stringPtrs(uniqueSortedStrings(portRanges[protocol]))
+			if len(properties.DestinationPortRanges) == 1 {
+				properties.DestinationPortRange = properties.DestinationPortRanges[0]
+				properties.DestinationPortRanges = nil
+			}
+			result = append(result, properties)
+		}
+	}
+	return result
+}
+
+// newSecurityRuleProperties returns the properties of a security rule matching the traffic of the pod IP addresses
+// with the peer prefixes in a direction, on any source port. The protocol and destination ports are left to the caller.
+func newSecurityRuleProperties(access aznetworkv2.SecurityRuleAccess, policyType networkingv1.PolicyType, podIPs, peerPrefixes []string) *aznetworkv2.SecurityRulePropertiesFormat {
+	direction := aznetworkv2.SecurityRuleDirectionInbound
+	podPrefixes, otherPrefixes := podIPs, peerPrefixes
+	if policyType == networkingv1.PolicyTypeEgress {
+		direction = aznetworkv2.SecurityRuleDirectionOutbound
+		podPrefixes, otherPrefixes = peerPrefixes, podIPs
+	}
+	properties := &aznetworkv2.SecurityRulePropertiesFormat{
+		Access:          &access,
+		Direction:       &direction,
+		SourcePortRange: stringPtr("*"),
+	}
+	// a single prefix must be set as prefix, "*" can't be part of a list of prefixes
+	if len(otherPrefixes) == 1 {
+		properties.SourceAddressPrefix = stringPtr(otherPrefixes[0])
+	} else {
+		properties.SourceAddressPrefixes = stringPtrs(otherPrefixes)
+	}
+	if len(podPrefixes) == 1 {
+		properties.DestinationAddressPrefix = stringPtr(podPrefixes[0])
+	} else {
+		properties.DestinationAddressPrefixes = stringPtrs(podPrefixes)
+	}
+	return properties
+}
+
+func uniqueSortedStrings(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func stringPtrs(values []string) []*string {
+	result := make([]*string, 0, len(values))
+	for i := range values {
+		result = append(result, &values[i])
+	}
+	return result
+}
+
+func securityRuleProtocolPtr(protocol aznetworkv2.SecurityRuleProtocol) *aznetworkv2.SecurityRuleProtocol {
+	return &protocol
+}
@@ -0,0 +1,237 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	aznetworkv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetSecurityRules(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provider, err := createTestProvider(createNewACIMock(), NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	provider.providernetwork.SubnetName = "aci"
+
+	web := testsutil.CreatePodObj("web", "ns")
+	web.Labels = map[string]string{"app": "web"}
+	db := testsutil.CreatePodObj("db", "ns")
+	db.Labels = map[string]string{"app": "db"}
+	public := testsutil.CreatePodObj("public", "ns")
+	public.Labels = map[string]string{"app": "web"}
+	pods := []*v1.Pod{web, db, public}
+	privateIPs := map[string]string{"ns/web": "10.0.0.4", "ns/db": "10.0.0.5"}
+
+	tcp, udp := v1.ProtocolTCP, v1.ProtocolUDP
+	port80, port53 := intstr.FromInt(80), intstr.FromInt(53)
+	endPort := int32(8090)
+	port8080 := intstr.FromInt(8080)
+	allowWeb := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-web", Namespace: "ns", UID: "allow-web"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From:  []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.1.0.0/16"}}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}, {Protocol: &tcp, Port: &port8080, EndPort: &endPort}},
+			}},
+			Egress: []networkingv1.NetworkPolicyEgressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}},
+			}},
+		},
+	}
+	selectors := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "selectors", Namespace: "ns", UID: "selectors"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+			}},
+		},
+	}
+	otherNode := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns", UID: "other"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}},
+			}},
+		},
+	}
+
+	rules, unsupported := provider.getSecurityRules([]*networkingv1.NetworkPolicy{selectors, allowWeb, otherNode}, pods, privateIPs)
+	assert.Check(t, is.Len(unsupported, 1), "only the policies selecting pods of the node are flagged")
+	assert.Check(t, strings.Contains(unsupported["selectors"], "selectors"))
+
+	assert.Assert(t, is.Len(rules, 1))
+	var summaries []string
+	for _, rule := range rules["aci"] {
+		summaries = append(summaries, *rule.Name+" "+securityRuleSummary(rule))
+	}
+	prefix := provider.securityRulePrefix()
+	assert.Check(t, is.DeepEqual([]string{
+		prefix + "inbound-1000 1000 Inbound Allow Tcp 10.1.0.0/16->10.0.0.4:80,8080-8090",
+		prefix + "inbound-1001 1001 Inbound Deny * *->10.0.0.4:*",
+		prefix + "outbound-1000 1000 Outbound Allow Udp 10.0.0.4->*:53",
+		prefix + "outbound-1001 1001 Outbound Deny * 10.0.0.4->*:*",
+	}, summaries))
+
+	// the deny rule doesn't fit in the remaining priorities
+	provider.networkPolicyPriority = maxNetworkPolicyPriority
+	rules, unsupported = provider.getSecurityRules([]*networkingv1.NetworkPolicy{allowWeb}, pods, privateIPs)
+	assert.Check(t, is.Len(rules["aci"], 2))
+	assert.Check(t, is.Contains(unsupported["allow-web"], "priorities"))
+}
+
+func TestSecurityRuleNamePattern(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provider, err := createTestProvider(createNewACIMock(), NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	provider.nodeName = "aci"
+
+	pattern := provider.securityRuleNamePattern()
+	assert.Check(t, pattern.MatchString("vk-aci-inbound-1000"))
+	assert.Check(t, pattern.MatchString("vk-aci-outbound-4096"))
+	assert.Check(t, !pattern.MatchString("vk-aci-2-inbound-1000"), "the rules of the other nodes aren't owned")
+	assert.Check(t, !pattern.MatchString("vk-aci-inbound-1000-custom"))
+	assert.Check(t, !pattern.MatchString("allow-vk-aci-inbound-1000"))
+}
+
+func TestGetUnsupportedNetworkPolicyReason(t *testing.T) {
+	sctp := v1.ProtocolSCTP
+	namedPort := intstr.FromString("http")
+	testCases := []struct {
+		desc   string
+		rule   networkingv1.NetworkPolicyIngressRule
+		reason string
+	}{
+		{
+			desc: "IP block",
+			rule: networkingv1.NetworkPolicyIngressRule{From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}}},
+		},
+		{
+			desc:   "IP block with exceptions",
+			rule:   networkingv1.NetworkPolicyIngressRule{From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}}},
+			reason: "exceptions",
+		},
+		{
+			desc:   "SCTP",
+			rule:   networkingv1.NetworkPolicyIngressRule{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &sctp}}},
+			reason: "SCTP",
+		},
+		{
+			desc:   "named port",
+			rule:   networkingv1.NetworkPolicyIngressRule{Ports: []networkingv1.NetworkPolicyPort{{Port: &namedPort}}},
+			reason: "named ports",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			policy := &networkingv1.NetworkPolicy{Spec: networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{tc.rule}}}
+			reason := getUnsupportedNetworkPolicyReason(policy)
+			if tc.reason == "" {
+				assert.Check(t, is.Equal("", reason))
+			} else {
+				assert.Check(t, is.Contains(reason, tc.reason))
+			}
+		})
+	}
+}
+
+func TestSyncNetworkPolicies(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pod := testsutil.CreatePodObj("web", "ns")
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		cg := testsutil.CreateContainerGroupObj(pod.Name, pod.Namespace, "Running", nil, "Succeeded")
+		nodeName, ipType := fakeNodeName, azaciv2.ContainerGroupIPAddressTypePrivate
+		cg.Tags["NodeName"] = &nodeName
+		cg.Properties.IPAddress.Type = &ipType
+		return []*azaciv2.ContainerGroup{cg}, nil
+	}
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	provider.providernetwork.SubnetName = "aci"
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "selectors", Namespace: "ns", UID: "selectors", Generation: 1},
+		Spec: networkingv1.NetworkPolicySpec{
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+			}},
+		},
+	}))
+	synced := map[string]int{}
+	s := &networkPolicySync{
+		policies: networkingv1listers.NewNetworkPolicyLister(indexer),
+		syncSecurityRules: func(ctx context.Context, subnetName string, owns func(name string) bool, rules []*aznetworkv2.SecurityRule) error {
+			assert.Check(t, owns(provider.securityRulePrefix()+"inbound-1000"))
+			synced[subnetName] = len(rules)
+			return nil
+		},
+		subnets: map[string]bool{"aci": true, "removed": true},
+		flagged: map[types.UID]int64{},
+	}
+
+	ctx := context.Background()
+	assert.NilError(t, provider.syncNetworkPolicies(ctx, s))
+	assert.Check(t, is.DeepEqual(map[string]int{"aci": 0, "removed": 0}, synced))
+	assert.Check(t, is.DeepEqual(map[string]bool{"aci": true}, s.subnets), "the subnets without rules are forgotten once emptied")
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Contains(<-recorder.Events, networkPolicyReasonNotEnforced))
+
+	// the unsupported policies are only flagged once per generation
+	assert.NilError(t, provider.syncNetworkPolicies(ctx, s))
+	assert.Check(t, is.Len(recorder.Events, 0))
+}
+
+// securityRuleSummary describes a security rule as "priority direction access protocol source->destination:ports".
+func securityRuleSummary(rule *aznetworkv2.SecurityRule) string {
+	properties := rule.Properties
+	prefixes := func(prefix *string, prefixes []*string) string {
+		if prefix != nil {
+			return *prefix
+		}
+		values := make([]string, 0, len(prefixes))
+		for _, value := range prefixes {
+			values = append(values, *value)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprintf("%d %s %s %s %s->%s:%s", *properties.Priority, *properties.Direction, *properties.Access, *properties.Protocol,
+		prefixes(properties.SourceAddressPrefix, properties.SourceAddressPrefixes),
+		prefixes(properties.DestinationAddressPrefix, properties.DestinationAddressPrefixes),
+		prefixes(properties.DestinationPortRange, properties.DestinationPortRanges))
+}
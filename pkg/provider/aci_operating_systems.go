@@ -0,0 +1,138 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// operatingSystemNodeSelectors are the node selectors of the operating system of a pod, the beta one is still set
+// by older charts.
+var operatingSystemNodeSelectors = []string{v1.LabelOSStable, "beta.kubernetes.io/os"}
+
+// getPodOperatingSystem returns the operating system of the container group of a pod, selected by
+// setPodOperatingSystem when the node runs both Linux and Windows pods, and the one of the node otherwise.
+func (p *ACIProvider) getPodOperatingSystem(pod *v1.Pod) string {
+	if p.mixedOperatingSystems && pod != nil && pod.Spec.OS != nil {
+		if os, ok := parseOperatingSystem(string(pod.Spec.OS.Name)); ok {
+			return os
+		}
+	}
+	return p.operatingSystem
+}
+
+// setPodOperatingSystem selects the operating system of the container group of a pod when the node runs both Linux
+// and Windows pods, see detectPodOperatingSystem. It returns a copy of the pod with the selected OS, for the rest
+// of its translation. The images are read with the registry credentials of the pod.
+func (p *ACIProvider) setPodOperatingSystem(ctx context.Context, pod *v1.Pod, creds []*azaciv2.ImageRegistryCredential) (*v1.Pod, error) {
+	if !p.mixedOperatingSystems {
+		return pod, nil
+	}
+	os, err := p.detectPodOperatingSystem(ctx, pod, creds)
+	if err != nil {
+		return nil, err
+	}
+	log.G(ctx).Debugf("creating a %s container group for pod %s", os, pod.Name)
+	pod = pod.DeepCopy()
+	pod.Spec.OS = &v1.PodOS{Name: v1.OSName(strings.ToLower(os))}
+	return pod, nil
+}
+
+// detectPodOperatingSystem returns the operating system a pod asks for with its OS or its node selector, or else
+// the one its images are built for. The images which have both Linux and Windows images, and the images whose
+// platforms can't be read, run on the operating system of the node.
+func (p *ACIProvider) detectPodOperatingSystem(ctx context.Context, pod *v1.Pod, creds []*azaciv2.ImageRegistryCredential) (string, error) {
+	if pod.Spec.OS != nil {
+		os, ok := parseOperatingSystem(string(pod.Spec.OS.Name))
+		if !ok {
+			return "", errdefs.InvalidInputf("pod %s: ACI doesn't support the %s operating system", pod.Name, pod.Spec.OS.Name)
+		}
+		return os, nil
+	}
+	for _, label := range operatingSystemNodeSelectors {
+		if selected, ok := pod.Spec.NodeSelector[label]; ok {
+			os, ok := parseOperatingSystem(selected)
+			if !ok {
+				return "", errdefs.InvalidInputf("pod %s: ACI doesn't support the %s operating system of node selector %s", pod.Name, selected, label)
+			}
+			return os, nil
+		}
+	}
+
+	resolver, ok := p.imageConfigResolver.(ImageOperatingSystemResolver)
+	if !ok {
+		return p.operatingSystem, nil
+	}
+	// the operating systems all the images of the pod have an image for
+	var common []string
+	images := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, container := range pod.Spec.InitContainers {
+		images = append(images, container.Image)
+	}
+	for _, container := range pod.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	for i, image := range images {
+		oses, err := resolver.GetImageOperatingSystems(ctx, image, creds)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("pod %s: failed to read the platforms of image %s, creating a %s container group",
+				pod.Name, image, p.operatingSystem)
+			return p.operatingSystem, nil
+		}
+		if i == 0 {
+			common = oses
+			continue
+		}
+		var both []string
+		for _, os := range common {
+			if containsString(oses, os) {
+				both = append(both, os)
+			}
+		}
+		common = both
+	}
+
+	var supported []string
+	for _, os := range common {
+		if parsed, ok := parseOperatingSystem(os); ok {
+			supported = append(supported, parsed)
+		}
+	}
+	switch {
+	case len(supported) == 0:
+		return "", errdefs.InvalidInputf("pod %s: the images of the pod have no common Linux or Windows amd64 image", pod.Name)
+	case len(supported) == 1:
+		return supported[0], nil
+	default:
+		return p.operatingSystem, nil
+	}
+}
+
+// parseOperatingSystem returns the ACI operating system of an operating system of Kubernetes or of an image
+// platform.
+func parseOperatingSystem(os string) (string, bool) {
+	switch strings.ToLower(os) {
+	case "linux":
+		return string(azaciv2.OperatingSystemTypesLinux), true
+	case "windows":
+		return string(azaciv2.OperatingSystemTypesWindows), true
+	}
+	return "", false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
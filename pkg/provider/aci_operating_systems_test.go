@@ -0,0 +1,140 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+// fakeImagePlatformResolver resolves the operating systems of images, the images it doesn't know fail.
+type fakeImagePlatformResolver struct {
+	fakeImageConfigResolver
+	oses map[string][]string
+}
+
+func (f fakeImagePlatformResolver) GetImageOperatingSystems(ctx context.Context, image string, creds []*azaciv2.ImageRegistryCredential) ([]string, error) {
+	if oses, ok := f.oses[image]; ok {
+		return oses, nil
+	}
+	return nil, fmt.Errorf("image %s not found", image)
+}
+
+func TestDetectPodOperatingSystem(t *testing.T) {
+	p := ACIProvider{
+		operatingSystem:       "Linux",
+		mixedOperatingSystems: true,
+		imageConfigResolver: fakeImagePlatformResolver{oses: map[string][]string{
+			"nginx":      {"linux"},
+			"iis":        {"windows"},
+			"pause":      {"linux", "windows"},
+			"wasm":       {"wasi"},
+			"powershell": {"windows", "linux"},
+		}},
+	}
+
+	cases := []struct {
+		description   string
+		os            v1.OSName
+		nodeSelector  map[string]string
+		images        []string
+		expectedOS    string
+		expectedError string
+	}{
+		{
+			description: "pod OS",
+			os:          v1.Windows,
+			images:      []string{"nginx"},
+			expectedOS:  "Windows",
+		},
+		{
+			description:  "node selector",
+			nodeSelector: map[string]string{v1.LabelOSStable: "windows"},
+			images:       []string{"nginx"},
+			expectedOS:   "Windows",
+		},
+		{
+			description:  "beta node selector",
+			nodeSelector: map[string]string{"beta.kubernetes.io/os": "linux"},
+			images:       []string{"iis"},
+			expectedOS:   "Linux",
+		},
+		{
+			description:   "unsupported node selector",
+			nodeSelector:  map[string]string{v1.LabelOSStable: "plan9"},
+			images:        []string{"nginx"},
+			expectedError: "plan9",
+		},
+		{
+			description: "windows images",
+			images:      []string{"pause", "iis"},
+			expectedOS:  "Windows",
+		},
+		{
+			description: "multi-platform images run on the default OS",
+			images:      []string{"pause", "powershell"},
+			expectedOS:  "Linux",
+		},
+		{
+			description:   "images without a common OS",
+			images:        []string{"nginx", "iis"},
+			expectedError: "no common Linux or Windows",
+		},
+		{
+			description:   "images of an unsupported OS",
+			images:        []string{"wasm"},
+			expectedError: "no common Linux or Windows",
+		},
+		{
+			description: "unknown images run on the default OS",
+			images:      []string{"iis", "unknown"},
+			expectedOS:  "Linux",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Spec.NodeSelector = tc.nodeSelector
+			if tc.os != "" {
+				pod.Spec.OS = &v1.PodOS{Name: tc.os}
+			}
+			pod.Spec.Containers = nil
+			for i, image := range tc.images {
+				pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+			}
+
+			mutated, err := p.setPodOperatingSystem(context.Background(), pod, nil)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(tc.expectedOS, p.getPodOperatingSystem(mutated)))
+			if tc.os == "" {
+				assert.Check(t, pod.Spec.OS == nil, "the pod was mutated")
+			}
+		})
+	}
+}
+
+func TestGetPodOperatingSystemSingleOS(t *testing.T) {
+	p := ACIProvider{operatingSystem: "Linux"}
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.OS = &v1.PodOS{Name: v1.Windows}
+
+	mutated, err := p.setPodOperatingSystem(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("Linux", p.getPodOperatingSystem(mutated)))
+}
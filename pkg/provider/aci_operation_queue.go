@@ -0,0 +1,140 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"sync"
+)
+
+// operationQueue limits the ARM operations of a kind in flight, so that bursts of pods don't trip the throttling
+// of ARM. The waiting operations are started by priority, then round robin between the namespaces so that a
+// namespace scaling up doesn't hold back the others, then in order of arrival. A nil queue doesn't limit anything.
+type operationQueue struct {
+	maxInFlight int
+
+	lock     sync.Mutex
+	inFlight int
+	// waiting are the operations waiting for a slot, by namespace, sorted by priority then arrival.
+	waiting map[string][]*queuedOperation
+	// lastStarted is the sequence number of the last operation started for each namespace with waiting operations.
+	lastStarted map[string]uint64
+	sequence    uint64
+}
+
+type queuedOperation struct {
+	namespace string
+	priority  int32
+	sequence  uint64
+	started   chan struct{}
+}
+
+func newOperationQueue(maxInFlight int) *operationQueue {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &operationQueue{
+		maxInFlight: maxInFlight,
+		waiting:     make(map[string][]*queuedOperation),
+		lastStarted: make(map[string]uint64),
+	}
+}
+
+// acquire waits for a slot for an operation of a namespace, and returns the function releasing the slot once the
+// operation completed. It fails when the context is done first.
+func (q *operationQueue) acquire(ctx context.Context, namespace string, priority int32) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	q.lock.Lock()
+	if q.inFlight < q.maxInFlight && len(q.waiting) == 0 {
+		q.inFlight++
+		q.lock.Unlock()
+		return q.release, nil
+	}
+	q.sequence++
+	op := &queuedOperation{namespace: namespace, priority: priority, sequence: q.sequence, started: make(chan struct{})}
+	q.enqueue(op)
+	q.lock.Unlock()
+
+	select {
+	case <-op.started:
+		return q.release, nil
+	case <-ctx.Done():
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	select {
+	case <-op.started:
+		// the slot was given to the operation meanwhile
+		q.inFlight--
+		q.startWaiting()
+	default:
+		q.dequeue(op)
+	}
+	return nil, ctx.Err()
+}
+
+func (q *operationQueue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.inFlight--
+	q.startWaiting()
+}
+
+// enqueue inserts an operation after the operations of its namespace with the same or a higher priority.
+func (q *operationQueue) enqueue(op *queuedOperation) {
+	ops := q.waiting[op.namespace]
+	i := len(ops)
+	for i > 0 && ops[i-1].priority < op.priority {
+		i--
+	}
+	ops = append(ops, nil)
+	copy(ops[i+1:], ops[i:])
+	ops[i] = op
+	q.waiting[op.namespace] = ops
+}
+
+func (q *operationQueue) dequeue(op *queuedOperation) {
+	ops := q.waiting[op.namespace]
+	for i := range ops {
+		if ops[i] == op {
+			ops = append(ops[:i], ops[i+1:]...)
+			break
+		}
+	}
+	if len(ops) == 0 {
+		delete(q.waiting, op.namespace)
+		delete(q.lastStarted, op.namespace)
+		return
+	}
+	q.waiting[op.namespace] = ops
+}
+
+// startWaiting starts the next waiting operations while slots are available: the first operation of each
+// namespace with the highest priority, from the namespace which started an operation the longest ago.
+func (q *operationQueue) startWaiting() {
+	for q.inFlight < q.maxInFlight && len(q.waiting) > 0 {
+		var next *queuedOperation
+		for namespace, ops := range q.waiting {
+			op := ops[0]
+			if next == nil || op.priority > next.priority ||
+				(op.priority == next.priority && q.lastStarted[namespace] < q.lastStarted[next.namespace]) ||
+				(op.priority == next.priority && q.lastStarted[namespace] == q.lastStarted[next.namespace] && op.sequence < next.sequence) {
+				next = op
+			}
+		}
+
+		q.dequeue(next)
+		if _, ok := q.waiting[next.namespace]; ok {
+			q.sequence++
+			q.lastStarted[next.namespace] = q.sequence
+		}
+		q.inFlight++
+		close(next.started)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// waitQueued waits until a number of operations wait for a slot of the queue.
+func waitQueued(t *testing.T, q *operationQueue, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.lock.Lock()
+		queued := 0
+		for _, ops := range q.waiting {
+			queued += len(ops)
+		}
+		q.lock.Unlock()
+		if queued == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d operations are queued, expected %d", queued, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOperationQueueOrder(t *testing.T) {
+	ctx := context.Background()
+	q := newOperationQueue(1)
+	release, err := q.acquire(ctx, "a", 0)
+	assert.NilError(t, err)
+
+	started := make(chan string, 5)
+	ops := []struct {
+		name      string
+		namespace string
+		priority  int32
+	}{
+		{"a1", "a", 0},
+		{"a2", "a", 0},
+		{"a3", "a", 0},
+		{"b1", "b", 0},
+		{"c1", "c", 10},
+	}
+	for i, op := range ops {
+		op := op
+		go func() {
+			release, err := q.acquire(ctx, op.namespace, op.priority)
+			if err != nil {
+				started <- err.Error()
+				return
+			}
+			started <- op.name
+			release()
+		}()
+		waitQueued(t, q, i+1)
+	}
+
+	release()
+	var order []string
+	for range ops {
+		order = append(order, <-started)
+	}
+	// the priority first, then round robin between the namespaces
+	assert.Check(t, is.DeepEqual([]string{"c1", "a1", "b1", "a2", "a3"}, order))
+}
+
+func TestOperationQueueCancel(t *testing.T) {
+	q := newOperationQueue(1)
+	release, err := q.acquire(context.Background(), "ns", 0)
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = q.acquire(ctx, "ns", 0)
+	assert.Check(t, is.ErrorContains(err, context.DeadlineExceeded.Error()))
+	assert.Check(t, is.Len(q.waiting, 0))
+
+	release()
+	release, err = q.acquire(context.Background(), "ns", 0)
+	assert.NilError(t, err)
+	release()
+}
+
+func TestOperationQueueUnlimited(t *testing.T) {
+	q := newOperationQueue(0)
+	assert.Check(t, q == nil)
+	release, err := q.acquire(context.Background(), "ns", 0)
+	assert.NilError(t, err)
+	release()
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// getMissingVolumeSource handles the missing secret or config map of a volume like the kubelet: the volume is
+// empty when its source is optional, with a warning event, and the pod fails otherwise. Errors other than not
+// found fail the pod in both cases.
+func (p *ACIProvider) getMissingVolumeSource(ctx context.Context, pod *v1.Pod, volume *v1.Volume, err error, optional *bool,
+	reason string, required error) (*azaciv2.Volume, error) {
+	if err != nil && !k8serr.IsNotFound(err) {
+		return nil, fmt.Errorf("error reading the source of volume %s: %w", volume.Name, err)
+	}
+	if optional == nil || !*optional {
+		return nil, required
+	}
+	p.reportOptionalVolumeSource(ctx, pod, reason, fmt.Sprintf("the optional source of volume %s does not exist, mounting an empty volume", volume.Name))
+	return getEmptyVolume(volume.Name), nil
+}
+
+// reportOptionalVolumeSource emits a warning event for a missing optional source of a volume.
+func (p *ACIProvider) reportOptionalVolumeSource(ctx context.Context, pod *v1.Pod, reason, message string) {
+	log.G(ctx).Debugf("pod %s: %s", pod.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeWarning, reason, message)
+	}
+}
+
+// getEmptyVolume returns the volume of a secret, config map or projected volume without any file, as ACI doesn't
+// accept secret volumes without files.
+func getEmptyVolume(name string) *azaciv2.Volume {
+	return &azaciv2.Volume{
+		Name:     &name,
+		EmptyDir: map[string]interface{}{},
+	}
+}
+
+// getSecretVolume returns the volume of the files of a secret, config map or projected volume, an empty volume
+// when it has none.
+func getSecretVolume(name string, files map[string]*string) *azaciv2.Volume {
+	if len(files) == 0 {
+		return getEmptyVolume(name)
+	}
+	return &azaciv2.Volume{
+		Name:   &name,
+		Secret: files,
+	}
+}
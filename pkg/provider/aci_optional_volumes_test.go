@@ -0,0 +1,96 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetVolumesOptionalSources(t *testing.T) {
+	p := newSubPathTestProvider(t)
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+
+	optional := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "missing"},
+				Optional:             &optional,
+			}}},
+			{Name: "creds", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+				SecretName: "missing",
+				Optional:   &optional,
+			}}},
+			{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+				SecretName: "tls",
+				Items:      []v1.KeyToPath{{Key: "tls.crt", Path: "tls.crt"}, {Key: "ca.crt", Path: "ca.crt"}},
+				Optional:   &optional,
+			}}},
+		}},
+	}
+
+	volumes, err := p.getVolumes(context.Background(), pod)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 3))
+	assert.Check(t, is.Equal("config", *volumes[0].Name))
+	assert.Check(t, volumes[0].EmptyDir != nil, "the missing optional configmap is mounted as an empty volume")
+	assert.Check(t, is.Equal("creds", *volumes[1].Name))
+	assert.Check(t, volumes[1].EmptyDir != nil, "the missing optional secret is mounted as an empty volume")
+	assert.Check(t, is.DeepEqual(map[string]*string{"tls.crt": encoded("cert")}, volumes[2].Secret))
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Assert(t, is.Len(events, 3))
+	assert.Check(t, strings.HasPrefix(events[0], "Warning "+eventReasonOptionalConfigMapNotFound), events[0])
+	assert.Check(t, strings.HasPrefix(events[1], "Warning "+eventReasonOptionalSecretNotFound), events[1])
+	assert.Check(t, strings.HasPrefix(events[2], "Warning "+eventReasonOptionalSecretKeyNotFound), events[2])
+	assert.Check(t, is.Contains(events[2], "[ca.crt]"))
+}
+
+func TestGetVolumesRequiredSources(t *testing.T) {
+	p := newSubPathTestProvider(t)
+	notOptional := false
+	cases := []struct {
+		description string
+		optional    *bool
+	}{
+		{"unset", nil},
+		{"false", &notOptional},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+				Spec: v1.PodSpec{Volumes: []v1.Volume{
+					{Name: "creds", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+						SecretName: "missing",
+						Optional:   tc.optional,
+					}}},
+				}},
+			}
+			_, err := p.getVolumes(context.Background(), pod)
+			assert.Check(t, is.ErrorContains(err, "secret missing is required by Pod p and does not exist"))
+
+			pod.Spec.Volumes[0].VolumeSource = v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "missing"},
+				Optional:             tc.optional,
+			}}
+			_, err = p.getVolumes(context.Background(), pod)
+			assert.Check(t, is.ErrorContains(err, "ConfigMap missing is required by Pod p and does not exist"))
+		})
+	}
+}
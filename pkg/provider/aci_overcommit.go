@@ -0,0 +1,160 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// overcommitPolicyRequests accounts the pods of the node by their requests, like the scheduler, so the limits
+	// of the pods may add up to more than the capacity of the node.
+	overcommitPolicyRequests = "Requests"
+	// overcommitPolicyLimits schedules the pods by their requests but caps the node by their limits: the
+	// allocatable resources are lowered by the limits exceeding the requests of the pods of the node, and the
+	// pods whose limits don't fit in the capacity of the node are failed.
+	overcommitPolicyLimits = "Limits"
+)
+
+func validateOvercommitPolicy(policy string) error {
+	switch policy {
+	case "", overcommitPolicyRequests, overcommitPolicyLimits:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid overcommit policy, expected %s or %s", policy, overcommitPolicyRequests, overcommitPolicyLimits)
+}
+
+// accountedResources are the CPU and memory of pods, either as seen by the scheduler or as accounted by the node.
+type accountedResources struct {
+	cpu    resource.Quantity
+	memory resource.Quantity
+}
+
+func (r *accountedResources) add(other accountedResources) {
+	r.cpu.Add(other.cpu)
+	r.memory.Add(other.memory)
+}
+
+// getPodRequests returns the resources the scheduler subtracts from the allocatable resources of the node for a pod,
+// including the overhead of its runtime class.
+func getPodRequests(pod *v1.Pod) accountedResources {
+	var requests accountedResources
+	if q, ok := pod.Spec.Overhead[v1.ResourceCPU]; ok {
+		requests.cpu.Add(q)
+	}
+	if q, ok := pod.Spec.Overhead[v1.ResourceMemory]; ok {
+		requests.memory.Add(q)
+	}
+	for _, container := range pod.Spec.Containers {
+		if q, ok := container.Resources.Requests[v1.ResourceCPU]; ok {
+			requests.cpu.Add(q)
+		}
+		if q, ok := container.Resources.Requests[v1.ResourceMemory]; ok {
+			requests.memory.Add(q)
+		}
+	}
+	return requests
+}
+
+// getPodLimits returns the resources accounted for a pod by the Limits overcommit policy: the limit of each
+// container, or its request without limit, or the default request of the provider without either.
+func getPodLimits(pod *v1.Pod, policy resourcePolicy) accountedResources {
+	var limits accountedResources
+	for _, container := range pod.Spec.Containers {
+		limits.cpu.Add(getContainerLimit(container, v1.ResourceCPU,
+			*resource.NewMilliQuantity(int64(policy.defaultCPU*1000), resource.DecimalSI)))
+		limits.memory.Add(getContainerLimit(container, v1.ResourceMemory,
+			*resource.NewQuantity(int64(policy.defaultMemoryGB*1e9), resource.DecimalSI)))
+	}
+	return limits
+}
+
+func getContainerLimit(container v1.Container, name v1.ResourceName, defaultRequest resource.Quantity) resource.Quantity {
+	if q, ok := container.Resources.Limits[name]; ok {
+		return q
+	}
+	if q, ok := container.Resources.Requests[name]; ok {
+		return q
+	}
+	return defaultRequest
+}
+
+// isActivePod returns whether a pod still holds the resources of the node.
+func isActivePod(pod *v1.Pod) bool {
+	return pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed
+}
+
+// getLimitsAllocatable lowers the allocatable CPU and memory by the limits exceeding the requests of the active
+// pods, as the scheduler only subtracts the requests.
+func getLimitsAllocatable(allocatable v1.ResourceList, pods []*v1.Pod, policyOf func(*v1.Pod) resourcePolicy) v1.ResourceList {
+	allocatable = allocatable.DeepCopy()
+	var requests, limits accountedResources
+	for _, pod := range pods {
+		if !isActivePod(pod) {
+			continue
+		}
+		requests.add(getPodRequests(pod))
+		limits.add(getPodLimits(pod, policyOf(pod)))
+	}
+
+	lower := func(name v1.ResourceName, limits, requests resource.Quantity) {
+		current, ok := allocatable[name]
+		if !ok || limits.Cmp(requests) <= 0 {
+			return
+		}
+		current.Sub(limits)
+		current.Add(requests)
+		if current.Sign() < 0 {
+			current = resource.Quantity{Format: current.Format}
+		}
+		allocatable[name] = current
+	}
+	lower(v1.ResourceCPU, limits.cpu, requests.cpu)
+	lower(v1.ResourceMemory, limits.memory, requests.memory)
+	return allocatable
+}
+
+// admitPodLimits fails the pods whose limits don't fit in the capacity of the node with the limits of the other
+// active pods of the node, when the overcommit policy is Limits, with the reason of the kubelet for the resource.
+// It returns whether the creation of the pod should go on.
+func (p *ACIProvider) admitPodLimits(ctx context.Context, pod *v1.Pod) bool {
+	if p.overcommitPolicy != overcommitPolicyLimits {
+		return true
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to list the pods, skipping the limits admission")
+		return true
+	}
+	limits := getPodLimits(pod, p.getAccountedResourcePolicy(pod))
+	for _, other := range pods {
+		if (other.Namespace == pod.Namespace && other.Name == pod.Name) || !isActivePod(other) {
+			continue
+		}
+		limits.add(getPodLimits(other, p.getAccountedResourcePolicy(other)))
+	}
+
+	capacity := p.capacity()
+	for _, r := range []struct {
+		name v1.ResourceName
+		used resource.Quantity
+	}{{v1.ResourceCPU, limits.cpu}, {v1.ResourceMemory, limits.memory}} {
+		if available := capacity[r.name]; r.used.Cmp(available) > 0 {
+			p.failPod(ctx, pod, fmt.Sprintf("OutOf%s", r.name),
+				errdefs.InvalidInputf("the limits of the pods of node %s would use %s %s, more than the capacity of %s",
+					p.nodeName, r.used.String(), r.name, available.String()))
+			return false
+		}
+	}
+	return true
+}
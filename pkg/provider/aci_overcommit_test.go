@@ -0,0 +1,126 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+)
+
+func newOvercommitTestPods() []*v1.Pod {
+	pods := testsutil.CreatePodsList([]string{"p1", "p2", "p3"}, "ns")
+	for _, pod := range pods {
+		pod.Spec.Containers = []v1.Container{{
+			Name: "c",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("1"),
+					v1.ResourceMemory: resource.MustParse("1G"),
+				},
+				Limits: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("3"),
+					v1.ResourceMemory: resource.MustParse("2G"),
+				},
+			},
+		}}
+	}
+	pods[2].Status.Phase = v1.PodFailed
+	return pods
+}
+
+func TestGetLimitsAllocatable(t *testing.T) {
+	capacity := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("10"),
+		v1.ResourceMemory: resource.MustParse("10G"),
+		v1.ResourcePods:   resource.MustParse("50"),
+	}
+	pods := newOvercommitTestPods()
+	policyOf := func(*v1.Pod) resourcePolicy {
+		return resourcePolicy{defaultCPU: 1, defaultMemoryGB: 1.5}
+	}
+
+	allocatable := getLimitsAllocatable(capacity, pods, policyOf)
+	assert.Check(t, is.Equal("6", allocatable.Cpu().String()))
+	assert.Check(t, is.Equal("8G", allocatable.Memory().String()))
+	assert.Check(t, is.Equal("50", allocatable.Pods().String()))
+
+	// the containers without requests are accounted with the default requests the scheduler doesn't see
+	pods[0].Spec.Containers[0].Resources = v1.ResourceRequirements{}
+	allocatable = getLimitsAllocatable(capacity, pods[:1], policyOf)
+	assert.Check(t, is.Equal("9", allocatable.Cpu().String()))
+	assert.Check(t, is.Equal("8500M", allocatable.Memory().String()))
+}
+
+func TestAdmitPodLimits(t *testing.T) {
+	cases := []struct {
+		description      string
+		overcommitPolicy string
+		cpuLimit         string
+		expectedReason   string
+	}{
+		{
+			description:      "pods accounted by requests",
+			overcommitPolicy: overcommitPolicyRequests,
+			cpuLimit:         "10",
+		},
+		{
+			description:      "limits fit in the node",
+			overcommitPolicy: overcommitPolicyLimits,
+			cpuLimit:         "4",
+		},
+		{
+			description:      "limits exceed the node",
+			overcommitPolicy: overcommitPolicyLimits,
+			cpuLimit:         "5",
+			expectedReason:   "OutOfcpu",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			pods := newOvercommitTestPods()
+			pod := pods[1]
+			pod.Spec.Containers[0].Resources.Limits[v1.ResourceCPU] = resource.MustParse(tc.cpuLimit)
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+			provider, err := createTestProvider(createNewACIMock(), NewMockConfigMapLister(mockCtrl),
+				NewMockSecretLister(mockCtrl), podLister)
+			assert.NilError(t, err)
+			provider.cpu, provider.memory = "7", "10G"
+			provider.overcommitPolicy = tc.overcommitPolicy
+			recorder := record.NewFakeRecorder(10)
+			provider.SetEventRecorder(recorder)
+			var updatedPod *v1.Pod
+			provider.tracker = &PodsTracker{
+				pods: podLister,
+				updateCb: func(p *v1.Pod) {
+					updatedPod = p
+				},
+			}
+
+			admitted := provider.admitPodLimits(context.Background(), pod)
+			if tc.expectedReason == "" {
+				assert.Check(t, admitted)
+				return
+			}
+			assert.Check(t, !admitted)
+			assert.Assert(t, updatedPod != nil)
+			assert.Check(t, is.Equal(tc.expectedReason, updatedPod.Status.Reason))
+			assert.Assert(t, is.Len(recorder.Events, 1))
+			assert.Check(t, is.Contains(<-recorder.Events, "more than the capacity of 7"))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// resourceOverheadTag is the CPU and memory the container group of a pod requests on top of the requests the
+	// scheduler accounted for the pod, e.g. for the default requests of its containers or the sidecars added by the
+	// container group mutators, as "cpu=<quantity>,memory=<quantity>".
+	resourceOverheadTag = "ResourceOverhead"
+
+	// podConditionACIResourceOverhead reports the resource overhead of the container group of a pod.
+	podConditionACIResourceOverhead v1.PodConditionType = "AciResourceOverhead"
+)
+
+func (r accountedResources) isZero() bool {
+	return r.cpu.IsZero() && r.memory.IsZero()
+}
+
+func (r accountedResources) String() string {
+	return fmt.Sprintf("cpu=%s,memory=%s", r.cpu.String(), r.memory.String())
+}
+
+// parseAccountedResources parses the resources formatted by accountedResources.String.
+func parseAccountedResources(value string) (accountedResources, error) {
+	var resources accountedResources
+	for _, field := range strings.Split(value, ",") {
+		name, quantity, ok := strings.Cut(field, "=")
+		if !ok {
+			return accountedResources{}, fmt.Errorf("invalid resources %q", value)
+		}
+		q, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			return accountedResources{}, fmt.Errorf("invalid resources %q: %v", value, err)
+		}
+		switch v1.ResourceName(name) {
+		case v1.ResourceCPU:
+			resources.cpu = q
+		case v1.ResourceMemory:
+			resources.memory = q
+		default:
+			return accountedResources{}, fmt.Errorf("invalid resources %q: unknown resource %s", value, name)
+		}
+	}
+	return resources, nil
+}
+
+// getContainerGroupRequests returns the CPU and memory requested by the containers of a container group. The init
+// containers run before the containers and don't request resources of their own.
+func getContainerGroupRequests(cg *azaciv2.ContainerGroup) accountedResources {
+	var requests accountedResources
+	if cg.Properties == nil {
+		return requests
+	}
+	for _, container := range cg.Properties.Containers {
+		if container == nil || container.Properties == nil || container.Properties.Resources == nil ||
+			container.Properties.Resources.Requests == nil {
+			continue
+		}
+		r := container.Properties.Resources.Requests
+		if r.CPU != nil {
+			requests.cpu.Add(*resource.NewMilliQuantity(int64(*r.CPU*1000+0.5), resource.DecimalSI))
+		}
+		if r.MemoryInGB != nil {
+			requests.memory.Add(*resource.NewQuantity(int64(*r.MemoryInGB*1e9+0.5), resource.DecimalSI))
+		}
+	}
+	return requests
+}
+
+// getResourceOverhead returns the resources the container group of a pod requests on top of the requests of the pod
+// as scheduled, each floored at zero as the requests of a container group can also be scaled down.
+func getResourceOverhead(pod *v1.Pod, cg *azaciv2.ContainerGroup) accountedResources {
+	overhead := getContainerGroupRequests(cg)
+	scheduled := getPodRequests(pod)
+	overhead.cpu.Sub(scheduled.cpu)
+	overhead.memory.Sub(scheduled.memory)
+	if overhead.cpu.Sign() < 0 {
+		overhead.cpu = resource.Quantity{Format: resource.DecimalSI}
+	}
+	if overhead.memory.Sign() < 0 {
+		overhead.memory = resource.Quantity{Format: resource.DecimalSI}
+	}
+	return overhead
+}
+
+// setResourceOverhead tags the container group of a pod with its resource overhead, compared to the pod as
+// scheduled, and records it for the accounting of the node.
+func (p *ACIProvider) setResourceOverhead(pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	key := pod.Namespace + "/" + pod.Name
+	overhead := getResourceOverhead(pod, cg)
+	if overhead.isZero() {
+		p.resourceOverheads.Delete(key)
+		return
+	}
+	if cg.Tags == nil {
+		cg.Tags = map[string]*string{}
+	}
+	value := overhead.String()
+	cg.Tags[resourceOverheadTag] = &value
+	p.resourceOverheads.Store(key, overhead)
+}
+
+// loadResourceOverhead returns the resource overhead tagged on the container group of a pod, and records it for the
+// accounting of the node as the overheads of the pods created before a restart are only known from their tags.
+func (p *ACIProvider) loadResourceOverhead(namespace, name string, cg *azaciv2.ContainerGroup) (accountedResources, bool) {
+	key := namespace + "/" + name
+	value, ok := cg.Tags[resourceOverheadTag]
+	if !ok || value == nil {
+		p.resourceOverheads.Delete(key)
+		return accountedResources{}, false
+	}
+	overhead, err := parseAccountedResources(*value)
+	if err != nil || overhead.isZero() {
+		p.resourceOverheads.Delete(key)
+		return accountedResources{}, false
+	}
+	p.resourceOverheads.Store(key, overhead)
+	return overhead, true
+}
+
+// setResourceOverheadCondition reports the resource overhead of the container group of a pod in the pod status.
+func (p *ACIProvider) setResourceOverheadCondition(status *v1.PodStatus, namespace, name string, cg *azaciv2.ContainerGroup) {
+	overhead, ok := p.loadResourceOverhead(namespace, name, cg)
+	if !ok {
+		return
+	}
+	setPodCondition(status, v1.PodCondition{
+		Type:               podConditionACIResourceOverhead,
+		Status:             v1.ConditionTrue,
+		Reason:             "ContainerGroupRequests",
+		Message:            fmt.Sprintf("the container group requests %s CPU and %s memory more than the pod", overhead.cpu.String(), overhead.memory.String()),
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	})
+}
+
+// getOverheadAllocatable lowers the allocatable CPU and memory by the resource overhead of the container groups of
+// the active pods, which the scheduler doesn't subtract.
+func (p *ACIProvider) getOverheadAllocatable(allocatable v1.ResourceList, pods []*v1.Pod) v1.ResourceList {
+	var overhead accountedResources
+	for _, pod := range pods {
+		if !isActivePod(pod) {
+			continue
+		}
+		if o, ok := p.resourceOverheads.Load(pod.Namespace + "/" + pod.Name); ok {
+			overhead.add(o.(accountedResources))
+		}
+	}
+	if overhead.isZero() {
+		return allocatable
+	}
+
+	allocatable = allocatable.DeepCopy()
+	lower := func(name v1.ResourceName, overhead resource.Quantity) {
+		current, ok := allocatable[name]
+		if !ok {
+			return
+		}
+		current.Sub(overhead)
+		if current.Sign() < 0 {
+			current = resource.Quantity{Format: current.Format}
+		}
+		allocatable[name] = current
+	}
+	lower(v1.ResourceCPU, overhead.cpu)
+	lower(v1.ResourceMemory, overhead.memory)
+	return allocatable
+}
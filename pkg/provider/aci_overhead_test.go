@@ -0,0 +1,95 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func newOverheadTestContainerGroup(requests ...[2]float64) *azaciv2.ContainerGroup {
+	cg := &azaciv2.ContainerGroup{Properties: &azaciv2.ContainerGroupPropertiesProperties{}}
+	for _, r := range requests {
+		cpu, memoryGB := r[0], r[1]
+		cg.Properties.Containers = append(cg.Properties.Containers, &azaciv2.Container{
+			Properties: &azaciv2.ContainerProperties{
+				Resources: &azaciv2.ResourceRequirements{
+					Requests: &azaciv2.ResourceRequests{CPU: &cpu, MemoryInGB: &memoryGB},
+				},
+			},
+		})
+	}
+	return cg
+}
+
+func TestGetResourceOverhead(t *testing.T) {
+	pods := newOvercommitTestPods()
+	pod := pods[0]
+
+	// a sidecar added to the container group
+	overhead := getResourceOverhead(pod, newOverheadTestContainerGroup([2]float64{1, 1}, [2]float64{0.5, 0.25}))
+	assert.Check(t, is.Equal("cpu=500m,memory=250M", overhead.String()))
+
+	// the overhead of the runtime class is accounted by the scheduler already
+	pod.Spec.Overhead = v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")}
+	overhead = getResourceOverhead(pod, newOverheadTestContainerGroup([2]float64{1, 1}, [2]float64{0.5, 0.25}))
+	assert.Check(t, is.Equal("cpu=250m,memory=250M", overhead.String()))
+
+	// the requests scaled down aren't an overhead
+	overhead = getResourceOverhead(pod, newOverheadTestContainerGroup([2]float64{0.5, 0.5}))
+	assert.Check(t, overhead.isZero())
+}
+
+func TestResourceOverheadAccounting(t *testing.T) {
+	p := ACIProvider{}
+	pods := newOvercommitTestPods()
+	cg := newOverheadTestContainerGroup([2]float64{1, 1}, [2]float64{0.5, 0.25})
+	p.setResourceOverhead(pods[0], cg)
+	assert.Assert(t, cg.Tags[resourceOverheadTag] != nil)
+	assert.Check(t, is.Equal("cpu=500m,memory=250M", *cg.Tags[resourceOverheadTag]))
+
+	// the overheads are recovered from the tags after a restart
+	restarted := ACIProvider{}
+	status := &v1.PodStatus{}
+	restarted.setResourceOverheadCondition(status, "ns", "p1", cg)
+	assert.Assert(t, is.Len(status.Conditions, 1))
+	assert.Check(t, is.Equal(podConditionACIResourceOverhead, status.Conditions[0].Type))
+	assert.Check(t, is.Contains(status.Conditions[0].Message, "500m CPU and 250M memory"))
+	restarted.setResourceOverheadCondition(&v1.PodStatus{}, "ns", "p3", cg)
+
+	capacity := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("10"),
+		v1.ResourceMemory: resource.MustParse("10G"),
+		v1.ResourcePods:   resource.MustParse("50"),
+	}
+	// the overhead of the completed pods is released
+	allocatable := restarted.getOverheadAllocatable(capacity, pods)
+	assert.Check(t, is.Equal("9500m", allocatable.Cpu().String()))
+	assert.Check(t, is.Equal("9750M", allocatable.Memory().String()))
+	assert.Check(t, is.Equal("50", allocatable.Pods().String()))
+	assert.Check(t, is.Equal("10", capacity.Cpu().String()))
+
+	// the container groups without overhead aren't accounted
+	restarted.loadResourceOverhead("ns", "p1", newOverheadTestContainerGroup([2]float64{1, 1}))
+	allocatable = restarted.getOverheadAllocatable(capacity, pods)
+	assert.Check(t, is.Equal("10", allocatable.Cpu().String()))
+}
+
+func TestParseAccountedResources(t *testing.T) {
+	resources, err := parseAccountedResources("cpu=1500m,memory=2G")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("1500m", resources.cpu.String()))
+	assert.Check(t, is.Equal("2G", resources.memory.String()))
+
+	_, err = parseAccountedResources("cpu=1,gpu=1")
+	assert.Check(t, is.ErrorContains(err, "unknown resource gpu"))
+	_, err = parseAccountedResources("cpu")
+	assert.Check(t, is.ErrorContains(err, "invalid resources"))
+}
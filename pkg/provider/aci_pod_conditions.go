@@ -0,0 +1,160 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// readinessGateACIProvisioned is the condition of the pods whose container group was provisioned, which pods
+	// can use as a readiness gate.
+	readinessGateACIProvisioned v1.PodConditionType = "aci.azure.com/provisioned"
+	// readinessGateACIRunning is the condition of the pods whose container group is running.
+	readinessGateACIRunning v1.PodConditionType = "aci.azure.com/running"
+
+	podConditionReasonContainersNotInitialized = "ContainersNotInitialized"
+	podConditionReasonContainersNotReady       = "ContainersNotReady"
+	podConditionReasonPodCompleted             = "PodCompleted"
+	podConditionReasonReadinessGatesNotReady   = "ReadinessGatesNotReady"
+)
+
+// getPodConditions returns the conditions of a pod from the state of its container group and the statuses of its
+// containers, like the kubelet computes them. The readiness gates of the pod are taken into account by
+// mergePodConditions, which knows the pod.
+func getPodConditions(cg *azaciv2.ContainerGroup, aciState string, creationTime, lastUpdateTime time.Time, initContainerStatuses, containerStatuses []v1.ContainerStatus) []v1.PodCondition {
+	completed := getPodPhaseFromACIState(aciState) == v1.PodSucceeded
+
+	initialized := newPodCondition(v1.PodInitialized, true, creationTime, "", "")
+	var notInitialized []string
+	for _, status := range initContainerStatuses {
+		if !isSucceeded(status.State) {
+			notInitialized = append(notInitialized, status.Name)
+		}
+	}
+	if len(notInitialized) > 0 {
+		initialized = newPodCondition(v1.PodInitialized, false, creationTime, podConditionReasonContainersNotInitialized,
+			fmt.Sprintf("containers with incomplete status: [%s]", strings.Join(notInitialized, " ")))
+	}
+
+	containersReady := newPodCondition(v1.ContainersReady, true, lastUpdateTime, "", "")
+	var notReady []string
+	for _, status := range containerStatuses {
+		if !status.Ready {
+			notReady = append(notReady, status.Name)
+		}
+	}
+	switch {
+	case completed:
+		containersReady = newPodCondition(v1.ContainersReady, false, lastUpdateTime, podConditionReasonPodCompleted, "")
+	case len(notReady) > 0 || len(containerStatuses) == 0:
+		containersReady = newPodCondition(v1.ContainersReady, false, creationTime, podConditionReasonContainersNotReady,
+			fmt.Sprintf("containers with unready status: [%s]", strings.Join(notReady, " ")))
+	}
+	ready := containersReady
+	ready.Type = v1.PodReady
+
+	provisioned := getProvisioningState(cg) == provisioningStateSucceeded
+	running := cg.Properties != nil && cg.Properties.InstanceView != nil && stringValue(cg.Properties.InstanceView.State) == "Running"
+
+	return []v1.PodCondition{
+		ready,
+		initialized,
+		newPodCondition(v1.PodScheduled, true, creationTime, "", ""),
+		containersReady,
+		newPodCondition(readinessGateACIProvisioned, provisioned, creationTime, getProvisioningState(cg), ""),
+		newPodCondition(readinessGateACIRunning, running, lastUpdateTime, aciState, ""),
+	}
+}
+
+func newPodCondition(conditionType v1.PodConditionType, status bool, transitionTime time.Time, reason, message string) v1.PodCondition {
+	condition := v1.PodCondition{
+		Type:               conditionType,
+		Status:             v1.ConditionFalse,
+		LastTransitionTime: metav1.NewTime(transitionTime),
+		Reason:             reason,
+		Message:            message,
+	}
+	if status {
+		condition.Status = v1.ConditionTrue
+	}
+	return condition
+}
+
+func isACIReadinessGate(conditionType v1.PodConditionType) bool {
+	return conditionType == readinessGateACIProvisioned || conditionType == readinessGateACIRunning
+}
+
+// mergePodConditions completes the conditions of a status fetched from ACI for a pod with its readiness gates:
+// the ACI conditions are only kept when the pod gates on them, the conditions of the other gates set by their
+// controllers are carried over and the pod is only ready once all its gates are true. The DisruptionTarget
+// condition of a pod about to be deleted is carried over as well. The transition times of the conditions whose
+// status didn't change are kept.
+func mergePodConditions(pod *v1.Pod, status *v1.PodStatus) {
+	gates := make(map[v1.PodConditionType]bool, len(pod.Spec.ReadinessGates))
+	for _, gate := range pod.Spec.ReadinessGates {
+		gates[gate.ConditionType] = true
+	}
+
+	conditions := make([]v1.PodCondition, 0, len(status.Conditions)+len(gates))
+	seen := map[v1.PodConditionType]bool{}
+	for _, condition := range status.Conditions {
+		if isACIReadinessGate(condition.Type) && !gates[condition.Type] {
+			continue
+		}
+		seen[condition.Type] = true
+		conditions = append(conditions, condition)
+	}
+	for _, condition := range pod.Status.Conditions {
+		if (gates[condition.Type] || condition.Type == v1.DisruptionTarget) && !seen[condition.Type] && !isACIReadinessGate(condition.Type) {
+			seen[condition.Type] = true
+			conditions = append(conditions, condition)
+		}
+	}
+
+	for i := range conditions {
+		if conditions[i].Type != v1.PodReady || conditions[i].Status != v1.ConditionTrue {
+			continue
+		}
+		for _, gate := range pod.Spec.ReadinessGates {
+			gateCondition := findPodCondition(conditions, gate.ConditionType)
+			message := ""
+			switch {
+			case gateCondition == nil:
+				message = fmt.Sprintf("corresponding condition of pod readiness gate %q does not exist.", gate.ConditionType)
+			case gateCondition.Status != v1.ConditionTrue:
+				message = fmt.Sprintf("the status of pod readiness gate %q is not \"True\", but %v", gate.ConditionType, gateCondition.Status)
+			default:
+				continue
+			}
+			conditions[i].Status = v1.ConditionFalse
+			conditions[i].Reason = podConditionReasonReadinessGatesNotReady
+			conditions[i].Message = message
+			break
+		}
+	}
+
+	for i := range conditions {
+		if previous := findPodCondition(pod.Status.Conditions, conditions[i].Type); previous != nil && previous.Status == conditions[i].Status {
+			conditions[i].LastTransitionTime = previous.LastTransitionTime
+		}
+	}
+	status.Conditions = conditions
+}
+
+func findPodCondition(conditions []v1.PodCondition, conditionType v1.PodConditionType) *v1.PodCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
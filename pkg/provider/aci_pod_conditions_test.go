@@ -0,0 +1,56 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergePodConditions(t *testing.T) {
+	scheduledAt := metav1.NewTime(time.Now().Add(-time.Hour))
+	now := time.Now()
+	const externalGate v1.PodConditionType = "example.com/registered"
+
+	newStatus := func() *v1.PodStatus {
+		return &v1.PodStatus{Conditions: []v1.PodCondition{
+			newPodCondition(v1.PodReady, true, now, "", ""),
+			newPodCondition(v1.PodScheduled, true, now, "", ""),
+			newPodCondition(readinessGateACIProvisioned, true, now, "Succeeded", ""),
+			newPodCondition(readinessGateACIRunning, true, now, "Running", ""),
+		}}
+	}
+	pod := &v1.Pod{Status: v1.PodStatus{Conditions: []v1.PodCondition{
+		{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: scheduledAt},
+	}}}
+
+	// the ACI conditions are dropped without readiness gates
+	status := newStatus()
+	mergePodConditions(pod, status)
+	assert.Check(t, is.Len(status.Conditions, 2))
+	assert.Check(t, is.Equal(v1.ConditionTrue, findPodCondition(status.Conditions, v1.PodReady).Status))
+	assert.Check(t, is.DeepEqual(scheduledAt, findPodCondition(status.Conditions, v1.PodScheduled).LastTransitionTime))
+
+	// the pod isn't ready until the condition of the external gate is set
+	pod.Spec.ReadinessGates = []v1.PodReadinessGate{{ConditionType: readinessGateACIRunning}, {ConditionType: externalGate}}
+	status = newStatus()
+	mergePodConditions(pod, status)
+	assert.Check(t, is.Len(status.Conditions, 3))
+	ready := findPodCondition(status.Conditions, v1.PodReady)
+	assert.Check(t, is.Equal(v1.ConditionFalse, ready.Status))
+	assert.Check(t, is.Equal(podConditionReasonReadinessGatesNotReady, ready.Reason))
+
+	pod.Status.Conditions = append(pod.Status.Conditions, v1.PodCondition{Type: externalGate, Status: v1.ConditionTrue})
+	status = newStatus()
+	mergePodConditions(pod, status)
+	assert.Check(t, is.Len(status.Conditions, 4))
+	assert.Check(t, is.Equal(v1.ConditionTrue, findPodCondition(status.Conditions, v1.PodReady).Status))
+	assert.Check(t, is.Equal(v1.ConditionTrue, findPodCondition(status.Conditions, externalGate).Status))
+}
@@ -0,0 +1,221 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// podDefaultsConfig are the labels, annotations, tolerations and container resources the pods of the node get
+// when they don't set them, e.g. the subnet or Log Analytics annotations of a team. They apply to the pods of
+// Namespaces, or of all the namespaces when none is set. Requests and Limits map resource names to quantities.
+type podDefaultsConfig struct {
+	Namespaces  []string
+	Labels      map[string]string
+	Annotations map[string]string
+	Tolerations []podTolerationConfig
+	Requests    map[string]string
+	Limits      map[string]string
+}
+
+// podTolerationConfig is a toleration of the pod defaults in the provider config.
+type podTolerationConfig struct {
+	Key      string
+	Operator string
+	Value    string
+	Effect   string
+}
+
+type podDefaults struct {
+	namespaces  map[string]bool
+	labels      map[string]string
+	annotations map[string]string
+	tolerations []v1.Toleration
+	requests    v1.ResourceList
+	limits      v1.ResourceList
+}
+
+// parsePodDefaults validates the pod defaults of the config file.
+func parsePodDefaults(configs []podDefaultsConfig) ([]podDefaults, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	result := make([]podDefaults, 0, len(configs))
+	for i, config := range configs {
+		defaults := podDefaults{
+			labels:      config.Labels,
+			annotations: config.Annotations,
+		}
+		if len(config.Namespaces) > 0 {
+			defaults.namespaces = make(map[string]bool, len(config.Namespaces))
+			for _, namespace := range config.Namespaces {
+				defaults.namespaces[namespace] = true
+			}
+		}
+		for key, value := range config.Labels {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("pod defaults %d: invalid label %q: %v", i, key, errs)
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf("pod defaults %d: invalid value of label %q: %v", i, key, errs)
+			}
+		}
+		for key := range config.Annotations {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("pod defaults %d: invalid annotation %q: %v", i, key, errs)
+			}
+		}
+
+		for _, toleration := range config.Tolerations {
+			operator := v1.TolerationOperator(toleration.Operator)
+			switch operator {
+			case "":
+				operator = v1.TolerationOpEqual
+			case v1.TolerationOpEqual, v1.TolerationOpExists:
+			default:
+				return nil, fmt.Errorf("pod defaults %d: toleration operator %q of %s is not supported", i, toleration.Operator, toleration.Key)
+			}
+			if operator == v1.TolerationOpExists && toleration.Value != "" {
+				return nil, fmt.Errorf("pod defaults %d: toleration %s can't have a value with the Exists operator", i, toleration.Key)
+			}
+			effect := v1.TaintEffect(toleration.Effect)
+			switch effect {
+			case "", v1.TaintEffectNoSchedule, v1.TaintEffectNoExecute, v1.TaintEffectPreferNoSchedule:
+			default:
+				return nil, fmt.Errorf("pod defaults %d: toleration effect %q of %s is not supported", i, toleration.Effect, toleration.Key)
+			}
+			defaults.tolerations = append(defaults.tolerations, v1.Toleration{
+				Key:      toleration.Key,
+				Operator: operator,
+				Value:    toleration.Value,
+				Effect:   effect,
+			})
+		}
+
+		var err error
+		if defaults.requests, err = parseResourceList(config.Requests); err != nil {
+			return nil, fmt.Errorf("pod defaults %d: requests: %v", i, err)
+		}
+		if err := validateDefaultResourceList(defaults.requests); err != nil {
+			return nil, fmt.Errorf("pod defaults %d: requests: %v", i, err)
+		}
+		if defaults.limits, err = parseResourceList(config.Limits); err != nil {
+			return nil, fmt.Errorf("pod defaults %d: limits: %v", i, err)
+		}
+		result = append(result, defaults)
+	}
+	return result, nil
+}
+
+func parseResourceList(quantities map[string]string) (v1.ResourceList, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+	resources := make(v1.ResourceList, len(quantities))
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q of %s: %v", value, name, err)
+		}
+		if quantity.Sign() < 0 {
+			return nil, fmt.Errorf("quantity %q of %s can't be negative", value, name)
+		}
+		resources[v1.ResourceName(name)] = quantity
+	}
+	return resources, nil
+}
+
+// applyPodDefaults returns a copy of a pod with the pod defaults of its namespace, which apply before the pod is
+// admitted and translated into a container group, or the pod itself when none apply. The defaults only fill in
+// what the pod doesn't set, the first pod defaults of the config file taking precedence, and the pod is left
+// unchanged in the cluster.
+func (p *ACIProvider) applyPodDefaults(pod *v1.Pod) *v1.Pod {
+	p.settingsLock.RLock()
+	allDefaults := p.podDefaults
+	p.settingsLock.RUnlock()
+
+	mutated := pod
+	for i := range allDefaults {
+		defaults := &allDefaults[i]
+		if defaults.namespaces != nil && !defaults.namespaces[pod.Namespace] {
+			continue
+		}
+		if mutated == pod {
+			mutated = pod.DeepCopy()
+		}
+		defaults.apply(mutated)
+	}
+	return mutated
+}
+
+func (d *podDefaults) apply(pod *v1.Pod) {
+	pod.Labels = addMissingEntries(pod.Labels, d.labels)
+	pod.Annotations = addMissingEntries(pod.Annotations, d.annotations)
+
+	for _, toleration := range d.tolerations {
+		found := false
+		for i := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[i].MatchToleration(&toleration) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			pod.Spec.Tolerations = append(pod.Spec.Tolerations, toleration)
+		}
+	}
+
+	// the init containers of ACI don't have resources
+	for i := range pod.Spec.Containers {
+		resources := &pod.Spec.Containers[i].Resources
+		for name, request := range d.requests {
+			// the default CPU and memory requests are resolved with the other default requests, see getDefaultRequests
+			if name == v1.ResourceCPU || name == v1.ResourceMemory {
+				continue
+			}
+			if _, ok := resources.Requests[name]; ok {
+				continue
+			}
+			// a default request can't exceed the limit of the container
+			if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+				continue
+			}
+			if resources.Requests == nil {
+				resources.Requests = v1.ResourceList{}
+			}
+			resources.Requests[name] = request.DeepCopy()
+		}
+		for name, limit := range d.limits {
+			if _, ok := resources.Limits[name]; ok {
+				continue
+			}
+			if request, ok := resources.Requests[name]; ok && limit.Cmp(request) < 0 {
+				continue
+			}
+			if resources.Limits == nil {
+				resources.Limits = v1.ResourceList{}
+			}
+			resources.Limits[name] = limit.DeepCopy()
+		}
+	}
+}
+
+func addMissingEntries(m map[string]string, defaults map[string]string) map[string]string {
+	for key, value := range defaults {
+		if _, ok := m[key]; ok {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string, len(defaults))
+		}
+		m[key] = value
+	}
+	return m
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const podDefaultsTestConfig = `
+Region = "westus"
+
+[[PodDefaults]]
+Namespaces = ["team-a"]
+Labels = { "team" = "a" }
+Annotations = { "virtual-kubelet.io/region" = "eastus" }
+Tolerations = [{ Key = "virtual-kubelet.io/provider", Operator = "Exists" }]
+Requests = { "cpu" = "500m", "memory" = "1Gi" }
+Limits = { "cpu" = "2" }
+
+[[PodDefaults]]
+Labels = { "team" = "unknown", "managed-by" = "virtual-kubelet" }
+`
+
+func TestApplyPodDefaults(t *testing.T) {
+	var p ACIProvider
+	assert.NilError(t, p.loadConfig(bytes.NewReader([]byte(podDefaultsTestConfig))))
+	assert.Assert(t, is.Len(p.podDefaults, 2))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "p",
+			Namespace:   "team-a",
+			Annotations: map[string]string{regionAnnotation: "westus"},
+		},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init"}},
+			Containers: []v1.Container{
+				{Name: "c1"},
+				{Name: "c2", Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("3")},
+					Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+				}},
+			},
+		},
+	}
+	mutated := p.applyPodDefaults(pod)
+	assert.Check(t, mutated != pod)
+	assert.Check(t, is.Len(pod.Labels, 0), "the pod must not be modified")
+
+	assert.Check(t, is.DeepEqual(map[string]string{"team": "a", "managed-by": "virtual-kubelet"}, mutated.Labels))
+	assert.Check(t, is.Equal("westus", mutated.Annotations[regionAnnotation]), "the pod annotations take precedence")
+	assert.Check(t, is.Len(mutated.Spec.Tolerations, 1))
+	assert.Check(t, is.Equal(v1.TolerationOpExists, mutated.Spec.Tolerations[0].Operator))
+	assert.Check(t, is.Len(mutated.Spec.InitContainers[0].Resources.Requests, 0))
+
+	// the default CPU and memory requests are resolved by getDefaultRequests
+	c1 := mutated.Spec.Containers[0].Resources
+	assert.Check(t, is.Len(c1.Requests, 0))
+	assert.Check(t, c1.Limits.Cpu().Equal(resource.MustParse("2")))
+
+	// the defaults don't conflict with the resources of the container
+	c2 := mutated.Spec.Containers[1].Resources
+	assert.Check(t, c2.Requests.Cpu().Equal(resource.MustParse("3")))
+	assert.Check(t, is.Len(c2.Limits, 1), "the default CPU limit is below the CPU request")
+	assert.Check(t, is.Len(c2.Requests, 1))
+
+	other := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "team-b"}}
+	mutated = p.applyPodDefaults(other)
+	assert.Check(t, is.DeepEqual(map[string]string{"team": "unknown", "managed-by": "virtual-kubelet"}, mutated.Labels))
+	assert.Check(t, is.Len(mutated.Spec.Tolerations, 0))
+
+	p.podDefaults = nil
+	assert.Check(t, p.applyPodDefaults(other) == other)
+}
+
+func TestParsePodDefaults(t *testing.T) {
+	cases := []struct {
+		description string
+		defaults    podDefaultsConfig
+		err         string
+	}{
+		{"invalid label", podDefaultsConfig{Labels: map[string]string{"-team": "a"}}, "invalid label"},
+		{"invalid label value", podDefaultsConfig{Labels: map[string]string{"team": "a b"}}, "invalid value of label"},
+		{"invalid annotation", podDefaultsConfig{Annotations: map[string]string{"a/b/c": ""}}, "invalid annotation"},
+		{"toleration operator", podDefaultsConfig{Tolerations: []podTolerationConfig{{Key: "k", Operator: "In"}}}, "operator \"In\" of k is not supported"},
+		{"toleration value", podDefaultsConfig{Tolerations: []podTolerationConfig{{Key: "k", Operator: "Exists", Value: "v"}}}, "can't have a value"},
+		{"toleration effect", podDefaultsConfig{Tolerations: []podTolerationConfig{{Key: "k", Effect: "Evict"}}}, "effect \"Evict\" of k is not supported"},
+		{"invalid quantity", podDefaultsConfig{Requests: map[string]string{"cpu": "a lot"}}, "invalid quantity"},
+		{"negative quantity", podDefaultsConfig{Limits: map[string]string{"memory": "-1Gi"}}, "can't be negative"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := parsePodDefaults([]podDefaultsConfig{tc.defaults})
+			assert.Check(t, is.ErrorContains(err, tc.err))
+		})
+	}
+}
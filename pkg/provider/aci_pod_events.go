@@ -0,0 +1,110 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventReasonCreateFailed   = "ContainerGroupCreateFailed"
+	eventReasonDeleteFailed   = "ContainerGroupDeleteFailed"
+	eventReasonProbeFailed    = "ProbeTranslationFailed"
+	eventReasonQuotaExceeded  = "QuotaExceeded"
+	eventReasonThrottled      = "Throttled"
+	maxEventMessageLength     = 1024
+	eventMessageTruncatedNote = "..."
+)
+
+// probeError is returned when a probe of a container can't be translated to an ACI probe.
+type probeError struct {
+	container string
+	probe     string
+	err       error
+}
+
+func (e *probeError) Error() string {
+	return fmt.Sprintf("invalid %s probe of container %s: %v", e.probe, e.container, e.err)
+}
+
+func (e *probeError) Unwrap() error {
+	return e.err
+}
+
+// quotaError is returned when a container group would exceed the ACI quota of the subscription, with the
+// container groups and cores missing from the quota.
+type quotaError struct {
+	error
+	containerGroups int32
+	cores           int32
+}
+
+func (e *quotaError) Unwrap() error {
+	return e.error
+}
+
+// SetEventRecorder sets the recorder the provider reports the failures of ACI operations on pods with.
+func (p *ACIProvider) SetEventRecorder(recorder record.EventRecorder) {
+	p.eventRecorder = recorder
+}
+
+// recordPodFailure emits a warning event on the pod for a failed operation. The reason is derived from the error
+// when it is more specific than the reason of the operation, and ARM errors are prefixed with their error code.
+func (p *ACIProvider) recordPodFailure(pod *v1.Pod, reason string, err error) {
+	if p.eventRecorder == nil || pod == nil || err == nil {
+		return
+	}
+	p.eventRecorder.Event(pod, v1.EventTypeWarning, getFailureReason(reason, err), getFailureMessage(err))
+}
+
+func getFailureReason(reason string, err error) string {
+	var pErr *probeError
+	if errors.As(err, &pErr) {
+		return eventReasonProbeFailed
+	}
+	var qErr *quotaError
+	if errors.As(err, &qErr) {
+		return eventReasonQuotaExceeded
+	}
+	var eErr *envError
+	if errors.As(err, &eErr) {
+		return eErr.reason
+	}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		if respErr.StatusCode == http.StatusTooManyRequests {
+			return eventReasonThrottled
+		}
+		if strings.Contains(respErr.ErrorCode, "Quota") {
+			return eventReasonQuotaExceeded
+		}
+	}
+	return reason
+}
+
+func getFailureMessage(err error) string {
+	var message string
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		message = fmt.Sprintf("ARM error %s (HTTP %d)", respErr.ErrorCode, respErr.StatusCode)
+		// the error of a response error describes the response, which is missing when it was built by hand
+		if respErr.RawResponse != nil {
+			message += ": " + err.Error()
+		}
+	} else {
+		message = err.Error()
+	}
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-len(eventMessageTruncatedNote)] + eventMessageTruncatedNote
+	}
+	return message
+}
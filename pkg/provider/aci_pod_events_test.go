@@ -0,0 +1,102 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPodFailureEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		return &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, ErrorCode: "TooManyRequests"}
+	}
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		return errors.New("connection reset")
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	assert.Check(t, provider.CreatePod(context.Background(), pod) != nil)
+	assert.Check(t, is.Equal("Warning Throttled ARM error TooManyRequests (HTTP 429)", <-recorder.Events))
+
+	pod.Spec.Containers[0].ReadinessProbe = &v1.Probe{}
+	assert.Check(t, provider.CreatePod(context.Background(), pod) != nil)
+	assert.Check(t, is.Equal(fmt.Sprintf("Warning ProbeTranslationFailed invalid readiness probe of container %s: probe must specify one of \"exec\" and \"httpGet\"",
+		pod.Spec.Containers[0].Name), <-recorder.Events))
+
+	assert.Check(t, provider.DeletePod(context.Background(), pod) != nil)
+	assert.Check(t, is.Equal("Warning ContainerGroupDeleteFailed connection reset", <-recorder.Events))
+}
+
+func TestGetFailureReason(t *testing.T) {
+	cases := []struct {
+		description    string
+		err            error
+		expectedReason string
+	}{
+		{
+			description:    "generic error",
+			err:            errors.New("failed"),
+			expectedReason: eventReasonCreateFailed,
+		},
+		{
+			description:    "quota check",
+			err:            fmt.Errorf("region westus: %w", &quotaError{error: errors.New("quota exhausted")}),
+			expectedReason: eventReasonQuotaExceeded,
+		},
+		{
+			description:    "ARM quota error",
+			err:            &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "ContainerGroupQuotaReached"},
+			expectedReason: eventReasonQuotaExceeded,
+		},
+		{
+			description:    "ARM throttling",
+			err:            &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+			expectedReason: eventReasonThrottled,
+		},
+		{
+			description:    "ARM error",
+			err:            &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "InvalidImage"},
+			expectedReason: eventReasonCreateFailed,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Check(t, is.Equal(tc.expectedReason, getFailureReason(eventReasonCreateFailed, tc.err)))
+		})
+	}
+}
+
+func TestGetFailureMessageIsTruncated(t *testing.T) {
+	message := getFailureMessage(errors.New(strings.Repeat("x", 2*maxEventMessageLength)))
+	assert.Check(t, is.Len(message, maxEventMessageLength))
+	assert.Check(t, strings.HasSuffix(message, eventMessageTruncatedNote))
+}
@@ -0,0 +1,60 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+)
+
+const (
+	// podIPPolicyContainerGroup reports the IP address of the container group as pod IP, public or private.
+	podIPPolicyContainerGroup = "ContainerGroup"
+	// podIPPolicyPrivate only reports the private IP addresses of the container groups in the virtual network,
+	// so that the pods with a public IP address aren't added to the endpoints of services.
+	podIPPolicyPrivate = "Private"
+
+	// hostIPPolicyNode reports the internal IP of the virtual node as host IP.
+	hostIPPolicyNode = "Node"
+	// hostIPPolicyPodIP reports the pod IP as host IP, as every container group runs on its own host.
+	hostIPPolicyPodIP = "PodIP"
+)
+
+func validatePodIPPolicy(policy string) error {
+	switch policy {
+	case "", podIPPolicyContainerGroup, podIPPolicyPrivate:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid pod IP policy, expected %s or %s", policy, podIPPolicyContainerGroup, podIPPolicyPrivate)
+}
+
+func validateHostIPPolicy(policy string) error {
+	switch policy {
+	case "", hostIPPolicyNode, hostIPPolicyPodIP:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid host IP policy, expected %s or %s", policy, hostIPPolicyNode, hostIPPolicyPodIP)
+}
+
+// getContainerGroupIPs returns the pod IP and host IP of the pod of a container group, following the IP policies
+// of the provider.
+func (p *ACIProvider) getContainerGroupIPs(cg *azaciv2.ContainerGroup) (string, string) {
+	podIP := ""
+	// windows container groups have no IP address the cluster can reach
+	if ip := cg.Properties.IPAddress; ip != nil && cg.Properties.OSType != nil &&
+		*cg.Properties.OSType != azaciv2.OperatingSystemTypesWindows {
+		private := ip.Type != nil && *ip.Type == azaciv2.ContainerGroupIPAddressTypePrivate
+		if p.podIPPolicy != podIPPolicyPrivate || private {
+			podIP = stringValue(ip.IP)
+		}
+	}
+
+	hostIP := p.internalIP
+	if p.hostIPPolicy == hostIPPolicyPodIP && podIP != "" {
+		hostIP = podIP
+	}
+	return podIP, hostIP
+}
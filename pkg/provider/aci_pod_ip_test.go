@@ -0,0 +1,90 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestGetContainerGroupIPs(t *testing.T) {
+	linux, windows := azaciv2.OperatingSystemTypesLinux, azaciv2.OperatingSystemTypesWindows
+	public, private := azaciv2.ContainerGroupIPAddressTypePublic, azaciv2.ContainerGroupIPAddressTypePrivate
+	nodeIP := "10.0.0.4"
+
+	cases := []struct {
+		description    string
+		podIPPolicy    string
+		hostIPPolicy   string
+		os             azaciv2.OperatingSystemTypes
+		ipType         azaciv2.ContainerGroupIPAddressType
+		expectedPodIP  string
+		expectedHostIP string
+	}{
+		{
+			description:    "public container group",
+			os:             linux,
+			ipType:         public,
+			expectedPodIP:  testsutil.FakeIP,
+			expectedHostIP: nodeIP,
+		},
+		{
+			description:    "public container group with the private policy",
+			podIPPolicy:    podIPPolicyPrivate,
+			hostIPPolicy:   hostIPPolicyPodIP,
+			os:             linux,
+			ipType:         public,
+			expectedPodIP:  "",
+			expectedHostIP: nodeIP,
+		},
+		{
+			description:    "private container group reported as its own host",
+			podIPPolicy:    podIPPolicyPrivate,
+			hostIPPolicy:   hostIPPolicyPodIP,
+			os:             linux,
+			ipType:         private,
+			expectedPodIP:  testsutil.FakeIP,
+			expectedHostIP: testsutil.FakeIP,
+		},
+		{
+			description:    "windows container group",
+			hostIPPolicy:   hostIPPolicyPodIP,
+			os:             windows,
+			ipType:         private,
+			expectedPodIP:  "",
+			expectedHostIP: nodeIP,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			p := &ACIProvider{internalIP: nodeIP, podIPPolicy: tc.podIPPolicy, hostIPPolicy: tc.hostIPPolicy}
+			cg := testsutil.CreateContainerGroupObj("pod", "ns", "Running", nil, "Succeeded")
+			os, ipType := tc.os, tc.ipType
+			cg.Properties.OSType = &os
+			cg.Properties.IPAddress.Type = &ipType
+
+			podIP, hostIP := p.getContainerGroupIPs(cg)
+			assert.Check(t, is.Equal(tc.expectedPodIP, podIP))
+			assert.Check(t, is.Equal(tc.expectedHostIP, hostIP))
+		})
+	}
+}
+
+func TestIPPolicyConfig(t *testing.T) {
+	var p ACIProvider
+	assert.NilError(t, p.loadConfig(bytes.NewReader([]byte(`
+PodIPPolicy = "Private"
+HostIPPolicy = "PodIP"`))))
+	assert.Check(t, is.Equal(podIPPolicyPrivate, p.podIPPolicy))
+	assert.Check(t, is.Equal(hostIPPolicyPodIP, p.hostIPPolicy))
+
+	assert.Check(t, p.loadConfig(bytes.NewReader([]byte(`PodIPPolicy = "Public"`))) != nil)
+	assert.Check(t, p.loadConfig(bytes.NewReader([]byte(`HostIPPolicy = "Gateway"`))) != nil)
+}
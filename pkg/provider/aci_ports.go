@@ -0,0 +1,91 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// portExposurePolicyAll exposes all the container ports on the IP address of the container group, unless the
+	// pod selects some with the public ports annotation.
+	portExposurePolicyAll = "AllContainerPorts"
+	// portExposurePolicyAnnotated only exposes the ports of the public ports annotation, the container groups of
+	// the pods without it get no IP address.
+	portExposurePolicyAnnotated = "AnnotatedPorts"
+)
+
+func validatePortExposurePolicy(policy string) error {
+	switch policy {
+	case "", portExposurePolicyAll, portExposurePolicyAnnotated:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid port exposure policy, expected %s or %s", policy, portExposurePolicyAll, portExposurePolicyAnnotated)
+}
+
+// getExposedPorts returns the ports of the IP address of the container group of a pod: the ports of the public
+// ports annotation when it is set, which must be container ports, or else all the container ports unless only the
+// annotated ports are exposed. A port used by several containers is only exposed once per protocol.
+func getExposedPorts(pod *v1.Pod, containers []*azaciv2.Container, annotatedOnly bool) ([]*azaciv2.Port, error) {
+	type portKey struct {
+		port     int32
+		protocol azaciv2.ContainerNetworkProtocol
+	}
+	// containerPorts is the protocol of the first container port of each port number
+	containerPorts := map[int32]azaciv2.ContainerNetworkProtocol{}
+	var all []portKey
+	for _, container := range containers {
+		for _, port := range container.Properties.Ports {
+			protocol := azaciv2.ContainerNetworkProtocolTCP
+			if port.Protocol != nil {
+				protocol = *port.Protocol
+			}
+			if _, ok := containerPorts[*port.Port]; !ok {
+				containerPorts[*port.Port] = protocol
+			}
+			all = append(all, portKey{port: *port.Port, protocol: protocol})
+		}
+	}
+
+	exposed := all
+	if value := pod.Annotations[publicPortsAnnotation]; value != "" {
+		exposed = nil
+		for _, field := range strings.Split(value, ",") {
+			portValue, protocolValue, _ := strings.Cut(strings.TrimSpace(field), "/")
+			port, err := strconv.ParseInt(portValue, 10, 32)
+			if err != nil {
+				return nil, errdefs.InvalidInputf("invalid port %q in %s annotation of pod %s/%s", field, publicPortsAnnotation, pod.Namespace, pod.Name)
+			}
+			protocol, ok := containerPorts[int32(port)]
+			if !ok {
+				return nil, errdefs.InvalidInputf("port %d in %s annotation of pod %s/%s is not a container port", port, publicPortsAnnotation, pod.Namespace, pod.Name)
+			}
+			if protocolValue != "" {
+				protocol = *util.GetProtocol(v1.Protocol(strings.ToUpper(protocolValue)))
+			}
+			exposed = append(exposed, portKey{port: int32(port), protocol: protocol})
+		}
+	} else if annotatedOnly {
+		return nil, nil
+	}
+
+	seen := map[portKey]bool{}
+	ports := make([]*azaciv2.Port, 0, len(exposed))
+	for _, key := range exposed {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ports = append(ports, newPublicPort(key.port, key.protocol))
+	}
+	return ports, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestGetExposedPorts(t *testing.T) {
+	tcp, udp := azaciv2.ContainerNetworkProtocolTCP, azaciv2.ContainerNetworkProtocolUDP
+	port80, port53, port9090 := int32(80), int32(53), int32(9090)
+	containers := []*azaciv2.Container{
+		{Properties: &azaciv2.ContainerProperties{Ports: []*azaciv2.ContainerPort{
+			{Port: &port80, Protocol: &tcp},
+			{Port: &port53, Protocol: &udp},
+		}}},
+		// the sidecar shares the port of the main container
+		{Properties: &azaciv2.ContainerProperties{Ports: []*azaciv2.ContainerPort{
+			{Port: &port80},
+			{Port: &port53, Protocol: &tcp},
+			{Port: &port9090},
+		}}},
+	}
+
+	cases := []struct {
+		description   string
+		annotations   map[string]string
+		annotatedOnly bool
+		expectedPorts []string
+	}{
+		{
+			description:   "all container ports",
+			expectedPorts: []string{"80/TCP", "53/UDP", "53/TCP", "9090/TCP"},
+		},
+		{
+			description:   "annotated ports",
+			annotations:   map[string]string{publicPortsAnnotation: "80,80/tcp,9090"},
+			expectedPorts: []string{"80/TCP", "9090/TCP"},
+		},
+		{
+			description:   "only annotated ports without annotation",
+			annotatedOnly: true,
+			expectedPorts: []string{},
+		},
+		{
+			description:   "only annotated ports",
+			annotations:   map[string]string{publicPortsAnnotation: "53/udp"},
+			annotatedOnly: true,
+			expectedPorts: []string{"53/UDP"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Annotations = tc.annotations
+
+			exposed, err := getExposedPorts(pod, containers, tc.annotatedOnly)
+			assert.NilError(t, err)
+			ports := make([]string, 0, len(exposed))
+			for _, port := range exposed {
+				ports = append(ports, fmt.Sprintf("%d/%s", *port.Port, *port.Protocol))
+			}
+			assert.Check(t, is.DeepEqual(tc.expectedPorts, ports))
+		})
+	}
+}
+
+func TestValidatePortExposurePolicy(t *testing.T) {
+	assert.Check(t, validatePortExposurePolicy(""))
+	assert.Check(t, validatePortExposurePolicy(portExposurePolicyAnnotated))
+	assert.Check(t, is.ErrorContains(validatePortExposurePolicy("Some"), "not a valid port exposure policy"))
+}
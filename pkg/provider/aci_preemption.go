@@ -0,0 +1,215 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// podStatusReasonPreempted is the reason of the pods whose container group was deleted to free ACI quota for
+	// a pod with a higher priority, and of the events emitted on them.
+	podStatusReasonPreempted = "Preempted"
+	// eventReasonPreempting is the reason of the event emitted on the pods preempting others.
+	eventReasonPreempting = "Preempting"
+)
+
+// preemptionVictim is a pod which may be preempted, with the ACI cores its container group accounts for.
+type preemptionVictim struct {
+	pod   *v1.Pod
+	cores int32
+}
+
+// preemptForQuota deletes the container groups of pods with a lower priority than a pod which doesn't fit in the
+// ACI quota of a region, when preemption is enabled. Like the scheduler, it preempts the pods with the lowest
+// priority first, and the most recently started ones among them, until their container groups and cores cover
+// the shortage of the quota. The pod is created by the retry of its creation once the quota is freed, and the
+// preempted pods are failed so that their controllers replace them.
+func (p *ACIProvider) preemptForQuota(ctx context.Context, pod *v1.Pod, region string, err error, dryRun bool) {
+	var qErr *quotaError
+	if dryRun || !errors.As(err, &qErr) || !p.isPreemptionEnabled() {
+		return
+	}
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == v1.PreemptNever {
+		return
+	}
+
+	ctx, span := trace.StartSpan(ctx, "aci.preemptForQuota")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	victims, err := p.getPreemptionVictims(ctx, pod, region, qErr)
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("pod %s/%s can't preempt lower priority pods", pod.Namespace, pod.Name)
+		return
+	}
+
+	names := make([]string, 0, len(victims))
+	for _, victim := range victims {
+		if err := p.preemptPod(ctx, victim.pod, pod, region); err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to preempt pod %s/%s", victim.pod.Namespace, victim.pod.Name)
+			continue
+		}
+		names = append(names, victim.pod.Namespace+"/"+victim.pod.Name)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	if checker := p.capacityCheckers[region]; checker != nil {
+		checker.invalidateUsage()
+	}
+	if p.eventRecorder != nil {
+		p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonPreempting,
+			"preempted %s to free ACI quota in region %s", strings.Join(names, ", "), region)
+	}
+}
+
+// isPreemptionEnabled returns whether the pods may preempt the pods with a lower priority.
+func (p *ACIProvider) isPreemptionEnabled() bool {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+	return p.preemptLowerPriorityPods
+}
+
+// getPreemptionVictims returns the pods to preempt to cover the quota shortage of a pod in a region, or an error
+// when the pods with a lower priority don't cover it.
+func (p *ACIProvider) getPreemptionVictims(ctx context.Context, pod *v1.Pod, region string, shortage *quotaError) ([]preemptionVictim, error) {
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	priority := getPodPriority(pod)
+	var candidates []*v1.Pod
+	for _, candidate := range pods {
+		if (candidate.Namespace == pod.Namespace && candidate.Name == pod.Name) || candidate.DeletionTimestamp != nil ||
+			!isActivePod(candidate) || candidate.Status.Reason == podStatusReasonProviderFailed ||
+			getPodPriority(candidate) >= priority {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if pi, pj := getPodPriority(candidates[i]), getPodPriority(candidates[j]); pi != pj {
+			return pi < pj
+		}
+		return getPodStartTime(candidates[i]).After(getPodStartTime(candidates[j]))
+	})
+
+	var victims []preemptionVictim
+	var containerGroups, cores int32
+	for _, candidate := range candidates {
+		if containerGroups >= shortage.containerGroups && cores >= shortage.cores {
+			break
+		}
+		// the pods of the other regions don't hold the quota of the region
+		if len(p.regions) > 1 {
+			cg, err := p.azClientsAPIs.GetContainerGroupInfo(ctx, p.getResourceGroup(candidate.Namespace), candidate.Namespace, candidate.Name, p.nodeName)
+			if err != nil || cg.Location == nil || !strings.EqualFold(*cg.Location, region) {
+				continue
+			}
+		}
+		victim := preemptionVictim{pod: candidate, cores: getPodCores(candidate, p.getAccountedResourcePolicy(candidate))}
+		victims = append(victims, victim)
+		containerGroups++
+		cores += victim.cores
+	}
+	if len(victims) == 0 || containerGroups < shortage.containerGroups || cores < shortage.cores {
+		return nil, fmt.Errorf("the pods with a priority lower than %d don't hold enough ACI quota in region %s", priority, region)
+	}
+	return victims, nil
+}
+
+// preemptPod deletes the container group of a pod and reports the pod as failed. The deletion is waited for, so
+// that the quota is freed once it returns.
+func (p *ACIProvider) preemptPod(ctx context.Context, victim, preemptor *v1.Pod, region string) error {
+	message := fmt.Sprintf("preempted by pod %s/%s with priority %d to free ACI quota in region %s",
+		preemptor.Namespace, preemptor.Name, getPodPriority(preemptor), region)
+	p.announceDisruption(ctx, victim, "deleting the container group: "+message)
+	p.archivePodLogsBeforeDeletion(ctx, victim)
+	release, err := p.deleteQueue.acquire(ctx, victim.Namespace, getPodPriority(victim))
+	if err != nil {
+		return err
+	}
+	err = p.deletePodContainerGroup(ctx, victim, true)
+	release()
+	if err != nil {
+		return err
+	}
+	p.forgetPod(victim.Namespace, victim.Name)
+
+	log.G(ctx).Infof("pod %s/%s %s", victim.Namespace, victim.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(victim, v1.EventTypeNormal, podStatusReasonPreempted, message)
+	}
+	if p.tracker == nil {
+		return nil
+	}
+
+	updateErr := p.tracker.UpdatePodStatus(ctx, victim.Namespace, victim.Name, func(podStatus *v1.PodStatus) {
+		podStatus.Phase = v1.PodFailed
+		podStatus.Reason = podStatusReasonPreempted
+		podStatus.Message = message
+		setPodCondition(podStatus, getDisruptionCondition("deleting the container group: "+message))
+		now := metav1.NewTime(time.Now())
+		for i := range podStatus.ContainerStatuses {
+			if podStatus.ContainerStatuses[i].State.Running == nil {
+				continue
+			}
+			podStatus.ContainerStatuses[i].State.Terminated = &v1.ContainerStateTerminated{
+				ExitCode:    containerExitCodePodDeleted,
+				Reason:      podStatusReasonPreempted,
+				Message:     message,
+				FinishedAt:  now,
+				StartedAt:   podStatus.ContainerStatuses[i].State.Running.StartedAt,
+				ContainerID: podStatus.ContainerStatuses[i].ContainerID,
+			}
+			podStatus.ContainerStatuses[i].State.Running = nil
+		}
+	}, false)
+	if updateErr != nil && !errdefs.IsNotFound(updateErr) {
+		log.G(ctx).WithError(updateErr).Errorf("failed to report pod %s/%s as preempted", victim.Namespace, victim.Name)
+	}
+	return nil
+}
+
+// getPodPriority returns the priority of a pod, resolved from its priority class by the admission of the API server.
+func getPodPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+func getPodStartTime(pod *v1.Pod) time.Time {
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// getPodCores returns the ACI cores the container group of a pod accounts for.
+func getPodCores(pod *v1.Pod, policy resourcePolicy) int32 {
+	var cpu float64
+	for i := range pod.Spec.Containers {
+		resources, _ := policy.getContainerResources(&pod.Spec.Containers[i])
+		cpu += *resources.Requests.CPU
+	}
+	return int32(math.Ceil(cpu))
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPreemptForQuota(t *testing.T) {
+	priority := func(value int32) *int32 {
+		return &value
+	}
+	preemptNever := v1.PreemptNever
+
+	cases := []struct {
+		description      string
+		disabled         bool
+		preemptionPolicy *v1.PreemptionPolicy
+		shortage         *quotaError
+		expectedVictims  []string
+	}{
+		{
+			description:     "lowest priority and most recent pods first",
+			shortage:        &quotaError{error: errors.New("quota exhausted"), cores: 2},
+			expectedVictims: []string{"low-recent", "low-old"},
+		},
+		{
+			description:     "container group shortage",
+			shortage:        &quotaError{error: errors.New("quota exhausted"), containerGroups: 1},
+			expectedVictims: []string{"low-recent"},
+		},
+		{
+			description: "lower priority pods don't cover the shortage",
+			shortage:    &quotaError{error: errors.New("quota exhausted"), cores: 8},
+		},
+		{
+			description: "preemption disabled",
+			disabled:    true,
+			shortage:    &quotaError{error: errors.New("quota exhausted"), cores: 1},
+		},
+		{
+			description:      "pod never preempting",
+			preemptionPolicy: &preemptNever,
+			shortage:         &quotaError{error: errors.New("quota exhausted"), cores: 1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			now := time.Now()
+			pods := testsutil.CreatePodsList([]string{"low-old", "low-recent", "medium", "high"}, "ns")
+			for i, pod := range pods {
+				pod.Status.Phase = v1.PodRunning
+				pod.Status.StartTime = &metav1.Time{Time: now.Add(time.Duration(i) * time.Minute)}
+				pod.Spec.Containers = []v1.Container{{
+					Name: "c",
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+					},
+				}}
+			}
+			pods[2].Spec.Priority = priority(100)
+			pods[2].Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("4")
+			pod := pods[3]
+			pod.Spec.Priority = priority(100)
+			pod.Spec.PreemptionPolicy = tc.preemptionPolicy
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+			var provider *ACIProvider
+			var deleted []string
+			aciMocks := createNewACIMock()
+			aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+				assert.Check(t, is.Equal(1, provider.deleteQueue.inFlight), "the deletions are expected to hold the delete queue")
+				deleted = append(deleted, cgName)
+				return nil
+			}
+
+			provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+				NewMockSecretLister(mockCtrl), podLister)
+			assert.NilError(t, err)
+			provider.deleteQueue = newOperationQueue(1)
+			provider.privateIPs.assigned["ns/low-recent"] = "10.1.0.10"
+			provider.preemptLowerPriorityPods = !tc.disabled
+			recorder := record.NewFakeRecorder(10)
+			provider.SetEventRecorder(recorder)
+			preempted := map[string]string{}
+			disrupted := map[string]bool{}
+			provider.tracker = &PodsTracker{
+				pods: podLister,
+				updateCb: func(p *v1.Pod) {
+					preempted[p.Name] = p.Status.Reason
+					disrupted[p.Name] = findPodCondition(p.Status.Conditions, v1.DisruptionTarget) != nil
+				},
+			}
+
+			provider.preemptForQuota(context.Background(), pod, fakeRegion, tc.shortage, false)
+			var expectedDeleted []string
+			for _, name := range tc.expectedVictims {
+				expectedDeleted = append(expectedDeleted, containerGroupName("ns", name))
+				assert.Check(t, is.Equal(podStatusReasonPreempted, preempted[name]))
+				assert.Check(t, disrupted[name])
+			}
+			assert.Check(t, is.DeepEqual(expectedDeleted, deleted))
+			// the private IP address of a preempted pod is released with its container group
+			assert.Check(t, is.Equal(len(tc.expectedVictims) == 0, provider.privateIPs.isAssigned("ns/low-recent")))
+			if len(tc.expectedVictims) > 0 {
+				// two events on each victim, announcing and reporting the preemption, and one on the preempting pod
+				assert.Check(t, is.Len(recorder.Events, 2*len(tc.expectedVictims)+1))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// priorityAnnotation selects the priority of the container group of a pod, Regular or Spot.
+	priorityAnnotation = "virtual-kubelet.io/priority"
+	// scaleSetPriorityLabel is the label of the spot node pools of AKS, which pods select to run on spot capacity.
+	scaleSetPriorityLabel = "kubernetes.azure.com/scalesetpriority"
+	scaleSetPrioritySpot  = "spot"
+)
+
+// getContainerGroupPriority returns the priority requested for the container group of a pod, or nil for the ACI
+// default. The annotation takes precedence over the scale set priority nodeSelector, which takes precedence over the
+// required node affinity. As the scheduler matches them against the labels of the virtual node, the node must be
+// labeled with the scale set priority, see NodeLabels.
+func getContainerGroupPriority(pod *v1.Pod) (*azaciv2.ContainerGroupPriority, error) {
+	if value, ok := pod.Annotations[priorityAnnotation]; ok {
+		for _, priority := range azaciv2.PossibleContainerGroupPriorityValues() {
+			if strings.EqualFold(value, string(priority)) {
+				return &priority, nil
+			}
+		}
+		return nil, errdefs.InvalidInputf("invalid %s annotation %q of pod %s/%s, expected %s or %s", priorityAnnotation, value,
+			pod.Namespace, pod.Name, azaciv2.ContainerGroupPriorityRegular, azaciv2.ContainerGroupPrioritySpot)
+	}
+
+	if value, ok := pod.Spec.NodeSelector[scaleSetPriorityLabel]; ok {
+		return getScaleSetPriority([]string{value}), nil
+	}
+	return getScaleSetPriority(getAffinityScaleSetPriorities(pod.Spec.Affinity)), nil
+}
+
+// getScaleSetPriority returns the Spot priority when all the scale set priorities a pod accepts are spot.
+func getScaleSetPriority(values []string) *azaciv2.ContainerGroupPriority {
+	if len(values) == 0 {
+		return nil
+	}
+	for _, value := range values {
+		if !strings.EqualFold(value, scaleSetPrioritySpot) {
+			return nil
+		}
+	}
+	priority := azaciv2.ContainerGroupPrioritySpot
+	return &priority
+}
+
+// getAffinityScaleSetPriorities returns the scale set priorities of the In expressions of the required node
+// affinity. Node selector terms are ORed, so the priorities of all the terms are merged, and a term without a scale
+// set priority accepts any.
+func getAffinityScaleSetPriorities(affinity *v1.Affinity) []string {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+
+	var priorities []string
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		found := false
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == scaleSetPriorityLabel && expr.Operator == v1.NodeSelectorOpIn {
+				priorities = append(priorities, expr.Values...)
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return priorities
+}
@@ -0,0 +1,102 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetContainerGroupPriority(t *testing.T) {
+	spotAffinity := func(values ...string) *v1.Affinity {
+		return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{
+					{MatchExpressions: []v1.NodeSelectorRequirement{{Key: scaleSetPriorityLabel, Operator: v1.NodeSelectorOpIn, Values: values}}},
+				},
+			},
+		}}
+	}
+
+	cases := []struct {
+		description      string
+		prepPod          func(pod *v1.Pod)
+		expectedPriority string
+		expectedError    bool
+	}{
+		{
+			description: "pod without priority",
+			prepPod:     func(pod *v1.Pod) {},
+		},
+		{
+			description: "pod with priority annotation",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{priorityAnnotation: "spot"}
+				pod.Spec.NodeSelector = map[string]string{scaleSetPriorityLabel: "regular"}
+			},
+			expectedPriority: string(azaciv2.ContainerGroupPrioritySpot),
+		},
+		{
+			description: "pod with invalid priority annotation",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{priorityAnnotation: "low"}
+			},
+			expectedError: true,
+		},
+		{
+			description: "pod with spot nodeSelector",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.NodeSelector = map[string]string{scaleSetPriorityLabel: scaleSetPrioritySpot}
+			},
+			expectedPriority: string(azaciv2.ContainerGroupPrioritySpot),
+		},
+		{
+			description: "pod with spot node affinity",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.Affinity = spotAffinity(scaleSetPrioritySpot)
+			},
+			expectedPriority: string(azaciv2.ContainerGroupPrioritySpot),
+		},
+		{
+			description: "pod accepting spot and regular nodes",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.Affinity = spotAffinity(scaleSetPrioritySpot, "regular")
+			},
+		},
+		{
+			description: "pod with a node selector term accepting any priority",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.Affinity = spotAffinity(scaleSetPrioritySpot)
+				terms := &pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+				*terms = append(*terms, v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpExists}}})
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			tc.prepPod(pod)
+
+			priority, err := getContainerGroupPriority(pod)
+			if tc.expectedError {
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				return
+			}
+			assert.NilError(t, err)
+			if tc.expectedPriority == "" {
+				assert.Check(t, is.Nil(priority))
+				return
+			}
+			assert.Assert(t, priority != nil)
+			assert.Check(t, is.Equal(tc.expectedPriority, string(*priority)))
+		})
+	}
+}
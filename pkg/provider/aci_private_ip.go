@@ -0,0 +1,265 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// privateIPAnnotation requests a specific private IP address of the subnet for the container group of a pod,
+	// e.g. for allow lists of downstream firewalls.
+	privateIPAnnotation = "virtual-kubelet.io/private-ip"
+	// privateIPPoolAnnotation requests a free private IP address of one of the PrivateIPPools of the provider.
+	privateIPPoolAnnotation = "virtual-kubelet.io/private-ip-pool"
+
+	// maxPrivateIPPoolSize bounds the addresses of a private IP pool, as they are scanned for each allocation.
+	maxPrivateIPPoolSize = 4096
+)
+
+// privateIPPoolConfig is a named pool of private IP addresses of the subnets of the provider, each address being
+// either an IPv4 address or a range of addresses like 10.1.0.10-10.1.0.20.
+type privateIPPoolConfig struct {
+	Name      string
+	Addresses []string
+}
+
+// parsePrivateIPPools validates the private IP pools of the config file, and returns their addresses by name.
+func parsePrivateIPPools(configs []privateIPPoolConfig) (map[string][]string, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	pools := make(map[string][]string, len(configs))
+	for _, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("private IP pools must have a name")
+		}
+		if _, ok := pools[config.Name]; ok {
+			return nil, fmt.Errorf("private IP pool %s is defined twice", config.Name)
+		}
+		var addresses []string
+		seen := make(map[string]bool)
+		for _, address := range config.Addresses {
+			ips, err := parsePrivateIPRange(address)
+			if err != nil {
+				return nil, fmt.Errorf("private IP pool %s: %v", config.Name, err)
+			}
+			for _, ip := range ips {
+				if !seen[ip] {
+					seen[ip] = true
+					addresses = append(addresses, ip)
+				}
+			}
+			if len(addresses) > maxPrivateIPPoolSize {
+				return nil, fmt.Errorf("private IP pool %s has more than %d addresses", config.Name, maxPrivateIPPoolSize)
+			}
+		}
+		if len(addresses) == 0 {
+			return nil, fmt.Errorf("private IP pool %s has no addresses", config.Name)
+		}
+		pools[config.Name] = addresses
+	}
+	return pools, nil
+}
+
+// parsePrivateIPRange returns the IPv4 addresses of an address or a range of addresses.
+func parsePrivateIPRange(value string) ([]string, error) {
+	first, last, isRange := strings.Cut(value, "-")
+	start := net.ParseIP(strings.TrimSpace(first)).To4()
+	end := start
+	if isRange {
+		end = net.ParseIP(strings.TrimSpace(last)).To4()
+	}
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("%q is not an IPv4 address or range of addresses", value)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, fmt.Errorf("the range %q ends before it starts", value)
+	}
+
+	var ips []string
+	for ip := append(net.IP{}, start...); bytes.Compare(ip, end) <= 0; ip = nextIP(ip) {
+		ips = append(ips, ip.String())
+		if len(ips) > maxPrivateIPPoolSize {
+			return nil, fmt.Errorf("the range %q has more than %d addresses", value, maxPrivateIPPoolSize)
+		}
+		if ip.Equal(net.IPv4bcast) {
+			break
+		}
+	}
+	return ips, nil
+}
+
+// nextIP returns the IPv4 address following an address.
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// privateIPAllocator tracks the private IP addresses assigned to the pods of the node with the private IP
+// annotations, until their deletion.
+type privateIPAllocator struct {
+	lock     sync.Mutex
+	assigned map[string]string
+}
+
+func newPrivateIPAllocator() *privateIPAllocator {
+	return &privateIPAllocator{assigned: make(map[string]string)}
+}
+
+func (a *privateIPAllocator) release(podKey string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.assigned, podKey)
+}
+
+func (a *privateIPAllocator) isAssigned(podKey string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, ok := a.assigned[podKey]
+	return ok
+}
+
+// hasPrivateIP returns whether a pod requests a private IP address with the private IP annotations.
+func hasPrivateIP(pod *v1.Pod) bool {
+	_, hasIP := pod.Annotations[privateIPAnnotation]
+	_, hasPool := pod.Annotations[privateIPPoolAnnotation]
+	return hasIP || hasPool
+}
+
+// getPrivateIPsInUse returns the private IP addresses of the active pods of the node other than a pod, from their
+// status or their annotation, by address.
+func (p *ACIProvider) getPrivateIPsInUse(pod *v1.Pod) (map[string]string, error) {
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]string, len(pods))
+	for _, other := range pods {
+		if (other.Namespace == pod.Namespace && other.Name == pod.Name) || !isActivePod(other) {
+			continue
+		}
+		key := other.Namespace + "/" + other.Name
+		if ip := other.Annotations[privateIPAnnotation]; ip != "" {
+			inUse[ip] = key
+		}
+		if other.Status.PodIP != "" {
+			inUse[other.Status.PodIP] = key
+		}
+	}
+	return inUse, nil
+}
+
+// getPodPrivateIP returns the private IP address requested by a pod with the private IP annotations, assigning it
+// a free address of its pool, and "" for the other pods. A pod keeps its address until its deletion, so that the
+// retries and the in place updates of its container group get the same address.
+func (p *ACIProvider) getPodPrivateIP(pod *v1.Pod) (string, error) {
+	requested, hasIP := pod.Annotations[privateIPAnnotation]
+	poolName, hasPool := pod.Annotations[privateIPPoolAnnotation]
+	switch {
+	case !hasIP && !hasPool:
+		return "", nil
+	case hasIP && hasPool:
+		return "", errdefs.InvalidInputf("pod %s can't have both the %s and %s annotations", pod.Name, privateIPAnnotation, privateIPPoolAnnotation)
+	case p.providernetwork.SubnetName == "":
+		return "", errdefs.InvalidInputf("pod %s requests a private IP address but the virtual node is not configured with a virtual network", pod.Name)
+	}
+
+	var candidates []string
+	if hasIP {
+		ip := net.ParseIP(requested).To4()
+		if ip == nil {
+			return "", errdefs.InvalidInputf("the value %q of annotation %s is not an IPv4 address", requested, privateIPAnnotation)
+		}
+		if err := p.checkSubnetIP(pod, ip); err != nil {
+			return "", err
+		}
+		candidates = []string{ip.String()}
+	} else {
+		pool, ok := p.privateIPPools[poolName]
+		if !ok {
+			return "", errdefs.InvalidInputf("pod %s requests an address of the private IP pool %s, which doesn't exist", pod.Name, poolName)
+		}
+		candidates = pool
+	}
+
+	inUse, err := p.getPrivateIPsInUse(pod)
+	if err != nil {
+		return "", err
+	}
+
+	podKey := pod.Namespace + "/" + pod.Name
+	p.privateIPs.lock.Lock()
+	defer p.privateIPs.lock.Unlock()
+	for key, ip := range p.privateIPs.assigned {
+		if key != podKey {
+			inUse[ip] = key
+		}
+	}
+
+	preferred := []string{p.privateIPs.assigned[podKey], pod.Status.PodIP}
+	for _, ip := range append(preferred, candidates...) {
+		if ip == "" || !containsString(candidates, ip) {
+			continue
+		}
+		if _, used := inUse[ip]; !used {
+			p.privateIPs.assigned[podKey] = ip
+			return ip, nil
+		}
+	}
+	if hasIP {
+		return "", fmt.Errorf("the private IP address %s requested by pod %s is used by pod %s", requested, pod.Name, inUse[candidates[0]])
+	}
+	return "", fmt.Errorf("the private IP pool %s requested by pod %s has no free address", poolName, pod.Name)
+}
+
+// checkSubnetIP verifies that an address requested by a pod is in the subnet of the pod, when its range is known.
+func (p *ACIProvider) checkSubnetIP(pod *v1.Pod, ip net.IP) error {
+	if p.providernetwork.GetPodSubnet(pod) != p.providernetwork.SubnetName || p.providernetwork.SubnetCIDR == "" {
+		return nil
+	}
+	_, subnet, err := net.ParseCIDR(p.providernetwork.SubnetCIDR)
+	if err != nil || subnet.Contains(ip) {
+		return nil
+	}
+	return errdefs.InvalidInputf("the private IP address %s requested by pod %s is not in the subnet %s (%s)",
+		ip, pod.Name, p.providernetwork.SubnetName, p.providernetwork.SubnetCIDR)
+}
+
+// setPrivateIPAddress sets the private IP address requested by a pod on its container group, see getPodPrivateIP.
+func (p *ACIProvider) setPrivateIPAddress(pod *v1.Pod, cg *azaciv2.ContainerGroup, ports []*azaciv2.Port, publicIP bool) error {
+	_, hasIP := pod.Annotations[privateIPAnnotation]
+	_, hasPool := pod.Annotations[privateIPPoolAnnotation]
+	if publicIP && (hasIP || hasPool) {
+		return errdefs.InvalidInputf("pod %s can't request both a public IP address and a private IP address", pod.Name)
+	}
+	ip, err := p.getPodPrivateIP(pod)
+	if err != nil || ip == "" {
+		return err
+	}
+	privateType := azaciv2.ContainerGroupIPAddressTypePrivate
+	cg.Properties.IPAddress = &azaciv2.IPAddress{
+		Type:  &privateType,
+		IP:    &ip,
+		Ports: ports,
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/virtual-kubelet/azure-aci/pkg/network"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParsePrivateIPPools(t *testing.T) {
+	pools, err := parsePrivateIPPools([]privateIPPoolConfig{
+		{Name: "egress", Addresses: []string{"10.1.0.254-10.1.1.1", "10.1.0.255", "10.1.2.10"}},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string][]string{
+		"egress": {"10.1.0.254", "10.1.0.255", "10.1.1.0", "10.1.1.1", "10.1.2.10"},
+	}, pools))
+
+	for _, configs := range [][]privateIPPoolConfig{
+		{{Addresses: []string{"10.1.0.10"}}},
+		{{Name: "egress"}},
+		{{Name: "egress", Addresses: []string{"10.1.0.10"}}, {Name: "egress", Addresses: []string{"10.1.0.11"}}},
+		{{Name: "egress", Addresses: []string{"10.1.0.0/24"}}},
+		{{Name: "egress", Addresses: []string{"fd00::10"}}},
+		{{Name: "egress", Addresses: []string{"10.1.0.20-10.1.0.10"}}},
+		{{Name: "egress", Addresses: []string{"10.0.0.0-10.1.0.0"}}},
+	} {
+		_, err := parsePrivateIPPools(configs)
+		assert.Check(t, err != nil, "%v", configs)
+	}
+}
+
+func TestGetPodPrivateIP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	running := testsutil.CreatePodObj("running", "ns")
+	running.Status.Phase = v1.PodRunning
+	running.Status.PodIP = "10.1.0.10"
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{running}, nil).AnyTimes()
+
+	p := ACIProvider{
+		podsL:           podLister,
+		providernetwork: network.ProviderNetwork{SubnetName: "subnet", SubnetCIDR: "10.1.0.0/24"},
+		privateIPPools:  map[string][]string{"egress": {"10.1.0.10", "10.1.0.11"}},
+		privateIPs:      newPrivateIPAllocator(),
+	}
+	newPod := func(name, annotation, value string) *v1.Pod {
+		pod := testsutil.CreatePodObj(name, "ns")
+		pod.Annotations = map[string]string{annotation: value}
+		return pod
+	}
+
+	// the pods get the free addresses of their pool, and keep them until their deletion
+	ip, err := p.getPodPrivateIP(newPod("a", privateIPPoolAnnotation, "egress"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("10.1.0.11", ip))
+	ip, err = p.getPodPrivateIP(newPod("a", privateIPPoolAnnotation, "egress"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("10.1.0.11", ip))
+	_, err = p.getPodPrivateIP(newPod("b", privateIPPoolAnnotation, "egress"))
+	assert.Check(t, is.ErrorContains(err, "has no free address"))
+	p.privateIPs.release("ns/a")
+	ip, err = p.getPodPrivateIP(newPod("b", privateIPPoolAnnotation, "egress"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("10.1.0.11", ip))
+
+	ip, err = p.getPodPrivateIP(newPod("c", privateIPAnnotation, "10.1.0.100"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("10.1.0.100", ip))
+	_, err = p.getPodPrivateIP(newPod("d", privateIPAnnotation, "10.1.0.10"))
+	assert.Check(t, is.ErrorContains(err, "is used by pod ns/running"))
+	_, err = p.getPodPrivateIP(newPod("d", privateIPAnnotation, "10.2.0.10"))
+	assert.Check(t, is.ErrorContains(err, "is not in the subnet"))
+	_, err = p.getPodPrivateIP(newPod("d", privateIPPoolAnnotation, "ingress"))
+	assert.Check(t, is.ErrorContains(err, "which doesn't exist"))
+
+	// the pods without private IP annotations are left alone
+	ip, err = p.getPodPrivateIP(testsutil.CreatePodObj("e", "ns"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("", ip))
+
+	p.providernetwork = network.ProviderNetwork{}
+	_, err = p.getPodPrivateIP(newPod("d", privateIPAnnotation, "10.1.0.12"))
+	assert.Check(t, is.ErrorContains(err, "not configured with a virtual network"))
+}
+
+func TestSetPrivateIPAddress(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(nil, nil).AnyTimes()
+	p := ACIProvider{
+		podsL:           podLister,
+		providernetwork: network.ProviderNetwork{SubnetName: "subnet"},
+		privateIPs:      newPrivateIPAllocator(),
+	}
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Annotations = map[string]string{privateIPAnnotation: "10.1.0.10"}
+	port := int32(80)
+	ports := []*azaciv2.Port{{Port: &port}}
+
+	cg := &azaciv2.ContainerGroup{Properties: &azaciv2.ContainerGroupPropertiesProperties{}}
+	assert.NilError(t, p.setPrivateIPAddress(pod, cg, ports, false))
+	assert.Assert(t, cg.Properties.IPAddress != nil)
+	assert.Check(t, is.Equal(azaciv2.ContainerGroupIPAddressTypePrivate, *cg.Properties.IPAddress.Type))
+	assert.Check(t, is.Equal("10.1.0.10", *cg.Properties.IPAddress.IP))
+	assert.Check(t, is.Len(cg.Properties.IPAddress.Ports, 1))
+
+	err := p.setPrivateIPAddress(pod, cg, ports, true)
+	assert.Check(t, is.ErrorContains(err, "both a public IP address and a private IP address"))
+	pod.Annotations[privateIPPoolAnnotation] = "egress"
+	err = p.setPrivateIPAddress(pod, cg, ports, false)
+	assert.Check(t, is.ErrorContains(err, "can't have both"))
+}
+
+func TestDeletePodReleasesPrivateIP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(nil, nil).AnyTimes()
+	deleteErr := errors.New("conflict")
+	aciMocks := createNewACIMock()
+	// the container group is still there after the deletion returned, until it is waited for
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		return deleteErr
+	}
+	p, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	p.providernetwork = network.ProviderNetwork{SubnetName: "subnet", SubnetCIDR: "10.1.0.0/24"}
+	p.privateIPPools = map[string][]string{"egress": {"10.1.0.10"}}
+
+	newPod := func(name string) *v1.Pod {
+		pod := testsutil.CreatePodObj(name, "ns")
+		pod.Annotations = map[string]string{privateIPPoolAnnotation: "egress"}
+		return pod
+	}
+	_, err = p.getPodPrivateIP(newPod("a"))
+	assert.NilError(t, err)
+
+	// the address is held until the container group is deleted
+	assert.Check(t, is.ErrorContains(p.DeletePod(context.Background(), newPod("a")), "conflict"))
+	_, err = p.getPodPrivateIP(newPod("b"))
+	assert.Check(t, is.ErrorContains(err, "has no free address"))
+
+	deleteErr = nil
+	assert.NilError(t, p.DeletePod(context.Background(), newPod("a")))
+	ip, err := p.getPodPrivateIP(newPod("b"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("10.1.0.10", ip))
+}
+
+func TestExpiredPodReleasesPrivateIPOnceDeleted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(nil, nil).AnyTimes()
+	deleted := false
+	aciMocks := createNewACIMock()
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		t.Error("the deletion of a container group holding a private IP address is expected to be waited for")
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = true
+		return nil
+	}
+	p, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	p.providernetwork = network.ProviderNetwork{SubnetName: "subnet", SubnetCIDR: "10.1.0.0/24"}
+	p.privateIPPools = map[string][]string{"egress": {"10.1.0.10"}}
+
+	pod := testsutil.CreatePodObj("a", "ns")
+	pod.Annotations = map[string]string{privateIPPoolAnnotation: "egress"}
+	_, err = p.getPodPrivateIP(pod)
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.stopExpiredPod(context.Background(), pod, time.Minute))
+	assert.Check(t, deleted)
+	assert.Check(t, !p.privateIPs.isAssigned("ns/a"))
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// podConditionACIProvisioning reports the provisioning state of the container group of a pod until it succeeded.
+	podConditionACIProvisioning v1.PodConditionType = "AciProvisioning"
+
+	eventReasonProvisioning = "ContainerGroupProvisioning"
+
+	provisioningStateAccepted  = "Accepted"
+	provisioningStateSucceeded = "Succeeded"
+)
+
+// isProvisioning returns whether ACI is still provisioning a container group in the provisioning state.
+func isProvisioning(state string) bool {
+	switch state {
+	case provisioningStateAccepted, "Pending", "Creating", "Repairing", "Updating":
+		return true
+	}
+	return false
+}
+
+func getProvisioningState(cg *azaciv2.ContainerGroup) string {
+	if cg == nil || cg.Properties == nil {
+		return ""
+	}
+	return stringValue(cg.Properties.ProvisioningState)
+}
+
+// startProvisioning records the ARM operation creating the container group of a pod, emits an event with its ID
+// and reports the pod as provisioning until the status of its container group is available.
+func (p *ACIProvider) startProvisioning(ctx context.Context, pod *v1.Pod, region, operationID string) {
+	if operationID != "" {
+		p.provisioningOperations.Store(pod.Namespace+"/"+pod.Name, operationID)
+	}
+	created := pod.CreationTimestamp.Time
+	if created.IsZero() {
+		created = time.Now()
+	}
+	p.burstMetrics.startCreation(pod.Namespace, pod.Name, created)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonProvisioning,
+			"ARM operation %s is creating the container group in region %s", operationID, region)
+	}
+	if p.tracker == nil {
+		return
+	}
+
+	err := p.tracker.UpdatePodStatus(ctx, pod.Namespace, pod.Name, func(podStatus *v1.PodStatus) {
+		setPodCondition(podStatus, p.getProvisioningCondition(pod.Namespace, pod.Name, provisioningStateAccepted))
+	}, false)
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.G(ctx).WithError(err).Warnf("failed to report the provisioning of pod %s/%s", pod.Namespace, pod.Name)
+	}
+}
+
+// getProvisioningCondition returns the provisioning condition of a pod, with the ID of the ARM operation creating
+// its container group when it is known. The operation is forgotten once the provisioning completed.
+func (p *ACIProvider) getProvisioningCondition(namespace, name, state string) v1.PodCondition {
+	key := namespace + "/" + name
+	condition := v1.PodCondition{
+		Type:               podConditionACIProvisioning,
+		Status:             v1.ConditionFalse,
+		Reason:             state,
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	}
+	if isProvisioning(state) {
+		condition.Status = v1.ConditionTrue
+	}
+	if operationID, ok := p.provisioningOperations.Load(key); ok {
+		condition.Message = fmt.Sprintf("ARM operation %s", operationID)
+	}
+	if !isProvisioning(state) {
+		p.provisioningOperations.Delete(key)
+	}
+	return condition
+}
+
+// getProvisioningPodStatus returns the status of a pod whose container group is still provisioning, and thus
+// doesn't report the state of its containers yet.
+func (p *ACIProvider) getProvisioningPodStatus(namespace, name, state string) *v1.PodStatus {
+	now := metav1.NewTime(time.Now())
+	status := &v1.PodStatus{
+		Phase:  v1.PodPending,
+		HostIP: p.internalIP,
+		Conditions: []v1.PodCondition{
+			{
+				Type:               v1.PodScheduled,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: now,
+			},
+			{
+				Type:               readinessGateACIProvisioned,
+				Status:             v1.ConditionFalse,
+				Reason:             state,
+				LastTransitionTime: now,
+			},
+		},
+	}
+	setPodCondition(status, p.getProvisioningCondition(namespace, name, state))
+	return status
+}
+
+// setPodCondition adds a condition to the pod status or replaces the condition of the same type, keeping its
+// transition time when the status of the condition didn't change.
+func setPodCondition(status *v1.PodStatus, condition v1.PodCondition) {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != condition.Type {
+			continue
+		}
+		if status.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = status.Conditions[i].LastTransitionTime
+		}
+		status.Conditions[i] = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
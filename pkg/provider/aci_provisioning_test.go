@@ -0,0 +1,89 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPodProvisioningStatus(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pod := testsutil.CreatePodObj(podName, podNamespace)
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockOperationID = "op-id"
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+	var updatedPod *v1.Pod
+	provider.tracker = &PodsTracker{
+		pods: podLister,
+		updateCb: func(p *v1.Pod) {
+			updatedPod = p
+		},
+	}
+
+	assert.NilError(t, provider.CreatePod(context.Background(), pod))
+	assert.Check(t, is.Equal("Normal ContainerGroupProvisioning ARM operation op-id is creating the container group in region "+fakeRegion, <-recorder.Events))
+	assert.Assert(t, updatedPod != nil)
+	assert.Check(t, is.DeepEqual([]string{string(podConditionACIProvisioning), "True", provisioningStateAccepted, "ARM operation op-id"},
+		conditionFields(updatedPod.Status, podConditionACIProvisioning)))
+
+	cg := testsutil.CreateContainerGroupObj(podName, podNamespace, "Pending", nil, "Creating")
+	cg.Properties.InstanceView = nil
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		return cg, nil
+	}
+
+	status, err := provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(v1.PodPending, status.Phase))
+	assert.Check(t, is.DeepEqual([]string{string(podConditionACIProvisioning), "True", "Creating", "ARM operation op-id"},
+		conditionFields(*status, podConditionACIProvisioning)))
+
+	containers := testsutil.CreateACIContainersListObj("Failed", "Pending",
+		time.Now(), time.Now(), false, false, false)
+	cg = testsutil.CreateContainerGroupObj(podName, podNamespace, "Failed", containers, "Failed")
+	status, err = provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{string(podConditionACIProvisioning), "False", "Failed", "ARM operation op-id"},
+		conditionFields(*status, podConditionACIProvisioning)))
+
+	// the operation is forgotten once the provisioning completed
+	status, err = provider.GetPodStatus(context.Background(), podNamespace, podName)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{string(podConditionACIProvisioning), "False", "Failed", ""},
+		conditionFields(*status, podConditionACIProvisioning)))
+}
+
+func conditionFields(status v1.PodStatus, conditionType v1.PodConditionType) []string {
+	for _, c := range status.Conditions {
+		if c.Type == conditionType {
+			return []string{string(c.Type), string(c.Status), c.Reason, c.Message}
+		}
+	}
+	return nil
+}
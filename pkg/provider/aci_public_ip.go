@@ -0,0 +1,83 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"strconv"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/network"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// publicIPAnnotation exposes the container group of a pod with a public IP address, also on virtual nodes
+	// with a virtual network, in which case the pod is placed outside of it.
+	publicIPAnnotation = "virtual-kubelet.io/public-ip"
+	// publicPortsAnnotation is a comma separated list of the container ports exposed on the public IP address,
+	// as port or port/protocol, all the container ports are exposed by default.
+	publicPortsAnnotation = "virtual-kubelet.io/public-ports"
+	// publicIPAddressAnnotation and fqdnAnnotation publish the public IP address and the fully qualified domain
+	// name of the DNS name label assigned by ACI.
+	publicIPAddressAnnotation = "virtual-kubelet.io/public-ip-address"
+	fqdnAnnotation            = "virtual-kubelet.io/fqdn"
+)
+
+// requestsPublicIP returns whether a pod requests a public IP address with the public IP annotation.
+func requestsPublicIP(pod *v1.Pod) (bool, error) {
+	value, ok := pod.Annotations[publicIPAnnotation]
+	if !ok {
+		return false, nil
+	}
+	public, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.InvalidInputf("invalid %s annotation %q of pod %s/%s: %v", publicIPAnnotation, value, pod.Namespace, pod.Name, err)
+	}
+	if public && pod.Annotations[network.SubnetAnnotation] != "" {
+		return false, errdefs.InvalidInputf("pod %s/%s can't request both a public IP address and subnet '%s'", pod.Namespace, pod.Name, pod.Annotations[network.SubnetAnnotation])
+	}
+	return public, nil
+}
+
+// getPublicIPAddress returns the public IP address of the container group of a pod which requests one, exposing
+// the given ports with the DNS name label of the pod.
+func getPublicIPAddress(pod *v1.Pod, ports []*azaciv2.Port) (*azaciv2.IPAddress, error) {
+	if len(ports) == 0 {
+		return nil, errdefs.InvalidInputf("pod %s/%s requests a public IP address but exposes no ports", pod.Namespace, pod.Name)
+	}
+
+	ipAddress := &azaciv2.IPAddress{
+		Ports: ports,
+		Type:  &util.ContainerGroupIPAddressTypePublic,
+	}
+	if dnsNameLabel := pod.Annotations[virtualKubeletDNSNameLabel]; dnsNameLabel != "" {
+		ipAddress.DNSNameLabel = &dnsNameLabel
+	}
+	return ipAddress, nil
+}
+
+func newPublicPort(port int32, protocol azaciv2.ContainerNetworkProtocol) *azaciv2.Port {
+	groupProtocol := azaciv2.ContainerGroupNetworkProtocol(protocol)
+	return &azaciv2.Port{
+		Port:     &port,
+		Protocol: &groupProtocol,
+	}
+}
+
+// setPublicIPAnnotations publishes the public IP address and FQDN of a container group on its pod.
+func setPublicIPAnnotations(pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	ip := cg.Properties.IPAddress
+	if ip == nil || ip.Type == nil || *ip.Type != azaciv2.ContainerGroupIPAddressTypePublic {
+		return
+	}
+	if address := stringValue(ip.IP); address != "" {
+		pod.Annotations[publicIPAddressAnnotation] = address
+	}
+	if fqdn := stringValue(ip.Fqdn); fqdn != "" {
+		pod.Annotations[fqdnAnnotation] = fqdn
+	}
+}
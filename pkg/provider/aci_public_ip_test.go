@@ -0,0 +1,141 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/virtual-kubelet/azure-aci/pkg/network"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestGetPublicIPAddress(t *testing.T) {
+	tcp, udp := azaciv2.ContainerNetworkProtocolTCP, azaciv2.ContainerNetworkProtocolUDP
+	port80, port53 := int32(80), int32(53)
+	containers := []*azaciv2.Container{{Properties: &azaciv2.ContainerProperties{Ports: []*azaciv2.ContainerPort{
+		{Port: &port80, Protocol: &tcp},
+		{Port: &port53, Protocol: &udp},
+	}}}}
+
+	cases := []struct {
+		description   string
+		annotations   map[string]string
+		expectedPorts []string
+		expectedError bool
+	}{
+		{
+			description:   "all container ports",
+			annotations:   map[string]string{virtualKubeletDNSNameLabel: "web"},
+			expectedPorts: []string{"80/TCP", "53/UDP"},
+		},
+		{
+			description:   "selected ports",
+			annotations:   map[string]string{publicPortsAnnotation: "53/tcp, 80"},
+			expectedPorts: []string{"53/TCP", "80/TCP"},
+		},
+		{
+			description:   "not a container port",
+			annotations:   map[string]string{publicPortsAnnotation: "443"},
+			expectedError: true,
+		},
+		{
+			description:   "invalid port",
+			annotations:   map[string]string{publicPortsAnnotation: "http"},
+			expectedError: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Annotations = tc.annotations
+
+			exposed, err := getExposedPorts(pod, containers, false)
+			if tc.expectedError {
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				return
+			}
+			assert.NilError(t, err)
+			ip, err := getPublicIPAddress(pod, exposed)
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(azaciv2.ContainerGroupIPAddressTypePublic, *ip.Type))
+			ports := make([]string, 0, len(ip.Ports))
+			for _, port := range ip.Ports {
+				ports = append(ports, fmt.Sprintf("%d/%s", *port.Port, *port.Protocol))
+			}
+			assert.Check(t, is.DeepEqual(tc.expectedPorts, ports))
+			assert.Check(t, is.Equal(tc.annotations[virtualKubeletDNSNameLabel], stringValue(ip.DNSNameLabel)))
+		})
+	}
+}
+
+func TestRequestsPublicIP(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	public, err := requestsPublicIP(pod)
+	assert.NilError(t, err)
+	assert.Check(t, !public)
+
+	pod.Annotations = map[string]string{publicIPAnnotation: "true"}
+	public, err = requestsPublicIP(pod)
+	assert.NilError(t, err)
+	assert.Check(t, public)
+
+	pod.Annotations[network.SubnetAnnotation] = "subnet"
+	_, err = requestsPublicIP(pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+
+	pod.Annotations = map[string]string{publicIPAnnotation: "yes please"}
+	_, err = requestsPublicIP(pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
+
+func TestCreatePodWithPublicIP(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	created := false
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		created = true
+		assert.Assert(t, cg.Properties.IPAddress != nil)
+		assert.Check(t, is.Equal(azaciv2.ContainerGroupIPAddressTypePublic, *cg.Properties.IPAddress.Type))
+		assert.Check(t, is.Equal("web", stringValue(cg.Properties.IPAddress.DNSNameLabel)))
+		assert.Check(t, is.Len(cg.Properties.SubnetIDs, 0), "container groups with a public IP can't be in a subnet")
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	provider.providernetwork.SubnetName = "subnet"
+
+	pod := testsutil.CreatePodObj(podName, podNamespace)
+	pod.Annotations = map[string]string{publicIPAnnotation: "true", virtualKubeletDNSNameLabel: "web"}
+	assert.NilError(t, provider.CreatePod(context.Background(), pod))
+	assert.Check(t, created)
+}
+
+func TestSetPublicIPAnnotations(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Annotations = map[string]string{}
+	cg := testsutil.CreateContainerGroupObj("pod", "ns", "Running", nil, "Succeeded")
+	fqdn := "web.westus.azurecontainer.io"
+	cg.Properties.IPAddress.Type = &util.ContainerGroupIPAddressTypePublic
+	cg.Properties.IPAddress.Fqdn = &fqdn
+
+	setPublicIPAnnotations(pod, cg)
+	assert.Check(t, is.Equal(testsutil.FakeIP, pod.Annotations[publicIPAddressAnnotation]))
+	assert.Check(t, is.Equal(fqdn, pod.Annotations[fqdnAnnotation]))
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	v1 "k8s.io/api/core/v1"
+)
+
+// propagateReadOnlyVolumeMounts makes the volume mounts of the containers of a container group read-only when
+// their volume is: the secret, configMap, projected and downward API volumes like on the kubelet, and the volumes
+// whose source is read-only. The volume mounts only follow the readOnly of the container otherwise. The mounts of
+// the init container extracting the archived volumes are left alone, as it writes the files of these volumes.
+func propagateReadOnlyVolumeMounts(pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	readOnly := make(map[string]bool)
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.Secret != nil, volume.ConfigMap != nil, volume.Projected != nil, volume.DownwardAPI != nil:
+			readOnly[volume.Name] = true
+		case volume.AzureFile != nil:
+			readOnly[volume.Name] = volume.AzureFile.ReadOnly
+		case volume.CSI != nil:
+			readOnly[volume.Name] = volume.CSI.ReadOnly != nil && *volume.CSI.ReadOnly
+		case volume.PersistentVolumeClaim != nil:
+			readOnly[volume.Name] = volume.PersistentVolumeClaim.ReadOnly
+		}
+	}
+	for _, volume := range cg.Properties.Volumes {
+		if volume.AzureFile != nil && volume.AzureFile.ReadOnly != nil && *volume.AzureFile.ReadOnly {
+			readOnly[*volume.Name] = true
+		}
+	}
+	if len(readOnly) == 0 {
+		return
+	}
+
+	setReadOnly := func(mounts []*azaciv2.VolumeMount) {
+		for _, mount := range mounts {
+			if readOnly[*mount.Name] && (mount.ReadOnly == nil || !*mount.ReadOnly) {
+				t := true
+				mount.ReadOnly = &t
+			}
+		}
+	}
+	for _, container := range cg.Properties.Containers {
+		if container.Properties != nil {
+			setReadOnly(container.Properties.VolumeMounts)
+		}
+	}
+	for _, initContainer := range cg.Properties.InitContainers {
+		if initContainer.Properties != nil && *initContainer.Name != volumeArchiveContainerName {
+			setReadOnly(initContainer.Properties.VolumeMounts)
+		}
+	}
+}
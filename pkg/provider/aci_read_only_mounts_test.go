@@ -0,0 +1,123 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestPropagateReadOnlyVolumeMounts(t *testing.T) {
+	cgName := "pod-" + uuid.New().String()
+	cgNamespace := "ns-" + uuid.New().String()
+	containerName := "fakeContainer"
+	mountPath := "/mnt/volume"
+	readOnlyShare := true
+
+	cases := []struct {
+		description      string
+		volume           v1.VolumeSource
+		aciVolume        *azaciv2.Volume
+		mountReadOnly    bool
+		expectedReadOnly bool
+	}{
+		{
+			description:      "Secret volume",
+			volume:           v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "secret"}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "ConfigMap volume",
+			volume:           v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "Projected volume",
+			volume:           v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "Read-only AzureFile volume",
+			volume:           v1.VolumeSource{AzureFile: &v1.AzureFileVolumeSource{ShareName: "share", ReadOnly: true}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "Writable AzureFile volume",
+			volume:           v1.VolumeSource{AzureFile: &v1.AzureFileVolumeSource{ShareName: "share"}},
+			expectedReadOnly: false,
+		},
+		{
+			description:      "Read-only Azure File CSI volume",
+			volume:           v1.VolumeSource{CSI: &v1.CSIVolumeSource{Driver: AzureFileDriverName, ReadOnly: &readOnlyShare}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "Read-only share of a hostPath mapping",
+			volume:           v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log"}},
+			aciVolume:        &azaciv2.Volume{AzureFile: &azaciv2.AzureFileVolume{ReadOnly: &readOnlyShare}},
+			expectedReadOnly: true,
+		},
+		{
+			description:      "EmptyDir volume",
+			volume:           v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+			expectedReadOnly: false,
+		},
+		{
+			description:      "EmptyDir volume mounted read-only",
+			volume:           v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+			mountReadOnly:    true,
+			expectedReadOnly: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			volumeName := "fakeVolume"
+			pod := testsutil.CreatePodObj(cgName, cgNamespace)
+			pod.Spec.Volumes = []v1.Volume{{Name: volumeName, VolumeSource: tc.volume}}
+
+			mountReadOnly := tc.mountReadOnly
+			containers := []*azaciv2.Container{
+				{
+					Name: &containerName,
+					Properties: &azaciv2.ContainerProperties{
+						VolumeMounts: []*azaciv2.VolumeMount{{Name: &volumeName, MountPath: &mountPath, ReadOnly: &mountReadOnly}},
+					},
+				},
+			}
+			initContainers := []*azaciv2.InitContainerDefinition{
+				{
+					Name: &containerName,
+					Properties: &azaciv2.InitContainerPropertiesDefinition{
+						VolumeMounts: []*azaciv2.VolumeMount{{Name: &volumeName, MountPath: &mountPath}},
+					},
+				},
+			}
+			cg := testsutil.CreateContainerGroupObj(cgName, cgNamespace, "Succeeded", containers, "Succeeded")
+			cg.Properties.InitContainers = initContainers
+			aciVolume := tc.aciVolume
+			if aciVolume == nil {
+				aciVolume = &azaciv2.Volume{}
+			}
+			aciVolume.Name = &volumeName
+			cg.Properties.Volumes = []*azaciv2.Volume{aciVolume}
+
+			propagateReadOnlyVolumeMounts(pod, cg)
+
+			mount := cg.Properties.Containers[0].Properties.VolumeMounts[0]
+			assert.Check(t, mount.ReadOnly != nil && *mount.ReadOnly == tc.expectedReadOnly, "read-only flag of the container volume mount")
+			initMount := cg.Properties.InitContainers[0].Properties.VolumeMounts[0]
+			assert.Check(t, is.Equal(tc.expectedReadOnly && !tc.mountReadOnly, initMount.ReadOnly != nil && *initMount.ReadOnly),
+				"read-only flag of the init container volume mount")
+			assert.Check(t, is.Equal(tc.mountReadOnly, mountReadOnly), "the flag of the pod is left alone")
+		})
+	}
+}
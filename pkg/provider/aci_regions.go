@@ -0,0 +1,241 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// regionAnnotation places the container group of a pod into one of the regions of the provider.
+	regionAnnotation = "virtual-kubelet.io/region"
+	regionTag        = "Region"
+)
+
+// regionCapacityErrorCodes are the ARM error codes after which the container group is retried in the next region.
+var regionCapacityErrorCodes = []string{
+	"ServiceUnavailable",
+	"SkuNotAvailable",
+	"InsufficientCapacity",
+	"QuotaReached",
+	"QuotaExceeded",
+}
+
+// setupRegions sets the regions container groups are spread across from the ACI_REGIONS environment variable
+// or the config file. The region of the provider is always the first one.
+func (p *ACIProvider) setupRegions() error {
+	if regions := os.Getenv("ACI_REGIONS"); regions != "" {
+		p.regions = strings.Split(regions, ",")
+	}
+
+	regions := []string{p.region}
+	for _, region := range p.regions {
+		region = strings.TrimSpace(region)
+		if region == "" || containsRegion(regions, region) {
+			continue
+		}
+		if !isValidACIRegion(region) {
+			return fmt.Errorf("Region %s is invalid. Current supported regions are: %s", region, strings.Join(validAciRegions, ", "))
+		}
+		regions = append(regions, region)
+	}
+	p.regions = regions
+
+	if err := validateFailoverRegion(p.region, p.failoverRegion); err != nil {
+		return err
+	}
+	if p.failoverRegion != "" {
+		p.regionFailover = newRegionFailover(p.failoverRegion, p.failoverThreshold, p.failoverProbeInterval)
+	}
+	return nil
+}
+
+// getPlacementRegions returns the regions to try creating the container group of a pod in, in order. A pod can
+// pick a region, including the failover region, with the region annotation, otherwise the regions are rotated
+// between pods.
+func (p *ACIProvider) getPlacementRegions(pod *v1.Pod) ([]string, error) {
+	allowed := p.regions
+	if p.failoverRegion != "" && !containsRegion(allowed, p.failoverRegion) {
+		allowed = append(append([]string{}, p.regions...), p.failoverRegion)
+	}
+	if len(allowed) <= 1 {
+		return []string{p.region}, nil
+	}
+
+	if region, ok := pod.Annotations[regionAnnotation]; ok {
+		for _, r := range allowed {
+			if strings.EqualFold(r, region) {
+				return []string{r}, nil
+			}
+		}
+		return nil, errdefs.InvalidInputf("the pod requires region %s, but the provider only places pods in regions %s", region, strings.Join(allowed, ", "))
+	}
+	if len(p.regions) <= 1 {
+		return []string{p.region}, nil
+	}
+
+	start := int(atomic.AddUint32(&p.nextRegion, 1)-1) % len(p.regions)
+	regions := make([]string, 0, len(p.regions))
+	regions = append(regions, p.regions[start:]...)
+	regions = append(regions, p.regions[:start]...)
+	return regions, nil
+}
+
+// createContainerGroupInRegions creates the container group in the first placement region of the pod which
+// has the capacity for it. A dry run stops at the first region passing the checks.
+func (p *ACIProvider) createContainerGroupInRegions(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup, dryRun bool) error {
+	regions, err := p.getPlacementRegions(pod)
+	if err != nil {
+		return err
+	}
+	regions = p.getFailoverRegions(pod, regions)
+	profile, err := p.getContainerGroupProfile(pod)
+	if err != nil {
+		return err
+	}
+	if profile != nil && profile.Overlay {
+		if err := p.validateProfileOverlay(ctx, cg, *profile); err != nil {
+			return err
+		}
+	}
+
+	var errs []string
+	// the pod only preempts other pods once it can't be placed in any region
+	var shortageRegion string
+	var shortage error
+	for i := range regions {
+		region := regions[i]
+		logger := log.G(ctx).WithField("region", region)
+
+		cg.Location = &region
+		cg.Tags[regionTag] = &region
+		cg.Zones = nil
+		var zones []string
+		zones, err = getAvailabilityZones(pod, region)
+		if err == nil {
+			if checker := p.capacityCheckers[region]; checker != nil {
+				if policy := p.getResourcePolicy(); policy.scale {
+					var adjustments []string
+					adjustments, err = checker.fitCapabilities(ctx, cg, policy)
+					p.reportResourceAdjustments(ctx, pod, adjustments)
+				}
+				if err == nil {
+					err = checker.check(ctx, cg)
+				}
+			}
+		}
+		if err == nil && dryRun {
+			logger.Debugf("container group of pod %s passed the checks", pod.Name)
+			return nil
+		}
+		if err == nil {
+			logger.Debugf("creating container group of pod %s", pod.Name)
+			var operationID, zone string
+			operationID, zone, err = p.createContainerGroupInZones(ctx, pod, cg, profile, p.getPlacementZones(zones))
+			p.recordRegionOutcome(ctx, region, err)
+			if err == nil {
+				p.startProvisioning(ctx, pod, region, operationID)
+				p.recordPlacedRegion(ctx, pod, region)
+				p.recordPlacedZone(ctx, pod, zone)
+				return nil
+			}
+			if !isRegionCapacityError(err) {
+				return err
+			}
+			// ARM rejects a container group moving to another region, so the failed one is deleted first
+			if i+1 < len(regions) {
+				if deleteErr := p.azClientsAPIs.DeleteContainerGroupAndWait(ctx, p.getResourceGroup(pod.Namespace), containerGroupName(pod.Namespace, pod.Name)); deleteErr != nil {
+					return fmt.Errorf("unable to delete the failed container group before trying the next region: %v, after: %w", deleteErr, err)
+				}
+			}
+		}
+
+		if shortage == nil && errors.As(err, new(*quotaError)) {
+			shortageRegion, shortage = region, err
+		}
+		if len(regions) == 1 {
+			p.preemptForQuota(ctx, pod, shortageRegion, shortage, dryRun)
+			return err
+		}
+		logger.WithError(err).Warnf("unable to place pod %s in region %s, trying the next region", pod.Name, region)
+		errs = append(errs, fmt.Sprintf("%s: %v", region, err))
+	}
+	p.preemptForQuota(ctx, pod, shortageRegion, shortage, dryRun)
+	return fmt.Errorf("unable to place the pod in any region: %s", strings.Join(errs, "; "))
+}
+
+// createContainerGroupInZones creates the container group in the first of the zones with the capacity for it,
+// or without a zone when the pod allows any zone. It returns the operation ID and the zone of the container group.
+func (p *ACIProvider) createContainerGroupInZones(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup, profile *client.ContainerGroupProfileReference, zones []string) (string, string, error) {
+	if len(zones) == 0 {
+		zones = []string{""}
+	}
+
+	for i := range zones {
+		zone := zones[i]
+		cg.Zones = nil
+		if zone != "" {
+			cg.Zones = []*string{&zone}
+		}
+
+		release, err := p.createQueue.acquire(ctx, pod.Namespace, getPodPriority(pod))
+		if err != nil {
+			return "", "", err
+		}
+		operationID, err := p.createContainerGroup(ctx, pod, cg, profile)
+		release()
+		if err == nil {
+			return operationID, zone, nil
+		}
+		if !isRegionCapacityError(err) || i+1 == len(zones) {
+			return "", "", err
+		}
+		// ARM rejects a container group moving to another zone, so the failed one is deleted first
+		if deleteErr := p.azClientsAPIs.DeleteContainerGroupAndWait(ctx, p.getResourceGroup(pod.Namespace), containerGroupName(pod.Namespace, pod.Name)); deleteErr != nil {
+			return "", "", fmt.Errorf("unable to delete the failed container group before trying the next zone: %v, after: %w", deleteErr, err)
+		}
+		log.G(ctx).WithError(err).Warnf("unable to place pod %s in zone %s, trying the next zone", pod.Name, zone)
+	}
+	return "", "", nil
+}
+
+// isRegionCapacityError returns whether ARM refused to create the container group for lack of capacity or quota.
+func isRegionCapacityError(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	if respErr.StatusCode == http.StatusServiceUnavailable {
+		return true
+	}
+	for _, code := range regionCapacityErrorCodes {
+		if strings.Contains(respErr.ErrorCode, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRegion(regions []string, region string) bool {
+	for _, r := range regions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSetupRegions(t *testing.T) {
+	t.Setenv("ACI_REGIONS", "eastus, westus,westeurope")
+	p := ACIProvider{region: "westus"}
+	assert.NilError(t, p.setupRegions())
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus", "westeurope"}, p.regions))
+
+	t.Setenv("ACI_REGIONS", "eastus,moon")
+	p = ACIProvider{region: "westus"}
+	assert.Check(t, is.ErrorContains(p.setupRegions(), "Region moon is invalid"))
+}
+
+func TestGetPlacementRegions(t *testing.T) {
+	p := ACIProvider{region: "westus", regions: []string{"westus", "eastus", "westeurope"}}
+	pod := testsutil.CreatePodObj("pod", "ns")
+
+	regions, err := p.getPlacementRegions(pod)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"westus", "eastus", "westeurope"}, regions))
+	regions, err = p.getPlacementRegions(pod)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"eastus", "westeurope", "westus"}, regions))
+
+	pod.Annotations = map[string]string{regionAnnotation: "WestEurope"}
+	regions, err = p.getPlacementRegions(pod)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual([]string{"westeurope"}, regions))
+
+	pod.Annotations = map[string]string{regionAnnotation: "northeurope"}
+	_, err = p.getPlacementRegions(pod)
+	assert.Check(t, is.ErrorContains(err, "the pod requires region northeurope"))
+}
+
+func TestCreateContainerGroupInRegions(t *testing.T) {
+	var tried []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		tried = append(tried, *cg.Location)
+		assert.Check(t, is.Equal(*cg.Location, *cg.Tags[regionTag]))
+		switch *cg.Location {
+		case "westus":
+			return &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "ContainerGroupQuotaReached"}
+		case "eastus":
+			return &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServiceUnavailable"}
+		}
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		assert.Check(t, is.Equal("ns-pod", cgName))
+		tried = append(tried, "deleted")
+		return nil
+	}
+	p := ACIProvider{
+		azClientsAPIs: aciMocks,
+		region:        "westus",
+		regions:       []string{"westus", "eastus", "westeurope"},
+	}
+
+	newContainerGroup := func() *azaciv2.ContainerGroup {
+		return &azaciv2.ContainerGroup{Tags: map[string]*string{}}
+	}
+
+	assert.NilError(t, p.createContainerGroupInRegions(context.Background(), testsutil.CreatePodObj("pod", "ns"), newContainerGroup(), false))
+	// the failed container group is deleted before the next region is tried
+	assert.Check(t, is.DeepEqual([]string{"westus", "deleted", "eastus", "deleted", "westeurope"}, tried))
+
+	// other errors are returned right away
+	tried = nil
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		tried = append(tried, *cg.Location)
+		return errors.New("invalid container group")
+	}
+	err := p.createContainerGroupInRegions(context.Background(), testsutil.CreatePodObj("pod", "ns"), newContainerGroup(), false)
+	assert.Check(t, is.Error(err, "invalid container group"))
+	assert.Check(t, is.Equal(1, len(tried)))
+
+	// all regions without capacity
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		return &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	}
+	err = p.createContainerGroupInRegions(context.Background(), testsutil.CreatePodObj("pod", "ns"), newContainerGroup(), false)
+	assert.Check(t, is.ErrorContains(err, "unable to place the pod in any region"))
+}
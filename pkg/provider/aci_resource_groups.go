@@ -0,0 +1,45 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"sort"
+	"strings"
+)
+
+// getResourceGroup returns the resource group the container groups of a namespace are created in.
+func (p *ACIProvider) getResourceGroup(namespace string) string {
+	if resourceGroup, ok := p.namespaceResourceGroups[namespace]; ok {
+		return resourceGroup
+	}
+	return p.resourceGroup
+}
+
+// getResourceGroups returns all resource groups of the provider, starting with the default resource group.
+func (p *ACIProvider) getResourceGroups() []string {
+	resourceGroups := []string{p.resourceGroup}
+	for _, resourceGroup := range p.namespaceResourceGroups {
+		if !containsResourceGroup(resourceGroups, resourceGroup) {
+			resourceGroups = append(resourceGroups, resourceGroup)
+		}
+	}
+	sort.Strings(resourceGroups[1:])
+	return resourceGroups
+}
+
+// isProviderResourceGroup returns whether container groups of the provider are created in a resource group.
+func (p *ACIProvider) isProviderResourceGroup(resourceGroup string) bool {
+	return containsResourceGroup(p.getResourceGroups(), resourceGroup)
+}
+
+func containsResourceGroup(resourceGroups []string, resourceGroup string) bool {
+	for _, rg := range resourceGroups {
+		// resource group names are case insensitive
+		if strings.EqualFold(rg, resourceGroup) {
+			return true
+		}
+	}
+	return false
+}
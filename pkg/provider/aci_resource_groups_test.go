@@ -0,0 +1,76 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestGetResourceGroup(t *testing.T) {
+	p := ACIProvider{
+		resourceGroup: "vk-rg",
+		namespaceResourceGroups: map[string]string{
+			"team-b": "team-b-rg",
+			"team-a": "team-a-rg",
+			"team-c": "VK-RG",
+		},
+	}
+
+	assert.Check(t, is.Equal("team-a-rg", p.getResourceGroup("team-a")))
+	assert.Check(t, is.Equal("vk-rg", p.getResourceGroup("default")))
+	assert.Check(t, is.DeepEqual([]string{"vk-rg", "team-a-rg", "team-b-rg"}, p.getResourceGroups()))
+	assert.Check(t, p.isProviderResourceGroup("Team-B-RG"))
+	assert.Check(t, !p.isProviderResourceGroup("other-rg"))
+}
+
+func TestGetPodsAcrossResourceGroups(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podNamespaceLister := NewMockPodNamespaceLister(mockCtrl)
+	podLister.EXPECT().Pods(gomock.Any()).Return(podNamespaceLister).AnyTimes()
+	podNamespaceLister.EXPECT().Get(gomock.Any()).Return(nil, nil).AnyTimes()
+
+	containerGroups := map[string]*azaciv2.ContainerGroup{
+		"vk-rg":     testsutil.CreateContainerGroupObj("default-pod", "default", "Succeeded", testsutil.CreateACIContainersListObj(runningState, "Initializing", testsutil.CgCreationTime.Add(2), testsutil.CgCreationTime.Add(3), false, false, false), "Succeeded"),
+		"team-a-rg": testsutil.CreateContainerGroupObj("team-a-pod", "team-a", "Succeeded", testsutil.CreateACIContainersListObj(runningState, "Initializing", testsutil.CgCreationTime.Add(2), testsutil.CgCreationTime.Add(3), false, false, false), "Succeeded"),
+	}
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		return []*azaciv2.ContainerGroup{containerGroups[resourceGroup]}, nil
+	}
+	aciMocks.MockGetContainerGroup = func(ctx context.Context, resourceGroup, containerGroupName string) (*azaciv2.ContainerGroup, error) {
+		return containerGroups[resourceGroup], nil
+	}
+	var deletedFrom string
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deletedFrom = resourceGroup
+		return nil
+	}
+
+	provider := ACIProvider{
+		azClientsAPIs:           aciMocks,
+		podsL:                   podLister,
+		nodeName:                fakeNodeName,
+		resourceGroup:           "vk-rg",
+		namespaceResourceGroups: map[string]string{"team-a": "team-a-rg"},
+	}
+
+	pods, err := provider.GetPods(context.Background())
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(2, len(pods)))
+
+	assert.NilError(t, provider.deleteContainerGroup(context.Background(), "team-a", "team-a-pod"))
+	assert.Check(t, is.Equal("team-a-rg", deletedFrom))
+
+}
@@ -0,0 +1,329 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// defaultCPURequestGranularity and defaultMemoryRequestGranularityGB are the multiples ACI requires for the
+	// CPU and memory of the containers, unless configured.
+	defaultCPURequestGranularity      = 0.01
+	defaultMemoryRequestGranularityGB = 0.1
+
+	// eventReasonResourcesAdjusted is the reason of the event emitted when the requested resources of a pod
+	// are rounded to the granularity of ACI or scaled to fit the maximums of a container group.
+	eventReasonResourcesAdjusted = "ResourcesAdjusted"
+
+	// podResourcesPolicyReject fails the pods requesting more resources than the maximums of a container group,
+	// podResourcesPolicyScale scales their requests down proportionally to fit.
+	podResourcesPolicyReject = "Reject"
+	podResourcesPolicyScale  = "Scale"
+)
+
+func validatePodResourcesPolicy(policy string) error {
+	switch policy {
+	case "", podResourcesPolicyReject, podResourcesPolicyScale:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid pod resources policy, expected %s or %s", policy, podResourcesPolicyReject, podResourcesPolicyScale)
+}
+
+// resourcePolicy normalizes the resources of the containers into the values ACI accepts.
+type resourcePolicy struct {
+	// defaultCPU and defaultMemoryGB are requested by the containers without requests.
+	defaultCPU      float64
+	defaultMemoryGB float64
+	// cpuGranularity and memoryGranularityGB are the multiples the resources are rounded down to.
+	cpuGranularity      float64
+	memoryGranularityGB float64
+	// maxPodCPU and maxPodMemoryGB cap the requests of all the containers of a pod, unlimited when zero.
+	maxPodCPU      float64
+	maxPodMemoryGB float64
+	// scale scales the resources of the pods down to the maximums instead of failing the pods.
+	scale bool
+}
+
+// getResourcePolicy returns the resource policy of the current settings, with the default requests of the node.
+// The pods use the default requests of their namespace, see getPodResourcePolicy.
+func (p *ACIProvider) getResourcePolicy() resourcePolicy {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+
+	policy := resourcePolicy{
+		defaultCPU:          p.defaultCPURequest,
+		defaultMemoryGB:     p.defaultMemoryRequest,
+		cpuGranularity:      p.cpuRequestGranularity,
+		memoryGranularityGB: p.memoryRequestGranularity,
+		maxPodCPU:           p.maxPodCPU,
+		maxPodMemoryGB:      p.maxPodMemory,
+		scale:               p.podResourcesPolicy == podResourcesPolicyScale,
+	}
+	if policy.defaultCPU == 0 {
+		policy.defaultCPU = defaultCPURequest
+	}
+	if policy.defaultMemoryGB == 0 {
+		policy.defaultMemoryGB = defaultMemoryRequestGB
+	}
+	if policy.cpuGranularity == 0 {
+		policy.cpuGranularity = defaultCPURequestGranularity
+	}
+	if policy.memoryGranularityGB == 0 {
+		policy.memoryGranularityGB = defaultMemoryRequestGranularityGB
+	}
+	return policy
+}
+
+// getDefaultRequests resolves the CPU and memory requested by the containers of the pods of a namespace which
+// don't request them. It is the only place default requests are resolved, from the highest precedence:
+//  1. the virtual-kubelet.io/default-cpu-request and default-memory-request annotations of the namespace,
+//  2. the requests of the first PodDefaults of the config file selecting the namespace,
+//  3. DefaultCPURequest and DefaultMemoryRequestGB of the config file,
+//  4. defaultCPURequest and defaultMemoryRequestGB.
+//
+// Each resource is resolved on its own, e.g. a namespace with a default CPU request only gets its default memory
+// request from the next levels.
+func (p *ACIProvider) getDefaultRequests(namespace string) (float64, float64, error) {
+	requests, err := p.getNamespaceDefaultRequests(namespace)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	p.settingsLock.RLock()
+	allDefaults := p.podDefaults
+	p.settingsLock.RUnlock()
+	for i := range allDefaults {
+		defaults := &allDefaults[i]
+		if defaults.namespaces != nil && !defaults.namespaces[namespace] {
+			continue
+		}
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			if _, ok := requests[name]; ok {
+				continue
+			}
+			if q, ok := defaults.requests[name]; ok {
+				if requests == nil {
+					requests = v1.ResourceList{}
+				}
+				requests[name] = q
+			}
+		}
+	}
+
+	// the node defaults of the policy already fall back to the built-in defaults
+	policy := p.getResourcePolicy()
+	cpu, memoryGB := policy.defaultCPU, policy.defaultMemoryGB
+	if q, ok := requests[v1.ResourceCPU]; ok {
+		cpu = cpuValue(q)
+	}
+	if q, ok := requests[v1.ResourceMemory]; ok {
+		memoryGB = memoryValueGB(q)
+	}
+	return cpu, memoryGB, nil
+}
+
+// getPodResourcePolicy returns the resource policy of the pods of a namespace, with its default requests, see
+// getDefaultRequests.
+func (p *ACIProvider) getPodResourcePolicy(namespace string) (resourcePolicy, error) {
+	policy := p.getResourcePolicy()
+	cpu, memoryGB, err := p.getDefaultRequests(namespace)
+	if err != nil {
+		return policy, err
+	}
+	policy.defaultCPU, policy.defaultMemoryGB = cpu, memoryGB
+	return policy, nil
+}
+
+// getAccountedResourcePolicy returns the resource policy the resources of an existing pod are accounted with. The
+// pods of namespaces with invalid default requests can't be created, so they are accounted with the defaults of
+// the node.
+func (p *ACIProvider) getAccountedResourcePolicy(pod *v1.Pod) resourcePolicy {
+	policy, _ := p.getPodResourcePolicy(pod.Namespace)
+	return policy
+}
+
+// getContainerResources returns the resources of a container, along with a description of each request the
+// policy rounded. The memory limits are rounded without a report, as the pods are scheduled by their requests.
+func (rp resourcePolicy) getContainerResources(container *v1.Container) (*azaciv2.ResourceRequirements, []string) {
+	var adjustments []string
+	round := func(kind string, q resource.Quantity, value, granularity float64, unit string) float64 {
+		rounded := roundDown(value, granularity)
+		if rounded != value {
+			adjustments = append(adjustments, fmt.Sprintf("container %s: %s %s rounded to %g%s",
+				container.Name, kind, q.String(), rounded, unit))
+		}
+		return rounded
+	}
+
+	// the default requests don't go above the limits of the container
+	cpuRequest := rp.defaultCPU
+	if q, ok := container.Resources.Requests[v1.ResourceCPU]; ok {
+		cpuRequest = round("CPU request", q, cpuValue(q), rp.cpuGranularity, "")
+	} else if q, ok := container.Resources.Limits[v1.ResourceCPU]; ok {
+		cpuRequest = math.Min(cpuRequest, roundDown(cpuValue(q), rp.cpuGranularity))
+	}
+	memoryRequest := rp.defaultMemoryGB
+	if q, ok := container.Resources.Requests[v1.ResourceMemory]; ok {
+		memoryRequest = round("memory request", q, memoryValueGB(q), rp.memoryGranularityGB, "GB")
+	} else if q, ok := container.Resources.Limits[v1.ResourceMemory]; ok {
+		memoryRequest = math.Min(memoryRequest, roundDown(memoryValueGB(q), rp.memoryGranularityGB))
+	}
+
+	resources := &azaciv2.ResourceRequirements{
+		Requests: &azaciv2.ResourceRequests{
+			CPU:        &cpuRequest,
+			MemoryInGB: &memoryRequest,
+		},
+	}
+
+	if container.Resources.Limits != nil {
+		cpuLimit := cpuRequest
+		if q, ok := container.Resources.Limits[v1.ResourceCPU]; ok {
+			cpuLimit = cpuValue(q)
+		}
+		memoryLimit := memoryRequest
+		if q, ok := container.Resources.Limits[v1.ResourceMemory]; ok {
+			memoryLimit = roundDown(memoryValueGB(q), rp.memoryGranularityGB)
+		}
+		resources.Limits = &azaciv2.ResourceLimits{
+			CPU:        &cpuLimit,
+			MemoryInGB: &memoryLimit,
+		}
+	}
+	return resources, adjustments
+}
+
+// fitPodResources checks the requests of all the containers of a pod against the maximums of the policy. With the
+// Scale policy, the requests over the maximums are scaled down instead, the limits are lowered to the maximums,
+// and the adjustments are returned.
+func (rp resourcePolicy) fitPodResources(pod *v1.Pod, containers []*azaciv2.Container) ([]string, error) {
+	adjustments, err := fitContainerResources(containers, rp.maxPodCPU, rp.maxPodMemoryGB, rp.cpuGranularity, rp.memoryGranularityGB, rp.scale)
+	if err != nil {
+		return nil, errdefs.InvalidInputf("pod %s/%s %v per pod", pod.Namespace, pod.Name, err)
+	}
+	return adjustments, nil
+}
+
+// fitContainerResources checks the total requests of containers against the maximums of a container group,
+// unlimited when zero. With scale, the requests over a maximum are scaled down proportionally, rounded down to the
+// granularity, and the limits of the containers over a maximum are lowered to it.
+func fitContainerResources(containers []*azaciv2.Container, maxCPU, maxMemoryGB, cpuGranularity, memoryGranularityGB float64, scale bool) ([]string, error) {
+	var adjustments []string
+	// noun follows the quantities in the errors, e.g. "2 CPU" or "4GB of memory"
+	fit := func(kind, unit, noun string, max, granularity float64, request, limit func(*azaciv2.ResourceRequirements) **float64) error {
+		if max <= 0 {
+			return nil
+		}
+		// tolerate the floating point error of the sums
+		const epsilon = 1e-9
+		var total float64
+		for _, container := range containers {
+			if resources := getResourceRequirements(container); resources != nil && *request(resources) != nil {
+				total += **request(resources)
+			}
+		}
+		if total > max+epsilon {
+			if !scale {
+				return fmt.Errorf("requests %g%s %s, more than the maximum of %g%s", total, unit, noun, max, unit)
+			}
+			ratio := max / total
+			total = 0
+			for _, container := range containers {
+				resources := getResourceRequirements(container)
+				if resources == nil || *request(resources) == nil {
+					continue
+				}
+				scaled := roundDown(**request(resources)*ratio, granularity)
+				adjustments = append(adjustments, fmt.Sprintf("container %s: %s request %g%s scaled to %g%s to fit the maximum of %g%s",
+					stringValue(container.Name), kind, **request(resources), unit, scaled, unit, max, unit))
+				*request(resources) = &scaled
+				total += scaled
+			}
+			// the containers can't request less than the granularity
+			if total > max+epsilon {
+				return fmt.Errorf("requests at least %g%s %s once scaled, more than the maximum of %g%s", total, unit, noun, max, unit)
+			}
+		}
+
+		if !scale {
+			return nil
+		}
+		for _, container := range containers {
+			resources := getResourceRequirements(container)
+			if resources == nil || resources.Limits == nil || *limit(resources) == nil || **limit(resources) <= max+epsilon {
+				continue
+			}
+			adjustments = append(adjustments, fmt.Sprintf("container %s: %s limit %g%s lowered to the maximum of %g%s",
+				stringValue(container.Name), kind, **limit(resources), unit, max, unit))
+			lowered := max
+			*limit(resources) = &lowered
+		}
+		return nil
+	}
+
+	err := fit("CPU", "", "CPU", maxCPU, cpuGranularity,
+		func(r *azaciv2.ResourceRequirements) **float64 { return &r.Requests.CPU },
+		func(r *azaciv2.ResourceRequirements) **float64 { return &r.Limits.CPU })
+	if err != nil {
+		return nil, err
+	}
+	err = fit("memory", "GB", "of memory", maxMemoryGB, memoryGranularityGB,
+		func(r *azaciv2.ResourceRequirements) **float64 { return &r.Requests.MemoryInGB },
+		func(r *azaciv2.ResourceRequirements) **float64 { return &r.Limits.MemoryInGB })
+	if err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+func getResourceRequirements(container *azaciv2.Container) *azaciv2.ResourceRequirements {
+	if container.Properties == nil || container.Properties.Resources == nil || container.Properties.Resources.Requests == nil {
+		return nil
+	}
+	return container.Properties.Resources
+}
+
+// reportResourceAdjustments warns about the requested resources of a pod the provider altered.
+func (p *ACIProvider) reportResourceAdjustments(ctx context.Context, pod *v1.Pod, adjustments []string) {
+	if len(adjustments) == 0 {
+		return
+	}
+	message := strings.Join(adjustments, "; ")
+	log.G(ctx).Warnf("adjusted the resources of pod %s/%s: %s", pod.Namespace, pod.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeWarning, eventReasonResourcesAdjusted, message)
+	}
+}
+
+// roundDown rounds a value down to a multiple of the granularity, with a minimum of one granularity.
+func roundDown(value, granularity float64) float64 {
+	// tolerate the floating point error of the division, e.g. 0.3/0.1
+	n := math.Floor(value/granularity + 1e-9)
+	if n < 1 {
+		n = 1
+	}
+	// drop the floating point error of the multiplication, e.g. 198*0.01
+	return math.Round(n*granularity*1e6) / 1e6
+}
+
+// cpuValue returns a CPU quantity in cores.
+func cpuValue(q resource.Quantity) float64 {
+	return float64(q.MilliValue()) / 1000
+}
+
+// memoryValueGB returns a memory quantity in GB, as ACI counts memory in decimal units.
+func memoryValueGB(q resource.Quantity) float64 {
+	return float64(q.Value()) / 1e9
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetContainerResources(t *testing.T) {
+	cases := []struct {
+		description         string
+		policy              resourcePolicy
+		resources           v1.ResourceRequirements
+		expectedCPU         float64
+		expectedMemory      float64
+		expectedMemoryLimit float64
+		expectedAdjustments int
+	}{
+		{
+			description:    "container without requests",
+			policy:         resourcePolicy{defaultCPU: 1, defaultMemoryGB: 1.5},
+			expectedCPU:    1,
+			expectedMemory: 1.5,
+		},
+		{
+			description:         "default requests above the limits",
+			policy:              resourcePolicy{defaultCPU: 1, defaultMemoryGB: 1.5},
+			resources:           v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512M")}},
+			expectedCPU:         1,
+			expectedMemory:      0.5,
+			expectedMemoryLimit: 0.5,
+		},
+		{
+			description: "requests at the granularity",
+			resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("1.98"),
+				v1.ResourceMemory: resource.MustParse("300M"),
+			}},
+			expectedCPU:    1.98,
+			expectedMemory: 0.3,
+		},
+		{
+			description: "requests rounded down",
+			resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("1981m"),
+				v1.ResourceMemory: resource.MustParse("1Gi"),
+			}},
+			expectedCPU:         1.98,
+			expectedMemory:      1,
+			expectedAdjustments: 2,
+		},
+		{
+			description: "requests below the granularity",
+			resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("1m"),
+				v1.ResourceMemory: resource.MustParse("1M"),
+			}},
+			expectedCPU:         0.01,
+			expectedMemory:      0.1,
+			expectedAdjustments: 2,
+		},
+		{
+			description: "coarser granularity",
+			policy:      resourcePolicy{cpuGranularity: 0.25, memoryGranularityGB: 0.5},
+			resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("600m"),
+					v1.ResourceMemory: resource.MustParse("1.2G"),
+				},
+				Limits: v1.ResourceList{
+					v1.ResourceMemory: resource.MustParse("2.2G"),
+				},
+			},
+			expectedCPU:         0.5,
+			expectedMemory:      1,
+			expectedMemoryLimit: 2,
+			expectedAdjustments: 2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			policy := tc.policy
+			if policy.cpuGranularity == 0 {
+				policy.cpuGranularity = defaultCPURequestGranularity
+			}
+			if policy.memoryGranularityGB == 0 {
+				policy.memoryGranularityGB = defaultMemoryRequestGranularityGB
+			}
+
+			resources, adjustments := policy.getContainerResources(&v1.Container{Name: "c", Resources: tc.resources})
+			assert.Check(t, is.Equal(tc.expectedCPU, *resources.Requests.CPU))
+			assert.Check(t, is.Equal(tc.expectedMemory, *resources.Requests.MemoryInGB))
+			assert.Check(t, is.Len(adjustments, tc.expectedAdjustments))
+			if tc.expectedMemoryLimit == 0 {
+				assert.Check(t, is.Nil(resources.Limits))
+				return
+			}
+			assert.Assert(t, resources.Limits != nil)
+			assert.Check(t, is.Equal(tc.expectedMemoryLimit, *resources.Limits.MemoryInGB))
+		})
+	}
+}
+
+func TestGetContainersResourcePolicy(t *testing.T) {
+	p := ACIProvider{maxPodCPU: 2, maxPodMemory: 4}
+	recorder := record.NewFakeRecorder(10)
+	p.SetEventRecorder(recorder)
+
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("1981m"),
+		v1.ResourceMemory: resource.MustParse("4G"),
+	}
+	containers, err := p.getContainers(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(1.98, *containers[0].Properties.Resources.Requests.CPU))
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonResourcesAdjusted))
+
+	pod.Spec.Containers = append(pod.Spec.Containers, *pod.Spec.Containers[0].DeepCopy())
+	pod.Spec.Containers[1].Name = "sidecar"
+	_, err = p.getContainers(context.Background(), pod, nil)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+	assert.Check(t, is.ErrorContains(err, "more than the maximum of 2 per pod"))
+
+	// unless the pods are scaled to fit
+	p.podResourcesPolicy = podResourcesPolicyScale
+	containers, err = p.getContainers(context.Background(), pod, nil)
+	assert.NilError(t, err)
+	for _, container := range containers {
+		assert.Check(t, is.Equal(1.0, *container.Properties.Resources.Requests.CPU))
+		assert.Check(t, is.Equal(2.0, *container.Properties.Resources.Requests.MemoryInGB))
+	}
+	assert.Assert(t, is.Len(recorder.Events, 1))
+	event := <-recorder.Events
+	assert.Check(t, is.Contains(event, "CPU request 1.98 scaled to 1 to fit the maximum of 2"))
+	// the limits are lowered to the maximums
+	assert.Check(t, is.Contains(event, "CPU limit 3.999 lowered to the maximum of 2"))
+	assert.Check(t, is.Equal(2.0, *containers[0].Properties.Resources.Limits.CPU))
+}
+
+func TestRoundDown(t *testing.T) {
+	assert.Check(t, is.Equal(0.3, roundDown(0.3, 0.1)))
+	assert.Check(t, is.Equal(1.98, roundDown(1.981, 0.01)))
+	assert.Check(t, is.Equal(0.1, roundDown(0.01, 0.1)))
+}
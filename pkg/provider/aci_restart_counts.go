@@ -0,0 +1,189 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// restartCountsTag are the restarts of the containers of a pod in the previous instances of its container group, as
+// "<container>=<count>,...". ACI resets the restart counts of the containers when it restarts a container group,
+// e.g. on a host maintenance or an in place update, while the kubelet keeps counting.
+const restartCountsTag = "RestartCounts"
+
+// observedRestarts is the instance of a container last seen in the instance view of its container group.
+type observedRestarts struct {
+	count     int32
+	startedAt time.Time
+}
+
+// podRestartCounts are the restart counts of the containers of a pod.
+type podRestartCounts struct {
+	// previous are the restarts of the containers in the previous instances of the container group.
+	previous map[string]int32
+	observed map[string]observedRestarts
+}
+
+// restartCountTracker adds up the restart counts of the containers across the restarts of their container groups.
+type restartCountTracker struct {
+	lock sync.Mutex
+	pods map[string]*podRestartCounts
+}
+
+func newRestartCountTracker() *restartCountTracker {
+	return &restartCountTracker{pods: map[string]*podRestartCounts{}}
+}
+
+func parseRestartCounts(value string) (map[string]int32, error) {
+	counts := map[string]int32{}
+	if value == "" {
+		return counts, nil
+	}
+	for _, field := range strings.Split(value, ",") {
+		name, count, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid restart counts %q", value)
+		}
+		n, err := strconv.ParseInt(count, 10, 32)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid restart count %q of container %s", count, name)
+		}
+		counts[name] = int32(n)
+	}
+	return counts, nil
+}
+
+func formatRestartCounts(counts map[string]int32) string {
+	fields := make([]string, 0, len(counts))
+	for name, count := range counts {
+		if count > 0 {
+			fields = append(fields, fmt.Sprintf("%s=%d", name, count))
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+// getContainerStartedAt returns when the current instance of a container started, zero while it is waiting.
+func getContainerStartedAt(status v1.ContainerStatus) time.Time {
+	switch {
+	case status.State.Running != nil:
+		return status.State.Running.StartedAt.Time
+	case status.State.Terminated != nil:
+		return status.State.Terminated.StartedAt.Time
+	}
+	return time.Time{}
+}
+
+// observe records the restart counts reported by ACI for the containers of a pod and returns the restarts of their
+// previous instances, and whether they changed. The previous restarts are seeded from the tag of the container group
+// the first time a pod is observed, e.g. after a restart of the provider. The container group was restarted when
+// the restart count of a container went down, or when a container started again without its count going up, which
+// the kubelet counts as one more restart.
+func (t *restartCountTracker) observe(key string, tagged map[string]int32, statuses []v1.ContainerStatus) (map[string]int32, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	pod, ok := t.pods[key]
+	if !ok {
+		pod = &podRestartCounts{previous: copyRestartCounts(tagged), observed: map[string]observedRestarts{}}
+		t.pods[key] = pod
+	}
+
+	changed := false
+	for _, status := range statuses {
+		current := observedRestarts{count: status.RestartCount, startedAt: getContainerStartedAt(status)}
+		last, seen := pod.observed[status.Name]
+		restarted := current.count < last.count ||
+			(current.count == last.count && !last.startedAt.IsZero() && !current.startedAt.IsZero() &&
+				!current.startedAt.Equal(last.startedAt))
+		if seen && restarted {
+			pod.previous[status.Name] += last.count + 1
+			changed = true
+		}
+		pod.observed[status.Name] = current
+	}
+
+	return copyRestartCounts(pod.previous), changed
+}
+
+// getPrevious returns the restarts of the containers of a pod in the previous instances of its container group.
+func (t *restartCountTracker) getPrevious(key string) map[string]int32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if pod, ok := t.pods[key]; ok {
+		return copyRestartCounts(pod.previous)
+	}
+	return nil
+}
+
+func copyRestartCounts(counts map[string]int32) map[string]int32 {
+	copied := make(map[string]int32, len(counts))
+	for name, count := range counts {
+		copied[name] = count
+	}
+	return copied
+}
+
+func (t *restartCountTracker) deletePod(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.pods, key)
+}
+
+// applyRestartCounts adds the restarts of the previous instances of the container group of a pod to the restart
+// counts of its containers, and persists them in the tags of the container group when they changed.
+func (p *ACIProvider) applyRestartCounts(ctx context.Context, cg *azaciv2.ContainerGroup, statuses []v1.ContainerStatus) {
+	namespace, name := stringValue(cg.Tags["Namespace"]), stringValue(cg.Tags["PodName"])
+	if name == "" {
+		return
+	}
+	tagged, err := parseRestartCounts(stringValue(cg.Tags[restartCountsTag]))
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("ignoring the restart counts tag of the container group of pod %s/%s", namespace, name)
+		tagged = map[string]int32{}
+	}
+
+	previous, changed := p.restartCounts.observe(namespace+"/"+name, tagged, statuses)
+	for i := range statuses {
+		statuses[i].RestartCount += previous[statuses[i].Name]
+	}
+	if !changed || !p.isLeading() || cg.Name == nil {
+		return
+	}
+
+	tags := make(map[string]*string, len(cg.Tags)+1)
+	for key, value := range cg.Tags {
+		tags[key] = value
+	}
+	value := formatRestartCounts(previous)
+	tags[restartCountsTag] = &value
+	if err := p.azClientsAPIs.UpdateContainerGroupTags(ctx, p.getResourceGroup(namespace), *cg.Name, tags); err != nil {
+		log.G(ctx).WithError(err).Warnf("failed to persist the restart counts of pod %s/%s", namespace, name)
+	}
+}
+
+// setRestartCountsTag keeps the restarts of the previous instances of the container group of a pod when it is
+// updated in place.
+func (p *ACIProvider) setRestartCountsTag(pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	value := formatRestartCounts(p.restartCounts.getPrevious(pod.Namespace + "/" + pod.Name))
+	if value == "" {
+		return
+	}
+	if cg.Tags == nil {
+		cg.Tags = map[string]*string{}
+	}
+	cg.Tags[restartCountsTag] = &value
+}
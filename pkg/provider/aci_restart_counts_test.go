@@ -0,0 +1,103 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRestartTestStatus(name string, restartCount int32, startedAt time.Time) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:         name,
+		RestartCount: restartCount,
+		State:        v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(startedAt)}},
+	}
+}
+
+func TestRestartCountTracker(t *testing.T) {
+	start := time.Now()
+	tracker := newRestartCountTracker()
+
+	previous, changed := tracker.observe("ns/pod", map[string]int32{"app": 2}, []v1.ContainerStatus{
+		newRestartTestStatus("app", 3, start), newRestartTestStatus("sidecar", 0, start),
+	})
+	assert.Check(t, !changed)
+	assert.Check(t, is.DeepEqual(map[string]int32{"app": 2}, previous))
+
+	// the restarts of the containers within the container group are counted by ACI
+	_, changed = tracker.observe("ns/pod", nil, []v1.ContainerStatus{
+		newRestartTestStatus("app", 4, start.Add(time.Minute)), newRestartTestStatus("sidecar", 0, start),
+	})
+	assert.Check(t, !changed)
+
+	// the container group restarted: the count of app went down and sidecar started again
+	previous, changed = tracker.observe("ns/pod", nil, []v1.ContainerStatus{
+		newRestartTestStatus("app", 0, start.Add(2*time.Minute)), newRestartTestStatus("sidecar", 0, start.Add(2*time.Minute)),
+	})
+	assert.Check(t, changed)
+	assert.Check(t, is.DeepEqual(map[string]int32{"app": 7, "sidecar": 1}, previous))
+	assert.Check(t, is.Equal("app=7,sidecar=1", formatRestartCounts(tracker.getPrevious("ns/pod"))))
+
+	tracker.deletePod("ns/pod")
+	assert.Check(t, is.Len(tracker.getPrevious("ns/pod"), 0))
+}
+
+func TestParseRestartCounts(t *testing.T) {
+	counts, err := parseRestartCounts("app=7,sidecar=1")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]int32{"app": 7, "sidecar": 1}, counts))
+
+	_, err = parseRestartCounts("app=-1")
+	assert.Check(t, is.ErrorContains(err, "invalid restart count"))
+	_, err = parseRestartCounts("app")
+	assert.Check(t, is.ErrorContains(err, "invalid restart counts"))
+}
+
+func TestApplyRestartCounts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	aciMocks := createNewACIMock()
+	var updated map[string]*string
+	aciMocks.MockUpdateContainerGroupTags = func(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+		updated = tags
+		return nil
+	}
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	start := time.Now()
+	cg := &azaciv2.ContainerGroup{
+		Name: stringPtr("ns-pod"),
+		Tags: map[string]*string{"Namespace": stringPtr("ns"), "PodName": stringPtr("pod"), restartCountsTag: stringPtr("app=2")},
+	}
+	statuses := []v1.ContainerStatus{newRestartTestStatus("app", 1, start)}
+	provider.applyRestartCounts(context.Background(), cg, statuses)
+	assert.Check(t, is.Equal(int32(3), statuses[0].RestartCount))
+	assert.Check(t, updated == nil)
+
+	statuses = []v1.ContainerStatus{newRestartTestStatus("app", 0, start.Add(time.Minute))}
+	provider.applyRestartCounts(context.Background(), cg, statuses)
+	assert.Check(t, is.Equal(int32(4), statuses[0].RestartCount))
+	assert.Assert(t, updated[restartCountsTag] != nil)
+	assert.Check(t, is.Equal("app=4", *updated[restartCountsTag]))
+	assert.Check(t, is.Equal("pod", *updated["PodName"]))
+
+	// an in place update of the container group keeps the restarts of its previous instances
+	recreated := &azaciv2.ContainerGroup{}
+	provider.setRestartCountsTag(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"}}, recreated)
+	assert.Check(t, is.Equal("app=4", *recreated.Tags[restartCountsTag]))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+// validateSecurityContext rejects pods requesting a security posture ACI can't satisfy. ACI runs every
+// container with the runtime default seccomp profile and a writable root filesystem, and offers no way to
+// change either, so silently ignoring such requests would run the pod less restricted than asked for.
+func validateSecurityContext(pod *v1.Pod) error {
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		if err := validateSeccompProfile(sc.SeccompProfile, "pod "+pod.Name); err != nil {
+			return err
+		}
+	}
+
+	containers := make([]v1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, container := range containers {
+		sc := container.SecurityContext
+		if sc == nil {
+			continue
+		}
+		if sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem {
+			return errdefs.InvalidInputf("container %s: ACI does not support read-only root filesystems", container.Name)
+		}
+		if err := validateSeccompProfile(sc.SeccompProfile, "container "+container.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSeccompProfile(profile *v1.SeccompProfile, owner string) error {
+	if profile == nil || profile.Type == v1.SeccompProfileTypeRuntimeDefault {
+		return nil
+	}
+	return errdefs.InvalidInputf("%s: ACI only supports the %s seccomp profile, %s was requested", owner, v1.SeccompProfileTypeRuntimeDefault, profile.Type)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateSecurityContext(t *testing.T) {
+	readOnly := true
+	writable := false
+
+	cases := []struct {
+		description   string
+		podContext    *v1.PodSecurityContext
+		container     v1.Container
+		initContainer *v1.Container
+		expectedError string
+	}{
+		{
+			description: "no security context",
+			container:   v1.Container{Name: "c"},
+		},
+		{
+			description: "runtime default seccomp profile and writable root filesystem",
+			podContext:  &v1.PodSecurityContext{SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault}},
+			container: v1.Container{Name: "c", SecurityContext: &v1.SecurityContext{
+				ReadOnlyRootFilesystem: &writable,
+				SeccompProfile:         &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault},
+			}},
+		},
+		{
+			description:   "read-only root filesystem",
+			container:     v1.Container{Name: "c", SecurityContext: &v1.SecurityContext{ReadOnlyRootFilesystem: &readOnly}},
+			expectedError: "container c: ACI does not support read-only root filesystems",
+		},
+		{
+			description:   "read-only root filesystem of init container",
+			container:     v1.Container{Name: "c"},
+			initContainer: &v1.Container{Name: "init", SecurityContext: &v1.SecurityContext{ReadOnlyRootFilesystem: &readOnly}},
+			expectedError: "container init: ACI does not support read-only root filesystems",
+		},
+		{
+			description:   "localhost seccomp profile of pod",
+			podContext:    &v1.PodSecurityContext{SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeLocalhost}},
+			container:     v1.Container{Name: "c"},
+			expectedError: "pod p: ACI only supports the RuntimeDefault seccomp profile, Localhost was requested",
+		},
+		{
+			description: "unconfined seccomp profile of container",
+			container: v1.Container{Name: "c", SecurityContext: &v1.SecurityContext{
+				SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeUnconfined},
+			}},
+			expectedError: "container c: ACI only supports the RuntimeDefault seccomp profile, Unconfined was requested",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p"},
+				Spec: v1.PodSpec{
+					SecurityContext: tc.podContext,
+					Containers:      []v1.Container{tc.container},
+				},
+			}
+			if tc.initContainer != nil {
+				pod.Spec.InitContainers = []v1.Container{*tc.initContainer}
+			}
+
+			err := validateSecurityContext(pod)
+			if tc.expectedError == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Check(t, is.Error(err, tc.expectedError))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+)
+
+const (
+	// securityReportAnnotation holds the JSON encoded SecurityReport of the container group backing a pod, patched
+	// when the report changes.
+	securityReportAnnotation = "virtual-kubelet.io/security-report"
+)
+
+// SecurityReport summarizes what was actually deployed to Azure for a pod from a security point of view.
+type SecurityReport struct {
+	Namespace        string              `json:"namespace"`
+	PodName          string              `json:"podName"`
+	ContainerGroup   string              `json:"containerGroup"`
+	PublicIP         bool                `json:"publicIP"`
+	PublicPorts      []int32             `json:"publicPorts,omitempty"`
+	DNSNameLabel     string              `json:"dnsNameLabel,omitempty"`
+	IdentityAssigned bool                `json:"identityAssigned"`
+	IdentityType     string              `json:"identityType,omitempty"`
+	ConfidentialSKU  bool                `json:"confidentialSku"`
+	SecretEnvVars    []string            `json:"secretEnvVars,omitempty"`
+	SecretVolumes    []string            `json:"secretVolumes,omitempty"`
+	Images           []SecurityImageInfo `json:"images"`
+}
+
+// SecurityImageInfo describes the image a container was deployed with.
+type SecurityImageInfo struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+// buildSecurityReport creates the security summary of a container group.
+func buildSecurityReport(cg *azaciv2.ContainerGroup) *SecurityReport {
+	report := &SecurityReport{
+		Images: make([]SecurityImageInfo, 0),
+	}
+	if cg == nil {
+		return report
+	}
+
+	if cg.Name != nil {
+		report.ContainerGroup = *cg.Name
+	}
+	if cg.Tags != nil {
+		if ns := cg.Tags["Namespace"]; ns != nil {
+			report.Namespace = *ns
+		}
+		if name := cg.Tags["PodName"]; name != nil {
+			report.PodName = *name
+		}
+	}
+
+	if cg.Identity != nil && cg.Identity.Type != nil &&
+		*cg.Identity.Type != azaciv2.ResourceIdentityTypeNone {
+		report.IdentityAssigned = true
+		report.IdentityType = string(*cg.Identity.Type)
+	}
+
+	if cg.Properties == nil {
+		return report
+	}
+
+	if ip := cg.Properties.IPAddress; ip != nil && ip.Type != nil &&
+		*ip.Type == azaciv2.ContainerGroupIPAddressTypePublic {
+		report.PublicIP = true
+		for _, port := range ip.Ports {
+			if port != nil && port.Port != nil {
+				report.PublicPorts = append(report.PublicPorts, *port.Port)
+			}
+		}
+		if ip.DNSNameLabel != nil {
+			report.DNSNameLabel = *ip.DNSNameLabel
+		}
+	}
+
+	if cg.Properties.SKU != nil && *cg.Properties.SKU == azaciv2.ContainerGroupSKUConfidential {
+		report.ConfidentialSKU = true
+	}
+
+	for _, volume := range cg.Properties.Volumes {
+		if volume != nil && volume.Name != nil && volume.Secret != nil {
+			report.SecretVolumes = append(report.SecretVolumes, *volume.Name)
+		}
+	}
+
+	for _, container := range cg.Properties.Containers {
+		if container == nil || container.Name == nil || container.Properties == nil {
+			continue
+		}
+		for _, env := range container.Properties.EnvironmentVariables {
+			// ACI never returns secure values, so a variable without a value is a secure one.
+			if env != nil && env.Name != nil && (env.SecureValue != nil || env.Value == nil) {
+				report.SecretEnvVars = append(report.SecretEnvVars, *container.Name+"/"+*env.Name)
+			}
+		}
+		if container.Properties.Image != nil {
+			report.Images = append(report.Images, SecurityImageInfo{
+				Container: *container.Name,
+				Image:     *container.Properties.Image,
+				Digest:    imageDigest(*container.Properties.Image),
+			})
+		}
+	}
+
+	sort.Strings(report.SecretEnvVars)
+	sort.Strings(report.SecretVolumes)
+	return report
+}
+
+// imageDigest returns the digest an image reference is pinned to, or an empty string.
+func imageDigest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// GetSecurityReports returns the security summary of every container group managed by this node.
+func (p *ACIProvider) GetSecurityReports(ctx context.Context) ([]*SecurityReport, error) {
+	ctx, span := trace.StartSpan(ctx, "aci.GetSecurityReports")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	reports := make([]*SecurityReport, 0)
+	for _, resourceGroup := range p.getResourceGroups() {
+		cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cg := range cgs {
+			if cg == nil || cg.Tags == nil || cg.Tags["NodeName"] == nil || *cg.Tags["NodeName"] != p.nodeName {
+				continue
+			}
+			reports = append(reports, buildSecurityReport(cg))
+		}
+	}
+	return reports, nil
+}
+
+// SecurityReportHandler serves the security summaries of all container groups as JSON.
+func (p *ACIProvider) SecurityReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reports, err := p.GetSecurityReports(r.Context())
+		if err != nil {
+			log.G(r.Context()).WithError(err).Error("failed to build security reports")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(reports); err != nil {
+			log.G(r.Context()).WithError(err).Error("failed to encode security reports")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/azure-aci/pkg/util"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestBuildSecurityReport(t *testing.T) {
+	startTime := time.Now()
+	pinnedImage := "nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+	envName := "PASSWORD"
+	envSecret := "secret"
+	plainEnvName := "MODE"
+	plainEnvValue := "debug"
+	secretVolumeName := "secret-volume"
+	dnsNameLabel := "my-pod"
+	port := int32(80)
+	systemAssigned := azaciv2.ResourceIdentityTypeSystemAssigned
+	confidentialSku := azaciv2.ContainerGroupSKUConfidential
+
+	cases := []struct {
+		description    string
+		amend          func(cg *azaciv2.ContainerGroup)
+		expectedReport SecurityReport
+	}{
+		{
+			description: "private container group without secrets",
+			amend: func(cg *azaciv2.ContainerGroup) {
+				cg.Properties.IPAddress.Type = nil
+			},
+			expectedReport: SecurityReport{
+				Images: []SecurityImageInfo{{Container: testsutil.TestContainerName, Image: testsutil.TestImageNginx}},
+			},
+		},
+		{
+			description: "public, identity enabled, confidential container group with secrets",
+			amend: func(cg *azaciv2.ContainerGroup) {
+				cg.Identity = &azaciv2.ContainerGroupIdentity{Type: &systemAssigned}
+				cg.Properties.SKU = &confidentialSku
+				cg.Properties.IPAddress.Type = &util.ContainerGroupIPAddressTypePublic
+				cg.Properties.IPAddress.DNSNameLabel = &dnsNameLabel
+				cg.Properties.IPAddress.Ports = []*azaciv2.Port{{Port: &port}}
+				cg.Properties.Volumes = []*azaciv2.Volume{{Name: &secretVolumeName, Secret: map[string]*string{}}}
+				cg.Properties.Containers[0].Properties.Image = &pinnedImage
+				cg.Properties.Containers[0].Properties.EnvironmentVariables = []*azaciv2.EnvironmentVariable{
+					{Name: &envName, SecureValue: &envSecret},
+					{Name: &plainEnvName, Value: &plainEnvValue},
+				}
+			},
+			expectedReport: SecurityReport{
+				PublicIP:         true,
+				PublicPorts:      []int32{port},
+				DNSNameLabel:     dnsNameLabel,
+				IdentityAssigned: true,
+				IdentityType:     string(systemAssigned),
+				ConfidentialSKU:  true,
+				SecretEnvVars:    []string{testsutil.TestContainerName + "/" + envName},
+				SecretVolumes:    []string{secretVolumeName},
+				Images: []SecurityImageInfo{{
+					Container: testsutil.TestContainerName,
+					Image:     pinnedImage,
+					Digest:    "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+				}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			cg := testsutil.CreateContainerGroupObj(cgName, cgName, "Running",
+				testsutil.CreateACIContainersListObj(runningState, "Initializing", startTime, startTime, false, false, false), "Succeeded")
+			tc.amend(cg)
+
+			report := buildSecurityReport(cg)
+			tc.expectedReport.Namespace = cgName
+			tc.expectedReport.PodName = cgName
+			tc.expectedReport.ContainerGroup = cgName
+			assert.Check(t, is.DeepEqual(tc.expectedReport, *report))
+		})
+	}
+}
+
+func TestSecurityReportAnnotationPatched(t *testing.T) {
+	startTime := time.Now()
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, pods.Add(pod))
+	client := fake.NewSimpleClientset(pod)
+	p := ACIProvider{podsL: corev1listers.NewPodLister(pods), restartCounts: newRestartCountTracker()}
+	p.SetPodClient(client.CoreV1())
+
+	cg := testsutil.CreateContainerGroupObj("pod", "ns", "Running",
+		testsutil.CreateACIContainersListObj("Running", "Initializing", startTime, startTime, false, false, false), "Succeeded")
+	cgName := containerGroupName(pod.Namespace, pod.Name)
+	cg.Name = &cgName
+	updatedPod, err := p.containerGroupToPod(context.Background(), cg)
+	assert.NilError(t, err)
+
+	patched, err := client.CoreV1().Pods("ns").Get(context.Background(), "pod", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, patched.Annotations[securityReportAnnotation] != "")
+	assert.Check(t, is.Equal(updatedPod.Annotations[securityReportAnnotation], patched.Annotations[securityReportAnnotation]))
+}
+
+func TestSecurityReportHandlerWithoutContainerGroups(t *testing.T) {
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		return nil, nil
+	}
+	p := ACIProvider{azClientsAPIs: aciMocks, resourceGroup: "rg"}
+
+	w := httptest.NewRecorder()
+	p.SecurityReportHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/securityreports", nil))
+	assert.Check(t, is.Equal(http.StatusOK, w.Code))
+	assert.Check(t, is.Equal("[]\n", w.Body.String()))
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+// containerGroupSKUAnnotation selects the SKU of the container group of a pod: Standard, Dedicated to run it on
+// hosts dedicated to the subscription, or Confidential, see setConfidentialComputeProperties.
+const containerGroupSKUAnnotation = confidentialComputeSkuLabel
+
+// skuUnavailableErrorCodes are the ARM error codes of the SKUs the region or the subscription doesn't offer.
+var skuUnavailableErrorCodes = []string{
+	"SkuNotAvailable",
+	"UnsupportedSku",
+	"InvalidSku",
+}
+
+func validateContainerGroupSKU(sku string) error {
+	switch azaciv2.ContainerGroupSKU(sku) {
+	case "", azaciv2.ContainerGroupSKUStandard, azaciv2.ContainerGroupSKUDedicated:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid container group SKU, expected %s or %s", sku,
+		azaciv2.ContainerGroupSKUStandard, azaciv2.ContainerGroupSKUDedicated)
+}
+
+// getContainerGroupSKU returns the SKU requested for the container group of a pod with the SKU annotation, or the
+// default SKU of the provider, nil for the ACI default. The Confidential SKU is left to the confidential compute
+// feature.
+func (p *ACIProvider) getContainerGroupSKU(pod *v1.Pod) (*azaciv2.ContainerGroupSKU, error) {
+	value, ok := pod.Annotations[containerGroupSKUAnnotation]
+	if !ok {
+		if p.containerGroupSKU == "" {
+			return nil, nil
+		}
+		sku := azaciv2.ContainerGroupSKU(p.containerGroupSKU)
+		return &sku, nil
+	}
+
+	for _, sku := range azaciv2.PossibleContainerGroupSKUValues() {
+		if !strings.EqualFold(value, string(sku)) {
+			continue
+		}
+		if sku == azaciv2.ContainerGroupSKUConfidential {
+			return nil, nil
+		}
+		return &sku, nil
+	}
+	return nil, errdefs.InvalidInputf("invalid %s annotation %q of pod %s/%s, expected %s, %s or %s", containerGroupSKUAnnotation, value,
+		pod.Namespace, pod.Name, azaciv2.ContainerGroupSKUStandard, azaciv2.ContainerGroupSKUDedicated, azaciv2.ContainerGroupSKUConfidential)
+}
+
+// skuUnavailableError explains why ARM refused the SKU of a container group. It wraps the ARM error, so that the
+// container group is still retried in the next region, see isRegionCapacityError.
+type skuUnavailableError struct {
+	error
+	sku    azaciv2.ContainerGroupSKU
+	region string
+}
+
+func (e *skuUnavailableError) Error() string {
+	return fmt.Sprintf("the %s container group SKU is not available in region %s, check that the region offers dedicated hosts "+
+		"and that they are enabled for the subscription: %v", e.sku, e.region, e.error)
+}
+
+func (e *skuUnavailableError) Unwrap() error {
+	return e.error
+}
+
+// getSKUError returns the error of the creation of a container group with a clear message when ARM refused its
+// Dedicated SKU.
+func getSKUError(err error, cg *azaciv2.ContainerGroup) error {
+	if err == nil || cg.Properties == nil || cg.Properties.SKU == nil || *cg.Properties.SKU != azaciv2.ContainerGroupSKUDedicated {
+		return err
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	for _, code := range skuUnavailableErrorCodes {
+		if strings.Contains(respErr.ErrorCode, code) {
+			return &skuUnavailableError{error: err, sku: *cg.Properties.SKU, region: stringValue(cg.Location)}
+		}
+	}
+	return err
+}
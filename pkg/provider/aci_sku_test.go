@@ -0,0 +1,103 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestGetContainerGroupSKU(t *testing.T) {
+	cases := []struct {
+		description   string
+		defaultSKU    string
+		annotation    string
+		expectedSKU   *azaciv2.ContainerGroupSKU
+		expectedError string
+	}{
+		{
+			description: "ACI default",
+		},
+		{
+			description: "provider default",
+			defaultSKU:  "Dedicated",
+			expectedSKU: skuPtr(azaciv2.ContainerGroupSKUDedicated),
+		},
+		{
+			description: "annotation overrides the provider default",
+			defaultSKU:  "Dedicated",
+			annotation:  "standard",
+			expectedSKU: skuPtr(azaciv2.ContainerGroupSKUStandard),
+		},
+		{
+			description: "confidential is left to confidential compute",
+			defaultSKU:  "Dedicated",
+			annotation:  "Confidential",
+		},
+		{
+			description:   "invalid annotation",
+			annotation:    "Isolated",
+			expectedError: "invalid virtual-kubelet.io/container-sku annotation",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			p := ACIProvider{containerGroupSKU: tc.defaultSKU}
+			pod := testsutil.CreatePodObj("pod", "ns")
+			if tc.annotation != "" {
+				pod.Annotations = map[string]string{containerGroupSKUAnnotation: tc.annotation}
+			}
+
+			sku, err := p.getContainerGroupSKU(pod)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				assert.Check(t, errdefs.IsInvalidInput(err))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.DeepEqual(tc.expectedSKU, sku))
+		})
+	}
+}
+
+func TestValidateContainerGroupSKU(t *testing.T) {
+	assert.Check(t, validateContainerGroupSKU(""))
+	assert.Check(t, validateContainerGroupSKU("Dedicated"))
+	assert.Check(t, is.ErrorContains(validateContainerGroupSKU("Confidential"), "not a valid container group SKU"))
+}
+
+func TestGetSKUError(t *testing.T) {
+	region := "westus"
+	cg := &azaciv2.ContainerGroup{
+		Location:   &region,
+		Properties: &azaciv2.ContainerGroupPropertiesProperties{SKU: skuPtr(azaciv2.ContainerGroupSKUDedicated)},
+	}
+	armErr := &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "SkuNotAvailable"}
+
+	err := getSKUError(armErr, cg)
+	assert.Check(t, is.ErrorContains(err, "the Dedicated container group SKU is not available in region westus"))
+	// the container group is still retried in the next region
+	assert.Check(t, isRegionCapacityError(err))
+	assert.Check(t, errors.Is(err, armErr))
+
+	// other errors and SKUs are left alone
+	otherErr := &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "InvalidImage"}
+	assert.Check(t, is.Equal(error(otherErr), getSKUError(otherErr, cg)))
+	cg.Properties.SKU = skuPtr(azaciv2.ContainerGroupSKUStandard)
+	assert.Check(t, is.Equal(error(armErr), getSKUError(armErr, cg)))
+}
+
+func skuPtr(sku azaciv2.ContainerGroupSKU) *azaciv2.ContainerGroupSKU {
+	return &sku
+}
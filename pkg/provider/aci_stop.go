@@ -0,0 +1,169 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// stopOnDeleteAnnotation set to "true" stops the container group of a pod when the pod is deleted instead of
+	// deleting it. The next pod with the same name and namespace, the annotation and the same containers and volumes
+	// starts the stopped container group again, keeping its name, identity and DNS name label, instead of creating
+	// a new one.
+	stopOnDeleteAnnotation = "virtual-kubelet.io/stop-on-delete"
+	// stoppedTag is set on the stopped container groups to when they were stopped, as RFC3339. The stopped container
+	// groups aren't pods of the node.
+	stoppedTag = "Stopped"
+	// podSpecHashTag is the hash of the containers and volumes of the pods whose container group is stopped on
+	// delete, see getPodSpecHash.
+	podSpecHashTag = "PodSpecHash"
+
+	eventReasonStoppedStarted = "StoppedContainerGroupStarted"
+)
+
+// isStoppedOnDelete returns whether the container group of a pod is stopped when the pod is deleted.
+func isStoppedOnDelete(pod *v1.Pod) (bool, error) {
+	value, ok := pod.Annotations[stopOnDeleteAnnotation]
+	if !ok {
+		return false, nil
+	}
+	stopped, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.InvalidInputf("the value %q of annotation %s is not a boolean", value, stopOnDeleteAnnotation)
+	}
+	return stopped, nil
+}
+
+// isContainerGroupStopped returns whether a container group was stopped on the deletion of its pod.
+func isContainerGroupStopped(cg *azaciv2.ContainerGroup) bool {
+	return cg != nil && cg.Tags[stoppedTag] != nil
+}
+
+// getPodSpecHash returns a hash of the containers and volumes of a pod, which must match for a stopped container
+// group to be started again for a new pod.
+func getPodSpecHash(pod *v1.Pod) string {
+	data, err := json.Marshal(struct {
+		InitContainers []v1.Container
+		Containers     []v1.Container
+		Volumes        []v1.Volume
+	}{pod.Spec.InitContainers, pod.Spec.Containers, pod.Spec.Volumes})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// setPodSpecHashTag tags the container group of a pod stopped on delete with the hash of its containers and volumes.
+func setPodSpecHashTag(pod *v1.Pod, cg *azaciv2.ContainerGroup) {
+	if stopped, _ := isStoppedOnDelete(pod); !stopped {
+		return
+	}
+	if hash := getPodSpecHash(pod); hash != "" {
+		cg.Tags[podSpecHashTag] = &hash
+	}
+}
+
+// stopContainerGroup stops the container group of a deleted pod and tags it as stopped, so that it isn't listed
+// as a pod of the node until it is started again. The container group is left running if it can't be stopped, and
+// the error of the tags is returned if it can't be tagged, so that the deletion of the pod is retried rather than the
+// stopped container group being listed as a pod of the node.
+func (p *ACIProvider) stopContainerGroup(ctx context.Context, pod *v1.Pod) error {
+	ctx, span := trace.StartSpan(ctx, "aci.stopContainerGroup")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	resourceGroup := p.getResourceGroup(pod.Namespace)
+	cgName := containerGroupName(pod.Namespace, pod.Name)
+
+	cg, err := p.azClientsAPIs.GetContainerGroup(ctx, resourceGroup, cgName)
+	if errdefs.IsNotFound(err) || (err == nil && cg == nil) {
+		p.terminatePodContainers(ctx, pod.Namespace, pod.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := p.azClientsAPIs.StopContainerGroup(ctx, resourceGroup, cgName); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to stop container group %v", cgName)
+		return err
+	}
+
+	tags := make(map[string]*string, len(cg.Tags)+1)
+	for key, value := range cg.Tags {
+		tags[key] = value
+	}
+	stopped := time.Now().UTC().Format(time.RFC3339)
+	tags[stoppedTag] = &stopped
+	if err := p.azClientsAPIs.UpdateContainerGroupTags(ctx, resourceGroup, cgName, tags); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to tag stopped container group %v", cgName)
+		return err
+	}
+
+	p.terminatePodContainers(ctx, pod.Namespace, pod.Name)
+	return nil
+}
+
+// startStoppedContainerGroup starts the stopped container group of a previous pod with the same name again for a
+// pod stopped on delete, with the tags of the pod. It returns whether it was started, and false when there is no
+// stopped container group or when the containers or volumes of the pod changed, so that it is recreated: the stopped
+// container group is then deleted first, as ARM would only update its tags and properties in place.
+func (p *ACIProvider) startStoppedContainerGroup(ctx context.Context, pod *v1.Pod, cg *azaciv2.ContainerGroup) (bool, error) {
+	if stopped, _ := isStoppedOnDelete(pod); !stopped {
+		return false, nil
+	}
+
+	resourceGroup := p.getResourceGroup(pod.Namespace)
+	cgName := containerGroupName(pod.Namespace, pod.Name)
+
+	existing, err := p.azClientsAPIs.GetContainerGroup(ctx, resourceGroup, cgName)
+	if errdefs.IsNotFound(err) || (err == nil && !isContainerGroupStopped(existing)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if stringValue(existing.Tags[podSpecHashTag]) != stringValue(cg.Tags[podSpecHashTag]) {
+		log.G(ctx).Infof("the containers or volumes of pod %s changed, recreating its stopped container group %s", pod.Name, cgName)
+		if err := p.azClientsAPIs.DeleteContainerGroupAndWait(ctx, resourceGroup, cgName); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	stoppedAt := stringValue(existing.Tags[stoppedTag])
+	tags := make(map[string]*string, len(cg.Tags)+1)
+	for key, value := range cg.Tags {
+		tags[key] = value
+	}
+	if region, ok := existing.Tags[regionTag]; ok {
+		tags[regionTag] = region
+	}
+	if err := p.azClientsAPIs.UpdateContainerGroupTags(ctx, resourceGroup, cgName, tags); err != nil {
+		return false, err
+	}
+	if err := p.azClientsAPIs.StartContainerGroup(ctx, resourceGroup, cgName); err != nil {
+		return false, err
+	}
+
+	log.G(ctx).Infof("started stopped container group %s for pod %s", cgName, pod.Name)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Eventf(pod, v1.EventTypeNormal, eventReasonStoppedStarted,
+			"Started container group %s, which was stopped at %s on the deletion of a previous pod", cgName, stoppedAt)
+	}
+	return true, nil
+}
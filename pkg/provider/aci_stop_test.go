@@ -0,0 +1,157 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestIsStoppedOnDelete(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	stopped, err := isStoppedOnDelete(pod)
+	assert.NilError(t, err)
+	assert.Check(t, !stopped)
+
+	pod.Annotations = map[string]string{stopOnDeleteAnnotation: "true"}
+	stopped, err = isStoppedOnDelete(pod)
+	assert.NilError(t, err)
+	assert.Check(t, stopped)
+
+	pod.Annotations[stopOnDeleteAnnotation] = "later"
+	_, err = isStoppedOnDelete(pod)
+	assert.Check(t, is.ErrorContains(err, "is not a boolean"))
+}
+
+func TestGetPodSpecHash(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	hash := getPodSpecHash(pod)
+	assert.Check(t, is.Len(hash, 16))
+
+	other := pod.DeepCopy()
+	other.Name = "other"
+	other.Spec.NodeName = "other-node"
+	assert.Check(t, is.Equal(hash, getPodSpecHash(other)))
+	other.Spec.Containers[0].Image = "nginx:next"
+	assert.Check(t, hash != getPodSpecHash(other))
+}
+
+func TestStopOnDelete(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var stored *azaciv2.ContainerGroup
+	var created, stopped, started, deleted, deletedAndWaited int
+	var tagErr error
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		created++
+		stored = cg
+		return nil
+	}
+	aciMocks.MockGetContainerGroup = func(ctx context.Context, resourceGroup, containerGroupName string) (*azaciv2.ContainerGroup, error) {
+		if stored == nil {
+			return nil, errdefs.NotFound("cg is not found")
+		}
+		return stored, nil
+	}
+	aciMocks.MockGetContainerGroupInfo = func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error) {
+		return stored, nil
+	}
+	aciMocks.MockStopContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		stopped++
+		return nil
+	}
+	aciMocks.MockStartContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		started++
+		return nil
+	}
+	aciMocks.MockUpdateContainerGroupTags = func(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+		if tagErr != nil {
+			return tagErr
+		}
+		stored.Tags = tags
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted++
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		deletedAndWaited++
+		stored = nil
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	newPod := func(uid, image string) *v1.Pod {
+		pod := testsutil.CreatePodObj("dev", "ns")
+		pod.UID = types.UID(uid)
+		pod.Annotations = map[string]string{stopOnDeleteAnnotation: "true"}
+		pod.Spec.Containers[0].Image = image
+		return pod
+	}
+	ctx := context.Background()
+
+	first := newPod("uid-1", "nginx")
+	assert.NilError(t, provider.CreatePod(ctx, first))
+	assert.Check(t, is.Equal(1, created))
+	assert.Check(t, stored.Tags[podSpecHashTag] != nil)
+
+	// the container group is stopped instead of deleted, and isn't a pod of the node anymore
+	assert.NilError(t, provider.DeletePod(ctx, first))
+	assert.Check(t, is.Equal(1, stopped))
+	assert.Check(t, is.Equal(0, deleted))
+	assert.Check(t, isContainerGroupStopped(stored))
+	_, err = provider.GetPod(ctx, "ns", "dev")
+	assert.Check(t, errdefs.IsNotFound(err))
+
+	// the next pod with the same containers starts it again with its tags
+	assert.NilError(t, provider.CreatePod(ctx, newPod("uid-2", "nginx")))
+	assert.Check(t, is.Equal(1, created))
+	assert.Check(t, is.Equal(1, started))
+	assert.Check(t, !isContainerGroupStopped(stored))
+	assert.Check(t, is.Equal("uid-2", *stored.Tags["UID"]))
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonProvisioning))
+	assert.Check(t, is.Contains(<-recorder.Events, "which was stopped at 20"))
+
+	// the container group is deleted and recreated when the containers changed
+	assert.NilError(t, provider.DeletePod(ctx, newPod("uid-2", "nginx")))
+	assert.NilError(t, provider.CreatePod(ctx, newPod("uid-3", "nginx:next")))
+	assert.Check(t, is.Equal(1, deletedAndWaited))
+	assert.Check(t, is.Equal(2, created))
+	assert.Check(t, is.Equal(1, started))
+	assert.Check(t, !isContainerGroupStopped(stored))
+
+	// the deletion fails when the stopped container group can't be tagged, so that it is retried
+	tagErr = errors.New("throttled")
+	assert.Check(t, is.ErrorContains(provider.DeletePod(ctx, newPod("uid-3", "nginx:next")), "throttled"))
+	assert.Check(t, !isContainerGroupStopped(stored))
+	tagErr = nil
+	assert.NilError(t, provider.DeletePod(ctx, newPod("uid-3", "nginx:next")))
+	assert.Check(t, isContainerGroupStopped(stored))
+
+	// the pods without the annotation are deleted
+	plain := newPod("uid-3", "nginx:next")
+	plain.Annotations = nil
+	assert.NilError(t, provider.DeletePod(ctx, plain))
+	assert.Check(t, is.Equal(1, deleted))
+}
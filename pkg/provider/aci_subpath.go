@@ -0,0 +1,163 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strings"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultVolumeMode is the mode the API server defaults the files of the secret and configMap volumes to.
+const defaultVolumeMode int32 = 0644
+
+// selectVolumeItems returns the files of a secret or configMap volume: all of its keys, or the keys its items
+// project to their paths, along with the keys of the items missing from an optional source. ACI secret volumes
+// are flat, so the paths of the items can't have directories.
+func selectVolumeItems(volumeName string, data map[string]*string, items []v1.KeyToPath, optional *bool) (map[string]*string, []string, error) {
+	if len(items) == 0 {
+		return data, nil, nil
+	}
+	files := make(map[string]*string, len(items))
+	var missing []string
+	for _, item := range items {
+		if strings.Contains(path.Clean(item.Path), "/") {
+			return nil, nil, errdefs.InvalidInputf("volume %s: ACI can't mount the file of key %s in a subdirectory, path %s must be a file name",
+				volumeName, item.Key, item.Path)
+		}
+		value, ok := data[item.Key]
+		if !ok {
+			if optional != nil && *optional {
+				missing = append(missing, item.Key)
+				continue
+			}
+			return nil, nil, fmt.Errorf("volume %s: key %s does not exist", volumeName, item.Key)
+		}
+		files[path.Clean(item.Path)] = value
+	}
+	return files, missing, nil
+}
+
+// hasCustomVolumeModes returns whether the files of a secret or configMap volume have other modes than the
+// default one, which ACI doesn't support.
+func hasCustomVolumeModes(defaultMode *int32, items []v1.KeyToPath) bool {
+	if defaultMode != nil && *defaultMode != defaultVolumeMode {
+		return true
+	}
+	for _, item := range items {
+		if item.Mode != nil && *item.Mode != defaultVolumeMode {
+			return true
+		}
+	}
+	return false
+}
+
+// applySubPathMounts emulates the volume mounts of a single file of a secret, configMap or projected volume with
+// subPath, which ACI can't mount: the files a container mounts in the same directory are put in a volume of
+// their own, mounted on that directory. The directory only contains these files in the container, hiding the
+// other files of the image there. It returns the volumes of the container group with the ones of the files.
+func applySubPathMounts(pod *v1.Pod, volumes []*azaciv2.Volume, containers []*azaciv2.Container,
+	initContainers []*azaciv2.InitContainerDefinition) ([]*azaciv2.Volume, error) {
+	volumesByName := make(map[string]*azaciv2.Volume, len(volumes))
+	for _, volume := range volumes {
+		volumesByName[*volume.Name] = volume
+	}
+
+	var err error
+	for i := range pod.Spec.InitContainers {
+		container := &pod.Spec.InitContainers[i]
+		for _, initContainer := range initContainers {
+			if *initContainer.Name == container.Name {
+				initContainer.Properties.VolumeMounts, volumes, err = getSubPathMounts(container, initContainer.Properties.VolumeMounts, volumesByName, volumes)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		for _, aciContainer := range containers {
+			if *aciContainer.Name == container.Name {
+				aciContainer.Properties.VolumeMounts, volumes, err = getSubPathMounts(container, aciContainer.Properties.VolumeMounts, volumesByName, volumes)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return volumes, nil
+}
+
+func getSubPathMounts(container *v1.Container, mounts []*azaciv2.VolumeMount, volumesByName map[string]*azaciv2.Volume,
+	volumes []*azaciv2.Volume) ([]*azaciv2.VolumeMount, []*azaciv2.Volume, error) {
+	// the volumes of the files of the container, by the directory they're mounted on
+	fileVolumes := map[string]*azaciv2.Volume{}
+	// the subPath mounts are replaced by the mount of the volume of their directory, or dropped when it is
+	// already mounted
+	replaced := map[string]*azaciv2.VolumeMount{}
+	for _, mount := range container.VolumeMounts {
+		if mount.SubPathExpr != "" {
+			return nil, nil, errdefs.InvalidInputf("container %s: ACI doesn't support subPathExpr, volume mount %s", container.Name, mount.Name)
+		}
+		if mount.SubPath == "" {
+			continue
+		}
+
+		source := volumesByName[mount.Name]
+		if source == nil || source.Secret == nil {
+			return nil, nil, errdefs.InvalidInputf("container %s: ACI can only mount a subPath of secret, configMap and projected volumes, "+
+				"volume %s is mounted with subPath %s", container.Name, mount.Name, mount.SubPath)
+		}
+		content, ok := source.Secret[path.Clean(mount.SubPath)]
+		if !ok {
+			return nil, nil, fmt.Errorf("container %s: subPath %s does not exist in volume %s", container.Name, mount.SubPath, mount.Name)
+		}
+
+		dir, file := path.Split(path.Clean(mount.MountPath))
+		dir = path.Clean(dir)
+		fileVolume := fileVolumes[dir]
+		var dirMount *azaciv2.VolumeMount
+		if fileVolume == nil {
+			name := getSubPathVolumeName(container.Name, dir)
+			fileVolume = &azaciv2.Volume{Name: &name, Secret: map[string]*string{}}
+			fileVolumes[dir] = fileVolume
+			volumes = append(volumes, fileVolume)
+			readOnly := true
+			dirMount = &azaciv2.VolumeMount{Name: &name, MountPath: &dir, ReadOnly: &readOnly}
+		}
+		fileVolume.Secret[file] = content
+		replaced[mount.Name+"\x00"+mount.MountPath] = dirMount
+	}
+	if len(replaced) == 0 {
+		return mounts, volumes, nil
+	}
+
+	result := make([]*azaciv2.VolumeMount, 0, len(mounts))
+	for _, mount := range mounts {
+		dirMount, ok := replaced[*mount.Name+"\x00"+*mount.MountPath]
+		if !ok {
+			result = append(result, mount)
+		} else if dirMount != nil {
+			result = append(result, dirMount)
+		}
+	}
+	return result, volumes, nil
+}
+
+// getSubPathVolumeName returns the name of the volume of the files a container mounts in a directory, unique
+// within the container group.
+func getSubPathVolumeName(containerName, dir string) string {
+	h := fnv.New32a()
+	h.Write([]byte(containerName))
+	h.Write([]byte{0})
+	h.Write([]byte(dir))
+	return fmt.Sprintf("subpath-%08x", h.Sum32())
+}
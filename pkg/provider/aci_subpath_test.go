@@ -0,0 +1,168 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newSubPathTestProvider(t *testing.T) *ACIProvider {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	assert.NilError(t, configMaps.Add(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nginx"},
+		Data:       map[string]string{"nginx.conf": "events {}", "default.conf": "server {}", "unused": "-"},
+	}))
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	assert.NilError(t, secrets.Add(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "tls"},
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}))
+	return &ACIProvider{
+		configL: corev1listers.NewConfigMapLister(configMaps),
+		secretL: corev1listers.NewSecretLister(secrets),
+	}
+}
+
+func encoded(value string) *string {
+	s := base64.StdEncoding.EncodeToString([]byte(value))
+	return &s
+}
+
+func TestGetVolumesItems(t *testing.T) {
+	p := newSubPathTestProvider(t)
+	mode := int32(0400)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "nginx"},
+				Items:                []v1.KeyToPath{{Key: "nginx.conf", Path: "main.conf"}},
+			}}},
+			{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+				SecretName:  "tls",
+				DefaultMode: &mode,
+			}}},
+		}},
+	}
+
+	volumes, err := p.getVolumes(context.Background(), pod)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 2))
+	assert.Check(t, is.DeepEqual(map[string]*string{"main.conf": encoded("events {}")}, volumes[0].Secret))
+	assert.Check(t, is.DeepEqual(map[string]*string{"tls.crt": encoded("cert"), "tls.key": encoded("key")}, volumes[1].Secret))
+
+	pod.Spec.Volumes[0].ConfigMap.Items = []v1.KeyToPath{{Key: "missing", Path: "missing"}}
+	_, err = p.getVolumes(context.Background(), pod)
+	assert.Check(t, is.ErrorContains(err, "key missing does not exist"))
+
+	optional := true
+	pod.Spec.Volumes[0].ConfigMap.Optional = &optional
+	volumes, err = p.getVolumes(context.Background(), pod)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 2))
+	assert.Check(t, volumes[0].EmptyDir != nil, "the volume without files is empty")
+
+	pod.Spec.Volumes[0].ConfigMap.Items = []v1.KeyToPath{{Key: "nginx.conf", Path: "conf/nginx.conf"}}
+	_, err = p.getVolumes(context.Background(), pod)
+	assert.Check(t, errdefs.IsInvalidInput(err))
+}
+
+func TestApplySubPathMounts(t *testing.T) {
+	p := newSubPathTestProvider(t)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "nginx"},
+				}}},
+				{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}},
+				{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+			Containers: []v1.Container{{
+				Name: "nginx",
+				VolumeMounts: []v1.VolumeMount{
+					{Name: "config", MountPath: "/etc/nginx/nginx.conf", SubPath: "nginx.conf"},
+					{Name: "config", MountPath: "/etc/nginx/conf.d/default.conf", SubPath: "default.conf"},
+					{Name: "tls", MountPath: "/etc/nginx/conf.d/tls.crt", SubPath: "tls.crt"},
+					{Name: "cache", MountPath: "/var/cache/nginx"},
+				},
+			}},
+		},
+	}
+
+	volumes, err := p.getVolumes(context.Background(), pod)
+	assert.NilError(t, err)
+	containers := []*azaciv2.Container{{
+		Name:       &pod.Spec.Containers[0].Name,
+		Properties: &azaciv2.ContainerProperties{VolumeMounts: p.getVolumeMounts(pod.Spec.Containers[0])},
+	}}
+	volumes, err = applySubPathMounts(pod, volumes, containers, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(volumes, 5))
+
+	mounts := map[string]string{}
+	for _, mount := range containers[0].Properties.VolumeMounts {
+		mounts[*mount.MountPath] = *mount.Name
+	}
+	assert.Check(t, is.DeepEqual(map[string]string{
+		"/etc/nginx":        getSubPathVolumeName("nginx", "/etc/nginx"),
+		"/etc/nginx/conf.d": getSubPathVolumeName("nginx", "/etc/nginx/conf.d"),
+		"/var/cache/nginx":  "cache",
+	}, mounts))
+
+	files := map[string]map[string]*string{}
+	for _, volume := range volumes[3:] {
+		files[*volume.Name] = volume.Secret
+	}
+	assert.Check(t, is.DeepEqual(map[string]map[string]*string{
+		getSubPathVolumeName("nginx", "/etc/nginx"):        {"nginx.conf": encoded("events {}")},
+		getSubPathVolumeName("nginx", "/etc/nginx/conf.d"): {"default.conf": encoded("server {}"), "tls.crt": encoded("cert")},
+	}, files))
+}
+
+func TestApplySubPathMountsUnsupported(t *testing.T) {
+	cases := []struct {
+		description string
+		mount       v1.VolumeMount
+		err         string
+	}{
+		{"empty dir", v1.VolumeMount{Name: "cache", MountPath: "/cache", SubPath: "nginx"}, "can only mount a subPath of secret, configMap and projected volumes"},
+		{"missing file", v1.VolumeMount{Name: "tls", MountPath: "/tls/ca.crt", SubPath: "ca.crt"}, "subPath ca.crt does not exist in volume tls"},
+		{"expression", v1.VolumeMount{Name: "cache", MountPath: "/cache", SubPathExpr: "$(POD_NAME)"}, "doesn't support subPathExpr"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "c", VolumeMounts: []v1.VolumeMount{tc.mount}}}},
+			}
+			tls := "tls"
+			cache := "cache"
+			volumes := []*azaciv2.Volume{
+				{Name: &tls, Secret: map[string]*string{"tls.crt": encoded("cert")}},
+				{Name: &cache, EmptyDir: map[string]interface{}{}},
+			}
+			containers := []*azaciv2.Container{{
+				Name:       &pod.Spec.Containers[0].Name,
+				Properties: &azaciv2.ContainerProperties{VolumeMounts: (&ACIProvider{}).getVolumeMounts(pod.Spec.Containers[0])},
+			}}
+			_, err := applySubPathMounts(pod, volumes, containers, nil)
+			assert.Check(t, is.ErrorContains(err, tc.err))
+		})
+	}
+}
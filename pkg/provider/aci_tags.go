@@ -0,0 +1,127 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// maxTagCount, maxTagNameLength and maxTagValueLength are the ARM limits for the tags of a resource.
+	maxTagCount       = 50
+	maxTagNameLength  = 512
+	maxTagValueLength = 256
+
+	// invalidTagNameCharacters can't be used in ARM tag names.
+	invalidTagNameCharacters = `<>%&\?/`
+)
+
+// internalTags are the tags the provider sets on every container group, which pod tags can't override.
+var internalTags = []string{"PodName", "NodeName", "Namespace", "UID", "CreationTimestamp", regionTag}
+
+// podTagLabel propagates a pod label to the container group tag with the given name.
+type podTagLabel struct {
+	label string
+	tag   string
+}
+
+// setupPodTags reads the ACI_POD_TAG_ANNOTATION_PREFIX and ACI_POD_TAG_LABELS environment variables, which
+// take precedence over the config file.
+func (p *ACIProvider) setupPodTags() error {
+	if prefix := os.Getenv("ACI_POD_TAG_ANNOTATION_PREFIX"); prefix != "" {
+		p.podTagAnnotationPrefix = prefix
+	}
+	if labels := os.Getenv("ACI_POD_TAG_LABELS"); labels != "" {
+		podTagLabels, err := parsePodTagLabels(strings.Split(labels, ","))
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_POD_TAG_LABELS: %v", err)
+		}
+		p.podTagLabels = podTagLabels
+	}
+	return nil
+}
+
+// parsePodTagLabels parses the pod labels propagated as tags. Each label can be renamed with label=tag,
+// as tag names can't contain a slash.
+func parsePodTagLabels(labels []string) ([]podTagLabel, error) {
+	var podTagLabels []podTagLabel
+	for _, l := range labels {
+		label, tag, ok := strings.Cut(strings.TrimSpace(l), "=")
+		if !ok {
+			tag = label
+		}
+		if label == "" {
+			continue
+		}
+		if err := validateTagName(tag); err != nil {
+			return nil, fmt.Errorf("invalid tag for pod label %s: %v", label, err)
+		}
+		podTagLabels = append(podTagLabels, podTagLabel{label: label, tag: tag})
+	}
+	return podTagLabels, nil
+}
+
+// getPodTags returns the container group tags of a pod from the annotations with the tag annotation prefix
+// and from the propagated labels. Annotation tags take precedence over label tags of the same name.
+func (p *ACIProvider) getPodTags(pod *v1.Pod) (map[string]*string, error) {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+
+	tags := map[string]*string{}
+	for _, l := range p.podTagLabels {
+		if value, ok := pod.Labels[l.label]; ok {
+			value := value
+			tags[l.tag] = &value
+		}
+	}
+
+	if p.podTagAnnotationPrefix != "" {
+		for key, value := range pod.Annotations {
+			name := strings.TrimPrefix(key, p.podTagAnnotationPrefix)
+			if name == key {
+				continue
+			}
+			if err := validateTagName(name); err != nil {
+				return nil, errdefs.InvalidInputf("invalid tag in annotation %s: %v", key, err)
+			}
+			if len(value) > maxTagValueLength {
+				return nil, errdefs.InvalidInputf("the value of annotation %s is longer than the %d characters allowed for tags", key, maxTagValueLength)
+			}
+			value := value
+			tags[name] = &value
+		}
+	}
+
+	if len(tags)+len(internalTags) > maxTagCount {
+		return nil, errdefs.InvalidInputf("the pod has %d tags, but container groups allow at most %d besides the %d tags of the provider",
+			len(tags), maxTagCount-len(internalTags), len(internalTags))
+	}
+	return tags, nil
+}
+
+// validateTagName validates a tag name against the ARM restrictions and the tags of the provider.
+func validateTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("tag name can not be empty")
+	}
+	if len(name) > maxTagNameLength {
+		return fmt.Errorf("tag name %s is longer than %d characters", name, maxTagNameLength)
+	}
+	if strings.ContainsAny(name, invalidTagNameCharacters) {
+		return fmt.Errorf("tag name %s contains one of the characters %s", name, invalidTagNameCharacters)
+	}
+	for _, tag := range internalTags {
+		// tag names are case insensitive
+		if strings.EqualFold(tag, name) {
+			return fmt.Errorf("tag %s is reserved for the provider, reserved tags are %s", name, strings.Join(internalTags, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+const podTagsCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+PodTagAnnotationPrefix = "tags.virtual-kubelet.io/"
+PodTagLabels = ["team", "app.kubernetes.io/name=app"]`
+
+func TestCreatePodWithTags(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	aciMocks := createNewACIMock()
+	var tags map[string]*string
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		tags = cg.Tags
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	assert.NilError(t, provider.loadConfig(bytes.NewReader([]byte(podTagsCfg))))
+
+	pod := testsutil.CreatePodObj(podName, podNamespace)
+	pod.Labels = map[string]string{
+		"team":                   "payments",
+		"app.kubernetes.io/name": "checkout",
+		"tier":                   "frontend",
+	}
+	pod.Annotations = map[string]string{
+		"tags.virtual-kubelet.io/costCenter": "1234",
+		"tags.virtual-kubelet.io/team":       "billing",
+		"example.com/other":                  "ignored",
+	}
+
+	assert.NilError(t, provider.CreatePod(context.Background(), pod))
+	assert.Check(t, is.Equal("1234", *tags["costCenter"]))
+	// annotations take precedence over labels
+	assert.Check(t, is.Equal("billing", *tags["team"]))
+	assert.Check(t, is.Equal("checkout", *tags["app"]))
+	assert.Check(t, is.Equal(podName, *tags["PodName"]))
+	assert.Check(t, is.Equal(podNamespace, *tags["Namespace"]))
+	assert.Check(t, is.Len(tags, 9))
+}
+
+func TestGetPodTagsErrors(t *testing.T) {
+	cases := []struct {
+		description   string
+		annotations   map[string]string
+		expectedError string
+	}{
+		{
+			description:   "reserved tag",
+			annotations:   map[string]string{"tags.virtual-kubelet.io/nodename": "other"},
+			expectedError: "tag nodename is reserved for the provider",
+		},
+		{
+			description:   "invalid character",
+			annotations:   map[string]string{"tags.virtual-kubelet.io/a/b": "c"},
+			expectedError: "tag name a/b contains one of the characters",
+		},
+		{
+			description:   "empty tag name",
+			annotations:   map[string]string{"tags.virtual-kubelet.io/": "c"},
+			expectedError: "tag name can not be empty",
+		},
+		{
+			description:   "value too long",
+			annotations:   map[string]string{"tags.virtual-kubelet.io/a": strings.Repeat("v", 257)},
+			expectedError: "longer than the 256 characters allowed for tags",
+		},
+	}
+
+	p := ACIProvider{podTagAnnotationPrefix: "tags.virtual-kubelet.io/"}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Annotations = tc.annotations
+
+			_, err := p.getPodTags(pod)
+			assert.Check(t, is.ErrorContains(err, tc.expectedError))
+			assert.Check(t, errdefs.IsInvalidInput(err))
+		})
+	}
+}
+
+func TestSetupPodTags(t *testing.T) {
+	t.Setenv("ACI_POD_TAG_ANNOTATION_PREFIX", "cost.example.com/")
+	t.Setenv("ACI_POD_TAG_LABELS", "team, example.com/owner=owner")
+
+	var p ACIProvider
+	assert.NilError(t, p.loadConfig(bytes.NewReader([]byte(podTagsCfg))))
+	assert.NilError(t, p.setupPodTags())
+	assert.Check(t, is.Equal("cost.example.com/", p.podTagAnnotationPrefix))
+	assert.Assert(t, is.Len(p.podTagLabels, 2))
+	assert.Check(t, p.podTagLabels[0] == podTagLabel{label: "team", tag: "team"})
+	assert.Check(t, p.podTagLabels[1] == podTagLabel{label: "example.com/owner", tag: "owner"})
+
+	t.Setenv("ACI_POD_TAG_LABELS", "example.com/owner")
+	assert.Check(t, is.ErrorContains(p.setupPodTags(), "error parsing ACI_POD_TAG_LABELS: invalid tag for pod label example.com/owner"))
+}
@@ -31,6 +31,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -634,59 +635,6 @@ func TestGetPodWithoutResourceRequestsLimits(t *testing.T) {
 	assert.Equal(t, ptrQuantity(resource.MustParse("0.99")).Value(), pod.Spec.Containers[0].Resources.Requests.Cpu().Value(), "Containers[0].Properties.Resources.Requests.CPU doesn't match")
 	assert.Equal(t, ptrQuantity(resource.MustParse("1.5G")).Value(), pod.Spec.Containers[0].Resources.Requests.Memory().Value(), "Containers[0].Properties.Resources.Requests.Memory doesn't match")
 }
-
-func TestPodToACISecretEnvVar(t *testing.T) {
-
-	testKey := "testVar"
-	testVal := "testVal"
-
-	e := corev1.EnvVar{
-		Name:  testKey,
-		Value: testVal,
-		ValueFrom: &corev1.EnvVarSource{
-			SecretKeyRef: &corev1.SecretKeySelector{},
-		},
-	}
-	aciEnvVar := getACIEnvVar(e)
-
-	if aciEnvVar.Value != nil {
-		t.Fatalf("ACI Env Variable Value should be empty for a secret")
-	}
-
-	if *aciEnvVar.Name != testKey {
-		t.Fatalf("ACI Env Variable Name does not match expected Name")
-	}
-
-	if *aciEnvVar.SecureValue != testVal {
-		t.Fatalf("ACI Env Variable Secure Value does not match expected value")
-	}
-}
-
-func TestPodToACIEnvVar(t *testing.T) {
-
-	testKey := "testVar"
-	testVal := "testVal"
-
-	e := corev1.EnvVar{
-		Name:      testKey,
-		Value:     testVal,
-		ValueFrom: &corev1.EnvVarSource{},
-	}
-	aciEnvVar := getACIEnvVar(e)
-
-	if aciEnvVar.SecureValue != nil {
-		t.Fatalf("ACI Env Variable Secure Value should be empty for non-secret variables")
-	}
-
-	if *aciEnvVar.Name != testKey {
-		t.Fatalf("ACI Env Variable Name does not match expected Name")
-	}
-
-	if *aciEnvVar.Value != testVal {
-		t.Fatalf("ACI Env Variable Value does not match expected value")
-	}
-}
-
 func setAuthConfig() error {
 	err := azConfig.SetAuthConfig(context.TODO())
 	if err != nil {
@@ -893,7 +841,7 @@ func TestGetProbe(t *testing.T) {
 			podProbe:        testsutil.CreatePodProbeObj(true, false),
 			podPorts:        testsutil.CreateContainerPortObj("https", 8888),
 			expectedCGProbe: nil,
-			expectedError:   fmt.Errorf("unable to find named port: %s", "http"),
+			expectedError:   fmt.Errorf("unable to find named port: %s, available named ports: %s", "http", "https"),
 		}, {
 			description:     "has_exec_with_port_info",
 			podProbe:        testsutil.CreatePodProbeObj(false, true),
@@ -920,14 +868,14 @@ func TestGetProbe(t *testing.T) {
 			podProbe:        testsutil.CreatePodProbeObj(true, false),
 			podPorts:        nil,
 			expectedCGProbe: nil,
-			expectedError:   fmt.Errorf("unable to find named port: %s", "http"),
+			expectedError:   fmt.Errorf("unable to find named port: %s, the pod does not declare any named ports", "http"),
 		},
 		{
 			description:     "has_httpGet_with_wrong_port_info",
 			podProbe:        testsutil.CreatePodProbeObj(true, false),
 			podPorts:        testsutil.CreateContainerPortObj("https", 8080),
 			expectedCGProbe: nil,
-			expectedError:   fmt.Errorf("unable to find named port: %s", "http"),
+			expectedError:   fmt.Errorf("unable to find named port: %s, available named ports: %s", "http", "https"),
 		},
 	}
 	for _, tc := range cases {
@@ -947,6 +895,66 @@ func TestGetProbe(t *testing.T) {
 	}
 }
 
+func TestGetProbePorts(t *testing.T) {
+	containers := []corev1.Container{
+		{Name: "app", Ports: testsutil.CreateContainerPortObj("http", 8080)},
+		{Name: "sidecar", Ports: testsutil.CreateContainerPortObj("metrics", 9090)},
+		{Name: "proxy", Ports: testsutil.CreateContainerPortObj("http", 15001)},
+	}
+
+	ports := getProbePorts(containers, 0)
+	assert.Check(t, is.DeepEqual([]string{"http", "metrics", "http"}, []string{ports[0].Name, ports[1].Name, ports[2].Name}))
+
+	probe := testsutil.CreatePodProbeObj(true, false)
+	probe.HTTPGet.Port = intstr.FromString("metrics")
+	cgProbe, err := getProbe(probe, ports)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(int32(9090), *cgProbe.HTTPGet.Port))
+
+	// the port of the container itself takes precedence over the ports of the other containers
+	cgProbe, err = getProbe(testsutil.CreatePodProbeObj(true, false), getProbePorts(containers, 2))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(int32(15001), *cgProbe.HTTPGet.Port))
+}
+
+func TestDelayForStartupProbe(t *testing.T) {
+	cases := []struct {
+		description          string
+		livenessInitialDelay int32
+		startupProbe         *corev1.Probe
+		expectedInitialDelay int32
+	}{
+		{
+			description:          "startup budget is added to the liveness delay",
+			livenessInitialDelay: 5,
+			startupProbe:         &corev1.Probe{InitialDelaySeconds: 10, PeriodSeconds: 5, FailureThreshold: 30},
+			expectedInitialDelay: 160,
+		},
+		{
+			description:          "kubernetes defaults are used for unset fields",
+			startupProbe:         &corev1.Probe{},
+			expectedInitialDelay: 30,
+		},
+		{
+			description:          "longer liveness delay is kept",
+			livenessInitialDelay: 300,
+			startupProbe:         &corev1.Probe{PeriodSeconds: 10, FailureThreshold: 6},
+			expectedInitialDelay: 300,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			livenessProbe := &corev1.Probe{InitialDelaySeconds: tc.livenessInitialDelay}
+			probe := &azaciv2.ContainerProbe{InitialDelaySeconds: &livenessProbe.InitialDelaySeconds}
+
+			delayForStartupProbe(probe, tc.startupProbe)
+
+			assert.Check(t, is.Equal(tc.expectedInitialDelay, *probe.InitialDelaySeconds))
+			assert.Check(t, is.Equal(tc.livenessInitialDelay, livenessProbe.InitialDelaySeconds), "pod spec should not be modified")
+		})
+	}
+}
+
 func TestCreatePodWithReadinessProbe(t *testing.T) {
 	podName := "pod-" + uuid.New().String()
 	podNamespace := "ns-" + uuid.New().String()
@@ -1166,7 +1174,7 @@ func TestGetPodWithContainerID(t *testing.T) {
 	assert.Check(t, is.Equal(util.GetContainerID(&cgID, &testsutil.TestContainerName), pod.Status.ContainerStatuses[0].ContainerID), "Container ID in the container status is not expected")
 }
 
-func TestFilterWindowsServiceAccountSecretVolume(t *testing.T) {
+func TestProjectWindowsServiceAccountSecretVolume(t *testing.T) {
 	cgName := "pod-" + uuid.New().String()
 	cgNamespace := "ns-" + uuid.New().String()
 	mockCtrl := gomock.NewController(t)
@@ -1184,8 +1192,12 @@ func TestFilterWindowsServiceAccountSecretVolume(t *testing.T) {
 			EmptyDir: &corev1.EmptyDirVolumeSource{},
 		},
 		{
-			Name:     &volMountName2,
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			Name: &volMountName2,
+			Secret: map[string]*string{
+				"token":     encoded("fake-token"),
+				"ca.crt":    encoded("fake-ca"),
+				"namespace": encoded(cgNamespace),
+			},
 		}}
 	nonServiceAccountSecretVolumeMount := []*azaciv2.VolumeMount{
 		{
@@ -1254,11 +1266,23 @@ func TestFilterWindowsServiceAccountSecretVolume(t *testing.T) {
 			assert.Check(t, cg.Properties.Containers != nil, "Containers should not be nil")
 			assert.Check(t, is.Equal(1, len(cg.Properties.Containers)), "1 Container is expected")
 
-			filterWindowsServiceAccountSecretVolume(context.Background(), tc.os, cg)
+			projectWindowsServiceAccountSecretVolume(context.Background(), tc.os, cg)
 
 			if tc.shouldFilter {
 				assert.Check(t, is.Equal(0, len(cg.Properties.Containers[0].Properties.VolumeMounts)), "should filter out volume mounts with service account secret volume name")
 				assert.Check(t, is.Equal(1, len(cg.Properties.Volumes)), "should filter out volume with service account secret volume name")
+				envVars := map[string]string{}
+				secure := map[string]bool{}
+				for _, envVar := range cg.Properties.Containers[0].Properties.EnvironmentVariables {
+					envVars[*envVar.Name] = stringValue(envVar.Value) + stringValue(envVar.SecureValue)
+					secure[*envVar.Name] = envVar.SecureValue != nil
+				}
+				assert.Check(t, is.DeepEqual(map[string]string{
+					serviceAccountTokenEnvVar:     "fake-token",
+					serviceAccountCACertEnvVar:    "fake-ca",
+					serviceAccountNamespaceEnvVar: cgNamespace,
+				}, envVars), "should project the service account files into environment variables")
+				assert.Check(t, secure[serviceAccountTokenEnvVar], "the token should be a secure value")
 			} else {
 				assert.Check(t, is.Equal(1, len(cg.Properties.Containers[0].Properties.VolumeMounts)), "volume mount should remain the same")
 				assert.Check(t, is.Equal(2, len(cg.Properties.Volumes)), "volume should remain the same")
@@ -1441,7 +1465,7 @@ func TestGetPodStatus(t *testing.T) {
 				assert.Check(t, podStatus.StartTime != nil, "podStatus start time should be set")
 				assert.Check(t, podStatus.ContainerStatuses != nil, "podStatus container statuses should be set")
 				assert.Check(t, is.Equal(podStatus.HostIP, provider.internalIP), "podStatus host IP should match")
-				assert.Check(t, is.Equal(len(podStatus.Conditions), 3), "3 pod conditions should be present")
+				assert.Check(t, is.Equal(len(podStatus.Conditions), 6), "6 pod conditions should be present")
 			}
 		})
 	}
@@ -1556,7 +1580,7 @@ func TestGetImagePullSecretsWithDockerCfgSecret(t *testing.T) {
 				t.Fatal("failed to create the test provider", err)
 			}
 
-			ips, err := provider.getImagePullSecrets(pod)
+			ips, err := provider.getImagePullSecrets(context.Background(), pod)
 
 			if tc.expectedError == nil {
 				assert.NilError(t, tc.expectedError, err)
@@ -1699,7 +1723,7 @@ func TestGetImagePullSecretsWithDockerConfigJSONSecret(t *testing.T) {
 				t.Fatal("failed to create the test provider", err)
 			}
 
-			ips, err := provider.getImagePullSecrets(pod)
+			ips, err := provider.getImagePullSecrets(context.Background(), pod)
 
 			if tc.expectedError == nil {
 				assert.NilError(t, tc.expectedError, err)
@@ -1762,7 +1786,7 @@ func TestGetContainerLogs(t *testing.T) {
 
 			aciMocks.MockListLogs =
 				func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
-
+					assert.Check(t, is.DeepEqual(api.ContainerLogOpts{Timestamps: true}, opts))
 					return tc.logContent, nil
 				}
 
@@ -1787,3 +1811,116 @@ func TestGetContainerLogs(t *testing.T) {
 	}
 
 }
+
+func TestGetRestartPolicy(t *testing.T) {
+	cases := []struct {
+		podPolicy      corev1.RestartPolicy
+		expectedPolicy azaciv2.ContainerGroupRestartPolicy
+		expectedError  string
+	}{
+		{podPolicy: "", expectedPolicy: azaciv2.ContainerGroupRestartPolicyAlways},
+		{podPolicy: corev1.RestartPolicyAlways, expectedPolicy: azaciv2.ContainerGroupRestartPolicyAlways},
+		{podPolicy: corev1.RestartPolicyOnFailure, expectedPolicy: azaciv2.ContainerGroupRestartPolicyOnFailure},
+		{podPolicy: corev1.RestartPolicyNever, expectedPolicy: azaciv2.ContainerGroupRestartPolicyNever},
+		{podPolicy: "Sometimes", expectedError: `unsupported restart policy "Sometimes"`},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.podPolicy), func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Spec.RestartPolicy = tc.podPolicy
+
+			policy, err := getRestartPolicy(pod)
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(tc.expectedPolicy, policy))
+		})
+	}
+}
+
+func TestGetGPUResource(t *testing.T) {
+	provider := ACIProvider{
+		region:  fakeRegion,
+		gpuSKUs: []azaciv2.GpuSKU{azaciv2.GpuSKUK80, azaciv2.GpuSKUV100},
+	}
+
+	cases := []struct {
+		description   string
+		annotations   map[string]string
+		resources     corev1.ResourceRequirements
+		expectedCount int32
+		expectedSKU   azaciv2.GpuSKU
+		expectedError string
+	}{
+		{
+			description: "no GPU",
+			resources:   corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}},
+		},
+		{
+			description:   "GPU in limits",
+			resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{gpuResourceName: resource.MustParse("2")}},
+			expectedCount: 2,
+			expectedSKU:   azaciv2.GpuSKUK80,
+		},
+		{
+			description:   "GPU in requests",
+			resources:     corev1.ResourceRequirements{Requests: corev1.ResourceList{gpuResourceName: resource.MustParse("1")}},
+			expectedCount: 1,
+			expectedSKU:   azaciv2.GpuSKUK80,
+		},
+		{
+			description:   "SKU from pod annotation",
+			annotations:   map[string]string{gpuTypeAnnotation: "v100"},
+			resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{gpuResourceName: resource.MustParse("1")}},
+			expectedCount: 1,
+			expectedSKU:   azaciv2.GpuSKUV100,
+		},
+		{
+			description:   "SKU from container annotation",
+			annotations:   map[string]string{gpuTypeAnnotation: "K80", gpuTypeAnnotation + ".c": "V100"},
+			resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{gpuResourceName: resource.MustParse("1")}},
+			expectedCount: 1,
+			expectedSKU:   azaciv2.GpuSKUV100,
+		},
+		{
+			description:   "unsupported SKU",
+			annotations:   map[string]string{gpuTypeAnnotation: "P100"},
+			resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{gpuResourceName: resource.MustParse("1")}},
+			expectedError: "the container c requires GPU SKU P100",
+		},
+		{
+			description: "request different from limit",
+			resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{gpuResourceName: resource.MustParse("1")},
+				Limits:   corev1.ResourceList{gpuResourceName: resource.MustParse("2")},
+			},
+			expectedError: "container c: nvidia.com/gpu request 1 must be equal to its limit 2",
+		},
+		{
+			description:   "fractional GPU",
+			resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{gpuResourceName: resource.MustParse("500m")}},
+			expectedError: "container c: nvidia.com/gpu must be a positive integer number, got 500m",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj("pod", "ns")
+			pod.Annotations = tc.annotations
+
+			gpu, err := provider.getGPUResource(pod, corev1.Container{Name: "c", Resources: tc.resources})
+			if tc.expectedError != "" {
+				assert.Check(t, is.ErrorContains(err, tc.expectedError))
+				return
+			}
+			assert.NilError(t, err)
+			if tc.expectedCount == 0 {
+				assert.Check(t, gpu == nil)
+				return
+			}
+			assert.Check(t, is.Equal(tc.expectedCount, *gpu.Count))
+			assert.Check(t, is.Equal(tc.expectedSKU, *gpu.SKU))
+		})
+	}
+}
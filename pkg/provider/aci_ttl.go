@@ -0,0 +1,178 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ttlAfterStartAnnotation is the duration after which the container group of a running pod is deleted, e.g.
+	// "8h" for a development sandbox.
+	ttlAfterStartAnnotation = "virtual-kubelet.io/ttl-after-start"
+	// podStatusReasonTTLExpired is the reason of the status of the pods stopped by their TTL, and of their event.
+	podStatusReasonTTLExpired = "TTLExpired"
+
+	podTTLExpirationInterval = 30 * time.Second
+)
+
+// getPodTTLAfterStart returns the TTL of a pod after its start, false when it has none.
+func getPodTTLAfterStart(pod *v1.Pod) (time.Duration, bool, error) {
+	value, ok := pod.Annotations[ttlAfterStartAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, false, errdefs.InvalidInputf("invalid %s annotation %q of pod %s/%s, expected a positive duration like 8h",
+			ttlAfterStartAnnotation, value, pod.Namespace, pod.Name)
+	}
+	return ttl, true, nil
+}
+
+// podTTLExpiration remembers the pods stopped by their TTL until the tracker reports them as completed, not to
+// stop them again.
+type podTTLExpiration struct {
+	lock    sync.Mutex
+	expired map[types.UID]bool
+}
+
+// StartPodTTLExpiration stops the running pods whose TTL after start expired: their container groups are deleted,
+// so that they stop costing, and the pods are reported as completed.
+func (p *ACIProvider) StartPodTTLExpiration(ctx context.Context) {
+	p.podTTLExpiration = &podTTLExpiration{expired: make(map[types.UID]bool)}
+
+	go func() {
+		timer := time.NewTimer(podTTLExpirationInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			p.expirePods(ctx, time.Now())
+			timer.Reset(podTTLExpirationInterval)
+		}
+	}()
+}
+
+// expirePods stops the running pods which were started for longer than their TTL.
+func (p *ACIProvider) expirePods(ctx context.Context, now time.Time) {
+	ctx, span := trace.StartSpan(ctx, "aci.expirePods")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	if !p.isLeading() {
+		return
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to list the pods to stop the expired ones")
+		return
+	}
+
+	e := p.podTTLExpiration
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	existing := make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		existing[pod.UID] = true
+		if e.expired[pod.UID] || pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning || pod.Status.StartTime == nil {
+			continue
+		}
+		ttl, ok, err := getPodTTLAfterStart(pod)
+		if err != nil || !ok || now.Sub(pod.Status.StartTime.Time) < ttl {
+			continue
+		}
+
+		if err := p.stopExpiredPod(ctx, pod, ttl); err != nil {
+			log.G(ctx).WithError(err).Warnf("unable to stop pod %s/%s after its TTL", pod.Namespace, pod.Name)
+			continue
+		}
+		e.expired[pod.UID] = true
+	}
+
+	for uid := range e.expired {
+		if !existing[uid] {
+			delete(e.expired, uid)
+		}
+	}
+}
+
+// stopExpiredPod deletes the container group of a pod whose TTL expired and reports the pod as succeeded, or as
+// failed when one of its containers failed before.
+func (p *ACIProvider) stopExpiredPod(ctx context.Context, pod *v1.Pod, ttl time.Duration) error {
+	message := fmt.Sprintf("stopped after its TTL of %s since its start", ttl)
+	p.announceDisruption(ctx, pod, "deleting the container group: "+message)
+	p.archivePodLogsBeforeDeletion(ctx, pod)
+	release, err := p.deleteQueue.acquire(ctx, pod.Namespace, getPodPriority(pod))
+	if err != nil {
+		return err
+	}
+	err = p.deletePodContainerGroup(ctx, pod, false)
+	release()
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	log.G(ctx).Infof("pod %s/%s %s", pod.Namespace, pod.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeNormal, podStatusReasonTTLExpired, message)
+	}
+	if p.tracker == nil {
+		return nil
+	}
+
+	updateErr := p.tracker.UpdatePodStatus(ctx, pod.Namespace, pod.Name, func(podStatus *v1.PodStatus) {
+		podStatus.Phase = getTTLExpiredPhase(podStatus.ContainerStatuses)
+		podStatus.Reason = podStatusReasonTTLExpired
+		podStatus.Message = message
+		setPodCondition(podStatus, getDisruptionCondition("deleting the container group: "+message))
+		now := metav1.NewTime(time.Now())
+		for i := range podStatus.ContainerStatuses {
+			podStatus.ContainerStatuses[i].Ready = false
+			if podStatus.ContainerStatuses[i].State.Running == nil {
+				continue
+			}
+			podStatus.ContainerStatuses[i].State.Terminated = &v1.ContainerStateTerminated{
+				Reason:      podStatusReasonTTLExpired,
+				Message:     message,
+				FinishedAt:  now,
+				StartedAt:   podStatus.ContainerStatuses[i].State.Running.StartedAt,
+				ContainerID: podStatus.ContainerStatuses[i].ContainerID,
+			}
+			podStatus.ContainerStatuses[i].State.Running = nil
+		}
+	}, false)
+	if updateErr != nil && !errdefs.IsNotFound(updateErr) {
+		log.G(ctx).WithError(updateErr).Errorf("failed to report pod %s/%s as stopped after its TTL", pod.Namespace, pod.Name)
+	}
+	return nil
+}
+
+// getTTLExpiredPhase returns the phase of a pod stopped by its TTL: the running containers are stopped as
+// expected, so the pod succeeded unless one of its containers failed or is waiting to be restarted.
+func getTTLExpiredPhase(statuses []v1.ContainerStatus) v1.PodPhase {
+	for _, status := range statuses {
+		if status.State.Waiting != nil || (status.State.Terminated != nil && status.State.Terminated.ExitCode != 0) {
+			return v1.PodFailed
+		}
+	}
+	return v1.PodSucceeded
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetPodTTLAfterStart(t *testing.T) {
+	pod := testsutil.CreatePodObj("pod", "ns")
+	_, ok, err := getPodTTLAfterStart(pod)
+	assert.NilError(t, err)
+	assert.Check(t, !ok)
+
+	pod.Annotations = map[string]string{ttlAfterStartAnnotation: "1h30m"}
+	ttl, ok, err := getPodTTLAfterStart(pod)
+	assert.NilError(t, err)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(90*time.Minute, ttl))
+
+	for _, value := range []string{"tomorrow", "-1h", "0s"} {
+		pod.Annotations[ttlAfterStartAnnotation] = value
+		_, _, err = getPodTTLAfterStart(pod)
+		assert.Check(t, errdefs.IsInvalidInput(err), value)
+	}
+}
+
+func TestGetTTLExpiredPhase(t *testing.T) {
+	running := v1.ContainerStatus{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}
+	succeeded := v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}}
+	failed := v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1}}}
+	crashing := v1.ContainerStatus{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+
+	assert.Check(t, is.Equal(v1.PodSucceeded, getTTLExpiredPhase([]v1.ContainerStatus{running, succeeded})))
+	assert.Check(t, is.Equal(v1.PodFailed, getTTLExpiredPhase([]v1.ContainerStatus{running, failed})))
+	assert.Check(t, is.Equal(v1.PodFailed, getTTLExpiredPhase([]v1.ContainerStatus{running, crashing})))
+}
+
+func TestExpirePods(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Now()
+	pods := testsutil.CreatePodsList([]string{"expired", "recent", "no-ttl", "completed"}, "ns")
+	for _, pod := range pods {
+		pod.UID = types.UID(pod.Name)
+		pod.Annotations = map[string]string{ttlAfterStartAnnotation: "1h"}
+		pod.Status.Phase = v1.PodRunning
+		pod.Status.StartTime = &metav1.Time{Time: now.Add(-2 * time.Hour)}
+	}
+	pods[1].Status.StartTime = &metav1.Time{Time: now.Add(-30 * time.Minute)}
+	pods[2].Annotations = nil
+	pods[3].Status.Phase = v1.PodSucceeded
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+	var deleted []string
+	aciMocks := createNewACIMock()
+	aciMocks.MockDeleteContainerGroup = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted = append(deleted, cgName)
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	provider.podTTLExpiration = &podTTLExpiration{expired: make(map[types.UID]bool)}
+	recorder := record.NewFakeRecorder(10)
+	provider.SetEventRecorder(recorder)
+
+	provider.expirePods(context.Background(), now)
+	assert.Check(t, is.DeepEqual([]string{containerGroupName("ns", "expired")}, deleted))
+	// the deletion is announced beforehand
+	assert.Assert(t, is.Len(recorder.Events, 2))
+	assert.Check(t, is.Contains(<-recorder.Events, eventReasonDisruptionTarget))
+	assert.Check(t, is.Contains(<-recorder.Events, podStatusReasonTTLExpired))
+
+	// the pods are stopped once
+	provider.expirePods(context.Background(), now.Add(time.Hour))
+	assert.Check(t, is.DeepEqual([]string{
+		containerGroupName("ns", "expired"),
+		containerGroupName("ns", "recent"),
+	}, deleted))
+}
@@ -0,0 +1,250 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// volumeSourceChangePolicyRestart updates the container group of a pod in place with the new files of its
+	// volumes, which ACI applies by restarting its containers.
+	volumeSourceChangePolicyRestart = "Restart"
+	// volumeSourceChangePolicyRecreate evicts the pod so that its controller recreates it with a new container
+	// group, one pod per controller at a time, the pods without a controller are restarted instead.
+	volumeSourceChangePolicyRecreate = "Recreate"
+
+	// volumeSourcesTag is the version of the secrets and config maps mounted by the container group of a pod, set
+	// while a volume source change policy is configured.
+	volumeSourcesTag                = "VolumeSources"
+	volumeSourceSyncInterval        = time.Minute
+	eventReasonVolumeSourcesChanged = "VolumeSourcesChanged"
+)
+
+func validateVolumeSourceChangePolicy(policy string) error {
+	switch policy {
+	case "", volumeSourceChangePolicyRestart, volumeSourceChangePolicyRecreate:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid volume source change policy, expected %s or %s", policy,
+		volumeSourceChangePolicyRestart, volumeSourceChangePolicyRecreate)
+}
+
+func (p *ACIProvider) getVolumeSourceChangePolicy() string {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+	return p.volumeSourceChangePolicy
+}
+
+// getVolumeSourcesVersion returns a version of the secrets and config maps the volumes of a pod mount, which
+// changes whenever the files of one of them change or one of them is created or deleted, but not with the updates
+// of their metadata, or "" when the pod mounts none.
+func (p *ACIProvider) getVolumeSourcesVersion(pod *v1.Pod) string {
+	var sources []string
+	addSecret := func(name string) {
+		version := ""
+		if secret, err := p.secretL.Secrets(pod.Namespace).Get(name); err == nil && secret != nil {
+			version = hashVolumeSourceData(nil, secret.Data)
+		}
+		sources = append(sources, "secret/"+name+"@"+version)
+	}
+	addConfigMap := func(name string) {
+		version := ""
+		if configMap, err := p.configL.ConfigMaps(pod.Namespace).Get(name); err == nil && configMap != nil {
+			version = hashVolumeSourceData(configMap.Data, configMap.BinaryData)
+		}
+		sources = append(sources, "configmap/"+name+"@"+version)
+	}
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.Secret != nil:
+			addSecret(volume.Secret.SecretName)
+		case volume.ConfigMap != nil:
+			addConfigMap(volume.ConfigMap.Name)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					addSecret(source.Secret.Name)
+				}
+				if source.ConfigMap != nil {
+					addConfigMap(source.ConfigMap.Name)
+				}
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return ""
+	}
+
+	sort.Strings(sources)
+	h := fnv.New64a()
+	for _, source := range sources {
+		h.Write([]byte(source))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// hashVolumeSourceData returns a hash of the files of a secret or config map.
+func hashVolumeSourceData(data map[string]string, binaryData map[string][]byte) string {
+	files := make(map[string][]byte, len(data)+len(binaryData))
+	for key, value := range data {
+		files[key] = []byte(value)
+	}
+	for key, value := range binaryData {
+		files[key] = value
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s:%d:", key, len(files[key]))
+		h.Write(files[key])
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// StartVolumeSourceSync periodically looks for the running pods of the node whose mounted secrets and config maps
+// changed since the creation of their container groups, and applies the volume source change policy to them so
+// that they pick up the new files, as ACI doesn't update the files of the secret volumes of running containers.
+func (p *ACIProvider) StartVolumeSourceSync(ctx context.Context, pods corev1client.PodsGetter) {
+	go func() {
+		timer := time.NewTimer(volumeSourceSyncInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if err := p.syncVolumeSources(ctx, pods); err != nil {
+				log.G(ctx).WithError(err).Warn("failed to sync the volume sources of the pods of the node")
+			}
+			timer.Reset(volumeSourceSyncInterval)
+		}
+	}()
+}
+
+// syncVolumeSources restarts or recreates the pods whose volume sources changed. The container groups created
+// before the policy was configured have no version and are left alone. The pods are recreated with the eviction
+// API, so that their disruption budgets are honored, and one pod per controller at a time: the pods of a controller
+// are left alone while another of its pods is evicted in the same sync or still terminating.
+func (p *ACIProvider) syncVolumeSources(ctx context.Context, client corev1client.PodsGetter) error {
+	policy := p.getVolumeSourceChangePolicy()
+	if policy == "" || !p.isLeading() {
+		return nil
+	}
+
+	ctx, span := trace.StartSpan(ctx, "aci.syncVolumeSources")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	// the versions and regions of the container groups of the node, by namespace/name of their pods
+	versions := map[string]string{}
+	regions := map[string]string{}
+	for _, resourceGroup := range p.getResourceGroups() {
+		cgs, err := p.azClientsAPIs.GetContainerGroupListResult(ctx, resourceGroup)
+		if err != nil {
+			return err
+		}
+		for _, cg := range cgs {
+			if cg == nil || stringValue(cg.Tags["NodeName"]) != p.nodeName || cg.Tags[volumeSourcesTag] == nil {
+				continue
+			}
+			key := stringValue(cg.Tags["Namespace"]) + "/" + stringValue(cg.Tags["PodName"])
+			versions[key] = *cg.Tags[volumeSourcesTag]
+			regions[key] = stringValue(cg.Tags[regionTag])
+		}
+	}
+
+	// the controllers already recreating one of their pods, by namespace/kind/name
+	recreating := map[string]bool{}
+	for _, pod := range pods {
+		if owner := metav1.GetControllerOf(pod); owner != nil && pod.DeletionTimestamp != nil {
+			recreating[pod.Namespace+"/"+owner.Kind+"/"+owner.Name] = true
+		}
+	}
+
+	for _, pod := range pods {
+		key := pod.Namespace + "/" + pod.Name
+		version, ok := versions[key]
+		if !ok || pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		current := p.getVolumeSourcesVersion(pod)
+		if current == version {
+			continue
+		}
+
+		if owner := metav1.GetControllerOf(pod); policy == volumeSourceChangePolicyRecreate && owner != nil {
+			controller := pod.Namespace + "/" + owner.Kind + "/" + owner.Name
+			if recreating[controller] {
+				continue
+			}
+			recreating[controller] = true
+			err := client.Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+				ObjectMeta:    metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+				DeleteOptions: &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}},
+			})
+			switch {
+			case apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				log.G(ctx).Infof("the disruption budget of pod %s doesn't allow its eviction yet", key)
+			case err != nil:
+				log.G(ctx).WithError(err).Warnf("failed to evict pod %s with changed volume sources", key)
+			default:
+				p.recordVolumeSourcesChanged(pod, "the secrets or config maps mounted by the pod changed, evicted it so that its controller recreates it")
+			}
+			continue
+		}
+
+		p.recordVolumeSourcesChanged(pod, "the secrets or config maps mounted by the pod changed, restarting its containers")
+		if err := p.CreatePod(ctx, pinPodRegion(pod, regions[key])); err != nil {
+			log.G(ctx).WithError(err).Warnf("failed to restart pod %s with changed volume sources", key)
+		}
+	}
+	return nil
+}
+
+// pinPodRegion returns a copy of a pod whose container group is updated in place in its region, rather than
+// placed in the next region.
+func pinPodRegion(pod *v1.Pod, region string) *v1.Pod {
+	pod = pod.DeepCopy()
+	if region == "" {
+		return pod
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[regionAnnotation] = region
+	return pod
+}
+
+func (p *ACIProvider) recordVolumeSourcesChanged(pod *v1.Pod, message string) {
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(pod, v1.EventTypeNormal, eventReasonVolumeSourcesChanged, message)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// recordEvictions makes a fake client record the names of the pods it evicts.
+func recordEvictions(client *fake.Clientset) *[]string {
+	evicted := &[]string{}
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		*evicted = append(*evicted, action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction).Name)
+		return true, nil, nil
+	})
+	return evicted
+}
+
+func TestGetVolumeSourcesVersion(t *testing.T) {
+	p := newSubPathTestProvider(t)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		}},
+	}
+	assert.Check(t, is.Equal("", p.getVolumeSourcesVersion(pod)), "the pods without secrets nor config maps have no version")
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes,
+		v1.Volume{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}},
+		v1.Volume{Name: "all", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+			{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: "nginx"}}},
+		}}}})
+	version := p.getVolumeSourcesVersion(pod)
+	assert.Check(t, version != "")
+	assert.Check(t, is.Equal(version, p.getVolumeSourcesVersion(pod)))
+
+	configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, configMaps.Add(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nginx", ResourceVersion: "2"}}))
+	p.configL = corev1listers.NewConfigMapLister(configMaps)
+	assert.Check(t, version != p.getVolumeSourcesVersion(pod), "the version changes with the projected config map")
+
+	version = p.getVolumeSourcesVersion(pod)
+	assert.NilError(t, configMaps.Update(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nginx", ResourceVersion: "3", Labels: map[string]string{"app": "nginx"}},
+	}))
+	assert.Check(t, is.Equal(version, p.getVolumeSourcesVersion(pod)), "the version doesn't change with the metadata")
+	assert.NilError(t, configMaps.Update(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nginx", ResourceVersion: "4"},
+		Data:       map[string]string{"nginx.conf": "worker_processes 1;"},
+	}))
+	assert.Check(t, version != p.getVolumeSourcesVersion(pod), "the version changes with the files")
+}
+
+func TestSyncVolumeSources(t *testing.T) {
+	cases := []struct {
+		description string
+		policy      string
+		controlled  bool
+		restarted   bool
+		evicted     bool
+	}{
+		{"restart", volumeSourceChangePolicyRestart, true, true, false},
+		{"recreate", volumeSourceChangePolicyRecreate, true, false, true},
+		{"recreate without controller", volumeSourceChangePolicyRecreate, false, true, false},
+		{"ignored", "", true, false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			pod := testsutil.CreatePodObj("web", "ns")
+			pod.Spec.NodeName = fakeNodeName
+			pod.Status.Phase = v1.PodRunning
+			pod.Spec.Volumes = []v1.Volume{{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}}}
+			if tc.controlled {
+				controller := true
+				pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web", Controller: &controller}}
+			}
+			podLister := NewMockPodLister(mockCtrl)
+			podLister.EXPECT().List(gomock.Any()).Return([]*v1.Pod{pod}, nil).AnyTimes()
+
+			aciMocks := createNewACIMock()
+			aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+				cg := testsutil.CreateContainerGroupObj(pod.Name, pod.Namespace, "Running", nil, "Succeeded")
+				nodeName := fakeNodeName
+				version := "outdated"
+				region := fakeRegion
+				cg.Tags["NodeName"] = &nodeName
+				cg.Tags[volumeSourcesTag] = &version
+				cg.Tags[regionTag] = &region
+				return []*azaciv2.ContainerGroup{cg}, nil
+			}
+			var created *azaciv2.ContainerGroup
+			aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+				created = cg
+				return nil
+			}
+
+			provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), podLister)
+			assert.NilError(t, err)
+			secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			assert.NilError(t, secrets.Add(&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "tls", ResourceVersion: "7"},
+				Data:       map[string][]byte{"tls.crt": []byte("cert")},
+			}))
+			provider.secretL = corev1listers.NewSecretLister(secrets)
+			provider.volumeSourceChangePolicy = tc.policy
+
+			client := fake.NewSimpleClientset(pod)
+			evicted := recordEvictions(client)
+			assert.NilError(t, provider.syncVolumeSources(context.Background(), client.CoreV1()))
+
+			if tc.restarted {
+				assert.Assert(t, created != nil, "the container group is updated with the new files")
+				assert.Check(t, is.Equal(provider.getVolumeSourcesVersion(pod), stringValue(created.Tags[volumeSourcesTag])))
+			} else {
+				assert.Check(t, created == nil)
+			}
+			assert.Check(t, is.Equal(tc.evicted, len(*evicted) == 1))
+		})
+	}
+}
+
+func TestSyncVolumeSourcesRecreateOnePodPerController(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	controller := true
+	pods := testsutil.CreatePodsList([]string{"web-1", "web-2", "api-1"}, "ns")
+	for _, pod := range pods {
+		pod.Status.Phase = v1.PodRunning
+		pod.Spec.Volumes = []v1.Volume{{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}}}
+		owner := strings.Split(pod.Name, "-")[0]
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: owner, Controller: &controller}}
+	}
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(pods, nil).AnyTimes()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockGetContainerGroupList = func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error) {
+		var cgs []*azaciv2.ContainerGroup
+		for _, pod := range pods {
+			cg := testsutil.CreateContainerGroupObj(pod.Name, pod.Namespace, "Running", nil, "Succeeded")
+			nodeName, version := fakeNodeName, "outdated"
+			cg.Tags["NodeName"] = &nodeName
+			cg.Tags[volumeSourcesTag] = &version
+			cgs = append(cgs, cg)
+		}
+		return cgs, nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl), NewMockSecretLister(mockCtrl), podLister)
+	assert.NilError(t, err)
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	provider.secretL = corev1listers.NewSecretLister(secrets)
+	provider.volumeSourceChangePolicy = volumeSourceChangePolicyRecreate
+
+	client := fake.NewSimpleClientset()
+	evicted := recordEvictions(client)
+	assert.NilError(t, provider.syncVolumeSources(context.Background(), client.CoreV1()))
+	assert.Check(t, is.DeepEqual([]string{"web-1", "api-1"}, *evicted))
+
+	// the other pods of the controller wait for the evicted pod to be deleted
+	now := metav1.Now()
+	pods[0].DeletionTimestamp = &now
+	*evicted = nil
+	assert.NilError(t, provider.syncVolumeSources(context.Background(), client.CoreV1()))
+	assert.Check(t, is.DeepEqual([]string{"api-1"}, *evicted))
+}
@@ -47,11 +47,13 @@ func (p *ACIProvider) getAzureFileCSI(volume v1.Volume, namespace string) (*azac
 
 	storageAccountNameStr := string(secret.Data[azureFileStorageAccountName])
 	storageAccountKeyStr := string(secret.Data[azureFileStorageAccountKey])
+	readOnly := volume.CSI.ReadOnly != nil && *volume.CSI.ReadOnly
 
 	return &azaciv2.Volume{
 		Name: &volume.Name,
 		AzureFile: &azaciv2.AzureFileVolume{
 			ShareName:          &shareName,
+			ReadOnly:           &readOnly,
 			StorageAccountName: &storageAccountNameStr,
 			StorageAccountKey:  &storageAccountKeyStr,
 		}}, nil
@@ -126,12 +128,16 @@ func (p *ACIProvider) getVolumes(ctx context.Context, pod *v1.Pod) ([]*azaciv2.V
 
 		// Handle the case for Secret volume.
 		if podVolumes[i].Secret != nil {
+			source := podVolumes[i].Secret
 			paths := make(map[string]*string)
-			secret, err := p.secretL.Secrets(pod.Namespace).Get(podVolumes[i].Secret.SecretName)
-			if podVolumes[i].Secret.Optional != nil && !*podVolumes[i].Secret.Optional && k8serr.IsNotFound(err) {
-				return nil, fmt.Errorf("secret %s is required by Pod %s and does not exist", podVolumes[i].Secret.SecretName, pod.Name)
-			}
-			if secret == nil {
+			secret, err := p.secretL.Secrets(pod.Namespace).Get(source.SecretName)
+			if err != nil || secret == nil {
+				volume, err := p.getMissingVolumeSource(ctx, pod, &podVolumes[i], err, source.Optional, eventReasonOptionalSecretNotFound,
+					fmt.Errorf("secret %s is required by Pod %s and does not exist", source.SecretName, pod.Name))
+				if err != nil {
+					return nil, err
+				}
+				volumes = append(volumes, volume)
 				continue
 			}
 
@@ -139,24 +145,33 @@ func (p *ACIProvider) getVolumes(ctx context.Context, pod *v1.Pod) ([]*azaciv2.V
 				strV := base64.StdEncoding.EncodeToString(v)
 				paths[k] = &strV
 			}
-
-			if len(paths) != 0 {
-				volumes = append(volumes, &azaciv2.Volume{
-					Name:   &podVolumes[i].Name,
-					Secret: paths,
-				})
+			paths, missing, err := selectVolumeItems(podVolumes[i].Name, paths, source.Items, source.Optional)
+			if err != nil {
+				return nil, err
+			}
+			if len(missing) > 0 {
+				p.reportOptionalVolumeSource(ctx, pod, eventReasonOptionalSecretKeyNotFound,
+					fmt.Sprintf("keys %v of the optional secret %s of volume %s do not exist", missing, source.SecretName, podVolumes[i].Name))
+			}
+			if hasCustomVolumeModes(source.DefaultMode, source.Items) {
+				log.G(ctx).Warnf("pod %s: ACI doesn't support the file modes of volume %s, ignoring them", pod.Name, podVolumes[i].Name)
 			}
+			volumes = append(volumes, getSecretVolume(podVolumes[i].Name, paths))
 			continue
 		}
 
 		// Handle the case for ConfigMap volume.
 		if podVolumes[i].ConfigMap != nil {
+			source := podVolumes[i].ConfigMap
 			paths := make(map[string]*string)
-			configMap, err := p.configL.ConfigMaps(pod.Namespace).Get(podVolumes[i].ConfigMap.Name)
-			if podVolumes[i].ConfigMap.Optional != nil && !*podVolumes[i].ConfigMap.Optional && k8serr.IsNotFound(err) {
-				return nil, fmt.Errorf("ConfigMap %s is required by Pod %s and does not exist", podVolumes[i].ConfigMap.Name, pod.Name)
-			}
-			if configMap == nil {
+			configMap, err := p.configL.ConfigMaps(pod.Namespace).Get(source.Name)
+			if err != nil || configMap == nil {
+				volume, err := p.getMissingVolumeSource(ctx, pod, &podVolumes[i], err, source.Optional, eventReasonOptionalConfigMapNotFound,
+					fmt.Errorf("ConfigMap %s is required by Pod %s and does not exist", source.Name, pod.Name))
+				if err != nil {
+					return nil, err
+				}
+				volumes = append(volumes, volume)
 				continue
 			}
 
@@ -168,13 +183,18 @@ func (p *ACIProvider) getVolumes(ctx context.Context, pod *v1.Pod) ([]*azaciv2.V
 				strV := base64.StdEncoding.EncodeToString(v)
 				paths[k] = &strV
 			}
-
-			if len(paths) != 0 {
-				volumes = append(volumes, &azaciv2.Volume{
-					Name:   &podVolumes[i].Name,
-					Secret: paths,
-				})
+			paths, missing, err := selectVolumeItems(podVolumes[i].Name, paths, source.Items, source.Optional)
+			if err != nil {
+				return nil, err
+			}
+			if len(missing) > 0 {
+				p.reportOptionalVolumeSource(ctx, pod, eventReasonOptionalConfigMapKeyNotFound,
+					fmt.Sprintf("keys %v of the optional configmap %s of volume %s do not exist", missing, source.Name, podVolumes[i].Name))
 			}
+			if hasCustomVolumeModes(source.DefaultMode, source.Items) {
+				log.G(ctx).Warnf("pod %s: ACI doesn't support the file modes of volume %s, ignoring them", pod.Name, podVolumes[i].Name)
+			}
+			volumes = append(volumes, getSecretVolume(podVolumes[i].Name, paths))
 			continue
 		}
 
@@ -271,12 +291,16 @@ func (p *ACIProvider) getVolumes(ctx context.Context, pod *v1.Pod) ([]*azaciv2.V
 					}
 				}
 			}
-			if len(paths) != 0 {
-				volumes = append(volumes, &azaciv2.Volume{
-					Name:   &podVolumes[i].Name,
-					Secret: paths,
-				})
+			volumes = append(volumes, getSecretVolume(podVolumes[i].Name, paths))
+			continue
+		}
+
+		if podVolumes[i].HostPath != nil {
+			hostPathVolume, err := p.getHostPathVolume(pod, podVolumes[i])
+			if err != nil {
+				return nil, err
 			}
+			volumes = append(volumes, hostPathVolume)
 			continue
 		}
 
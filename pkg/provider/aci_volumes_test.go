@@ -497,7 +497,6 @@ func TestGetVolumesForSecretVolume(t *testing.T) {
 	fakeVolumeSecret := "fake-volume-secret"
 	secretVolumeName := "SecretVolume"
 	secretName := "AzureStorageAccountInfo"
-	azureFileStorageAccountInfoFilePath := "/.azure/azurestorageaccountinfo.json"
 
 	fakeSecret := v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -527,11 +526,11 @@ func TestGetVolumesForSecretVolume(t *testing.T) {
 					Items: []v1.KeyToPath{
 						{
 							Key:  azureFileStorageAccountName,
-							Path: azureFileStorageAccountInfoFilePath,
+							Path: azureFileStorageAccountName,
 						},
 						{
 							Key:  azureFileStorageAccountKey,
-							Path: azureFileStorageAccountInfoFilePath,
+							Path: azureFileStorageAccountKey,
 						},
 					},
 					Optional: setOptional,
@@ -713,7 +712,8 @@ func TestGetVolumesForConfigMapVolume(t *testing.T) {
 				assert.NilError(t, tc.expectedError, err)
 
 				fakeCaConfigData := base64.StdEncoding.EncodeToString([]byte("fake-ca-data"))
-				assert.DeepEqual(t, *volumes[1].Secret[configMapName], fakeCaConfigData)
+				// the key of the item is mounted at its path
+				assert.DeepEqual(t, *volumes[1].Secret["ca.crt"], fakeCaConfigData)
 			} else {
 				assert.Equal(t, tc.expectedError.Error(), err.Error())
 			}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// availabilityZonesAnnotation is a comma separated list of availability zones a container group may be placed in.
+	availabilityZonesAnnotation = "virtual-kubelet.io/availability-zones"
+	// placedZoneAnnotation is set on the pods by the provider to the availability zone their container group was
+	// created in.
+	placedZoneAnnotation = "virtual-kubelet.io/placed-zone"
+)
+
+// getAvailabilityZones returns the availability zones allowed for a pod. The annotation takes
+// precedence over the zone nodeSelector, which takes precedence over the required node affinity.
+// ACI places a container group in a single zone, which is picked among the allowed ones at creation.
+func getAvailabilityZones(pod *v1.Pod, region string) ([]string, error) {
+	var requested []string
+
+	if zones := pod.Annotations[availabilityZonesAnnotation]; zones != "" {
+		requested = strings.Split(zones, ",")
+	} else if zone := pod.Spec.NodeSelector[v1.LabelTopologyZone]; zone != "" {
+		requested = []string{zone}
+	} else if zone := pod.Spec.NodeSelector[v1.LabelFailureDomainBetaZone]; zone != "" {
+		requested = []string{zone}
+	} else {
+		requested = getAffinityZones(pod.Spec.Affinity)
+	}
+
+	seen := make(map[string]bool)
+	zones := make([]string, 0, len(requested))
+	for _, zone := range requested {
+		z, err := normalizeAvailabilityZone(zone, region)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[z] {
+			seen[z] = true
+			zones = append(zones, z)
+		}
+	}
+	if len(zones) == 0 {
+		return nil, nil
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// getPlacementZones returns the order the allowed zones are tried in. The first zone rotates between the
+// container groups so that they are spread across the zones.
+func (p *ACIProvider) getPlacementZones(zones []string) []string {
+	if len(zones) <= 1 {
+		return zones
+	}
+
+	start := int(atomic.AddUint32(&p.nextZone, 1)-1) % len(zones)
+	placement := make([]string, 0, len(zones))
+	placement = append(placement, zones[start:]...)
+	placement = append(placement, zones[:start]...)
+	return placement
+}
+
+// recordPlacedZone annotates a pod with the availability zone its container group was created in.
+func (p *ACIProvider) recordPlacedZone(ctx context.Context, pod *v1.Pod, zone string) {
+	if zone == "" || p.podClient == nil || pod.Annotations[placedZoneAnnotation] == zone {
+		return
+	}
+	if err := p.annotatePod(ctx, pod, map[string]string{placedZoneAnnotation: zone}); err != nil {
+		log.G(ctx).WithError(err).Warnf("failed to annotate pod %s/%s with zone %s", pod.Namespace, pod.Name, zone)
+	}
+}
+
+// getAffinityZones returns the zones of the In expressions of the required node affinity.
+// Node selector terms are ORed, so the zones of all the terms are merged.
+func getAffinityZones(affinity *v1.Affinity) []string {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+
+	zones := make([]string, 0)
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if (expr.Key == v1.LabelTopologyZone || expr.Key == v1.LabelFailureDomainBetaZone) &&
+				expr.Operator == v1.NodeSelectorOpIn {
+				zones = append(zones, expr.Values...)
+			}
+		}
+	}
+	return zones
+}
+
+// normalizeAvailabilityZone turns the kubernetes zone label format "<region>-<zone>" into the ACI zone format.
+func normalizeAvailabilityZone(zone, region string) (string, error) {
+	zone = strings.TrimSpace(zone)
+	if i := strings.LastIndex(zone, "-"); i >= 0 {
+		if !strings.EqualFold(zone[:i], region) {
+			return "", fmt.Errorf("availability zone %q is not in region %s", zone, region)
+		}
+		zone = zone[i+1:]
+	}
+	if _, err := strconv.Atoi(zone); err != nil || zone == "" {
+		return "", fmt.Errorf("%q is not a valid availability zone", zone)
+	}
+	return zone, nil
+}
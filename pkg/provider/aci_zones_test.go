@@ -0,0 +1,195 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetAvailabilityZones(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	cases := []struct {
+		description   string
+		prepPod       func(pod *v1.Pod)
+		expectedZones []string
+		expectedError bool
+	}{
+		{
+			description:   "pod without zone requirements",
+			prepPod:       func(pod *v1.Pod) {},
+			expectedZones: nil,
+		},
+		{
+			description: "pod with zones annotation",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{availabilityZonesAnnotation: " 3,3"}
+			},
+			expectedZones: []string{"3"},
+		},
+		{
+			description: "pod with several zones",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{availabilityZonesAnnotation: "3,1"}
+			},
+			expectedZones: []string{"1", "3"},
+		},
+		{
+			description: "pod with a zone from another region among several zones",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{availabilityZonesAnnotation: "1,otherregion-2"}
+			},
+			expectedError: true,
+		},
+		{
+			description: "pod with zone nodeSelector",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.NodeSelector = map[string]string{v1.LabelTopologyZone: fakeRegion + "-2"}
+			},
+			expectedZones: []string{"2"},
+		},
+		{
+			description: "pod with zone node affinity",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.Affinity = &v1.Affinity{
+					NodeAffinity: &v1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+							NodeSelectorTerms: []v1.NodeSelectorTerm{
+								{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"2"}}}},
+								{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelFailureDomainBetaZone, Operator: v1.NodeSelectorOpIn, Values: []string{fakeRegion + "-2"}}}},
+								{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpNotIn, Values: []string{"3"}}}},
+							},
+						},
+					},
+				}
+			},
+			expectedZones: []string{"2"},
+		},
+		{
+			description: "pod with zone from another region",
+			prepPod: func(pod *v1.Pod) {
+				pod.Spec.NodeSelector = map[string]string{v1.LabelTopologyZone: "otherregion-1"}
+			},
+			expectedError: true,
+		},
+		{
+			description: "pod with invalid zone",
+			prepPod: func(pod *v1.Pod) {
+				pod.Annotations = map[string]string{availabilityZonesAnnotation: "first"}
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := testsutil.CreatePodObj(podName, podNamespace)
+			tc.prepPod(pod)
+
+			zones, err := getAvailabilityZones(pod, fakeRegion)
+			if tc.expectedError {
+				assert.Check(t, err != nil, "expected an error")
+				return
+			}
+			assert.NilError(t, err)
+			assert.Check(t, is.DeepEqual(tc.expectedZones, zones))
+		})
+	}
+}
+
+func TestCreatePodWithAvailabilityZones(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		assert.Check(t, is.Equal(1, len(cg.Zones)), "1 zone is expected")
+		assert.Check(t, is.Equal("2", *cg.Zones[0]), "zone 2 is expected")
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := testsutil.CreatePodObj(podName, podNamespace)
+	pod.Annotations = map[string]string{availabilityZonesAnnotation: "2"}
+
+	if err := provider.CreatePod(context.Background(), pod); err != nil {
+		t.Fatal("failed to create pod", err)
+	}
+}
+
+func TestCreatePodInNextAvailabilityZone(t *testing.T) {
+	podName := "pod-" + uuid.New().String()
+	podNamespace := "ns-" + uuid.New().String()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var tried []string
+	deleted := 0
+	aciMocks := createNewACIMock()
+	aciMocks.MockCreateContainerGroup = func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+		assert.Assert(t, is.Equal(1, len(cg.Zones)), "1 zone is expected")
+		tried = append(tried, *cg.Zones[0])
+		if len(tried) == 1 {
+			return &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "InsufficientCapacity"}
+		}
+		return nil
+	}
+	aciMocks.MockDeleteContainerGroupAndWait = func(ctx context.Context, resourceGroup, cgName string) error {
+		deleted++
+		return nil
+	}
+
+	provider, err := createTestProvider(aciMocks, NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := testsutil.CreatePodObj(podName, podNamespace)
+	pod.Annotations = map[string]string{availabilityZonesAnnotation: "1,2"}
+	client := fake.NewSimpleClientset(pod)
+	provider.SetPodClient(client.CoreV1())
+
+	if err := provider.CreatePod(context.Background(), pod); err != nil {
+		t.Fatal("failed to create pod", err)
+	}
+	assert.Check(t, is.Equal(2, len(tried)))
+	assert.Check(t, tried[0] != tried[1], "the next zone is expected after a capacity error")
+	assert.Check(t, is.Equal(1, deleted), "the failed container group is expected to be deleted")
+
+	// the zone the container group was created in is patched on the pod
+	updated, err := client.CoreV1().Pods(podNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(tried[1], updated.Annotations[placedZoneAnnotation]))
+}
+
+func TestGetPlacementZones(t *testing.T) {
+	p := ACIProvider{}
+	zones := []string{"1", "2", "3"}
+	assert.Check(t, is.DeepEqual([]string{"1", "2", "3"}, p.getPlacementZones(zones)))
+	assert.Check(t, is.DeepEqual([]string{"2", "3", "1"}, p.getPlacementZones(zones)))
+	assert.Check(t, is.DeepEqual([]string{"3", "1", "2"}, p.getPlacementZones(zones)))
+	assert.Check(t, is.DeepEqual([]string{"1", "2", "3"}, p.getPlacementZones(zones)))
+}
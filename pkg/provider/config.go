@@ -4,19 +4,180 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/virtual-kubelet/azure-aci/pkg/analytics"
 )
 
 type providerConfig struct {
-	ResourceGroup   string
-	Region          string
+	ResourceGroup string
+	// NamespaceResourceGroups maps a namespace to the resource group its container groups are created in.
+	NamespaceResourceGroups map[string]string
+	Region                  string
+	// Regions are additional regions container groups are spread across.
+	Regions         []string
 	OperatingSystem string
-	CPU             string
-	Memory          string
-	Pods            string
-	SubnetName      string
-	SubnetCIDR      string
+	// FailoverRegion is the region the container groups are created in once Region returned FailoverThreshold
+	// capacity or availability errors in a row, 3 by default. Region is probed every FailoverProbeInterval, 1m
+	// by default, to fail back.
+	FailoverRegion        string
+	FailoverThreshold     int
+	FailoverProbeInterval string
+	// MixedOperatingSystems runs both Linux and Windows pods on the node, creating their container groups with the
+	// OS of the pods, their kubernetes.io/os node selector or the platforms of their images, and OperatingSystem
+	// by default. The node keeps the OS labels of OperatingSystem, so the pods of the other OS can't select it with
+	// kubernetes.io/os.
+	MixedOperatingSystems bool
+	// ValidateImageArchitectures reads the platforms of the images of the pods from their registries and fails the
+	// pods whose images have no amd64 image for the OS of their container group, as ACI only runs amd64 containers.
+	ValidateImageArchitectures bool
+	CPU                        string
+	Memory                     string
+	Pods                       string
+	// DynamicCapacity lowers the allocatable CPU and pods of the node to the remaining ACI quota,
+	// refreshed every CapacityRefreshInterval.
+	DynamicCapacity         bool
+	CapacityRefreshInterval string
+	// AccountResourceOverhead lowers the allocatable CPU and memory of the node by the resources the container
+	// groups request on top of their pods, e.g. for default requests or sidecars, refreshed every
+	// CapacityRefreshInterval.
+	AccountResourceOverhead bool
+	// NodeLabels, NodeAnnotations and NodeTaints are added to the virtual node.
+	NodeLabels      map[string]string
+	NodeAnnotations map[string]string
+	NodeTaints      []nodeTaintConfig
+	// PodTagAnnotationPrefix turns the pod annotations with the prefix into container group tags,
+	// PodTagLabels are the pod labels propagated as tags, renamed with label=tag.
+	PodTagAnnotationPrefix string
+	PodTagLabels           []string
+	// ContainerGroupSKU is the SKU of the container groups of the pods without the virtual-kubelet.io/container-sku
+	// annotation, Standard or Dedicated to place them on hosts dedicated to the subscription. The ACI default
+	// when not set.
+	ContainerGroupSKU string
+	// ContainerGroupWebhookURL is an HTTP endpoint receiving each pod and its container group before it is created,
+	// and answering the container group to create, e.g. with sidecars or DNS settings added. It receives the
+	// secrets of the pods, so it should be served over HTTPS. ContainerGroupWebhookTimeout is 10s by default, and
+	// ContainerGroupWebhookFailurePolicy is Fail to fail the pods when the webhook can't be reached, the default,
+	// or Ignore to create their container groups unchanged.
+	ContainerGroupWebhookURL           string
+	ContainerGroupWebhookTimeout       string
+	ContainerGroupWebhookFailurePolicy string
+	// DisableKubeProxyExtension doesn't add the kube-proxy extension to the container groups in a virtual network,
+	// whose pods then can't reach the services of the cluster. KubeProxyMasterURI and KubeProxyClusterCIDR are the
+	// API server and the cluster CIDR of the extension, the MASTER_URI and CLUSTER_CIDR environment variables by
+	// default. EnableRealtimeMetricsExtension adds the realtime metrics extension to the container groups in a
+	// virtual network, as the ENABLE_REAL_TIME_METRICS environment variable.
+	DisableKubeProxyExtension      bool
+	KubeProxyMasterURI             string
+	KubeProxyClusterCIDR           string
+	EnableRealtimeMetricsExtension bool
+	// Extensions are custom deployment extensions added to the Linux container groups.
+	Extensions []extensionConfig
+	// ContainerGroupProfiles are the ACI container group profiles, and their standby pools, the pods can be created
+	// from with the container group profile annotation, so that frequently used images start faster.
+	ContainerGroupProfiles []containerGroupProfileConfig
+	// PodDefaults are the labels, annotations, tolerations and container resources the pods get when they don't
+	// set them, applied before the pods are admitted and translated into container groups.
+	PodDefaults []podDefaultsConfig
+	// HostPathMappings redirect the hostPath volumes under their prefixes to Azure Files shares, the other
+	// hostPath volumes are rejected.
+	HostPathMappings []hostPathMappingConfig
+	// LargeVolumePolicy is Reject to fail the pods with a secret, configMap or projected volume over the size
+	// limits of ACI, or Archive to extract such volumes from gzipped tar chunks with an init container running
+	// VolumeArchiveImage, a busybox image by default.
+	LargeVolumePolicy  string
+	VolumeArchiveImage string
+	// VolumeSourceChangePolicy is Restart to update the container groups of the running pods whose mounted secrets
+	// and config maps changed, which restarts their containers, or Recreate to evict these pods so that their
+	// controllers recreate them, one pod per controller at a time. The changes are ignored when not set.
+	VolumeSourceChangePolicy string
+	// DryRun validates pods without creating their container groups.
+	DryRun bool
+	// RequireTaintToleration fails the pods which don't tolerate the taints of the node, and RequiredNodeSelector
+	// the pods whose nodeSelector doesn't select these node labels, as they were not meant to run on ACI.
+	RequireTaintToleration bool
+	RequiredNodeSelector   map[string]string
+	// MaxInFlightCreations and MaxInFlightDeletions limit the container groups created and deleted at once, to
+	// avoid the throttling of ARM on bursts of pods. The waiting pods are served by priority, then round robin
+	// between namespaces. They are unlimited when not set.
+	MaxInFlightCreations int
+	MaxInFlightDeletions int
+	// PreemptLowerPriorityPods deletes the container groups of pods with a lower priority when a pod doesn't fit
+	// in the ACI quota of the subscription, the preempted pods are failed.
+	PreemptLowerPriorityPods bool
+	// DrainBatchSize is the number of pods evicted every 30 seconds while the node is drained with the
+	// virtual-kubelet.io/drain annotation, 10 when not set.
+	DrainBatchSize int
+	// HostNetworkWarnOnly creates the pods requesting host networking or host ports with an event, ignoring
+	// these fields, instead of failing them.
+	HostNetworkWarnOnly bool
+	// DefaultCPURequest and DefaultMemoryRequestGB are the resources requested by the containers without requests,
+	// unless their namespace has the virtual-kubelet.io/default-cpu-request and default-memory-request annotations
+	// or pod defaults apply. They can't be lower than the minimums of ACI.
+	DefaultCPURequest      float64
+	DefaultMemoryRequestGB float64
+	// CPURequestGranularity and MemoryRequestGranularityGB are the multiples the container resources are rounded
+	// down to, 0.01 CPU and 0.1GB by default. MaxPodCPU and MaxPodMemoryGB reject the pods requesting more
+	// resources in total, unlimited when not set.
+	CPURequestGranularity      float64
+	MemoryRequestGranularityGB float64
+	MaxPodCPU                  float64
+	MaxPodMemoryGB             float64
+	// PodResourcesPolicy is Reject to fail the pods whose containers request more resources in total, or have
+	// limits over, MaxPodCPU and MaxPodMemoryGB or the maximums of a container group in the region, the default,
+	// or Scale to scale their requests down proportionally and lower their limits to fit, with a warning event.
+	PodResourcesPolicy string
+	// ImagePullSecrets are added to the image pull secrets of every pod, either name for the secret of the
+	// namespace of the pod or namespace/name.
+	ImagePullSecrets []string
+	// RegistryCredentialHelpers are the credential helpers the docker config of image pull secrets may use, run
+	// as docker-credential-<helper>, each only for its servers and, when set, the secrets of its namespaces.
+	RegistryCredentialHelpers []registryCredentialHelperConfig
+	// RegistryTokenHosts are the hosts, besides the registries themselves and auth.docker.io, whose bearer token
+	// realms the registry credentials of the pods are sent to when reading the entrypoints of their images.
+	RegistryTokenHosts []string
+	// PodStatusMinInterval is the minimum time between two status fetches of the same pod, 5s by default.
+	PodStatusMinInterval string
+	SubnetName           string
+	SubnetCIDR           string
+	// NamespaceSubnets maps a namespace to the subnet its pods are placed into by default.
+	NamespaceSubnets map[string]string
+	// PrivateIPPools are named ranges of private IP addresses of the subnets, the pods with the
+	// virtual-kubelet.io/private-ip-pool annotation get a free address of.
+	PrivateIPPools []privateIPPoolConfig
+	// PodIPPolicy is ContainerGroup to report the IP address of the container groups as pod IP, or Private to
+	// only report the private IP addresses in the virtual network. HostIPPolicy is Node to report the internal IP
+	// of the virtual node as host IP, or PodIP to report the pod IP.
+	PodIPPolicy  string
+	HostIPPolicy string
+	// PortExposurePolicy is AllContainerPorts to expose all the container ports on the IP address of the
+	// container groups, or AnnotatedPorts to only expose the ports of the public ports annotation of the pods.
+	PortExposurePolicy string
+	// OvercommitPolicy is Requests to account the resources of the node by the requests of the pods, or Limits to
+	// schedule the pods by their requests but cap the node by their limits.
+	OvercommitPolicy string
+	// NetworkPolicyPriority is the priority of the first network security rule generated for the network
+	// policies, the following rules of each direction taking the next priorities. The virtual nodes sharing a
+	// network security group must be given non-overlapping ranges, as they would fail to create their rules with
+	// the priorities already taken by the other nodes.
+	NetworkPolicyPriority int32
+	// Log Analytics workspace the container logs are sent to, either with the workspace ID and key
+	// or with the workspace resource ID, which is resolved with the identity of the virtual node.
+	LogAnalyticsWorkspaceID         string
+	LogAnalyticsWorkspaceKey        string
+	LogAnalyticsWorkspaceResourceID string
+	// LogArchiveContainerURL is the URL of an Azure Storage blob container the new container logs are appended to
+	// every LogArchiveInterval, under the name of the node, and before the provider deletes the container groups
+	// of completed, expired or preempted pods. The logs written after the last archive of the pods deleted through
+	// the API are not archived. The archived logs of the node are deleted LogArchiveRetention after their last
+	// update, or kept when it is not set.
+	LogArchiveContainerURL string
+	LogArchiveInterval     string
+	LogArchiveRetention    string
+	// CompletedPodRetention deletes the container groups of the succeeded and failed pods once they completed
+	// for this duration, while their pods are kept. They are kept until the deletion of the pods when not set.
+	CompletedPodRetention string
 }
 
 var validOS = map[string]bool{
@@ -30,7 +191,21 @@ func (p *ACIProvider) loadConfig(r io.Reader) error {
 		return err
 	}
 	p.region = config.Region
+	p.regions = config.Regions
+	p.failoverRegion = config.FailoverRegion
+	if config.FailoverThreshold < 0 {
+		return fmt.Errorf("the failover threshold can't be negative")
+	}
+	p.failoverThreshold = config.FailoverThreshold
+	if config.FailoverProbeInterval != "" {
+		interval, err := time.ParseDuration(config.FailoverProbeInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid failover probe interval %q", config.FailoverProbeInterval)
+		}
+		p.failoverProbeInterval = interval
+	}
 	p.resourceGroup = config.ResourceGroup
+	p.namespaceResourceGroups = config.NamespaceResourceGroups
 
 	// Default to 20 mcpu
 	p.cpu = "20"
@@ -48,6 +223,117 @@ func (p *ACIProvider) loadConfig(r io.Reader) error {
 		p.pods = config.Pods
 	}
 
+	p.nodeLabels = config.NodeLabels
+	p.nodeAnnotations = config.NodeAnnotations
+	p.nodeTaints = getNodeTaints(config.NodeTaints)
+
+	p.podTagAnnotationPrefix = config.PodTagAnnotationPrefix
+	podTagLabels, err := parsePodTagLabels(config.PodTagLabels)
+	if err != nil {
+		return err
+	}
+	p.podTagLabels = podTagLabels
+	containerGroupProfiles, err := parseContainerGroupProfiles(config.ContainerGroupProfiles)
+	if err != nil {
+		return err
+	}
+	p.containerGroupProfiles = containerGroupProfiles
+	customExtensions, err := parseExtensions(config.Extensions)
+	if err != nil {
+		return err
+	}
+	p.extensions = extensionsConfig{
+		disableKubeProxy:      config.DisableKubeProxyExtension,
+		enableRealtimeMetrics: config.EnableRealtimeMetricsExtension,
+		kubeProxyMasterURI:    config.KubeProxyMasterURI,
+		kubeProxyClusterCIDR:  config.KubeProxyClusterCIDR,
+		customExtensions:      customExtensions,
+	}
+	podDefaults, err := parsePodDefaults(config.PodDefaults)
+	if err != nil {
+		return err
+	}
+	p.podDefaults = podDefaults
+	hostPathMappings, err := parseHostPathMappings(config.HostPathMappings)
+	if err != nil {
+		return err
+	}
+	p.hostPathMappings = hostPathMappings
+	privateIPPools, err := parsePrivateIPPools(config.PrivateIPPools)
+	if err != nil {
+		return err
+	}
+	p.privateIPPools = privateIPPools
+	p.dryRun = config.DryRun
+	p.hostNetworkWarnOnly = config.HostNetworkWarnOnly
+	p.preemptLowerPriorityPods = config.PreemptLowerPriorityPods
+	if config.DrainBatchSize < 0 {
+		return fmt.Errorf("the drain batch size can't be negative")
+	}
+	p.drainBatchSize = config.DrainBatchSize
+	if config.MaxInFlightCreations < 0 || config.MaxInFlightDeletions < 0 {
+		return fmt.Errorf("the maximum container group operations in flight can't be negative")
+	}
+	p.createQueue = newOperationQueue(config.MaxInFlightCreations)
+	p.deleteQueue = newOperationQueue(config.MaxInFlightDeletions)
+	p.requireTaintToleration = config.RequireTaintToleration
+	p.requiredNodeSelector = config.RequiredNodeSelector
+
+	defaultImagePullSecrets, err := parseImagePullSecrets(config.ImagePullSecrets)
+	if err != nil {
+		return err
+	}
+	p.defaultImagePullSecrets = defaultImagePullSecrets
+	if err := p.setRegistryCredentialHelpers(config.RegistryCredentialHelpers); err != nil {
+		return err
+	}
+	p.registryTokenHosts = config.RegistryTokenHosts
+
+	if config.DefaultCPURequest < 0 || config.DefaultMemoryRequestGB < 0 {
+		return fmt.Errorf("default container resource requests can't be negative")
+	}
+	if err := validateDefaultRequests(config.DefaultCPURequest, config.DefaultMemoryRequestGB); err != nil {
+		return err
+	}
+	p.defaultCPURequest = config.DefaultCPURequest
+	p.defaultMemoryRequest = config.DefaultMemoryRequestGB
+
+	// ACI doesn't accept finer values than the default granularity
+	if (config.CPURequestGranularity != 0 && config.CPURequestGranularity < defaultCPURequestGranularity) ||
+		(config.MemoryRequestGranularityGB != 0 && config.MemoryRequestGranularityGB < defaultMemoryRequestGranularityGB) {
+		return fmt.Errorf("container resource granularity can't be finer than %g CPU and %gGB",
+			defaultCPURequestGranularity, defaultMemoryRequestGranularityGB)
+	}
+	if config.MaxPodCPU < 0 || config.MaxPodMemoryGB < 0 {
+		return fmt.Errorf("pod resource maximums can't be negative")
+	}
+	p.cpuRequestGranularity = config.CPURequestGranularity
+	p.memoryRequestGranularity = config.MemoryRequestGranularityGB
+	p.maxPodCPU = config.MaxPodCPU
+	p.maxPodMemory = config.MaxPodMemoryGB
+	if err := validatePodResourcesPolicy(config.PodResourcesPolicy); err != nil {
+		return err
+	}
+	p.podResourcesPolicy = config.PodResourcesPolicy
+
+	if config.PodStatusMinInterval != "" {
+		interval, err := time.ParseDuration(config.PodStatusMinInterval)
+		if err != nil {
+			return fmt.Errorf("error parsing pod status min interval: %v", err)
+		}
+		p.podStatusMinInterval = interval
+	}
+
+	p.dynamicCapacity = config.DynamicCapacity
+	p.accountResourceOverhead = config.AccountResourceOverhead
+	if config.CapacityRefreshInterval != "" {
+		interval, err := time.ParseDuration(config.CapacityRefreshInterval)
+		if err != nil {
+			return fmt.Errorf("error parsing capacity refresh interval: %v", err)
+		}
+		p.capacityRefreshInterval = interval
+	}
+
 	// Default to Linux if the operating system was not defined in the config.
 	if config.OperatingSystem == "" {
 		config.OperatingSystem = "Linux"
@@ -72,6 +358,98 @@ func (p *ACIProvider) loadConfig(r io.Reader) error {
 		}
 	}
 
+	if err := validatePodIPPolicy(config.PodIPPolicy); err != nil {
+		return err
+	}
+	if err := validateHostIPPolicy(config.HostIPPolicy); err != nil {
+		return err
+	}
+	p.podIPPolicy = config.PodIPPolicy
+	p.hostIPPolicy = config.HostIPPolicy
+
+	if err := validatePortExposurePolicy(config.PortExposurePolicy); err != nil {
+		return err
+	}
+	p.portExposurePolicy = config.PortExposurePolicy
+	if err := validateOvercommitPolicy(config.OvercommitPolicy); err != nil {
+		return err
+	}
+	p.overcommitPolicy = config.OvercommitPolicy
+	if err := validateLargeVolumePolicy(config.LargeVolumePolicy); err != nil {
+		return err
+	}
+	p.largeVolumePolicy = config.LargeVolumePolicy
+	if err := validateContainerGroupSKU(config.ContainerGroupSKU); err != nil {
+		return err
+	}
+	p.containerGroupSKU = config.ContainerGroupSKU
+	if config.ContainerGroupWebhookURL != "" {
+		if err := validateContainerGroupWebhookFailurePolicy(config.ContainerGroupWebhookFailurePolicy); err != nil {
+			return err
+		}
+		var timeout time.Duration
+		if config.ContainerGroupWebhookTimeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(config.ContainerGroupWebhookTimeout); err != nil {
+				return fmt.Errorf("error parsing container group webhook timeout: %v", err)
+			}
+		}
+		webhook, err := newContainerGroupWebhook(config.ContainerGroupWebhookURL, timeout, config.ContainerGroupWebhookFailurePolicy)
+		if err != nil {
+			return err
+		}
+		p.containerGroupWebhook = webhook
+	}
+	if err := validateVolumeSourceChangePolicy(config.VolumeSourceChangePolicy); err != nil {
+		return err
+	}
+	p.volumeSourceChangePolicy = config.VolumeSourceChangePolicy
+	p.volumeArchiveImage = config.VolumeArchiveImage
+
+	if config.NetworkPolicyPriority != 0 && (config.NetworkPolicyPriority < 100 || config.NetworkPolicyPriority > maxNetworkPolicyPriority) {
+		return fmt.Errorf("network policy priority %d is not between 100 and %d", config.NetworkPolicyPriority, maxNetworkPolicyPriority)
+	}
+	p.networkPolicyPriority = config.NetworkPolicyPriority
+
+	if len(config.NamespaceSubnets) > 0 {
+		p.providernetwork.NamespaceSubnets = config.NamespaceSubnets
+	}
+
+	if config.LogAnalyticsWorkspaceID != "" || config.LogAnalyticsWorkspaceKey != "" {
+		diagnostics, err := analytics.NewContainerGroupDiagnostics(config.LogAnalyticsWorkspaceID, config.LogAnalyticsWorkspaceKey)
+		if err != nil {
+			return err
+		}
+		p.diagnostics = diagnostics
+	}
+	p.logAnalyticsResourceID = config.LogAnalyticsWorkspaceResourceID
+
+	p.logArchiveContainerURL = config.LogArchiveContainerURL
+	if config.LogArchiveInterval != "" {
+		interval, err := time.ParseDuration(config.LogArchiveInterval)
+		if err != nil {
+			return fmt.Errorf("error parsing log archive interval: %v", err)
+		}
+		p.logArchiveInterval = interval
+	}
+	if config.LogArchiveRetention != "" {
+		retention, err := time.ParseDuration(config.LogArchiveRetention)
+		if err != nil {
+			return fmt.Errorf("error parsing log archive retention: %v", err)
+		}
+		p.logArchiveRetention = retention
+	}
+
+	if config.CompletedPodRetention != "" {
+		retention, err := time.ParseDuration(config.CompletedPodRetention)
+		if err != nil {
+			return fmt.Errorf("error parsing completed pod retention: %v", err)
+		}
+		p.completedPodRetention = retention
+	}
+
 	p.operatingSystem = config.OperatingSystem
+	p.mixedOperatingSystems = config.MixedOperatingSystems
+	p.validateImageArchitectures = config.ValidateImageArchitectures
 	return nil
 }
@@ -2,8 +2,10 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"strings"
 	"testing"
+	"time"
 )
 
 const cfg = `
@@ -92,3 +94,127 @@ func TestDefaultedConfig(t *testing.T) {
 		t.Errorf("Wanted default %s, got %s.", wanted, p.pods)
 	}
 }
+
+const subnetCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+SubnetName = "default-subnet"
+
+[NamespaceSubnets]
+team-a = "team-a-subnet"`
+
+func TestNamespaceSubnetsConfig(t *testing.T) {
+	br := bytes.NewReader([]byte(subnetCfg))
+	var p ACIProvider
+	err := p.loadConfig(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := "default-subnet"
+	if p.providernetwork.SubnetName != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, p.providernetwork.SubnetName)
+	}
+
+	wanted = "team-a-subnet"
+	if got := p.providernetwork.NamespaceSubnets["team-a"]; got != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, got)
+	}
+}
+
+const logAnalyticsCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+LogAnalyticsWorkspaceID = "workspace-id"
+LogAnalyticsWorkspaceKey = "workspace-key"`
+
+func TestLogAnalyticsConfig(t *testing.T) {
+	br := bytes.NewReader([]byte(logAnalyticsCfg))
+	var p ACIProvider
+	err := p.loadConfig(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.diagnostics == nil || p.diagnostics.LogAnalytics == nil {
+		t.Fatal("expected log analytics diagnostics to be set")
+	}
+	wanted := "workspace-id"
+	if got := *p.diagnostics.LogAnalytics.WorkspaceID; got != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, got)
+	}
+	wanted = "workspace-key"
+	if got := *p.diagnostics.LogAnalytics.WorkspaceKey; got != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, got)
+	}
+}
+
+const logAnalyticsCfgBad = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+LogAnalyticsWorkspaceID = "workspace-id"`
+
+func TestBadLogAnalyticsConfig(t *testing.T) {
+	br := bytes.NewReader([]byte(logAnalyticsCfgBad))
+	var p ACIProvider
+	err := p.loadConfig(br)
+	if err == nil {
+		t.Fatal("expected loadConfig to fail without log analytics workspace key")
+	}
+}
+
+const dynamicCapacityCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+CPU = "100"
+DynamicCapacity = true
+CapacityRefreshInterval = "2m"`
+
+func TestDynamicCapacityConfig(t *testing.T) {
+	br := bytes.NewReader([]byte(dynamicCapacityCfg))
+	var p ACIProvider
+	err := p.loadConfig(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.dynamicCapacity {
+		t.Error("Wanted dynamic capacity to be enabled.")
+	}
+	if p.capacityRefreshInterval != 2*time.Minute {
+		t.Errorf("Wanted %s, got %s.", 2*time.Minute, p.capacityRefreshInterval)
+	}
+
+	// the capacity of the config is kept when setting up the node capacity
+	if err := p.setupNodeCapacity(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.cpu != "100" {
+		t.Errorf("Wanted %s, got %s.", "100", p.cpu)
+	}
+}
+
+const namespaceResourceGroupsCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+
+[NamespaceResourceGroups]
+team-a = "team-a-rg"`
+
+func TestNamespaceResourceGroupsConfig(t *testing.T) {
+	br := bytes.NewReader([]byte(namespaceResourceGroupsCfg))
+	var p ACIProvider
+	err := p.loadConfig(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := "team-a-rg"
+	if got := p.getResourceGroup("team-a"); got != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, got)
+	}
+	wanted = "virtual-kubeletrg"
+	if got := p.getResourceGroup("team-b"); got != wanted {
+		t.Errorf("Wanted %s, got %s.", wanted, got)
+	}
+}
@@ -6,6 +6,8 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"time"
 
 	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
@@ -14,13 +16,25 @@ import (
 	"github.com/virtual-kubelet/azure-aci/pkg/util"
 	"github.com/virtual-kubelet/azure-aci/pkg/validation"
 	errdef "github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	containerWaitingReasonErrImagePull     = "ErrImagePull"
+	containerWaitingReasonImagePullBackOff = "ImagePullBackOff"
+	containerWaitingReasonCrashLoopBackOff = "CrashLoopBackOff"
+
+	containerTerminatedReasonOOMKilled = "OOMKilled"
+	// containerExitCodeOOMKilled is the exit code of the containers killed with SIGKILL, e.g. by the OOM killer.
+	containerExitCodeOOMKilled int32 = 137
+)
+
 func (p *ACIProvider) containerGroupToPod(ctx context.Context, cg *azaciv2.ContainerGroup) (*v1.Pod, error) {
 	//cg is validated
-	pod, err := p.podsL.Pods(*cg.Tags["Namespace"]).Get(*cg.Name)
+	// the container group is named <namespace>-<pod>, the pod is looked up by the name of its tag
+	pod, err := p.podsL.Pods(*cg.Tags["Namespace"]).Get(*cg.Tags["PodName"])
 	// in case pod got deleted, we want to continue the workflow to kick off clean dangling pods
 	if errdef.IsNotFound(err) || pod == nil {
 		return &v1.Pod{
@@ -41,14 +55,30 @@ func (p *ACIProvider) containerGroupToPod(ctx context.Context, cg *azaciv2.Conta
 		return nil, err
 	}
 
+	mergePodConditions(pod, podState)
 	updatedPod.Status = *podState
 
+	report, err := json.Marshal(buildSecurityReport(cg))
+	if err != nil {
+		return nil, err
+	}
+	if updatedPod.Annotations == nil {
+		updatedPod.Annotations = make(map[string]string)
+	}
+	updatedPod.Annotations[securityReportAnnotation] = string(report)
+	// the pod controller only updates the status, so the annotation is patched
+	if p.podClient != nil && pod.Annotations[securityReportAnnotation] != string(report) {
+		if err := p.annotatePod(ctx, pod, map[string]string{securityReportAnnotation: string(report)}); err != nil {
+			log.G(ctx).WithError(err).Warnf("failed to annotate pod %s/%s with its security report", pod.Namespace, pod.Name)
+		}
+	}
+	setPublicIPAnnotations(updatedPod, cg)
+
 	return updatedPod, nil
 }
 
 func (p *ACIProvider) getPodStatusFromContainerGroup(ctx context.Context, cg *azaciv2.ContainerGroup) (*v1.PodStatus, error) {
 	// cg is validated
-	allReady := true
 	var firstContainerStartTime, lastUpdateTime time.Time
 
 	containerStatuses := make([]v1.ContainerStatus, 0, len(cg.Properties.Containers))
@@ -66,21 +96,7 @@ func (p *ACIProvider) getPodStatusFromContainerGroup(ctx context.Context, cg *az
 			lastUpdateTime = firstContainerStartTime
 		}
 
-		containerStatus := v1.ContainerStatus{
-			Name:                 *containersList[i].Name,
-			State:                aciContainerStateToContainerState(containersList[i].Properties.InstanceView.CurrentState),
-			LastTerminationState: aciContainerStateToContainerState(containersList[i].Properties.InstanceView.PreviousState),
-			Ready:                getPodPhaseFromACIState(*containersList[i].Properties.InstanceView.CurrentState.State) == v1.PodRunning,
-			RestartCount:         *containersList[i].Properties.InstanceView.RestartCount,
-			Image:                *containersList[i].Properties.Image,
-			ImageID:              "",
-			ContainerID:          util.GetContainerID(cg.ID, containersList[i].Name),
-		}
-
-		if getPodPhaseFromACIState(*containersList[i].Properties.InstanceView.CurrentState.State) != v1.PodRunning &&
-			getPodPhaseFromACIState(*containersList[i].Properties.InstanceView.CurrentState.State) != v1.PodSucceeded {
-			allReady = false
-		}
+		containerStatus := getContainerStatus(cg.ID, *containersList[i].Name, *containersList[i].Properties.Image, containersList[i].Properties.InstanceView)
 
 		containerStartTime := containersList[i].Properties.InstanceView.CurrentState.StartTime
 		if containerStartTime.After(lastUpdateTime) {
@@ -91,30 +107,162 @@ func (p *ACIProvider) getPodStatusFromContainerGroup(ctx context.Context, cg *az
 		containerStatuses = append(containerStatuses, containerStatus)
 	}
 
+	p.applyRestartCounts(ctx, cg, containerStatuses)
+
 	aciState, creationTime, err := getACIResourceMetaFromContainerGroup(cg)
 	if err != nil {
 		return nil, err
 	}
 
-	podIp := ""
-	if cg.Properties.OSType != nil &&
-		*cg.Properties.OSType != azaciv2.OperatingSystemTypesWindows {
-		podIp = *cg.Properties.IPAddress.IP
-	}
+	initContainerStatuses := getInitContainerStatuses(cg)
+
+	podIp, hostIP := p.getContainerGroupIPs(cg)
 	return &v1.PodStatus{
-		Phase:             getPodPhaseFromACIState(*aciState),
-		Conditions:        getPodConditionsFromACIState(*aciState, creationTime, lastUpdateTime, allReady),
-		Message:           "",
-		Reason:            "",
-		HostIP:            p.internalIP,
-		PodIP:             podIp,
-		StartTime:         &metav1.Time{Time: firstContainerStartTime},
-		ContainerStatuses: containerStatuses,
+		Phase:                 getCompletedPodPhase(cg.Properties.RestartPolicy, getPodPhaseFromACIState(*aciState), containerStatuses),
+		Conditions:            getPodConditions(cg, *aciState, creationTime, lastUpdateTime, initContainerStatuses, containerStatuses),
+		Message:               "",
+		Reason:                "",
+		HostIP:                hostIP,
+		PodIP:                 podIp,
+		PodIPs:                getPodIPs(podIp),
+		StartTime:             &metav1.Time{Time: firstContainerStartTime},
+		InitContainerStatuses: initContainerStatuses,
+		ContainerStatuses:     containerStatuses,
 	}, nil
 }
 
+// getInitContainerStatuses returns the statuses of the init containers of a container group, which ran to
+// completion one after the other before the containers started.
+func getInitContainerStatuses(cg *azaciv2.ContainerGroup) []v1.ContainerStatus {
+	var statuses []v1.ContainerStatus
+	for _, initContainer := range cg.Properties.InitContainers {
+		if initContainer == nil || initContainer.Name == nil || initContainer.Properties == nil {
+			continue
+		}
+		instanceView := &azaciv2.ContainerPropertiesInstanceView{}
+		if view := initContainer.Properties.InstanceView; view != nil {
+			instanceView.CurrentState = view.CurrentState
+			instanceView.PreviousState = view.PreviousState
+			instanceView.RestartCount = view.RestartCount
+			instanceView.Events = view.Events
+		}
+		status := getContainerStatus(cg.ID, *initContainer.Name, stringValue(initContainer.Properties.Image), instanceView)
+		// init containers are ready once they completed
+		status.Ready = isSucceeded(status.State)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// getContainerStatus returns the status of a container from its ACI instance view, with the state of its last
+// terminated instance when it was restarted.
+func getContainerStatus(cgID *string, name, image string, instanceView *azaciv2.ContainerPropertiesInstanceView) v1.ContainerStatus {
+	status := v1.ContainerStatus{
+		Name:         name,
+		State:        aciContainerStateToContainerState(instanceView.CurrentState),
+		RestartCount: getRestartCount(instanceView),
+		Image:        image,
+		ImageID:      "",
+		ContainerID:  util.GetContainerID(cgID, &name),
+	}
+	status.Ready = status.State.Running != nil
+	if status.State.Waiting != nil {
+		if reason, message, ok := getWaitingReasonFromEvents(instanceView); ok {
+			status.State.Waiting.Reason, status.State.Waiting.Message = reason, message
+		}
+	}
+	markOOMKilled(status.State.Terminated, instanceView.Events)
+	// the last termination state only covers the terminated instances, ACI reports the initial state of a
+	// container which never restarted as its previous state
+	if lastState := aciContainerStateToContainerState(instanceView.PreviousState); lastState.Terminated != nil {
+		markOOMKilled(lastState.Terminated, instanceView.Events)
+		status.LastTerminationState = lastState
+	}
+	return status
+}
+
+// isOOMMessage returns whether a detail status or an event message reports that the container ran out of memory.
+func isOOMMessage(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "oomkilled") || strings.Contains(message, "out of memory") ||
+		strings.Contains(message, "oom kill") || strings.Contains(message, "memory limit")
+}
+
+// markOOMKilled sets the reason of a terminated container which was killed, i.e. exited with 137, to OOMKilled
+// when ACI recorded an out of memory event during its run, since ACI only reports most OOM kills with events.
+func markOOMKilled(terminated *v1.ContainerStateTerminated, events []*azaciv2.Event) {
+	if terminated == nil || terminated.ExitCode != containerExitCodeOOMKilled || terminated.Reason == containerTerminatedReasonOOMKilled {
+		return
+	}
+	for _, event := range events {
+		if event == nil || !(isOOMMessage(stringValue(event.Name)) || isOOMMessage(stringValue(event.Message))) {
+			continue
+		}
+		if event.LastTimestamp != nil && (event.LastTimestamp.Before(terminated.StartedAt.Time) ||
+			(!terminated.FinishedAt.IsZero() && event.LastTimestamp.After(terminated.FinishedAt.Add(time.Minute)))) {
+			continue
+		}
+		terminated.Reason = containerTerminatedReasonOOMKilled
+		return
+	}
+}
+
+// getWaitingReasonFromEvents translates the last event of a waiting container into the waiting reason the kubelet
+// would report, so that image pull failures and crash loops are recognizable, e.g. ErrImagePull or CrashLoopBackOff.
+func getWaitingReasonFromEvents(instanceView *azaciv2.ContainerPropertiesInstanceView) (string, string, bool) {
+	var last *azaciv2.Event
+	for _, event := range instanceView.Events {
+		if event == nil {
+			continue
+		}
+		if last == nil || last.LastTimestamp == nil || (event.LastTimestamp != nil && !event.LastTimestamp.Before(*last.LastTimestamp)) {
+			last = event
+		}
+	}
+
+	if last != nil && stringValue(last.Type) == v1.EventTypeWarning {
+		message := stringValue(last.Message)
+		pulling := strings.Contains(strings.ToLower(message), "pull")
+		switch strings.ToLower(stringValue(last.Name)) {
+		case "failed":
+			if pulling {
+				return containerWaitingReasonErrImagePull, message, true
+			}
+		case "backoff":
+			if pulling {
+				return containerWaitingReasonImagePullBackOff, message, true
+			}
+			return containerWaitingReasonCrashLoopBackOff, message, true
+		}
+	}
+
+	// ACI waits before restarting a container which terminated
+	if getRestartCount(instanceView) > 0 && instanceView.PreviousState != nil && stringValue(instanceView.PreviousState.State) == aciContainerStateTerminated {
+		return containerWaitingReasonCrashLoopBackOff, "back-off restarting failed container", true
+	}
+	return "", "", false
+}
+
+func isSucceeded(state v1.ContainerState) bool {
+	return state.Terminated != nil && state.Terminated.ExitCode == 0
+}
+
+func getPodIPs(podIP string) []v1.PodIP {
+	if podIP == "" {
+		return nil
+	}
+	return []v1.PodIP{{IP: podIP}}
+}
+
 func aciContainerStateToContainerState(cs *azaciv2.ContainerState) v1.ContainerState {
-	// cg container state is validated
+	if cs == nil || cs.State == nil {
+		return v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{
+				Reason: "ContainerCreating",
+			},
+		}
+	}
+
 	finishTime := time.Time{}
 	startTime := time.Time{}
 	if cs.StartTime != nil {
@@ -123,6 +271,12 @@ func aciContainerStateToContainerState(cs *azaciv2.ContainerState) v1.ContainerS
 	if cs.FinishTime != nil {
 		finishTime = *cs.FinishTime
 	}
+	var exitCode int32
+	if cs.ExitCode != nil {
+		exitCode = *cs.ExitCode
+	}
+	detailStatus := stringValue(cs.DetailStatus)
+
 	switch *cs.State {
 	case "Running":
 		return v1.ContainerState{
@@ -134,43 +288,85 @@ func aciContainerStateToContainerState(cs *azaciv2.ContainerState) v1.ContainerS
 	case "Succeeded":
 		return v1.ContainerState{
 			Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   exitCode,
 				StartedAt:  metav1.NewTime(startTime),
 				Reason:     "Completed",
 				FinishedAt: metav1.NewTime(finishTime),
 			},
 		}
-	// Handle the case where the container failed.
-	case "Failed", "Canceled":
+	// Handle the case where the container exited, the detail status is its reason, e.g. Completed, Error or
+	// OOMKilled, unless it is a message.
+	case aciContainerStateTerminated:
+		reason, message := splitDetailStatus(detailStatus)
+		if reason == "" {
+			reason = "Error"
+			if exitCode == 0 {
+				reason = "Completed"
+			}
+		}
+		if isOOMMessage(detailStatus) {
+			reason = containerTerminatedReasonOOMKilled
+		}
+		if reason == containerTerminatedReasonOOMKilled && cs.ExitCode == nil {
+			exitCode = containerExitCodeOOMKilled
+		}
 		return v1.ContainerState{
 			Terminated: &v1.ContainerStateTerminated{
-				ExitCode:   *cs.ExitCode,
-				Reason:     *cs.State,
-				Message:    *cs.DetailStatus,
+				ExitCode:   exitCode,
+				Reason:     reason,
+				Message:    message,
 				StartedAt:  metav1.NewTime(startTime),
 				FinishedAt: metav1.NewTime(finishTime),
 			},
 		}
-		// Handle windows container with no prev state
-	case "Pending":
+	// Handle the case where the container failed.
+	case "Failed", "Canceled":
+		reason := *cs.State
+		if isOOMMessage(detailStatus) {
+			reason = containerTerminatedReasonOOMKilled
+			if cs.ExitCode == nil {
+				exitCode = containerExitCodeOOMKilled
+			}
+		}
 		return v1.ContainerState{
-			Waiting: &v1.ContainerStateWaiting{
-				Reason:  *cs.State,
-				Message: *cs.DetailStatus,
+			Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   exitCode,
+				Reason:     reason,
+				Message:    detailStatus,
+				StartedAt:  metav1.NewTime(startTime),
+				FinishedAt: metav1.NewTime(finishTime),
 			},
 		}
 
 	default:
-		// Handle the case where the container is pending.
+		// Handle the case where the container is pending or waiting, e.g. to be restarted.
 		// Which should be all other aci states.
+		reason, message := splitDetailStatus(detailStatus)
+		if reason == "" {
+			reason = *cs.State
+		}
 		return v1.ContainerState{
 			Waiting: &v1.ContainerStateWaiting{
-				Reason:  *cs.State,
-				Message: *cs.DetailStatus,
+				Reason:  reason,
+				Message: message,
 			},
 		}
 	}
 }
 
+// splitDetailStatus splits the detail status of an ACI container state into a reason, e.g. CrashLoopBackOff, and a
+// message. Detail statuses which start with no single word reason are only a message.
+func splitDetailStatus(detailStatus string) (string, string) {
+	reason, message, found := strings.Cut(detailStatus, ":")
+	if !found {
+		reason, message = detailStatus, ""
+	}
+	if reason == "" || strings.ContainsAny(reason, " \t") {
+		return "", detailStatus
+	}
+	return reason, strings.TrimSpace(message)
+}
+
 func getPodPhaseFromACIState(state string) v1.PodPhase {
 	switch state {
 	case "Running":
@@ -194,36 +390,6 @@ func getPodPhaseFromACIState(state string) v1.PodPhase {
 	return v1.PodUnknown
 }
 
-func getPodConditionsFromACIState(state string, creationTime, lastUpdateTime time.Time, allReady bool) []v1.PodCondition {
-	// cg state is validated
-	switch state {
-	case "Running", "Succeeded":
-		readyConditionStatus := v1.ConditionFalse
-		readyConditionTime := creationTime
-		if allReady {
-			readyConditionStatus = v1.ConditionTrue
-			readyConditionTime = lastUpdateTime
-		}
-
-		return []v1.PodCondition{
-			{
-				Type:               v1.PodReady,
-				Status:             readyConditionStatus,
-				LastTransitionTime: metav1.Time{Time: readyConditionTime},
-			}, {
-				Type:               v1.PodInitialized,
-				Status:             v1.ConditionTrue,
-				LastTransitionTime: metav1.Time{Time: creationTime},
-			}, {
-				Type:               v1.PodScheduled,
-				Status:             v1.ConditionTrue,
-				LastTransitionTime: metav1.Time{Time: creationTime},
-			},
-		}
-	}
-	return []v1.PodCondition{}
-}
-
 func getACIResourceMetaFromContainerGroup(cg *azaciv2.ContainerGroup) (*string, time.Time, error) {
 	// cg is validated
 
@@ -41,15 +41,21 @@ func TestContainerGroupToPodStatus(t *testing.T) {
 	}{
 		{
 			description:           "Container is Running/Succeeded",
-			containerGroup:        testutil.CreateContainerGroupObj(cgName, cgName, "Succeeded", testutil.CreateACIContainersListObj("Running", "Initializing", startTime, finishTime, false, false, false), "Succeeded"),
-			expectedPodPhase:      getPodPhaseFromACIState("Succeeded"),
+			containerGroup:        testutil.CreateContainerGroupObj(cgName, cgName, "Running", testutil.CreateACIContainersListObj("Running", "Initializing", startTime, finishTime, false, false, false), "Succeeded"),
+			expectedPodPhase:      getPodPhaseFromACIState("Running"),
 			expectedPodConditions: testutil.GetPodConditions(metav1.NewTime(cgCreationTime), metav1.NewTime(finishTime), v1.ConditionTrue),
 		},
+		{
+			description:           "Container group Succeeded",
+			containerGroup:        testutil.CreateContainerGroupObj(cgName, cgName, "Succeeded", testutil.CreateACIContainersListObj("Terminated", "Running", startTime, finishTime, false, false, false), "Succeeded"),
+			expectedPodPhase:      getPodPhaseFromACIState("Succeeded"),
+			expectedPodConditions: testutil.GetPodConditions(metav1.NewTime(cgCreationTime), metav1.NewTime(finishTime), v1.ConditionFalse),
+		},
 		{
 			description:           "Container Failed",
 			containerGroup:        testutil.CreateContainerGroupObj(cgName, cgName, "Failed", testutil.CreateACIContainersListObj("Failed", "Running", startTime, finishTime, false, false, false), "Succeeded"),
 			expectedPodPhase:      getPodPhaseFromACIState("Failed"),
-			expectedPodConditions: []v1.PodCondition{},
+			expectedPodConditions: testutil.GetPodConditions(metav1.NewTime(cgCreationTime), metav1.NewTime(cgCreationTime), v1.ConditionFalse),
 		},
 	}
 	for _, tc := range cases {
@@ -57,7 +63,195 @@ func TestContainerGroupToPodStatus(t *testing.T) {
 			expectedStatus, err := provider.getPodStatusFromContainerGroup(context.TODO(), tc.containerGroup)
 			assert.NilError(t, err, "no errors should be returned")
 			assert.Equal(t, tc.expectedPodPhase, expectedStatus.Phase, "Pod phase is not as expected as current container group phase")
+			// the ACI readiness gates are dropped for pods which don't gate on them
+			mergePodConditions(&v1.Pod{}, expectedStatus)
 			assert.Equal(t, len(tc.expectedPodConditions), len(expectedStatus.Conditions), "Pod conditions are not as expected")
+			for _, condition := range tc.expectedPodConditions {
+				actual := findPodCondition(expectedStatus.Conditions, condition.Type)
+				assert.Assert(t, actual != nil, condition.Type)
+				assert.Equal(t, condition.Status, actual.Status, condition.Type)
+			}
+		})
+	}
+}
+
+func TestACIContainerStateToContainerState(t *testing.T) {
+	state := func(state, detailStatus string, exitCode int32) *azaciv2.ContainerState {
+		cs := testutil.CreateContainerStateObj(state, cgCreationTime, cgCreationTime, exitCode)
+		cs.DetailStatus = &detailStatus
+		return cs
+	}
+	cases := []struct {
+		description string
+		state       *azaciv2.ContainerState
+		expected    v1.ContainerState
+	}{
+		{
+			description: "no state",
+			expected:    v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		},
+		{
+			description: "terminated with a reason",
+			state:       state("Terminated", "OOMKilled", 137),
+			expected: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled",
+				StartedAt: metav1.NewTime(cgCreationTime), FinishedAt: metav1.NewTime(cgCreationTime)}},
+		},
+		{
+			description: "terminated with a message",
+			state:       state("Terminated", "process exited", 1),
+			expected: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "process exited",
+				StartedAt: metav1.NewTime(cgCreationTime), FinishedAt: metav1.NewTime(cgCreationTime)}},
+		},
+		{
+			description: "failed out of memory",
+			state:       &azaciv2.ContainerState{State: stringPtr("Failed"), DetailStatus: stringPtr("Container ran out of memory")},
+			expected: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled",
+				Message: "Container ran out of memory"}},
+		},
+		{
+			description: "completed",
+			state:       state("Terminated", "", 0),
+			expected: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed",
+				StartedAt: metav1.NewTime(cgCreationTime), FinishedAt: metav1.NewTime(cgCreationTime)}},
+		},
+		{
+			description: "waiting with a reason and a message",
+			state:       state("Waiting", "CrashLoopBackOff: Back-off restarting failed container", 0),
+			expected:    v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "Back-off restarting failed container"}},
+		},
+		{
+			description: "waiting without detail status",
+			state:       state("Waiting", "", 0),
+			expected:    v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "Waiting"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.DeepEqual(t, tc.expected, aciContainerStateToContainerState(tc.state))
 		})
 	}
 }
+
+func TestContainerGroupToPodContainerStatuses(t *testing.T) {
+	startTime := cgCreationTime.Add(time.Second * 3)
+	finishTime := startTime.Add(time.Second * 3)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provider, err := createTestProvider(createNewACIMock(), NewMockConfigMapLister(mockCtrl),
+		NewMockSecretLister(mockCtrl), NewMockPodLister(mockCtrl))
+	assert.NilError(t, err)
+
+	containers := testutil.CreateACIContainersListObj("Running", "Terminated", startTime, finishTime, false, false, false)
+	restartCount := int32(3)
+	containers[0].Properties.InstanceView.RestartCount = &restartCount
+	containers[0].Properties.InstanceView.PreviousState.ExitCode = &restartCount
+	cg := testutil.CreateContainerGroupObj(cgName, cgName, "Running", containers, "Succeeded")
+	initName, initImage := "init", "busybox"
+	cg.Properties.InitContainers = []*azaciv2.InitContainerDefinition{{
+		Name: &initName,
+		Properties: &azaciv2.InitContainerPropertiesDefinition{
+			Image: &initImage,
+			InstanceView: &azaciv2.InitContainerPropertiesDefinitionInstanceView{
+				CurrentState: testutil.CreateContainerStateObj("Terminated", cgCreationTime, startTime, 0),
+			},
+		},
+	}}
+
+	status, err := provider.getPodStatusFromContainerGroup(context.TODO(), cg)
+	assert.NilError(t, err)
+
+	assert.Equal(t, 1, len(status.ContainerStatuses))
+	containerStatus := status.ContainerStatuses[0]
+	assert.Check(t, containerStatus.Ready)
+	assert.Check(t, containerStatus.State.Running != nil)
+	assert.Equal(t, int32(3), containerStatus.RestartCount)
+	assert.Assert(t, containerStatus.LastTerminationState.Terminated != nil)
+	assert.Equal(t, int32(3), containerStatus.LastTerminationState.Terminated.ExitCode)
+	assert.Equal(t, "Error", containerStatus.LastTerminationState.Terminated.Reason)
+
+	assert.Equal(t, 1, len(status.InitContainerStatuses))
+	initStatus := status.InitContainerStatuses[0]
+	assert.Equal(t, initName, initStatus.Name)
+	assert.Equal(t, initImage, initStatus.Image)
+	assert.Check(t, initStatus.Ready)
+	assert.Assert(t, initStatus.State.Terminated != nil)
+	assert.Equal(t, "Completed", initStatus.State.Terminated.Reason)
+	assert.Check(t, initStatus.LastTerminationState.Terminated == nil)
+}
+
+func TestGetWaitingReasonFromEvents(t *testing.T) {
+	event := func(name, eventType, message string, at time.Time) *azaciv2.Event {
+		return &azaciv2.Event{Name: &name, Type: &eventType, Message: &message, LastTimestamp: &at}
+	}
+	cases := []struct {
+		description    string
+		events         []*azaciv2.Event
+		restartCount   int32
+		expectedReason string
+	}{
+		{
+			description:    "image pull failure",
+			events:         []*azaciv2.Event{event("Pulling", "Normal", "pulling image \"nginx:nope\"", cgCreationTime), event("Failed", "Warning", "Failed to pull image \"nginx:nope\"", cgCreationTime.Add(time.Second))},
+			expectedReason: "ErrImagePull",
+		},
+		{
+			description:    "image pull back-off",
+			events:         []*azaciv2.Event{event("BackOff", "Warning", "Back-off pulling image \"nginx:nope\"", cgCreationTime)},
+			expectedReason: "ImagePullBackOff",
+		},
+		{
+			description:    "crash loop",
+			events:         []*azaciv2.Event{event("BackOff", "Warning", "Back-off restarting failed container", cgCreationTime)},
+			expectedReason: "CrashLoopBackOff",
+		},
+		{
+			description:    "restarted without events",
+			restartCount:   2,
+			expectedReason: "CrashLoopBackOff",
+		},
+		{
+			description:    "pulling",
+			events:         []*azaciv2.Event{event("Failed", "Warning", "Failed to pull image", cgCreationTime), event("Pulling", "Normal", "pulling image", cgCreationTime.Add(time.Second))},
+			expectedReason: "Waiting",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			restartCount := tc.restartCount
+			instanceView := &azaciv2.ContainerPropertiesInstanceView{
+				CurrentState:  testutil.CreateContainerStateObj("Waiting", cgCreationTime, cgCreationTime, 0),
+				PreviousState: testutil.CreateContainerStateObj("Terminated", cgCreationTime, cgCreationTime, 1),
+				RestartCount:  &restartCount,
+				Events:        tc.events,
+			}
+			status := getContainerStatus(&cgName, "c", "nginx", instanceView)
+			assert.Assert(t, status.State.Waiting != nil)
+			assert.Equal(t, tc.expectedReason, status.State.Waiting.Reason)
+		})
+	}
+}
+
+func TestOOMKilledFromEvents(t *testing.T) {
+	startTime := cgCreationTime.Add(time.Second)
+	finishTime := startTime.Add(time.Minute)
+	oomAt := finishTime.Add(-time.Second)
+	name, eventType, message := "OOMKilling", "Warning", "Memory cgroup out of memory: Killed process 42"
+	restartCount := int32(1)
+	instanceView := &azaciv2.ContainerPropertiesInstanceView{
+		CurrentState:  testutil.CreateContainerStateObj("Running", finishTime, finishTime, 0),
+		PreviousState: testutil.CreateContainerStateObj("Terminated", startTime, finishTime, 137),
+		RestartCount:  &restartCount,
+		Events:        []*azaciv2.Event{{Name: &name, Type: &eventType, Message: &message, LastTimestamp: &oomAt}},
+	}
+
+	status := getContainerStatus(&cgName, "c", "nginx", instanceView)
+	assert.Assert(t, status.LastTerminationState.Terminated != nil)
+	assert.Equal(t, "OOMKilled", status.LastTerminationState.Terminated.Reason)
+	assert.Equal(t, int32(137), status.LastTerminationState.Terminated.ExitCode)
+
+	// the events of other instances don't apply
+	oomAt = startTime.Add(-time.Second)
+	status = getContainerStatus(&cgName, "c", "nginx", instanceView)
+	assert.Equal(t, "Error", status.LastTerminationState.Terminated.Reason)
+}
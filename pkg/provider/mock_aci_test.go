@@ -4,29 +4,49 @@ import (
 	"context"
 
 	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
 	"github.com/virtual-kubelet/virtual-kubelet/node/api"
 )
 
 type CreateContainerGroupFunc func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error
+type CreateContainerGroupFromProfileFunc func(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile client.ContainerGroupProfileReference) error
+type GetContainerGroupProfileImagesFunc func(ctx context.Context, profile client.ContainerGroupProfileReference) (map[string]string, error)
 type GetContainerGroupInfoFunc func(ctx context.Context, resourceGroup, namespace, name, nodeName string) (*azaciv2.ContainerGroup, error)
 type GetContainerGroupListFunc func(ctx context.Context, resourceGroup string) ([]*azaciv2.ContainerGroup, error)
 type ListCapabilitiesFunc func(ctx context.Context, region string) ([]*azaciv2.Capabilities, error)
+type ListUsageFunc func(ctx context.Context, region string) ([]*azaciv2.Usage, error)
 type DeleteContainerGroupFunc func(ctx context.Context, resourceGroup, cgName string) error
+type DeleteContainerGroupAndWaitFunc func(ctx context.Context, resourceGroup, cgName string) error
+type StopContainerGroupFunc func(ctx context.Context, resourceGroup, cgName string) error
+type StartContainerGroupFunc func(ctx context.Context, resourceGroup, cgName string) error
+type UpdateContainerGroupTagsFunc func(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error
 type ListLogsFunc func(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error)
 type ExecuteContainerCommandFunc func(ctx context.Context, resourceGroup, cgName, containerName string, containerReq azaciv2.ContainerExecRequest) (*azaciv2.ContainerExecResponse, error)
+type AttachToContainerFunc func(ctx context.Context, resourceGroup, cgName, containerName string) (*azaciv2.ContainerAttachResponse, error)
 
 type GetContainerGroupFunc func(ctx context.Context, resourceGroup, containerGroupName string) (*azaciv2.ContainerGroup, error)
 
 type MockACIProvider struct {
-	MockCreateContainerGroup    CreateContainerGroupFunc
-	MockGetContainerGroupInfo   GetContainerGroupInfoFunc
-	MockGetContainerGroupList   GetContainerGroupListFunc
-	MockListCapabilities        ListCapabilitiesFunc
-	MockDeleteContainerGroup    DeleteContainerGroupFunc
-	MockListLogs                ListLogsFunc
-	MockExecuteContainerCommand ExecuteContainerCommandFunc
+	MockCreateContainerGroup            CreateContainerGroupFunc
+	MockCreateContainerGroupFromProfile CreateContainerGroupFromProfileFunc
+	MockGetContainerGroupProfileImages  GetContainerGroupProfileImagesFunc
+	MockGetContainerGroupInfo           GetContainerGroupInfoFunc
+	MockGetContainerGroupList           GetContainerGroupListFunc
+	MockListCapabilities                ListCapabilitiesFunc
+	MockListUsage                       ListUsageFunc
+	MockDeleteContainerGroup            DeleteContainerGroupFunc
+	MockDeleteContainerGroupAndWait     DeleteContainerGroupAndWaitFunc
+	MockStopContainerGroup              StopContainerGroupFunc
+	MockStartContainerGroup             StartContainerGroupFunc
+	MockUpdateContainerGroupTags        UpdateContainerGroupTagsFunc
+	MockListLogs                        ListLogsFunc
+	MockExecuteContainerCommand         ExecuteContainerCommandFunc
+	MockAttachToContainer               AttachToContainerFunc
 
 	MockGetContainerGroup GetContainerGroupFunc
+
+	// MockOperationID is the ARM operation ID returned for created container groups.
+	MockOperationID string
 }
 
 func NewMockACIProvider(capList ListCapabilitiesFunc) *MockACIProvider {
@@ -42,6 +62,13 @@ func (m *MockACIProvider) ListCapabilities(ctx context.Context, region string) (
 	return nil, nil
 }
 
+func (m *MockACIProvider) ListUsage(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+	if m.MockListUsage != nil {
+		return m.MockListUsage(ctx, region)
+	}
+	return nil, nil
+}
+
 func (m *MockACIProvider) GetContainerGroupListResult(ctx context.Context, resourcegroup string) ([]*azaciv2.ContainerGroup, error) {
 	if m.MockGetContainerGroupList != nil {
 		return m.MockGetContainerGroupList(ctx, resourcegroup)
@@ -56,12 +83,34 @@ func (m *MockACIProvider) GetContainerGroupInfo(ctx context.Context, resourceGro
 	return nil, nil
 }
 
-func (m *MockACIProvider) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) error {
+func (m *MockACIProvider) CreateContainerGroup(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup) (string, error) {
 	if m.MockCreateContainerGroup != nil {
-		return m.MockCreateContainerGroup(ctx, resourceGroup, podNS, podName, cg)
+		return m.MockOperationID, m.MockCreateContainerGroup(ctx, resourceGroup, podNS, podName, cg)
+	}
+	return m.MockOperationID, nil
+}
+
+func (m *MockACIProvider) CreateContainerGroupFromProfile(ctx context.Context, resourceGroup, podNS, podName string, cg *azaciv2.ContainerGroup, profile client.ContainerGroupProfileReference) (string, error) {
+	if m.MockCreateContainerGroupFromProfile != nil {
+		return m.MockOperationID, m.MockCreateContainerGroupFromProfile(ctx, resourceGroup, podNS, podName, cg, profile)
+	}
+	return m.MockOperationID, nil
+}
+
+func (m *MockACIProvider) GetContainerGroupProfileImages(ctx context.Context, profile client.ContainerGroupProfileReference) (map[string]string, error) {
+	if m.MockGetContainerGroupProfileImages != nil {
+		return m.MockGetContainerGroupProfileImages(ctx, profile)
+	}
+	return nil, nil
+}
+
+func (m *MockACIProvider) UpdateContainerGroupTags(ctx context.Context, resourceGroup, cgName string, tags map[string]*string) error {
+	if m.MockUpdateContainerGroupTags != nil {
+		return m.MockUpdateContainerGroupTags(ctx, resourceGroup, cgName, tags)
 	}
 	return nil
 }
+
 func (m *MockACIProvider) DeleteContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
 	if m.MockDeleteContainerGroup != nil {
 		return m.MockDeleteContainerGroup(ctx, resourceGroup, cgName)
@@ -69,6 +118,27 @@ func (m *MockACIProvider) DeleteContainerGroup(ctx context.Context, resourceGrou
 	return nil
 }
 
+func (m *MockACIProvider) DeleteContainerGroupAndWait(ctx context.Context, resourceGroup, cgName string) error {
+	if m.MockDeleteContainerGroupAndWait != nil {
+		return m.MockDeleteContainerGroupAndWait(ctx, resourceGroup, cgName)
+	}
+	return nil
+}
+
+func (m *MockACIProvider) StopContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	if m.MockStopContainerGroup != nil {
+		return m.MockStopContainerGroup(ctx, resourceGroup, cgName)
+	}
+	return nil
+}
+
+func (m *MockACIProvider) StartContainerGroup(ctx context.Context, resourceGroup, cgName string) error {
+	if m.MockStartContainerGroup != nil {
+		return m.MockStartContainerGroup(ctx, resourceGroup, cgName)
+	}
+	return nil
+}
+
 func (m *MockACIProvider) ListLogs(ctx context.Context, resourceGroup, cgName, containerName string, opts api.ContainerLogOpts) (*string, error) {
 	if m.MockListLogs != nil {
 		return m.MockListLogs(ctx, resourceGroup, cgName, containerName, opts)
@@ -84,6 +154,13 @@ func (m *MockACIProvider) ExecuteContainerCommand(ctx context.Context, resourceG
 	return nil, nil
 }
 
+func (m *MockACIProvider) AttachToContainer(ctx context.Context, resourceGroup, cgName, containerName string) (*azaciv2.ContainerAttachResponse, error) {
+	if m.MockAttachToContainer != nil {
+		return m.MockAttachToContainer(ctx, resourceGroup, cgName, containerName)
+	}
+	return nil, nil
+}
+
 func (m *MockACIProvider) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*azaciv2.ContainerGroup, error) {
 	if m.MockGetContainerGroup != nil {
 		return m.MockGetContainerGroup(ctx, resourceGroup, containerGroupName)
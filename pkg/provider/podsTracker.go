@@ -2,12 +2,16 @@ package provider
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/virtual-kubelet/azure-aci/pkg/logging"
 	errdef "github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	corev1listers "k8s.io/client-go/listers/core/v1"
@@ -21,6 +25,9 @@ const (
 
 	statusUpdatesInterval = 5 * time.Second
 	cleanupInterval       = 5 * time.Minute
+
+	// defaultStatusUpdateWorkers is the number of pod statuses fetched concurrently by default.
+	defaultStatusUpdateWorkers = 10
 )
 
 type PodIdentifier struct {
@@ -38,12 +45,23 @@ type PodsTracker struct {
 	pods     corev1listers.PodLister
 	updateCb func(*v1.Pod)
 	handler  PodsTrackerHandler
+
+	// workers is the number of pod statuses fetched concurrently.
+	workers int
+	// minPodUpdateInterval is the minimum time between two status fetches of the same pod, guarded by lock.
+	minPodUpdateInterval time.Duration
+
+	lock        sync.Mutex
+	lastUpdates map[PodIdentifier]time.Time
+	// cbLock serializes the calls to updateCb
+	cbLock sync.Mutex
 }
 
 // StartTracking starts the background tracking for created pods.
 func (pt *PodsTracker) StartTracking(ctx context.Context) {
 	ctx, span := trace.StartSpan(ctx, "PodsTracker.StartTracking")
 	defer span.End()
+	ctx = logging.WithComponent(ctx, logging.ComponentTracker)
 
 	statusUpdatesTimer := time.NewTimer(statusUpdatesInterval)
 	cleanupTimer := time.NewTimer(cleanupInterval)
@@ -88,10 +106,33 @@ func (pt *PodsTracker) UpdatePodStatus(ctx context.Context, ns, name string, upd
 	}
 
 	updateHandler(&updatedPod.Status)
-	pt.updateCb(updatedPod)
+	pt.notify(updatedPod)
 	return nil
 }
 
+// RefreshPodStatus fetches the status of a pod from the provider right away and posts it to the update callback.
+func (pt *PodsTracker) RefreshPodStatus(ctx context.Context, ns, name string) error {
+	ctx, span := trace.StartSpan(ctx, "PodsTracker.RefreshPodStatus")
+	defer span.End()
+
+	pod, err := pt.pods.Pods(ns).Get(name)
+	if err != nil {
+		return err
+	}
+
+	updatedPod := pod.DeepCopy()
+	if pt.processPodUpdates(ctx, updatedPod) {
+		pt.notify(updatedPod)
+	}
+	return nil
+}
+
+func (pt *PodsTracker) notify(pod *v1.Pod) {
+	pt.cbLock.Lock()
+	defer pt.cbLock.Unlock()
+	pt.updateCb(pod)
+}
+
 func (pt *PodsTracker) updatePodsLoop(ctx context.Context) {
 	ctx, span := trace.StartSpan(ctx, "PodsTracker.updatePods")
 	defer span.End()
@@ -100,11 +141,73 @@ func (pt *PodsTracker) updatePodsLoop(ctx context.Context) {
 	if err != nil {
 		log.L.WithError(err).Errorf("failed to retrieve pods list")
 	}
+
+	workers := pt.workers
+	if workers <= 0 {
+		workers = defaultStatusUpdateWorkers
+	}
+
+	g := errgroup.Group{}
+	g.SetLimit(workers)
 	for _, pod := range k8sPods {
+		if !pt.shouldFetchPodStatus(pod) {
+			continue
+		}
 		updatedPod := pod.DeepCopy()
-		ok := pt.processPodUpdates(ctx, updatedPod)
-		if ok {
-			pt.updateCb(updatedPod)
+		g.Go(func() error {
+			ok := pt.processPodUpdates(ctx, updatedPod)
+			if ok {
+				pt.notify(updatedPod)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	pt.forgetDeletedPods(k8sPods)
+}
+
+// shouldFetchPodStatus rate limits the status fetches of a pod to one per minPodUpdateInterval.
+func (pt *PodsTracker) shouldFetchPodStatus(pod *v1.Pod) bool {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if pt.minPodUpdateInterval <= 0 {
+		return true
+	}
+
+	if pt.lastUpdates == nil {
+		pt.lastUpdates = make(map[PodIdentifier]time.Time)
+	}
+	id := PodIdentifier{namespace: pod.Namespace, name: pod.Name}
+	if last, ok := pt.lastUpdates[id]; ok && time.Since(last) < pt.minPodUpdateInterval {
+		return false
+	}
+	pt.lastUpdates[id] = time.Now()
+	return true
+}
+
+// setMinPodUpdateInterval changes the minimum time between two status fetches of the same pod.
+func (pt *PodsTracker) setMinPodUpdateInterval(interval time.Duration) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pt.minPodUpdateInterval = interval
+}
+
+// forgetDeletedPods drops the rate limiting state of the pods which are not in the list anymore.
+func (pt *PodsTracker) forgetDeletedPods(k8sPods []*v1.Pod) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if len(pt.lastUpdates) == 0 {
+		return
+	}
+	existing := make(map[PodIdentifier]bool, len(k8sPods))
+	for _, pod := range k8sPods {
+		existing[PodIdentifier{namespace: pod.Namespace, name: pod.Name}] = true
+	}
+	for id := range pt.lastUpdates {
+		if !existing[id] {
+			delete(pt.lastUpdates, id)
 		}
 	}
 }
@@ -151,6 +254,12 @@ func (pt *PodsTracker) processPodUpdates(ctx context.Context, pod *v1.Pod) bool
 
 	podStatusFromProvider, err := pt.handler.FetchPodStatus(ctx, pod.Namespace, pod.Name)
 	if err == nil && podStatusFromProvider != nil {
+		mergePodConditions(pod, podStatusFromProvider)
+		keepConditionTransitionTimes(pod.Status.Conditions, podStatusFromProvider.Conditions)
+		// only the changes are pushed to the node controller, which updates the status in the API server
+		if apiequality.Semantic.DeepEqual(pod.Status, *podStatusFromProvider) {
+			return false
+		}
 		podStatusFromProvider.DeepCopyInto(&pod.Status)
 		return true
 	}
@@ -189,6 +298,20 @@ func (pt *PodsTracker) processPodUpdates(ctx context.Context, pod *v1.Pod) bool
 	return false
 }
 
+// keepConditionTransitionTimes keeps the probe and transition times of the conditions whose status didn't change,
+// as the provider reports the time of the fetch for some of them.
+func keepConditionTransitionTimes(current, updated []v1.PodCondition) {
+	for i := range updated {
+		for _, condition := range current {
+			if condition.Type == updated[i].Type && condition.Status == updated[i].Status {
+				updated[i].LastProbeTime = condition.LastProbeTime
+				updated[i].LastTransitionTime = condition.LastTransitionTime
+				break
+			}
+		}
+	}
+}
+
 func (pt *PodsTracker) shouldSkipPodStatusUpdate(pod *v1.Pod) bool {
 	return pod.Status.Phase == v1.PodSucceeded || // Pod completed its execution
 		pod.Status.Phase == v1.PodFailed ||
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	is "gotest.tools/assert/cmp"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestUpdatePodStatus(t *testing.T) {
@@ -148,7 +150,7 @@ func TestProcessPodUpdates(t *testing.T) {
 					assert.Check(t, pod.Status.Conditions != nil, "podStatus conditions should be set")
 					assert.Check(t, pod.Status.StartTime != nil, "podStatus start time should be set")
 					assert.Check(t, pod.Status.ContainerStatuses != nil, "podStatus container statuses should be set")
-					assert.Check(t, is.Equal(len(pod.Status.Conditions), 3), "3 pod conditions should be present")
+					assert.Check(t, is.Equal(len(pod.Status.Conditions), 4), "4 pod conditions should be present")
 				}
 
 				if tc.podPhase == v1.PodRunning {
@@ -263,3 +265,98 @@ func TestCleanupDanglingPods(t *testing.T) {
 		}
 	}
 }
+
+type concurrencyTrackingHandler struct {
+	PodsTrackerHandler
+	lock            sync.Mutex
+	running         int
+	maxRunning      int
+	fetchedStatuses int
+}
+
+func (h *concurrencyTrackingHandler) FetchPodStatus(ctx context.Context, ns, name string) (*v1.PodStatus, error) {
+	h.lock.Lock()
+	h.running++
+	h.fetchedStatuses++
+	if h.running > h.maxRunning {
+		h.maxRunning = h.running
+	}
+	h.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	h.lock.Lock()
+	h.running--
+	h.lock.Unlock()
+	return &v1.PodStatus{Phase: v1.PodRunning}, nil
+}
+
+func TestUpdatePodsLoop(t *testing.T) {
+	podNamespace := "ns-" + uuid.New().String()
+	podNames := make([]string, 0, 8)
+	for i := 0; i < 8; i++ {
+		podNames = append(podNames, "pod-"+uuid.New().String())
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(testsutil.CreatePodsList(podNames, podNamespace), nil).AnyTimes()
+
+	handler := &concurrencyTrackingHandler{}
+	updatedPods := 0
+	podsTracker := &PodsTracker{
+		pods: podLister,
+		updateCb: func(p *v1.Pod) {
+			updatedPods++
+		},
+		handler:              handler,
+		workers:              3,
+		minPodUpdateInterval: time.Hour,
+	}
+
+	podsTracker.updatePodsLoop(context.Background())
+	assert.Check(t, is.Equal(len(podNames), updatedPods), "all pods should be updated")
+	assert.Check(t, handler.maxRunning <= 3, "at most 3 statuses should be fetched concurrently, got %d", handler.maxRunning)
+	assert.Check(t, handler.maxRunning > 1, "statuses should be fetched concurrently")
+
+	podsTracker.updatePodsLoop(context.Background())
+	assert.Check(t, is.Equal(len(podNames), handler.fetchedStatuses), "pod statuses should not be fetched again within the minimum interval")
+}
+
+func TestProcessPodUpdatesUnchangedStatus(t *testing.T) {
+	transition := metav1.NewTime(time.Now().Add(-time.Hour))
+	pod := testsutil.CreatePodObj("pod", "ns")
+	pod.Status = v1.PodStatus{
+		Phase: v1.PodRunning,
+		Conditions: []v1.PodCondition{
+			{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: transition},
+		},
+	}
+
+	status := v1.PodStatus{
+		Phase: v1.PodRunning,
+		Conditions: []v1.PodCondition{
+			{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()},
+		},
+	}
+	podsTracker := &PodsTracker{
+		handler: &statusHandler{status: &status},
+	}
+	assert.Check(t, !podsTracker.processPodUpdates(context.Background(), pod.DeepCopy()), "unchanged status should not be pushed")
+
+	status.Conditions[0].Status = v1.ConditionFalse
+	updatedPod := pod.DeepCopy()
+	assert.Check(t, podsTracker.processPodUpdates(context.Background(), updatedPod), "changed status should be pushed")
+	assert.Check(t, updatedPod.Status.Conditions[0].LastTransitionTime.After(transition.Time))
+}
+
+type statusHandler struct {
+	PodsTrackerHandler
+	status *v1.PodStatus
+}
+
+func (h *statusHandler) FetchPodStatus(ctx context.Context, ns, name string) (*v1.PodStatus, error) {
+	return h.status.DeepCopy(), nil
+}
@@ -6,8 +6,11 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
 	v1 "k8s.io/api/core/v1"
@@ -20,10 +23,12 @@ import (
 func (p *ACIProvider) ConfigureNode(ctx context.Context, node *v1.Node) {
 	node.Status.Capacity = p.capacity()
 	node.Status.Allocatable = p.capacity()
-	node.Status.Conditions = p.nodeConditions()
+	node.Status.Conditions = append(p.nodeConditions(), p.healthConditions(ctx, time.Now(), false)...)
 	node.Status.Addresses = p.nodeAddresses()
 	node.Status.DaemonEndpoints = p.nodeDaemonEndpoints()
 	node.Status.NodeInfo.OperatingSystem = p.operatingSystem
+	node.Status.NodeInfo.Architecture = aciArchitecture
+	p.configureNodeMetadata(node)
 	node.ObjectMeta.Labels["alpha.service-controller.kubernetes.io/exclude-balancer"] = "true"
 	node.ObjectMeta.Labels["node.kubernetes.io/exclude-from-external-load-balancers"] = "true"
 
@@ -31,9 +36,17 @@ func (p *ACIProvider) ConfigureNode(ctx context.Context, node *v1.Node) {
 	os := strings.ToLower(p.operatingSystem)
 	node.ObjectMeta.Labels["beta.kubernetes.io/os"] = os
 	node.ObjectMeta.Labels["kubernetes.io/os"] = os
+	// ACI only runs amd64 containers, so that the pods of other architectures of multi-arch clusters aren't
+	// scheduled to the node
+	node.ObjectMeta.Labels["beta.kubernetes.io/arch"] = aciArchitecture
+	node.ObjectMeta.Labels["kubernetes.io/arch"] = aciArchitecture
 
 	// Virtual node would be skipped for cloud provider operations (e.g. CP should not add route).
 	node.ObjectMeta.Labels["kubernetes.azure.com/managed"] = "false"
+
+	p.nodeLock.Lock()
+	p.node = node.DeepCopy()
+	p.nodeLock.Unlock()
 }
 
 // capacity returns a resource list containing the capacity limits set for ACI.
@@ -127,9 +140,15 @@ func (p *ACIProvider) setupNodeCapacity(ctx context.Context) error {
 	_ = addAzureAttributes(ctx, span, p)
 
 	// Set sane defaults for Capacity in case config is not supplied
-	p.cpu = "10000"
-	p.memory = "4Ti"
-	p.pods = "5000"
+	if p.cpu == "" {
+		p.cpu = "10000"
+	}
+	if p.memory == "" {
+		p.memory = "4Ti"
+	}
+	if p.pods == "" {
+		p.pods = "5000"
+	}
 
 	if cpuQuota := os.Getenv("ACI_QUOTA_CPU"); cpuQuota != "" {
 		p.cpu = cpuQuota
@@ -143,6 +162,20 @@ func (p *ACIProvider) setupNodeCapacity(ctx context.Context) error {
 		p.pods = podsQuota
 	}
 
+	for name, quantity := range map[string]string{"CPU": p.cpu, "memory": p.memory, "pods": p.pods} {
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return fmt.Errorf("invalid %s capacity %q: %v", name, quantity, err)
+		}
+	}
+
+	if dynamicCapacity := os.Getenv("ACI_DYNAMIC_CAPACITY"); dynamicCapacity != "" {
+		enabled, err := strconv.ParseBool(dynamicCapacity)
+		if err != nil {
+			return fmt.Errorf("error parsing ACI_DYNAMIC_CAPACITY: %v", err)
+		}
+		p.dynamicCapacity = enabled
+	}
+
 	//TODO To be uncommented after Location API fix
 	//capabilities, err := p.azClientsAPIs.ListCapabilities(ctx, p.region)
 	//if err != nil {
@@ -0,0 +1,143 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const defaultCapacityRefreshInterval = 5 * time.Minute
+
+// NotifyNodeStatus implements node.NodeProvider. The health conditions of the node are refreshed periodically and
+// reported through the callback when they change. When dynamic capacity is enabled, the pods are accounted by
+// their limits or the resource overhead of their container groups is accounted, the allocatable resources of the
+// node are refreshed and reported as well.
+func (p *ACIProvider) NotifyNodeStatus(ctx context.Context, cb func(*v1.Node)) {
+	go p.runNodeHealthChecks(ctx, cb)
+
+	if !p.dynamicCapacity && p.overcommitPolicy != overcommitPolicyLimits && !p.accountResourceOverhead {
+		return
+	}
+
+	go func() {
+		for {
+			if node := p.refreshNodeAllocatable(ctx); node != nil {
+				cb(node)
+			}
+			// the interval is read on every refresh, as it can be changed by a reload of the config
+			timer := time.NewTimer(p.getCapacityRefreshInterval())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// getCapacityRefreshInterval returns the interval between two refreshes of the node allocatable resources.
+func (p *ACIProvider) getCapacityRefreshInterval() time.Duration {
+	p.settingsLock.RLock()
+	defer p.settingsLock.RUnlock()
+	if p.capacityRefreshInterval <= 0 {
+		return defaultCapacityRefreshInterval
+	}
+	return p.capacityRefreshInterval
+}
+
+// refreshNodeAllocatable returns a copy of the node with its allocatable resources lowered to the remaining
+// ACI quota, to the limits of the pods and by the resource overhead of their container groups, or nil when the node is not configured yet or the usage can't be
+// retrieved.
+func (p *ACIProvider) refreshNodeAllocatable(ctx context.Context) *v1.Node {
+	ctx, span := trace.StartSpan(ctx, "aci.refreshNodeAllocatable")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	p.nodeLock.Lock()
+	defer p.nodeLock.Unlock()
+	if p.node == nil {
+		return nil
+	}
+
+	pods, err := p.podsL.List(labels.Everything())
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to list the pods, keeping the current node allocatable resources")
+		return nil
+	}
+
+	allocatable := p.capacity()
+	if p.dynamicCapacity {
+		usage, err := p.azClientsAPIs.ListUsage(ctx, p.region)
+		if err != nil {
+			log.G(ctx).WithError(err).Warn("unable to fetch the ACI usage, keeping the current node allocatable resources")
+			return nil
+		}
+		allocatable = getDynamicAllocatable(allocatable, usage, pods)
+	}
+	if p.overcommitPolicy == overcommitPolicyLimits {
+		allocatable = getLimitsAllocatable(allocatable, pods, p.getAccountedResourcePolicy)
+	}
+	if p.accountResourceOverhead {
+		allocatable = p.getOverheadAllocatable(allocatable, pods)
+	}
+
+	p.node.Status.Allocatable = allocatable
+	return p.node.DeepCopy()
+}
+
+// getDynamicAllocatable caps the CPU and pods of the capacity to what the pods of the node use already
+// plus the remaining core and container group quota. The quota includes the container groups of the node,
+// so their requests are added back as the scheduler subtracts them from the allocatable resources again.
+func getDynamicAllocatable(capacity v1.ResourceList, usage []*azaciv2.Usage, pods []*v1.Pod) v1.ResourceList {
+	allocatable := capacity.DeepCopy()
+
+	var podCount int64
+	cpu := resource.Quantity{}
+	for _, pod := range pods {
+		if !isActivePod(pod) {
+			continue
+		}
+		podCount++
+		for _, container := range pod.Spec.Containers {
+			if request, ok := container.Resources.Requests[v1.ResourceCPU]; ok {
+				cpu.Add(request)
+			}
+		}
+	}
+
+	for _, u := range usage {
+		if u.Name == nil || u.CurrentValue == nil || u.Limit == nil {
+			continue
+		}
+		remaining := int64(*u.Limit - *u.CurrentValue)
+		if remaining < 0 {
+			remaining = 0
+		}
+		switch name := stringValue(u.Name.Value); {
+		case strings.EqualFold(name, standardCoresUsageName):
+			quota := cpu.DeepCopy()
+			quota.Add(*resource.NewQuantity(remaining, resource.DecimalSI))
+			if quota.Cmp(allocatable[v1.ResourceCPU]) < 0 {
+				allocatable[v1.ResourceCPU] = quota
+			}
+		case strings.EqualFold(name, containerGroupsUsageName):
+			quota := *resource.NewQuantity(podCount+remaining, resource.DecimalSI)
+			if quota.Cmp(allocatable[v1.ResourcePods]) < 0 {
+				allocatable[v1.ResourcePods] = quota
+			}
+		}
+	}
+	return allocatable
+}
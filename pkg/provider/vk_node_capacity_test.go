@@ -0,0 +1,89 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"testing"
+
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/golang/mock/gomock"
+	testsutil "github.com/virtual-kubelet/azure-aci/pkg/tests"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDynamicAllocatable(t *testing.T) {
+	capacity := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("100"),
+		v1.ResourceMemory: resource.MustParse("4Ti"),
+		v1.ResourcePods:   resource.MustParse("50"),
+	}
+	pods := testsutil.CreatePodsList([]string{"p1", "p2", "p3"}, "ns")
+	for _, pod := range pods {
+		pod.Spec.Containers = []v1.Container{{
+			Name: "c",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1500m")},
+			},
+		}}
+	}
+	pods[2].Status.Phase = v1.PodSucceeded
+
+	allocatable := getDynamicAllocatable(capacity, []*azaciv2.Usage{
+		newTestUsage("StandardCores", 90, 100),
+		newTestUsage("ContainerGroups", 95, 100),
+	}, pods)
+	assert.Check(t, is.Equal("13", allocatable.Cpu().String()))
+	assert.Check(t, is.Equal("7", allocatable.Pods().String()))
+	assert.Check(t, is.Equal("4Ti", allocatable.Memory().String()))
+
+	// the allocatable resources never exceed the capacity
+	allocatable = getDynamicAllocatable(capacity, []*azaciv2.Usage{
+		newTestUsage("StandardCores", 0, 1000),
+		newTestUsage("ContainerGroups", 0, 1000),
+	}, pods)
+	assert.Check(t, is.DeepEqual(capacity, allocatable))
+}
+
+func TestNotifyNodeStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	podLister := NewMockPodLister(mockCtrl)
+	podLister.EXPECT().List(gomock.Any()).Return(nil, nil).AnyTimes()
+
+	aciMocks := createNewACIMock()
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		return []*azaciv2.Usage{newTestUsage("ContainerGroups", 95, 100)}, nil
+	}
+
+	provider := &ACIProvider{
+		azClientsAPIs:   aciMocks,
+		podsL:           podLister,
+		cpu:             "100",
+		memory:          "4Ti",
+		pods:            "50",
+		dynamicCapacity: true,
+	}
+	provider.ConfigureNode(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := make(chan *v1.Node, 1)
+	provider.NotifyNodeStatus(ctx, func(node *v1.Node) {
+		select {
+		case nodes <- node:
+		default:
+		}
+	})
+
+	node := <-nodes
+	assert.Check(t, is.Equal("5", node.Status.Allocatable.Pods().String()))
+	assert.Check(t, is.Equal("50", node.Status.Capacity.Pods().String()))
+}
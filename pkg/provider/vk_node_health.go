@@ -0,0 +1,188 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The health conditions of the node are true when the provider is degraded, like the pressure conditions of
+	// the kubelet.
+	nodeConditionAuthenticationFailed v1.NodeConditionType = "ACIAuthenticationFailed"
+	nodeConditionARMThrottled         v1.NodeConditionType = "ARMThrottled"
+	nodeConditionSubnetMisconfigured  v1.NodeConditionType = "ACISubnetMisconfigured"
+
+	defaultHealthCheckInterval = time.Minute
+	// armThrottledWindow is how long the node is reported throttled after the last throttled ARM call.
+	armThrottledWindow = 5 * time.Minute
+)
+
+// healthConditions returns the health conditions of the provider: whether the ARM calls fail to authenticate or
+// are throttled, and whether the subnet of the node is still delegated to ACI. The subnet is only looked up when
+// checkSubnet is set, it was validated when the provider started.
+func (p *ACIProvider) healthConditions(ctx context.Context, now time.Time, checkSubnet bool) []v1.NodeCondition {
+	authCondition := newNodeCondition(nodeConditionAuthenticationFailed, false, now, "AuthenticationSucceeded",
+		"the provider is authenticated to ARM")
+	throttledCondition := newNodeCondition(nodeConditionARMThrottled, false, now, "ARMNotThrottled",
+		"ARM doesn't throttle the provider")
+	if p.armHealth != nil {
+		if failure, _ := p.armHealth.GetAuthenticationFailure(); failure != "" {
+			authCondition = newNodeCondition(nodeConditionAuthenticationFailed, true, now, "AuthenticationFailed",
+				"the provider failed to authenticate to ARM: "+failure)
+		}
+		if at := p.armHealth.GetLastThrottled(); !at.IsZero() && now.Sub(at) < armThrottledWindow {
+			throttledCondition = newNodeCondition(nodeConditionARMThrottled, true, now, "ARMThrottled",
+				fmt.Sprintf("ARM throttled the provider in the last %s", armThrottledWindow))
+		}
+	}
+	conditions := []v1.NodeCondition{authCondition, throttledCondition}
+
+	if subnetName := p.providernetwork.SubnetName; subnetName != "" {
+		subnetCondition := newNodeCondition(nodeConditionSubnetMisconfigured, false, now, "SubnetConfigured",
+			fmt.Sprintf("subnet %s is delegated to ACI", subnetName))
+		if checkSubnet {
+			if err := p.providernetwork.CheckSubnet(ctx, subnetName); err != nil {
+				subnetCondition = newNodeCondition(nodeConditionSubnetMisconfigured, true, now, "SubnetMisconfigured", err.Error())
+			}
+		}
+		conditions = append(conditions, subnetCondition)
+	}
+	return conditions
+}
+
+func newNodeCondition(conditionType v1.NodeConditionType, status bool, now time.Time, reason, message string) v1.NodeCondition {
+	condition := v1.NodeCondition{
+		Type:               conditionType,
+		Status:             v1.ConditionFalse,
+		LastHeartbeatTime:  metav1.NewTime(now),
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reason,
+		Message:            message,
+	}
+	if status {
+		condition.Status = v1.ConditionTrue
+	}
+	return condition
+}
+
+// setNodeCondition sets a condition of the node, keeping its transition time when its status doesn't change, and
+// returns whether the status, reason or message of the condition changed.
+func setNodeCondition(node *v1.Node, condition v1.NodeCondition) bool {
+	for i := range node.Status.Conditions {
+		current := &node.Status.Conditions[i]
+		if current.Type != condition.Type {
+			continue
+		}
+		changed := current.Status != condition.Status || current.Reason != condition.Reason || current.Message != condition.Message
+		if current.Status == condition.Status {
+			condition.LastTransitionTime = current.LastTransitionTime
+		}
+		*current = condition
+		return changed
+	}
+	node.Status.Conditions = append(node.Status.Conditions, condition)
+	return true
+}
+
+// refreshNodeHealth returns a copy of the node with its health conditions refreshed when one of them changed, or
+// nil when the node is not configured yet or its health didn't change.
+func (p *ACIProvider) refreshNodeHealth(ctx context.Context) *v1.Node {
+	ctx, span := trace.StartSpan(ctx, "aci.refreshNodeHealth")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	conditions := p.healthConditions(ctx, time.Now(), true)
+
+	p.nodeLock.Lock()
+	defer p.nodeLock.Unlock()
+	if p.node == nil {
+		return nil
+	}
+	changed := false
+	for _, condition := range conditions {
+		if setNodeCondition(p.node, condition) {
+			changed = true
+			if condition.Status == v1.ConditionTrue {
+				log.G(ctx).Warnf("node condition %s: %s", condition.Type, condition.Message)
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return p.node.DeepCopy()
+}
+
+// runNodeHealthChecks refreshes the health conditions of the node periodically and reports them through the
+// callback when they change, and reports the node as soon as Ping sets it ready or not ready.
+func (p *ACIProvider) runNodeHealthChecks(ctx context.Context, cb func(*v1.Node)) {
+	ticker := time.NewTicker(defaultHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.serviceHealthChanged():
+			p.nodeLock.Lock()
+			var node *v1.Node
+			if p.node != nil {
+				node = p.node.DeepCopy()
+			}
+			p.nodeLock.Unlock()
+			if node != nil {
+				cb(node)
+			}
+			continue
+		case <-ticker.C:
+		}
+		if node := p.refreshNodeHealth(ctx); node != nil {
+			cb(node)
+		}
+	}
+}
+
+// HealthzHandler serves the liveness of the provider.
+func (p *ACIProvider) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+}
+
+// ReadyzHandler serves the readiness of the provider, which isn't ready until the node is configured and while
+// the ARM calls fail to authenticate.
+func (p *ACIProvider) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var failures []string
+		p.nodeLock.Lock()
+		configured := p.node != nil
+		p.nodeLock.Unlock()
+		if !configured {
+			failures = append(failures, "the node is not configured")
+		}
+		if p.armHealth != nil {
+			if failure, _ := p.armHealth.GetAuthenticationFailure(); failure != "" {
+				failures = append(failures, "the provider failed to authenticate to ARM: "+failure)
+			}
+		}
+
+		if len(failures) > 0 {
+			http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/virtual-kubelet/azure-aci/pkg/client"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getNodeCondition(node *v1.Node, conditionType v1.NodeConditionType) *v1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == conditionType {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func TestRefreshNodeHealth(t *testing.T) {
+	provider := &ACIProvider{
+		cpu:       "100",
+		memory:    "4Ti",
+		pods:      "50",
+		armHealth: client.NewARMHealth(),
+	}
+	assert.Check(t, provider.refreshNodeHealth(context.Background()) == nil, "the node isn't configured")
+
+	provider.ConfigureNode(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}})
+	assert.Check(t, provider.refreshNodeHealth(context.Background()) == nil, "the health of the node didn't change")
+
+	req, err := http.NewRequest(http.MethodPut, "https://management.azure.com/cg", nil)
+	assert.NilError(t, err)
+	provider.armHealth.RecordResponse(&http.Response{StatusCode: http.StatusUnauthorized, Request: req}, nil, time.Now())
+	provider.armHealth.RecordThrottled(time.Now())
+
+	node := provider.refreshNodeHealth(context.Background())
+	assert.Assert(t, node != nil)
+	authCondition := getNodeCondition(node, nodeConditionAuthenticationFailed)
+	assert.Check(t, is.Equal(v1.ConditionTrue, authCondition.Status))
+	assert.Check(t, is.Equal("AuthenticationFailed", authCondition.Reason))
+	assert.Check(t, is.Equal(v1.ConditionTrue, getNodeCondition(node, nodeConditionARMThrottled).Status))
+	assert.Check(t, getNodeCondition(node, nodeConditionSubnetMisconfigured) == nil)
+	assert.Check(t, is.Equal(v1.ConditionTrue, getNodeCondition(node, v1.NodeReady).Status))
+
+	recorder := httptest.NewRecorder()
+	provider.ReadyzHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Check(t, is.Equal(http.StatusServiceUnavailable, recorder.Code))
+
+	// the transition time is kept while the status doesn't change
+	provider.armHealth.RecordResponse(&http.Response{StatusCode: http.StatusOK, Request: req}, nil, time.Now())
+	node = provider.refreshNodeHealth(context.Background())
+	assert.Assert(t, node != nil)
+	assert.Check(t, is.Equal(v1.ConditionFalse, getNodeCondition(node, nodeConditionAuthenticationFailed).Status))
+	throttledCondition := getNodeCondition(node, nodeConditionARMThrottled)
+	assert.Check(t, is.Equal(v1.ConditionTrue, throttledCondition.Status))
+
+	recorder = httptest.NewRecorder()
+	provider.ReadyzHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Check(t, is.Equal(http.StatusOK, recorder.Code))
+}
+
+func TestSetNodeCondition(t *testing.T) {
+	before := time.Now().Add(-time.Hour)
+	node := &v1.Node{}
+	assert.Check(t, setNodeCondition(node, newNodeCondition(nodeConditionARMThrottled, true, before, "ARMThrottled", "")))
+
+	now := time.Now()
+	assert.Check(t, !setNodeCondition(node, newNodeCondition(nodeConditionARMThrottled, true, now, "ARMThrottled", "")))
+	assert.Check(t, is.Len(node.Status.Conditions, 1))
+	assert.Check(t, node.Status.Conditions[0].LastTransitionTime.Time.Equal(metav1.NewTime(before).Time))
+	assert.Check(t, node.Status.Conditions[0].LastHeartbeatTime.Time.Equal(metav1.NewTime(now).Time))
+
+	assert.Check(t, setNodeCondition(node, newNodeCondition(nodeConditionARMThrottled, false, now, "ARMNotThrottled", "")))
+	assert.Check(t, node.Status.Conditions[0].LastTransitionTime.Time.Equal(metav1.NewTime(now).Time))
+}
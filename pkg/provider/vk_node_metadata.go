@@ -0,0 +1,142 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// nodeTaintConfig is a taint of the virtual node in the provider config.
+type nodeTaintConfig struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// setupNodeMetadata adds the labels, annotations and taints of the ACI_NODE_LABELS, ACI_NODE_ANNOTATIONS
+// and ACI_NODE_TAINTS environment variables to the ones of the config file, and validates all of them.
+// Labels and annotations are comma separated key=value pairs, taints use the kubectl format key[=value]:effect.
+func (p *ACIProvider) setupNodeMetadata() error {
+	if labels := os.Getenv("ACI_NODE_LABELS"); labels != "" {
+		if err := parseKeyValuePairs(labels, &p.nodeLabels); err != nil {
+			return fmt.Errorf("error parsing ACI_NODE_LABELS: %v", err)
+		}
+	}
+	if annotations := os.Getenv("ACI_NODE_ANNOTATIONS"); annotations != "" {
+		if err := parseKeyValuePairs(annotations, &p.nodeAnnotations); err != nil {
+			return fmt.Errorf("error parsing ACI_NODE_ANNOTATIONS: %v", err)
+		}
+	}
+	if taints := os.Getenv("ACI_NODE_TAINTS"); taints != "" {
+		for _, taint := range strings.Split(taints, ",") {
+			parsed, err := parseTaint(strings.TrimSpace(taint))
+			if err != nil {
+				return fmt.Errorf("error parsing ACI_NODE_TAINTS: %v", err)
+			}
+			p.nodeTaints = append(p.nodeTaints, parsed)
+		}
+	}
+
+	for key, value := range p.nodeLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid node label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid node label value %q: %s", value, strings.Join(errs, "; "))
+		}
+	}
+	for key := range p.nodeAnnotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) > 0 {
+			return fmt.Errorf("invalid node annotation key %q: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	for _, taint := range p.nodeTaints {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid node taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+		}
+		switch taint.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectNoExecute, v1.TaintEffectPreferNoSchedule:
+		default:
+			return fmt.Errorf("taint effect %q of node taint %s is not supported", taint.Effect, taint.Key)
+		}
+	}
+	return nil
+}
+
+// configureNodeMetadata adds the configured labels, annotations and taints to the node.
+func (p *ACIProvider) configureNodeMetadata(node *v1.Node) {
+	if len(p.nodeLabels) > 0 && node.ObjectMeta.Labels == nil {
+		node.ObjectMeta.Labels = make(map[string]string, len(p.nodeLabels))
+	}
+	for key, value := range p.nodeLabels {
+		node.ObjectMeta.Labels[key] = value
+	}
+
+	if len(p.nodeAnnotations) > 0 && node.ObjectMeta.Annotations == nil {
+		node.ObjectMeta.Annotations = make(map[string]string, len(p.nodeAnnotations))
+	}
+	for key, value := range p.nodeAnnotations {
+		node.ObjectMeta.Annotations[key] = value
+	}
+
+	for _, taint := range p.nodeTaints {
+		exists := false
+		for _, existing := range node.Spec.Taints {
+			if existing.MatchTaint(&taint) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			node.Spec.Taints = append(node.Spec.Taints, taint)
+		}
+	}
+}
+
+func getNodeTaints(taints []nodeTaintConfig) []v1.Taint {
+	result := make([]v1.Taint, 0, len(taints))
+	for _, taint := range taints {
+		result = append(result, v1.Taint{
+			Key:    taint.Key,
+			Value:  taint.Value,
+			Effect: v1.TaintEffect(taint.Effect),
+		})
+	}
+	return result
+}
+
+// parseKeyValuePairs adds comma separated key=value pairs to a map.
+func parseKeyValuePairs(s string, m *map[string]string) error {
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		(*m)[key] = value
+	}
+	return nil
+}
+
+// parseTaint parses a taint in the kubectl format key[=value]:effect.
+func parseTaint(s string) (v1.Taint, error) {
+	keyValue, effect, ok := strings.Cut(s, ":")
+	if !ok || keyValue == "" {
+		return v1.Taint{}, fmt.Errorf("%q is not a taint in the key[=value]:effect format", s)
+	}
+	key, value, _ := strings.Cut(keyValue, "=")
+	return v1.Taint{
+		Key:    key,
+		Value:  value,
+		Effect: v1.TaintEffect(effect),
+	}, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const nodeMetadataCfg = `
+Region = "westus"
+ResourceGroup = "virtual-kubeletrg"
+
+[NodeLabels]
+"example.com/team" = "a"
+
+[NodeAnnotations]
+"example.com/owner" = "team-a@example.com"
+
+[[NodeTaints]]
+Key = "example.com/dedicated"
+Value = "team-a"
+Effect = "NoSchedule"`
+
+func TestConfigureNodeMetadata(t *testing.T) {
+	t.Setenv("ACI_NODE_LABELS", "example.com/tier=batch, kubernetes.io/os=plan9")
+	t.Setenv("ACI_NODE_TAINTS", "example.com/spot:PreferNoSchedule")
+
+	var p ACIProvider
+	assert.NilError(t, p.loadConfig(bytes.NewReader([]byte(nodeMetadataCfg))))
+	assert.NilError(t, p.setupNodeCapacity(context.Background()))
+	assert.NilError(t, p.setupNodeMetadata())
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}}
+	p.ConfigureNode(context.Background(), node)
+
+	assert.Check(t, is.Equal("a", node.Labels["example.com/team"]))
+	assert.Check(t, is.Equal("batch", node.Labels["example.com/tier"]))
+	// the labels set by the provider can't be overridden
+	assert.Check(t, is.Equal("linux", node.Labels["kubernetes.io/os"]))
+	assert.Check(t, is.Equal("amd64", node.Labels["kubernetes.io/arch"]))
+	assert.Check(t, is.Equal("team-a@example.com", node.Annotations["example.com/owner"]))
+	assert.Check(t, is.DeepEqual([]v1.Taint{
+		{Key: "example.com/dedicated", Value: "team-a", Effect: v1.TaintEffectNoSchedule},
+		{Key: "example.com/spot", Effect: v1.TaintEffectPreferNoSchedule},
+	}, node.Spec.Taints))
+}
+
+func TestSetupNodeMetadataErrors(t *testing.T) {
+	cases := []struct {
+		env           string
+		value         string
+		expectedError string
+	}{
+		{env: "ACI_NODE_LABELS", value: "team", expectedError: `"team" is not a key=value pair`},
+		{env: "ACI_NODE_LABELS", value: "team=a b", expectedError: `invalid node label value "a b"`},
+		{env: "ACI_NODE_ANNOTATIONS", value: "=value", expectedError: `"=value" is not a key=value pair`},
+		{env: "ACI_NODE_TAINTS", value: "dedicated=a", expectedError: "is not a taint in the key[=value]:effect format"},
+		{env: "ACI_NODE_TAINTS", value: "dedicated=a:Sometimes", expectedError: `taint effect "Sometimes" of node taint dedicated is not supported`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.env+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			var p ACIProvider
+			assert.Check(t, is.ErrorContains(p.setupNodeMetadata(), tc.expectedError))
+		})
+	}
+}
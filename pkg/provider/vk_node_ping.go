@@ -0,0 +1,147 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// serviceHealthCacheTTL is how long the reachability of ACI is cached, the node controller pings the provider
+	// every ten seconds.
+	serviceHealthCacheTTL = 30 * time.Second
+	// serviceUnreachableThreshold is the number of consecutive failed checks after which the node is not ready,
+	// so that a single failed call doesn't evict the pods of the node.
+	serviceUnreachableThreshold = 2
+
+	nodeReadyReason              = "KubeletReady"
+	nodeServiceUnavailableReason = "ACIServiceUnavailable"
+)
+
+// serviceHealthCheck caches the reachability of the ACI control plane in the regions of the node.
+type serviceHealthCheck struct {
+	lock     sync.Mutex
+	checked  time.Time
+	failures int
+	err      error
+	// changed is signaled when the node switches between ready and not ready.
+	changed chan struct{}
+}
+
+func newServiceHealthCheck() *serviceHealthCheck {
+	return &serviceHealthCheck{changed: make(chan struct{}, 1)}
+}
+
+// Ping implements node.NodeProvider. It checks that the ACI control plane is reachable in the regions of the node,
+// and sets the node not ready while it isn't. The outages of ACI aren't returned, as the node controller stops
+// updating the status of the node while the ping fails, which would hide the not ready condition until the lease
+// of the node expires.
+func (p *ACIProvider) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.serviceHealth != nil {
+		p.checkServiceHealth(ctx, time.Now())
+	}
+	return nil
+}
+
+// checkServiceHealth lists the ACI usage of the regions of the node, a lightweight call, unless the last check is
+// recent, and updates the ready condition of the node when ACI becomes unreachable in all the regions or
+// reachable again.
+func (p *ACIProvider) checkServiceHealth(ctx context.Context, now time.Time) {
+	h := p.serviceHealth
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.checked.IsZero() && now.Sub(h.checked) < serviceHealthCacheTTL {
+		return
+	}
+
+	ctx, span := trace.StartSpan(ctx, "aci.checkServiceHealth")
+	defer span.End()
+	ctx = addAzureAttributes(ctx, span, p)
+
+	regions := p.regions
+	if len(regions) == 0 {
+		regions = []string{p.region}
+	}
+	var errs []string
+	for _, region := range regions {
+		_, err := p.azClientsAPIs.ListUsage(ctx, region)
+		if err == nil || !isServiceUnavailable(err) {
+			errs = nil
+			break
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", region, err))
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// the provider is shutting down
+		return
+	}
+	h.checked = now
+
+	wasReady := h.failures < serviceUnreachableThreshold
+	if len(errs) == 0 {
+		h.failures = 0
+		h.err = nil
+	} else {
+		h.failures++
+		h.err = errors.New(strings.Join(errs, "; "))
+		log.G(ctx).WithError(h.err).Warnf("ACI is unreachable, %d consecutive failed checks", h.failures)
+	}
+	isReady := h.failures < serviceUnreachableThreshold
+	if wasReady == isReady {
+		return
+	}
+
+	ready := newNodeCondition(v1.NodeReady, true, now, nodeReadyReason, "kubelet is ready.")
+	if !isReady {
+		ready = newNodeCondition(v1.NodeReady, false, now, nodeServiceUnavailableReason,
+			fmt.Sprintf("ACI is unreachable: %v", h.err))
+		log.G(ctx).Error("setting the node not ready as ACI is unreachable")
+	} else {
+		log.G(ctx).Info("setting the node ready as ACI is reachable again")
+	}
+	p.nodeLock.Lock()
+	if p.node != nil {
+		setNodeCondition(p.node, ready)
+	}
+	p.nodeLock.Unlock()
+
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+// serviceHealthChanged returns the channel signaled when the node switches between ready and not ready, nil when
+// the reachability of ACI isn't checked.
+func (p *ACIProvider) serviceHealthChanged() <-chan struct{} {
+	if p.serviceHealth == nil {
+		return nil
+	}
+	return p.serviceHealth.changed
+}
+
+// isServiceUnavailable returns whether an error means that ACI is unreachable or failing, rather than rejecting
+// the call of the provider.
+func isServiceUnavailable(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
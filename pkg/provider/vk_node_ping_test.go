@@ -0,0 +1,69 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azaciv2 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPingChecksServiceHealth(t *testing.T) {
+	var usageErr error
+	calls := 0
+	aciMocks := createNewACIMock()
+	aciMocks.MockListUsage = func(ctx context.Context, region string) ([]*azaciv2.Usage, error) {
+		calls++
+		return nil, usageErr
+	}
+	provider := &ACIProvider{
+		azClientsAPIs: aciMocks,
+		region:        fakeRegion,
+		cpu:           "100",
+		memory:        "4Ti",
+		pods:          "50",
+		serviceHealth: newServiceHealthCheck(),
+	}
+	provider.ConfigureNode(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}})
+	ready := func() *v1.NodeCondition {
+		provider.nodeLock.Lock()
+		defer provider.nodeLock.Unlock()
+		return getNodeCondition(provider.node, v1.NodeReady)
+	}
+
+	now := time.Now()
+	usageErr = errors.New("dial tcp: i/o timeout")
+	provider.checkServiceHealth(context.Background(), now)
+	assert.Check(t, is.Equal(v1.ConditionTrue, ready().Status), "a single failed check doesn't set the node not ready")
+
+	// the reachability is cached
+	provider.checkServiceHealth(context.Background(), now.Add(time.Second))
+	assert.Check(t, is.Equal(1, calls))
+
+	now = now.Add(serviceHealthCacheTTL)
+	provider.checkServiceHealth(context.Background(), now)
+	assert.Check(t, is.Equal(v1.ConditionFalse, ready().Status))
+	assert.Check(t, is.Equal(nodeServiceUnavailableReason, ready().Reason))
+	assert.Check(t, is.Len(provider.serviceHealthChanged(), 1))
+	<-provider.serviceHealthChanged()
+
+	// the calls rejected by ARM don't mean that ACI is unreachable
+	now = now.Add(serviceHealthCacheTTL)
+	usageErr = &azcore.ResponseError{StatusCode: http.StatusForbidden}
+	provider.checkServiceHealth(context.Background(), now)
+	assert.Check(t, is.Equal(v1.ConditionTrue, ready().Status))
+	assert.Check(t, is.Len(provider.serviceHealthChanged(), 1))
+
+	assert.NilError(t, provider.Ping(context.Background()))
+}
@@ -197,6 +197,10 @@ func GetPodConditions(creationTime, readyConditionTime v1.Time, readyConditionSt
 			Type:               corev1.PodScheduled,
 			Status:             corev1.ConditionTrue,
 			LastTransitionTime: creationTime,
+		}, {
+			Type:               corev1.ContainersReady,
+			Status:             readyConditionStatus,
+			LastTransitionTime: readyConditionTime,
 		},
 	}
 }
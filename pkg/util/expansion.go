@@ -0,0 +1,72 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the Apache 2.0 license.
+*/
+package util
+
+import (
+	"strings"
+)
+
+const (
+	expansionOperator        = '$'
+	expansionReferenceOpener = '('
+	expansionReferenceCloser = ')'
+)
+
+// ExpansionMappingFor returns the mapping of the variable references of Expand to the values of the first of vars
+// defining them. The references to undefined variables are left unchanged, as the kubelet does.
+func ExpansionMappingFor(vars ...map[string]string) func(string) string {
+	return func(name string) string {
+		for _, values := range vars {
+			if value, ok := values[name]; ok {
+				return value
+			}
+		}
+		return string(expansionOperator) + string(expansionReferenceOpener) + name + string(expansionReferenceCloser)
+	}
+}
+
+// Expand replaces the $(VAR) references of input with the values of mapping, with the semantics of the kubelet
+// for the environment variables, commands and args of containers: $$ escapes the operator, and incomplete
+// references are left unchanged.
+func Expand(input string, mapping func(string) string) string {
+	var buf strings.Builder
+	checkpoint := 0
+	for cursor := 0; cursor < len(input); cursor++ {
+		if input[cursor] != expansionOperator || cursor+1 >= len(input) {
+			continue
+		}
+		buf.WriteString(input[checkpoint:cursor])
+		read, isVar, advance := readVariableName(input[cursor+1:])
+		if isVar {
+			buf.WriteString(mapping(read))
+		} else {
+			buf.WriteString(read)
+		}
+		cursor += advance
+		checkpoint = cursor + 1
+	}
+	return buf.String() + input[checkpoint:]
+}
+
+// readVariableName reads the variable reference following an operator, and returns the content read, whether it
+// is a variable name and the number of bytes consumed.
+func readVariableName(input string) (string, bool, int) {
+	switch input[0] {
+	case expansionOperator:
+		// escaped operator
+		return input[0:1], false, 1
+	case expansionReferenceOpener:
+		for i := 1; i < len(input); i++ {
+			if input[i] == expansionReferenceCloser {
+				return input[1:i], true, i + 1
+			}
+		}
+		// incomplete reference
+		return string(expansionOperator) + string(expansionReferenceOpener), false, 1
+	default:
+		// operator not followed by a reference
+		return string(expansionOperator) + string(input[0]), false, 1
+	}
+}
@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// azureFileDriverName is the only CSI driver whose volumes ACI can mount.
+const azureFileDriverName = "file.csi.azure.com"
+
+// PodOptions are the optional capabilities the pods are validated against.
+type PodOptions struct {
+	// AllowPrivileged accepts the privileged containers, which are rejected by default as the provider doesn't
+	// grant them any privilege on ACI.
+	AllowPrivileged bool
+	// HostPathPrefixes are the host paths redirected to Azure Files shares by the HostPathMappings of the
+	// provider config, the hostPath volumes under them are accepted.
+	HostPathPrefixes []string
+}
+
+// ValidatePod checks a pod against the capabilities of ACI, so that the pods ACI can't run can be rejected at
+// admission rather than failing once they're bound to the node. It returns the fields of the pod ACI doesn't
+// support.
+func ValidatePod(pod *v1.Pod, opts PodOptions) field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if pod.Spec.HostNetwork {
+		errs = append(errs, field.Forbidden(spec.Child("hostNetwork"), "ACI doesn't support host networking"))
+	}
+	if pod.Spec.HostPID {
+		errs = append(errs, field.Forbidden(spec.Child("hostPID"), "ACI doesn't share the process namespace of the host"))
+	}
+	if pod.Spec.HostIPC {
+		errs = append(errs, field.Forbidden(spec.Child("hostIPC"), "ACI doesn't share the IPC namespace of the host"))
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		errs = append(errs, validateSeccompProfile(sc.SeccompProfile, spec.Child("securityContext", "seccompProfile"))...)
+	}
+
+	volumes := make(map[string]v1.Volume, len(pod.Spec.Volumes))
+	for i, volume := range pod.Spec.Volumes {
+		volumes[volume.Name] = volume
+		errs = append(errs, validateVolume(volume, spec.Child("volumes").Index(i), opts)...)
+	}
+	for i, container := range pod.Spec.InitContainers {
+		path := spec.Child("initContainers").Index(i)
+		errs = append(errs, validateContainer(container, path, volumes, opts)...)
+		if len(container.Ports) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("ports"), "ACI init containers don't support ports"))
+		}
+		if len(container.Resources.Requests) > 0 || len(container.Resources.Limits) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("resources"), "ACI init containers don't support resources"))
+		}
+		if container.LivenessProbe != nil {
+			errs = append(errs, field.Forbidden(path.Child("livenessProbe"), "ACI init containers don't support probes"))
+		}
+		if container.ReadinessProbe != nil {
+			errs = append(errs, field.Forbidden(path.Child("readinessProbe"), "ACI init containers don't support probes"))
+		}
+	}
+	for i, container := range pod.Spec.Containers {
+		path := spec.Child("containers").Index(i)
+		errs = append(errs, validateContainer(container, path, volumes, opts)...)
+		errs = append(errs, validateProbe(container.LivenessProbe, path.Child("livenessProbe"))...)
+		errs = append(errs, validateProbe(container.ReadinessProbe, path.Child("readinessProbe"))...)
+		errs = append(errs, validateProbe(container.StartupProbe, path.Child("startupProbe"))...)
+	}
+	return errs
+}
+
+func validateContainer(container v1.Container, path *field.Path, volumes map[string]v1.Volume, opts PodOptions) field.ErrorList {
+	var errs field.ErrorList
+	for i, port := range container.Ports {
+		if port.HostPort != 0 {
+			errs = append(errs, field.Forbidden(path.Child("ports").Index(i).Child("hostPort"), "ACI doesn't support host ports"))
+		}
+	}
+	// the provider only emulates the subPath mounts of a file of the secret, configMap and projected volumes
+	for i, mount := range container.VolumeMounts {
+		mountPath := path.Child("volumeMounts").Index(i)
+		if mount.SubPathExpr != "" {
+			errs = append(errs, field.Forbidden(mountPath.Child("subPathExpr"), "ACI doesn't support subPathExpr"))
+		}
+		if volume := volumes[mount.Name]; mount.SubPath != "" && volume.Secret == nil && volume.ConfigMap == nil && volume.Projected == nil {
+			errs = append(errs, field.Forbidden(mountPath.Child("subPath"), "ACI only supports the subPath of secret, configMap and projected volumes"))
+		}
+	}
+
+	sc := container.SecurityContext
+	if sc == nil {
+		return errs
+	}
+	scPath := path.Child("securityContext")
+	if sc.Privileged != nil && *sc.Privileged && !opts.AllowPrivileged {
+		errs = append(errs, field.Forbidden(scPath.Child("privileged"), "privileged containers aren't allowed on ACI"))
+	}
+	if sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem {
+		errs = append(errs, field.Forbidden(scPath.Child("readOnlyRootFilesystem"), "ACI doesn't support read-only root filesystems"))
+	}
+	return append(errs, validateSeccompProfile(sc.SeccompProfile, scPath.Child("seccompProfile"))...)
+}
+
+func validateSeccompProfile(profile *v1.SeccompProfile, path *field.Path) field.ErrorList {
+	if profile == nil || profile.Type == v1.SeccompProfileTypeRuntimeDefault {
+		return nil
+	}
+	return field.ErrorList{field.NotSupported(path.Child("type"), profile.Type, []string{string(v1.SeccompProfileTypeRuntimeDefault)})}
+}
+
+// validateProbe checks that a probe has one of the exec and httpGet handlers, the only ones of ACI.
+func validateProbe(probe *v1.Probe, path *field.Path) field.ErrorList {
+	if probe == nil {
+		return nil
+	}
+	switch {
+	case probe.TCPSocket != nil:
+		return field.ErrorList{field.Forbidden(path.Child("tcpSocket"), "ACI only supports the exec and httpGet probes")}
+	case probe.GRPC != nil:
+		return field.ErrorList{field.Forbidden(path.Child("grpc"), "ACI only supports the exec and httpGet probes")}
+	}
+	return nil
+}
+
+// validateVolume checks that a volume is of one of the types the provider mounts in the container groups.
+func validateVolume(volume v1.Volume, path *field.Path, opts PodOptions) field.ErrorList {
+	switch {
+	case volume.AzureFile != nil, volume.EmptyDir != nil, volume.GitRepo != nil, volume.Secret != nil,
+		volume.ConfigMap != nil, volume.Projected != nil:
+		return nil
+	case volume.CSI != nil:
+		if volume.CSI.Driver == azureFileDriverName {
+			if protocol := volume.CSI.VolumeAttributes["protocol"]; protocol != "" && !strings.EqualFold(protocol, "smb") {
+				return field.ErrorList{field.NotSupported(path.Child("csi", "volumeAttributes").Key("protocol"), protocol, []string{"smb"})}
+			}
+			return nil
+		}
+		return field.ErrorList{field.NotSupported(path.Child("csi", "driver"), volume.CSI.Driver, []string{azureFileDriverName})}
+	case volume.HostPath != nil:
+		if isMappedHostPath(volume.HostPath.Path, opts.HostPathPrefixes) {
+			return nil
+		}
+		return field.ErrorList{field.Forbidden(path.Child("hostPath"), "ACI doesn't give access to the filesystem of the host")}
+	}
+	return field.ErrorList{field.Forbidden(path, "ACI only supports the azureFile, emptyDir, gitRepo, secret, configMap, "+
+		"projected and Azure File CSI volumes")}
+}
+
+func isMappedHostPath(hostPath string, prefixes []string) bool {
+	hostPath = path.Clean(hostPath)
+	for _, prefix := range prefixes {
+		prefix = path.Clean(prefix)
+		if hostPath == prefix || prefix == "/" || strings.HasPrefix(hostPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
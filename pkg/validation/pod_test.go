@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestValidatePod(t *testing.T) {
+	privileged := true
+
+	cases := []struct {
+		description    string
+		spec           v1.PodSpec
+		opts           PodOptions
+		expectedFields []string
+	}{
+		{
+			description: "supported pod",
+			spec: v1.PodSpec{
+				Volumes: []v1.Volume{
+					{Name: "data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+					{Name: "files", VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{Driver: azureFileDriverName}}},
+				},
+				Containers: []v1.Container{{
+					Name:  "c",
+					Ports: []v1.ContainerPort{{ContainerPort: 80}},
+					LivenessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{
+						HTTPGet: &v1.HTTPGetAction{Port: intstr.FromInt(80)},
+					}},
+				}},
+			},
+		},
+		{
+			description: "host namespaces and ports",
+			spec: v1.PodSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				Containers:  []v1.Container{{Name: "c", Ports: []v1.ContainerPort{{ContainerPort: 80, HostPort: 80}}}},
+			},
+			expectedFields: []string{"spec.hostNetwork", "spec.hostPID", "spec.containers[0].ports[0].hostPort"},
+		},
+		{
+			description: "unsupported volumes",
+			spec: v1.PodSpec{
+				Volumes: []v1.Volume{
+					{Name: "host", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log"}}},
+					{Name: "disk", VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{Driver: "disk.csi.azure.com"}}},
+					{Name: "claim", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "claim"}}},
+					{Name: "nfs", VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{
+						Driver:           azureFileDriverName,
+						VolumeAttributes: map[string]string{"protocol": "nfs"},
+					}}},
+				},
+				Containers: []v1.Container{{Name: "c"}},
+			},
+			expectedFields: []string{"spec.volumes[0].hostPath", "spec.volumes[1].csi.driver", "spec.volumes[2]", "spec.volumes[3].csi.volumeAttributes[protocol]"},
+		},
+		{
+			description: "mapped host path",
+			spec: v1.PodSpec{
+				Volumes: []v1.Volume{
+					{Name: "logs", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log/pods"}}},
+					{Name: "lib", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/lib"}}},
+				},
+				Containers: []v1.Container{{Name: "c"}},
+			},
+			opts:           PodOptions{HostPathPrefixes: []string{"/var/log"}},
+			expectedFields: []string{"spec.volumes[1].hostPath"},
+		},
+		{
+			description: "subPath mounts",
+			spec: v1.PodSpec{
+				Volumes: []v1.Volume{
+					{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+					{Name: "data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				},
+				Containers: []v1.Container{{Name: "c", VolumeMounts: []v1.VolumeMount{
+					{Name: "config", MountPath: "/etc/nginx/nginx.conf", SubPath: "nginx.conf"},
+					{Name: "data", MountPath: "/data", SubPath: "c"},
+					{Name: "data", MountPath: "/logs", SubPathExpr: "$(POD_NAME)"},
+				}}},
+			},
+			expectedFields: []string{"spec.containers[0].volumeMounts[1].subPath", "spec.containers[0].volumeMounts[2].subPathExpr"},
+		},
+		{
+			description: "privileged container",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "c", SecurityContext: &v1.SecurityContext{Privileged: &privileged}}},
+			},
+			expectedFields: []string{"spec.containers[0].securityContext.privileged"},
+		},
+		{
+			description: "allowed privileged container",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "c", SecurityContext: &v1.SecurityContext{Privileged: &privileged}}},
+			},
+			opts: PodOptions{AllowPrivileged: true},
+		},
+		{
+			description: "unsupported probes",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{{
+					Name: "c",
+					ReadinessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{
+						TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(80)},
+					}},
+					StartupProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{GRPC: &v1.GRPCAction{Port: 80}}},
+				}},
+			},
+			expectedFields: []string{"spec.containers[0].readinessProbe.tcpSocket", "spec.containers[0].startupProbe.grpc"},
+		},
+		{
+			description: "init container with probes and resources",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{
+					Name:          "init",
+					Resources:     v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+					LivenessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"true"}}}},
+				}},
+				Containers: []v1.Container{{Name: "c"}},
+			},
+			expectedFields: []string{"spec.initContainers[0].resources", "spec.initContainers[0].livenessProbe"},
+		},
+		{
+			description: "seccomp profile",
+			spec: v1.PodSpec{
+				SecurityContext: &v1.PodSecurityContext{SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeUnconfined}},
+				Containers:      []v1.Container{{Name: "c"}},
+			},
+			expectedFields: []string{"spec.securityContext.seccompProfile.type"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}, Spec: tc.spec}
+
+			var fields []string
+			for _, err := range ValidatePod(pod, tc.opts) {
+				fields = append(fields, err.Field)
+			}
+			assert.Check(t, is.DeepEqual(tc.expectedFields, fields))
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxAdmissionReviewSize bounds the admission reviews the webhook decodes, the API server sends them up to 3MiB.
+const maxAdmissionReviewSize = 3 << 20
+
+// NewWebhookHandler returns a validating admission webhook rejecting the pods ACI doesn't support. The webhook
+// validates every pod it receives, so its configuration should only select the pods scheduled on the virtual
+// nodes, e.g. with an object selector.
+func NewWebhookHandler(opts PodOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		review := admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdmissionReviewSize)).Decode(&review); err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode the admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "the admission review has no request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = admitPod(review.Request, opts)
+		review.Response.UID = review.Request.UID
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(review); err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode the admission review: %v", err), http.StatusInternalServerError)
+		}
+	})
+}
+
+func admitPod(req *admissionv1.AdmissionRequest, opts PodOptions) *admissionv1.AdmissionResponse {
+	if req.Resource.Group != "" || req.Resource.Resource != "pods" || req.SubResource != "" {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	pod := v1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("failed to decode the pod: %v", err),
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+			},
+		}
+	}
+
+	errs := ValidatePod(&pod, opts)
+	if len(errs) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	return &admissionv1.AdmissionResponse{
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("the pod can't run on Azure Container Instances: %v", errs.ToAggregate()),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	review := func(pod *v1.Pod) *admissionv1.AdmissionReview {
+		t.Helper()
+		raw, err := json.Marshal(pod)
+		assert.NilError(t, err)
+
+		body, err := json.Marshal(admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{
+				UID:       "uid",
+				Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		assert.NilError(t, err)
+
+		w := httptest.NewRecorder()
+		NewWebhookHandler(PodOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate-pods", bytes.NewReader(body)))
+		assert.Equal(t, w.Code, http.StatusOK)
+
+		resp := &admissionv1.AdmissionReview{}
+		assert.NilError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Assert(t, resp.Response != nil)
+		assert.Check(t, is.Equal(resp.Response.UID, types.UID("uid")))
+		return resp
+	}
+
+	supported := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p"}, Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c"}}}}
+	assert.Check(t, review(supported).Response.Allowed)
+
+	unsupported := supported.DeepCopy()
+	unsupported.Spec.HostNetwork = true
+	resp := review(unsupported)
+	assert.Check(t, !resp.Response.Allowed)
+	assert.Check(t, is.Equal(resp.Response.Result.Code, int32(http.StatusUnprocessableEntity)))
+	assert.Check(t, is.Contains(resp.Response.Result.Message, "spec.hostNetwork"))
+}